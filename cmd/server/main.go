@@ -18,6 +18,10 @@ import (
 
 func main() {
 
+	if len(os.Args) > 1 && os.Args[1] == "migrate-prefixes" {
+		os.Exit(migratePrefixes(os.Args[2:]))
+	}
+
 	cfg := api.DefaultServerConfigFromEnv()
 
 	zerolog.TimeFieldFormat = time.RFC3339Nano
@@ -48,6 +52,17 @@ func main() {
 		}
 	}()
 
+	// with INTEGRESQL_LAZY_CONNECT, requests are accepted (and held) while the manager is initialized in background
+	if cfg.LazyConnect {
+		go func() {
+			if err := s.AwaitManager(context.Background()); err != nil {
+				log.Fatal().Err(err).Msg("Failed to initialize manager")
+			}
+
+			log.Info().Msg("Manager ready, releasing held requests")
+		}()
+	}
+
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
 	<-quit
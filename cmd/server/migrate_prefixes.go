@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/allaboutapps/integresql/pkg/client"
+	"github.com/allaboutapps/integresql/pkg/manager"
+	"github.com/allaboutapps/integresql/pkg/util"
+)
+
+// migratePrefixes implements the "migrate-prefixes" command, which triggers the prefix migration of a running server
+// via its admin API (the databases are tracked by the server) and prints the summary as JSON.
+// Usage: integresql migrate-prefixes [-dry-run] [-token admin-token] [-ca-file cert.pem] [-from-db-prefix integresql] [-from-template-db-prefix template] [-from-test-db-prefix test]
+func migratePrefixes(args []string) int {
+	flags := flag.NewFlagSet("migrate-prefixes", flag.ContinueOnError)
+
+	var from manager.PrefixScheme
+	flags.StringVar(&from.DatabasePrefix, "from-db-prefix", "integresql", "previous INTEGRESQL_DB_PREFIX")
+	flags.StringVar(&from.TemplateDatabasePrefix, "from-template-db-prefix", "template", "previous INTEGRESQL_TEMPLATE_DB_PREFIX")
+	flags.StringVar(&from.TestDatabasePrefix, "from-test-db-prefix", "test", "previous INTEGRESQL_TEST_DB_PREFIX")
+	dryRun := flags.Bool("dry-run", false, "only print the planned actions")
+	// the admin routes are served on INTEGRESQL_ADMIN_PORT if configured
+	port := util.GetEnvAsInt("INTEGRESQL_ADMIN_PORT", 0)
+	if port <= 0 {
+		port = util.GetEnvAsInt("INTEGRESQL_PORT", 5000)
+	}
+	// the server terminates TLS if configured, its (self-signed) certificate is trusted by default
+	scheme := "http"
+	if len(util.GetEnv("INTEGRESQL_TLS_CERT_FILE", "")) > 0 {
+		scheme = "https"
+	}
+	baseURL := flags.String("url", fmt.Sprintf("%s://127.0.0.1:%d/api", scheme, port), "base URL of the running server")
+	caFile := flags.String("ca-file", util.GetEnv("INTEGRESQL_TLS_CERT_FILE", ""), "PEM CA certificates trusted in addition to the system ones")
+	timeout := flags.Duration("timeout", 5*time.Minute, "timeout of the migration")
+	// the admin routes require an admin token if any token is configured
+	token := flags.String("token", util.GetEnvAsStringArr("INTEGRESQL_ADMIN_TOKENS", []string{""})[0], "admin bearer token of the running server")
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	body, err := json.Marshal(map[string]interface{}{"from": from, "dryRun": *dryRun})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(*baseURL, "/")+"/v1/admin/migrate-prefixes", bytes.NewReader(body))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if len(*token) > 0 {
+		req.Header.Set("Authorization", "Bearer "+*token)
+	}
+
+	httpClient := http.DefaultClient
+	if strings.HasPrefix(*baseURL, "https://") && len(*caFile) > 0 {
+		if httpClient, err = client.NewHTTPClient(*caFile); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+
+	res, err := httpClient.Do(req)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer res.Body.Close()
+
+	msg, err := io.ReadAll(res.Body)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	if res.StatusCode != http.StatusOK {
+		fmt.Fprintf(os.Stderr, "migration failed with status %d: %s\n", res.StatusCode, strings.TrimSpace(string(msg)))
+		return 1
+	}
+
+	var summary manager.PrefixMigrationSummary
+	if err := json.Unmarshal(msg, &summary); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	out, _ := json.MarshalIndent(summary, "", "  ")
+	fmt.Println(string(out))
+
+	if summary.Failed() {
+		return 1
+	}
+
+	return 0
+}
@@ -1,15 +1,50 @@
 package admin
 
 import (
+	"errors"
 	"net/http"
+	"time"
 
 	"github.com/allaboutapps/integresql/internal/api"
+	"github.com/allaboutapps/integresql/pkg/manager"
 	"github.com/labstack/echo/v4"
 )
 
+// getTemplates lists the templates currently tracked by the manager along with a summary of their pools.
+func getTemplates(s *api.Server) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		list, err := s.Manager.ListTemplates(c.Request().Context())
+		if err != nil {
+			if errors.Is(err, manager.ErrManagerNotReady) {
+				return echo.ErrServiceUnavailable
+			}
+
+			// default 500
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+
+		list, err = paginate(c, list)
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(http.StatusOK, list)
+	}
+}
+
 func deleteResetAllTemplates(s *api.Server) echo.HandlerFunc {
 	return func(c echo.Context) error {
 		ctx := c.Request().Context()
+
+		// ?label=<label> only resets the templates with this label
+		if label := c.QueryParam("label"); len(label) > 0 {
+			if err := s.Manager.ResetTrackingWithLabel(ctx, label); err != nil {
+				return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+			}
+
+			return c.NoContent(http.StatusNoContent)
+		}
+
 		if err := s.Manager.ResetAllTracking(ctx); err != nil {
 			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
 		}
@@ -17,3 +52,106 @@ func deleteResetAllTemplates(s *api.Server) echo.HandlerFunc {
 		return c.NoContent(http.StatusNoContent)
 	}
 }
+
+func getStats(s *api.Server) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		stats, err := s.Manager.Stats(c.Request().Context())
+		if err != nil {
+			if errors.Is(err, manager.ErrManagerNotReady) {
+				return echo.ErrServiceUnavailable
+			}
+
+			// default 500
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+
+		// the number of pools grows with the number of templates, ?offset= and ?limit= apply to them
+		stats.Pools, err = paginate(c, stats.Pools)
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(http.StatusOK, &stats)
+	}
+}
+
+// getStatsHistory returns the trend of the pool utilization, optionally since ?since= (RFC 3339) and downsampled into
+// steps of ?step= (e.g. "5m").
+func getStatsHistory(s *api.Server) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		since, err := queryParamAsTime(c, "since")
+		if err != nil {
+			return err
+		}
+
+		var step time.Duration
+		if param := c.QueryParam("step"); len(param) > 0 {
+			if step, err = time.ParseDuration(param); err != nil || step < 0 {
+				return echo.NewHTTPError(http.StatusBadRequest, "step must be a positive duration (e.g. 5m)")
+			}
+		}
+
+		points, err := s.Manager.StatsHistory(c.Request().Context(), since, step)
+		if err != nil {
+			if errors.Is(err, manager.ErrStatsHistoryDisabled) {
+				return echo.NewHTTPError(http.StatusNotFound, err.Error())
+			}
+
+			// default 500
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+
+		points, err = paginate(c, points)
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(http.StatusOK, points)
+	}
+}
+
+// getCapacity returns the resource use of all templates and the estimated headroom of the backend.
+func getCapacity(s *api.Server) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		capacity, err := s.Manager.Capacity(c.Request().Context())
+		if err != nil {
+			if errors.Is(err, manager.ErrManagerNotReady) {
+				return echo.ErrServiceUnavailable
+			}
+
+			// default 500
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+
+		return c.JSON(http.StatusOK, &capacity)
+	}
+}
+
+// getShutdownReport returns the databases left behind by the last shutdown (see INTEGRESQL_SHUTDOWN_REPORT_RETENTION_MS)
+// or, while still running, a preview of what shutting down now would leave behind.
+func getShutdownReport(s *api.Server) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		report, err := s.Manager.ShutdownReport(c.Request().Context())
+		if err != nil {
+			if errors.Is(err, manager.ErrManagerNotReady) {
+				return echo.ErrServiceUnavailable
+			}
+
+			// default 500
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+
+		return c.JSON(http.StatusOK, &report)
+	}
+}
+
+func getEvents(s *api.Server) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		events, err := paginate(c, s.Manager.RecentEvents(c.Request().Context()))
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(http.StatusOK, events)
+	}
+}
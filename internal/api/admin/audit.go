@@ -0,0 +1,56 @@
+package admin
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/allaboutapps/integresql/internal/api"
+	"github.com/allaboutapps/integresql/pkg/audit"
+	"github.com/labstack/echo/v4"
+)
+
+// getAudit queries the audit store (see ServerConfig.AuditFile) via the optional ?since= and ?until= (RFC 3339),
+// ?action=, ?hash= and ?token= (fingerprint) query params, oldest first.
+func getAudit(s *api.Server) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if s.Audit == nil {
+			return echo.NewHTTPError(http.StatusNotFound, "audit store is disabled")
+		}
+
+		query := audit.Query{
+			Action: audit.Action(c.QueryParam("action")),
+			Hash:   c.QueryParam("hash"),
+			Token:  c.QueryParam("token"),
+		}
+
+		var err error
+		if query.Since, err = queryParamAsTime(c, "since"); err != nil {
+			return err
+		}
+
+		if query.Until, err = queryParamAsTime(c, "until"); err != nil {
+			return err
+		}
+
+		entries, err := paginate(c, s.Audit.Query(query))
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(http.StatusOK, entries)
+	}
+}
+
+func queryParamAsTime(c echo.Context, name string) (time.Time, error) {
+	param := c.QueryParam(name)
+	if len(param) == 0 {
+		return time.Time{}, nil
+	}
+
+	val, err := time.Parse(time.RFC3339, param)
+	if err != nil {
+		return time.Time{}, echo.NewHTTPError(http.StatusBadRequest, name+" must be a RFC 3339 timestamp")
+	}
+
+	return val, nil
+}
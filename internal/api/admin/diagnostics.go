@@ -0,0 +1,96 @@
+package admin
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"runtime/pprof"
+	"time"
+
+	"github.com/allaboutapps/integresql/internal/api"
+	"github.com/labstack/echo/v4"
+)
+
+// getDiagnostics gathers everything useful for a bug report into a single tarball: stats, recent events (including the
+// exceeded checkout durations), goroutine dumps, the sanitized configs and pg_stat snapshots of all managed databases.
+// Failing parts don't fail the bundle, their error is included as errors.txt instead.
+func getDiagnostics(s *api.Server) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		ctx := c.Request().Context()
+		now := time.Now().UTC()
+
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		tw := tar.NewWriter(gz)
+
+		addFile := func(name string, content []byte) error {
+			if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(content)), ModTime: now}); err != nil {
+				return err
+			}
+
+			_, err := tw.Write(content)
+			return err
+		}
+
+		var errs bytes.Buffer
+		addJSON := func(name string, v interface{}, err error) error {
+			if err != nil {
+				fmt.Fprintf(&errs, "%s: %v\n", name, err)
+			}
+
+			b, err := json.MarshalIndent(v, "", "  ")
+			if err != nil {
+				fmt.Fprintf(&errs, "%s: failed to marshal: %v\n", name, err)
+				return nil
+			}
+
+			return addFile(name, b)
+		}
+
+		stats, err := s.Manager.Stats(ctx)
+		if err := addJSON("stats.json", stats, err); err != nil {
+			return err
+		}
+
+		if err := addJSON("events.json", s.Manager.RecentEvents(ctx), nil); err != nil {
+			return err
+		}
+
+		diagnostics, err := s.Manager.Diagnostics(ctx)
+		if err := addJSON("manager.json", diagnostics, err); err != nil {
+			return err
+		}
+
+		if err := addJSON("server_config.json", s.Config, nil); err != nil {
+			return err
+		}
+
+		var goroutines bytes.Buffer
+		if err := pprof.Lookup("goroutine").WriteTo(&goroutines, 2); err != nil {
+			fmt.Fprintf(&errs, "goroutines.txt: %v\n", err)
+		}
+		if err := addFile("goroutines.txt", goroutines.Bytes()); err != nil {
+			return err
+		}
+
+		if errs.Len() > 0 {
+			if err := addFile("errors.txt", errs.Bytes()); err != nil {
+				return err
+			}
+		}
+
+		if err := tw.Close(); err != nil {
+			return err
+		}
+		if err := gz.Close(); err != nil {
+			return err
+		}
+
+		c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", "integresql-diagnostics-"+now.Format("20060102T150405Z")+".tar.gz"))
+
+		return c.Blob(http.StatusOK, "application/gzip", buf.Bytes())
+	}
+}
@@ -0,0 +1,51 @@
+package admin
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+const headerTotalCount = "X-Total-Count"
+
+// paginate applies the optional ?offset= and ?limit= query params to the items and sets the X-Total-Count header.
+// Without a limit all items starting at the offset are returned.
+func paginate[T any](c echo.Context, items []T) ([]T, error) {
+	offset, err := queryParamAsNonNegativeInt(c, "offset", 0)
+	if err != nil {
+		return nil, err
+	}
+
+	limit, err := queryParamAsNonNegativeInt(c, "limit", len(items))
+	if err != nil {
+		return nil, err
+	}
+
+	c.Response().Header().Set(headerTotalCount, strconv.Itoa(len(items)))
+
+	if offset > len(items) {
+		offset = len(items)
+	}
+
+	end := offset + limit
+	if end > len(items) || end < offset /* overflow */ {
+		end = len(items)
+	}
+
+	return items[offset:end], nil
+}
+
+func queryParamAsNonNegativeInt(c echo.Context, name string, defaultVal int) (int, error) {
+	param := c.QueryParam(name)
+	if len(param) == 0 {
+		return defaultVal, nil
+	}
+
+	val, err := strconv.Atoi(param)
+	if err != nil || val < 0 {
+		return 0, echo.NewHTTPError(http.StatusBadRequest, name+" must be a non-negative integer")
+	}
+
+	return val, nil
+}
@@ -0,0 +1,41 @@
+package admin
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/allaboutapps/integresql/internal/api"
+	"github.com/allaboutapps/integresql/pkg/manager"
+	"github.com/labstack/echo/v4"
+)
+
+// postMigratePrefixes moves the databases of a previous prefix scheme to the current one (see manager.MigratePrefixes).
+func postMigratePrefixes(s *api.Server) echo.HandlerFunc {
+	type requestPayload struct {
+		From   manager.PrefixScheme `json:"from"`
+		DryRun bool                 `json:"dryRun"`
+	}
+
+	return func(c echo.Context) error {
+		var payload requestPayload
+
+		if err := c.Bind(&payload); err != nil {
+			return err
+		}
+
+		summary, err := s.Manager.MigratePrefixes(c.Request().Context(), payload.From, payload.DryRun)
+		if err != nil {
+			if errors.Is(err, manager.ErrManagerNotReady) {
+				return echo.ErrServiceUnavailable
+			} else if errors.Is(err, manager.ErrInvalidPrefixMigration) {
+				return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+			}
+
+			// default 500
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+
+		// failures of single databases are part of the summary
+		return c.JSON(http.StatusOK, &summary)
+	}
+}
@@ -3,7 +3,32 @@ package admin
 import "github.com/allaboutapps/integresql/internal/api"
 
 func InitRoutes(s *api.Server) {
-	g := s.Echo.Group("/api/v1/admin")
+	g := s.AdminRouter().Group("/api/v1/admin")
 
-	g.DELETE("/templates", deleteResetAllTemplates(s))
+	destructive := s.RouteMiddlewares(api.RouteGroupAdmin, true)
+	regular := s.RouteMiddlewares(api.RouteGroupAdmin, false)
+
+	g.GET("/templates", getTemplates(s), regular...)
+	g.DELETE("/templates", deleteResetAllTemplates(s), destructive...)
+	g.POST("/migrate-prefixes", postMigratePrefixes(s), destructive...)
+	g.POST("/templates/:hash/migration", postTemplateMigration(s), destructive...)
+	g.GET("/templates/:hash/migration", getTemplateMigration(s), regular...)
+	g.PUT("/templates/:hash/pool", putTemplatePool(s), destructive...)
+	g.POST("/templates/:hash/tests/:id/freeze", postFreezeTestDatabase(s), destructive...)
+	g.DELETE("/templates/:hash/tests/:id/freeze", deleteFreezeTestDatabase(s), destructive...)
+	g.GET("/stats", getStats(s), regular...)
+	g.GET("/stats/history", getStatsHistory(s), regular...)
+	g.GET("/events", getEvents(s), regular...)
+	g.GET("/capacity", getCapacity(s), regular...)
+	g.GET("/schedules", getSchedules(s), regular...)
+
+	// scheduled tasks drop databases and discard templates
+	g.POST("/schedules", postSchedule(s), destructive...)
+	g.DELETE("/schedules/:id", deleteSchedule(s), destructive...)
+	g.POST("/schedules/:id/run", postRunSchedule(s), destructive...)
+
+	// not destructive, but exposes internals (configs, queries), thus restricted the same way
+	g.GET("/diagnostics", getDiagnostics(s), destructive...)
+	g.GET("/shutdown-report", getShutdownReport(s), destructive...)
+	g.GET("/audit", getAudit(s), destructive...)
 }
@@ -0,0 +1,94 @@
+package admin
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/allaboutapps/integresql/internal/api"
+	"github.com/allaboutapps/integresql/pkg/manager"
+	"github.com/labstack/echo/v4"
+)
+
+func getSchedules(s *api.Server) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		return c.JSON(http.StatusOK, s.Manager.ScheduledTasks(c.Request().Context()))
+	}
+}
+
+// postSchedule adds a recurring admin task (see manager.ScheduleTask).
+func postSchedule(s *api.Server) echo.HandlerFunc {
+	type requestPayload struct {
+		Cron      string                     `json:"cron"`
+		Operation manager.ScheduledOperation `json:"operation"`
+		Hash      string                     `json:"hash"`
+	}
+
+	return func(c echo.Context) error {
+		var payload requestPayload
+
+		if err := c.Bind(&payload); err != nil {
+			return err
+		}
+
+		task, err := s.Manager.ScheduleTask(c.Request().Context(), manager.ScheduledTask{
+			Cron:      payload.Cron,
+			Operation: payload.Operation,
+			Hash:      payload.Hash,
+		})
+		if err != nil {
+			if errors.Is(err, manager.ErrInvalidScheduledTask) {
+				return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+			}
+
+			// default 500
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+
+		return c.JSON(http.StatusCreated, &task)
+	}
+}
+
+func deleteSchedule(s *api.Server) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "scheduled task ID malformed")
+		}
+
+		if err := s.Manager.UnscheduleTask(c.Request().Context(), id); err != nil {
+			if errors.Is(err, manager.ErrScheduledTaskNotFound) {
+				return echo.NewHTTPError(http.StatusNotFound, "scheduled task not found")
+			}
+
+			// default 500
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+
+		return c.NoContent(http.StatusNoContent)
+	}
+}
+
+// postRunSchedule executes the scheduled task right away, the result of the run is part of the returned task.
+func postRunSchedule(s *api.Server) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "scheduled task ID malformed")
+		}
+
+		task, err := s.Manager.RunScheduledTask(c.Request().Context(), id)
+		if err != nil {
+			if errors.Is(err, manager.ErrManagerNotReady) {
+				return echo.ErrServiceUnavailable
+			} else if errors.Is(err, manager.ErrScheduledTaskNotFound) {
+				return echo.NewHTTPError(http.StatusNotFound, "scheduled task not found")
+			}
+
+			// default 500
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+
+		return c.JSON(http.StatusOK, &task)
+	}
+}
@@ -0,0 +1,66 @@
+package admin
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/allaboutapps/integresql/internal/api"
+	"github.com/allaboutapps/integresql/pkg/manager"
+	"github.com/labstack/echo/v4"
+)
+
+// postTemplateMigration starts moving the pool of a template to another server (see manager.MigrateTemplate).
+func postTemplateMigration(s *api.Server) echo.HandlerFunc {
+	type requestPayload struct {
+		Host string `json:"host"`
+	}
+
+	return func(c echo.Context) error {
+		hash := c.Param("hash")
+
+		var payload requestPayload
+
+		if err := c.Bind(&payload); err != nil {
+			return err
+		}
+
+		if len(payload.Host) == 0 {
+			return echo.NewHTTPError(http.StatusBadRequest, "host is required")
+		}
+
+		migration, err := s.Manager.MigrateTemplate(c.Request().Context(), hash, payload.Host)
+		if err != nil {
+			if errors.Is(err, manager.ErrManagerNotReady) {
+				return echo.ErrServiceUnavailable
+			} else if errors.Is(err, manager.ErrTemplateNotFound) {
+				return api.NewHTTPError(http.StatusNotFound, "template not found", err)
+			} else if errors.Is(err, manager.ErrInvalidTemplateState) {
+				return api.NewHTTPError(http.StatusConflict, err.Error(), err)
+			} else if errors.Is(err, manager.ErrInvalidMigration) {
+				return api.NewHTTPError(http.StatusBadRequest, err.Error(), err)
+			}
+
+			// default 500
+			return api.NewHTTPError(http.StatusInternalServerError, err.Error(), err)
+		}
+
+		// copied and drained in background
+		return c.JSON(http.StatusAccepted, &migration)
+	}
+}
+
+func getTemplateMigration(s *api.Server) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		migration, err := s.Manager.TemplateMigrationStatus(c.Request().Context(), c.Param("hash"))
+		if err != nil {
+			if errors.Is(err, manager.ErrMigrationNotFound) {
+				return api.NewHTTPError(http.StatusNotFound, "template migration not found", err)
+			}
+
+			// default 500
+			return api.NewHTTPError(http.StatusInternalServerError, err.Error(), err)
+		}
+
+		return c.JSON(http.StatusOK, &migration)
+	}
+}
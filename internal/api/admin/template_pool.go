@@ -0,0 +1,50 @@
+package admin
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/allaboutapps/integresql/internal/api"
+	"github.com/allaboutapps/integresql/pkg/manager"
+	"github.com/labstack/echo/v4"
+)
+
+// putTemplatePool resizes the pool of a template at runtime (see manager.ResizeTemplatePool).
+func putTemplatePool(s *api.Server) echo.HandlerFunc {
+	type requestPayload struct {
+		InitialPoolSize int `json:"initialPoolSize"`
+		MaxPoolSize     int `json:"maxPoolSize"`
+	}
+
+	return func(c echo.Context) error {
+		hash := c.Param("hash")
+
+		var payload requestPayload
+
+		if err := c.Bind(&payload); err != nil {
+			return err
+		}
+
+		if payload.InitialPoolSize == 0 && payload.MaxPoolSize == 0 {
+			return echo.NewHTTPError(http.StatusBadRequest, "initialPoolSize or maxPoolSize is required")
+		}
+
+		size, err := s.Manager.ResizeTemplatePool(c.Request().Context(), hash, payload.InitialPoolSize, payload.MaxPoolSize)
+		if err != nil {
+			if errors.Is(err, manager.ErrManagerNotReady) {
+				return echo.ErrServiceUnavailable
+			} else if errors.Is(err, manager.ErrTemplateNotFound) {
+				return api.NewHTTPError(http.StatusNotFound, "template not found", err)
+			} else if errors.Is(err, manager.ErrInvalidTemplateState) {
+				return api.NewHTTPError(http.StatusConflict, err.Error(), err)
+			} else if errors.Is(err, manager.ErrInvalidTemplateOptions) {
+				return api.NewHTTPError(http.StatusBadRequest, err.Error(), err)
+			}
+
+			// default 500
+			return api.NewHTTPError(http.StatusInternalServerError, err.Error(), err)
+		}
+
+		return c.JSON(http.StatusOK, &size)
+	}
+}
@@ -0,0 +1,63 @@
+package admin
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/allaboutapps/integresql/internal/api"
+	"github.com/allaboutapps/integresql/pkg/manager"
+	"github.com/allaboutapps/integresql/pkg/pool"
+	"github.com/labstack/echo/v4"
+)
+
+// postFreezeTestDatabase removes a test database from rotation until it's unfrozen (see manager.FreezeTestDatabase).
+func postFreezeTestDatabase(s *api.Server) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		hash := c.Param("hash")
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid test database ID")
+		}
+
+		frozen, err := s.Manager.FreezeTestDatabase(c.Request().Context(), hash, id)
+		if err != nil {
+			return freezeHTTPError(err)
+		}
+
+		return c.JSON(http.StatusOK, &frozen)
+	}
+}
+
+// deleteFreezeTestDatabase puts a frozen test database back into rotation (see manager.UnfreezeTestDatabase).
+func deleteFreezeTestDatabase(s *api.Server) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		hash := c.Param("hash")
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid test database ID")
+		}
+
+		if err := s.Manager.UnfreezeTestDatabase(c.Request().Context(), hash, id); err != nil {
+			return freezeHTTPError(err)
+		}
+
+		// recreated in background
+		return c.NoContent(http.StatusNoContent)
+	}
+}
+
+func freezeHTTPError(err error) error {
+	if errors.Is(err, manager.ErrManagerNotReady) {
+		return echo.ErrServiceUnavailable
+	} else if errors.Is(err, manager.ErrTemplateNotFound) {
+		return api.NewHTTPError(http.StatusNotFound, "template not found", err)
+	} else if errors.Is(err, manager.ErrTestNotFound) {
+		return api.NewHTTPError(http.StatusNotFound, "test database not found", err)
+	} else if errors.Is(err, manager.ErrInvalidTemplateState) || errors.Is(err, pool.ErrInvalidState) {
+		return api.NewHTTPError(http.StatusConflict, err.Error(), err)
+	}
+
+	// default 500
+	return api.NewHTTPError(http.StatusInternalServerError, err.Error(), err)
+}
@@ -0,0 +1,70 @@
+package api
+
+import (
+	"errors"
+
+	"github.com/allaboutapps/integresql/pkg/db"
+	"github.com/allaboutapps/integresql/pkg/manager"
+	"github.com/allaboutapps/integresql/pkg/pool"
+	"github.com/labstack/echo/v4"
+)
+
+// ErrorResponse is the body of the error responses of failed manager operations. Besides the message, it carries the
+// stable code of the typed error (see ErrorCode) and the context of the operation (see db.OpError), clients rely on
+// these instead of matching the message.
+type ErrorResponse struct {
+	Message string `json:"message"`
+	Code    string `json:"code,omitempty"`
+
+	// embedded by value, it must not implement error itself
+	db.OpError
+}
+
+// errorCodes of the typed errors, the first one matching via errors.Is wins (thus the more specific ones come first).
+var errorCodes = []struct {
+	err  error
+	code string
+}{
+	{manager.ErrManagerNotReady, "manager_not_ready"},
+	{manager.ErrTemplateQuotaExceeded, "template_quota_exceeded"},
+	{manager.ErrTemplateHashCollision, "template_hash_collision"},
+	{manager.ErrTemplateNamespaceConflict, "template_namespace_conflict"},
+	{manager.ErrTemplateAlreadyInitialized, "template_already_initialized"},
+	{manager.ErrTemplateNotFound, "template_not_found"},
+	{manager.ErrTestNotFound, "test_not_found"},
+	{manager.ErrTemplateDiscarded, "template_discarded"},
+	{manager.ErrInvalidTemplateState, "invalid_template_state"},
+	{manager.ErrInvalidTemplateOptions, "invalid_template_options"},
+	{manager.ErrInvalidTestDatabaseOptions, "invalid_test_database_options"},
+	{manager.ErrInvalidMigration, "invalid_migration"},
+	{manager.ErrMigrationNotFound, "migration_not_found"},
+	{manager.ErrDeadlineExceeded, "deadline_exceeded"},
+	{pool.ErrTestDBInUse, "test_database_in_use"},
+	{pool.ErrInvalidState, "invalid_state"},
+	{pool.ErrLeaseExpired, "lease_expired"},
+	{pool.ErrCircuitOpen, "circuit_open"},
+	{pool.ErrTimeout, "timeout"},
+}
+
+// ErrorCode returns the code of the typed error err matches, empty if none.
+func ErrorCode(err error) string {
+	for _, c := range errorCodes {
+		if errors.Is(err, c.err) {
+			return c.code
+		}
+	}
+
+	return ""
+}
+
+// NewHTTPError returns the error response with the status for the failed manager operation.
+func NewHTTPError(status int, message string, err error) *echo.HTTPError {
+	response := ErrorResponse{Message: message, Code: ErrorCode(err)}
+
+	var opErr *db.OpError
+	if errors.As(err, &opErr) {
+		response.OpError = *opErr
+	}
+
+	return echo.NewHTTPError(status, response)
+}
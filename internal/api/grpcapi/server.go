@@ -0,0 +1,220 @@
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/allaboutapps/integresql/internal/api"
+	"github.com/allaboutapps/integresql/internal/api/middleware"
+	"github.com/allaboutapps/integresql/pkg/audit"
+	"github.com/allaboutapps/integresql/pkg/grpcapi/integresqlv1"
+	"github.com/allaboutapps/integresql/pkg/manager"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// destructiveMethods are restricted to the DestructiveEndpointsAllowlist, like their HTTP routes.
+var destructiveMethods = map[string]bool{
+	integresqlv1.IntegreSQL_InitializeTemplate_FullMethodName: true,
+	integresqlv1.IntegreSQL_DiscardTemplate_FullMethodName:    true,
+}
+
+// auditedMethods maps the audited methods to their action, see middleware.AuditedRoutes.
+var auditedMethods = map[string]audit.Action{
+	integresqlv1.IntegreSQL_DiscardTemplate_FullMethodName: audit.ActionDiscardTemplate,
+}
+
+// httpStatus maps the codes of audited calls to the HTTP status recorded in the audit store.
+var httpStatus = map[codes.Code]int{
+	codes.OK:                 http.StatusNoContent,
+	codes.NotFound:           http.StatusNotFound,
+	codes.Unauthenticated:    http.StatusUnauthorized,
+	codes.PermissionDenied:   http.StatusForbidden,
+	codes.FailedPrecondition: http.StatusLocked,
+	codes.Unavailable:        http.StatusServiceUnavailable,
+}
+
+// NewServer returns the gRPC server of the IntegreSQL service. Its calls pass the built-in interceptors of the HTTP
+// API (audit log, token auth, IP allowlist and startup queue), custom interceptors (see api.Interceptor) only apply to HTTP.
+// Returns an error if the DestructiveEndpointsAllowlist is invalid.
+func NewServer(s *api.Server) (*grpc.Server, error) {
+	nets, err := middleware.ParseIPAllowlist(s.Config.DestructiveEndpointsAllowlist)
+	if err != nil {
+		return nil, err
+	}
+
+	interceptors := []grpc.UnaryServerInterceptor{logCalls(s.Config.Logger.RequestLevel), deadlineHint}
+
+	// audit denied calls as well
+	if s.Audit != nil {
+		interceptors = append(interceptors, auditCalls(s.Audit))
+	}
+
+	interceptors = append(interceptors, tokenAuth(s.Tokens), ipAllowlist(nets))
+
+	if s.Startup != nil {
+		interceptors = append(interceptors, startupQueue(s.Startup, s.Config.StartupQueueTimeout))
+	}
+
+	opts := []grpc.ServerOption{grpc.ChainUnaryInterceptor(interceptors...)}
+	if s.TLS != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(s.TLS)))
+	}
+
+	server := grpc.NewServer(opts...)
+	integresqlv1.RegisterIntegreSQLServer(server, NewService(s))
+
+	return server, nil
+}
+
+func logCalls(level zerolog.Level) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+		res, err := handler(ctx, req)
+
+		event := log.WithLevel(level).Str("component", "grpc").Str("method", info.FullMethod).Str("remoteAddr", remoteAddr(ctx)).
+			Str("code", status.Code(err).String()).Dur("duration", time.Since(start))
+		if err != nil {
+			event = event.Err(err)
+		}
+		event.Msg("Call handled")
+
+		return res, err
+	}
+}
+
+// deadlineHint forwards the deadline of the call to the manager (see manager.WithDeadlineHint), the equivalent of
+// the X-Integresql-Deadline-Ms header.
+func deadlineHint(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if deadline, ok := ctx.Deadline(); ok {
+		ctx = manager.WithDeadlineHint(ctx, deadline)
+	}
+
+	return handler(ctx, req)
+}
+
+func auditCalls(store *audit.Store) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		action, audited := auditedMethods[info.FullMethod]
+		if !audited {
+			return handler(ctx, req)
+		}
+
+		res, err := handler(ctx, req)
+
+		code, known := httpStatus[status.Code(err)]
+		if !known {
+			code = http.StatusInternalServerError
+		}
+
+		entry := audit.Entry{
+			Action: action,
+			Actor: audit.Actor{
+				Token:    audit.TokenFingerprint(authorization(ctx)),
+				RemoteIP: remoteIP(ctx),
+			},
+			Params: map[string]string{"transport": "grpc"},
+			Status: code,
+		}
+
+		if hashed, ok := req.(interface{ GetHash() string }); ok {
+			entry.Hash = hashed.GetHash()
+		}
+
+		if md, ok := metadata.FromIncomingContext(ctx); ok && len(md.Get("user-agent")) > 0 {
+			entry.Actor.UserAgent = md.Get("user-agent")[0]
+		}
+
+		if _, appendErr := store.Append(entry); appendErr != nil {
+			log.Error().Err(appendErr).Str("action", string(action)).Msg("Failed to record audit entry")
+		}
+
+		return res, err
+	}
+}
+
+// tokenAuth rejects calls without a valid bearer token (authorization metadata), all methods are consumer ones
+// requiring the runner scope, see middleware.TokenAuthWithConfig.
+func tokenAuth(tokens *middleware.Tokens) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		err := tokens.Authorize(authorization(ctx), middleware.TokenScopeRunner)
+		if err == nil {
+			return handler(ctx, req)
+		}
+
+		log.Warn().Err(err).Str("remoteAddr", remoteAddr(ctx)).Str("method", info.FullMethod).Msg("Call rejected")
+
+		if errors.Is(err, middleware.ErrTokenInsufficient) {
+			return nil, status.Error(codes.PermissionDenied, err.Error())
+		}
+
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+}
+
+// ipAllowlist rejects destructive calls whose remote address is not within the allowlist, see middleware.IPAllowlistWithConfig.
+func ipAllowlist(nets []*net.IPNet) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if !destructiveMethods[info.FullMethod] || len(nets) == 0 {
+			return handler(ctx, req)
+		}
+
+		if ip := net.ParseIP(remoteIP(ctx)); ip != nil {
+			for _, n := range nets {
+				if n.Contains(ip) {
+					return handler(ctx, req)
+				}
+			}
+		}
+
+		log.Warn().Str("remoteAddr", remoteAddr(ctx)).Str("method", info.FullMethod).Msg("Call rejected, remote address is not within the allowlist")
+
+		return nil, status.Error(codes.PermissionDenied, "remote address is not within the allowlist")
+	}
+}
+
+// startupQueue holds the calls until the manager is ready, see middleware.StartupQueueWithConfig.
+func startupQueue(queue *middleware.StartupQueue, timeout time.Duration) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		waitCtx := ctx
+		if timeout > 0 {
+			var cancel context.CancelFunc
+			waitCtx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+
+		if err := queue.Wait(waitCtx); err != nil {
+			return nil, status.Error(codes.Unavailable, "server is still starting")
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+func remoteAddr(ctx context.Context) string {
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		return p.Addr.String()
+	}
+
+	return ""
+}
+
+func remoteIP(ctx context.Context) string {
+	addr := remoteAddr(ctx)
+
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+
+	return host
+}
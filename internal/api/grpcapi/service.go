@@ -0,0 +1,183 @@
+// Package grpcapi serves the template and test database lifecycle of the HTTP API via gRPC (see
+// proto/integresql/v1/integresql.proto), sharing the manager of the api.Server.
+package grpcapi
+
+import (
+	"context"
+	"errors"
+
+	"github.com/allaboutapps/integresql/internal/api"
+	"github.com/allaboutapps/integresql/pkg/db"
+	"github.com/allaboutapps/integresql/pkg/grpcapi/integresqlv1"
+	"github.com/allaboutapps/integresql/pkg/manager"
+	"github.com/allaboutapps/integresql/pkg/pool"
+	pkgtemplates "github.com/allaboutapps/integresql/pkg/templates"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Service implements integresqlv1.IntegreSQLServer on top of the manager of the server.
+type Service struct {
+	integresqlv1.UnimplementedIntegreSQLServer
+
+	s *api.Server
+}
+
+func NewService(s *api.Server) *Service {
+	return &Service{s: s}
+}
+
+func (svc *Service) InitializeTemplate(ctx context.Context, req *integresqlv1.InitializeTemplateRequest) (*integresqlv1.InitializeTemplateResponse, error) {
+	if len(req.GetHash()) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "hash is required")
+	}
+
+	// templates are accounted to the API token, only admins may pick another namespace
+	namespace, err := svc.s.Tokens.TemplateNamespace(authorization(ctx), req.GetNamespace())
+	if err != nil {
+		return nil, status.Error(codes.PermissionDenied, err.Error())
+	}
+
+	template, err := svc.s.Manager.InitializeTemplateDatabaseWithOptions(ctx, req.GetHash(), pkgtemplates.TemplateOptions{
+		PostCloneScript:   req.GetPostCloneScript(),
+		ValidationQueries: req.GetValidationQueries(),
+		Ephemeral:         req.GetEphemeral(),
+		Labels:            req.GetLabels(),
+		Settings:          req.GetSettings(),
+		Metadata:          req.GetMetadata(),
+		Namespace:         namespace,
+	})
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &integresqlv1.InitializeTemplateResponse{Database: toDatabase(template.Database)}, nil
+}
+
+func (svc *Service) FinalizeTemplate(ctx context.Context, req *integresqlv1.FinalizeTemplateRequest) (*integresqlv1.FinalizeTemplateResponse, error) {
+	// template is initialized, we ignore this error
+	if _, err := svc.s.Manager.FinalizeTemplateDatabase(ctx, req.GetHash()); err != nil && !errors.Is(err, manager.ErrTemplateAlreadyInitialized) {
+		return nil, toStatus(err)
+	}
+
+	return &integresqlv1.FinalizeTemplateResponse{}, nil
+}
+
+func (svc *Service) DiscardTemplate(ctx context.Context, req *integresqlv1.DiscardTemplateRequest) (*integresqlv1.DiscardTemplateResponse, error) {
+	if err := svc.s.Manager.DiscardTemplateDatabase(ctx, req.GetHash()); err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &integresqlv1.DiscardTemplateResponse{}, nil
+}
+
+func (svc *Service) GetTestDatabase(ctx context.Context, req *integresqlv1.GetTestDatabaseRequest) (*integresqlv1.GetTestDatabaseResponse, error) {
+	// defaults to the remote address of the client
+	holder := incoming(ctx, metadataHolder)
+	if len(holder) == 0 {
+		holder = remoteIP(ctx)
+	}
+	ctx = pool.WithHolder(ctx, holder)
+
+	var test db.TestDatabase
+	var err error
+	if req.GetSkipClean() {
+		test, err = svc.s.Manager.GetTestDatabaseWithOptions(ctx, req.GetHash(), manager.TestDatabaseOptions{SkipClean: true})
+	} else {
+		test, err = svc.s.Manager.GetTestDatabase(ctx, req.GetHash())
+	}
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &integresqlv1.GetTestDatabaseResponse{TestDatabase: &integresqlv1.TestDatabase{
+		Id:          int32(test.ID),
+		Database:    toDatabase(test.Database),
+		Seed:        test.Seed,
+		Dirty:       test.Dirty,
+		PoolerAlias: test.PoolerAlias,
+	}}, nil
+}
+
+func (svc *Service) ReturnTestDatabase(ctx context.Context, req *integresqlv1.ReturnTestDatabaseRequest) (*integresqlv1.ReturnTestDatabaseResponse, error) {
+	if err := svc.s.Manager.ReturnTestDatabase(ctx, req.GetHash(), int(req.GetId())); err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &integresqlv1.ReturnTestDatabaseResponse{}, nil
+}
+
+func (svc *Service) RecreateTestDatabase(ctx context.Context, req *integresqlv1.RecreateTestDatabaseRequest) (*integresqlv1.RecreateTestDatabaseResponse, error) {
+	if err := svc.s.Manager.RecreateTestDatabase(ctx, req.GetHash(), int(req.GetId())); err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &integresqlv1.RecreateTestDatabaseResponse{}, nil
+}
+
+func toDatabase(database db.Database) *integresqlv1.Database {
+	return &integresqlv1.Database{
+		TemplateHash: database.TemplateHash,
+		Config: &integresqlv1.DatabaseConfig{
+			Host:             database.Config.Host,
+			Port:             int32(database.Config.Port),
+			Username:         database.Config.Username,
+			Password:         database.Config.Password,
+			Database:         database.Config.Database,
+			AdditionalParams: database.Config.Params(), // including the TLS settings (sslmode, sslrootcert, ...)
+		},
+	}
+}
+
+// toStatus maps the errors of the manager to gRPC status codes, analogous to the HTTP status of the HTTP API.
+func toStatus(err error) error {
+	var quotaErr *manager.TemplateQuotaError
+
+	switch {
+	case errors.Is(err, manager.ErrManagerNotReady):
+		return status.Error(codes.Unavailable, err.Error())
+	case errors.As(err, &quotaErr):
+		return status.Error(codes.ResourceExhausted, err.Error())
+	case errors.Is(err, manager.ErrTemplateAlreadyInitialized):
+		return status.Error(codes.AlreadyExists, err.Error())
+	case errors.Is(err, manager.ErrTemplateHashCollision), errors.Is(err, manager.ErrTemplateNamespaceConflict):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, manager.ErrTemplateNotFound), errors.Is(err, manager.ErrTestNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, manager.ErrTemplateDiscarded):
+		return status.Error(codes.Aborted, err.Error())
+	case errors.Is(err, manager.ErrInvalidTemplateOptions), errors.Is(err, manager.ErrInvalidTestDatabaseOptions):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, pool.ErrTestDBInUse):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, manager.ErrDeadlineExceeded), errors.Is(err, context.DeadlineExceeded):
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, err.Error())
+	default:
+		return status.Error(codes.Internal, err.Error())
+	}
+}
+
+// metadataHolder identifies the holder of the checked out test database (the equivalent of the X-Integresql-Holder header).
+const metadataHolder = "x-integresql-holder"
+
+// authorization returns the authorization metadata of the call (the equivalent of the Authorization header).
+func authorization(ctx context.Context) string {
+	return incoming(ctx, "authorization")
+}
+
+// incoming returns the first value of the metadata key of the call.
+func incoming(ctx context.Context, key string) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+
+	return ""
+}
@@ -0,0 +1,138 @@
+package grpcapi_test
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/allaboutapps/integresql/internal/api"
+	"github.com/allaboutapps/integresql/internal/api/grpcapi"
+	"github.com/allaboutapps/integresql/internal/api/middleware"
+	"github.com/allaboutapps/integresql/pkg/audit"
+	"github.com/allaboutapps/integresql/pkg/db"
+	"github.com/allaboutapps/integresql/pkg/grpcapi/integresqlv1"
+	"github.com/allaboutapps/integresql/pkg/manager"
+	"github.com/allaboutapps/integresql/pkg/templates"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// fakeManager implements the lifecycle methods used by the tests, all others panic.
+type fakeManager struct {
+	manager.ManagerAPI
+
+	deadlineHint bool
+	namespace    string
+}
+
+func (m *fakeManager) InitializeTemplateDatabaseWithOptions(_ context.Context, hash string, options templates.TemplateOptions) (db.TemplateDatabase, error) {
+	m.namespace = options.Namespace
+
+	if hash == "initialized" {
+		return db.TemplateDatabase{}, manager.ErrTemplateAlreadyInitialized
+	}
+
+	return db.TemplateDatabase{Database: db.Database{TemplateHash: hash, Config: db.DatabaseConfig{Database: "integresql_template_" + hash}}}, nil
+}
+
+func (m *fakeManager) GetTestDatabase(ctx context.Context, hash string) (db.TestDatabase, error) {
+	_, m.deadlineHint = manager.DeadlineHint(ctx)
+
+	if hash != "hashinghash" {
+		return db.TestDatabase{}, manager.ErrTemplateNotFound
+	}
+
+	return db.TestDatabase{ID: 3, Database: db.Database{TemplateHash: hash, Config: db.DatabaseConfig{Port: 5432, Database: "integresql_test_hashinghash_003"}}}, nil
+}
+
+func testClient(t *testing.T, config api.ServerConfig, m manager.ManagerAPI) integresqlv1.IntegreSQLClient {
+	t.Helper()
+
+	s := api.NewServer(config)
+	s.Manager = m
+	s.Tokens = middleware.NewTokens(config.AdminTokens, config.RunnerTokens)
+
+	server, err := grpcapi.NewServer(s)
+	require.NoError(t, err)
+
+	lis := bufconn.Listen(1024 * 1024)
+	go func() {
+		_ = server.Serve(lis)
+	}()
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.DialContext(context.Background(), "bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	return integresqlv1.NewIntegreSQLClient(conn)
+}
+
+func TestService(t *testing.T) {
+	m := &fakeManager{}
+	c := testClient(t, api.ServerConfig{}, m)
+
+	ctx := context.Background()
+
+	template, err := c.InitializeTemplate(ctx, &integresqlv1.InitializeTemplateRequest{Hash: "hashinghash"})
+	require.NoError(t, err)
+	assert.Equal(t, "integresql_template_hashinghash", template.GetDatabase().GetConfig().GetDatabase())
+
+	_, err = c.InitializeTemplate(ctx, &integresqlv1.InitializeTemplateRequest{Hash: "initialized"})
+	assert.Equal(t, codes.AlreadyExists, status.Code(err))
+
+	_, err = c.InitializeTemplate(ctx, &integresqlv1.InitializeTemplateRequest{})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+
+	test, err := c.GetTestDatabase(timeoutCtx, &integresqlv1.GetTestDatabaseRequest{Hash: "hashinghash"})
+	require.NoError(t, err)
+	assert.Equal(t, int32(3), test.GetTestDatabase().GetId())
+	assert.Equal(t, int32(5432), test.GetTestDatabase().GetDatabase().GetConfig().GetPort())
+	assert.True(t, m.deadlineHint)
+
+	_, err = c.GetTestDatabase(ctx, &integresqlv1.GetTestDatabaseRequest{Hash: "unknown"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestServiceDestructiveAllowlist(t *testing.T) {
+	c := testClient(t, api.ServerConfig{DestructiveEndpointsAllowlist: []string{"10.0.0.1"}}, &fakeManager{})
+
+	ctx := context.Background()
+
+	_, err := c.InitializeTemplate(ctx, &integresqlv1.InitializeTemplateRequest{Hash: "hashinghash"})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	_, err = c.GetTestDatabase(ctx, &integresqlv1.GetTestDatabaseRequest{Hash: "hashinghash"})
+	assert.NoError(t, err)
+}
+
+func TestServiceNamespaceOverride(t *testing.T) {
+	m := &fakeManager{}
+	c := testClient(t, api.ServerConfig{AdminTokens: []string{"admin-token"}, RunnerTokens: []string{"runner-token"}}, m)
+
+	runner := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer runner-token")
+	admin := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer admin-token")
+
+	_, err := c.InitializeTemplate(runner, &integresqlv1.InitializeTemplateRequest{Hash: "hashinghash", Namespace: "team-a"})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	_, err = c.InitializeTemplate(runner, &integresqlv1.InitializeTemplateRequest{Hash: "hashinghash"})
+	require.NoError(t, err)
+	assert.Equal(t, audit.TokenFingerprint("Bearer runner-token"), m.namespace)
+
+	_, err = c.InitializeTemplate(admin, &integresqlv1.InitializeTemplateRequest{Hash: "hashinghash", Namespace: "team-a"})
+	require.NoError(t, err)
+	assert.Equal(t, "team-a", m.namespace)
+}
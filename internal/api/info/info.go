@@ -0,0 +1,27 @@
+package info
+
+import (
+	"net/http"
+
+	"github.com/allaboutapps/integresql/internal/api"
+	"github.com/allaboutapps/integresql/pkg/signature"
+	"github.com/labstack/echo/v4"
+)
+
+type infoResponse struct {
+	// base64 Ed25519 public key verifying the signed responses (see the signature package), nil if signing is disabled
+	SigningPublicKey *string `json:"signingPublicKey"`
+}
+
+func getInfo(s *api.Server) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var response infoResponse
+
+		if s.SigningKey != nil {
+			key := signature.EncodePublicKey(s.SigningKey)
+			response.SigningPublicKey = &key
+		}
+
+		return c.JSON(http.StatusOK, &response)
+	}
+}
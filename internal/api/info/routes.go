@@ -0,0 +1,11 @@
+package info
+
+import "github.com/allaboutapps/integresql/internal/api"
+
+func InitRoutes(s *api.Server) {
+	g := s.Echo.Group("/api/v1/info")
+
+	regular := s.RouteMiddlewares(api.RouteGroupTemplates, false)
+
+	g.GET("", getInfo(s), regular...)
+}
@@ -0,0 +1,112 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/labstack/echo/v4"
+)
+
+var ErrInvalidInterceptor = errors.New("invalid interceptor")
+
+// RouteGroup classifies the API routes, interceptors may be restricted to one of them.
+type RouteGroup string
+
+const (
+	RouteGroupTemplates RouteGroup = "templates" // consumer routes: /api/v1/templates/...
+	RouteGroupAdmin     RouteGroup = "admin"     // admin routes: /api/v1/admin/...
+)
+
+// Names of the built-in interceptors registered by router.Init, custom interceptors may be positioned before them.
+const (
+	InterceptorAuditLog        = "audit_log"         // records discards, resets and prefix migrations (including denied ones), only if an AuditFile is configured
+	InterceptorAdminTokenAuth  = "admin_token_auth"  // requires an admin bearer token on the admin routes, only if any token is configured
+	InterceptorRunnerTokenAuth = "runner_token_auth" // requires a runner (or admin) bearer token on the consumer routes, only if any token is configured
+	InterceptorIPAllowlist     = "ip_allowlist"      // restricts destructive routes to the DestructiveEndpointsAllowlist
+	InterceptorStartupQueue    = "startup_queue"     // holds requests until the manager is ready, only with LazyConnect
+)
+
+// Interceptor is a named middleware of the interceptor chain wrapping the handlers of all API routes, in addition to
+// the general middlewares applied to all requests (e.g. the request logger). Forks insert custom policies (e.g.
+// corporate audit logging or quotas) via Server.Interceptors before calling router.Init, without patching handlers.
+type Interceptor struct {
+	Name       string // unique within the chain
+	Middleware echo.MiddlewareFunc
+
+	Group           RouteGroup // only applied to the routes of this group (empty applies it to all groups)
+	DestructiveOnly bool       // only applied to destructive routes (initialize, discard, reset, migrate, diagnostics, reports)
+
+	// Before positions the interceptor in front of the one with this name, a built-in or preceding custom one (e.g.
+	// InterceptorIPAllowlist to audit denied requests as well), empty appends it to the end of the chain
+	Before string
+}
+
+// InterceptorChain is the ordered list of interceptors, the first one is called first.
+type InterceptorChain []Interceptor
+
+// BuildInterceptorChain appends the custom interceptors to the built-in ones, respecting their Before position.
+func BuildInterceptorChain(builtin []Interceptor, custom []Interceptor) (InterceptorChain, error) {
+	chain := make(InterceptorChain, 0, len(builtin)+len(custom))
+
+	for _, interceptor := range append(append([]Interceptor{}, builtin...), custom...) {
+		if len(interceptor.Name) == 0 || interceptor.Middleware == nil {
+			return nil, fmt.Errorf("%w: name and middleware are required (%q)", ErrInvalidInterceptor, interceptor.Name)
+		}
+
+		if chain.index(interceptor.Name) >= 0 {
+			return nil, fmt.Errorf("%w: duplicate name %q", ErrInvalidInterceptor, interceptor.Name)
+		}
+
+		if len(interceptor.Before) == 0 {
+			chain = append(chain, interceptor)
+			continue
+		}
+
+		i := chain.index(interceptor.Before)
+		if i < 0 {
+			return nil, fmt.Errorf("%w: %q should run before the unknown interceptor %q", ErrInvalidInterceptor, interceptor.Name, interceptor.Before)
+		}
+
+		chain = append(chain[:i], append(InterceptorChain{interceptor}, chain[i:]...)...)
+	}
+
+	return chain, nil
+}
+
+// Names returns the names of all interceptors in the order they are called.
+func (c InterceptorChain) Names() []string {
+	names := make([]string, 0, len(c))
+	for _, interceptor := range c {
+		names = append(names, interceptor.Name)
+	}
+
+	return names
+}
+
+// Middlewares returns the middlewares of all interceptors applied to routes of the group.
+func (c InterceptorChain) Middlewares(group RouteGroup, destructive bool) []echo.MiddlewareFunc {
+	middlewares := make([]echo.MiddlewareFunc, 0, len(c))
+	for _, interceptor := range c {
+		if len(interceptor.Group) > 0 && interceptor.Group != group {
+			continue
+		}
+
+		if interceptor.DestructiveOnly && !destructive {
+			continue
+		}
+
+		middlewares = append(middlewares, interceptor.Middleware)
+	}
+
+	return middlewares
+}
+
+func (c InterceptorChain) index(name string) int {
+	for i, interceptor := range c {
+		if interceptor.Name == name {
+			return i
+		}
+	}
+
+	return -1
+}
@@ -0,0 +1,95 @@
+package middleware
+
+import (
+	"errors"
+	"net"
+	"net/http"
+
+	"github.com/allaboutapps/integresql/pkg/audit"
+	"github.com/allaboutapps/integresql/pkg/util"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+type AuditConfig struct {
+	Skipper middleware.Skipper
+
+	// Store receiving an entry for each audited request (see AuditedRoutes), the middleware is a no-op without a store
+	Store *audit.Store
+}
+
+// AuditedRoutes maps the method and route ("<method> <path>") of all audited requests to their action.
+var AuditedRoutes = map[string]audit.Action{
+	http.MethodDelete + " /api/v1/templates/:hash":                        audit.ActionDiscardTemplate,
+	http.MethodDelete + " /api/v1/admin/templates":                        audit.ActionResetAllTemplates,
+	http.MethodPost + " /api/v1/admin/migrate-prefixes":                   audit.ActionMigratePrefixes,
+	http.MethodPost + " /api/v1/admin/templates/:hash/migration":          audit.ActionMigrateTemplate,
+	http.MethodPut + " /api/v1/admin/templates/:hash/pool":                audit.ActionResizePool,
+	http.MethodPost + " /api/v1/admin/templates/:hash/tests/:id/freeze":   audit.ActionFreezeTestDB,
+	http.MethodDelete + " /api/v1/admin/templates/:hash/tests/:id/freeze": audit.ActionUnfreezeTestDB,
+	http.MethodPost + " /api/v1/admin/schedules":                          audit.ActionScheduleTask,
+	http.MethodDelete + " /api/v1/admin/schedules/:id":                    audit.ActionUnscheduleTask,
+	http.MethodPost + " /api/v1/admin/schedules/:id/run":                  audit.ActionRunScheduledTask,
+}
+
+// AuditWithConfig records who (token fingerprint, remote address), when and what for each audited request after its
+// handler ran, including its response status (e.g. rejected requests). A failed append is logged, as the action
+// already happened.
+func AuditWithConfig(config AuditConfig) echo.MiddlewareFunc {
+	if config.Skipper == nil {
+		config.Skipper = middleware.DefaultSkipper
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			action, audited := AuditedRoutes[c.Request().Method+" "+c.Path()]
+			if config.Skipper(c) || config.Store == nil || !audited {
+				return next(c)
+			}
+
+			err := next(c)
+
+			status := c.Response().Status
+			if err != nil {
+				status = http.StatusInternalServerError
+
+				var httpErr *echo.HTTPError
+				if errors.As(err, &httpErr) {
+					status = httpErr.Code
+				}
+			}
+
+			req := c.Request()
+			host, _, splitErr := net.SplitHostPort(req.RemoteAddr)
+			if splitErr != nil {
+				host = req.RemoteAddr
+			}
+
+			entry := audit.Entry{
+				Action: action,
+				Hash:   c.Param("hash"),
+				Actor: audit.Actor{
+					Token:     audit.TokenFingerprint(req.Header.Get(echo.HeaderAuthorization)),
+					RemoteIP:  host,
+					UserAgent: req.UserAgent(),
+				},
+				RequestID: c.Response().Header().Get(echo.HeaderXRequestID),
+				Status:    status,
+			}
+
+			if label := c.QueryParam("label"); action == audit.ActionResetAllTemplates && len(label) > 0 {
+				entry.Params = map[string]string{"label": label}
+			}
+
+			if id := c.Param("id"); len(id) > 0 {
+				entry.Params = map[string]string{"id": id}
+			}
+
+			if _, appendErr := config.Store.Append(entry); appendErr != nil {
+				util.LogFromEchoContext(c).Error().Err(appendErr).Str("action", string(action)).Msg("Failed to record audit entry")
+			}
+
+			return err
+		}
+	}
+}
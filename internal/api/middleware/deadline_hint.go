@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/allaboutapps/integresql/pkg/manager"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+// HeaderDeadlineHint holds the remaining time (in milliseconds) the client is willing to wait for a response,
+// typically the remaining timeout of the test requesting a database.
+const HeaderDeadlineHint = "X-Integresql-Deadline-Ms"
+
+type DeadlineHintConfig struct {
+	Skipper middleware.Skipper
+}
+
+var (
+	DefaultDeadlineHintConfig = DeadlineHintConfig{
+		Skipper: middleware.DefaultSkipper,
+	}
+)
+
+// DeadlineHint forwards the client deadline of the HeaderDeadlineHint header to the manager (see manager.WithDeadlineHint).
+func DeadlineHint() echo.MiddlewareFunc {
+	return DeadlineHintWithConfig(DefaultDeadlineHintConfig)
+}
+
+// DeadlineHintWithConfig forwards the client deadline of the HeaderDeadlineHint header to the manager (see manager.WithDeadlineHint).
+// Requests with an invalid header value are rejected with 400 Bad Request.
+func DeadlineHintWithConfig(config DeadlineHintConfig) echo.MiddlewareFunc {
+	if config.Skipper == nil {
+		config.Skipper = DefaultDeadlineHintConfig.Skipper
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			value := c.Request().Header.Get(HeaderDeadlineHint)
+			if config.Skipper(c) || len(value) == 0 {
+				return next(c)
+			}
+
+			ms, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || ms < 0 {
+				return echo.NewHTTPError(http.StatusBadRequest, "invalid "+HeaderDeadlineHint+" header")
+			}
+
+			req := c.Request()
+			c.SetRequest(req.WithContext(manager.WithDeadlineHint(req.Context(), time.Now().Add(time.Duration(ms)*time.Millisecond))))
+
+			return next(c)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package middleware
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/allaboutapps/integresql/pkg/util"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+type IPAllowlistConfig struct {
+	Skipper middleware.Skipper
+
+	// Allowlist holds the CIDRs (or single IPs) which are allowed to access the routes, an empty allowlist allows everyone.
+	// Only the direct remote address of the request is checked, X-Forwarded-For and X-Real-IP headers are ignored
+	// as they may be set by any client.
+	Allowlist []string
+}
+
+var (
+	DefaultIPAllowlistConfig = IPAllowlistConfig{
+		Skipper:   middleware.DefaultSkipper,
+		Allowlist: nil,
+	}
+)
+
+// IPAllowlistWithConfig rejects all requests with 403 Forbidden whose remote address is not within the configured allowlist.
+// Returns an error if the allowlist contains an invalid CIDR or IP.
+func IPAllowlistWithConfig(config IPAllowlistConfig) (echo.MiddlewareFunc, error) {
+	if config.Skipper == nil {
+		config.Skipper = DefaultIPAllowlistConfig.Skipper
+	}
+
+	nets, err := ParseIPAllowlist(config.Allowlist)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if config.Skipper(c) || len(nets) == 0 {
+				return next(c)
+			}
+
+			remoteAddr := c.Request().RemoteAddr
+			host, _, err := net.SplitHostPort(remoteAddr)
+			if err != nil {
+				host = remoteAddr
+			}
+
+			ip := net.ParseIP(host)
+			if ip != nil {
+				for _, n := range nets {
+					if n.Contains(ip) {
+						return next(c)
+					}
+				}
+			}
+
+			util.LogFromEchoContext(c).Warn().Str("remoteAddr", remoteAddr).Str("path", c.Path()).Msg("Request rejected, remote address is not within the allowlist")
+
+			return echo.ErrForbidden
+		}
+	}, nil
+}
+
+// ParseIPAllowlist parses the given CIDRs, single IPs are treated as a network containing only this IP.
+// Empty entries are skipped.
+func ParseIPAllowlist(allowlist []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(allowlist))
+
+	for _, entry := range allowlist {
+		entry = strings.TrimSpace(entry)
+		if len(entry) == 0 {
+			continue
+		}
+
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid IP in allowlist: %q", entry)
+			}
+
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip = ip4
+				bits = 8 * net.IPv4len
+			}
+
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, n, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR in allowlist: %w", err)
+		}
+
+		nets = append(nets, n)
+	}
+
+	return nets, nil
+}
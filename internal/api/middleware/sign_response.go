@@ -0,0 +1,84 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"net/http"
+
+	"github.com/allaboutapps/integresql/pkg/signature"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+type SignResponseConfig struct {
+	Skipper middleware.Skipper
+
+	// Key signs the responses, they are passed through unsigned if nil.
+	Key ed25519.PrivateKey
+}
+
+var (
+	DefaultSignResponseConfig = SignResponseConfig{
+		Skipper: middleware.DefaultSkipper,
+		Key:     nil,
+	}
+)
+
+// SignResponseWithConfig buffers the response (including errors) and signs it with the configured key, see the
+// signature package. The signature is bound to the nonce of the request (signature.NonceHeader).
+func SignResponseWithConfig(config SignResponseConfig) echo.MiddlewareFunc {
+	if config.Skipper == nil {
+		config.Skipper = DefaultSignResponseConfig.Skipper
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if config.Skipper(c) || config.Key == nil {
+				return next(c)
+			}
+
+			res := c.Response()
+			writer := res.Writer
+			buffered := &bufferedResponseWriter{ResponseWriter: writer}
+			res.Writer = buffered
+
+			err := next(c)
+			if err != nil {
+				// errors are signed as well, the error handler skips the already committed response afterwards
+				c.Error(err)
+			}
+
+			res.Writer = writer
+
+			status := buffered.status
+			if status == 0 {
+				status = http.StatusOK
+			}
+
+			res.Header().Set(signature.SignatureHeader, signature.Sign(config.Key, c.Request().Method, c.Request().Header.Get(signature.NonceHeader), status, buffered.body.Bytes()))
+			writer.WriteHeader(status)
+			if _, werr := writer.Write(buffered.body.Bytes()); werr != nil && err == nil {
+				return werr
+			}
+
+			return err
+		}
+	}
+}
+
+// bufferedResponseWriter holds back the status and body until the response is signed.
+type bufferedResponseWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *bufferedResponseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *bufferedResponseWriter) Write(b []byte) (int, error) {
+	return w.body.Write(b)
+}
@@ -0,0 +1,46 @@
+package middleware_test
+
+import (
+	"crypto/ed25519"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/allaboutapps/integresql/internal/api/middleware"
+	"github.com/allaboutapps/integresql/pkg/signature"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignResponse(t *testing.T) {
+	pub, key, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+
+	e := echo.New()
+	sign := middleware.SignResponseWithConfig(middleware.SignResponseConfig{Key: key})
+	e.GET("/tests", func(c echo.Context) error {
+		return c.JSON(http.StatusOK, map[string]int{"id": 1})
+	}, sign)
+	e.GET("/missing", func(c echo.Context) error {
+		return echo.NewHTTPError(http.StatusNotFound, "template not found")
+	}, sign)
+	e.GET("/unsigned", func(c echo.Context) error {
+		return c.NoContent(http.StatusNoContent)
+	}, middleware.SignResponseWithConfig(middleware.SignResponseConfig{}))
+
+	for _, path := range []string{"/tests", "/missing"} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set(signature.NonceHeader, "nonce")
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+
+		assert.NotEmpty(t, rec.Body.Bytes(), path)
+		assert.True(t, signature.Verify(pub, http.MethodGet, "nonce", rec.Code, rec.Body.Bytes(), rec.Header().Get(signature.SignatureHeader)), path)
+	}
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/unsigned", nil))
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Empty(t, rec.Header().Get(signature.SignatureHeader))
+}
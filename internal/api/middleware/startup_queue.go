@@ -0,0 +1,142 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+var ErrStartupQueueFull = errors.New("startup queue is full")
+
+// StartupQueue holds requests arriving while the server is still starting (connecting to PostgreSQL and
+// initializing the manager) until it is opened, afterwards they are released in the order they arrived.
+type StartupQueue struct {
+	maxSize int
+
+	opened  bool
+	waiters []chan struct{} // FIFO, while opened the first one is released and passes the turn on to the next one
+	mutex   sync.Mutex
+}
+
+// NewStartupQueue returns a closed queue holding at most maxSize requests (<= 0 is unlimited).
+func NewStartupQueue(maxSize int) *StartupQueue {
+	return &StartupQueue{maxSize: maxSize}
+}
+
+// Open releases all held requests in order, later requests only wait for the ones queued before them.
+func (q *StartupQueue) Open() {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if q.opened {
+		return
+	}
+
+	q.opened = true
+	if len(q.waiters) > 0 {
+		close(q.waiters[0])
+	}
+}
+
+// Opened returns true if the queue was opened.
+func (q *StartupQueue) Opened() bool {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	return q.opened
+}
+
+// Len returns the number of currently held requests.
+func (q *StartupQueue) Len() int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	return len(q.waiters)
+}
+
+// Wait blocks until all requests queued before were released and the queue is opened, or ctx is done.
+func (q *StartupQueue) Wait(ctx context.Context) error {
+	q.mutex.Lock()
+	if q.opened && len(q.waiters) == 0 {
+		q.mutex.Unlock()
+		return nil
+	}
+
+	if q.maxSize > 0 && len(q.waiters) >= q.maxSize {
+		q.mutex.Unlock()
+		return ErrStartupQueueFull
+	}
+
+	turn := make(chan struct{})
+	q.waiters = append(q.waiters, turn)
+	q.mutex.Unlock()
+
+	select {
+	case <-turn:
+		q.leave(turn)
+		return nil
+	case <-ctx.Done():
+		q.leave(turn)
+		return ctx.Err()
+	}
+}
+
+// leave removes the waiter, passing the turn on to the next one if it was released (or due) already.
+func (q *StartupQueue) leave(turn chan struct{}) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	for i, waiter := range q.waiters {
+		if waiter != turn {
+			continue
+		}
+
+		q.waiters = append(q.waiters[:i], q.waiters[i+1:]...)
+
+		if i == 0 && q.opened && len(q.waiters) > 0 {
+			close(q.waiters[0])
+		}
+
+		return
+	}
+}
+
+type StartupQueueConfig struct {
+	Skipper middleware.Skipper
+	Queue   *StartupQueue
+	Timeout time.Duration // max time a request is held, 0 holds it until the request is canceled
+}
+
+// StartupQueueWithConfig holds requests in the queue until the server has started, see StartupQueue.
+// Requests held longer than the timeout or exceeding the size of the queue are rejected with 503 Service Unavailable.
+func StartupQueueWithConfig(config StartupQueueConfig) echo.MiddlewareFunc {
+	if config.Skipper == nil {
+		config.Skipper = middleware.DefaultSkipper
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if config.Skipper(c) || config.Queue == nil {
+				return next(c)
+			}
+
+			ctx := c.Request().Context()
+			if config.Timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, config.Timeout)
+				defer cancel()
+			}
+
+			if err := config.Queue.Wait(ctx); err != nil {
+				return echo.NewHTTPError(http.StatusServiceUnavailable, "server is still starting").SetInternal(err)
+			}
+
+			return next(c)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package middleware_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/allaboutapps/integresql/internal/api/middleware"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStartupQueueOrder(t *testing.T) {
+	queue := middleware.NewStartupQueue(0)
+
+	var mutex sync.Mutex
+	released := make([]int, 0)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			assert.NoError(t, queue.Wait(context.Background()))
+
+			mutex.Lock()
+			released = append(released, i)
+			mutex.Unlock()
+		}(i)
+
+		// enqueue one after another
+		require.Eventually(t, func() bool { return queue.Len() == i+1 }, time.Second, time.Millisecond)
+	}
+
+	// a canceled request leaves the queue without blocking the others
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, queue.Wait(ctx), context.DeadlineExceeded)
+	assert.Equal(t, 5, queue.Len())
+
+	queue.Open()
+	wg.Wait()
+
+	assert.Equal(t, []int{0, 1, 2, 3, 4}, released)
+	assert.Equal(t, 0, queue.Len())
+
+	// opened, requests pass right away
+	assert.NoError(t, queue.Wait(context.Background()))
+}
+
+func TestStartupQueueWithConfig(t *testing.T) {
+	queue := middleware.NewStartupQueue(1)
+
+	serve := func(timeout time.Duration) int {
+		e := echo.New()
+		e.Use(middleware.StartupQueueWithConfig(middleware.StartupQueueConfig{Queue: queue, Timeout: timeout}))
+		e.GET("/", func(c echo.Context) error { return c.NoContent(http.StatusNoContent) })
+
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		return rec.Code
+	}
+
+	// held until the timeout
+	assert.Equal(t, http.StatusServiceUnavailable, serve(20*time.Millisecond))
+
+	// held until opened, a further request exceeds the size of the queue
+	done := make(chan int)
+	go func() { done <- serve(0) }()
+	require.Eventually(t, func() bool { return queue.Len() == 1 }, time.Second, time.Millisecond)
+	assert.Equal(t, http.StatusServiceUnavailable, serve(0))
+
+	queue.Open()
+	assert.Equal(t, http.StatusNoContent, <-done)
+	assert.Equal(t, http.StatusNoContent, serve(0))
+}
@@ -0,0 +1,200 @@
+package middleware
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/allaboutapps/integresql/pkg/audit"
+	"github.com/allaboutapps/integresql/pkg/util"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+var (
+	ErrTokenMissing      = errors.New("bearer token missing")
+	ErrTokenInvalid      = errors.New("bearer token invalid")
+	ErrTokenInsufficient = errors.New("bearer token lacks the required scope")
+	ErrNamespaceOverride = errors.New("only admin tokens may account templates to another namespace")
+)
+
+// TokenScope is the scope a route requires, admin tokens are granted all scopes.
+type TokenScope string
+
+const (
+	TokenScopeRunner TokenScope = "runner" // templates and test databases, e.g. test runners
+	TokenScopeAdmin  TokenScope = "admin"  // admin routes (resetting, stats, metrics, debug)
+)
+
+// Tokens holds the static bearer tokens per scope.
+type Tokens struct {
+	admin  [][]byte
+	runner [][]byte
+}
+
+// NewTokens returns the tokens of both scopes, empty entries are skipped. Without any token, authentication is disabled.
+func NewTokens(admin []string, runner []string) *Tokens {
+	return &Tokens{
+		admin:  tokenBytes(admin),
+		runner: tokenBytes(runner),
+	}
+}
+
+// LoadTokensFile reads one token per line, empty lines and lines starting with '#' are skipped.
+func LoadTokensFile(path string) ([]string, error) {
+	f, err := os.Open(path) // #nosec G304 - path is provided via config
+	if err != nil {
+		return nil, fmt.Errorf("failed to open tokens file: %w", err)
+	}
+	defer f.Close()
+
+	var tokens []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		tokens = append(tokens, line)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read tokens file: %w", err)
+	}
+
+	return tokens, nil
+}
+
+// Enabled returns true if any token is configured.
+func (t *Tokens) Enabled() bool {
+	return t != nil && len(t.admin)+len(t.runner) > 0
+}
+
+// Authorize checks the Authorization header value ("Bearer <token>") against the tokens granted the scope.
+func (t *Tokens) Authorize(authorization string, scope TokenScope) error {
+	if !t.Enabled() {
+		return nil
+	}
+
+	token, ok := bearerToken(authorization)
+	if !ok {
+		return ErrTokenMissing
+	}
+
+	// all tokens are compared, not leaking which one matched via timing
+	admin, runner := matchToken(t.admin, token), matchToken(t.runner, token)
+
+	switch {
+	case admin:
+		return nil
+	case runner && scope == TokenScopeRunner:
+		return nil
+	case runner:
+		return ErrTokenInsufficient
+	default:
+		return ErrTokenInvalid
+	}
+}
+
+// TemplateNamespace returns the namespace the templates initialized with the Authorization header value are accounted to
+// (see manager.ManagerConfig.MaxTemplatesPerNamespace): the fingerprint of its token. Only admin tokens (or anyone if
+// authentication is disabled) may request another namespace, otherwise runners could escape their quota.
+func (t *Tokens) TemplateNamespace(authorization string, requested string) (string, error) {
+	fingerprint := audit.TokenFingerprint(authorization)
+	if len(requested) == 0 || requested == fingerprint {
+		return fingerprint, nil
+	}
+
+	if err := t.Authorize(authorization, TokenScopeAdmin); err != nil {
+		return "", ErrNamespaceOverride
+	}
+
+	return requested, nil
+}
+
+type TokenAuthConfig struct {
+	Skipper middleware.Skipper
+
+	// Tokens granted access, authentication is disabled if none are configured.
+	Tokens *Tokens
+
+	// Scope required by the routes.
+	Scope TokenScope
+}
+
+var (
+	DefaultTokenAuthConfig = TokenAuthConfig{
+		Skipper: middleware.DefaultSkipper,
+		Scope:   TokenScopeAdmin,
+	}
+)
+
+// TokenAuthWithConfig rejects all requests without a valid bearer token (Authorization header) with 401 Unauthorized,
+// requests with a token lacking the scope with 403 Forbidden.
+func TokenAuthWithConfig(config TokenAuthConfig) echo.MiddlewareFunc {
+	if config.Skipper == nil {
+		config.Skipper = DefaultTokenAuthConfig.Skipper
+	}
+
+	if len(config.Scope) == 0 {
+		config.Scope = DefaultTokenAuthConfig.Scope
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if config.Skipper(c) || !config.Tokens.Enabled() {
+				return next(c)
+			}
+
+			err := config.Tokens.Authorize(c.Request().Header.Get(echo.HeaderAuthorization), config.Scope)
+			if err == nil {
+				return next(c)
+			}
+
+			util.LogFromEchoContext(c).Warn().Err(err).Str("remoteAddr", c.Request().RemoteAddr).Str("path", c.Path()).Str("scope", string(config.Scope)).Msg("Request rejected")
+
+			if errors.Is(err, ErrTokenInsufficient) {
+				return echo.NewHTTPError(http.StatusForbidden, err.Error())
+			}
+
+			c.Response().Header().Set(echo.HeaderWWWAuthenticate, "Bearer")
+			return echo.NewHTTPError(http.StatusUnauthorized, err.Error())
+		}
+	}
+}
+
+func bearerToken(authorization string) (string, bool) {
+	scheme, token, found := strings.Cut(strings.TrimSpace(authorization), " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+
+	token = strings.TrimSpace(token)
+
+	return token, len(token) > 0
+}
+
+func matchToken(tokens [][]byte, token string) bool {
+	matched := 0
+	for _, t := range tokens {
+		matched |= subtle.ConstantTimeCompare(t, []byte(token))
+	}
+
+	return matched == 1
+}
+
+func tokenBytes(tokens []string) [][]byte {
+	b := make([][]byte, 0, len(tokens))
+	for _, token := range tokens {
+		if token = strings.TrimSpace(token); len(token) > 0 {
+			b = append(b, []byte(token))
+		}
+	}
+
+	return b
+}
@@ -0,0 +1,68 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/allaboutapps/integresql/internal/api/middleware"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenAuth(t *testing.T) {
+	tokens := middleware.NewTokens([]string{"admin-token"}, []string{"runner-token", " "})
+
+	e := echo.New()
+	ok := func(c echo.Context) error {
+		return c.NoContent(http.StatusNoContent)
+	}
+	e.GET("/admin", ok, middleware.TokenAuthWithConfig(middleware.TokenAuthConfig{Tokens: tokens, Scope: middleware.TokenScopeAdmin}))
+	e.GET("/runner", ok, middleware.TokenAuthWithConfig(middleware.TokenAuthConfig{Tokens: tokens, Scope: middleware.TokenScopeRunner}))
+	e.GET("/open", ok, middleware.TokenAuthWithConfig(middleware.TokenAuthConfig{Tokens: middleware.NewTokens(nil, nil)}))
+
+	tests := []struct {
+		path          string
+		authorization string
+		want          int
+	}{
+		{"/admin", "", http.StatusUnauthorized},
+		{"/admin", "Bearer wrong", http.StatusUnauthorized},
+		{"/admin", "Basic admin-token", http.StatusUnauthorized},
+		{"/admin", "Bearer runner-token", http.StatusForbidden},
+		{"/admin", "Bearer admin-token", http.StatusNoContent},
+		{"/runner", "", http.StatusUnauthorized},
+		{"/runner", "bearer runner-token", http.StatusNoContent},
+		{"/runner", "Bearer admin-token", http.StatusNoContent},
+		{"/open", "", http.StatusNoContent},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		if len(tt.authorization) > 0 {
+			req.Header.Set(echo.HeaderAuthorization, tt.authorization)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+
+		assert.Equal(t, tt.want, rec.Code, "%s %q", tt.path, tt.authorization)
+		if tt.want == http.StatusUnauthorized {
+			assert.Equal(t, "Bearer", rec.Header().Get(echo.HeaderWWWAuthenticate))
+		}
+	}
+}
+
+func TestLoadTokensFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens")
+	require.NoError(t, os.WriteFile(path, []byte("# CI runners\nfirst\n\n  second  \n"), 0600))
+
+	tokens, err := middleware.LoadTokensFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"first", "second"}, tokens)
+
+	_, err = middleware.LoadTokensFile(filepath.Join(t.TempDir(), "missing"))
+	assert.Error(t, err)
+}
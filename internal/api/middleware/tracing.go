@@ -0,0 +1,69 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/allaboutapps/integresql/pkg/tracing"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+type TracingConfig struct {
+	Skipper middleware.Skipper
+}
+
+var (
+	DefaultTracingConfig = TracingConfig{
+		// scrapes would flood the traces
+		Skipper: func(c echo.Context) bool {
+			return c.Path() == "/metrics"
+		},
+	}
+)
+
+// Tracing starts a server span for each request, the spans of the manager and the pools become its children.
+func Tracing() echo.MiddlewareFunc {
+	return TracingWithConfig(DefaultTracingConfig)
+}
+
+// TracingWithConfig starts a server span for each request (continuing the trace propagated by the client), named by
+// the method and route (e.g. "GET /api/v1/templates/:hash/tests").
+func TracingWithConfig(config TracingConfig) echo.MiddlewareFunc {
+	if config.Skipper == nil {
+		config.Skipper = DefaultTracingConfig.Skipper
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if config.Skipper(c) {
+				return next(c)
+			}
+
+			ctx, span := tracing.StartHTTP(c.Request(), c.Path())
+			defer span.End()
+
+			c.SetRequest(c.Request().WithContext(ctx))
+
+			err := next(c)
+
+			// the error is yet to be turned into the response by the error handler
+			status := c.Response().Status
+			if err != nil {
+				status = http.StatusInternalServerError
+
+				var httpErr *echo.HTTPError
+				if errors.As(err, &httpErr) {
+					status = httpErr.Code
+				}
+			}
+
+			span.SetHTTPStatus(status)
+			if status >= http.StatusInternalServerError {
+				span.RecordError(err)
+			}
+
+			return err
+		}
+	}
+}
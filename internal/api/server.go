@@ -2,6 +2,8 @@ package api
 
 import (
 	"context"
+	"crypto/ed25519"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"log"
@@ -11,15 +13,50 @@ import (
 	// #nosec G108 - pprof handlers (conditionally made available via http.DefaultServeMux within router)
 	_ "net/http/pprof"
 
+	"github.com/allaboutapps/integresql/internal/api/middleware"
+	"github.com/allaboutapps/integresql/pkg/audit"
 	"github.com/allaboutapps/integresql/pkg/manager"
+	"github.com/allaboutapps/integresql/pkg/metrics"
+	"github.com/allaboutapps/integresql/pkg/tracing"
 	"github.com/allaboutapps/integresql/pkg/util"
 	"github.com/labstack/echo/v4"
+	"google.golang.org/grpc"
 )
 
 type Server struct {
 	Config  ServerConfig
 	Echo    *echo.Echo
-	Manager *manager.Manager
+	Manager manager.ManagerAPI
+	Metrics metrics.Metrics // backend receiving the metrics of all manager operations, set by InitManager
+	Audit   *audit.Store    // records destructive admin actions, opened by router.Init if an AuditFile is configured
+
+	// AdminEcho serves the admin routes (/api/v1/admin, metrics, debug) on the separate AdminPort, nil if Echo serves all routes
+	AdminEcho *echo.Echo
+
+	// Interceptors are custom interceptors inserted into the chain of the API routes by router.Init, see Interceptor
+	Interceptors []Interceptor
+
+	// Chain of all interceptors (built-in and custom ones) wrapping the API routes, built by router.Init
+	Chain InterceptorChain
+
+	// Startup holds the API requests until the manager is ready, nil unless the LazyConnect is enabled
+	Startup *middleware.StartupQueue
+
+	// GRPC serves the gRPC API on the GRPCPort sharing the Manager, nil if disabled
+	GRPC *grpc.Server
+
+	// SigningKey signs the responses of acquiring and returning test databases, parsed by router.Init from the
+	// ResponseSigningKey, nil if disabled
+	SigningKey ed25519.PrivateKey
+
+	// Tokens authenticate all requests, loaded by router.Init from the AdminTokens and RunnerTokens (and their files)
+	Tokens *middleware.Tokens
+
+	// TLS terminated by all listeners, loaded by router.Init from the TLSCertFile and TLSKeyFile, nil serves plain HTTP
+	TLS *tls.Config
+
+	shutdownTracing func(context.Context) error // flushes pending spans, set by InitManager
+	startupErr      chan error                  // result of starting the manager lazily, see AwaitManager
 }
 
 func NewServer(config ServerConfig) *Server {
@@ -29,6 +66,11 @@ func NewServer(config ServerConfig) *Server {
 		Manager: nil,
 	}
 
+	if config.LazyConnect {
+		s.Startup = middleware.NewStartupQueue(config.StartupQueueSize)
+		s.startupErr = make(chan error, 1)
+	}
+
 	return s
 }
 
@@ -41,26 +83,195 @@ func (s *Server) Ready() bool {
 }
 
 func (s *Server) Start() error {
-	if !s.Ready() {
+	// starting lazily, the manager becomes ready in background while the startup queue holds the requests
+	lazy := s.Startup != nil && s.Echo != nil && s.Manager != nil
+	if !s.Ready() && !lazy {
 		return errors.New("server is not ready")
 	}
 
-	return s.Echo.Start(net.JoinHostPort(s.Config.Address, fmt.Sprintf("%d", s.Config.Port)))
+	listeners := []func() error{
+		func() error {
+			return s.startEcho(s.Echo, net.JoinHostPort(s.Config.Address, fmt.Sprintf("%d", s.Config.Port)))
+		},
+	}
+
+	if s.AdminEcho != nil {
+		listeners = append(listeners, func() error {
+			return s.startEcho(s.AdminEcho, net.JoinHostPort(s.Config.AdminAddress, fmt.Sprintf("%d", s.Config.AdminPort)))
+		})
+	}
+
+	if s.GRPC != nil {
+		listeners = append(listeners, func() error {
+			lis, err := net.Listen("tcp", net.JoinHostPort(s.Config.GRPCAddress, fmt.Sprintf("%d", s.Config.GRPCPort)))
+			if err != nil {
+				return err
+			}
+
+			return s.GRPC.Serve(lis)
+		})
+	}
+
+	if len(listeners) == 1 {
+		return listeners[0]()
+	}
+
+	// returns as soon as either of the listeners stops (e.g. fails to bind or shuts down)
+	errs := make(chan error, len(listeners))
+	for _, listen := range listeners {
+		listen := listen
+		go func() {
+			errs <- listen()
+		}()
+	}
+
+	return <-errs
+}
+
+// startEcho serves the echo instance on the address, terminating TLS if configured. Unlike echo's StartTLS, the
+// configured http.Server (timeouts, keep-alive) serves TLS as well.
+func (s *Server) startEcho(e *echo.Echo, address string) error {
+	if s.TLS == nil {
+		return e.Start(address)
+	}
+
+	e.Server.Addr = address
+	e.Server.TLSConfig = s.TLS.Clone()
+
+	return e.StartServer(e.Server)
+}
+
+// RouteMiddlewares returns the middlewares of the interceptor chain applied to a route of the group.
+func (s *Server) RouteMiddlewares(group RouteGroup, destructive bool) []echo.MiddlewareFunc {
+	return s.Chain.Middlewares(group, destructive)
+}
+
+// AdminRouter returns the echo instance serving the admin routes.
+func (s *Server) AdminRouter() *echo.Echo {
+	if s.AdminEcho != nil {
+		return s.AdminEcho
+	}
+
+	return s.Echo
 }
 
 func (s *Server) Shutdown(ctx context.Context) error {
 	if s.Manager != nil {
+		if s.Config.DropAllOnShutdown && s.Manager.Ready() {
+			if err := s.Manager.DropAllDatabases(ctx); err != nil {
+				log.Printf("Received error while dropping all databases during shutdown: %v", err)
+			}
+		}
+
 		if err := s.Manager.Disconnect(ctx, true); err != nil {
 			log.Printf("Received error while disconnecting manager during shutdown: %v", err)
 		}
+
+		// all other endpoints respond with 503 by now, give operators the chance to fetch the shutdown report
+		if s.Config.ShutdownReportRetention > 0 {
+			select {
+			case <-time.After(s.Config.ShutdownReportRetention):
+			case <-ctx.Done():
+			}
+		}
+	}
+
+	if s.Metrics != nil {
+		if err := s.Metrics.Close(); err != nil {
+			log.Printf("Received error while closing metrics during shutdown: %v", err)
+		}
+	}
+
+	if s.shutdownTracing != nil {
+		if err := s.shutdownTracing(ctx); err != nil {
+			log.Printf("Received error while flushing traces during shutdown: %v", err)
+		}
+	}
+
+	if s.Audit != nil {
+		if err := s.Audit.Close(); err != nil {
+			log.Printf("Received error while closing the audit store during shutdown: %v", err)
+		}
+	}
+
+	if s.GRPC != nil {
+		stopGRPC(ctx, s.GRPC)
+	}
+
+	if s.AdminEcho != nil {
+		return errors.Join(s.Echo.Shutdown(ctx), s.AdminEcho.Shutdown(ctx))
 	}
 
 	return s.Echo.Shutdown(ctx)
 }
 
+// stopGRPC waits for the pending calls to finish, cancelling them once the ctx is done.
+func stopGRPC(ctx context.Context, server *grpc.Server) {
+	stopped := make(chan struct{})
+	go func() {
+		server.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		server.Stop()
+	}
+}
+
+// InitManager initializes the manager, the metrics and tracing. With LazyConnect, the manager is initialized in
+// background instead, the requests are held by the Startup queue until it is ready, see AwaitManager.
 func (s *Server) InitManager(ctx context.Context) error {
+	// before the manager starts its pools, their background spans are exported as well
+	shutdownTracing, err := tracing.Init(ctx, s.Config.Tracing)
+	if err != nil {
+		return err
+	}
+	s.shutdownTracing = shutdownTracing
+
+	mx, err := metrics.New(s.Config.Metrics)
+	if err != nil {
+		return err
+	}
+
 	m := manager.DefaultFromEnv()
 
+	s.Metrics = mx
+	s.Manager = manager.Instrument(m, mx)
+
+	if s.Startup == nil {
+		return s.startManager(ctx, m)
+	}
+
+	go func() {
+		err := s.startManager(ctx, m)
+		if err == nil {
+			s.Startup.Open()
+		}
+
+		s.startupErr <- err
+	}()
+
+	return nil
+}
+
+// AwaitManager blocks until the manager initialized lazily by InitManager is ready, returning the error if it failed.
+// Returns nil immediately unless LazyConnect is enabled, must only be called once.
+func (s *Server) AwaitManager(ctx context.Context) error {
+	if s.startupErr == nil {
+		return nil
+	}
+
+	select {
+	case err := <-s.startupErr:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *Server) startManager(ctx context.Context, m *manager.Manager) error {
 	if err := util.Retry(30, 1*time.Second, func() error {
 		ctxx, cancel := context.WithTimeout(ctx, 10*time.Second)
 		defer cancel()
@@ -70,7 +281,18 @@ func (s *Server) InitManager(ctx context.Context) error {
 		return err
 	}
 
-	s.Manager = m
+	// startup barrier: the first clients after a restart shouldn't each pay the cold build of their template
+	if cfg := m.Config(); cfg.StartupPrebuildTemplates > 0 {
+		ctxx, cancel := context.WithTimeout(ctx, cfg.StartupPrebuildTimeout)
+		summary, err := m.PrebuildTemplates(ctxx)
+		cancel()
+		if err != nil {
+			log.Printf("Serving without all prebuilt templates (%d prebuilt): %v", len(summary.Prebuilt), err)
+		}
+	}
+
+	// sampled only once ready, the manager is not safe for concurrent use while initializing
+	s.Metrics.Collect(m.MetricSamples)
 
 	return nil
 }
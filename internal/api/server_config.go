@@ -3,16 +3,57 @@ package api
 import (
 	"time"
 
+	"github.com/allaboutapps/integresql/pkg/metrics"
+	"github.com/allaboutapps/integresql/pkg/tracing"
 	"github.com/allaboutapps/integresql/pkg/util"
 	"github.com/rs/zerolog"
 )
 
 type ServerConfig struct {
-	Address        string
-	Port           int
-	DebugEndpoints bool
-	Logger         LoggerConfig
-	Echo           EchoConfig
+	Address           string
+	Port              int
+	AdminAddress      string // address of the admin listener, see AdminPort
+	AdminPort         int    // serves the admin routes (/api/v1/admin, metrics, debug) on a separate listener, 0 serves them on Port
+	DebugEndpoints    bool
+	DropAllOnShutdown bool // drops all managed template and test databases while shutting down
+	// keeps serving the shutdown report (GET /api/v1/admin/shutdown-report) for this duration after disconnecting the manager
+	ShutdownReportRetention time.Duration
+	// blocked acquisitions of test databases log their progress (phase, pool state, estimate) in this interval (0 disables it)
+	ProgressLogInterval time.Duration
+	// file of the audit store recording all discards, resets and prefix migrations (empty disables it), see GET /api/v1/admin/audit
+	AuditFile string
+	// CIDRs (or IPs) allowed to call destructive endpoints (initialize, discard, reset), diagnostics and the shutdown report, empty allows everyone
+	DestructiveEndpointsAllowlist []string
+	// sensitive, static bearer tokens granted all endpoints (admin) or the templates, test databases and info (runner),
+	// merged with the tokens of the files (one per line). Without any token, authentication is disabled.
+	AdminTokens      []string `json:"-"`
+	RunnerTokens     []string `json:"-"`
+	AdminTokensFile  string
+	RunnerTokensFile string
+	Logger           LoggerConfig
+	Echo             EchoConfig
+	Metrics          metrics.Config
+	Tracing          tracing.Config
+
+	// serve right away while the manager connects in background, API requests are held (see StartupQueueSize) until it is ready
+	LazyConnect bool
+	// max number of requests held while starting lazily (0 is unlimited), further ones are rejected with 503
+	StartupQueueSize int
+	// max time a request is held while starting lazily, afterwards it's rejected with 503
+	StartupQueueTimeout time.Duration
+
+	// serves the gRPC API (see proto/integresql/v1) on this port in addition to the HTTP API, 0 disables it
+	GRPCPort int
+	// address of the gRPC listener, see GRPCPort
+	GRPCAddress string
+
+	// sensitive, base64 Ed25519 private key (32 byte seed or 64 byte key) signing the responses of acquiring and returning test
+	// databases, see the signature package. Empty disables signing.
+	ResponseSigningKey string `json:"-"`
+
+	// PEM certificate (chain) and key files, all listeners (HTTP, admin and gRPC) serve TLS if set, empty disables it
+	TLSCertFile string
+	TLSKeyFile  string
 }
 
 type EchoConfig struct {
@@ -24,7 +65,17 @@ type EchoConfig struct {
 	EnableRequestIDMiddleware     bool
 	EnableTrailingSlashMiddleware bool
 	EnableTimeoutMiddleware       bool
+	EnableGzipMiddleware          bool
+	EnableDeadlineHintMiddleware  bool // forwards the client deadline (X-Integresql-Deadline-Ms header) to the manager
+	GzipMinLength                 int  // responses smaller than this (bytes) are not compressed
 	RequestTimeout                time.Duration
+
+	// http.Server settings (0 disables the timeout)
+	EnableKeepAlive   bool
+	ReadHeaderTimeout time.Duration
+	ReadTimeout       time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
 }
 
 type LoggerConfig struct {
@@ -40,9 +91,28 @@ type LoggerConfig struct {
 
 func DefaultServerConfigFromEnv() ServerConfig {
 	return ServerConfig{
-		Address:        util.GetEnv("INTEGRESQL_ADDRESS", ""),
-		Port:           util.GetEnvAsInt("INTEGRESQL_PORT", 5000),
-		DebugEndpoints: util.GetEnvAsBool("INTEGRESQL_DEBUG_ENDPOINTS", false), // https://golang.org/pkg/net/http/pprof/
+		Address:                       util.GetEnv("INTEGRESQL_ADDRESS", ""),
+		Port:                          util.GetEnvAsInt("INTEGRESQL_PORT", 5000),
+		AdminAddress:                  util.GetEnv("INTEGRESQL_ADMIN_ADDRESS", util.GetEnv("INTEGRESQL_ADDRESS", "")),
+		AdminPort:                     util.GetEnvAsInt("INTEGRESQL_ADMIN_PORT", 0 /*disabled*/),
+		DebugEndpoints:                util.GetEnvAsBool("INTEGRESQL_DEBUG_ENDPOINTS", false), // https://golang.org/pkg/net/http/pprof/
+		DropAllOnShutdown:             util.GetEnvAsBool("INTEGRESQL_SHUTDOWN_DROP_ALL", false),
+		ShutdownReportRetention:       time.Millisecond * time.Duration(util.GetEnvAsInt("INTEGRESQL_SHUTDOWN_REPORT_RETENTION_MS", 0 /*disabled*/)),
+		DestructiveEndpointsAllowlist: util.GetEnvAsStringArr("INTEGRESQL_DESTRUCTIVE_ENDPOINTS_ALLOWLIST", []string{}),
+		AdminTokens:                   util.GetEnvAsStringArr("INTEGRESQL_ADMIN_TOKENS", []string{}),
+		RunnerTokens:                  util.GetEnvAsStringArr("INTEGRESQL_RUNNER_TOKENS", []string{}),
+		AdminTokensFile:               util.GetEnv("INTEGRESQL_ADMIN_TOKENS_FILE", ""),
+		RunnerTokensFile:              util.GetEnv("INTEGRESQL_RUNNER_TOKENS_FILE", ""),
+		AuditFile:                     util.GetEnv("INTEGRESQL_AUDIT_FILE", ""),
+		ProgressLogInterval:           time.Millisecond * time.Duration(util.GetEnvAsInt("INTEGRESQL_PROGRESS_LOG_INTERVAL_MS", 10*1000 /*10 sec*/)),
+		LazyConnect:                   util.GetEnvAsBool("INTEGRESQL_LAZY_CONNECT", false),
+		StartupQueueSize:              util.GetEnvAsInt("INTEGRESQL_STARTUP_QUEUE_SIZE", 1000),
+		StartupQueueTimeout:           time.Millisecond * time.Duration(util.GetEnvAsInt("INTEGRESQL_STARTUP_QUEUE_TIMEOUT_MS", util.GetEnvAsInt("INTEGRESQL_ECHO_REQUEST_TIMEOUT_MS", 60*1000 /*1 min*/))),
+		GRPCPort:                      util.GetEnvAsInt("INTEGRESQL_GRPC_PORT", 0 /*disabled*/),
+		GRPCAddress:                   util.GetEnv("INTEGRESQL_GRPC_ADDRESS", util.GetEnv("INTEGRESQL_ADDRESS", "")),
+		ResponseSigningKey:            util.GetEnv("INTEGRESQL_RESPONSE_SIGNING_KEY", ""),
+		TLSCertFile:                   util.GetEnv("INTEGRESQL_TLS_CERT_FILE", ""),
+		TLSKeyFile:                    util.GetEnv("INTEGRESQL_TLS_KEY_FILE", ""),
 		Echo: EchoConfig{
 			Debug:                         util.GetEnvAsBool("INTEGRESQL_ECHO_DEBUG", false),
 			EnableCORSMiddleware:          util.GetEnvAsBool("INTEGRESQL_ECHO_ENABLE_CORS_MIDDLEWARE", true),
@@ -51,10 +121,35 @@ func DefaultServerConfigFromEnv() ServerConfig {
 			EnableRequestIDMiddleware:     util.GetEnvAsBool("INTEGRESQL_ECHO_ENABLE_REQUEST_ID_MIDDLEWARE", true),
 			EnableTrailingSlashMiddleware: util.GetEnvAsBool("INTEGRESQL_ECHO_ENABLE_TRAILING_SLASH_MIDDLEWARE", true),
 			EnableTimeoutMiddleware:       util.GetEnvAsBool("INTEGRESQL_ECHO_ENABLE_REQUEST_TIMEOUT_MIDDLEWARE", true),
+			EnableGzipMiddleware:          util.GetEnvAsBool("INTEGRESQL_ECHO_ENABLE_GZIP_MIDDLEWARE", true),
+			GzipMinLength:                 util.GetEnvAsInt("INTEGRESQL_ECHO_GZIP_MIN_LENGTH", 1024),
+			EnableDeadlineHintMiddleware:  util.GetEnvAsBool("INTEGRESQL_ECHO_ENABLE_DEADLINE_HINT_MIDDLEWARE", true),
 
 			// typically these timeouts should be the same as INTEGRESQL_TEMPLATE_FINALIZE_TIMEOUT_MS and INTEGRESQL_TEST_DB_GET_TIMEOUT_MS
 			// pkg/manager/manager_config.go
 			RequestTimeout: time.Millisecond * time.Duration(util.GetEnvAsInt("INTEGRESQL_ECHO_REQUEST_TIMEOUT_MS", 60*1000 /*1 min*/)), // affects INTEGRESQL_TEMPLATE_FINALIZE_TIMEOUT_MS and INTEGRESQL_TEST_DB_GET_TIMEOUT_MS
+
+			// keep-alive connections are reused by clients polling stats or checking out many test databases
+			EnableKeepAlive:   util.GetEnvAsBool("INTEGRESQL_SERVER_ENABLE_KEEP_ALIVE", true),
+			ReadHeaderTimeout: time.Millisecond * time.Duration(util.GetEnvAsInt("INTEGRESQL_SERVER_READ_HEADER_TIMEOUT_MS", 10*1000 /*10 sec*/)),
+			ReadTimeout:       time.Millisecond * time.Duration(util.GetEnvAsInt("INTEGRESQL_SERVER_READ_TIMEOUT_MS", 0 /*disabled*/)),
+			WriteTimeout:      time.Millisecond * time.Duration(util.GetEnvAsInt("INTEGRESQL_SERVER_WRITE_TIMEOUT_MS", 0 /*disabled, must exceed INTEGRESQL_ECHO_REQUEST_TIMEOUT_MS*/)),
+			IdleTimeout:       time.Millisecond * time.Duration(util.GetEnvAsInt("INTEGRESQL_SERVER_IDLE_TIMEOUT_MS", 120*1000 /*2 min*/)),
+		},
+		Metrics: metrics.Config{
+			Backend:       metrics.Backend(util.GetEnv("INTEGRESQL_METRICS_BACKEND", string(metrics.BackendNone))), // "none", "prometheus" (GET /metrics), "statsd" or "dogstatsd"
+			Prefix:        util.GetEnv("INTEGRESQL_METRICS_PREFIX", "integresql"),
+			StatsdAddress: util.GetEnv("INTEGRESQL_METRICS_STATSD_ADDRESS", "127.0.0.1:8125"),
+
+			RuntimeInterval: time.Millisecond * time.Duration(util.GetEnvAsInt("INTEGRESQL_METRICS_RUNTIME_INTERVAL_MS", 10000 /*10 sec*/)),
+			GaugeInterval:   time.Millisecond * time.Duration(util.GetEnvAsInt("INTEGRESQL_METRICS_GAUGE_INTERVAL_MS", 10000 /*10 sec*/)),
+		},
+		Tracing: tracing.Config{
+			Exporter:      tracing.Exporter(util.GetEnv("INTEGRESQL_TRACING_EXPORTER", string(tracing.ExporterNone))), // "none" or "otlp" (OTLP/HTTP)
+			Endpoint:      util.GetEnv("INTEGRESQL_TRACING_OTLP_ENDPOINT", ""),
+			Insecure:      util.GetEnvAsBool("INTEGRESQL_TRACING_OTLP_INSECURE", false),
+			ServiceName:   util.GetEnv("INTEGRESQL_TRACING_SERVICE_NAME", "integresql"),
+			SamplePercent: util.GetEnvAsInt("INTEGRESQL_TRACING_SAMPLE_PERCENT", 100),
 		},
 		Logger: LoggerConfig{
 			Level:              util.LogLevelFromString(util.GetEnv("INTEGRESQL_LOGGER_LEVEL", zerolog.InfoLevel.String())),
@@ -1,17 +1,29 @@
 package templates
 
-import "github.com/allaboutapps/integresql/internal/api"
+import (
+	"github.com/allaboutapps/integresql/internal/api"
+	"github.com/allaboutapps/integresql/internal/api/middleware"
+	"github.com/labstack/echo/v4"
+)
 
 func InitRoutes(s *api.Server) {
 	g := s.Echo.Group("/api/v1/templates")
 
-	g.POST("", postInitializeTemplate(s))
-	g.PUT("/:hash", putFinalizeTemplate(s))
-	g.DELETE("/:hash", deleteDiscardTemplate(s))
-	g.GET("/:hash/tests", getTestDatabase(s))
-	g.DELETE("/:hash/tests/:id", deleteReturnTestDatabase(s)) // deprecated, use POST /unlock instead
+	destructive := s.RouteMiddlewares(api.RouteGroupTemplates, true)
+	regular := s.RouteMiddlewares(api.RouteGroupTemplates, false)
 
-	g.POST("/:hash/tests/:id/recreate", postRecreateTestDatabase(s))
-	g.POST("/:hash/tests/:id/unlock", postUnlockTestDatabase(s))
+	// acquiring and returning test databases are signed (if a key is configured), proving the DSN came from this instance
+	signed := append(append([]echo.MiddlewareFunc{}, regular...), middleware.SignResponseWithConfig(middleware.SignResponseConfig{Key: s.SigningKey}))
+
+	g.POST("", postInitializeTemplate(s), destructive...)
+	g.POST("/bootstrap", postBootstrapTemplate(s), destructive...)
+	g.PUT("/:hash", putFinalizeTemplate(s), regular...)
+	g.DELETE("/:hash", deleteDiscardTemplate(s), destructive...)
+	g.GET("/:hash/tests", getTestDatabase(s), signed...)
+	g.DELETE("/:hash/tests/:id", deleteReturnTestDatabase(s), signed...) // deprecated, use POST /unlock instead
+
+	g.POST("/:hash/tests/:id/recreate", postRecreateTestDatabase(s), signed...)
+	g.POST("/:hash/tests/:id/unlock", postUnlockTestDatabase(s), signed...)
+	g.POST("/:hash/tests/:id/renew", postRenewTestDatabase(s), regular...)
 
 }
@@ -4,39 +4,187 @@ import (
 	"errors"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/allaboutapps/integresql/internal/api"
+	"github.com/allaboutapps/integresql/pkg/db"
 	"github.com/allaboutapps/integresql/pkg/manager"
 	"github.com/allaboutapps/integresql/pkg/pool"
+	pkgtemplates "github.com/allaboutapps/integresql/pkg/templates"
+	"github.com/allaboutapps/integresql/pkg/util"
 	"github.com/labstack/echo/v4"
 )
 
-func postInitializeTemplate(s *api.Server) echo.HandlerFunc {
-	type requestPayload struct {
-		Hash string `json:"hash"`
+// templatePayload is the payload of initializing (or bootstrapping) a template.
+type templatePayload struct {
+	Hash                      string            `json:"hash"`
+	PostCloneScript           string            `json:"postCloneScript"`
+	ValidationQueries         []string          `json:"validationQueries"`
+	SourceKind                string            `json:"sourceKind"`
+	SourceDatabase            string            `json:"sourceDatabase"`
+	SourceDump                string            `json:"sourceDump"`
+	SourceArtifact            string            `json:"sourceArtifact"`
+	Ephemeral                 bool              `json:"ephemeral"`
+	TTLMs                     int               `json:"ttlMs"`
+	MaxCloneAgeMs             int               `json:"maxCloneAgeMs"`
+	MaxLeaseDurationMs        int               `json:"maxLeaseDurationMs"`
+	FillConcurrency           int               `json:"fillConcurrency"`
+	FillPriority              int               `json:"fillPriority"`
+	InitialPoolSize           int               `json:"initialPoolSize"`
+	MaxPoolSize               int               `json:"maxPoolSize"`
+	SelectionPolicy           string            `json:"selectionPolicy"`
+	Labels                    []string          `json:"labels"`
+	Settings                  map[string]string `json:"settings"`
+	Metadata                  map[string]string `json:"metadata"`
+	Namespace                 string            `json:"namespace"`
+	ReadyWebhook              string            `json:"readyWebhook"`
+	FailedWebhook             string            `json:"failedWebhook"`
+	StaleCheckoutAlertAfterMs int               `json:"staleCheckoutAlertAfterMs"`
+	StaleCheckoutWebhook      string            `json:"staleCheckoutWebhook"`
+	SchemaFingerprint         string            `json:"schemaFingerprint"`
+	Tablespace                string            `json:"tablespace"`
+	CloneTablespace           string            `json:"cloneTablespace"`
+	CloneSettings             map[string]string `json:"cloneSettings"`
+	ChecksumTables            []string          `json:"checksumTables"`
+}
+
+// bindTemplatePayload binds and validates the payload, returns its hash and options.
+func bindTemplatePayload(s *api.Server, c echo.Context) (string, pkgtemplates.TemplateOptions, error) {
+	var payload templatePayload
+
+	if err := c.Bind(&payload); err != nil {
+		return "", pkgtemplates.TemplateOptions{}, err
 	}
 
-	return func(c echo.Context) error {
-		var payload requestPayload
+	if len(payload.Hash) == 0 {
+		return "", pkgtemplates.TemplateOptions{}, echo.NewHTTPError(http.StatusBadRequest, "hash is required")
+	}
 
-		if err := c.Bind(&payload); err != nil {
+	// templates are accounted to the API token, only admins may pick another namespace
+	namespace, err := s.Tokens.TemplateNamespace(c.Request().Header.Get(echo.HeaderAuthorization), payload.Namespace)
+	if err != nil {
+		return "", pkgtemplates.TemplateOptions{}, api.NewHTTPError(http.StatusForbidden, err.Error(), err)
+	}
+
+	return payload.Hash, pkgtemplates.TemplateOptions{
+		PostCloneScript:         payload.PostCloneScript,
+		ValidationQueries:       payload.ValidationQueries,
+		SourceKind:              pkgtemplates.TemplateSourceKind(payload.SourceKind),
+		SourceDatabase:          payload.SourceDatabase,
+		SourceDump:              payload.SourceDump,
+		SourceArtifact:          payload.SourceArtifact,
+		Ephemeral:               payload.Ephemeral,
+		TTL:                     time.Duration(payload.TTLMs) * time.Millisecond,
+		MaxCloneAge:             time.Duration(payload.MaxCloneAgeMs) * time.Millisecond,
+		MaxLeaseDuration:        time.Duration(payload.MaxLeaseDurationMs) * time.Millisecond,
+		FillConcurrency:         payload.FillConcurrency,
+		FillPriority:            payload.FillPriority,
+		InitialPoolSize:         payload.InitialPoolSize,
+		MaxPoolSize:             payload.MaxPoolSize,
+		SelectionPolicy:         payload.SelectionPolicy,
+		Labels:                  payload.Labels,
+		Settings:                payload.Settings,
+		Metadata:                payload.Metadata,
+		Namespace:               namespace,
+		ReadyWebhook:            payload.ReadyWebhook,
+		FailedWebhook:           payload.FailedWebhook,
+		StaleCheckoutAlertAfter: time.Duration(payload.StaleCheckoutAlertAfterMs) * time.Millisecond,
+		StaleCheckoutWebhook:    payload.StaleCheckoutWebhook,
+		SchemaFingerprint:       payload.SchemaFingerprint,
+		Tablespace:              payload.Tablespace,
+		CloneTablespace:         payload.CloneTablespace,
+		CloneSettings:           payload.CloneSettings,
+		ChecksumTables:          payload.ChecksumTables,
+	}, nil
+}
+
+// flattens the quota details into the error response (embedded by value, it must not implement error itself)
+type quotaResponse struct {
+	Message string `json:"message"`
+	manager.TemplateQuotaError
+}
+
+// flattens the collision details into the error response (embedded by value, it must not implement error itself)
+type collisionResponse struct {
+	Message string `json:"message"`
+	manager.TemplateHashCollisionError
+}
+
+func postInitializeTemplate(s *api.Server) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		hash, options, err := bindTemplatePayload(s, c)
+		if err != nil {
 			return err
 		}
 
-		if len(payload.Hash) == 0 {
-			return echo.NewHTTPError(http.StatusBadRequest, "hash is required")
+		template, err := s.Manager.InitializeTemplateDatabaseWithOptions(c.Request().Context(), hash, options)
+		if err != nil {
+			var quotaErr *manager.TemplateQuotaError
+			if errors.As(err, &quotaErr) {
+				return echo.NewHTTPError(http.StatusTooManyRequests, quotaResponse{Message: quotaErr.Error(), TemplateQuotaError: *quotaErr})
+			}
+
+			var collisionErr *manager.TemplateHashCollisionError
+			if errors.As(err, &collisionErr) {
+				return echo.NewHTTPError(http.StatusConflict, collisionResponse{Message: collisionErr.Error(), TemplateHashCollisionError: *collisionErr})
+			}
+
+			if errors.Is(err, manager.ErrManagerNotReady) {
+				return echo.ErrServiceUnavailable
+			} else if errors.Is(err, manager.ErrTemplateNamespaceConflict) {
+				return api.NewHTTPError(http.StatusConflict, err.Error(), err)
+			} else if errors.Is(err, manager.ErrTemplateAlreadyInitialized) {
+				return api.NewHTTPError(http.StatusLocked, "template is already initialized", err)
+			} else if errors.Is(err, manager.ErrInvalidTemplateOptions) {
+				return api.NewHTTPError(http.StatusBadRequest, err.Error(), err)
+			}
+
+			// default 500
+			return api.NewHTTPError(http.StatusInternalServerError, err.Error(), err)
+		}
+
+		return c.JSON(http.StatusOK, &template)
+	}
+}
+
+// postBootstrapTemplate makes sure a finalized template exists (initializing, restoring and finalizing it or joining
+// the current initialization), it accepts the payload of postInitializeTemplate.
+func postBootstrapTemplate(s *api.Server) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		hash, options, err := bindTemplatePayload(s, c)
+		if err != nil {
+			return err
 		}
 
-		template, err := s.Manager.InitializeTemplateDatabase(c.Request().Context(), payload.Hash)
+		template, err := s.Manager.BootstrapTemplateDatabase(c.Request().Context(), hash, options)
 		if err != nil {
+			var quotaErr *manager.TemplateQuotaError
+			if errors.As(err, &quotaErr) {
+				return echo.NewHTTPError(http.StatusTooManyRequests, quotaResponse{Message: quotaErr.Error(), TemplateQuotaError: *quotaErr})
+			}
+
+			var collisionErr *manager.TemplateHashCollisionError
+			if errors.As(err, &collisionErr) {
+				return echo.NewHTTPError(http.StatusConflict, collisionResponse{Message: collisionErr.Error(), TemplateHashCollisionError: *collisionErr})
+			}
+
 			if errors.Is(err, manager.ErrManagerNotReady) {
 				return echo.ErrServiceUnavailable
-			} else if errors.Is(err, manager.ErrTemplateAlreadyInitialized) {
-				return echo.NewHTTPError(http.StatusLocked, "template is already initialized")
+			} else if errors.Is(err, manager.ErrTemplateNamespaceConflict) {
+				return api.NewHTTPError(http.StatusConflict, err.Error(), err)
+			} else if errors.Is(err, manager.ErrInvalidTemplateOptions) {
+				return api.NewHTTPError(http.StatusBadRequest, err.Error(), err)
+			} else if errors.Is(err, manager.ErrTemplateDiscarded) {
+				return api.NewHTTPError(http.StatusGone, "template was just discarded", err)
+			} else if errors.Is(err, manager.ErrDeadlineExceeded) {
+				return api.NewHTTPError(http.StatusRequestTimeout, err.Error(), err)
+			} else if errors.Is(err, manager.ErrInvalidTemplateState) {
+				// joined template wasn't finalized within the TemplateFinalizeTimeout
+				return api.NewHTTPError(http.StatusRequestTimeout, "template was not finalized in time", err)
 			}
 
 			// default 500
-			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+			return api.NewHTTPError(http.StatusInternalServerError, err.Error(), err)
 		}
 
 		return c.JSON(http.StatusOK, &template)
@@ -54,11 +202,14 @@ func putFinalizeTemplate(s *api.Server) echo.HandlerFunc {
 			} else if errors.Is(err, manager.ErrManagerNotReady) {
 				return echo.ErrServiceUnavailable
 			} else if errors.Is(err, manager.ErrTemplateNotFound) {
-				return echo.NewHTTPError(http.StatusNotFound, "template not found")
+				return api.NewHTTPError(http.StatusNotFound, "template not found", err)
+			} else if errors.Is(err, manager.ErrInvalidTemplateOptions) {
+				// e.g. an unknown checksum table
+				return api.NewHTTPError(http.StatusBadRequest, err.Error(), err)
 			}
 
 			// default 500
-			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+			return api.NewHTTPError(http.StatusInternalServerError, err.Error(), err)
 		}
 
 		return c.NoContent(http.StatusNoContent)
@@ -66,48 +217,165 @@ func putFinalizeTemplate(s *api.Server) echo.HandlerFunc {
 }
 
 func deleteDiscardTemplate(s *api.Server) echo.HandlerFunc {
+
+	// flattens the blocking backends into the error response (embedded by value, it must not implement error itself)
+	type inUseResponse struct {
+		Message string `json:"message"`
+		manager.TemplateInUseError
+	}
+
 	return func(c echo.Context) error {
 		hash := c.Param("hash")
 
 		if err := s.Manager.DiscardTemplateDatabase(c.Request().Context(), hash); err != nil {
+			var inUseErr *manager.TemplateInUseError
+			if errors.As(err, &inUseErr) {
+				return echo.NewHTTPError(http.StatusLocked, inUseResponse{Message: inUseErr.Error(), TemplateInUseError: *inUseErr})
+			}
+
 			if errors.Is(err, manager.ErrManagerNotReady) {
 				return echo.ErrServiceUnavailable
 			} else if errors.Is(err, manager.ErrTemplateNotFound) {
-				return echo.NewHTTPError(http.StatusNotFound, "template not found")
+				return api.NewHTTPError(http.StatusNotFound, "template not found", err)
 			}
 
 			// default 500
-			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+			return api.NewHTTPError(http.StatusInternalServerError, err.Error(), err)
 		}
 
 		return c.NoContent(http.StatusNoContent)
 	}
 }
 
+// headerHolder identifies the holder of the checked out test database (e.g. the CI job), reported by stale checkout alerts.
+const headerHolder = "X-Integresql-Holder"
+
 func getTestDatabase(s *api.Server) echo.HandlerFunc {
 
 	return func(c echo.Context) error {
 		hash := c.Param("hash")
 
-		test, err := s.Manager.GetTestDatabase(c.Request().Context(), hash)
+		// ?skipClean=true accepts a dirty test database as-is (flagged via "dirty")
+		var skipClean bool
+		if param := c.QueryParam("skipClean"); len(param) > 0 {
+			var err error
+			if skipClean, err = strconv.ParseBool(param); err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest, "invalid skipClean")
+			}
+		}
+
+		// ?index=<k> acquires the test database with this ID (e.g. of CI worker k), created if absent
+		var index *int
+		if param := c.QueryParam("index"); len(param) > 0 {
+			i, err := strconv.Atoi(param)
+			if err != nil || i < 0 {
+				return echo.NewHTTPError(http.StatusBadRequest, "invalid index")
+			}
+			index = &i
+		}
+
+		// ?leaseMs=<ms> reclaims the test database as soon as the lease expired without being returned or renewed
+		var lease time.Duration
+		if param := c.QueryParam("leaseMs"); len(param) > 0 {
+			ms, err := strconv.Atoi(param)
+			if err != nil || ms <= 0 {
+				return echo.NewHTTPError(http.StatusBadRequest, "invalid leaseMs")
+			}
+			lease = time.Duration(ms) * time.Millisecond
+		}
+
+		// ?owner=<role> hands out the test database owned by the (allowlisted) role, the config connects as it
+		owner := c.QueryParam("owner")
+
+		// ?dryRun=true explains the decision of the acquisition instead of checking out a test database
+		if param := c.QueryParam("dryRun"); len(param) > 0 {
+			dryRun, err := strconv.ParseBool(param)
+			if err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest, "invalid dryRun")
+			}
+
+			if dryRun {
+				return explainGetTestDatabase(c, s, hash, manager.TestDatabaseOptions{SkipClean: skipClean, Index: index, LeaseDuration: lease, Owner: owner})
+			}
+		}
+
+		// defaults to the remote address of the client
+		holder := c.Request().Header.Get(headerHolder)
+		if len(holder) == 0 {
+			holder = c.RealIP()
+		}
+		ctx := pool.WithHolder(c.Request().Context(), holder)
+
+		// surface slow acquisitions instead of a silent hang
+		if s.Config.ProgressLogInterval > 0 {
+			ctx = manager.WithProgress(ctx, s.Config.ProgressLogInterval, func(p manager.Progress) error {
+				event := util.LogFromEchoContext(c).Info().
+					Str("hash", p.Hash).
+					Str("phase", string(p.Phase)).
+					Str("templateState", string(p.TemplateState)).
+					Dur("elapsed", p.Elapsed).
+					Dur("remaining", p.Remaining)
+				if p.EstimatedRemaining != nil {
+					event = event.Dur("estimatedRemaining", *p.EstimatedRemaining)
+				}
+				if p.Pool != nil {
+					event = event.Str("decision", string(p.Pool.Decision)).Int("ready", p.Pool.Ready).Int("recreating", p.Pool.Recreating)
+				}
+				event.Msg("Still waiting for a test database")
+
+				return nil
+			})
+		}
+
+		var test db.TestDatabase
+		var err error
+		if skipClean || index != nil || lease > 0 || len(owner) > 0 {
+			test, err = s.Manager.GetTestDatabaseWithOptions(ctx, hash, manager.TestDatabaseOptions{SkipClean: skipClean, Index: index, LeaseDuration: lease, Owner: owner})
+		} else {
+			test, err = s.Manager.GetTestDatabase(ctx, hash)
+		}
 		if err != nil {
 
 			if errors.Is(err, manager.ErrManagerNotReady) {
 				return echo.ErrServiceUnavailable
 			} else if errors.Is(err, manager.ErrTemplateNotFound) {
-				return echo.NewHTTPError(http.StatusNotFound, "template not found")
+				return api.NewHTTPError(http.StatusNotFound, "template not found", err)
 			} else if errors.Is(err, manager.ErrTemplateDiscarded) {
-				return echo.NewHTTPError(http.StatusGone, "template was just discarded")
+				return api.NewHTTPError(http.StatusGone, "template was just discarded", err)
+			} else if errors.Is(err, manager.ErrDeadlineExceeded) {
+				return api.NewHTTPError(http.StatusRequestTimeout, err.Error(), err)
+			} else if errors.Is(err, manager.ErrInvalidTestDatabaseOptions) {
+				return api.NewHTTPError(http.StatusBadRequest, err.Error(), err)
+			} else if errors.Is(err, pool.ErrCircuitOpen) {
+				return api.NewHTTPError(http.StatusServiceUnavailable, err.Error(), err)
 			}
 
 			// default 500
-			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+			return api.NewHTTPError(http.StatusInternalServerError, err.Error(), err)
 		}
 
 		return c.JSON(http.StatusOK, &test)
 	}
 }
 
+func explainGetTestDatabase(c echo.Context, s *api.Server, hash string, options manager.TestDatabaseOptions) error {
+	explanation, err := s.Manager.ExplainGetTestDatabase(c.Request().Context(), hash, options)
+	if err != nil {
+		if errors.Is(err, manager.ErrManagerNotReady) {
+			return echo.ErrServiceUnavailable
+		} else if errors.Is(err, manager.ErrTemplateNotFound) {
+			return api.NewHTTPError(http.StatusNotFound, "template not found", err)
+		} else if errors.Is(err, manager.ErrInvalidTestDatabaseOptions) {
+			return api.NewHTTPError(http.StatusBadRequest, err.Error(), err)
+		}
+
+		// default 500
+		return api.NewHTTPError(http.StatusInternalServerError, err.Error(), err)
+	}
+
+	return c.JSON(http.StatusOK, &explanation)
+}
+
 // deprecated
 func deleteReturnTestDatabase(s *api.Server) echo.HandlerFunc {
 	return postUnlockTestDatabase(s)
@@ -125,21 +393,68 @@ func postUnlockTestDatabase(s *api.Server) echo.HandlerFunc {
 			if errors.Is(err, manager.ErrManagerNotReady) {
 				return echo.ErrServiceUnavailable
 			} else if errors.Is(err, manager.ErrTemplateNotFound) {
-				return echo.NewHTTPError(http.StatusNotFound, "template not found")
+				return api.NewHTTPError(http.StatusNotFound, "template not found", err)
 			} else if errors.Is(err, manager.ErrTestNotFound) {
-				return echo.NewHTTPError(http.StatusNotFound, "test database not found")
+				return api.NewHTTPError(http.StatusNotFound, "test database not found", err)
 			} else if errors.Is(err, pool.ErrTestDBInUse) {
-				return echo.NewHTTPError(http.StatusLocked, pool.ErrTestDBInUse.Error())
+				return api.NewHTTPError(http.StatusLocked, pool.ErrTestDBInUse.Error(), err)
+			} else if errors.Is(err, manager.ErrDeadlineExceeded) {
+				return api.NewHTTPError(http.StatusRequestTimeout, err.Error(), err)
 			}
 
 			// default 500
-			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+			return api.NewHTTPError(http.StatusInternalServerError, err.Error(), err)
 		}
 
 		return c.NoContent(http.StatusNoContent)
 	}
 }
 
+func postRenewTestDatabase(s *api.Server) echo.HandlerFunc {
+	type responsePayload struct {
+		ExpiresAt    *time.Time `json:"expiresAt"`    // null if the test database is never auto-cleaned (overflow)
+		MaxExpiresAt *time.Time `json:"maxExpiresAt"` // null if renewals are unlimited
+	}
+
+	return func(c echo.Context) error {
+		hash := c.Param("hash")
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid test database ID")
+		}
+
+		lease, err := s.Manager.RenewTestDatabase(c.Request().Context(), hash, id)
+		if err != nil {
+			if errors.Is(err, manager.ErrManagerNotReady) {
+				return echo.ErrServiceUnavailable
+			} else if errors.Is(err, manager.ErrTemplateNotFound) {
+				return api.NewHTTPError(http.StatusNotFound, "template not found", err)
+			} else if errors.Is(err, manager.ErrTestNotFound) {
+				return api.NewHTTPError(http.StatusNotFound, "test database not found", err)
+			} else if errors.Is(err, pool.ErrInvalidState) {
+				return api.NewHTTPError(http.StatusConflict, err.Error(), err)
+			} else if errors.Is(err, pool.ErrLeaseExpired) {
+				return api.NewHTTPError(http.StatusGone, err.Error(), err)
+			} else if errors.Is(err, manager.ErrDeadlineExceeded) {
+				return api.NewHTTPError(http.StatusRequestTimeout, err.Error(), err)
+			}
+
+			// default 500
+			return api.NewHTTPError(http.StatusInternalServerError, err.Error(), err)
+		}
+
+		var payload responsePayload
+		if !lease.ExpiresAt.IsZero() {
+			payload.ExpiresAt = &lease.ExpiresAt
+		}
+		if !lease.MaxExpiresAt.IsZero() {
+			payload.MaxExpiresAt = &lease.MaxExpiresAt
+		}
+
+		return c.JSON(http.StatusOK, &payload)
+	}
+}
+
 func postRecreateTestDatabase(s *api.Server) echo.HandlerFunc {
 	return func(c echo.Context) error {
 		hash := c.Param("hash")
@@ -153,15 +468,17 @@ func postRecreateTestDatabase(s *api.Server) echo.HandlerFunc {
 			if errors.Is(err, manager.ErrManagerNotReady) {
 				return echo.ErrServiceUnavailable
 			} else if errors.Is(err, manager.ErrTemplateNotFound) {
-				return echo.NewHTTPError(http.StatusNotFound, "template not found")
+				return api.NewHTTPError(http.StatusNotFound, "template not found", err)
 			} else if errors.Is(err, manager.ErrTestNotFound) {
-				return echo.NewHTTPError(http.StatusNotFound, "test database not found")
+				return api.NewHTTPError(http.StatusNotFound, "test database not found", err)
 			} else if errors.Is(err, pool.ErrTestDBInUse) {
-				return echo.NewHTTPError(http.StatusLocked, pool.ErrTestDBInUse.Error())
+				return api.NewHTTPError(http.StatusLocked, pool.ErrTestDBInUse.Error(), err)
+			} else if errors.Is(err, manager.ErrDeadlineExceeded) {
+				return api.NewHTTPError(http.StatusRequestTimeout, err.Error(), err)
 			}
 
 			// default 500
-			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+			return api.NewHTTPError(http.StatusInternalServerError, err.Error(), err)
 		}
 
 		return c.NoContent(http.StatusNoContent)
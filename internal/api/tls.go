@@ -0,0 +1,36 @@
+package api
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+)
+
+var ErrTLSIncomplete = errors.New("TLS requires both a certificate and a key file")
+
+// TLSEnabled returns true if the listeners serve TLS, see LoadTLSConfig.
+func (c ServerConfig) TLSEnabled() bool {
+	return len(c.TLSCertFile) > 0 || len(c.TLSKeyFile) > 0
+}
+
+// LoadTLSConfig returns the TLS config shared by all listeners (HTTP, admin and gRPC) with the certificate of the
+// TLSCertFile and TLSKeyFile, nil if TLS is disabled.
+func LoadTLSConfig(config ServerConfig) (*tls.Config, error) {
+	if !config.TLSEnabled() {
+		return nil, nil
+	}
+
+	if len(config.TLSCertFile) == 0 || len(config.TLSKeyFile) == 0 {
+		return nil, ErrTLSIncomplete
+	}
+
+	cert, err := tls.LoadX509KeyPair(config.TLSCertFile, config.TLSKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
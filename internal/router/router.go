@@ -5,42 +5,164 @@ import (
 
 	"github.com/allaboutapps/integresql/internal/api"
 	"github.com/allaboutapps/integresql/internal/api/admin"
+	"github.com/allaboutapps/integresql/internal/api/grpcapi"
+	"github.com/allaboutapps/integresql/internal/api/info"
 	"github.com/allaboutapps/integresql/internal/api/middleware"
 	"github.com/allaboutapps/integresql/internal/api/templates"
+	"github.com/allaboutapps/integresql/pkg/audit"
+	"github.com/allaboutapps/integresql/pkg/signature"
 	"github.com/labstack/echo/v4"
 	echoMiddleware "github.com/labstack/echo/v4/middleware"
 	"github.com/rs/zerolog/log"
 )
 
 func Init(s *api.Server) {
-	s.Echo = echo.New()
+	s.Echo = newEcho(s)
 
-	s.Echo.Debug = s.Config.Echo.Debug
-	s.Echo.HideBanner = true
-	s.Echo.Logger.SetOutput(&echoLogger{level: s.Config.Logger.RequestLevel, log: log.With().Str("component", "echo").Logger()})
+	// admin routes on a separate listener, e.g. to only expose the consumer routes to CI runners
+	if s.Config.AdminPort > 0 {
+		s.AdminEcho = newEcho(s)
+	}
+
+	adminRouter := s.AdminRouter()
+
+	// bearer tokens authenticate all endpoints, unless none are configured
+	if s.Tokens == nil {
+		tokens, err := loadTokens(s.Config)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Invalid tokens")
+		}
+		s.Tokens = tokens
+	}
+	if !s.Tokens.Enabled() {
+		log.Warn().Msg("No tokens configured, all endpoints are accessible without authentication")
+	}
+
+	adminAuth := middleware.TokenAuthWithConfig(middleware.TokenAuthConfig{Tokens: s.Tokens, Scope: middleware.TokenScopeAdmin})
+	runnerAuth := middleware.TokenAuthWithConfig(middleware.TokenAuthConfig{Tokens: s.Tokens, Scope: middleware.TokenScopeRunner})
+
+	// scrape endpoint of pull based metrics backends (Prometheus)
+	if s.Metrics != nil {
+		if handler := s.Metrics.Handler(); handler != nil {
+			adminRouter.GET("/metrics", echo.WrapHandler(handler), adminAuth)
+		}
+	}
+
+	// enable debug endpoints only if requested
+	if s.Config.DebugEndpoints {
+		adminRouter.GET("/debug/*", echo.WrapHandler(http.DefaultServeMux), adminAuth)
+	}
+
+	// restrict destructive endpoints to the configured allowlist (if any)
+	ipAllowlist, err := middleware.IPAllowlistWithConfig(middleware.IPAllowlistConfig{
+		Allowlist: s.Config.DestructiveEndpointsAllowlist,
+	})
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid destructive endpoints allowlist")
+	}
+
+	if len(s.Config.ResponseSigningKey) > 0 {
+		if s.SigningKey, err = signature.ParsePrivateKey(s.Config.ResponseSigningKey); err != nil {
+			log.Fatal().Err(err).Msg("Invalid response signing key")
+		}
+	}
+
+	// all listeners terminate TLS, if configured
+	if s.TLS == nil {
+		if s.TLS, err = api.LoadTLSConfig(s.Config); err != nil {
+			log.Fatal().Err(err).Msg("Invalid TLS config")
+		}
+	}
+
+	builtin := []api.Interceptor{}
+
+	// audit denied requests as well
+	if len(s.Config.AuditFile) > 0 {
+		if s.Audit == nil {
+			if s.Audit, err = audit.Open(s.Config.AuditFile); err != nil {
+				log.Fatal().Err(err).Msg("Failed to open the audit store")
+			}
+		}
+
+		builtin = append(builtin, api.Interceptor{Name: api.InterceptorAuditLog, Middleware: middleware.AuditWithConfig(middleware.AuditConfig{Store: s.Audit}), DestructiveOnly: true})
+	}
+
+	if s.Tokens.Enabled() {
+		builtin = append(builtin,
+			api.Interceptor{Name: api.InterceptorAdminTokenAuth, Middleware: adminAuth, Group: api.RouteGroupAdmin},
+			api.Interceptor{Name: api.InterceptorRunnerTokenAuth, Middleware: runnerAuth, Group: api.RouteGroupTemplates},
+		)
+	}
+
+	builtin = append(builtin, api.Interceptor{Name: api.InterceptorIPAllowlist, Middleware: ipAllowlist, DestructiveOnly: true})
+
+	// denied requests are rejected right away, all others wait for the manager to become ready
+	if s.Startup != nil {
+		builtin = append(builtin, api.Interceptor{Name: api.InterceptorStartupQueue, Middleware: middleware.StartupQueueWithConfig(middleware.StartupQueueConfig{
+			Queue:   s.Startup,
+			Timeout: s.Config.StartupQueueTimeout,
+		})})
+	}
+
+	// custom interceptors of forks (see api.Interceptor) are positioned relative to the built-in ones
+	s.Chain, err = api.BuildInterceptorChain(builtin, s.Interceptors)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid interceptors")
+	}
+	log.Debug().Strs("interceptors", s.Chain.Names()).Msg("Interceptor chain built")
+
+	admin.InitRoutes(s)
+	info.InitRoutes(s)
+	templates.InitRoutes(s)
+
+	// the gRPC API shares the manager (and the built-in interceptors) with the HTTP API
+	if s.Config.GRPCPort > 0 {
+		if s.GRPC, err = grpcapi.NewServer(s); err != nil {
+			log.Fatal().Err(err).Msg("Failed to create the gRPC server")
+		}
+	}
+}
+
+// newEcho returns an echo instance with all general middlewares configured.
+func newEcho(s *api.Server) *echo.Echo {
+	e := echo.New()
+
+	e.Debug = s.Config.Echo.Debug
+	e.HideBanner = true
+	e.Logger.SetOutput(&echoLogger{level: s.Config.Logger.RequestLevel, log: log.With().Str("component", "echo").Logger()})
+
+	e.Server.ReadHeaderTimeout = s.Config.Echo.ReadHeaderTimeout
+	e.Server.ReadTimeout = s.Config.Echo.ReadTimeout
+	e.Server.WriteTimeout = s.Config.Echo.WriteTimeout
+	e.Server.IdleTimeout = s.Config.Echo.IdleTimeout
+	e.Server.SetKeepAlivesEnabled(s.Config.Echo.EnableKeepAlive)
 
 	// ---
 	// General middleware
 	if s.Config.Echo.EnableTrailingSlashMiddleware {
-		s.Echo.Pre(echoMiddleware.RemoveTrailingSlash())
+		e.Pre(echoMiddleware.RemoveTrailingSlash())
 	} else {
 		log.Warn().Msg("Disabling trailing slash middleware due to environment config")
 	}
 
 	if s.Config.Echo.EnableRecoverMiddleware {
-		s.Echo.Use(echoMiddleware.Recover())
+		e.Use(echoMiddleware.Recover())
 	} else {
 		log.Warn().Msg("Disabling recover middleware due to environment config")
 	}
 
+	if s.Config.Tracing.Enabled() {
+		e.Use(middleware.Tracing())
+	}
+
 	if s.Config.Echo.EnableRequestIDMiddleware {
-		s.Echo.Use(echoMiddleware.RequestID())
+		e.Use(echoMiddleware.RequestID())
 	} else {
 		log.Warn().Msg("Disabling request ID middleware due to environment config")
 	}
 
 	if s.Config.Echo.EnableLoggerMiddleware {
-		s.Echo.Use(middleware.LoggerWithConfig(middleware.LoggerConfig{
+		e.Use(middleware.LoggerWithConfig(middleware.LoggerConfig{
 			Level:             s.Config.Logger.RequestLevel,
 			LogRequestBody:    s.Config.Logger.LogRequestBody,
 			LogRequestHeader:  s.Config.Logger.LogRequestHeader,
@@ -61,17 +183,52 @@ func Init(s *api.Server) {
 		log.Warn().Msg("Disabling logger middleware due to environment config")
 	}
 
+	if s.Config.Echo.EnableGzipMiddleware {
+		e.Use(echoMiddleware.GzipWithConfig(echoMiddleware.GzipConfig{
+			MinLength: s.Config.Echo.GzipMinLength,
+			Skipper: func(c echo.Context) bool {
+				// already compressed
+				return c.Path() == "/api/v1/admin/diagnostics"
+			},
+		}))
+	} else {
+		log.Warn().Msg("Disabling gzip middleware due to environment config")
+	}
+
+	if s.Config.Echo.EnableDeadlineHintMiddleware {
+		e.Use(middleware.DeadlineHint())
+	} else {
+		log.Warn().Msg("Disabling deadline hint middleware due to environment config")
+	}
+
 	if s.Config.Echo.EnableTimeoutMiddleware {
-		s.Echo.Use(echoMiddleware.TimeoutWithConfig(echoMiddleware.TimeoutConfig{
+		e.Use(echoMiddleware.TimeoutWithConfig(echoMiddleware.TimeoutConfig{
 			Timeout: s.Config.Echo.RequestTimeout,
 		}))
 	}
 
-	// enable debug endpoints only if requested
-	if s.Config.DebugEndpoints {
-		s.Echo.GET("/debug/*", echo.WrapHandler(http.DefaultServeMux))
+	return e
+}
+
+// loadTokens merges the configured tokens with the ones of the tokens files.
+func loadTokens(config api.ServerConfig) (*middleware.Tokens, error) {
+	admin, runner := config.AdminTokens, config.RunnerTokens
+
+	if len(config.AdminTokensFile) > 0 {
+		tokens, err := middleware.LoadTokensFile(config.AdminTokensFile)
+		if err != nil {
+			return nil, err
+		}
+		admin = append(append([]string{}, admin...), tokens...)
 	}
 
-	admin.InitRoutes(s)
-	templates.InitRoutes(s)
+	if len(config.RunnerTokensFile) > 0 {
+		tokens, err := middleware.LoadTokensFile(config.RunnerTokensFile)
+		if err != nil {
+			return nil, err
+		}
+		runner = append(append([]string{}, runner...), tokens...)
+	}
+
+	return middleware.NewTokens(admin, runner), nil
 }
@@ -1,10 +1,40 @@
 package router_test
 
 import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/allaboutapps/integresql/internal/api"
+	"github.com/allaboutapps/integresql/internal/api/middleware"
+	"github.com/allaboutapps/integresql/internal/router"
 	"github.com/allaboutapps/integresql/internal/test"
+	"github.com/allaboutapps/integresql/pkg/audit"
+	"github.com/allaboutapps/integresql/pkg/client"
+	"github.com/allaboutapps/integresql/pkg/db"
+	"github.com/allaboutapps/integresql/pkg/events"
+	"github.com/allaboutapps/integresql/pkg/manager"
+	"github.com/allaboutapps/integresql/pkg/metrics"
+	"github.com/allaboutapps/integresql/pkg/pool"
+	pkgtemplates "github.com/allaboutapps/integresql/pkg/templates"
+	"github.com/labstack/echo/v4"
 	"github.com/stretchr/testify/require"
 )
 
@@ -33,3 +63,1110 @@ func TestPprofDisabled(t *testing.T) {
 		require.Equal(t, 404, res.Result().StatusCode)
 	})
 }
+
+func TestDestructiveEndpointsAllowlist(t *testing.T) {
+	config := api.DefaultServerConfigFromEnv()
+
+	// httptest requests originate from 192.0.2.1
+	config.DestructiveEndpointsAllowlist = []string{"10.0.0.0/8", "127.0.0.1"}
+
+	test.WithTestServerConfigurable(t, config, func(s *api.Server) {
+		res := test.PerformRequest(t, s, "DELETE", "/api/v1/admin/templates", nil, nil)
+		require.Equal(t, 403, res.Result().StatusCode)
+
+		res = test.PerformRequest(t, s, "DELETE", "/api/v1/templates/hash", nil, nil)
+		require.Equal(t, 403, res.Result().StatusCode)
+
+		// non destructive endpoints are not restricted
+		res = test.PerformRequest(t, s, "GET", "/api/v1/admin/stats", nil, nil)
+		require.Equal(t, 200, res.Result().StatusCode)
+	})
+
+	config.DestructiveEndpointsAllowlist = []string{"192.0.2.0/24"}
+
+	test.WithTestServerConfigurable(t, config, func(s *api.Server) {
+		res := test.PerformRequest(t, s, "DELETE", "/api/v1/admin/templates", nil, nil)
+		require.Equal(t, 204, res.Result().StatusCode)
+	})
+}
+
+// stubManager overwrites the methods required by the test, calling any other method panics.
+type stubManager struct {
+	manager.ManagerAPI
+}
+
+func (stubManager) Ready() bool { return true }
+
+func (stubManager) InitializeTemplateDatabaseWithOptions(_ context.Context, hash string, options pkgtemplates.TemplateOptions) (db.TemplateDatabase, error) {
+	if hash == "overquotahash" {
+		return db.TemplateDatabase{}, &manager.TemplateQuotaError{Namespace: options.Namespace, Count: 2, Limit: 2, EvictionCandidates: []string{"stubhash"}}
+	}
+
+	if hash == "foreignhash" {
+		return db.TemplateDatabase{}, fmt.Errorf("%w: hash %q isn't shared with namespace %q", manager.ErrTemplateNamespaceConflict, hash, options.Namespace)
+	}
+
+	return db.TemplateDatabase{Database: db.Database{TemplateHash: hash}}, nil
+}
+
+func (s stubManager) BootstrapTemplateDatabase(ctx context.Context, hash string, options pkgtemplates.TemplateOptions) (db.TemplateDatabase, error) {
+	return s.InitializeTemplateDatabaseWithOptions(ctx, hash, options)
+}
+
+func (stubManager) GetTestDatabase(ctx context.Context, hash string) (db.TestDatabase, error) {
+	if hash == "deadlinehash" {
+		if _, ok := manager.DeadlineHint(ctx); ok {
+			return db.TestDatabase{}, fmt.Errorf("%w: gave up waiting", manager.ErrDeadlineExceeded)
+		}
+	}
+
+	if hash != "stubhash" {
+		return db.TestDatabase{}, manager.ErrTemplateNotFound
+	}
+
+	return db.TestDatabase{Database: db.Database{TemplateHash: hash}, ID: 42}, nil
+}
+
+func (s stubManager) GetTestDatabaseWithOptions(ctx context.Context, hash string, options manager.TestDatabaseOptions) (db.TestDatabase, error) {
+	if options.Index != nil && options.SkipClean {
+		return db.TestDatabase{}, manager.ErrInvalidTestDatabaseOptions
+	}
+
+	testDB, err := s.GetTestDatabase(ctx, hash)
+	testDB.Dirty = options.SkipClean
+	if options.Index != nil {
+		testDB.ID = *options.Index
+	}
+
+	return testDB, err
+}
+
+func (stubManager) RenewTestDatabase(_ context.Context, hash string, id int) (pool.Lease, error) {
+	if hash != "stubhash" {
+		return pool.Lease{}, manager.ErrTemplateNotFound
+	}
+
+	switch id {
+	case 1:
+		return pool.Lease{}, fmt.Errorf("%w: test database %d is not checked out", pool.ErrInvalidState, id)
+	case 2:
+		return pool.Lease{}, db.WrapOp(pool.ErrLeaseExpired, "renew_test_db", hash, "integresql_test_stubhash_002")
+	}
+
+	return pool.Lease{ExpiresAt: time.Now().Add(time.Minute)}, nil
+}
+
+func (stubManager) ExplainGetTestDatabase(_ context.Context, hash string, options manager.TestDatabaseOptions) (manager.AcquireExplanation, error) {
+	if hash != "stubhash" {
+		return manager.AcquireExplanation{}, manager.ErrTemplateNotFound
+	}
+
+	if options.Index != nil && options.SkipClean {
+		return manager.AcquireExplanation{}, manager.ErrInvalidTestDatabaseOptions
+	}
+
+	explanation := manager.AcquireExplanation{Hash: hash, TemplateState: "finalized", Decision: pool.DecisionReuseReady}
+	if options.SkipClean {
+		explanation.Decision = pool.DecisionReuseDirty
+	}
+
+	return explanation, nil
+}
+
+func (stubManager) Stats(_ context.Context) (manager.Stats, error) { return manager.Stats{}, nil }
+
+func (stubManager) ListTemplates(_ context.Context) ([]manager.TrackedTemplate, error) {
+	return []manager.TrackedTemplate{
+		{Hash: "inithash", State: "init", Database: "integresql_template_inithash"},
+		{Hash: "stubhash", State: "finalized", Database: "integresql_template_stubhash", Pool: &manager.TemplatePoolSummary{Ready: 3, InUse: 1}},
+	}, nil
+}
+
+func (stubManager) StatsHistory(_ context.Context, since time.Time, step time.Duration) ([]manager.StatsTrendPoint, error) {
+	if step > time.Hour {
+		return nil, manager.ErrStatsHistoryDisabled
+	}
+
+	return []manager.StatsTrendPoint{{Time: since, Samples: 1}, {Time: since.Add(step), Samples: 1}}, nil
+}
+
+func (stubManager) RecentEvents(_ context.Context) []events.Event {
+	return []events.Event{{Message: "first"}, {Message: "second"}, {Message: "third"}}
+}
+
+func (stubManager) MigratePrefixes(_ context.Context, from manager.PrefixScheme, dryRun bool) (manager.PrefixMigrationSummary, error) {
+	if len(from.TestDatabasePrefix) == 0 {
+		return manager.PrefixMigrationSummary{}, fmt.Errorf("%w: empty test database prefix", manager.ErrInvalidPrefixMigration)
+	}
+
+	return manager.PrefixMigrationSummary{From: from, DryRun: dryRun, Results: []manager.PrefixMigrationResult{
+		{Database: "integresql_old_hash", Hash: "hash", Action: manager.PrefixMigrationActionRename, Target: "integresql_template_hash"},
+	}}, nil
+}
+
+func (stubManager) MigrateTemplate(_ context.Context, hash string, host string) (manager.TemplateMigration, error) {
+	if hash != "stubhash" {
+		return manager.TemplateMigration{}, manager.ErrTemplateNotFound
+	}
+
+	if host == "target" {
+		return manager.TemplateMigration{}, fmt.Errorf("%w: already located on %s", manager.ErrInvalidMigration, host)
+	}
+
+	return manager.TemplateMigration{Hash: hash, Host: host + ":5432", State: manager.MigrationStateCopying}, nil
+}
+
+func (stubManager) TemplateMigrationStatus(_ context.Context, hash string) (manager.TemplateMigration, error) {
+	if hash != "stubhash" {
+		return manager.TemplateMigration{}, manager.ErrMigrationNotFound
+	}
+
+	return manager.TemplateMigration{Hash: hash, Host: "new:5432", State: manager.MigrationStateDraining, MoveStats: pool.MoveStats{Remaining: 2, CheckedOut: 1}}, nil
+}
+
+func (stubManager) ResizeTemplatePool(_ context.Context, hash string, initialPoolSize int, maxPoolSize int) (pool.PoolSize, error) {
+	if hash != "stubhash" {
+		return pool.PoolSize{}, manager.ErrTemplateNotFound
+	}
+
+	if maxPoolSize > 8 {
+		return pool.PoolSize{}, fmt.Errorf("%w: max pool size %d exceeds the limit of 8", manager.ErrInvalidTemplateOptions, maxPoolSize)
+	}
+
+	return pool.PoolSize{InitialPoolSize: initialPoolSize, MaxPoolSize: maxPoolSize, MaxPoolSizeLimit: 8, Total: 4}, nil
+}
+
+func (stubManager) FreezeTestDatabase(_ context.Context, hash string, id int) (pool.FrozenTestDatabase, error) {
+	if hash != "stubhash" {
+		return pool.FrozenTestDatabase{}, manager.ErrTemplateNotFound
+	}
+
+	if id == 1 {
+		return pool.FrozenTestDatabase{}, fmt.Errorf("%w: test database 1 is checked out, return it first", pool.ErrInvalidState)
+	}
+
+	return pool.FrozenTestDatabase{ID: id, DBName: fmt.Sprintf("integresql_test_stubhash_%03d", id)}, nil
+}
+
+func (stubManager) UnfreezeTestDatabase(_ context.Context, hash string, id int) error {
+	if hash != "stubhash" {
+		return manager.ErrTemplateNotFound
+	}
+
+	if id > 8 {
+		return manager.ErrTestNotFound
+	}
+
+	return nil
+}
+
+func (stubManager) Capacity(_ context.Context) (manager.Capacity, error) {
+	return manager.Capacity{Templates: 1, TestDatabases: 10, Connections: 20, MaxConnections: 100, Headroom: 0.8, Bottleneck: manager.CapacityConnections}, nil
+}
+
+func (stubManager) Diagnostics(_ context.Context) (manager.Diagnostics, error) {
+	return manager.Diagnostics{}, errors.New("pg_stat unavailable")
+}
+
+func (stubManager) Disconnect(_ context.Context, _ bool) error { return nil }
+
+func (stubManager) DiscardTemplateDatabase(_ context.Context, hash string) error {
+	if hash == "unknown" {
+		return manager.ErrTemplateNotFound
+	}
+
+	return nil
+}
+
+func (stubManager) ResetTrackingWithLabel(_ context.Context, _ string) error { return nil }
+
+func (stubManager) ShutdownReport(_ context.Context) (manager.ShutdownReport, error) {
+	return manager.ShutdownReport{Final: true, Templates: []manager.ShutdownReportDatabase{
+		{Database: "integresql_template_hash", Hash: "hash", State: "finalized", OnRestart: manager.ShutdownReportOnRestartOrphaned},
+	}}, nil
+}
+
+func TestAlternativeManagerImplementation(t *testing.T) {
+	s := api.NewServer(api.DefaultServerConfigFromEnv())
+	s.Manager = stubManager{}
+
+	router.Init(s)
+
+	res := test.PerformRequest(t, s, "GET", "/api/v1/templates/stubhash/tests", nil, nil)
+	require.Equal(t, 200, res.Result().StatusCode)
+
+	var testDB db.TestDatabase
+	require.NoError(t, json.NewDecoder(res.Result().Body).Decode(&testDB))
+	require.Equal(t, 42, testDB.ID)
+	require.Equal(t, "stubhash", testDB.TemplateHash)
+
+	res = test.PerformRequest(t, s, "GET", "/api/v1/templates/unknown/tests", nil, nil)
+	require.Equal(t, 404, res.Result().StatusCode)
+}
+
+func TestDiagnosticsBundle(t *testing.T) {
+	s := api.NewServer(api.DefaultServerConfigFromEnv())
+	s.Manager = stubManager{}
+
+	router.Init(s)
+
+	res := test.PerformRequest(t, s, "GET", "/api/v1/admin/diagnostics", nil, nil)
+	require.Equal(t, 200, res.Result().StatusCode)
+	require.Equal(t, "application/gzip", res.Result().Header.Get("Content-Type"))
+
+	gz, err := gzip.NewReader(res.Result().Body)
+	require.NoError(t, err)
+
+	files := map[string][]byte{}
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		require.NoError(t, err)
+
+		content, err := io.ReadAll(tr)
+		require.NoError(t, err)
+		files[header.Name] = content
+	}
+
+	for _, name := range []string{"stats.json", "events.json", "manager.json", "server_config.json", "goroutines.txt"} {
+		require.Contains(t, files, name)
+	}
+
+	require.Contains(t, string(files["goroutines.txt"]), "goroutine")
+
+	// failing parts are reported, but don't fail the bundle
+	require.Contains(t, string(files["errors.txt"]), "pg_stat unavailable")
+}
+
+func TestEventsPagination(t *testing.T) {
+	s := api.NewServer(api.DefaultServerConfigFromEnv())
+	s.Manager = stubManager{}
+
+	router.Init(s)
+
+	res := test.PerformRequestWithParams(t, s, "GET", "/api/v1/admin/events", nil, nil, map[string]string{"offset": "1", "limit": "1"})
+	require.Equal(t, 200, res.Result().StatusCode)
+	require.Equal(t, "3", res.Result().Header.Get("X-Total-Count"))
+
+	var evts []events.Event
+	require.NoError(t, json.NewDecoder(res.Result().Body).Decode(&evts))
+	require.Len(t, evts, 1)
+	require.Equal(t, "second", evts[0].Message)
+
+	res = test.PerformRequestWithParams(t, s, "GET", "/api/v1/admin/events", nil, nil, map[string]string{"offset": "5"})
+	require.Equal(t, 200, res.Result().StatusCode)
+	require.NoError(t, json.NewDecoder(res.Result().Body).Decode(&evts))
+	require.Empty(t, evts)
+
+	res = test.PerformRequestWithParams(t, s, "GET", "/api/v1/admin/events", nil, nil, map[string]string{"limit": "-1"})
+	require.Equal(t, 400, res.Result().StatusCode)
+}
+
+func TestGzipCompression(t *testing.T) {
+	config := api.DefaultServerConfigFromEnv()
+	config.Echo.EnableGzipMiddleware = true
+	config.Echo.GzipMinLength = 0
+
+	s := api.NewServer(config)
+	s.Manager = stubManager{}
+
+	router.Init(s)
+
+	res := test.PerformRequest(t, s, "GET", "/api/v1/admin/events", nil, http.Header{"Accept-Encoding": []string{"gzip"}})
+	require.Equal(t, 200, res.Result().StatusCode)
+	require.Equal(t, "gzip", res.Result().Header.Get("Content-Encoding"))
+
+	gz, err := gzip.NewReader(res.Result().Body)
+	require.NoError(t, err)
+
+	var evts []events.Event
+	require.NoError(t, json.NewDecoder(gz).Decode(&evts))
+	require.Len(t, evts, 3)
+
+	// uncompressed without the Accept-Encoding header
+	res = test.PerformRequest(t, s, "GET", "/api/v1/admin/events", nil, nil)
+	require.Equal(t, 200, res.Result().StatusCode)
+	require.Empty(t, res.Result().Header.Get("Content-Encoding"))
+}
+
+func TestDeadlineHint(t *testing.T) {
+	s := api.NewServer(api.DefaultServerConfigFromEnv())
+	s.Manager = stubManager{}
+
+	router.Init(s)
+
+	// without hint
+	res := test.PerformRequest(t, s, "GET", "/api/v1/templates/deadlinehash/tests", nil, nil)
+	require.Equal(t, 404, res.Result().StatusCode)
+
+	headers := http.Header{}
+	headers.Set(middleware.HeaderDeadlineHint, "100")
+	res = test.PerformRequest(t, s, "GET", "/api/v1/templates/deadlinehash/tests", nil, headers)
+	require.Equal(t, 408, res.Result().StatusCode)
+	require.Contains(t, res.Body.String(), manager.ErrDeadlineExceeded.Error())
+
+	headers.Set(middleware.HeaderDeadlineHint, "soon")
+	res = test.PerformRequest(t, s, "GET", "/api/v1/templates/deadlinehash/tests", nil, headers)
+	require.Equal(t, 400, res.Result().StatusCode)
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	mx, err := metrics.New(metrics.Config{Backend: metrics.BackendPrometheus, Prefix: "integresql"})
+	require.NoError(t, err)
+
+	s := api.NewServer(api.DefaultServerConfigFromEnv())
+	s.Metrics = mx
+	s.Manager = manager.Instrument(stubManager{}, mx)
+
+	router.Init(s)
+
+	res := test.PerformRequest(t, s, "GET", "/api/v1/templates/stubhash/tests", nil, nil)
+	require.Equal(t, 200, res.Result().StatusCode)
+
+	res = test.PerformRequest(t, s, "GET", "/api/v1/templates/unknown/tests", nil, nil)
+	require.Equal(t, 404, res.Result().StatusCode)
+
+	res = test.PerformRequest(t, s, "GET", "/metrics", nil, nil)
+	require.Equal(t, 200, res.Result().StatusCode)
+	require.Contains(t, res.Body.String(), `integresql_test_database_operations_total{operation="get",result="success"} 1`)
+	require.Contains(t, res.Body.String(), `integresql_test_database_operations_total{operation="get",result="not_found"} 1`)
+
+	// push based backends (and disabled metrics) have no scrape endpoint
+	s = api.NewServer(api.DefaultServerConfigFromEnv())
+	s.Metrics = metrics.Noop()
+	s.Manager = stubManager{}
+
+	router.Init(s)
+
+	res = test.PerformRequest(t, s, "GET", "/metrics", nil, nil)
+	require.Equal(t, 404, res.Result().StatusCode)
+}
+
+func TestMigratePrefixes(t *testing.T) {
+	config := api.DefaultServerConfigFromEnv()
+
+	// httptest requests originate from 192.0.2.1
+	config.DestructiveEndpointsAllowlist = []string{"127.0.0.1"}
+
+	s := api.NewServer(config)
+	s.Manager = stubManager{}
+
+	router.Init(s)
+
+	payload := map[string]interface{}{"from": manager.PrefixScheme{DatabasePrefix: "integresql", TemplateDatabasePrefix: "old", TestDatabasePrefix: "oldtest"}, "dryRun": true}
+
+	res := test.PerformRequest(t, s, "POST", "/api/v1/admin/migrate-prefixes", payload, nil)
+	require.Equal(t, 403, res.Result().StatusCode)
+
+	config.DestructiveEndpointsAllowlist = nil
+	s = api.NewServer(config)
+	s.Manager = stubManager{}
+
+	router.Init(s)
+
+	res = test.PerformRequest(t, s, "POST", "/api/v1/admin/migrate-prefixes", payload, nil)
+	require.Equal(t, 200, res.Result().StatusCode)
+
+	var summary manager.PrefixMigrationSummary
+	require.NoError(t, json.NewDecoder(res.Result().Body).Decode(&summary))
+	require.True(t, summary.DryRun)
+	require.Equal(t, "old", summary.From.TemplateDatabasePrefix)
+	require.Len(t, summary.Results, 1)
+	require.Equal(t, manager.PrefixMigrationActionRename, summary.Results[0].Action)
+
+	res = test.PerformRequest(t, s, "POST", "/api/v1/admin/migrate-prefixes", map[string]interface{}{"from": manager.PrefixScheme{}}, nil)
+	require.Equal(t, 400, res.Result().StatusCode)
+}
+
+func TestTemplateMigration(t *testing.T) {
+	config := api.DefaultServerConfigFromEnv()
+
+	// httptest requests originate from 192.0.2.1
+	config.DestructiveEndpointsAllowlist = []string{"127.0.0.1"}
+
+	s := api.NewServer(config)
+	s.Manager = stubManager{}
+
+	router.Init(s)
+
+	res := test.PerformRequest(t, s, "POST", "/api/v1/admin/templates/stubhash/migration", test.GenericPayload{"host": "new"}, nil)
+	require.Equal(t, 403, res.Result().StatusCode)
+
+	// the status is not destructive
+	res = test.PerformRequest(t, s, "GET", "/api/v1/admin/templates/stubhash/migration", nil, nil)
+	require.Equal(t, 200, res.Result().StatusCode)
+
+	var migration manager.TemplateMigration
+	require.NoError(t, json.NewDecoder(res.Result().Body).Decode(&migration))
+	require.Equal(t, manager.MigrationStateDraining, migration.State)
+	require.Equal(t, 2, migration.Remaining)
+	require.Equal(t, 1, migration.CheckedOut)
+
+	res = test.PerformRequest(t, s, "GET", "/api/v1/admin/templates/unknown/migration", nil, nil)
+	require.Equal(t, 404, res.Result().StatusCode)
+
+	config.DestructiveEndpointsAllowlist = nil
+	s = api.NewServer(config)
+	s.Manager = stubManager{}
+
+	router.Init(s)
+
+	res = test.PerformRequest(t, s, "POST", "/api/v1/admin/templates/stubhash/migration", test.GenericPayload{"host": "new"}, nil)
+	require.Equal(t, 202, res.Result().StatusCode)
+
+	require.NoError(t, json.NewDecoder(res.Result().Body).Decode(&migration))
+	require.Equal(t, manager.MigrationStateCopying, migration.State)
+	require.Equal(t, "new:5432", migration.Host)
+
+	res = test.PerformRequest(t, s, "POST", "/api/v1/admin/templates/stubhash/migration", test.GenericPayload{}, nil)
+	require.Equal(t, 400, res.Result().StatusCode)
+
+	res = test.PerformRequest(t, s, "POST", "/api/v1/admin/templates/stubhash/migration", test.GenericPayload{"host": "target"}, nil)
+	require.Equal(t, 400, res.Result().StatusCode)
+
+	res = test.PerformRequest(t, s, "POST", "/api/v1/admin/templates/unknown/migration", test.GenericPayload{"host": "new"}, nil)
+	require.Equal(t, 404, res.Result().StatusCode)
+}
+
+func TestResizeTemplatePool(t *testing.T) {
+	config := api.DefaultServerConfigFromEnv()
+
+	// httptest requests originate from 192.0.2.1
+	config.DestructiveEndpointsAllowlist = []string{"127.0.0.1"}
+
+	s := api.NewServer(config)
+	s.Manager = stubManager{}
+
+	router.Init(s)
+
+	res := test.PerformRequest(t, s, "PUT", "/api/v1/admin/templates/stubhash/pool", test.GenericPayload{"maxPoolSize": 6}, nil)
+	require.Equal(t, 403, res.Result().StatusCode)
+
+	config.DestructiveEndpointsAllowlist = nil
+	s = api.NewServer(config)
+	s.Manager = stubManager{}
+
+	router.Init(s)
+
+	res = test.PerformRequest(t, s, "PUT", "/api/v1/admin/templates/stubhash/pool", test.GenericPayload{"initialPoolSize": 2, "maxPoolSize": 6}, nil)
+	require.Equal(t, 200, res.Result().StatusCode)
+
+	var size pool.PoolSize
+	require.NoError(t, json.NewDecoder(res.Result().Body).Decode(&size))
+	require.Equal(t, 2, size.InitialPoolSize)
+	require.Equal(t, 6, size.MaxPoolSize)
+	require.Equal(t, 8, size.MaxPoolSizeLimit)
+
+	res = test.PerformRequest(t, s, "PUT", "/api/v1/admin/templates/stubhash/pool", test.GenericPayload{}, nil)
+	require.Equal(t, 400, res.Result().StatusCode)
+
+	res = test.PerformRequest(t, s, "PUT", "/api/v1/admin/templates/stubhash/pool", test.GenericPayload{"maxPoolSize": 16}, nil)
+	require.Equal(t, 400, res.Result().StatusCode)
+
+	res = test.PerformRequest(t, s, "PUT", "/api/v1/admin/templates/unknown/pool", test.GenericPayload{"maxPoolSize": 6}, nil)
+	require.Equal(t, 404, res.Result().StatusCode)
+}
+
+func TestSkipClean(t *testing.T) {
+	s := api.NewServer(api.DefaultServerConfigFromEnv())
+	s.Manager = stubManager{}
+
+	router.Init(s)
+
+	for param, dirty := range map[string]bool{"true": true, "false": false, "": false} {
+		res := test.PerformRequestWithParams(t, s, "GET", "/api/v1/templates/stubhash/tests", nil, nil, map[string]string{"skipClean": param})
+		require.Equal(t, 200, res.Result().StatusCode)
+
+		var testDB db.TestDatabase
+		require.NoError(t, json.NewDecoder(res.Result().Body).Decode(&testDB))
+		require.Equal(t, dirty, testDB.Dirty, param)
+	}
+
+	res := test.PerformRequestWithParams(t, s, "GET", "/api/v1/templates/stubhash/tests", nil, nil, map[string]string{"skipClean": "maybe"})
+	require.Equal(t, 400, res.Result().StatusCode)
+}
+
+func TestGetTestDatabaseAtIndex(t *testing.T) {
+	s := api.NewServer(api.DefaultServerConfigFromEnv())
+	s.Manager = stubManager{}
+
+	router.Init(s)
+
+	res := test.PerformRequestWithParams(t, s, "GET", "/api/v1/templates/stubhash/tests", nil, nil, map[string]string{"index": "3"})
+	require.Equal(t, 200, res.Result().StatusCode)
+
+	var testDB db.TestDatabase
+	require.NoError(t, json.NewDecoder(res.Result().Body).Decode(&testDB))
+	require.Equal(t, 3, testDB.ID)
+
+	for _, params := range []map[string]string{{"index": "-1"}, {"index": "first"}, {"index": "0", "skipClean": "true"}} {
+		res := test.PerformRequestWithParams(t, s, "GET", "/api/v1/templates/stubhash/tests", nil, nil, params)
+		require.Equal(t, 400, res.Result().StatusCode, params)
+	}
+}
+
+func TestRenewTestDatabase(t *testing.T) {
+	s := api.NewServer(api.DefaultServerConfigFromEnv())
+	s.Manager = stubManager{}
+
+	router.Init(s)
+
+	res := test.PerformRequest(t, s, "POST", "/api/v1/templates/stubhash/tests/42/renew", nil, nil)
+	require.Equal(t, 200, res.Result().StatusCode)
+
+	var lease struct {
+		ExpiresAt    *time.Time `json:"expiresAt"`
+		MaxExpiresAt *time.Time `json:"maxExpiresAt"`
+	}
+	require.NoError(t, json.NewDecoder(res.Result().Body).Decode(&lease))
+	require.NotNil(t, lease.ExpiresAt)
+	require.True(t, lease.ExpiresAt.After(time.Now()))
+	require.Nil(t, lease.MaxExpiresAt)
+
+	for path, status := range map[string]int{
+		"/api/v1/templates/stubhash/tests/1/renew":    409,
+		"/api/v1/templates/stubhash/tests/2/renew":    410,
+		"/api/v1/templates/stubhash/tests/x/renew":    400,
+		"/api/v1/templates/unknownhash/tests/0/renew": 404,
+	} {
+		res := test.PerformRequest(t, s, "POST", path, nil, nil)
+		require.Equal(t, status, res.Result().StatusCode, path)
+	}
+}
+
+func TestErrorResponse(t *testing.T) {
+	s := api.NewServer(api.DefaultServerConfigFromEnv())
+	s.Manager = stubManager{}
+
+	router.Init(s)
+
+	res := test.PerformRequest(t, s, "POST", "/api/v1/templates/stubhash/tests/2/renew", nil, nil)
+	require.Equal(t, 410, res.Result().StatusCode)
+
+	var response api.ErrorResponse
+	require.NoError(t, json.NewDecoder(res.Result().Body).Decode(&response))
+	require.Equal(t, "lease_expired", response.Code)
+	require.Equal(t, "renew_test_db", response.Op)
+	require.Equal(t, "stubhash", response.Hash)
+	require.Equal(t, "integresql_test_stubhash_002", response.DBName)
+	require.Contains(t, response.Message, pool.ErrLeaseExpired.Error())
+
+	// typed errors without context only carry their code
+	res = test.PerformRequest(t, s, "POST", "/api/v1/templates/unknownhash/tests/0/renew", nil, nil)
+	require.Equal(t, 404, res.Result().StatusCode)
+
+	response = api.ErrorResponse{}
+	require.NoError(t, json.NewDecoder(res.Result().Body).Decode(&response))
+	require.Equal(t, "template_not_found", response.Code)
+	require.Empty(t, response.Op)
+}
+
+func TestExplainGetTestDatabase(t *testing.T) {
+	s := api.NewServer(api.DefaultServerConfigFromEnv())
+	s.Manager = stubManager{}
+
+	router.Init(s)
+
+	// GetTestDatabaseWithOptions is never called, the stub would hand out a test database otherwise
+	for path, decision := range map[string]pool.Decision{
+		"/api/v1/templates/stubhash/tests?dryRun=true":                pool.DecisionReuseReady,
+		"/api/v1/templates/stubhash/tests?dryRun=true&skipClean=true": pool.DecisionReuseDirty,
+	} {
+		res := test.PerformRequest(t, s, "GET", path, nil, nil)
+		require.Equal(t, 200, res.Result().StatusCode, path)
+
+		var explanation manager.AcquireExplanation
+		require.NoError(t, json.NewDecoder(res.Result().Body).Decode(&explanation))
+		require.Equal(t, decision, explanation.Decision, path)
+		require.Equal(t, "finalized", explanation.TemplateState, path)
+	}
+
+	for path, status := range map[string]int{
+		"/api/v1/templates/stubhash/tests?dryRun=maybe":                       400,
+		"/api/v1/templates/stubhash/tests?dryRun=true&skipClean=true&index=1": 400,
+		"/api/v1/templates/unknownhash/tests?dryRun=true":                     404,
+	} {
+		res := test.PerformRequest(t, s, "GET", path, nil, nil)
+		require.Equal(t, status, res.Result().StatusCode, path)
+	}
+}
+
+func TestCapacity(t *testing.T) {
+	s := api.NewServer(api.DefaultServerConfigFromEnv())
+	s.Manager = stubManager{}
+
+	router.Init(s)
+
+	res := test.PerformRequest(t, s, "GET", "/api/v1/admin/capacity", nil, nil)
+	require.Equal(t, 200, res.Result().StatusCode)
+
+	var capacity manager.Capacity
+	require.NoError(t, json.NewDecoder(res.Result().Body).Decode(&capacity))
+	require.Equal(t, 10, capacity.TestDatabases)
+	require.Equal(t, manager.CapacityConnections, capacity.Bottleneck)
+	require.InDelta(t, 0.8, capacity.Headroom, 0.001)
+}
+
+func TestShutdownReport(t *testing.T) {
+	config := api.DefaultServerConfigFromEnv()
+	config.ShutdownReportRetention = 50 * time.Millisecond
+
+	s := api.NewServer(config)
+	s.Manager = stubManager{}
+
+	router.Init(s)
+
+	res := test.PerformRequest(t, s, "GET", "/api/v1/admin/shutdown-report", nil, nil)
+	require.Equal(t, 200, res.Result().StatusCode)
+
+	var report manager.ShutdownReport
+	require.NoError(t, json.NewDecoder(res.Result().Body).Decode(&report))
+	require.True(t, report.Final)
+	require.Len(t, report.Templates, 1)
+	require.False(t, report.Templates[0].Readopted)
+	require.Equal(t, manager.ShutdownReportOnRestartOrphaned, report.Templates[0].OnRestart)
+
+	// the report stays retrievable for a while after disconnecting the manager
+	start := time.Now()
+	require.NoError(t, s.Shutdown(context.Background()))
+	require.GreaterOrEqual(t, time.Since(start), config.ShutdownReportRetention)
+}
+
+func TestSeparateAdminListener(t *testing.T) {
+	mx, err := metrics.New(metrics.Config{Backend: metrics.BackendPrometheus, Prefix: "integresql"})
+	require.NoError(t, err)
+
+	config := api.DefaultServerConfigFromEnv()
+	config.AdminPort = 5001
+	config.DebugEndpoints = true
+
+	s := api.NewServer(config)
+	s.Metrics = mx
+	s.Manager = stubManager{}
+
+	router.Init(s)
+	require.NotNil(t, s.AdminEcho)
+
+	// consumer routes only on the main listener
+	res := test.PerformRequest(t, s, "GET", "/api/v1/templates/stubhash/tests", nil, nil)
+	require.Equal(t, 200, res.Result().StatusCode)
+
+	res = test.PerformAdminRequest(t, s, "GET", "/api/v1/templates/stubhash/tests", nil, nil)
+	require.Equal(t, 404, res.Result().StatusCode)
+
+	// admin routes, metrics and debug endpoints only on the admin listener
+	for _, path := range []string{"/api/v1/admin/stats", "/api/v1/admin/shutdown-report", "/metrics", "/debug/pprof/heap"} {
+		res = test.PerformRequest(t, s, "GET", path, nil, nil)
+		require.Equal(t, 404, res.Result().StatusCode, path)
+
+		res = test.PerformAdminRequest(t, s, "GET", path, nil, nil)
+		require.Equal(t, 200, res.Result().StatusCode, path)
+	}
+
+	// a single listener serves everything by default
+	s = api.NewServer(api.DefaultServerConfigFromEnv())
+	s.Manager = stubManager{}
+
+	router.Init(s)
+	require.Nil(t, s.AdminEcho)
+
+	res = test.PerformAdminRequest(t, s, "GET", "/api/v1/templates/stubhash/tests", nil, nil)
+	require.Equal(t, 200, res.Result().StatusCode)
+
+	res = test.PerformRequest(t, s, "GET", "/api/v1/admin/stats", nil, nil)
+	require.Equal(t, 200, res.Result().StatusCode)
+}
+
+func TestInterceptors(t *testing.T) {
+	config := api.DefaultServerConfigFromEnv()
+	config.DestructiveEndpointsAllowlist = []string{"127.0.0.1"} // httptest requests originate from 192.0.2.1
+
+	s := api.NewServer(config)
+	s.Manager = stubManager{}
+
+	calls := []string{}
+	record := func(name string) echo.MiddlewareFunc {
+		return func(next echo.HandlerFunc) echo.HandlerFunc {
+			return func(c echo.Context) error {
+				calls = append(calls, name+" "+c.Path())
+				return next(c)
+			}
+		}
+	}
+
+	s.Interceptors = []api.Interceptor{
+		{Name: "audit", Middleware: record("audit"), DestructiveOnly: true, Before: api.InterceptorIPAllowlist},
+		{Name: "quota", Middleware: record("quota"), Group: api.RouteGroupTemplates},
+	}
+
+	router.Init(s)
+	require.Equal(t, []string{"audit", api.InterceptorIPAllowlist, "quota"}, s.Chain.Names())
+
+	// audited before being denied
+	res := test.PerformRequest(t, s, "DELETE", "/api/v1/templates/stubhash", nil, nil)
+	require.Equal(t, 403, res.Result().StatusCode)
+
+	res = test.PerformRequest(t, s, "GET", "/api/v1/templates/stubhash/tests", nil, nil)
+	require.Equal(t, 200, res.Result().StatusCode)
+
+	res = test.PerformRequest(t, s, "GET", "/api/v1/admin/stats", nil, nil)
+	require.Equal(t, 200, res.Result().StatusCode)
+
+	require.Equal(t, []string{"audit /api/v1/templates/:hash", "quota /api/v1/templates/:hash/tests"}, calls)
+
+	_, err := api.BuildInterceptorChain(nil, []api.Interceptor{{Name: "audit", Middleware: record("audit"), Before: "unknown"}})
+	require.ErrorIs(t, err, api.ErrInvalidInterceptor)
+	_, err = api.BuildInterceptorChain(s.Chain, []api.Interceptor{{Name: "quota", Middleware: record("quota")}})
+	require.ErrorIs(t, err, api.ErrInvalidInterceptor)
+	_, err = api.BuildInterceptorChain(nil, []api.Interceptor{{Name: "noop"}})
+	require.ErrorIs(t, err, api.ErrInvalidInterceptor)
+}
+
+func TestAuditStore(t *testing.T) {
+	config := api.DefaultServerConfigFromEnv()
+	config.AuditFile = filepath.Join(t.TempDir(), "audit.jsonl")
+
+	s := api.NewServer(config)
+	s.Manager = stubManager{}
+
+	router.Init(s)
+	require.Equal(t, []string{api.InterceptorAuditLog, api.InterceptorIPAllowlist}, s.Chain.Names())
+
+	res := test.PerformRequest(t, s, "DELETE", "/api/v1/templates/stubhash", nil, test.HeadersWithAuth(t, "secret"))
+	require.Equal(t, 204, res.Result().StatusCode)
+
+	res = test.PerformRequest(t, s, "DELETE", "/api/v1/templates/unknown", nil, nil)
+	require.Equal(t, 404, res.Result().StatusCode)
+
+	res = test.PerformRequest(t, s, "DELETE", "/api/v1/admin/templates?label=pr-1234", nil, nil)
+	require.Equal(t, 204, res.Result().StatusCode)
+
+	// not audited
+	res = test.PerformRequest(t, s, "GET", "/api/v1/templates/stubhash/tests", nil, nil)
+	require.Equal(t, 200, res.Result().StatusCode)
+
+	res = test.PerformRequest(t, s, "GET", "/api/v1/admin/audit", nil, nil)
+	require.Equal(t, 200, res.Result().StatusCode)
+	require.Equal(t, "3", res.Result().Header.Get("X-Total-Count"))
+
+	var entries []audit.Entry
+	require.NoError(t, json.NewDecoder(res.Result().Body).Decode(&entries))
+	require.Len(t, entries, 3)
+	require.Equal(t, audit.ActionDiscardTemplate, entries[0].Action)
+	require.Equal(t, "stubhash", entries[0].Hash)
+	require.Equal(t, 204, entries[0].Status)
+	require.Equal(t, audit.TokenFingerprint("Bearer secret"), entries[0].Actor.Token)
+	require.Equal(t, "192.0.2.1", entries[0].Actor.RemoteIP)
+	require.Equal(t, 404, entries[1].Status)
+	require.Equal(t, audit.ActionResetAllTemplates, entries[2].Action)
+	require.Equal(t, map[string]string{"label": "pr-1234"}, entries[2].Params)
+
+	res = test.PerformRequest(t, s, "GET", "/api/v1/admin/audit?hash=unknown", nil, nil)
+	require.Equal(t, 200, res.Result().StatusCode)
+	require.Equal(t, "1", res.Result().Header.Get("X-Total-Count"))
+
+	res = test.PerformRequest(t, s, "GET", "/api/v1/admin/audit?since=yesterday", nil, nil)
+	require.Equal(t, 400, res.Result().StatusCode)
+
+	// entries survive a restart
+	require.NoError(t, s.Shutdown(context.Background()))
+
+	s = api.NewServer(config)
+	s.Manager = stubManager{}
+
+	router.Init(s)
+
+	res = test.PerformRequest(t, s, "GET", "/api/v1/admin/audit?action=discard_template&token="+audit.TokenFingerprint("Bearer secret"), nil, nil)
+	require.Equal(t, 200, res.Result().StatusCode)
+	require.Equal(t, "1", res.Result().Header.Get("X-Total-Count"))
+	require.NoError(t, s.Audit.Close())
+
+	// disabled by default
+	s = api.NewServer(api.DefaultServerConfigFromEnv())
+	s.Manager = stubManager{}
+
+	router.Init(s)
+
+	res = test.PerformRequest(t, s, "GET", "/api/v1/admin/audit", nil, nil)
+	require.Equal(t, 404, res.Result().StatusCode)
+}
+
+func TestTemplateQuota(t *testing.T) {
+	s := api.NewServer(api.DefaultServerConfigFromEnv())
+	s.Manager = stubManager{}
+
+	router.Init(s)
+
+	res := test.PerformRequest(t, s, "POST", "/api/v1/templates", test.GenericPayload{"hash": "overquotahash"}, test.HeadersWithAuth(t, "secret"))
+	require.Equal(t, 429, res.Result().StatusCode)
+
+	var body struct {
+		Message            string   `json:"message"`
+		Namespace          string   `json:"namespace"`
+		Count              int      `json:"count"`
+		Limit              int      `json:"limit"`
+		EvictionCandidates []string `json:"evictionCandidates"`
+	}
+	test.ParseResponseBody(t, res, &body)
+	require.Contains(t, body.Message, manager.ErrTemplateQuotaExceeded.Error())
+	require.Equal(t, audit.TokenFingerprint("Bearer secret"), body.Namespace)
+	require.Equal(t, 2, body.Count)
+	require.Equal(t, 2, body.Limit)
+	require.Equal(t, []string{"stubhash"}, body.EvictionCandidates)
+
+	// an explicit namespace takes precedence over the token without authentication (see TestTemplateQuotaNamespaceOverride)
+	res = test.PerformRequest(t, s, "POST", "/api/v1/templates", test.GenericPayload{"hash": "overquotahash", "namespace": "team-a"}, test.HeadersWithAuth(t, "secret"))
+	require.Equal(t, 429, res.Result().StatusCode)
+	test.ParseResponseBody(t, res, &body)
+	require.Equal(t, "team-a", body.Namespace)
+
+	res = test.PerformRequest(t, s, "POST", "/api/v1/templates", test.GenericPayload{"hash": "stubhash"}, nil)
+	require.Equal(t, 200, res.Result().StatusCode)
+}
+
+func TestTemplateQuotaNamespaceOverride(t *testing.T) {
+	config := api.DefaultServerConfigFromEnv()
+	config.AdminTokens = []string{"admin-token"}
+	config.RunnerTokens = []string{"runner-token"}
+
+	s := api.NewServer(config)
+	s.Manager = stubManager{}
+
+	router.Init(s)
+
+	var body struct {
+		Namespace string `json:"namespace"`
+	}
+
+	// runners can't escape their quota by picking another namespace
+	res := test.PerformRequest(t, s, "POST", "/api/v1/templates", test.GenericPayload{"hash": "overquotahash", "namespace": "team-a"}, test.HeadersWithAuth(t, "runner-token"))
+	require.Equal(t, 403, res.Result().StatusCode)
+
+	res = test.PerformRequest(t, s, "POST", "/api/v1/templates/bootstrap", test.GenericPayload{"hash": "overquotahash", "namespace": "team-b"}, test.HeadersWithAuth(t, "runner-token"))
+	require.Equal(t, 403, res.Result().StatusCode)
+
+	res = test.PerformRequest(t, s, "POST", "/api/v1/templates", test.GenericPayload{"hash": "overquotahash", "namespace": audit.TokenFingerprint("Bearer runner-token")}, test.HeadersWithAuth(t, "runner-token"))
+	require.Equal(t, 429, res.Result().StatusCode)
+	test.ParseResponseBody(t, res, &body)
+	require.Equal(t, audit.TokenFingerprint("Bearer runner-token"), body.Namespace)
+
+	res = test.PerformRequest(t, s, "POST", "/api/v1/templates", test.GenericPayload{"hash": "overquotahash"}, test.HeadersWithAuth(t, "runner-token"))
+	require.Equal(t, 429, res.Result().StatusCode)
+	test.ParseResponseBody(t, res, &body)
+	require.Equal(t, audit.TokenFingerprint("Bearer runner-token"), body.Namespace)
+
+	// admins may account templates to any namespace
+	res = test.PerformRequest(t, s, "POST", "/api/v1/templates", test.GenericPayload{"hash": "overquotahash", "namespace": "team-a"}, test.HeadersWithAuth(t, "admin-token"))
+	require.Equal(t, 429, res.Result().StatusCode)
+	test.ParseResponseBody(t, res, &body)
+	require.Equal(t, "team-a", body.Namespace)
+}
+
+func TestTemplateNamespaceConflict(t *testing.T) {
+	s := api.NewServer(api.DefaultServerConfigFromEnv())
+	s.Manager = stubManager{}
+
+	router.Init(s)
+
+	var body api.ErrorResponse
+
+	for _, path := range []string{"/api/v1/templates", "/api/v1/templates/bootstrap"} {
+		res := test.PerformRequest(t, s, "POST", path, test.GenericPayload{"hash": "foreignhash"}, nil)
+		require.Equal(t, 409, res.Result().StatusCode)
+		test.ParseResponseBody(t, res, &body)
+		require.Equal(t, "template_namespace_conflict", body.Code)
+	}
+}
+
+func TestStatsHistory(t *testing.T) {
+	s := api.NewServer(api.DefaultServerConfigFromEnv())
+	s.Manager = stubManager{}
+
+	router.Init(s)
+
+	res := test.PerformRequest(t, s, "GET", "/api/v1/admin/stats/history?since=2024-05-01T14:00:00Z&step=5m", nil, nil)
+	require.Equal(t, 200, res.Result().StatusCode)
+	require.Equal(t, "2", res.Result().Header.Get("X-Total-Count"))
+
+	var points []manager.StatsTrendPoint
+	test.ParseResponseBody(t, res, &points)
+	require.Len(t, points, 2)
+	require.Equal(t, time.Date(2024, 5, 1, 14, 5, 0, 0, time.UTC), points[1].Time.UTC())
+
+	res = test.PerformRequest(t, s, "GET", "/api/v1/admin/stats/history?step=often", nil, nil)
+	require.Equal(t, 400, res.Result().StatusCode)
+
+	res = test.PerformRequest(t, s, "GET", "/api/v1/admin/stats/history?since=yesterday", nil, nil)
+	require.Equal(t, 400, res.Result().StatusCode)
+
+	res = test.PerformRequest(t, s, "GET", "/api/v1/admin/stats/history?step=2h", nil, nil)
+	require.Equal(t, 404, res.Result().StatusCode)
+}
+
+func TestTokenAuth(t *testing.T) {
+	config := api.DefaultServerConfigFromEnv()
+	config.AdminTokens = []string{"admin-token"}
+	config.RunnerTokens = []string{"runner-token"}
+
+	s := api.NewServer(config)
+	s.Manager = stubManager{}
+
+	router.Init(s)
+
+	res := test.PerformRequest(t, s, "GET", "/api/v1/templates/stubhash/tests", nil, nil)
+	require.Equal(t, 401, res.Result().StatusCode)
+
+	res = test.PerformRequest(t, s, "GET", "/api/v1/templates/stubhash/tests", nil, test.HeadersWithAuth(t, "runner-token"))
+	require.Equal(t, 200, res.Result().StatusCode)
+
+	// runner tokens are not granted the admin routes, admin tokens all routes
+	res = test.PerformRequest(t, s, "GET", "/api/v1/admin/events", nil, test.HeadersWithAuth(t, "runner-token"))
+	require.Equal(t, 403, res.Result().StatusCode)
+
+	res = test.PerformRequest(t, s, "GET", "/api/v1/admin/events", nil, test.HeadersWithAuth(t, "admin-token"))
+	require.Equal(t, 200, res.Result().StatusCode)
+
+	res = test.PerformRequest(t, s, "GET", "/api/v1/info", nil, test.HeadersWithAuth(t, "admin-token"))
+	require.Equal(t, 200, res.Result().StatusCode)
+}
+
+func TestTLS(t *testing.T) {
+	certFile, keyFile := writeSelfSignedCert(t)
+
+	config := api.DefaultServerConfigFromEnv()
+	config.Address = "127.0.0.1"
+	config.Port = 0
+	config.TLSCertFile = certFile
+
+	_, err := api.LoadTLSConfig(config)
+	require.ErrorIs(t, err, api.ErrTLSIncomplete)
+
+	config.TLSKeyFile = keyFile
+
+	s := api.NewServer(config)
+	s.Manager = stubManager{}
+
+	router.Init(s)
+	require.NotNil(t, s.TLS)
+
+	go func() {
+		_ = s.Start()
+	}()
+	t.Cleanup(func() {
+		_ = s.Echo.Shutdown(context.Background())
+	})
+
+	require.Eventually(t, func() bool { return s.Echo.TLSListenerAddr() != nil }, 5*time.Second, 10*time.Millisecond)
+	url := fmt.Sprintf("https://%s/api/v1/info", s.Echo.TLSListenerAddr())
+
+	httpClient, err := client.NewHTTPClient(certFile)
+	require.NoError(t, err)
+
+	res, err := httpClient.Get(url)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	require.NotNil(t, res.TLS)
+
+	// the configured timeouts apply to the TLS listener as well
+	require.Equal(t, config.Echo.ReadHeaderTimeout, s.Echo.Server.ReadHeaderTimeout)
+}
+
+// writeSelfSignedCert writes a self-signed certificate for 127.0.0.1 and its key (PEM) to temporary files.
+func writeSelfSignedCert(t *testing.T) (certFile string, keyFile string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "integresql"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	cert, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	keyBytes, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	certFile, keyFile = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert}), 0600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyBytes}), 0600))
+
+	return certFile, keyFile
+}
+
+func TestFreezeTestDatabase(t *testing.T) {
+	config := api.DefaultServerConfigFromEnv()
+	config.DestructiveEndpointsAllowlist = nil
+
+	s := api.NewServer(config)
+	s.Manager = stubManager{}
+
+	router.Init(s)
+
+	res := test.PerformRequest(t, s, "POST", "/api/v1/admin/templates/stubhash/tests/2/freeze", nil, nil)
+	require.Equal(t, 200, res.Result().StatusCode)
+
+	var frozen pool.FrozenTestDatabase
+	require.NoError(t, json.NewDecoder(res.Result().Body).Decode(&frozen))
+	require.Equal(t, 2, frozen.ID)
+	require.Equal(t, "integresql_test_stubhash_002", frozen.DBName)
+
+	res = test.PerformRequest(t, s, "POST", "/api/v1/admin/templates/stubhash/tests/1/freeze", nil, nil)
+	require.Equal(t, 409, res.Result().StatusCode)
+
+	res = test.PerformRequest(t, s, "POST", "/api/v1/admin/templates/stubhash/tests/abc/freeze", nil, nil)
+	require.Equal(t, 400, res.Result().StatusCode)
+
+	res = test.PerformRequest(t, s, "POST", "/api/v1/admin/templates/unknown/tests/2/freeze", nil, nil)
+	require.Equal(t, 404, res.Result().StatusCode)
+
+	res = test.PerformRequest(t, s, "DELETE", "/api/v1/admin/templates/stubhash/tests/2/freeze", nil, nil)
+	require.Equal(t, 204, res.Result().StatusCode)
+
+	res = test.PerformRequest(t, s, "DELETE", "/api/v1/admin/templates/stubhash/tests/9/freeze", nil, nil)
+	require.Equal(t, 404, res.Result().StatusCode)
+}
+
+func TestListTemplates(t *testing.T) {
+	s := api.NewServer(api.DefaultServerConfigFromEnv())
+	s.Manager = stubManager{}
+
+	router.Init(s)
+
+	res := test.PerformRequest(t, s, "GET", "/api/v1/admin/templates", nil, nil)
+	require.Equal(t, 200, res.Result().StatusCode)
+	require.Equal(t, "2", res.Result().Header.Get("X-Total-Count"))
+
+	var list []manager.TrackedTemplate
+	require.NoError(t, json.NewDecoder(res.Result().Body).Decode(&list))
+	require.Len(t, list, 2)
+	require.Equal(t, "inithash", list[0].Hash)
+	require.Nil(t, list[0].Pool)
+	require.Equal(t, "finalized", list[1].State)
+	require.NotNil(t, list[1].Pool)
+	require.Equal(t, 3, list[1].Pool.Ready)
+	require.Equal(t, 1, list[1].Pool.InUse)
+
+	res = test.PerformRequest(t, s, "GET", "/api/v1/admin/templates?offset=1&limit=1", nil, nil)
+	require.Equal(t, 200, res.Result().StatusCode)
+
+	list = nil
+	require.NoError(t, json.NewDecoder(res.Result().Body).Decode(&list))
+	require.Len(t, list, 1)
+	require.Equal(t, "stubhash", list[0].Hash)
+}
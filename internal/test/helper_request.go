@@ -86,6 +86,31 @@ func PerformRequestWithRawBody(t *testing.T, s *api.Server, method string, path
 	return res
 }
 
+// PerformAdminRequest performs the request against the admin listener (see ServerConfig.AdminPort).
+func PerformAdminRequest(t *testing.T, s *api.Server, method string, path string, body GenericPayload, headers http.Header) *httptest.ResponseRecorder {
+	t.Helper()
+
+	var reader io.Reader
+	if body != nil {
+		reader = body.Reader(t)
+	}
+
+	req := httptest.NewRequest(method, path, reader)
+
+	if headers != nil {
+		req.Header = headers
+	}
+	if body != nil && len(req.Header.Get(echo.HeaderContentType)) == 0 {
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	}
+
+	res := httptest.NewRecorder()
+
+	s.AdminRouter().ServeHTTP(res, req)
+
+	return res
+}
+
 func PerformRequest(t *testing.T, s *api.Server, method string, path string, body GenericPayload, headers http.Header) *httptest.ResponseRecorder {
 	t.Helper()
 
@@ -53,6 +53,12 @@ func execClosureNewTestServer(ctx context.Context, t *testing.T, config api.Serv
 		t.Fatalf("failed to shutdown server: %v", err)
 	}
 
+	if s.AdminEcho != nil {
+		if err := s.AdminEcho.Shutdown(ctx); err != nil {
+			t.Fatalf("failed to shutdown admin server: %v", err)
+		}
+	}
+
 	if err := s.Manager.Disconnect(ctx, true); err != nil {
 		t.Fatalf("failed to shutdown manager: %v", err)
 	}
@@ -0,0 +1,235 @@
+// Package audit provides a minimal embedded store of destructive admin actions (who, when and what), answering
+// questions like "who wiped the templates at 3pm?" on shared CI infrastructure.
+//
+// Entries are keyed by their sequence ID and appended to a local file (one JSON object per line), each append is
+// synced to disk before it's acknowledged. All entries are kept in memory for querying.
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrClosed = errors.New("audit store is closed")
+
+// Action describes what was done.
+type Action string
+
+const (
+	ActionDiscardTemplate   Action = "discard_template"    // DELETE /api/v1/templates/:hash
+	ActionResetAllTemplates Action = "reset_all_templates" // DELETE /api/v1/admin/templates (optionally restricted to a label)
+	ActionMigratePrefixes   Action = "migrate_prefixes"    // POST /api/v1/admin/migrate-prefixes
+	ActionMigrateTemplate   Action = "migrate_template"    // POST /api/v1/admin/templates/:hash/migration
+	ActionResizePool        Action = "resize_pool"         // PUT /api/v1/admin/templates/:hash/pool
+	ActionFreezeTestDB      Action = "freeze_test_db"      // POST /api/v1/admin/templates/:hash/tests/:id/freeze
+	ActionUnfreezeTestDB    Action = "unfreeze_test_db"    // DELETE /api/v1/admin/templates/:hash/tests/:id/freeze
+	ActionScheduleTask      Action = "schedule_task"       // POST /api/v1/admin/schedules
+	ActionUnscheduleTask    Action = "unschedule_task"     // DELETE /api/v1/admin/schedules/:id
+	ActionRunScheduledTask  Action = "run_scheduled_task"  // POST /api/v1/admin/schedules/:id/run
+)
+
+// Actor describes who did it.
+type Actor struct {
+	Token     string `json:"token,omitempty"` // fingerprint of the credentials of the Authorization header (see TokenFingerprint), never the credentials themselves
+	RemoteIP  string `json:"remoteIp"`        // direct remote address of the request (X-Forwarded-For is ignored, like the allowlist)
+	UserAgent string `json:"userAgent,omitempty"`
+}
+
+type Entry struct {
+	ID        uint64            `json:"id"`
+	Time      time.Time         `json:"time"`
+	Action    Action            `json:"action"`
+	Hash      string            `json:"hash,omitempty"`
+	Params    map[string]string `json:"params,omitempty"` // e.g. the label of a reset
+	Actor     Actor             `json:"actor"`
+	RequestID string            `json:"requestId,omitempty"`
+	Status    int               `json:"status"` // HTTP status of the response, e.g. 403 for requests denied by the allowlist
+}
+
+// TokenFingerprint returns a stable fingerprint ("sha256:<16 hex chars>") of the credentials of the Authorization header
+// (e.g. "Bearer <token>"), empty without credentials. Operators compare it against the fingerprints of their tokens
+// (e.g. via `printf %s <token> | sha256sum`).
+func TokenFingerprint(authorization string) string {
+	authorization = strings.TrimSpace(authorization)
+	if len(authorization) == 0 {
+		return ""
+	}
+
+	// the scheme isn't part of the credentials
+	if _, credentials, ok := strings.Cut(authorization, " "); ok {
+		authorization = strings.TrimSpace(credentials)
+	}
+
+	sum := sha256.Sum256([]byte(authorization))
+	return "sha256:" + hex.EncodeToString(sum[:])[:16]
+}
+
+// Query filters the entries, zero values match all entries.
+type Query struct {
+	Since  time.Time // inclusive
+	Until  time.Time // exclusive
+	Action Action
+	Hash   string
+	Token  string
+}
+
+func (q Query) matches(e Entry) bool {
+	return (q.Since.IsZero() || !e.Time.Before(q.Since)) &&
+		(q.Until.IsZero() || e.Time.Before(q.Until)) &&
+		(len(q.Action) == 0 || e.Action == q.Action) &&
+		(len(q.Hash) == 0 || e.Hash == q.Hash) &&
+		(len(q.Token) == 0 || e.Actor.Token == q.Token)
+}
+
+// Store appends entries to its file, see the package docs.
+type Store struct {
+	file    *os.File
+	entries []Entry // ordered by ID
+	nextID  uint64
+	mutex   sync.RWMutex
+}
+
+// Open opens (or creates) the store at path and loads its entries. A truncated last line (e.g. a crash while
+// appending) is skipped and overwritten by the next append.
+func Open(path string) (*Store, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o640)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Store{file: file, entries: make([]Entry, 0), nextID: 1}
+
+	valid, err := s.load()
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to load the audit store %s: %w", path, err)
+	}
+
+	// drop a truncated last line, appends continue at the end of the last complete entry
+	if err := file.Truncate(valid); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	if _, err := file.Seek(valid, io.SeekStart); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// load reads all entries, returning the offset after the last complete one.
+func (s *Store) load() (int64, error) {
+	reader := bufio.NewReader(s.file)
+
+	var offset int64
+	for {
+		line, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			// empty or truncated last line
+			return offset, nil
+		}
+		if err != nil {
+			return offset, err
+		}
+
+		var entry Entry
+		if err := json.Unmarshal(bytes.TrimSpace(line), &entry); err != nil {
+			return offset, fmt.Errorf("invalid entry at offset %d: %w", offset, err)
+		}
+
+		s.entries = append(s.entries, entry)
+		if entry.ID >= s.nextID {
+			s.nextID = entry.ID + 1
+		}
+
+		offset += int64(len(line))
+	}
+}
+
+// Append assigns the next ID (and the current time if unset) to the entry and persists it.
+func (s *Store) Append(entry Entry) (Entry, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.file == nil {
+		return entry, ErrClosed
+	}
+
+	entry.ID = s.nextID
+	if entry.Time.IsZero() {
+		entry.Time = time.Now().UTC()
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return entry, err
+	}
+
+	if _, err := s.file.Write(append(line, '\n')); err != nil {
+		return entry, err
+	}
+
+	if err := s.file.Sync(); err != nil {
+		return entry, err
+	}
+
+	s.nextID++
+	s.entries = append(s.entries, entry)
+
+	return entry, nil
+}
+
+// Get returns the entry with the ID.
+func (s *Store) Get(id uint64) (Entry, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	for _, entry := range s.entries {
+		if entry.ID == id {
+			return entry, true
+		}
+	}
+
+	return Entry{}, false
+}
+
+// Query returns all entries matching the query ordered by ID (oldest first).
+func (s *Store) Query(q Query) []Entry {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	entries := make([]Entry, 0)
+	for _, entry := range s.entries {
+		if q.matches(entry) {
+			entries = append(entries, entry)
+		}
+	}
+
+	return entries
+}
+
+func (s *Store) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.file == nil {
+		return nil
+	}
+
+	err := s.file.Close()
+	s.file = nil
+
+	return err
+}
@@ -0,0 +1,80 @@
+package audit_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/allaboutapps/integresql/pkg/audit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStoreAppendQuery(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+
+	s, err := audit.Open(path)
+	require.NoError(t, err)
+
+	start := time.Date(2024, 5, 1, 15, 0, 0, 0, time.UTC)
+	token := audit.TokenFingerprint("Bearer secret")
+
+	for i, entry := range []audit.Entry{
+		{Time: start, Action: audit.ActionDiscardTemplate, Hash: "abc", Actor: audit.Actor{Token: token, RemoteIP: "10.0.0.1"}, Status: 204},
+		{Time: start.Add(time.Minute), Action: audit.ActionResetAllTemplates, Actor: audit.Actor{RemoteIP: "10.0.0.2"}, Status: 204},
+		{Time: start.Add(2 * time.Minute), Action: audit.ActionDiscardTemplate, Hash: "def", Actor: audit.Actor{Token: token}, Status: 403},
+	} {
+		appended, err := s.Append(entry)
+		require.NoError(t, err)
+		assert.Equal(t, uint64(i+1), appended.ID)
+	}
+
+	assert.Len(t, s.Query(audit.Query{}), 3)
+	assert.Len(t, s.Query(audit.Query{Action: audit.ActionDiscardTemplate}), 2)
+	assert.Len(t, s.Query(audit.Query{Token: token}), 2)
+	assert.Len(t, s.Query(audit.Query{Hash: "def"}), 1)
+
+	window := s.Query(audit.Query{Since: start.Add(time.Minute), Until: start.Add(2 * time.Minute)})
+	require.Len(t, window, 1)
+	assert.Equal(t, audit.ActionResetAllTemplates, window[0].Action)
+
+	entry, ok := s.Get(3)
+	require.True(t, ok)
+	assert.Equal(t, "def", entry.Hash)
+
+	require.NoError(t, s.Close())
+	_, err = s.Append(audit.Entry{Action: audit.ActionMigratePrefixes})
+	assert.ErrorIs(t, err, audit.ErrClosed)
+
+	// a crash while appending leaves a truncated line behind, reopening skips it and continues the IDs
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o600)
+	require.NoError(t, err)
+	_, err = f.WriteString(`{"id":4,"action":"mig`)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	s, err = audit.Open(path)
+	require.NoError(t, err)
+	defer s.Close()
+
+	assert.Len(t, s.Query(audit.Query{}), 3)
+
+	appended, err := s.Append(audit.Entry{Action: audit.ActionMigratePrefixes})
+	require.NoError(t, err)
+	assert.Equal(t, uint64(4), appended.ID)
+	assert.False(t, appended.Time.IsZero())
+
+	require.NoError(t, s.Close())
+	s, err = audit.Open(path)
+	require.NoError(t, err)
+	assert.Len(t, s.Query(audit.Query{}), 4)
+}
+
+func TestTokenFingerprint(t *testing.T) {
+	assert.Empty(t, audit.TokenFingerprint(""))
+	assert.Equal(t, audit.TokenFingerprint("Bearer secret"), audit.TokenFingerprint("Basic secret"))
+	assert.NotEqual(t, audit.TokenFingerprint("Bearer secret"), audit.TokenFingerprint("Bearer other"))
+	assert.NotContains(t, audit.TokenFingerprint("Bearer secret"), "secret")
+	assert.Len(t, audit.TokenFingerprint("Bearer secret"), len("sha256:")+16)
+}
@@ -0,0 +1,466 @@
+// Package client is the Go client of the IntegreSQL HTTP API: setting up templates and acquiring/returning test
+// databases with typed errors (see APIError), context support and retries of transient failures.
+//
+//	c, err := client.New(client.DefaultConfigFromEnv())
+//	err = c.SetupTemplate(ctx, hash, func(ctx context.Context, conn *sql.DB) error {
+//		return migrateAndSeed(ctx, conn)
+//	})
+//	testDB, err := c.GetTestDatabase(ctx, hash)
+//	defer c.ReturnTestDatabase(ctx, hash, testDB.ID)
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/allaboutapps/integresql/pkg/db"
+	"github.com/allaboutapps/integresql/pkg/signature"
+	"github.com/allaboutapps/integresql/pkg/util"
+
+	// Import postgres driver for database/sql package
+	_ "github.com/lib/pq"
+)
+
+// headerDeadlineHint lets the server give up (with a precise error) before the deadline of the ctx is reached.
+const headerDeadlineHint = "X-Integresql-Deadline-Ms"
+
+// headerHolder identifies the client in the stale checkout alerts of the server.
+const headerHolder = "X-Integresql-Holder"
+
+type Config struct {
+	BaseURL    string // e.g. "http://integresql:5000/api"
+	APIVersion string
+
+	MaxRetries      int           // Retries of requests failing due to network errors or unavailability (502, 503, 504), 0 disables retries
+	RetryBackoff    time.Duration // Sleep before the first retry, doubled before each further one...
+	RetryBackoffMax time.Duration // ... up to this maximum
+
+	Holder string // Optional, identifies the client holding test databases (e.g. the CI job "worker-12"), defaults to its remote address
+
+	Token string // Optional, sensitive, bearer token sent with each request (runner or admin token of the server)
+
+	// Optional, base64 Ed25519 public key of the server (see Info), responses of acquiring and returning test databases
+	// must be signed by it, otherwise ErrInvalidSignature is returned
+	SigningPublicKey string
+
+	HTTPClient *http.Client // Optional, defaults to a new http.Client
+
+	// Optional, PEM CA certificates trusted in addition to the system ones verifying the TLS certificate of the server
+	// (e.g. its self-signed one), ignored if an HTTPClient is set
+	CAFile string
+
+	Interceptors []Interceptor // Optional, wrap each HTTP request (including retries), the first one is the outermost
+}
+
+func DefaultConfigFromEnv() Config {
+	return Config{
+		BaseURL:          util.GetEnv("INTEGRESQL_CLIENT_BASE_URL", "http://integresql:5000/api"),
+		APIVersion:       util.GetEnv("INTEGRESQL_CLIENT_API_VERSION", "v1"),
+		MaxRetries:       util.GetEnvAsInt("INTEGRESQL_CLIENT_MAX_RETRIES", 3),
+		RetryBackoff:     time.Millisecond * time.Duration(util.GetEnvAsInt("INTEGRESQL_CLIENT_RETRY_BACKOFF_MS", 250)),
+		RetryBackoffMax:  time.Millisecond * time.Duration(util.GetEnvAsInt("INTEGRESQL_CLIENT_RETRY_BACKOFF_MAX_MS", 1000*5 /*5 sec*/)),
+		Holder:           util.GetEnv("INTEGRESQL_CLIENT_HOLDER", ""),
+		Token:            util.GetEnv("INTEGRESQL_CLIENT_TOKEN", ""),
+		SigningPublicKey: util.GetEnv("INTEGRESQL_CLIENT_SIGNING_PUBLIC_KEY", ""),
+		CAFile:           util.GetEnv("INTEGRESQL_CLIENT_CA_FILE", ""),
+	}
+}
+
+type Client struct {
+	config     Config
+	baseURL    *url.URL
+	http       *http.Client
+	signingKey ed25519.PublicKey // nil if responses aren't verified
+	invoke     Invoker           // sends requests through the Config.Interceptors
+}
+
+func New(config Config) (*Client, error) {
+	if len(config.APIVersion) == 0 {
+		config.APIVersion = "v1"
+	}
+
+	if config.HTTPClient == nil {
+		config.HTTPClient = &http.Client{}
+
+		if len(config.CAFile) > 0 {
+			httpClient, err := NewHTTPClient(config.CAFile)
+			if err != nil {
+				return nil, err
+			}
+			config.HTTPClient = httpClient
+		}
+	}
+
+	u, err := url.Parse(config.BaseURL)
+	if err != nil {
+		return nil, err
+	}
+
+	var signingKey ed25519.PublicKey
+	if len(config.SigningPublicKey) > 0 {
+		if signingKey, err = signature.ParsePublicKey(config.SigningPublicKey); err != nil {
+			return nil, err
+		}
+	}
+
+	return &Client{
+		config:     config,
+		baseURL:    u.ResolveReference(&url.URL{Path: path.Join(u.Path, config.APIVersion)}),
+		http:       config.HTTPClient,
+		signingKey: signingKey,
+		invoke:     chainInterceptors(config.Interceptors, config.HTTPClient.Do),
+	}, nil
+}
+
+func DefaultFromEnv() (*Client, error) {
+	return New(DefaultConfigFromEnv())
+}
+
+// TemplateOptions are the optional settings of a template, see the template options of the README.
+type TemplateOptions struct {
+	PostCloneScript         string            `json:"postCloneScript,omitempty"`
+	ValidationQueries       []string          `json:"validationQueries,omitempty"`
+	SourceKind              string            `json:"sourceKind,omitempty"`
+	SourceDatabase          string            `json:"sourceDatabase,omitempty"`
+	SourceDump              string            `json:"sourceDump,omitempty"`
+	SourceArtifact          string            `json:"sourceArtifact,omitempty"`
+	Ephemeral               bool              `json:"ephemeral,omitempty"`
+	TTL                     time.Duration     `json:"-"`
+	MaxCloneAge             time.Duration     `json:"-"`
+	MaxLeaseDuration        time.Duration     `json:"-"`
+	FillConcurrency         int               `json:"fillConcurrency,omitempty"`
+	FillPriority            int               `json:"fillPriority,omitempty"`
+	InitialPoolSize         int               `json:"initialPoolSize,omitempty"`
+	MaxPoolSize             int               `json:"maxPoolSize,omitempty"`
+	SelectionPolicy         string            `json:"selectionPolicy,omitempty"`
+	Labels                  []string          `json:"labels,omitempty"`
+	Settings                map[string]string `json:"settings,omitempty"`
+	Metadata                map[string]string `json:"metadata,omitempty"`
+	Namespace               string            `json:"namespace,omitempty"`
+	ReadyWebhook            string            `json:"readyWebhook,omitempty"`
+	FailedWebhook           string            `json:"failedWebhook,omitempty"`
+	StaleCheckoutAlertAfter time.Duration     `json:"-"`
+	StaleCheckoutWebhook    string            `json:"staleCheckoutWebhook,omitempty"`
+
+	// Fingerprint of the full schema the hash was derived from, initializing a hash tracked with a different one
+	// fails with ErrTemplateHashCollision.
+	SchemaFingerprint string `json:"schemaFingerprint,omitempty"`
+
+	// Tablespaces of the template and (if different) its test databases, settings of the clone-time sessions (e.g.
+	// "maintenance_io_concurrency"), see the tablespaces section of the README.
+	Tablespace      string            `json:"tablespace,omitempty"`
+	CloneTablespace string            `json:"cloneTablespace,omitempty"`
+	CloneSettings   map[string]string `json:"cloneSettings,omitempty"`
+
+	// Tables whose contents are checksummed while finalizing, acquired test databases carry the checksum (see
+	// db.TestDatabase.Checksum).
+	ChecksumTables []string `json:"checksumTables,omitempty"`
+}
+
+// Info about the server, see Info.
+type Info struct {
+	SigningPublicKey *string `json:"signingPublicKey"` // nil if the server doesn't sign responses, see Config.SigningPublicKey
+}
+
+// Lease of a checked out test database, see RenewTestDatabase.
+type Lease struct {
+	ExpiresAt    *time.Time `json:"expiresAt"`    // nil if the test database is never auto-cleaned
+	MaxExpiresAt *time.Time `json:"maxExpiresAt"` // nil if renewals are unlimited
+}
+
+func (c *Client) InitializeTemplate(ctx context.Context, hash string) (db.TemplateDatabase, error) {
+	return c.InitializeTemplateWithOptions(ctx, hash, TemplateOptions{})
+}
+
+// InitializeTemplateWithOptions initializes the template, returning ErrTemplateAlreadyInitialized if another
+// client initialized it already (e.g. a concurrent test runner), which typically waits for it via GetTestDatabase.
+// ErrTemplateNamespaceConflict is returned if another namespace tracks the template without sharing it.
+func (c *Client) InitializeTemplateWithOptions(ctx context.Context, hash string, options TemplateOptions) (db.TemplateDatabase, error) {
+	var template db.TemplateDatabase
+	err := c.request(ctx, http.MethodPost, "/templates", nil, templatePayload(hash, options), http.StatusOK, &template, templateErrors)
+
+	return template, err
+}
+
+// BootstrapTemplate makes sure a finalized template exists, initializing it from the source of the options (a dump,
+// source database, existing database or artifact) and finalizing it in a single idempotent call. A template currently
+// initialized by another client is joined by waiting until it's finalized.
+func (c *Client) BootstrapTemplate(ctx context.Context, hash string, options TemplateOptions) (db.TemplateDatabase, error) {
+	var template db.TemplateDatabase
+	err := c.request(ctx, http.MethodPost, "/templates/bootstrap", nil, templatePayload(hash, options), http.StatusOK, &template, bootstrapErrors)
+
+	return template, err
+}
+
+// templatePayload returns the JSON payload of initializing (or bootstrapping) the template.
+func templatePayload(hash string, options TemplateOptions) interface{} {
+	return struct {
+		TemplateOptions
+		Hash                      string `json:"hash"`
+		MaxCloneAgeMs             int64  `json:"maxCloneAgeMs,omitempty"`
+		MaxLeaseDurationMs        int64  `json:"maxLeaseDurationMs,omitempty"`
+		StaleCheckoutAlertAfterMs int64  `json:"staleCheckoutAlertAfterMs,omitempty"`
+		TTLMs                     int64  `json:"ttlMs,omitempty"`
+	}{
+		TemplateOptions:           options,
+		Hash:                      hash,
+		MaxCloneAgeMs:             options.MaxCloneAge.Milliseconds(),
+		MaxLeaseDurationMs:        options.MaxLeaseDuration.Milliseconds(),
+		StaleCheckoutAlertAfterMs: options.StaleCheckoutAlertAfter.Milliseconds(),
+		TTLMs:                     options.TTL.Milliseconds(),
+	}
+}
+
+// FinalizeTemplate marks the template as ready, its test databases are cloned from now on.
+// Finalizing an already finalized template succeeds.
+func (c *Client) FinalizeTemplate(ctx context.Context, hash string) error {
+	return c.request(ctx, http.MethodPut, fmt.Sprintf("/templates/%s", hash), nil, nil, http.StatusNoContent, nil, templateErrors)
+}
+
+// DiscardTemplate removes the template and all of its test databases.
+func (c *Client) DiscardTemplate(ctx context.Context, hash string) error {
+	return c.request(ctx, http.MethodDelete, fmt.Sprintf("/templates/%s", hash), nil, nil, http.StatusNoContent, nil, discardErrors)
+}
+
+// SetupTemplate initializes the template, populates it via init and finalizes it. If the template was already
+// initialized (e.g. by a concurrent test runner), nil is returned right away without calling init.
+func (c *Client) SetupTemplate(ctx context.Context, hash string, init func(ctx context.Context, conn *sql.DB) error) error {
+	template, err := c.InitializeTemplate(ctx, hash)
+	if errors.Is(err, ErrTemplateAlreadyInitialized) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if err := c.populateTemplate(ctx, template, init); err != nil {
+		// don't leave a half populated template behind, others would wait for it in vain
+		if discardErr := c.DiscardTemplate(ctx, hash); discardErr != nil {
+			return fmt.Errorf("%w (discarding the template failed as well: %v)", err, discardErr)
+		}
+
+		return err
+	}
+
+	return c.FinalizeTemplate(ctx, hash)
+}
+
+func (c *Client) populateTemplate(ctx context.Context, template db.TemplateDatabase, init func(ctx context.Context, conn *sql.DB) error) error {
+	conn, err := sql.Open("postgres", template.Config.ConnectionString())
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if err := conn.PingContext(ctx); err != nil {
+		return err
+	}
+
+	return init(ctx, conn)
+}
+
+// GetTestDatabase acquires a ready test database of the template, waiting for the template to be finalized.
+func (c *Client) GetTestDatabase(ctx context.Context, hash string) (db.TestDatabase, error) {
+	var testDB db.TestDatabase
+	err := c.signedRequest(ctx, http.MethodGet, fmt.Sprintf("/templates/%s/tests", hash), nil, http.StatusOK, &testDB, testDatabaseErrors)
+
+	return testDB, err
+}
+
+// GetTestDatabaseSkipClean accepts a dirty test database as-is (flagged via db.TestDatabase.Dirty), the caller is
+// responsible for resetting it.
+func (c *Client) GetTestDatabaseSkipClean(ctx context.Context, hash string) (db.TestDatabase, error) {
+	var testDB db.TestDatabase
+	err := c.signedRequest(ctx, http.MethodGet, fmt.Sprintf("/templates/%s/tests", hash), url.Values{"skipClean": []string{"true"}}, http.StatusOK, &testDB, testDatabaseErrors)
+
+	return testDB, err
+}
+
+// GetTestDatabaseWithLease acquires a ready test database, which is reclaimed (recreated and handed out again) as soon
+// as the lease expired without being returned or renewed (see RenewTestDatabase), e.g. as the test process crashed.
+func (c *Client) GetTestDatabaseWithLease(ctx context.Context, hash string, lease time.Duration) (db.TestDatabase, error) {
+	var testDB db.TestDatabase
+	err := c.signedRequest(ctx, http.MethodGet, fmt.Sprintf("/templates/%s/tests", hash), url.Values{"leaseMs": []string{strconv.FormatInt(lease.Milliseconds(), 10)}}, http.StatusOK, &testDB, testDatabaseErrors)
+
+	return testDB, err
+}
+
+// GetTestDatabaseAsOwner acquires a ready test database owned by the role (e.g. the role of the application under
+// test), the returned config connects as it. The role must be allowlisted by the server.
+func (c *Client) GetTestDatabaseAsOwner(ctx context.Context, hash string, owner string) (db.TestDatabase, error) {
+	var testDB db.TestDatabase
+	err := c.signedRequest(ctx, http.MethodGet, fmt.Sprintf("/templates/%s/tests", hash), url.Values{"owner": []string{owner}}, http.StatusOK, &testDB, testDatabaseErrors)
+
+	return testDB, err
+}
+
+// ReturnTestDatabase returns the (unmodified) test database, it's handed out again as-is. Use RecreateTestDatabase
+// for modified ones.
+func (c *Client) ReturnTestDatabase(ctx context.Context, hash string, id int) error {
+	return c.signedRequest(ctx, http.MethodPost, fmt.Sprintf("/templates/%s/tests/%d/unlock", hash, id), nil, http.StatusNoContent, nil, testDatabaseErrors)
+}
+
+// RecreateTestDatabase returns the test database, it's recreated from the template before being handed out again.
+func (c *Client) RecreateTestDatabase(ctx context.Context, hash string, id int) error {
+	return c.signedRequest(ctx, http.MethodPost, fmt.Sprintf("/templates/%s/tests/%d/recreate", hash, id), nil, http.StatusNoContent, nil, testDatabaseErrors)
+}
+
+// RenewTestDatabase extends the lease of the checked out test database, preventing its auto-cleaning while a long
+// running test is still using it.
+func (c *Client) RenewTestDatabase(ctx context.Context, hash string, id int) (Lease, error) {
+	var lease Lease
+	err := c.request(ctx, http.MethodPost, fmt.Sprintf("/templates/%s/tests/%d/renew", hash, id), nil, nil, http.StatusOK, &lease, leaseErrors)
+
+	return lease, err
+}
+
+// Info returns the info of the server, e.g. its public key to pin via Config.SigningPublicKey. As the response itself
+// isn't signed, pin a key retrieved via a trusted channel.
+func (c *Client) Info(ctx context.Context) (Info, error) {
+	var info Info
+	err := c.request(ctx, http.MethodGet, "/info", nil, nil, http.StatusOK, &info, nil)
+
+	return info, err
+}
+
+// request sends the request (retrying transient failures) and decodes the response into v if it has the expected
+// status, other statuses are returned as APIError.
+func (c *Client) request(ctx context.Context, method string, endpoint string, query url.Values, body interface{}, expectedStatus int, v interface{}, errs statusErrors) error {
+	return c.send(ctx, method, endpoint, query, body, false, expectedStatus, v, errs)
+}
+
+// signedRequest is a request whose response must be signed by the server, if a Config.SigningPublicKey is configured.
+func (c *Client) signedRequest(ctx context.Context, method string, endpoint string, query url.Values, expectedStatus int, v interface{}, errs statusErrors) error {
+	return c.send(ctx, method, endpoint, query, nil, c.signingKey != nil, expectedStatus, v, errs)
+}
+
+func (c *Client) send(ctx context.Context, method string, endpoint string, query url.Values, body interface{}, signed bool, expectedStatus int, v interface{}, errs statusErrors) error {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+
+	backoff := c.config.RetryBackoff
+
+	for attempt := 0; ; attempt++ {
+		statusCode, respBody, err := c.do(ctx, method, endpoint, query, payload, signed)
+
+		// spoofed responses are never retried
+		retryable := (err != nil && ctx.Err() == nil && !errors.Is(err, ErrInvalidSignature)) ||
+			statusCode == http.StatusBadGateway || statusCode == http.StatusServiceUnavailable || statusCode == http.StatusGatewayTimeout
+
+		if !retryable || attempt >= c.config.MaxRetries {
+			if err != nil {
+				return err
+			}
+
+			return c.decode(statusCode, respBody, expectedStatus, v, errs)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+		if c.config.RetryBackoffMax > 0 && backoff > c.config.RetryBackoffMax {
+			backoff = c.config.RetryBackoffMax
+		}
+	}
+}
+
+func (c *Client) do(ctx context.Context, method string, endpoint string, query url.Values, payload []byte, signed bool) (int, []byte, error) {
+	u := c.baseURL.ResolveReference(&url.URL{Path: path.Join(c.baseURL.Path, endpoint), RawQuery: query.Encode()})
+
+	var body io.Reader
+	if payload != nil {
+		body = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json; charset=UTF-8")
+	}
+
+	req.Header.Set("Accept", "application/json")
+
+	if len(c.config.Holder) > 0 {
+		req.Header.Set(headerHolder, c.config.Holder)
+	}
+
+	if len(c.config.Token) > 0 {
+		req.Header.Set("Authorization", "Bearer "+c.config.Token)
+	}
+
+	// a fresh nonce per attempt, binding the signature to this very request (no replays)
+	var nonce string
+	if signed {
+		if nonce, err = signature.NewNonce(); err != nil {
+			return 0, nil, err
+		}
+		req.Header.Set(signature.NonceHeader, nonce)
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		remaining := time.Until(deadline).Milliseconds()
+		if remaining < 0 {
+			remaining = 0
+		}
+		req.Header.Set(headerDeadlineHint, strconv.FormatInt(remaining, 10))
+	}
+
+	resp, err := c.invoke(req)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	// body must always be closed
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if signed && !signature.Verify(c.signingKey, method, nonce, resp.StatusCode, respBody, resp.Header.Get(signature.SignatureHeader)) {
+		return 0, nil, fmt.Errorf("%w: %s %s (HTTP status %d)", ErrInvalidSignature, method, endpoint, resp.StatusCode)
+	}
+
+	return resp.StatusCode, respBody, nil
+}
+
+func (c *Client) decode(statusCode int, body []byte, expectedStatus int, v interface{}, errs statusErrors) error {
+	if statusCode != expectedStatus {
+		// echo.HTTPError
+		var response errorResponse
+		if err := json.Unmarshal(body, &response); err != nil {
+			response = errorResponse{Message: string(bytes.TrimSpace(body))}
+		}
+
+		return newAPIError(statusCode, response, errs)
+	}
+
+	if v == nil || len(body) == 0 {
+		return nil
+	}
+
+	return json.Unmarshal(body, v)
+}
@@ -0,0 +1,35 @@
+package client
+
+import (
+	"net"
+	"net/url"
+	"strconv"
+
+	"github.com/allaboutapps/integresql/pkg/db"
+)
+
+// ConnectionString returns the key/value connection string of the database (e.g. for sql.Open("postgres", ...)).
+func ConnectionString(database db.Database) string {
+	return database.Config.ConnectionString()
+}
+
+// ConnectionURL returns the postgres:// URL of the database, e.g. for DATABASE_URL style configs of tools and ORMs
+// not accepting key/value connection strings.
+func ConnectionURL(database db.Database) string {
+	config := database.Config
+
+	query := url.Values{}
+	for param, value := range config.Params() {
+		query.Set(param, value)
+	}
+
+	u := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(config.Username, config.Password),
+		Host:     net.JoinHostPort(config.Host, strconv.Itoa(config.Port)),
+		Path:     "/" + config.Database,
+		RawQuery: query.Encode(),
+	}
+
+	return u.String()
+}
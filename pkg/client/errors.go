@@ -0,0 +1,145 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+var (
+	ErrManagerNotReady            = errors.New("manager not ready")
+	ErrTemplateAlreadyInitialized = errors.New("template is already initialized")
+	ErrTemplateNotFound           = errors.New("template not found")
+	ErrTemplateDiscarded          = errors.New("template is discarded")
+	ErrTemplateInUse              = errors.New("template is in use")
+	ErrTestNotFound               = errors.New("test database not found")
+	ErrTestDatabaseInUse          = errors.New("test database is in use")
+	ErrInvalidState               = errors.New("test database is in an invalid state")
+	ErrLeaseExpired               = errors.New("lease of the test database expired")
+	ErrDeadlineExceeded           = errors.New("deadline exceeded")
+	ErrTemplateQuotaExceeded      = errors.New("template quota exceeded")
+	ErrTemplateHashCollision      = errors.New("template hash collision")
+	ErrTemplateNamespaceConflict  = errors.New("template is tracked by another namespace")
+	ErrCircuitOpen                = errors.New("circuit breaker of the template is open")
+	ErrBadRequest                 = errors.New("bad request")
+
+	// ErrInvalidSignature is returned if a signed response (see Config.SigningPublicKey) isn't signed by the server key.
+	ErrInvalidSignature = errors.New("invalid response signature")
+)
+
+// APIError is returned for all responses with an unexpected status. It wraps the typed error (e.g. ErrTemplateNotFound)
+// of the status, thus check it via errors.Is, the details are available via errors.As.
+type APIError struct {
+	StatusCode int
+	Message    string // message of the server, if any
+
+	// Code of the typed error (e.g. "test_not_found") and the context of the failed operation on the server, if any
+	Code   string
+	Op     string // e.g. "get_test_db"
+	Hash   string
+	DBName string
+
+	err error // typed error of the code or status, nil for unknown ones
+}
+
+func (e *APIError) Error() string {
+	if len(e.Message) == 0 {
+		return fmt.Sprintf("integresql: unexpected HTTP status %d (%s)", e.StatusCode, http.StatusText(e.StatusCode))
+	}
+
+	return fmt.Sprintf("integresql: unexpected HTTP status %d (%s): %s", e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
+
+func (e *APIError) Unwrap() error {
+	return e.err
+}
+
+// codeErrors maps the codes of error responses to the typed errors, taking precedence over the status of the endpoint.
+var codeErrors = map[string]error{
+	"manager_not_ready":             ErrManagerNotReady,
+	"template_quota_exceeded":       ErrTemplateQuotaExceeded,
+	"template_hash_collision":       ErrTemplateHashCollision,
+	"template_namespace_conflict":   ErrTemplateNamespaceConflict,
+	"template_already_initialized":  ErrTemplateAlreadyInitialized,
+	"template_not_found":            ErrTemplateNotFound,
+	"test_not_found":                ErrTestNotFound,
+	"template_discarded":            ErrTemplateDiscarded,
+	"invalid_template_options":      ErrBadRequest,
+	"invalid_test_database_options": ErrBadRequest,
+	"deadline_exceeded":             ErrDeadlineExceeded,
+	"test_database_in_use":          ErrTestDatabaseInUse,
+	"invalid_state":                 ErrInvalidState,
+	"lease_expired":                 ErrLeaseExpired,
+	"circuit_open":                  ErrCircuitOpen,
+}
+
+// errorResponse is the body of error responses (echo.HTTPError), see api.ErrorResponse.
+type errorResponse struct {
+	Message string `json:"message"`
+	Code    string `json:"code"`
+	Op      string `json:"op"`
+	Hash    string `json:"hash"`
+	DBName  string `json:"dbName"`
+}
+
+// statusErrors maps the status of an endpoint to its typed error, see newAPIError.
+type statusErrors map[int]error
+
+var (
+	templateErrors = statusErrors{
+		http.StatusNotFound:        ErrTemplateNotFound,
+		http.StatusLocked:          ErrTemplateAlreadyInitialized,
+		http.StatusConflict:        ErrTemplateHashCollision,
+		http.StatusTooManyRequests: ErrTemplateQuotaExceeded,
+	}
+
+	bootstrapErrors = statusErrors{
+		http.StatusGone:            ErrTemplateDiscarded,
+		http.StatusConflict:        ErrTemplateHashCollision,
+		http.StatusTooManyRequests: ErrTemplateQuotaExceeded,
+		http.StatusRequestTimeout:  ErrDeadlineExceeded,
+	}
+
+	discardErrors = statusErrors{
+		http.StatusNotFound: ErrTemplateNotFound,
+		http.StatusLocked:   ErrTemplateInUse, // e.g. test databases are still being cloned from it
+	}
+
+	testDatabaseErrors = statusErrors{
+		http.StatusNotFound:       ErrTemplateNotFound, // or ErrTestNotFound, see newAPIError
+		http.StatusGone:           ErrTemplateDiscarded,
+		http.StatusLocked:         ErrTestDatabaseInUse,
+		http.StatusConflict:       ErrInvalidState,
+		http.StatusRequestTimeout: ErrDeadlineExceeded,
+	}
+
+	leaseErrors = statusErrors{
+		http.StatusNotFound:       ErrTemplateNotFound,
+		http.StatusGone:           ErrLeaseExpired,
+		http.StatusConflict:       ErrInvalidState,
+		http.StatusRequestTimeout: ErrDeadlineExceeded,
+	}
+)
+
+func newAPIError(statusCode int, response errorResponse, errs statusErrors) *APIError {
+	apiErr := &APIError{
+		StatusCode: statusCode,
+		Message:    response.Message,
+		Code:       response.Code,
+		Op:         response.Op,
+		Hash:       response.Hash,
+		DBName:     response.DBName,
+		err:        errs[statusCode],
+	}
+
+	switch {
+	case codeErrors[response.Code] != nil:
+		apiErr.err = codeErrors[response.Code]
+	case statusCode == http.StatusServiceUnavailable:
+		apiErr.err = ErrManagerNotReady
+	case statusCode == http.StatusBadRequest:
+		apiErr.err = ErrBadRequest
+	}
+
+	return apiErr
+}
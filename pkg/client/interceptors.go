@@ -0,0 +1,81 @@
+package client
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"sync"
+)
+
+// Invoker sends the request, see Interceptor.
+type Invoker func(req *http.Request) (*http.Response, error)
+
+// Interceptor wraps each HTTP request of the client (including retries) and calls next to send it, e.g. adding auth
+// headers, recording metrics, injecting trace headers or capturing bodies for debugging. The request already carries
+// all headers of the client. Interceptors must not consume the response body without replacing it.
+type Interceptor func(req *http.Request, next Invoker) (*http.Response, error)
+
+// chainInterceptors returns the invoker passing requests through the interceptors (the first one is the outermost)
+// before sending them via send.
+func chainInterceptors(interceptors []Interceptor, send Invoker) Invoker {
+	invoker := send
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, next := interceptors[i], invoker
+		invoker = func(req *http.Request) (*http.Response, error) {
+			return interceptor(req, next)
+		}
+	}
+
+	return invoker
+}
+
+// HeaderInterceptor sets the headers on each request, e.g. an Authorization header for a server behind a proxy.
+func HeaderInterceptor(header http.Header) Interceptor {
+	return func(req *http.Request, next Invoker) (*http.Response, error) {
+		for key, values := range header {
+			req.Header.Del(key)
+			for _, value := range values {
+				req.Header.Add(key, value)
+			}
+		}
+
+		return next(req)
+	}
+}
+
+// DumpInterceptor writes each request and response (including their bodies) to w for debugging, see
+// httputil.DumpRequestOut. Writes are serialized, concurrent requests don't interleave.
+func DumpInterceptor(w io.Writer) Interceptor {
+	var mutex sync.Mutex
+
+	return func(req *http.Request, next Invoker) (*http.Response, error) {
+		reqDump, err := httputil.DumpRequestOut(req, true)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := next(req)
+
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		fmt.Fprintf(w, "%s\n\n", reqDump)
+
+		if err != nil {
+			fmt.Fprintf(w, "error: %v\n\n", err)
+			return nil, err
+		}
+
+		// the body is read and replaced by DumpResponse
+		respDump, err := httputil.DumpResponse(resp, true)
+		if err != nil {
+			resp.Body.Close()
+			return nil, err
+		}
+
+		fmt.Fprintf(w, "%s\n\n", respDump)
+
+		return resp, nil
+	}
+}
@@ -0,0 +1,38 @@
+package client
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+)
+
+var ErrNoCACertificates = errors.New("no CA certificates found")
+
+// NewHTTPClient returns an http.Client verifying the TLS certificate of the server with the PEM CA certificates of the
+// caFile in addition to the system ones, e.g. the self-signed certificate of the server (INTEGRESQL_TLS_CERT_FILE).
+func NewHTTPClient(caFile string) (*http.Client, error) {
+	pem, err := os.ReadFile(caFile) // #nosec G304 - path is provided via config
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA file: %w", err)
+	}
+
+	roots, err := x509.SystemCertPool()
+	if err != nil {
+		roots = x509.NewCertPool()
+	}
+
+	if !roots.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("%w in %s", ErrNoCACertificates, caFile)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{
+		RootCAs:    roots,
+		MinVersion: tls.VersionTLS12,
+	}
+
+	return &http.Client{Transport: transport}, nil
+}
@@ -8,7 +8,17 @@ type Database struct {
 type TestDatabase struct {
 	Database `json:"database"`
 
-	ID int `json:"id"`
+	ID   int   `json:"id"`
+	Seed int64 `json:"seed"` // random seed assigned on each recreation, useful for reproducing randomized test data
+
+	// handed out as-is (skip clean), thus still containing the changes of previous tests since its last recreation
+	Dirty bool `json:"dirty"`
+
+	// database name to connect to via the connection pooler (e.g. PgBouncer) integresql generates the config of, if enabled
+	PoolerAlias string `json:"poolerAlias,omitempty"`
+
+	// checksum of the checksum tables of the template computed while finalizing it, if any
+	Checksum string `json:"checksum,omitempty"`
 }
 
 type TemplateDatabase struct {
@@ -13,6 +13,39 @@ type DatabaseConfig struct {
 	Password         string            `json:"password"`
 	Database         string            `json:"database"`
 	AdditionalParams map[string]string `json:"additionalParams,omitempty"` // Optional additional connection parameters mapped into the connection string
+
+	// Optional TLS settings of the connection (libpq sslmode, sslrootcert, sslcert and sslkey), taking precedence over
+	// the AdditionalParams. Without any SSLMode, TLS is disabled.
+	SSLMode     string `json:"sslMode,omitempty"`     // e.g. "require" or "verify-full"
+	SSLRootCert string `json:"sslRootCert,omitempty"` // path of the root CA certificate(s) verifying the server
+	SSLCert     string `json:"sslCert,omitempty"`     // path of the client certificate
+	SSLKey      string `json:"sslKey,omitempty"`      // path of the key of the client certificate
+}
+
+// Params returns the connection parameters besides host, port, user, password and database: the AdditionalParams
+// with the TLS settings applied, sslmode defaults to "disable".
+func (c DatabaseConfig) Params() map[string]string {
+	params := make(map[string]string, len(c.AdditionalParams)+4)
+	for param, value := range c.AdditionalParams {
+		params[param] = value
+	}
+
+	for param, value := range map[string]string{
+		"sslmode":     c.SSLMode,
+		"sslrootcert": c.SSLRootCert,
+		"sslcert":     c.SSLCert,
+		"sslkey":      c.SSLKey,
+	} {
+		if len(value) > 0 {
+			params[param] = value
+		}
+	}
+
+	if _, ok := params["sslmode"]; !ok {
+		params["sslmode"] = "disable"
+	}
+
+	return params
 }
 
 // Generates a connection string to be passed to sql.Open or equivalents, assuming Postgres syntax
@@ -20,21 +53,16 @@ func (c DatabaseConfig) ConnectionString() string {
 	var b strings.Builder
 	b.WriteString(fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s", c.Host, c.Port, c.Username, c.Password, c.Database))
 
-	if _, ok := c.AdditionalParams["sslmode"]; !ok {
-		b.WriteString(" sslmode=disable")
+	params := c.Params()
+	names := make([]string, 0, len(params))
+	for param := range params {
+		names = append(names, param)
 	}
 
-	if len(c.AdditionalParams) > 0 {
-		params := make([]string, 0, len(c.AdditionalParams))
-		for param := range c.AdditionalParams {
-			params = append(params, param)
-		}
-
-		sort.Strings(params)
+	sort.Strings(names)
 
-		for _, param := range params {
-			fmt.Fprintf(&b, " %s=%s", param, c.AdditionalParams[param])
-		}
+	for _, param := range names {
+		fmt.Fprintf(&b, " %s=%s", param, params[param])
 	}
 
 	return b.String()
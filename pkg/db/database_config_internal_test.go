@@ -57,6 +57,25 @@ func TestDatabaseConfigConnectionString(t *testing.T) {
 			},
 			want: "host=localhost port=5432 user=simple password=database_config dbname=simple_database_config connect_timeout=10 sslcert=/app/certs/pg.pem sslkey=/app/certs/pg.key sslmode=verify-full sslrootcert=/app/certs/pg_root.pem",
 		},
+		{
+			name: "TLS",
+			config: DatabaseConfig{
+				Host:     "localhost",
+				Port:     5432,
+				Username: "simple",
+				Password: "database_config",
+				Database: "simple_database_config",
+				AdditionalParams: map[string]string{
+					"connect_timeout": "10",
+					"sslmode":         "prefer",
+				},
+				SSLMode:     "verify-full",
+				SSLRootCert: "/app/certs/pg_root.pem",
+				SSLCert:     "/app/certs/pg.pem",
+				SSLKey:      "/app/certs/pg.key",
+			},
+			want: "host=localhost port=5432 user=simple password=database_config dbname=simple_database_config connect_timeout=10 sslcert=/app/certs/pg.pem sslkey=/app/certs/pg.key sslmode=verify-full sslrootcert=/app/certs/pg_root.pem",
+		},
 	}
 
 	for _, tt := range tests {
@@ -122,6 +141,19 @@ func TestDatabaseConfigMarshal(t *testing.T) {
 			},
 			want: "{\"host\":\"localhost\",\"port\":5432,\"username\":\"simple\",\"password\":\"database_config\",\"database\":\"simple_database_config\",\"additionalParams\":{\"connect_timeout\":\"10\",\"sslcert\":\"/app/certs/pg.pem\",\"sslkey\":\"/app/certs/pg.key\",\"sslmode\":\"verify-full\",\"sslrootcert\":\"/app/certs/pg_root.pem\"}}",
 		},
+		{
+			name: "TLS",
+			config: DatabaseConfig{
+				Host:        "localhost",
+				Port:        5432,
+				Username:    "simple",
+				Password:    "database_config",
+				Database:    "simple_database_config",
+				SSLMode:     "verify-full",
+				SSLRootCert: "/app/certs/pg_root.pem",
+			},
+			want: "{\"host\":\"localhost\",\"port\":5432,\"username\":\"simple\",\"password\":\"database_config\",\"database\":\"simple_database_config\",\"sslMode\":\"verify-full\",\"sslRootCert\":\"/app/certs/pg_root.pem\"}",
+		},
 	}
 
 	for _, tt := range tests {
@@ -0,0 +1,63 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// OpError records the operation and the template (or test database) an error occurred on. It matches the wrapped
+// error (e.g. pool.ErrTimeout) via errors.Is, the context is available via errors.As.
+type OpError struct {
+	Op     string `json:"op,omitempty"`     // e.g. "get_test_db"
+	Hash   string `json:"hash,omitempty"`   // hash of the template
+	DBName string `json:"dbName,omitempty"` // name of the template or test database, empty if unknown
+	Err    error  `json:"-"`
+}
+
+func (e *OpError) Error() string {
+	context := make([]string, 0, 2)
+	if len(e.Hash) > 0 {
+		context = append(context, "hash "+e.Hash)
+	}
+	if len(e.DBName) > 0 {
+		context = append(context, "database "+e.DBName)
+	}
+
+	if len(context) == 0 {
+		return fmt.Sprintf("%s: %v", e.Op, e.Err)
+	}
+
+	return fmt.Sprintf("%s (%s): %v", e.Op, strings.Join(context, ", "), e.Err)
+}
+
+func (e *OpError) Unwrap() error {
+	return e.Err
+}
+
+// WrapOp returns err wrapped into an OpError, nil if err is nil. An OpError passed as-is keeps its (innermost)
+// operation and is only completed by the missing fields, errors already wrapping one are returned unchanged.
+func WrapOp(err error, op string, hash string, dbName string) error {
+	if err == nil {
+		return nil
+	}
+
+	if opErr, ok := err.(*OpError); ok { //nolint:errorlint // only completing the outermost one
+		e := *opErr
+		if len(e.Hash) == 0 {
+			e.Hash = hash
+		}
+		if len(e.DBName) == 0 {
+			e.DBName = dbName
+		}
+
+		return &e
+	}
+
+	var opErr *OpError
+	if errors.As(err, &opErr) {
+		return err
+	}
+
+	return &OpError{Op: op, Hash: hash, DBName: dbName, Err: err}
+}
@@ -0,0 +1,46 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestWrapOp(t *testing.T) {
+	t.Parallel()
+
+	errSentinel := errors.New("test database not found")
+
+	if err := WrapOp(nil, "get_test_db", "hash", ""); err != nil {
+		t.Fatalf("WrapOp(nil) = %v, want nil", err)
+	}
+
+	err := WrapOp(errSentinel, "return_test_db", "hash", "integresql_test_hash_001")
+	if !errors.Is(err, errSentinel) {
+		t.Fatalf("errors.Is(%v, sentinel) = false", err)
+	}
+	if want := "return_test_db (hash hash, database integresql_test_hash_001): test database not found"; err.Error() != want {
+		t.Errorf("Error() = %q, want %q", err.Error(), want)
+	}
+
+	// completed by the missing fields, keeping the innermost operation
+	err = WrapOp(WrapOp(errSentinel, "drop_db", "", "integresql_test_hash_001"), "recreate_test_db", "hash", "other")
+
+	var opErr *OpError
+	if !errors.As(err, &opErr) {
+		t.Fatalf("errors.As(%v, *OpError) = false", err)
+	}
+	if opErr.Op != "drop_db" || opErr.Hash != "hash" || opErr.DBName != "integresql_test_hash_001" {
+		t.Errorf("OpError = %+v, want op drop_db, hash hash, database integresql_test_hash_001", *opErr)
+	}
+
+	// further wrapped ones are left as-is
+	wrapped := fmt.Errorf("retrying failed: %w", WrapOp(errSentinel, "drop_db", "", "integresql_test_hash_001"))
+	if err := WrapOp(wrapped, "recreate_test_db", "hash", ""); err != wrapped { //nolint:errorlint // identity
+		t.Errorf("WrapOp(wrapped) = %v, want it unchanged", err)
+	}
+
+	if err := WrapOp(errSentinel, "get_test_db", "", ""); err.Error() != "get_test_db: test database not found" {
+		t.Errorf("Error() = %q", err.Error())
+	}
+}
@@ -0,0 +1,121 @@
+package db
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// RewriteRule rewrites host and/or port of database configs handed out to clients, which e.g. reach
+// Postgres through a forwarded port or a different hostname (NAT) than the server itself.
+type RewriteRule struct {
+	FromHost string `json:"fromHost"` // empty or "*" matches all hosts
+	FromPort int    `json:"fromPort"` // 0 matches all ports
+	ToHost   string `json:"toHost"`   // empty keeps the host
+	ToPort   int    `json:"toPort"`   // 0 keeps the port
+}
+
+// RewriteRules are applied in order, the first matching rule wins.
+type RewriteRules []RewriteRule
+
+// ParseRewriteRule parses a rule in the format "fromHost[:fromPort]=toHost[:toPort]".
+// Use "*" as fromHost to match any host (e.g. "*:5432=localhost:15432") and omit toHost to only rewrite the port (e.g. "*=:15432").
+func ParseRewriteRule(rule string) (RewriteRule, error) {
+	from, to, found := strings.Cut(strings.TrimSpace(rule), "=")
+	if !found {
+		return RewriteRule{}, fmt.Errorf("invalid rewrite rule %q, expected fromHost[:fromPort]=toHost[:toPort]", rule)
+	}
+
+	fromHost, fromPort, err := splitRewriteHostPort(from)
+	if err != nil {
+		return RewriteRule{}, fmt.Errorf("invalid rewrite rule %q: %w", rule, err)
+	}
+
+	toHost, toPort, err := splitRewriteHostPort(to)
+	if err != nil {
+		return RewriteRule{}, fmt.Errorf("invalid rewrite rule %q: %w", rule, err)
+	}
+
+	if toHost == "*" {
+		return RewriteRule{}, fmt.Errorf("invalid rewrite rule %q: wildcard target host", rule)
+	}
+
+	if len(toHost) == 0 && toPort == 0 {
+		return RewriteRule{}, fmt.Errorf("invalid rewrite rule %q: empty target", rule)
+	}
+
+	return RewriteRule{
+		FromHost: fromHost,
+		FromPort: fromPort,
+		ToHost:   toHost,
+		ToPort:   toPort,
+	}, nil
+}
+
+// ParseNamespaceRewriteRule parses a rule only applying to the templates of a namespace in the format
+// "namespace@fromHost[:fromPort]=toHost[:toPort]" (e.g. "team-a@*:5432=pgbouncer-a:6432"), see ParseRewriteRule.
+func ParseNamespaceRewriteRule(rule string) (namespace string, _ RewriteRule, _ error) {
+	namespace, rest, found := strings.Cut(strings.TrimSpace(rule), "@")
+	if !found || len(namespace) == 0 {
+		return "", RewriteRule{}, fmt.Errorf("invalid namespace rewrite rule %q, expected namespace@fromHost[:fromPort]=toHost[:toPort]", rule)
+	}
+
+	parsed, err := ParseRewriteRule(rest)
+	if err != nil {
+		return "", RewriteRule{}, err
+	}
+
+	return namespace, parsed, nil
+}
+
+func splitRewriteHostPort(hostPort string) (host string, port int, err error) {
+	hostPort = strings.TrimSpace(hostPort)
+
+	// a port is only present if the value ends with ":<port>" (take care of IPv6 hosts like "[::1]:5432")
+	if !strings.Contains(hostPort, ":") || (strings.HasPrefix(hostPort, "[") && strings.HasSuffix(hostPort, "]")) {
+		return strings.Trim(hostPort, "[]"), 0, nil
+	}
+
+	host, portStr, err := net.SplitHostPort(hostPort)
+	if err != nil {
+		return "", 0, err
+	}
+
+	port, err = strconv.Atoi(portStr)
+	if err != nil || port < 1 || port > 65535 {
+		return "", 0, fmt.Errorf("invalid port %q", portStr)
+	}
+
+	return host, port, nil
+}
+
+// Matches returns true if the rule applies to the given config.
+func (r RewriteRule) Matches(config DatabaseConfig) bool {
+	if len(r.FromHost) > 0 && r.FromHost != "*" && !strings.EqualFold(r.FromHost, config.Host) {
+		return false
+	}
+
+	return r.FromPort == 0 || r.FromPort == config.Port
+}
+
+// Apply returns the config with the first matching rule applied (or unchanged if none matches).
+func (rules RewriteRules) Apply(config DatabaseConfig) DatabaseConfig {
+	for _, rule := range rules {
+		if !rule.Matches(config) {
+			continue
+		}
+
+		if len(rule.ToHost) > 0 {
+			config.Host = rule.ToHost
+		}
+
+		if rule.ToPort != 0 {
+			config.Port = rule.ToPort
+		}
+
+		return config
+	}
+
+	return config
+}
@@ -0,0 +1,100 @@
+package db
+
+import (
+	"testing"
+)
+
+func TestParseRewriteRule(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		rule    string
+		want    RewriteRule
+		wantErr bool
+	}{
+		{name: "HostAndPort", rule: "127.0.0.1:5432=localhost:15432", want: RewriteRule{FromHost: "127.0.0.1", FromPort: 5432, ToHost: "localhost", ToPort: 15432}},
+		{name: "HostOnly", rule: "postgres=db.example.com", want: RewriteRule{FromHost: "postgres", ToHost: "db.example.com"}},
+		{name: "WildcardPortOnly", rule: " *=:15432 ", want: RewriteRule{FromHost: "*", ToPort: 15432}},
+		{name: "WildcardHostWithPort", rule: "*:5432=localhost", want: RewriteRule{FromHost: "*", FromPort: 5432, ToHost: "localhost"}},
+		{name: "IPv6", rule: "[::1]:5432=[fe80::1]", want: RewriteRule{FromHost: "::1", FromPort: 5432, ToHost: "fe80::1"}},
+		{name: "MissingSeparator", rule: "localhost:5432", wantErr: true},
+		{name: "InvalidPort", rule: "localhost:port=localhost", wantErr: true},
+		{name: "PortOutOfRange", rule: "localhost=localhost:70000", wantErr: true},
+		{name: "EmptyTarget", rule: "localhost=", wantErr: true},
+		{name: "WildcardTarget", rule: "localhost=*", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := ParseRewriteRule(tt.rule)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("invalid error, got %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if got != tt.want {
+				t.Errorf("invalid rule, got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRewriteRulesApply(t *testing.T) {
+	t.Parallel()
+
+	rules := RewriteRules{
+		{FromHost: "127.0.0.1", FromPort: 5432, ToHost: "localhost", ToPort: 15432},
+		{FromHost: "postgres", ToHost: "db.example.com"},
+		{FromHost: "*", FromPort: 6432, ToPort: 16432},
+	}
+
+	tests := []struct {
+		name   string
+		config DatabaseConfig
+		want   DatabaseConfig
+	}{
+		{name: "HostAndPort", config: DatabaseConfig{Host: "127.0.0.1", Port: 5432, Database: "test"}, want: DatabaseConfig{Host: "localhost", Port: 15432, Database: "test"}},
+		{name: "HostOnlyCaseInsensitive", config: DatabaseConfig{Host: "Postgres", Port: 5432}, want: DatabaseConfig{Host: "db.example.com", Port: 5432}},
+		{name: "WildcardHost", config: DatabaseConfig{Host: "pgbouncer", Port: 6432}, want: DatabaseConfig{Host: "pgbouncer", Port: 16432}},
+		{name: "FirstMatchWins", config: DatabaseConfig{Host: "postgres", Port: 6432}, want: DatabaseConfig{Host: "db.example.com", Port: 6432}},
+		{name: "NoMatch", config: DatabaseConfig{Host: "127.0.0.1", Port: 5433}, want: DatabaseConfig{Host: "127.0.0.1", Port: 5433}},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got := rules.Apply(tt.config)
+			if got.ConnectionString() != tt.want.ConnectionString() {
+				t.Errorf("invalid config, got %q, want %q", got.ConnectionString(), tt.want.ConnectionString())
+			}
+		})
+	}
+}
+
+func TestParseNamespaceRewriteRule(t *testing.T) {
+	t.Parallel()
+
+	namespace, rule, err := ParseNamespaceRewriteRule(" team-a@*:5432=pgbouncer-a:6432 ")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if namespace != "team-a" {
+		t.Errorf("invalid namespace, got %q, want %q", namespace, "team-a")
+	}
+
+	if want := (RewriteRule{FromHost: "*", FromPort: 5432, ToHost: "pgbouncer-a", ToPort: 6432}); rule != want {
+		t.Errorf("invalid rule, got %+v, want %+v", rule, want)
+	}
+
+	for _, invalid := range []string{"*:5432=localhost", "@*:5432=localhost", "team-a@localhost"} {
+		if _, _, err := ParseNamespaceRewriteRule(invalid); err == nil {
+			t.Errorf("expected an error for %q", invalid)
+		}
+	}
+}
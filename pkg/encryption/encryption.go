@@ -0,0 +1,179 @@
+// Package encryption encrypts the state persisted by the manager (the template usage and schedule files, the template
+// options within the tracking schema) at rest with AES-256-GCM, as these often land on volumes shared by CI jobs.
+//
+// A Keyring holds one or more base64 (standard encoding) 32 byte keys. Data is always sealed with the first (primary)
+// key, but opened with whichever configured key it was sealed with (identified by the key ID within the envelope).
+// Keys are rotated by configuring the new key first followed by the old ones, the state is sealed with the new key on
+// its next save, afterwards the old keys may be removed.
+//
+// Data may be sealed for a scope (e.g. the namespace of a template, see SealScoped), which is authenticated along with
+// it: data of one scope can't be opened as the one of another scope, even if both share their keys.
+package encryption
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	ErrInvalidKey = errors.New("invalid encryption key")
+	ErrUnknownKey = errors.New("sealed with an unknown encryption key")
+	ErrOpen       = errors.New("unable to open sealed data")
+)
+
+const (
+	keySize = 32 // AES-256
+
+	// sealed data is "integresql-sealed-v1:<key ID>:<base64 of nonce and ciphertext>"
+	envelopePrefix = "integresql-sealed-v1:"
+)
+
+type key struct {
+	id   string
+	aead cipher.AEAD
+}
+
+// Keyring seals and opens data with its keys. A nil *Keyring is valid and keeps data in plaintext.
+type Keyring struct {
+	keys []key
+}
+
+// ParseKeyring parses the base64 (standard encoding) keys, the first one is the primary key. No keys return a nil
+// *Keyring (encryption disabled).
+func ParseKeyring(encoded []string) (*Keyring, error) {
+	if len(encoded) == 0 {
+		return nil, nil
+	}
+
+	k := &Keyring{keys: make([]key, 0, len(encoded))}
+
+	for i, e := range encoded {
+		raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(e))
+		if err != nil {
+			return nil, fmt.Errorf("%w: key %d: %v", ErrInvalidKey, i, err)
+		}
+
+		if len(raw) != keySize {
+			return nil, fmt.Errorf("%w: key %d must be %d bytes, got %d", ErrInvalidKey, i, keySize, len(raw))
+		}
+
+		block, err := aes.NewCipher(raw)
+		if err != nil {
+			return nil, fmt.Errorf("%w: key %d: %v", ErrInvalidKey, i, err)
+		}
+
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, fmt.Errorf("%w: key %d: %v", ErrInvalidKey, i, err)
+		}
+
+		k.keys = append(k.keys, key{id: keyID(raw), aead: aead})
+	}
+
+	return k, nil
+}
+
+// Enabled returns true if data is sealed.
+func (k *Keyring) Enabled() bool {
+	return k != nil && len(k.keys) > 0
+}
+
+// Seal encrypts the data with the primary key, without keys the data is returned as-is.
+func (k *Keyring) Seal(plaintext []byte) ([]byte, error) {
+	return k.SealScoped(plaintext, "")
+}
+
+// SealScoped encrypts the data for the scope with the primary key, it's only opened via OpenScoped with the same scope.
+// Without keys the data is returned as-is.
+func (k *Keyring) SealScoped(plaintext []byte, scope string) ([]byte, error) {
+	if !k.Enabled() {
+		return plaintext, nil
+	}
+
+	primary := k.keys[0]
+
+	nonce := make([]byte, primary.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	prefix := envelopePrefix + primary.id + ":"
+	sealed := primary.aead.Seal(nonce, nonce, plaintext, []byte(prefix+scope))
+
+	return []byte(prefix + base64.StdEncoding.EncodeToString(sealed)), nil
+}
+
+// Open decrypts the data sealed with any of the keys. Data that isn't sealed is returned as-is, thus the state persisted
+// before configuring the first key is still readable (and sealed on its next save).
+func (k *Keyring) Open(data []byte) ([]byte, error) {
+	return k.OpenScoped(data, "")
+}
+
+// OpenScoped decrypts the data sealed for the scope with any of the keys, data sealed for another scope fails with
+// ErrOpen. Data that isn't sealed is returned as-is.
+func (k *Keyring) OpenScoped(data []byte, scope string) ([]byte, error) {
+	if !IsSealed(data) {
+		return data, nil
+	}
+
+	id, encoded, ok := strings.Cut(strings.TrimPrefix(string(data), envelopePrefix), ":")
+	if !ok {
+		return nil, fmt.Errorf("%w: malformed envelope", ErrOpen)
+	}
+
+	var aead cipher.AEAD
+	if k != nil {
+		for _, key := range k.keys {
+			if key.id == id {
+				aead = key.aead
+				break
+			}
+		}
+	}
+
+	if aead == nil {
+		return nil, fmt.Errorf("%w %s", ErrUnknownKey, id)
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return nil, fmt.Errorf("%w: malformed envelope", ErrOpen)
+	}
+
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(envelopePrefix+id+":"+scope))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrOpen, err)
+	}
+
+	return plaintext, nil
+}
+
+// Current returns true if the data doesn't need to be sealed again: it's sealed with the primary key, or it's plaintext
+// and there are no keys.
+func (k *Keyring) Current(data []byte) bool {
+	if !k.Enabled() {
+		return !IsSealed(data)
+	}
+
+	return bytes.HasPrefix(data, []byte(envelopePrefix+k.keys[0].id+":"))
+}
+
+// IsSealed returns true if the data was sealed via Seal.
+func IsSealed(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(envelopePrefix))
+}
+
+// keyID identifies the key within the envelope without disclosing it.
+func keyID(raw []byte) string {
+	digest := sha256.Sum256(raw)
+
+	return hex.EncodeToString(digest[:4])
+}
@@ -0,0 +1,139 @@
+package encryption_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"testing"
+
+	"github.com/allaboutapps/integresql/pkg/encryption"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testKey(b byte) string {
+	return base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{b}, 32))
+}
+
+func TestParseKeyring(t *testing.T) {
+	keys, err := encryption.ParseKeyring(nil)
+	require.NoError(t, err)
+	assert.False(t, keys.Enabled())
+
+	keys, err = encryption.ParseKeyring([]string{testKey(1)})
+	require.NoError(t, err)
+	assert.True(t, keys.Enabled())
+
+	_, err = encryption.ParseKeyring([]string{"not base64!"})
+	assert.ErrorIs(t, err, encryption.ErrInvalidKey)
+
+	_, err = encryption.ParseKeyring([]string{testKey(1), base64.StdEncoding.EncodeToString([]byte("too short"))})
+	assert.ErrorIs(t, err, encryption.ErrInvalidKey)
+}
+
+func TestSealOpen(t *testing.T) {
+	keys, err := encryption.ParseKeyring([]string{testKey(1)})
+	require.NoError(t, err)
+
+	plaintext := []byte(`[{"hash":"0a1b","options":{"readyWebhook":"https://ci.example.com/hook?token=secret"}}]`)
+
+	sealed, err := keys.Seal(plaintext)
+	require.NoError(t, err)
+	assert.True(t, encryption.IsSealed(sealed))
+	assert.NotContains(t, string(sealed), "secret")
+	assert.True(t, keys.Current(sealed))
+
+	opened, err := keys.Open(sealed)
+	require.NoError(t, err)
+	assert.Equal(t, plaintext, opened)
+
+	// plaintext (persisted before configuring a key) is still readable, it's sealed on its next save
+	opened, err = keys.Open(plaintext)
+	require.NoError(t, err)
+	assert.Equal(t, plaintext, opened)
+	assert.False(t, keys.Current(plaintext))
+
+	// tampering is detected
+	tampered := append([]byte{}, sealed...)
+	tampered[len(tampered)-2] ^= 1
+	_, err = keys.Open(tampered)
+	assert.ErrorIs(t, err, encryption.ErrOpen)
+
+	// without keys, sealed data can't be opened and plaintext is kept
+	var disabled *encryption.Keyring
+	_, err = disabled.Open(sealed)
+	assert.ErrorIs(t, err, encryption.ErrUnknownKey)
+	assert.False(t, disabled.Current(sealed))
+
+	kept, err := disabled.Seal(plaintext)
+	require.NoError(t, err)
+	assert.Equal(t, plaintext, kept)
+	assert.True(t, disabled.Current(kept))
+}
+
+func TestSealScoped(t *testing.T) {
+	shared, err := encryption.ParseKeyring([]string{testKey(1)})
+	require.NoError(t, err)
+
+	sealed, err := shared.SealScoped([]byte("options of team-a"), "team-a")
+	require.NoError(t, err)
+
+	opened, err := shared.OpenScoped(sealed, "team-a")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("options of team-a"), opened)
+
+	// the scope is authenticated, even with the same key
+	_, err = shared.OpenScoped(sealed, "team-b")
+	assert.ErrorIs(t, err, encryption.ErrOpen)
+	_, err = shared.Open(sealed)
+	assert.ErrorIs(t, err, encryption.ErrOpen)
+
+	// nor opened with the key of another scope
+	teamB, err := encryption.ParseKeyring([]string{testKey(2)})
+	require.NoError(t, err)
+
+	_, err = teamB.OpenScoped(sealed, "team-a")
+	assert.ErrorIs(t, err, encryption.ErrUnknownKey)
+
+	// unscoped data is the same as the one of the empty scope
+	unscoped, err := shared.Seal([]byte("state"))
+	require.NoError(t, err)
+
+	opened, err = shared.OpenScoped(unscoped, "")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("state"), opened)
+}
+
+func TestKeyRotation(t *testing.T) {
+	old, err := encryption.ParseKeyring([]string{testKey(1)})
+	require.NoError(t, err)
+
+	sealed, err := old.Seal([]byte("state"))
+	require.NoError(t, err)
+
+	// the new key comes first, the old one is still able to open the state
+	rotated, err := encryption.ParseKeyring([]string{testKey(2), testKey(1)})
+	require.NoError(t, err)
+
+	opened, err := rotated.Open(sealed)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("state"), opened)
+	assert.False(t, rotated.Current(sealed))
+
+	resealed, err := rotated.Seal(opened)
+	require.NoError(t, err)
+	assert.True(t, rotated.Current(resealed))
+
+	// once the old key is removed, only the resealed state is readable
+	_, err = old.Open(resealed)
+	assert.ErrorIs(t, err, encryption.ErrUnknownKey)
+
+	current, err := encryption.ParseKeyring([]string{testKey(2)})
+	require.NoError(t, err)
+
+	_, err = current.Open(sealed)
+	assert.ErrorIs(t, err, encryption.ErrUnknownKey)
+
+	opened, err = current.Open(resealed)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("state"), opened)
+}
@@ -0,0 +1,101 @@
+package events
+
+import (
+	"sync"
+	"time"
+)
+
+// Type categorizes an event.
+type Type string
+
+const (
+	TypeCheckoutDurationExceeded   Type = "CHECKOUT_DURATION_EXCEEDED"   // a test database was checked out longer than the configured threshold
+	TypeEphemeralTemplateDiscarded Type = "EPHEMERAL_TEMPLATE_DISCARDED" // an ephemeral template was automatically discarded after being idle
+	TypeBackgroundTaskFailed       Type = "BACKGROUND_TASK_FAILED"       // a background task (e.g. recreating a test database) failed
+	TypeTestDatabaseUnhealthy      Type = "TEST_DATABASE_UNHEALTHY"      // a ready test database failed its health check and is recreated
+	TypePoolOverflow               Type = "POOL_OVERFLOW"                // the pool was exhausted, a temporary test database beyond its max size was created
+	TypeTemplateDrift              Type = "TEMPLATE_DRIFT"               // a finalized template was modified afterwards (its schema or row counts changed)
+	TypeRuntimeThresholdExceeded   Type = "RUNTIME_THRESHOLD_EXCEEDED"   // the Go runtime of the server exceeded a configured threshold (goroutines, heap, GC pause)
+	TypeCloneValidationFailed      Type = "CLONE_VALIDATION_FAILED"      // a (re)created test database failed a validation query of its template and doesn't enter the pool
+	TypeSoakInvariantViolated      Type = "SOAK_INVARIANT_VIOLATED"      // a test database was handed out again without being recreated (see SoakInvariantCheck)
+	TypeTemplateExported           Type = "TEMPLATE_EXPORTED"            // a finalized template was pushed to the registry as OCI artifact (see OCIExport)
+	TypeTemplateQuotaExceeded      Type = "TEMPLATE_QUOTA_EXCEEDED"      // initializing a template was rejected as its namespace reached MaxTemplatesPerNamespace
+	TypeStaleCheckout              Type = "STALE_CHECKOUT"               // a test database is still checked out beyond the alert threshold of its template without renewing its lease
+	TypeTemplateExpired            Type = "TEMPLATE_EXPIRED"             // a template was automatically discarded after its TTL
+	TypeLeaseExpired               Type = "LEASE_EXPIRED"                // the lease of a checked out test database expired, it's reclaimed (recreated and handed out again)
+	TypeScheduledTaskRun           Type = "SCHEDULED_TASK_RUN"           // a recurring admin task (see the scheduled tasks of the manager) was executed
+	TypeTemplateHashCollision      Type = "TEMPLATE_HASH_COLLISION"      // initializing a template was rejected as a different schema is tracked with the same (truncated) hash
+	TypeWaitStarvation             Type = "WAIT_STARVATION"              // a client waits for a ready test database far longer than the median waiting client (see WaitStarvationFactor)
+	TypeCircuitOpened              Type = "CIRCUIT_OPENED"               // (re)creating the test databases of a template failed repeatedly, acquisitions fail fast until a probe succeeds (see CircuitBreakerThreshold)
+	TypeCircuitClosed              Type = "CIRCUIT_CLOSED"               // a probe recreating a test database of a template with an open circuit breaker succeeded again
+	TypeTestDatabaseEvicted        Type = "TEST_DATABASE_EVICTED"        // a ready test database was dropped while shrinking its pool (idle eviction or resize), never checked out ones first
+	TypeTemplateShared             Type = "TEMPLATE_SHARED"              // a namespace initialized a template tracked by another namespace and shares it (see TemplateSharingNamespaces)
+)
+
+// Event describes a noteworthy occurrence within the manager or the pool (typically something an operator should know about).
+type Event struct {
+	Time    time.Time              `json:"time"`
+	Type    Type                   `json:"type"`
+	Hash    string                 `json:"hash,omitempty"`
+	Message string                 `json:"message"`
+	Fields  map[string]interface{} `json:"fields,omitempty"`
+}
+
+// Recorder keeps the most recent events in memory (ring buffer).
+// A nil *Recorder is valid and simply discards all events.
+type Recorder struct {
+	events []Event
+	next   int
+
+	mutex sync.RWMutex
+}
+
+// NewRecorder creates a new recorder keeping up to size events.
+func NewRecorder(size int) *Recorder {
+	if size < 1 {
+		size = 1
+	}
+
+	return &Recorder{
+		events: make([]Event, 0, size),
+	}
+}
+
+// Emit records the given event. If the time of the event is not set, the current time is used.
+func (r *Recorder) Emit(e Event) {
+	if r == nil {
+		return
+	}
+
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if len(r.events) < cap(r.events) {
+		r.events = append(r.events, e)
+	} else {
+		r.events[r.next] = e
+	}
+	r.next = (r.next + 1) % cap(r.events)
+}
+
+// Recent returns all currently kept events ordered from oldest to newest.
+func (r *Recorder) Recent() []Event {
+	if r == nil {
+		return []Event{}
+	}
+
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	res := make([]Event, 0, len(r.events))
+	if len(r.events) < cap(r.events) {
+		return append(res, r.events...)
+	}
+
+	res = append(res, r.events[r.next:]...)
+	return append(res, r.events[:r.next]...)
+}
@@ -0,0 +1,37 @@
+package events_test
+
+import (
+	"testing"
+
+	"github.com/allaboutapps/integresql/pkg/events"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecorder(t *testing.T) {
+	r := events.NewRecorder(3)
+	assert.Empty(t, r.Recent())
+
+	r.Emit(events.Event{Type: events.TypeCheckoutDurationExceeded, Message: "1"})
+	r.Emit(events.Event{Type: events.TypeCheckoutDurationExceeded, Message: "2"})
+
+	recent := r.Recent()
+	assert.Len(t, recent, 2)
+	assert.Equal(t, "1", recent[0].Message)
+	assert.False(t, recent[0].Time.IsZero())
+
+	// oldest events get overwritten
+	r.Emit(events.Event{Type: events.TypeCheckoutDurationExceeded, Message: "3"})
+	r.Emit(events.Event{Type: events.TypeCheckoutDurationExceeded, Message: "4"})
+
+	recent = r.Recent()
+	assert.Len(t, recent, 3)
+	assert.Equal(t, "2", recent[0].Message)
+	assert.Equal(t, "4", recent[2].Message)
+}
+
+func TestNilRecorder(t *testing.T) {
+	var r *events.Recorder
+
+	r.Emit(events.Event{Type: events.TypeCheckoutDurationExceeded})
+	assert.Empty(t, r.Recent())
+}
@@ -0,0 +1,92 @@
+package manager
+
+import (
+	"context"
+	"database/sql/driver"
+)
+
+// Advisory locks of IntegreSQL use the two-key variant, the first key namespaces them from locks of other applications
+// (prefixed with 0x4951, "IQ"), the second key is the hashtext of the locked name.
+const (
+	advisoryLockClassInstances int32 = 0x49510000 // held shared by all running instances, exclusively during the startup cleanup
+	advisoryLockClassTemplates int32 = 0x49510001 // held while creating the template database of a hash
+	advisoryLockClassDrops     int32 = 0x49510002 // held while dropping a database
+)
+
+// withAdvisoryLock runs fn while holding the session level advisory lock of the class and name, serializing it with the
+// same operation of other instances sharing the PostgreSQL server (see AdvisoryLocks). The lock is held by a dedicated
+// connection, fn may use any other connection.
+func (m Manager) withAdvisoryLock(ctx context.Context, class int32, name string, fn func() error) error {
+	if !m.config.AdvisoryLocks {
+		return fn()
+	}
+
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	// closing the connection releases the lock in any case (e.g. if unlocking fails)
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1, hashtext($2))", class, name); err != nil {
+		return err
+	}
+
+	fnErr := fn()
+
+	// unlock even if the ctx is done meanwhile, the connection is returned to the pool afterwards
+	if _, err := conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1, hashtext($2))", class, name); err != nil {
+		log := m.getManagerLogger(ctx, "withAdvisoryLock")
+		log.Warn().Err(err).Str("name", name).Msg("unable to release advisory lock")
+		_ = conn.Raw(func(interface{}) error { return driver.ErrBadConn }) // discards the connection, releasing the lock
+	}
+
+	return fnErr
+}
+
+// acquireInstanceLock registers the manager as a running instance (shared lock held until Disconnect) and returns true if
+// no other instance is running, i.e. the startup cleanup may drop the test databases of previous runs.
+func (m *Manager) acquireInstanceLock(ctx context.Context) (exclusive bool, err error) {
+	m.releaseInstanceLock()
+
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1, 0)", advisoryLockClassInstances).Scan(&exclusive); err != nil {
+		conn.Close()
+		return false, err
+	}
+
+	m.instanceLock = conn
+
+	return exclusive, nil
+}
+
+// downgradeInstanceLock switches the exclusive lock acquired by acquireInstanceLock to a shared one (blocking while
+// another instance runs its startup cleanup).
+func (m *Manager) downgradeInstanceLock(ctx context.Context, exclusive bool) error {
+	if _, err := m.instanceLock.ExecContext(ctx, "SELECT pg_advisory_lock_shared($1, 0)", advisoryLockClassInstances); err != nil {
+		return err
+	}
+
+	if !exclusive {
+		return nil
+	}
+
+	_, err := m.instanceLock.ExecContext(ctx, "SELECT pg_advisory_unlock($1, 0)", advisoryLockClassInstances)
+
+	return err
+}
+
+// releaseInstanceLock unregisters the manager as a running instance, closing the session releases its locks.
+func (m *Manager) releaseInstanceLock() {
+	if m.instanceLock == nil {
+		return
+	}
+
+	_ = m.instanceLock.Raw(func(interface{}) error { return driver.ErrBadConn }) // never reuse the session
+	m.instanceLock.Close()
+	m.instanceLock = nil
+}
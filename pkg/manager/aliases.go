@@ -0,0 +1,92 @@
+package manager
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/allaboutapps/integresql/pkg/templates"
+)
+
+// latestAliasPrefix prefixes the aliases automatically maintained for the LatestAliasMetadataKey, e.g. "latest:main".
+const latestAliasPrefix = "latest:"
+
+// aliasRegistry maps aliases to template hashes.
+type aliasRegistry struct {
+	aliases map[string]string // map[alias]hash
+	mutex   sync.RWMutex
+}
+
+func newAliasRegistry() *aliasRegistry {
+	return &aliasRegistry{aliases: make(map[string]string)}
+}
+
+// Resolve returns the hash the alias points to, anything not being a known alias is returned unchanged (typically a hash).
+func (r *aliasRegistry) Resolve(hashOrAlias string) string {
+	if !strings.HasPrefix(hashOrAlias, latestAliasPrefix) {
+		return hashOrAlias
+	}
+
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	if hash, ok := r.aliases[hashOrAlias]; ok {
+		return hash
+	}
+
+	return hashOrAlias
+}
+
+// Set points the alias to the hash, replacing any previous target.
+func (r *aliasRegistry) Set(alias string, hash string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.aliases[alias] = hash
+}
+
+// RemoveHash removes all aliases pointing to the hash.
+func (r *aliasRegistry) RemoveHash(hash string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for alias, h := range r.aliases {
+		if h == hash {
+			delete(r.aliases, alias)
+		}
+	}
+}
+
+// RemoveAll removes all aliases.
+func (r *aliasRegistry) RemoveAll() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.aliases = make(map[string]string)
+}
+
+// List returns a copy of all aliases.
+func (r *aliasRegistry) List() map[string]string {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	aliases := make(map[string]string, len(r.aliases))
+	for alias, hash := range r.aliases {
+		aliases[alias] = hash
+	}
+
+	return aliases
+}
+
+// updateLatestAlias points the "latest:<value>" alias to the just finalized template, if it carries the LatestAliasMetadataKey.
+func (m Manager) updateLatestAlias(hash string, options templates.TemplateOptions) {
+	if len(m.config.LatestAliasMetadataKey) == 0 {
+		return
+	}
+
+	value, ok := options.Metadata[m.config.LatestAliasMetadataKey]
+	if !ok || len(value) == 0 {
+		return
+	}
+
+	m.aliases.Set(latestAliasPrefix+value, hash)
+}
@@ -0,0 +1,76 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/allaboutapps/integresql/pkg/db"
+	"github.com/allaboutapps/integresql/pkg/templates"
+	"github.com/allaboutapps/integresql/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// number of attempts to initialize the template if the one joined was discarded meanwhile
+const bootstrapAttempts = 3
+
+// BootstrapTemplateDatabase makes sure a finalized template with the hash exists and returns its config, combining
+// InitializeTemplateDatabaseWithOptions and FinalizeTemplateDatabase for templates built from a source alone (a dump,
+// a source database, an existing database or an artifact of the registry). It's idempotent: Finalized templates are
+// returned as-is, templates currently initialized by another client are joined by waiting (up to the
+// TemplateFinalizeTimeout) until they are finalized.
+func (m Manager) BootstrapTemplateDatabase(ctx context.Context, hash string, options templates.TemplateOptions) (_ db.TemplateDatabase, err error) {
+	defer func() { err = m.wrapTemplateOp(err, "bootstrap_template_db", hash) }()
+
+	ctx, span := tracing.Start(ctx, "bootstrap_template_db", attribute.String("hash", hash))
+
+	log := m.getManagerLogger(ctx, "BootstrapTemplateDatabase").With().Str("hash", hash).Logger()
+
+	defer span.End()
+
+	if !m.Ready() {
+		log.Error().Msg("not ready")
+		return db.TemplateDatabase{}, ErrManagerNotReady
+	}
+
+	// empty templates are populated by the client, there's nothing to bootstrap them from
+	if options.Source() == templates.TemplateSourceEmpty {
+		return db.TemplateDatabase{}, fmt.Errorf("%w: bootstrapping requires a source (dump, database, existing or oci)", ErrInvalidTemplateOptions)
+	}
+
+	for attempt := 1; attempt <= bootstrapAttempts; attempt++ {
+		_, err := m.InitializeTemplateDatabaseWithOptions(ctx, hash, options)
+		if err != nil && !errors.Is(err, ErrTemplateAlreadyInitialized) {
+			return db.TemplateDatabase{}, err
+		}
+
+		if err == nil {
+			// restores and copies are complete, there's nothing left to populate
+			if _, err := m.FinalizeTemplateDatabase(ctx, hash); err != nil && !errors.Is(err, ErrTemplateAlreadyInitialized) {
+				return db.TemplateDatabase{}, err
+			}
+
+			log.Info().Str("source", string(options.Source())).Msg("template bootstrapped")
+		}
+
+		template, found := m.templates.Get(ctx, hash)
+		if !found {
+			// discarded meanwhile, initialize it again
+			log.Debug().Int("attempt", attempt).Msg("joined template vanished, retrying...")
+			continue
+		}
+
+		if err := m.waitUntilFinalized(ctx, template); err != nil {
+			if template.GetState(ctx) == templates.TemplateStateDiscarded {
+				log.Debug().Int("attempt", attempt).Msg("joined template was discarded, retrying...")
+				continue
+			}
+
+			return db.TemplateDatabase{}, err
+		}
+
+		return db.TemplateDatabase{Database: m.rewriteDatabase(template.Database, template.GetConfig(ctx).Options.Namespace)}, nil
+	}
+
+	return db.TemplateDatabase{}, ErrTemplateDiscarded
+}
@@ -0,0 +1,204 @@
+package manager
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// Dimensions of the capacity of the backend, see Capacity.Bottleneck.
+const (
+	CapacityConnections = "connections"
+	CapacityDisk        = "disk"
+	CapacityDatabases   = "databases"
+)
+
+// number of templates listed within Capacity.TopTemplates
+const capacityTopTemplates = 5
+
+// Capacity rolls up the resource use of all templates and estimates the headroom of the backend, answering whether
+// another team (template) fits into the instance.
+type Capacity struct {
+	Templates     int `json:"templates"`     // managed template databases
+	TestDatabases int `json:"testDatabases"` // managed test databases of all templates
+
+	Connections        int `json:"connections"`        // client backends of the server (all databases)
+	ManagedConnections int `json:"managedConnections"` // connections to managed databases
+	MaxConnections     int `json:"maxConnections"`     // max_connections minus superuser_reserved_connections
+
+	DiskBytes        int64 `json:"diskBytes"`        // size of all databases of the server
+	ManagedDiskBytes int64 `json:"managedDiskBytes"` // size of all managed databases
+	DiskLimitBytes   int64 `json:"diskLimitBytes"`   // see CapacityDiskLimitBytes, 0 if unknown
+
+	MaxDatabases int `json:"maxDatabases"` // see CapacityMaxDatabases, 0 if unlimited
+
+	// estimated test database (re)creations per second of a single pool: MaxParallelTasks / mean DDL latency, 0 without samples
+	CreatesPerSecond float64 `json:"createsPerSecond"`
+
+	// remaining share (0..1) of the most utilized dimension and that dimension (connections, disk or databases)
+	Headroom   float64 `json:"headroom"`
+	Bottleneck string  `json:"bottleneck"`
+
+	// estimated number of additional templates (of average resource use) fitting into the remaining capacity, nil
+	// without any template to estimate from
+	AddableTemplates *int `json:"addableTemplates"`
+
+	TopTemplates []TemplateUsage `json:"topTemplates"` // by managed disk bytes (descending)
+}
+
+// TemplateUsage is the resource use of a template including all of its test databases.
+type TemplateUsage struct {
+	Hash          string `json:"hash"`
+	TestDatabases int    `json:"testDatabases"`
+	Connections   int    `json:"connections"`
+	DiskBytes     int64  `json:"diskBytes"`
+}
+
+// Capacity queries the resource use of all managed databases and the limits of the backend.
+func (m Manager) Capacity(ctx context.Context) (Capacity, error) {
+
+	if !m.Ready() {
+		return Capacity{}, ErrManagerNotReady
+	}
+
+	capacity := Capacity{
+		DiskLimitBytes: m.config.CapacityDiskLimitBytes,
+		MaxDatabases:   m.config.CapacityMaxDatabases,
+		TopTemplates:   []TemplateUsage{},
+	}
+
+	if err := m.db.QueryRowContext(ctx, `SELECT current_setting('max_connections')::int - current_setting('superuser_reserved_connections')::int,
+		(SELECT count(*) FROM pg_stat_activity WHERE backend_type = 'client backend'),
+		(SELECT coalesce(sum(pg_database_size(datname)), 0)::bigint FROM pg_database WHERE datallowconn)`).Scan(&capacity.MaxConnections, &capacity.Connections, &capacity.DiskBytes); err != nil {
+		return capacity, fmt.Errorf("failed to query the limits of the server: %w", err)
+	}
+
+	// '_' and '%' are wildcards within LIKE patterns, we want to match the prefixes literally
+	escape := strings.NewReplacer(`\`, `\\`, "_", `\_`, "%", `\%`)
+	templatePrefix := m.makeTemplateDatabaseName("")
+	testPrefix := m.config.PoolConfig.TestDBNamePrefix
+
+	rows, err := m.db.QueryContext(ctx, `SELECT d.datname, pg_database_size(d.datname), (SELECT count(*) FROM pg_stat_activity a WHERE a.datname = d.datname)
+		FROM pg_database d WHERE d.datallowconn AND (d.datname LIKE $1 OR d.datname LIKE $2)`, escape.Replace(templatePrefix)+"%", escape.Replace(testPrefix)+"%")
+	if err != nil {
+		return capacity, fmt.Errorf("failed to query the managed databases: %w", err)
+	}
+	defer rows.Close()
+
+	usages := make(map[string]*TemplateUsage)
+	usage := func(hash string) *TemplateUsage {
+		if _, ok := usages[hash]; !ok {
+			usages[hash] = &TemplateUsage{Hash: hash}
+		}
+		return usages[hash]
+	}
+
+	for rows.Next() {
+		var dbName string
+		var size int64
+		var connections int
+		if err := rows.Scan(&dbName, &size, &connections); err != nil {
+			return capacity, err
+		}
+
+		var u *TemplateUsage
+		if hash, _, ok := splitTestDatabaseName(testPrefix, dbName); ok {
+			u = usage(hash)
+			u.TestDatabases++
+			capacity.TestDatabases++
+		} else if strings.HasPrefix(dbName, templatePrefix) {
+			u = usage(strings.TrimPrefix(dbName, templatePrefix))
+			capacity.Templates++
+		} else {
+			continue
+		}
+
+		u.DiskBytes += size
+		u.Connections += connections
+		capacity.ManagedConnections += connections
+		capacity.ManagedDiskBytes += size
+	}
+
+	if err := rows.Err(); err != nil {
+		return capacity, err
+	}
+
+	for _, u := range usages {
+		capacity.TopTemplates = append(capacity.TopTemplates, *u)
+	}
+
+	sort.Slice(capacity.TopTemplates, func(i, j int) bool {
+		if capacity.TopTemplates[i].DiskBytes != capacity.TopTemplates[j].DiskBytes {
+			return capacity.TopTemplates[i].DiskBytes > capacity.TopTemplates[j].DiskBytes
+		}
+		return capacity.TopTemplates[i].Hash < capacity.TopTemplates[j].Hash
+	})
+
+	if len(capacity.TopTemplates) > capacityTopTemplates {
+		capacity.TopTemplates = capacity.TopTemplates[:capacityTopTemplates]
+	}
+
+	capacity.CreatesPerSecond = m.createsPerSecond(ctx)
+	capacity.estimateHeadroom(len(usages))
+
+	return capacity, nil
+}
+
+// createsPerSecond estimates the recreations per second of a single pool from the mean DDL latency of all pools.
+func (m Manager) createsPerSecond(ctx context.Context) float64 {
+	var count int
+	var totalMs float64
+	for _, stats := range m.pool.Stats(ctx) {
+		count += stats.Latencies.DDL.Count
+		totalMs += stats.Latencies.DDL.MeanMs * float64(stats.Latencies.DDL.Count)
+	}
+
+	if count == 0 || totalMs <= 0 {
+		return 0
+	}
+
+	return float64(m.config.PoolConfig.MaxParallelTasks) * 1000 / (totalMs / float64(count))
+}
+
+// estimateHeadroom computes the headroom of the most utilized dimension and the number of additional templates
+// fitting into it, based on the average use of the given number of templates.
+func (c *Capacity) estimateHeadroom(templates int) {
+	type dimension struct {
+		name        string
+		used, limit float64
+		perTemplate float64 // average use of a template
+	}
+
+	dimensions := []dimension{}
+	if c.MaxConnections > 0 {
+		dimensions = append(dimensions, dimension{CapacityConnections, float64(c.Connections), float64(c.MaxConnections), float64(c.ManagedConnections)})
+	}
+	if c.DiskLimitBytes > 0 {
+		dimensions = append(dimensions, dimension{CapacityDisk, float64(c.DiskBytes), float64(c.DiskLimitBytes), float64(c.ManagedDiskBytes)})
+	}
+	if c.MaxDatabases > 0 {
+		dimensions = append(dimensions, dimension{CapacityDatabases, float64(c.Templates + c.TestDatabases), float64(c.MaxDatabases), float64(c.Templates + c.TestDatabases)})
+	}
+
+	c.Headroom = 1
+	for _, d := range dimensions {
+		headroom := math.Max(0, 1-d.used/d.limit)
+		if len(c.Bottleneck) == 0 || headroom < c.Headroom {
+			c.Headroom = headroom
+			c.Bottleneck = d.name
+		}
+
+		if templates == 0 {
+			continue
+		}
+
+		if perTemplate := d.perTemplate / float64(templates); perTemplate > 0 {
+			addable := int(math.Max(0, d.limit-d.used) / perTemplate)
+			if c.AddableTemplates == nil || addable < *c.AddableTemplates {
+				c.AddableTemplates = &addable
+			}
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package manager
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+
+	"github.com/allaboutapps/integresql/pkg/db"
+	"github.com/allaboutapps/integresql/pkg/templates"
+)
+
+// cloneOptions are the per template options of creating its databases, see TemplateOptions.Tablespace,
+// TemplateOptions.CloneTablespace and TemplateOptions.CloneSettings.
+type cloneOptions struct {
+	tablespace string            // CREATE DATABASE ... TABLESPACE, empty inherits the one of the template
+	settings   map[string]string // settings of the sessions creating, scripting and validating the database
+}
+
+type cloneOptionsKey struct{}
+
+// withCloneOptions returns a ctx creating databases (see execCreateDatabase) with the options.
+func withCloneOptions(ctx context.Context, options cloneOptions) context.Context {
+	return context.WithValue(ctx, cloneOptionsKey{}, options)
+}
+
+// cloneOptionsFrom returns the options set via withCloneOptions.
+func cloneOptionsFrom(ctx context.Context) cloneOptions {
+	options, _ := ctx.Value(cloneOptionsKey{}).(cloneOptions)
+	return options
+}
+
+// templateCloneOptions returns the options of creating the template database (and its replicas).
+func templateCloneOptions(options templates.TemplateOptions) cloneOptions {
+	return cloneOptions{tablespace: options.Tablespace, settings: options.CloneSettings}
+}
+
+// testDatabaseCloneOptions returns the options of (re)creating the test databases of the template.
+func testDatabaseCloneOptions(options templates.TemplateOptions) cloneOptions {
+	tablespace := options.CloneTablespace
+	if len(tablespace) == 0 {
+		// explicitly, copies of the template on further shards are created in the default tablespace
+		tablespace = options.Tablespace
+	}
+
+	return cloneOptions{tablespace: tablespace, settings: options.CloneSettings}
+}
+
+// cloneSettingValueRegexp matches the values passed as runtime parameters within the connection string.
+var cloneSettingValueRegexp = regexp.MustCompile(`^[A-Za-z0-9_.:+-]+$`)
+
+// validateCloneOptions rejects tablespaces not existing on the target and invalid clone settings.
+func (m Manager) validateCloneOptions(ctx context.Context, options templates.TemplateOptions) error {
+	if len(options.Tablespace) == 0 && len(options.CloneTablespace) == 0 && len(options.CloneSettings) == 0 {
+		return nil
+	}
+
+	// validated by validateEngineOptions for other engines
+	if m.config.Engine != EnginePostgres {
+		return nil
+	}
+
+	if len(m.config.DDLFunctions.CreateDatabase) > 0 {
+		return fmt.Errorf("%w: tablespaces and clone settings are not supported with DDL functions", ErrInvalidTemplateOptions)
+	}
+
+	if len(options.Tablespace) > 0 && options.Source() == templates.TemplateSourceExisting {
+		return fmt.Errorf("%w: adopted databases keep their tablespace", ErrInvalidTemplateOptions)
+	}
+
+	for _, tablespace := range []string{options.Tablespace, options.CloneTablespace} {
+		if len(tablespace) == 0 {
+			continue
+		}
+
+		var exists bool
+		if err := m.db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM pg_tablespace WHERE spcname = $1)", tablespace).Scan(&exists); err != nil {
+			return err
+		}
+
+		if !exists {
+			return fmt.Errorf("%w: tablespace %q does not exist", ErrInvalidTemplateOptions, tablespace)
+		}
+	}
+
+	if len(options.CloneSettings) == 0 {
+		return nil
+	}
+
+	for name, value := range options.CloneSettings {
+		if !settingNameRegexp.MatchString(name) {
+			return fmt.Errorf("%w: invalid clone setting name %q", ErrInvalidTemplateOptions, name)
+		}
+
+		if !cloneSettingValueRegexp.MatchString(value) {
+			return fmt.Errorf("%w: invalid value of clone setting %s", ErrInvalidTemplateOptions, name)
+		}
+	}
+
+	// unknown settings and invalid values are rejected by the server while connecting
+	conn, err := sql.Open("postgres", cloneSessionConfig(m.config.TargetDatabaseConfig, options.CloneSettings).ConnectionString())
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if err := conn.PingContext(ctx); err != nil {
+		return fmt.Errorf("%w: invalid clone settings: %v", ErrInvalidTemplateOptions, err)
+	}
+
+	return nil
+}
+
+// cloneSessionConfig returns the config of sessions with the settings, passed as runtime parameters while connecting.
+func cloneSessionConfig(config db.DatabaseConfig, settings map[string]string) db.DatabaseConfig {
+	if len(settings) == 0 {
+		return config
+	}
+
+	params := make(map[string]string, len(config.AdditionalParams)+len(settings))
+	for param, value := range config.AdditionalParams {
+		params[param] = value
+	}
+	for name, value := range settings {
+		params[name] = value
+	}
+	config.AdditionalParams = params
+
+	return config
+}
+
+// createDatabaseWithOptions creates the database in the tablespace within a session with the settings of the options.
+func (m Manager) createDatabaseWithOptions(ctx context.Context, dbName string, owner string, template string, options cloneOptions) error {
+	conn := m.db
+	if len(options.settings) > 0 {
+		session, err := sql.Open("postgres", cloneSessionConfig(m.config.TargetDatabaseConfig, options.settings).ConnectionString())
+		if err != nil {
+			return err
+		}
+		defer session.Close()
+
+		conn = session
+	}
+
+	return createPostgresDatabase(ctx, conn, dbName, owner, template, options.tablespace)
+}
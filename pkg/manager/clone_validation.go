@@ -0,0 +1,110 @@
+package manager
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/allaboutapps/integresql/pkg/db"
+	"github.com/allaboutapps/integresql/pkg/events"
+	"github.com/allaboutapps/integresql/pkg/tracing"
+)
+
+var ErrCloneValidationFailed = errors.New("test database failed its validation")
+
+// validateClone runs the validation queries of the template (see TemplateOptions.ValidationQueries) within the just
+// (re)created test database, an error keeps it from entering the ready set.
+func (m Manager) validateClone(ctx context.Context, testDB db.TestDatabase, queries []string) error {
+
+	defer tracing.Region(ctx, "validate_clone").End()
+
+	log := m.getManagerLogger(ctx, "validateClone").With().Str("dbName", testDB.Config.Database).Logger()
+
+	conn, err := sql.Open("postgres", cloneSessionConfig(testDB.Config, cloneOptionsFrom(ctx).settings).ConnectionString())
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	for i, query := range queries {
+		if err := runValidationQuery(ctx, conn, query); err != nil {
+			err = fmt.Errorf("%w: query %d: %v", ErrCloneValidationFailed, i, err)
+			log.Error().Err(err).Msg("validation failed")
+
+			m.events.Emit(events.Event{
+				Type:    events.TypeCloneValidationFailed,
+				Hash:    testDB.TemplateHash,
+				Message: fmt.Sprintf("test database %s failed validation query %d, it doesn't enter the pool", testDB.Config.Database, i),
+				Fields: map[string]interface{}{
+					"id":    testDB.ID,
+					"query": i,
+					"error": err.Error(),
+				},
+			})
+
+			return err
+		}
+	}
+
+	log.Trace().Int("queries", len(queries)).Msg("validated")
+
+	return nil
+}
+
+// runValidationQuery fails if the query errors or any row reports a failure in its first column: false or a
+// "not ok" TAP line (e.g. of a pgTAP suite via SELECT * FROM runtests()).
+func runValidationQuery(ctx context.Context, conn *sql.DB, query string) error {
+	rows, err := conn.QueryContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+
+	values := make([]interface{}, len(columns))
+	for i := range values {
+		values[i] = new(interface{})
+	}
+
+	failures := make([]string, 0)
+	for rows.Next() {
+		if err := rows.Scan(values...); err != nil {
+			return err
+		}
+
+		if len(values) == 0 {
+			continue
+		}
+
+		switch v := (*values[0].(*interface{})).(type) {
+		case bool:
+			if !v {
+				failures = append(failures, "false")
+			}
+		case []byte:
+			if line := string(v); strings.HasPrefix(strings.TrimSpace(line), "not ok") {
+				failures = append(failures, line)
+			}
+		case string:
+			if strings.HasPrefix(strings.TrimSpace(v), "not ok") {
+				failures = append(failures, v)
+			}
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if len(failures) > 0 {
+		return errors.New(strings.Join(failures, "; "))
+	}
+
+	return nil
+}
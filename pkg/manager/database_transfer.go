@@ -0,0 +1,103 @@
+package manager
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/allaboutapps/integresql/pkg/db"
+	"github.com/allaboutapps/integresql/pkg/tracing"
+)
+
+// transferDatabase copies the schema and data of the source database into the (already existing and empty) target database
+// by piping pg_dump into pg_restore. Source and target may reside on different clusters (e.g. a readonly standby as source).
+// restoreArgs are passed to pg_restore additionally (e.g. --role).
+func (m Manager) transferDatabase(ctx context.Context, source db.DatabaseConfig, target db.DatabaseConfig, restoreArgs ...string) error {
+
+	defer tracing.Region(ctx, "transfer_db").End()
+
+	log := m.getManagerLogger(ctx, "transferDatabase").With().Str("source", source.Database).Str("target", target.Database).Logger()
+	log.Debug().Msg("transferring...")
+
+	// owners and privileges of the source cluster typically don't exist on the target cluster
+	dump := exec.CommandContext(ctx, m.config.PgDumpPath, append(pgToolConnectionArgs(source), "--format=custom", "--no-owner", "--no-acl")...) // #nosec G204 - binary path is provided via config
+	dump.Env = pgToolEnv(source)
+
+	restore := exec.CommandContext(ctx, m.config.PgRestorePath, append(append(pgToolConnectionArgs(target), "--no-owner", "--no-acl", "--exit-on-error"), restoreArgs...)...) // #nosec G204 - binary path is provided via config
+	restore.Env = pgToolEnv(target)
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+
+	var dumpStderr, restoreStderr bytes.Buffer
+	dump.Stdout = w
+	dump.Stderr = &dumpStderr
+	restore.Stdin = r
+	restore.Stderr = &restoreStderr
+
+	if err := restore.Start(); err != nil {
+		r.Close()
+		w.Close()
+		return fmt.Errorf("failed to start pg_restore: %w", err)
+	}
+
+	if err := dump.Start(); err != nil {
+		r.Close()
+		w.Close()
+		_ = restore.Wait()
+		return fmt.Errorf("failed to start pg_dump: %w", err)
+	}
+
+	// both processes hold their own copies of the pipe now
+	r.Close()
+	w.Close()
+
+	dumpErr := dump.Wait()
+	restoreErr := restore.Wait()
+
+	if dumpErr != nil {
+		log.Error().Err(dumpErr).Str("stderr", dumpStderr.String()).Msg("pg_dump failed")
+		return fmt.Errorf("pg_dump failed: %w: %s", dumpErr, strings.TrimSpace(dumpStderr.String()))
+	}
+
+	if restoreErr != nil {
+		log.Error().Err(restoreErr).Str("stderr", restoreStderr.String()).Msg("pg_restore failed")
+		return fmt.Errorf("pg_restore failed: %w: %s", restoreErr, strings.TrimSpace(restoreStderr.String()))
+	}
+
+	log.Debug().Msg("transferred.")
+
+	return nil
+}
+
+// pgToolConnectionArgs returns the connection arguments for pg_dump/pg_restore (the password is passed via env).
+func pgToolConnectionArgs(config db.DatabaseConfig) []string {
+	return []string{
+		"--host", config.Host,
+		"--port", fmt.Sprintf("%d", config.Port),
+		"--username", config.Username,
+		"--dbname", config.Database,
+		"--no-password",
+	}
+}
+
+// pgToolEnv passes sensitive and additional connection params to pg_dump/pg_restore via the libpq environment variables.
+func pgToolEnv(config db.DatabaseConfig) []string {
+	env := append(os.Environ(), fmt.Sprintf("PGPASSWORD=%s", config.Password))
+
+	params := config.Params()
+	env = append(env, fmt.Sprintf("PGSSLMODE=%s", params["sslmode"]))
+
+	for param, variable := range map[string]string{"sslrootcert": "PGSSLROOTCERT", "sslcert": "PGSSLCERT", "sslkey": "PGSSLKEY"} {
+		if value, ok := params[param]; ok {
+			env = append(env, fmt.Sprintf("%s=%s", variable, value))
+		}
+	}
+
+	return env
+}
@@ -0,0 +1,50 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+)
+
+var ErrInvalidDDLFunction = errors.New("invalid DDL function")
+
+// ddlFunctionNameRegexp matches plain and schema qualified (e.g. "dba.create_database") function names.
+var ddlFunctionNameRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?$`)
+
+// DDLFunctions are optional SQL functions (e.g. audited SECURITY DEFINER ones maintained by DBAs) executing the
+// database DDL on behalf of the manager role, which doesn't require CREATEDB then. Unset ones fall back to raw DDL.
+// CREATE/DROP DATABASE can't run within a function (transaction block), they typically execute it via dblink_exec.
+type DDLFunctions struct {
+	CreateDatabase string // SELECT <fn>(name, owner, template)
+	DropDatabase   string // SELECT <fn>(name), must ignore absent databases (like DROP DATABASE IF EXISTS)
+	RenameDatabase string // SELECT <fn>(from, to)
+}
+
+func (f DDLFunctions) validate() error {
+	for kind, name := range map[string]string{"create": f.CreateDatabase, "drop": f.DropDatabase, "rename": f.RenameDatabase} {
+		if len(name) > 0 && !ddlFunctionNameRegexp.MatchString(name) {
+			return fmt.Errorf("%w: %s function name %q", ErrInvalidDDLFunction, kind, name)
+		}
+	}
+
+	return nil
+}
+
+// callDDLFunction calls the DDL function with the given arguments, its name was validated while connecting.
+func (m Manager) callDDLFunction(ctx context.Context, function string, args ...interface{}) error {
+	placeholders := ""
+	for i := range args {
+		if i > 0 {
+			placeholders += ", "
+		}
+		placeholders += fmt.Sprintf("$%d", i+1)
+	}
+
+	// the result (typically void) is discarded, errors raised by the function are passed through
+	if _, err := m.db.ExecContext(ctx, fmt.Sprintf("SELECT %s(%s)", function, placeholders), args...); err != nil {
+		return fmt.Errorf("%s failed: %w", function, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,50 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var ErrDeadlineExceeded = errors.New("client deadline exceeded")
+
+type deadlineHintKey struct{}
+
+// WithDeadlineHint returns a context carrying the deadline of the client (e.g. the remaining timeout of its test).
+// All waits of the manager (template finalization, ready test databases) are capped to this deadline (minus the
+// configured DeadlineHintMargin) and fail with ErrDeadlineExceeded, so the client receives a precise error
+// before it runs into its own timeout.
+func WithDeadlineHint(ctx context.Context, deadline time.Time) context.Context {
+	return context.WithValue(ctx, deadlineHintKey{}, deadline)
+}
+
+// DeadlineHint returns the client deadline set via WithDeadlineHint.
+func DeadlineHint(ctx context.Context) (time.Time, bool) {
+	deadline, ok := ctx.Value(deadlineHintKey{}).(time.Time)
+	return deadline, ok
+}
+
+// waitTimeout caps the given timeout to the client deadline of ctx (if any).
+// Returns true if the client deadline is the effective limit.
+func (m Manager) waitTimeout(ctx context.Context, timeout time.Duration) (time.Duration, bool) {
+	deadline, ok := DeadlineHint(ctx)
+	if !ok {
+		return timeout, false
+	}
+
+	remaining := time.Until(deadline) - m.config.DeadlineHintMargin
+	if remaining >= timeout {
+		return timeout, false
+	}
+
+	if remaining < 0 {
+		remaining = 0
+	}
+
+	return remaining, true
+}
+
+func deadlineExceeded(waitingFor string, waited time.Duration) error {
+	return fmt.Errorf("%w: gave up waiting for %s after %s", ErrDeadlineExceeded, waitingFor, waited.Round(time.Millisecond))
+}
@@ -0,0 +1,91 @@
+package manager
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Diagnostics is a snapshot of the manager's config (sensitive fields are excluded via their json tags) and the backend
+// statistics of all managed databases, typically attached to bug reports.
+type Diagnostics struct {
+	Config         ManagerConfig            `json:"config"`
+	PgStatActivity []map[string]interface{} `json:"pgStatActivity"`
+	PgStatDatabase []map[string]interface{} `json:"pgStatDatabase"`
+}
+
+// Diagnostics snapshots pg_stat_activity and pg_stat_database of all managed (template and test) databases.
+func (m Manager) Diagnostics(ctx context.Context) (Diagnostics, error) {
+
+	if !m.Ready() {
+		return Diagnostics{}, ErrManagerNotReady
+	}
+
+	diagnostics := Diagnostics{Config: m.config}
+
+	// '_' and '%' are wildcards within LIKE patterns, we want to match the prefixes literally
+	escape := strings.NewReplacer(`\`, `\\`, "_", `\_`, "%", `\%`)
+	templatePattern := escape.Replace(m.makeTemplateDatabaseName("")) + "%"
+	testPattern := escape.Replace(m.config.PoolConfig.TestDBNamePrefix) + "%"
+
+	var err error
+	diagnostics.PgStatActivity, err = m.queryMaps(ctx, `SELECT datname, pid, usename, application_name, client_addr::text, state, wait_event_type, wait_event,
+		backend_start, xact_start, query_start, state_change, left(query, 1024) AS query
+		FROM pg_stat_activity WHERE datname LIKE $1 OR datname LIKE $2 ORDER BY datname, pid`, templatePattern, testPattern)
+	if err != nil {
+		return diagnostics, fmt.Errorf("failed to query pg_stat_activity: %w", err)
+	}
+
+	diagnostics.PgStatDatabase, err = m.queryMaps(ctx, `SELECT datname, numbackends, xact_commit, xact_rollback, blks_read, blks_hit,
+		temp_files, temp_bytes, deadlocks, stats_reset
+		FROM pg_stat_database WHERE datname LIKE $1 OR datname LIKE $2 ORDER BY datname`, templatePattern, testPattern)
+	if err != nil {
+		return diagnostics, fmt.Errorf("failed to query pg_stat_database: %w", err)
+	}
+
+	return diagnostics, nil
+}
+
+// queryMaps returns each row as map of column name to value.
+func (m Manager) queryMaps(ctx context.Context, query string, args ...interface{}) ([]map[string]interface{}, error) {
+	rows, err := m.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]map[string]interface{}, 0)
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		for i := range values {
+			values[i] = new(interface{})
+		}
+
+		if err := rows.Scan(values...); err != nil {
+			return nil, err
+		}
+
+		row := make(map[string]interface{}, len(columns))
+		for i, column := range columns {
+			row[column] = diagnosticsValue(*(values[i].(*interface{})))
+		}
+
+		result = append(result, row)
+	}
+
+	return result, rows.Err()
+}
+
+// diagnosticsValue converts driver values into JSON friendly ones (e.g. text columns scanned as []byte).
+func diagnosticsValue(value interface{}) interface{} {
+	if v, ok := value.([]byte); ok {
+		return string(v)
+	}
+
+	return value
+}
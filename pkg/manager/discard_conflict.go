@@ -0,0 +1,140 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/allaboutapps/integresql/pkg/pool"
+)
+
+const (
+	TemplateBlockerClone      = "clone"      // CREATE DATABASE ... TEMPLATE of the template in progress
+	TemplateBlockerConnection = "connection" // client connected to the template database
+
+	// max length of the query reported of a TemplateBlocker
+	templateBlockerQueryLength = 256
+
+	// backoff between dropping the template again while waiting for its blockers, doubled up to templateDiscardMaxBackoff
+	templateDiscardBackoff    = 10 * time.Millisecond
+	templateDiscardMaxBackoff = time.Second
+)
+
+// templateBlockersQuery lists the backends blocking dropping the template database: backends connected to it and
+// backends holding a lock on it, e.g. cloning it via CREATE DATABASE ... TEMPLATE (while connected to another database).
+const templateBlockersQuery = `
+SELECT a.pid, coalesce(a.datname, ''), coalesce(a.application_name, ''), coalesce(a.state, ''),
+	left(coalesce(a.query, ''), $2), coalesce(a.query_start, a.backend_start)
+FROM pg_stat_activity a
+WHERE a.pid <> pg_backend_pid()
+	AND (a.datname = $1 OR a.pid IN (
+		SELECT l.pid
+		FROM pg_locks l
+		JOIN pg_database d ON d.oid = l.objid
+		WHERE l.locktype = 'object' AND l.classid = 'pg_database'::regclass AND l.granted AND d.datname = $1))
+ORDER BY 6, a.pid`
+
+// TemplateBlocker is a backend preventing the template database from being dropped.
+type TemplateBlocker struct {
+	PID             int       `json:"pid"`
+	Kind            string    `json:"kind"`     // TemplateBlockerClone or TemplateBlockerConnection
+	Database        string    `json:"database"` // database the backend is connected to
+	ApplicationName string    `json:"applicationName"`
+	State           string    `json:"state"`
+	Query           string    `json:"query"` // current (or last) query, truncated
+	Since           time.Time `json:"since"` // start of the query (or connection)
+}
+
+// TemplateInUseError is returned while discarding a template if its database is still accessed, e.g. by clones of
+// test databases still in progress. It matches pool.ErrTestDBInUse via errors.Is.
+type TemplateInUseError struct {
+	TemplateDatabase string            `json:"templateDatabase"`
+	Blockers         []TemplateBlocker `json:"blockers"`
+}
+
+func (e *TemplateInUseError) Error() string {
+	clones := 0
+	for _, blocker := range e.Blockers {
+		if blocker.Kind == TemplateBlockerClone {
+			clones++
+		}
+	}
+
+	return fmt.Sprintf("%v: template %s is blocked by %d in-flight clones and %d connections",
+		pool.ErrTestDBInUse, e.TemplateDatabase, clones, len(e.Blockers)-clones)
+}
+
+func (e *TemplateInUseError) Unwrap() error {
+	return pool.ErrTestDBInUse
+}
+
+// dropTemplateDatabase drops the template database, waiting up to TemplateDiscardWaitTimeout for its blockers (e.g.
+// a burst of clones) to finish. If it remains in use, a TemplateInUseError reports the blocking backends.
+func (m Manager) dropTemplateDatabase(ctx context.Context, dbName string) error {
+
+	log := m.getManagerLogger(ctx, "dropTemplateDatabase").With().Str("dbName", dbName).Logger()
+
+	err := m.dropDatabase(ctx, dbName)
+
+	deadline := time.Now().Add(m.config.TemplateDiscardWaitTimeout)
+	backoff := templateDiscardBackoff
+
+	for errors.Is(err, pool.ErrTestDBInUse) && time.Now().Before(deadline) {
+		log.Debug().Dur("backoff", backoff).Msg("template in use, waiting...")
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+		if backoff > templateDiscardMaxBackoff {
+			backoff = templateDiscardMaxBackoff
+		}
+
+		err = m.dropDatabase(ctx, dbName)
+	}
+
+	if !errors.Is(err, pool.ErrTestDBInUse) {
+		return err
+	}
+
+	blockers, blockersErr := m.templateBlockers(ctx, dbName)
+	if blockersErr != nil {
+		log.Warn().Err(blockersErr).Msg("unable to list the blockers of the template")
+		return err
+	}
+
+	log.Warn().Int("blockers", len(blockers)).Msg("template in use")
+
+	return &TemplateInUseError{TemplateDatabase: dbName, Blockers: blockers}
+}
+
+// templateBlockers lists the backends preventing the template database from being dropped, oldest first.
+func (m Manager) templateBlockers(ctx context.Context, dbName string) ([]TemplateBlocker, error) {
+	rows, err := m.db.QueryContext(ctx, templateBlockersQuery, dbName, templateBlockerQueryLength)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	blockers := make([]TemplateBlocker, 0)
+	for rows.Next() {
+		var blocker TemplateBlocker
+		if err := rows.Scan(&blocker.PID, &blocker.Database, &blocker.ApplicationName, &blocker.State, &blocker.Query, &blocker.Since); err != nil {
+			return nil, err
+		}
+
+		blocker.Kind = TemplateBlockerConnection
+		if blocker.Database != dbName && strings.Contains(strings.ToUpper(blocker.Query), "CREATE DATABASE") {
+			blocker.Kind = TemplateBlockerClone
+		}
+
+		blockers = append(blockers, blocker)
+	}
+
+	return blockers, rows.Err()
+}
@@ -0,0 +1,210 @@
+package manager
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/allaboutapps/integresql/pkg/db"
+	"github.com/allaboutapps/integresql/pkg/templates"
+	"github.com/lib/pq"
+)
+
+var (
+	ErrInvalidEngine     = errors.New("invalid database engine")
+	ErrEngineUnsupported = errors.New("not supported by the database engine")
+)
+
+// Engine selects the database server the template and test databases are managed on.
+type Engine string
+
+const (
+	EnginePostgres  Engine = "postgres"  // PostgreSQL (default), all features are supported
+	EngineMySQL     Engine = "mysql"     // MySQL/MariaDB, test databases are cloned via mysqldump | mysql
+	EngineCockroach Engine = "cockroach" // CockroachDB, test databases are restored from a backup of the template
+)
+
+// ParseEngine returns the engine, empty defaults to EnginePostgres.
+func ParseEngine(s string) (Engine, error) {
+	switch engine := Engine(s); engine {
+	case "":
+		return EnginePostgres, nil
+	case EnginePostgres, EngineMySQL, EngineCockroach:
+		return engine, nil
+	default:
+		return "", fmt.Errorf("%w: %q", ErrInvalidEngine, s)
+	}
+}
+
+// DatabaseEngine executes the statements managing databases on a specific database server. All methods operate via
+// the connection of the manager (conn), opened via DriverName and DSN of the TargetDatabaseConfig.
+type DatabaseEngine interface {
+	DriverName() string
+	DSN(config db.DatabaseConfig) string
+
+	// CreateDatabase creates the database owned by owner as copy of the template database.
+	CreateDatabase(ctx context.Context, conn *sql.DB, dbName string, owner string, template string) error
+	// DropDatabase drops the database if it exists, force terminates connected sessions (if supported).
+	DropDatabase(ctx context.Context, conn *sql.DB, dbName string, force bool) error
+	// ListDatabases returns the names of all databases matching the LIKE pattern.
+	ListDatabases(ctx context.Context, conn *sql.DB, pattern string) ([]string, error)
+	// CountConnections returns the number of sessions currently connected to the database.
+	CountConnections(ctx context.Context, conn *sql.DB, dbName string) (int, error)
+}
+
+func newDatabaseEngine(config ManagerConfig) DatabaseEngine {
+	switch config.Engine {
+	case EngineMySQL:
+		return &mysqlEngine{
+			config:        config.TargetDatabaseConfig,
+			rootTemplate:  config.TemplateDatabaseTemplate,
+			mysqlPath:     config.MySQLPath,
+			mysqlDumpPath: config.MySQLDumpPath,
+		}
+	case EngineCockroach:
+		return &cockroachEngine{
+			rootTemplate: config.TemplateDatabaseTemplate,
+			backupURI:    config.CockroachBackupURI,
+			backups:      make(map[string]string),
+		}
+	default:
+		return postgresEngine{}
+	}
+}
+
+// validateEngine rejects the configured features the engine doesn't support.
+func (m Manager) validateEngine() error {
+	if m.config.Engine == EnginePostgres {
+		return nil
+	}
+
+	// these rely on PostgreSQL specific statements or catalogs
+	features := []struct {
+		name    string
+		enabled bool
+	}{
+		{"DDL functions", len(m.config.DDLFunctions.CreateDatabase) > 0 || len(m.config.DDLFunctions.DropDatabase) > 0 || len(m.config.DDLFunctions.RenameDatabase) > 0},
+		{"force dropping databases", m.config.ForceDropDatabase},
+		{"advisory locks", m.config.AdvisoryLocks},
+		{"tracking schema", m.config.TrackingSchema},
+		{"isolating test databases", m.config.IsolateTestDatabases},
+		{"logical clones", m.config.CloneStrategy == CloneStrategyLogical},
+		{"template drift checks", m.templateDriftCheckEnabled()},
+		{"template backups", m.templateBackupConfigured()},
+		{"template registry", m.oci != nil},
+		{"connection pooler config", m.pooler != nil},
+		{"managed roles", len(m.config.ManagedRolePrefix) > 0},
+		{"sharding", len(m.config.PoolConfig.Shards) > 1},
+		{"test database owner overrides", len(m.config.TestDatabaseOwnerAllowlist) > 0},
+	}
+
+	for _, feature := range features {
+		if feature.enabled {
+			return fmt.Errorf("%w: %s (%s)", ErrEngineUnsupported, feature.name, m.config.Engine)
+		}
+	}
+
+	return nil
+}
+
+// validateEngineOptions rejects the template options the engine doesn't support.
+func (m Manager) validateEngineOptions(options templates.TemplateOptions) error {
+	if m.config.Engine == EnginePostgres {
+		return nil
+	}
+
+	if options.Source() != templates.TemplateSourceEmpty {
+		return fmt.Errorf("%w: %s templates are not supported by the %s engine", ErrInvalidTemplateOptions, options.Source(), m.config.Engine)
+	}
+
+	if len(options.Tablespace) > 0 || len(options.CloneTablespace) > 0 || len(options.CloneSettings) > 0 {
+		return fmt.Errorf("%w: tablespaces and clone settings are not supported by the %s engine", ErrInvalidTemplateOptions, m.config.Engine)
+	}
+
+	if len(options.ChecksumTables) > 0 {
+		return fmt.Errorf("%w: checksum tables are not supported by the %s engine", ErrInvalidTemplateOptions, m.config.Engine)
+	}
+
+	// post clone scripts and validation queries run via the PostgreSQL wire protocol of CockroachDB
+	if m.config.Engine == EngineCockroach {
+		if len(options.Settings) > 0 {
+			return fmt.Errorf("%w: settings are not supported by the %s engine", ErrInvalidTemplateOptions, m.config.Engine)
+		}
+
+		return nil
+	}
+
+	if len(options.Settings) > 0 || len(options.PostCloneScript) > 0 || len(options.ValidationQueries) > 0 {
+		return fmt.Errorf("%w: settings, post clone scripts and validation queries are not supported by the %s engine", ErrInvalidTemplateOptions, m.config.Engine)
+	}
+
+	return nil
+}
+
+// postgresEngine manages the databases via CREATE DATABASE ... TEMPLATE.
+type postgresEngine struct{}
+
+func (postgresEngine) DriverName() string {
+	return "postgres"
+}
+
+func (postgresEngine) DSN(config db.DatabaseConfig) string {
+	return config.ConnectionString()
+}
+
+func (postgresEngine) CreateDatabase(ctx context.Context, conn *sql.DB, dbName string, owner string, template string) error {
+	return createPostgresDatabase(ctx, conn, dbName, owner, template, "")
+}
+
+// createPostgresDatabase creates the database in the tablespace, empty inherits the one of the template.
+func createPostgresDatabase(ctx context.Context, conn *sql.DB, dbName string, owner string, template string, tablespace string) error {
+	query := fmt.Sprintf("CREATE DATABASE %s WITH OWNER %s TEMPLATE %s", pq.QuoteIdentifier(dbName), pq.QuoteIdentifier(owner), pq.QuoteIdentifier(template))
+	if len(tablespace) > 0 {
+		query += " TABLESPACE " + pq.QuoteIdentifier(tablespace)
+	}
+
+	_, err := conn.ExecContext(ctx, query)
+	return err
+}
+
+func (postgresEngine) DropDatabase(ctx context.Context, conn *sql.DB, dbName string, force bool) error {
+	// DROP DATABASE ... WITH (FORCE) is only available since PostgreSQL 13, see forceDropSupported
+	if force {
+		_, err := conn.ExecContext(ctx, fmt.Sprintf("DROP DATABASE IF EXISTS %s WITH (FORCE)", pq.QuoteIdentifier(dbName)))
+		return err
+	}
+
+	_, err := conn.ExecContext(ctx, fmt.Sprintf("DROP DATABASE IF EXISTS %s", pq.QuoteIdentifier(dbName)))
+	return err
+}
+
+func (postgresEngine) ListDatabases(ctx context.Context, conn *sql.DB, pattern string) ([]string, error) {
+	return queryNames(ctx, conn, "SELECT datname FROM pg_database WHERE datname LIKE $1", pattern)
+}
+
+func (postgresEngine) CountConnections(ctx context.Context, conn *sql.DB, dbName string) (int, error) {
+	var count int
+	err := conn.QueryRowContext(ctx, "SELECT count(pid) FROM pg_stat_activity WHERE datname = $1", dbName).Scan(&count)
+	return count, err
+}
+
+func queryNames(ctx context.Context, conn *sql.DB, query string, args ...interface{}) ([]string, error) {
+	rows, err := conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+
+		names = append(names, name)
+	}
+
+	return names, rows.Err()
+}
@@ -0,0 +1,82 @@
+package manager
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/allaboutapps/integresql/pkg/tracing"
+	"github.com/lib/pq"
+)
+
+// cockroachEngine manages the databases on CockroachDB (via the PostgreSQL wire protocol). CockroachDB has no template
+// databases, each template is backed up once (BACKUP DATABASE ... INTO) and its test databases are restored from that
+// backup (RESTORE DATABASE ... WITH new_db_name).
+type cockroachEngine struct {
+	postgresEngine
+
+	rootTemplate string // databases "cloned" from the root template are created empty
+	backupURI    string // collection URI the templates are backed up into, e.g. nodelocal://1/integresql
+
+	backups map[string]string // map[template]URI of its latest backup
+	mutex   sync.Mutex        // serializes taking backups
+}
+
+func (e *cockroachEngine) CreateDatabase(ctx context.Context, conn *sql.DB, dbName string, owner string, template string) error {
+	if template == e.rootTemplate {
+		_, err := conn.ExecContext(ctx, fmt.Sprintf("CREATE DATABASE %s OWNER %s", pq.QuoteIdentifier(dbName), pq.QuoteIdentifier(owner)))
+		return err
+	}
+
+	uri, err := e.backup(ctx, conn, template)
+	if err != nil {
+		return err
+	}
+
+	reg := tracing.Region(ctx, "cockroach_restore_db")
+	_, err = conn.ExecContext(ctx, fmt.Sprintf("RESTORE DATABASE %s FROM LATEST IN %s WITH new_db_name = %s", pq.QuoteIdentifier(template), pq.QuoteLiteral(uri), pq.QuoteLiteral(dbName)))
+	reg.End()
+	if err != nil {
+		return fmt.Errorf("restoring %s from the backup of %s failed: %w", dbName, template, err)
+	}
+
+	// restored databases are owned by the user restoring them
+	_, err = conn.ExecContext(ctx, fmt.Sprintf("ALTER DATABASE %s OWNER TO %s", pq.QuoteIdentifier(dbName), pq.QuoteIdentifier(owner)))
+	return err
+}
+
+func (e *cockroachEngine) DropDatabase(ctx context.Context, conn *sql.DB, dbName string, _ bool) error {
+	// a template dropped (and possibly recreated with the same name) must be backed up again, the backup files are
+	// left in the collection
+	e.mutex.Lock()
+	delete(e.backups, dbName)
+	e.mutex.Unlock()
+
+	_, err := conn.ExecContext(ctx, fmt.Sprintf("DROP DATABASE IF EXISTS %s CASCADE", pq.QuoteIdentifier(dbName)))
+	return err
+}
+
+// backup returns the URI of the backup of the template, the first clone of a (finalized) template takes it.
+func (e *cockroachEngine) backup(ctx context.Context, conn *sql.DB, template string) (string, error) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if uri, ok := e.backups[template]; ok {
+		return uri, nil
+	}
+
+	defer tracing.Region(ctx, "cockroach_backup_db").End()
+
+	// a new collection per backup, previous backups of a template with the same name must not be restored
+	uri := fmt.Sprintf("%s/%s/%d", strings.TrimSuffix(e.backupURI, "/"), template, time.Now().UnixNano())
+	if _, err := conn.ExecContext(ctx, fmt.Sprintf("BACKUP DATABASE %s INTO %s", pq.QuoteIdentifier(template), pq.QuoteLiteral(uri))); err != nil {
+		return "", fmt.Errorf("backing up template %s failed: %w", template, err)
+	}
+
+	e.backups[template] = uri
+
+	return uri, nil
+}
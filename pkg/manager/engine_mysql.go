@@ -0,0 +1,147 @@
+package manager
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/allaboutapps/integresql/pkg/db"
+	"github.com/allaboutapps/integresql/pkg/tracing"
+	"github.com/go-sql-driver/mysql"
+)
+
+// mysqlEngine manages the databases on MySQL/MariaDB. There are no template databases, test databases are cloned by
+// piping mysqldump of the template into mysql. Databases have no owner, the owner is ignored.
+type mysqlEngine struct {
+	config        db.DatabaseConfig // of the manager, used by mysqldump and mysql
+	rootTemplate  string            // databases "cloned" from the root template are created empty
+	mysqlPath     string
+	mysqlDumpPath string
+}
+
+func (e *mysqlEngine) DriverName() string {
+	return "mysql"
+}
+
+func (e *mysqlEngine) DSN(config db.DatabaseConfig) string {
+	cfg := mysql.NewConfig()
+	cfg.User = config.Username
+	cfg.Passwd = config.Password
+	cfg.Net = "tcp"
+	cfg.Addr = net.JoinHostPort(config.Host, strconv.Itoa(config.Port))
+	cfg.DBName = config.Database
+	cfg.Params = config.AdditionalParams
+
+	return cfg.FormatDSN()
+}
+
+func (e *mysqlEngine) CreateDatabase(ctx context.Context, conn *sql.DB, dbName string, _ string, template string) error {
+	if _, err := conn.ExecContext(ctx, fmt.Sprintf("CREATE DATABASE %s", quoteMySQLIdentifier(dbName))); err != nil {
+		return err
+	}
+
+	if template == e.rootTemplate {
+		return nil
+	}
+
+	if err := e.cloneDatabase(ctx, template, dbName); err != nil {
+		// don't leave a partial clone behind
+		_, _ = conn.ExecContext(context.Background(), fmt.Sprintf("DROP DATABASE IF EXISTS %s", quoteMySQLIdentifier(dbName)))
+		return err
+	}
+
+	return nil
+}
+
+func (e *mysqlEngine) DropDatabase(ctx context.Context, conn *sql.DB, dbName string, _ bool) error {
+	_, err := conn.ExecContext(ctx, fmt.Sprintf("DROP DATABASE IF EXISTS %s", quoteMySQLIdentifier(dbName)))
+	return err
+}
+
+func (e *mysqlEngine) ListDatabases(ctx context.Context, conn *sql.DB, pattern string) ([]string, error) {
+	return queryNames(ctx, conn, "SELECT schema_name FROM information_schema.schemata WHERE schema_name LIKE ?", pattern)
+}
+
+func (e *mysqlEngine) CountConnections(ctx context.Context, conn *sql.DB, dbName string) (int, error) {
+	var count int
+	err := conn.QueryRowContext(ctx, "SELECT count(*) FROM information_schema.processlist WHERE db = ?", dbName).Scan(&count)
+	return count, err
+}
+
+// cloneDatabase copies the schema (including routines and triggers) and data of the template database into the
+// (already existing and empty) target database by piping mysqldump into mysql.
+func (e *mysqlEngine) cloneDatabase(ctx context.Context, template string, target string) error {
+
+	defer tracing.Region(ctx, "mysql_clone_db").End()
+
+	dump := exec.CommandContext(ctx, e.mysqlDumpPath, append(e.toolConnectionArgs(), "--single-transaction", "--routines", "--triggers", "--events", template)...) // #nosec G204 - binary path is provided via config
+	dump.Env = e.toolEnv()
+
+	restore := exec.CommandContext(ctx, e.mysqlPath, append(e.toolConnectionArgs(), target)...) // #nosec G204 - binary path is provided via config
+	restore.Env = e.toolEnv()
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+
+	var dumpStderr, restoreStderr bytes.Buffer
+	dump.Stdout = w
+	dump.Stderr = &dumpStderr
+	restore.Stdin = r
+	restore.Stderr = &restoreStderr
+
+	if err := restore.Start(); err != nil {
+		r.Close()
+		w.Close()
+		return fmt.Errorf("failed to start mysql: %w", err)
+	}
+
+	if err := dump.Start(); err != nil {
+		r.Close()
+		w.Close()
+		_ = restore.Wait()
+		return fmt.Errorf("failed to start mysqldump: %w", err)
+	}
+
+	// both processes hold their own copies of the pipe now
+	r.Close()
+	w.Close()
+
+	dumpErr := dump.Wait()
+	restoreErr := restore.Wait()
+
+	if dumpErr != nil {
+		return fmt.Errorf("mysqldump failed: %w: %s", dumpErr, strings.TrimSpace(dumpStderr.String()))
+	}
+
+	if restoreErr != nil {
+		return fmt.Errorf("mysql failed: %w: %s", restoreErr, strings.TrimSpace(restoreStderr.String()))
+	}
+
+	return nil
+}
+
+// toolConnectionArgs returns the connection arguments for mysqldump/mysql (the password is passed via env).
+func (e *mysqlEngine) toolConnectionArgs() []string {
+	return []string{
+		"--host", e.config.Host,
+		"--port", strconv.Itoa(e.config.Port),
+		"--user", e.config.Username,
+		"--protocol", "tcp",
+	}
+}
+
+func (e *mysqlEngine) toolEnv() []string {
+	return append(os.Environ(), "MYSQL_PWD="+e.config.Password)
+}
+
+func quoteMySQLIdentifier(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
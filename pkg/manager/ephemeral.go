@@ -0,0 +1,90 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/allaboutapps/integresql/pkg/events"
+	"github.com/allaboutapps/integresql/pkg/templates"
+)
+
+const (
+	taskEphemeralTemplateReaper = "EPHEMERAL_TEMPLATE_REAPER"
+
+	minEphemeralReaperInterval = 10 * time.Millisecond
+	maxEphemeralReaperInterval = 10 * time.Second
+)
+
+// runEphemeralTemplateReaper periodically discards all idle ephemeral templates until the ctx is done.
+// Errors of single runs are reported to the background supervisor, they don't stop the reaper.
+// Runs outside of the maintenance schedule (see pool.PoolConfig.Maintenance) are skipped.
+func (m Manager) runEphemeralTemplateReaper(ctx context.Context) error {
+	interval := m.config.EphemeralTemplateIdleTimeout / 4
+	if interval < minEphemeralReaperInterval {
+		interval = minEphemeralReaperInterval
+	}
+	if interval > maxEphemeralReaperInterval {
+		interval = maxEphemeralReaperInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case now := <-ticker.C:
+			if m.config.PoolConfig.Maintenance.Allowed(now) {
+				m.background.Report(taskEphemeralTemplateReaper, m.reapEphemeralTemplates(ctx))
+			}
+		}
+	}
+}
+
+// reapEphemeralTemplates discards all finalized ephemeral templates with no checked out test databases,
+// whose pool was idle for at least the configured EphemeralTemplateIdleTimeout.
+func (m Manager) reapEphemeralTemplates(ctx context.Context) error {
+
+	log := m.getManagerLogger(ctx, "reapEphemeralTemplates")
+
+	var errs []error
+
+	for _, template := range m.templates.List(ctx) {
+		if !template.GetConfig(ctx).Options.Ephemeral || template.GetState(ctx) != templates.TemplateStateFinalized {
+			continue
+		}
+
+		hash := template.TemplateHash
+
+		checkedOut, lastActivity, err := m.pool.Activity(ctx, hash)
+		if err != nil {
+			continue
+		}
+
+		idle := time.Since(lastActivity)
+		if checkedOut > 0 || idle < m.config.EphemeralTemplateIdleTimeout {
+			continue
+		}
+
+		log.Info().Str("hash", hash).Dur("idle", idle).Msg("discarding idle ephemeral template...")
+
+		if err := m.DiscardTemplateDatabase(ctx, hash); err != nil {
+			errs = append(errs, fmt.Errorf("failed to discard ephemeral template %s: %w", hash, err))
+			continue
+		}
+
+		m.events.Emit(events.Event{
+			Type:    events.TypeEphemeralTemplateDiscarded,
+			Hash:    hash,
+			Message: fmt.Sprintf("ephemeral template %s was discarded after being idle for %v", hash, idle.Round(time.Millisecond)),
+			Fields: map[string]interface{}{
+				"idleMs": idle.Milliseconds(),
+			},
+		})
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,88 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/allaboutapps/integresql/pkg/pool"
+	"github.com/allaboutapps/integresql/pkg/templates"
+)
+
+// Decisions of AcquireExplanation in addition to the ones of the pool (see pool.Decision).
+const (
+	DecisionWaitTemplate      pool.Decision = "wait-template"      // the template is still initializing, waits until it's finalized
+	DecisionTemplateDiscarded pool.Decision = "template-discarded" // the template was discarded, the request is rejected
+)
+
+// AcquireExplanation describes the decision path GetTestDatabaseWithOptions would take, see ExplainGetTestDatabase.
+type AcquireExplanation struct {
+	Hash          string        `json:"hash"` // resolved (alias) hash of the template
+	TemplateState string        `json:"templateState"`
+	Decision      pool.Decision `json:"decision"`
+	Reason        string        `json:"reason"`
+
+	// snapshot of the pool, nil if there is no pool (yet), e.g. while the template is initializing
+	Pool *pool.Explanation `json:"pool"`
+}
+
+// ExplainGetTestDatabase is a dry-run of GetTestDatabaseWithOptions: Nothing is checked out, waited for or changed,
+// it explains which branch an acquisition would take right now (reuse a ready test database, hand out a dirty one,
+// create a new one or wait).
+func (m Manager) ExplainGetTestDatabase(ctx context.Context, hash string, options TestDatabaseOptions) (AcquireExplanation, error) {
+	if !m.Ready() {
+		return AcquireExplanation{}, ErrManagerNotReady
+	}
+
+	if options.Index != nil && options.SkipClean {
+		return AcquireExplanation{}, fmt.Errorf("%w: index and skip clean are mutually exclusive", ErrInvalidTestDatabaseOptions)
+	}
+
+	if err := m.validateOwner(options.Owner); err != nil {
+		return AcquireExplanation{}, err
+	}
+
+	hash = m.aliases.Resolve(hash)
+
+	template, found := m.templates.Get(ctx, hash)
+	if !found {
+		return AcquireExplanation{}, ErrTemplateNotFound
+	}
+
+	state := template.GetState(ctx)
+	explanation := AcquireExplanation{
+		Hash:          template.TemplateHash,
+		TemplateState: state.String(),
+	}
+
+	switch state {
+	case templates.TemplateStateInit:
+		explanation.Decision = DecisionWaitTemplate
+		explanation.Reason = "the template is still initializing, waits until it's finalized"
+		return explanation, nil
+	case templates.TemplateStateDiscarded:
+		explanation.Decision = DecisionTemplateDiscarded
+		explanation.Reason = "the template was discarded, no test database is handed out"
+		return explanation, nil
+	}
+
+	poolExplanation, err := m.pool.ExplainGetTestDatabase(ctx, template.TemplateHash, options.SkipClean, options.Index)
+	if errors.Is(err, pool.ErrInvalidIndex) {
+		return AcquireExplanation{}, fmt.Errorf("%w: %v", ErrInvalidTestDatabaseOptions, err)
+	}
+	if errors.Is(err, pool.ErrUnknownHash) {
+		// the pool was removed, it's reinitialized by the next acquisition
+		explanation.Decision = pool.DecisionWaitCreate
+		explanation.Reason = "there is no pool for the finalized template, it's reinitialized and waits for its first test database"
+		return explanation, nil
+	}
+	if err != nil {
+		return AcquireExplanation{}, err
+	}
+
+	explanation.Decision = poolExplanation.Decision
+	explanation.Reason = poolExplanation.Reason
+	explanation.Pool = &poolExplanation
+
+	return explanation, nil
+}
@@ -0,0 +1,74 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/allaboutapps/integresql/pkg/pool"
+)
+
+const (
+	// DROP DATABASE ... WITH (FORCE) is available since PostgreSQL 13
+	forceDropMinServerVersionNum = 130000
+
+	// number of times the backends are terminated before giving up, clients may reconnect in the meantime
+	forceDropTerminateRetries = 3
+)
+
+// detectServerVersion stores the server_version_num of the manager cluster, FORCE isn't used if it's unknown.
+func (m *Manager) detectServerVersion(ctx context.Context) {
+
+	log := m.getManagerLogger(ctx, "detectServerVersion")
+
+	var version string
+	if err := m.db.QueryRowContext(ctx, "SHOW server_version_num").Scan(&version); err != nil {
+		log.Warn().Err(err).Msg("unable to detect the server version, falling back to terminating backends")
+		return
+	}
+
+	num, err := strconv.Atoi(version)
+	if err != nil {
+		log.Warn().Err(err).Str("version", version).Msg("unable to parse the server version, falling back to terminating backends")
+		return
+	}
+
+	m.serverVersionNum = num
+	log.Debug().Int("serverVersionNum", num).Bool("force", m.forceDropSupported()).Msg("detected server version")
+}
+
+// forceDropSupported returns true if databases are dropped via DROP DATABASE ... WITH (FORCE).
+func (m Manager) forceDropSupported() bool {
+	return m.config.ForceDropDatabase && m.serverVersionNum >= forceDropMinServerVersionNum
+}
+
+// dropDatabaseTerminatingBackends terminates all backends connected to the database and retries dropping it, err is
+// the pool.ErrTestDBInUse of the first attempt.
+func (m Manager) dropDatabaseTerminatingBackends(ctx context.Context, dbName string, err error) error {
+
+	log := m.getManagerLogger(ctx, "dropDatabaseTerminatingBackends").With().Str("dbName", dbName).Logger()
+
+	for try := 1; try <= forceDropTerminateRetries && errors.Is(err, pool.ErrTestDBInUse); try++ {
+		terminated, termErr := m.terminateBackends(ctx, dbName)
+		if termErr != nil {
+			return fmt.Errorf("%w (terminating its backends failed: %v)", err, termErr)
+		}
+
+		log.Warn().Int64("terminated", terminated).Int("try", try).Msg("terminated leaked connections, dropping again...")
+
+		err = m.execDropDatabase(ctx, dbName)
+	}
+
+	return err
+}
+
+// terminateBackends terminates all backends connected to the database (except the own one), returning their number.
+func (m Manager) terminateBackends(ctx context.Context, dbName string) (int64, error) {
+	var terminated int64
+	err := m.db.QueryRowContext(ctx,
+		"SELECT count(*) FILTER (WHERE pg_terminate_backend(pid)) FROM pg_stat_activity WHERE datname = $1 AND pid <> pg_backend_pid()",
+		dbName).Scan(&terminated)
+
+	return terminated, err
+}
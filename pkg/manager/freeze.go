@@ -0,0 +1,88 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/allaboutapps/integresql/pkg/pool"
+	"github.com/allaboutapps/integresql/pkg/templates"
+)
+
+// FreezeTestDatabase removes the test database with the ID of the finalized template with the hash from rotation until
+// it's unfrozen, e.g. to investigate a failed test within it without the pool recycling it meanwhile. Frozen test
+// databases are neither handed out, cleaned, recreated nor dropped by any sweep (idle eviction, shrinking the pool),
+// discarding the template drops them though. Only test databases back in the pool (not checked out) can be frozen.
+func (m Manager) FreezeTestDatabase(ctx context.Context, hash string, id int) (pool.FrozenTestDatabase, error) {
+
+	log := m.getManagerLogger(ctx, "FreezeTestDatabase").With().Str("hash", hash).Int("id", id).Logger()
+
+	if !m.Ready() {
+		log.Error().Msg("not ready")
+		return pool.FrozenTestDatabase{}, ErrManagerNotReady
+	}
+
+	hash = m.aliases.Resolve(hash)
+	if err := m.checkFreezable(ctx, hash); err != nil {
+		return pool.FrozenTestDatabase{}, err
+	}
+
+	frozen, err := m.pool.FreezeTestDatabase(ctx, hash, id)
+	if err != nil {
+		return pool.FrozenTestDatabase{}, mapFreezeError(err)
+	}
+
+	log.Info().Str("dbName", frozen.DBName).Msg("test database frozen")
+
+	return frozen, nil
+}
+
+// UnfreezeTestDatabase puts the frozen test database with the ID of the template with the hash back into rotation,
+// it's recreated first as it might have been modified meanwhile.
+func (m Manager) UnfreezeTestDatabase(ctx context.Context, hash string, id int) error {
+
+	log := m.getManagerLogger(ctx, "UnfreezeTestDatabase").With().Str("hash", hash).Int("id", id).Logger()
+
+	if !m.Ready() {
+		log.Error().Msg("not ready")
+		return ErrManagerNotReady
+	}
+
+	hash = m.aliases.Resolve(hash)
+	if err := m.checkFreezable(ctx, hash); err != nil {
+		return err
+	}
+
+	if err := m.pool.UnfreezeTestDatabase(ctx, hash, id); err != nil {
+		return mapFreezeError(err)
+	}
+
+	log.Info().Msg("test database unfrozen")
+
+	return nil
+}
+
+// checkFreezable returns an error unless the template with the hash exists and is finalized.
+func (m Manager) checkFreezable(ctx context.Context, hash string) error {
+	template, found := m.templates.Get(ctx, hash)
+	if !found {
+		return ErrTemplateNotFound
+	}
+
+	if state := template.GetState(ctx); state != templates.TemplateStateFinalized {
+		return fmt.Errorf("%w: template is %s", ErrInvalidTemplateState, state)
+	}
+
+	return nil
+}
+
+func mapFreezeError(err error) error {
+	if errors.Is(err, pool.ErrInvalidIndex) {
+		return ErrTestNotFound
+	} else if errors.Is(err, pool.ErrUnknownHash) {
+		// recreated with the next acquisition
+		return fmt.Errorf("%w: the pool of the template is not initialized", ErrInvalidTemplateState)
+	}
+
+	return err
+}
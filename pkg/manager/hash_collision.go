@@ -0,0 +1,93 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/allaboutapps/integresql/pkg/events"
+)
+
+var ErrTemplateHashCollision = errors.New("template hash collision")
+
+// PostgreSQL silently truncates identifiers (thus database names) to NAMEDATALEN-1 bytes
+const maxIdentifierLength = 63
+
+// TemplateHashCollisionError is returned while initializing a template if a different schema is already tracked with
+// the same hash (see templates.TemplateOptions.SchemaFingerprint) or another hash is tracked with the same truncated
+// template database name. It matches ErrTemplateHashCollision via errors.Is.
+type TemplateHashCollisionError struct {
+	Hash             string `json:"hash"`
+	TemplateDatabase string `json:"templateDatabase"` // as truncated by PostgreSQL
+
+	// tracked template the hash collides with, equal to Hash for mismatching fingerprints
+	CollidingHash        string `json:"collidingHash"`
+	CollidingFingerprint string `json:"collidingFingerprint,omitempty"`
+	Fingerprint          string `json:"fingerprint,omitempty"`
+}
+
+func (e *TemplateHashCollisionError) Error() string {
+	if e.CollidingHash != e.Hash {
+		return fmt.Sprintf("%v: template database %s of hash %q is already used by hash %q (database names are truncated to %d bytes)",
+			ErrTemplateHashCollision, e.TemplateDatabase, e.Hash, e.CollidingHash, maxIdentifierLength)
+	}
+
+	return fmt.Sprintf("%v: hash %q is tracked with schema fingerprint %q, got %q", ErrTemplateHashCollision, e.Hash, e.CollidingFingerprint, e.Fingerprint)
+}
+
+func (e *TemplateHashCollisionError) Unwrap() error {
+	return ErrTemplateHashCollision
+}
+
+// truncateIdentifier returns the name as stored by PostgreSQL.
+func truncateIdentifier(name string) string {
+	if len(name) > maxIdentifierLength {
+		return name[:maxIdentifierLength]
+	}
+
+	return name
+}
+
+// checkTemplateHashCollision returns a TemplateHashCollisionError if initializing the template with the given hash and
+// schema fingerprint would reuse (or replace) the template database of a different schema. Fingerprints are only
+// compared if both templates provide one.
+func (m Manager) checkTemplateHashCollision(ctx context.Context, hash string, fingerprint string) error {
+	dbName := truncateIdentifier(m.makeTemplateDatabaseName(hash))
+
+	var collisionErr *TemplateHashCollisionError
+	for _, template := range m.templates.List(ctx) {
+		tracked := template.GetConfig(ctx).Options.SchemaFingerprint
+
+		if template.TemplateHash == hash {
+			if len(fingerprint) > 0 && len(tracked) > 0 && fingerprint != tracked {
+				collisionErr = &TemplateHashCollisionError{Hash: hash, TemplateDatabase: dbName, CollidingHash: hash, CollidingFingerprint: tracked, Fingerprint: fingerprint}
+			}
+			break
+		}
+
+		if truncateIdentifier(template.Config.Database) == dbName {
+			collisionErr = &TemplateHashCollisionError{Hash: hash, TemplateDatabase: dbName, CollidingHash: template.TemplateHash, CollidingFingerprint: tracked, Fingerprint: fingerprint}
+			break
+		}
+	}
+
+	if collisionErr == nil {
+		return nil
+	}
+
+	log := m.getManagerLogger(ctx, "checkTemplateHashCollision")
+	log.Error().Str("hash", hash).Str("collidingHash", collisionErr.CollidingHash).Str("fingerprint", fingerprint).Str("collidingFingerprint", collisionErr.CollidingFingerprint).Msg("template hash collision")
+
+	m.events.Emit(events.Event{
+		Type:    events.TypeTemplateHashCollision,
+		Hash:    hash,
+		Message: collisionErr.Error(),
+		Fields: map[string]interface{}{
+			"collidingHash":        collisionErr.CollidingHash,
+			"fingerprint":          fingerprint,
+			"collidingFingerprint": collisionErr.CollidingFingerprint,
+		},
+	})
+
+	return collisionErr
+}
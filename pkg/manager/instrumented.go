@@ -0,0 +1,113 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/allaboutapps/integresql/pkg/db"
+	"github.com/allaboutapps/integresql/pkg/metrics"
+	"github.com/allaboutapps/integresql/pkg/pool"
+	"github.com/allaboutapps/integresql/pkg/templates"
+)
+
+// instrumentedManager records the rate, result and duration of all template and test database operations.
+type instrumentedManager struct {
+	ManagerAPI
+	metrics metrics.Metrics
+}
+
+// Instrument wraps the manager, emitting metrics for all template and test database operations.
+func Instrument(m ManagerAPI, mx metrics.Metrics) ManagerAPI {
+	return instrumentedManager{ManagerAPI: m, metrics: mx}
+}
+
+func (i instrumentedManager) InitializeTemplateDatabaseWithOptions(ctx context.Context, hash string, options templates.TemplateOptions) (db.TemplateDatabase, error) {
+	start := time.Now()
+	template, err := i.ManagerAPI.InitializeTemplateDatabaseWithOptions(ctx, hash, options)
+	i.record(metrics.TemplateOperations, metrics.TemplateOperationDuration, "initialize", start, err)
+
+	return template, err
+}
+
+func (i instrumentedManager) FinalizeTemplateDatabase(ctx context.Context, hash string) (db.TemplateDatabase, error) {
+	start := time.Now()
+	template, err := i.ManagerAPI.FinalizeTemplateDatabase(ctx, hash)
+	i.record(metrics.TemplateOperations, metrics.TemplateOperationDuration, "finalize", start, err)
+
+	return template, err
+}
+
+func (i instrumentedManager) DiscardTemplateDatabase(ctx context.Context, hash string) error {
+	start := time.Now()
+	err := i.ManagerAPI.DiscardTemplateDatabase(ctx, hash)
+	i.record(metrics.TemplateOperations, metrics.TemplateOperationDuration, "discard", start, err)
+
+	return err
+}
+
+func (i instrumentedManager) BootstrapTemplateDatabase(ctx context.Context, hash string, options templates.TemplateOptions) (db.TemplateDatabase, error) {
+	start := time.Now()
+	template, err := i.ManagerAPI.BootstrapTemplateDatabase(ctx, hash, options)
+	i.record(metrics.TemplateOperations, metrics.TemplateOperationDuration, "bootstrap", start, err)
+
+	return template, err
+}
+
+func (i instrumentedManager) GetTestDatabase(ctx context.Context, hash string) (db.TestDatabase, error) {
+	start := time.Now()
+	testDB, err := i.ManagerAPI.GetTestDatabase(ctx, hash)
+	i.record(metrics.TestDatabaseOperations, metrics.TestDatabaseOperationDuration, "get", start, err)
+
+	return testDB, err
+}
+
+func (i instrumentedManager) GetTestDatabaseWithOptions(ctx context.Context, hash string, options TestDatabaseOptions) (db.TestDatabase, error) {
+	start := time.Now()
+	testDB, err := i.ManagerAPI.GetTestDatabaseWithOptions(ctx, hash, options)
+	i.record(metrics.TestDatabaseOperations, metrics.TestDatabaseOperationDuration, "get", start, err)
+
+	return testDB, err
+}
+
+func (i instrumentedManager) ReturnTestDatabase(ctx context.Context, hash string, id int) error {
+	start := time.Now()
+	err := i.ManagerAPI.ReturnTestDatabase(ctx, hash, id)
+	i.record(metrics.TestDatabaseOperations, metrics.TestDatabaseOperationDuration, "return", start, err)
+
+	return err
+}
+
+func (i instrumentedManager) RecreateTestDatabase(ctx context.Context, hash string, id int) error {
+	start := time.Now()
+	err := i.ManagerAPI.RecreateTestDatabase(ctx, hash, id)
+	i.record(metrics.TestDatabaseOperations, metrics.TestDatabaseOperationDuration, "recreate", start, err)
+
+	return err
+}
+
+func (i instrumentedManager) RenewTestDatabase(ctx context.Context, hash string, id int) (pool.Lease, error) {
+	start := time.Now()
+	lease, err := i.ManagerAPI.RenewTestDatabase(ctx, hash, id)
+	i.record(metrics.TestDatabaseOperations, metrics.TestDatabaseOperationDuration, "renew", start, err)
+
+	return lease, err
+}
+
+func (i instrumentedManager) record(counter string, histogram string, operation string, start time.Time, err error) {
+	i.metrics.Observe(histogram, time.Since(start), metrics.Labels{metrics.LabelOperation: operation})
+	i.metrics.Inc(counter, metrics.Labels{metrics.LabelOperation: operation, metrics.LabelResult: metricsResult(err)})
+}
+
+func metricsResult(err error) string {
+	switch {
+	case err == nil:
+		return "success"
+	case errors.Is(err, ErrTemplateNotFound), errors.Is(err, ErrTestNotFound):
+		return "not_found"
+	case errors.Is(err, ErrDeadlineExceeded), errors.Is(err, pool.ErrTimeout), errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	default:
+		return "error"
+	}
+}
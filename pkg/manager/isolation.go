@@ -0,0 +1,100 @@
+package manager
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/allaboutapps/integresql/pkg/tracing"
+	"github.com/lib/pq"
+)
+
+// templateSchemasQuery lists the schemas of the template, ignoring the system ones.
+const templateSchemasQuery = `
+SELECT nspname
+FROM pg_namespace
+WHERE nspname NOT IN ('pg_catalog', 'information_schema', 'pg_toast')
+	AND nspname NOT LIKE 'pg_temp_%'
+	AND nspname NOT LIKE 'pg_toast_temp_%'
+ORDER BY nspname`
+
+// hardenTemplate revokes CONNECT/TEMPORARY on the template and CREATE on all of its schemas from PUBLIC, see
+// IsolateTestDatabases. Clones inherit the schema privileges, the database ones are revoked on each clone separately.
+func (m Manager) hardenTemplate(ctx context.Context, dbName string) error {
+
+	defer tracing.Region(ctx, "harden_template_db").End()
+
+	if _, err := m.db.ExecContext(ctx, fmt.Sprintf("REVOKE ALL ON DATABASE %s FROM PUBLIC", pq.QuoteIdentifier(dbName))); err != nil {
+		return fmt.Errorf("failed to revoke privileges on template %s: %w", dbName, err)
+	}
+
+	// the manager role owns (or is privileged enough for) the schemas created by the root template
+	cfg := m.config.TargetDatabaseConfig
+	cfg.Database = dbName
+
+	conn, err := sql.Open("postgres", cfg.ConnectionString())
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	rows, err := conn.QueryContext(ctx, templateSchemasQuery)
+	if err != nil {
+		return fmt.Errorf("failed to list the schemas of template %s: %w", dbName, err)
+	}
+
+	schemas := make([]string, 0)
+	for rows.Next() {
+		var schema string
+		if err := rows.Scan(&schema); err != nil {
+			rows.Close()
+			return err
+		}
+		schemas = append(schemas, schema)
+	}
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, schema := range schemas {
+		if _, err := conn.ExecContext(ctx, fmt.Sprintf("REVOKE CREATE ON SCHEMA %s FROM PUBLIC", pq.QuoteIdentifier(schema))); err != nil {
+			return fmt.Errorf("failed to revoke CREATE on schema %s of template %s: %w", schema, dbName, err)
+		}
+	}
+
+	return nil
+}
+
+// isolateTestDatabase revokes CONNECT/TEMPORARY on the (just recreated) test database from PUBLIC and pins its
+// search_path, so only its owner may connect and unqualified names never resolve to unexpected schemas.
+func (m Manager) isolateTestDatabase(ctx context.Context, dbName string) error {
+
+	defer tracing.Region(ctx, "isolate_test_db").End()
+
+	if _, err := m.db.ExecContext(ctx, fmt.Sprintf("REVOKE ALL ON DATABASE %s FROM PUBLIC", pq.QuoteIdentifier(dbName))); err != nil {
+		return fmt.Errorf("failed to revoke privileges on %s: %w", dbName, err)
+	}
+
+	if len(m.config.IsolatedSearchPath) == 0 {
+		return nil
+	}
+
+	if _, err := m.db.ExecContext(ctx, fmt.Sprintf("ALTER DATABASE %s SET search_path TO %s", pq.QuoteIdentifier(dbName), quoteSearchPath(m.config.IsolatedSearchPath))); err != nil {
+		return fmt.Errorf("failed to set the search_path of %s: %w", dbName, err)
+	}
+
+	return nil
+}
+
+// quoteSearchPath quotes each of the comma separated schemas (including "$user") as identifier.
+func quoteSearchPath(searchPath string) string {
+	schemas := strings.Split(searchPath, ",")
+	for i, schema := range schemas {
+		schemas[i] = pq.QuoteIdentifier(strings.Trim(strings.TrimSpace(schema), `"`))
+	}
+
+	return strings.Join(schemas, ", ")
+}
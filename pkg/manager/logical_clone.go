@@ -0,0 +1,106 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/allaboutapps/integresql/pkg/tracing"
+	"github.com/lib/pq"
+)
+
+var ErrInvalidCloneStrategy = errors.New("invalid clone strategy")
+
+// CloneStrategy defines how test databases are cloned from their template. Some managed PostgreSQL offerings deny
+// CREATE DATABASE ... TEMPLATE of non-template databases, logical clones work there as well (though much slower).
+type CloneStrategy string
+
+const (
+	CloneStrategyAuto     CloneStrategy = "auto"     // TEMPLATE, switching to logical clones once TEMPLATE is denied (default)
+	CloneStrategyTemplate CloneStrategy = "template" // CREATE DATABASE ... TEMPLATE only
+	CloneStrategyLogical  CloneStrategy = "logical"  // pg_dump of the template restored into an empty database
+)
+
+// insufficient_privilege, e.g. "permission denied to copy database"
+const pqCodeInsufficientPrivilege = "42501"
+
+// ParseCloneStrategy returns the strategy, empty defaults to CloneStrategyAuto.
+func ParseCloneStrategy(s string) (CloneStrategy, error) {
+	switch strategy := CloneStrategy(s); strategy {
+	case "":
+		return CloneStrategyAuto, nil
+	case CloneStrategyAuto, CloneStrategyTemplate, CloneStrategyLogical:
+		return strategy, nil
+	default:
+		return "", fmt.Errorf("%w: %q", ErrInvalidCloneStrategy, s)
+	}
+}
+
+// cloneStrategy holds the strategy currently in use, CloneStrategyAuto switches to logical clones once.
+type cloneStrategy struct {
+	logical atomic.Bool
+}
+
+// useLogicalClone returns true if the database should be cloned logically from the template.
+func (m Manager) useLogicalClone(template string) bool {
+	// the root template of the templates themselves (e.g. template0) is always cloned via TEMPLATE
+	if template == m.config.TemplateDatabaseTemplate {
+		return false
+	}
+
+	return m.config.CloneStrategy == CloneStrategyLogical || m.cloneStrategy.logical.Load()
+}
+
+// fallbackToLogicalClone returns true if the failed CREATE DATABASE ... TEMPLATE should be retried as logical clone,
+// switching CloneStrategyAuto to logical clones for all further ones.
+func (m Manager) fallbackToLogicalClone(ctx context.Context, template string, err error) bool {
+	if m.config.CloneStrategy != CloneStrategyAuto || template == m.config.TemplateDatabaseTemplate {
+		return false
+	}
+
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) || pqErr.Code != pqCodeInsufficientPrivilege {
+		return false
+	}
+
+	if m.cloneStrategy.logical.CompareAndSwap(false, true) {
+		log := m.getManagerLogger(ctx, "fallbackToLogicalClone")
+		log.Warn().Err(err).Str("template", template).Msg("cloning via TEMPLATE denied, switching to logical clones (pg_dump | pg_restore)")
+	}
+
+	return true
+}
+
+// logicalClone creates the empty database (cloned from the root template) and restores the pg_dump of the template
+// into it. Restored objects are owned by the owner (pg_restore --role) if it's not the manager role itself.
+func (m Manager) logicalClone(ctx context.Context, dbName string, owner string, template string) error {
+
+	defer tracing.Region(ctx, "logical_clone_db").End()
+
+	if err := m.execCreateDatabase(ctx, dbName, owner, m.config.TemplateDatabaseTemplate); err != nil {
+		return err
+	}
+
+	source := m.config.TargetDatabaseConfig
+	source.Database = template
+
+	target := m.config.TargetDatabaseConfig
+	target.Database = dbName
+
+	restoreArgs := make([]string, 0, 2)
+	if owner != m.config.TargetDatabaseConfig.Username {
+		restoreArgs = append(restoreArgs, "--role", owner)
+	}
+
+	if err := m.transferDatabase(ctx, source, target, restoreArgs...); err != nil {
+		// don't leave a partially restored database behind, it's recreated (dropped first) anyways on retry
+		if dropErr := m.execDropDatabase(ctx, dbName); dropErr != nil {
+			return fmt.Errorf("failed to clone %s logically: %w (dropping it failed: %v)", dbName, err, dropErr)
+		}
+
+		return fmt.Errorf("failed to clone %s logically: %w", dbName, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,61 @@
+package manager
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/allaboutapps/integresql/pkg/tracing"
+	"github.com/lib/pq"
+)
+
+// managedRolesQuery lists the roles matching the LIKE pattern, the most recently created first (roles created later
+// typically depend on earlier ones, e.g. granted memberships).
+const managedRolesQuery = `
+SELECT rolname
+FROM pg_roles
+WHERE rolname LIKE $1
+	AND rolname <> current_user
+ORDER BY oid DESC`
+
+// dropManagedRoles drops all roles matching the ManagedRolePrefix (e.g. created per template or test database by
+// populating scripts), so they don't accumulate on shared servers. Objects and privileges of the roles within the
+// database of the manager are dropped first, roles still owning objects within other (e.g. still existing template)
+// databases can't be dropped and are skipped until the next cleanup.
+func (m Manager) dropManagedRoles(ctx context.Context) error {
+	if len(m.config.ManagedRolePrefix) == 0 {
+		return nil
+	}
+
+	defer tracing.Region(ctx, "drop_managed_roles").End()
+
+	log := m.getManagerLogger(ctx, "dropManagedRoles")
+
+	roles, err := queryNames(ctx, m.db, managedRolesQuery, likePrefixPattern(m.config.ManagedRolePrefix))
+	if err != nil {
+		return fmt.Errorf("failed to list managed roles: %w", err)
+	}
+
+	dropped := 0
+	for _, role := range roles {
+		// never drop the roles the manager itself relies on
+		if role == m.config.TargetDatabaseConfig.Username || role == m.config.TestDatabaseOwner {
+			continue
+		}
+
+		if _, err := m.db.ExecContext(ctx, fmt.Sprintf("DROP OWNED BY %s", pq.QuoteIdentifier(role))); err != nil {
+			log.Warn().Err(err).Str("role", role).Msg("unable to drop owned objects of managed role, skipping")
+			continue
+		}
+
+		if _, err := m.db.ExecContext(ctx, fmt.Sprintf("DROP ROLE IF EXISTS %s", pq.QuoteIdentifier(role))); err != nil {
+			log.Warn().Err(err).Str("role", role).Msg("unable to drop managed role, skipping")
+			continue
+		}
+
+		dropped++
+	}
+
+	log.Info().Int("dropped", dropped).Int("skipped", len(roles)-dropped).Msg("dropped managed roles")
+
+	return nil
+}
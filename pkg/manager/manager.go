@@ -6,16 +6,26 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"runtime/trace"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/allaboutapps/integresql/pkg/db"
+	"github.com/allaboutapps/integresql/pkg/encryption"
+	"github.com/allaboutapps/integresql/pkg/events"
+	"github.com/allaboutapps/integresql/pkg/oci"
 	"github.com/allaboutapps/integresql/pkg/pool"
+	"github.com/allaboutapps/integresql/pkg/pooler"
 	"github.com/allaboutapps/integresql/pkg/templates"
+	"github.com/allaboutapps/integresql/pkg/tracing"
 	"github.com/allaboutapps/integresql/pkg/util"
+	"github.com/allaboutapps/integresql/pkg/webhook"
 	"github.com/lib/pq"
 	"github.com/rs/zerolog"
-	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 var (
@@ -25,18 +35,88 @@ var (
 	ErrTestNotFound               = errors.New("test database not found")
 	ErrTemplateDiscarded          = errors.New("template is discarded, can't be used")
 	ErrInvalidTemplateState       = errors.New("unexpected template state")
+	ErrInvalidTemplateOptions     = errors.New("invalid template options")
+	ErrInvalidTestDatabaseOptions = errors.New("invalid test database options")
 )
 
+// number of the most recent events kept in memory
+const eventsBufferSize = 250
+
 type Manager struct {
-	config ManagerConfig
-	db     *sql.DB
+	config     ManagerConfig
+	db         *sql.DB        // connection to the TargetDatabaseConfig server the databases are created on
+	trackingDB *sql.DB        // connection holding the tracking schema, db unless a separate TargetDatabaseConfig is configured
+	engine     DatabaseEngine // executes the statements managing databases on the server, see Engine
 
 	templates *templates.Collection
 	pool      *pool.PoolCollection
+	events    *events.Recorder
+	aliases   *aliasRegistry
+
+	fingerprints *fingerprintRegistry           // captured while finalizing templates, see TemplateDriftCheckInterval
+	shutdowns    *shutdownReports               // report of the databases left behind by the last Disconnect
+	runtime      *runtimeHealth                 // thresholds of the Go runtime currently exceeded, see RuntimeHealthCheckInterval
+	statsHistory *statsHistory                  // most recent samples of the pool utilization, nil if disabled
+	pooler       *pooler.Syncer                 // keeps the config of the connection pooler in sync, nil if disabled
+	oci          *oci.Client                    // pushes/pulls template artifacts, nil if no registry is configured
+	soak         *soakRegistry                  // state of the invariant check, see SoakInvariantCheck
+	owners       *ownerRegistry                 // test databases owned by another role, see TestDatabaseOptions.Owner
+	usage        *templateUsageRegistry         // acquisitions per template persisted to the TemplateUsageFile, nil if disabled
+	stateKeys    *encryption.Keyring            // seals the persisted state, nil if StateEncryptionKeys are disabled
+	nsStateKeys  map[string]*encryption.Keyring // seal the tracked templates of their namespace instead of the stateKeys, see NamespaceStateEncryptionKeys
+
+	restoreCheckpoints *restoreCheckpointRegistry // progress of failed dump restores, see TemplateRestoreCheckpoints
+	quota              *sync.Mutex                // serializes the quota check with adding the template, see MaxTemplatesPerNamespace
+	ddlCounts          *ddlCounters               // executed CREATE/DROP DATABASE statements, see MetricSamples
+	cloneStrategy      *cloneStrategy             // switched to logical clones by CloneStrategyAuto
+	staleCheckouts     *staleCheckouts            // checkouts alerted as stale, see StaleCheckoutAlertAfter
+	webhooks           *webhook.Client            // delivers the ready/failed webhooks of templates
+	replicas           *templateReplicaRegistry   // clone sources besides the templates, see TemplateReplicas
+	shards             *shardRegistry             // further servers the test databases are striped across, see ShardHosts
+	migrations         *migrationRegistry         // servers pools were migrated to, see MigrateTemplate
+	schedule           *scheduleRegistry          // recurring admin tasks, see ScheduleTask
+
+	serverVersionNum int // server_version_num of the manager cluster (e.g. 130004), only detected with ForceDropDatabase
+
+	instanceLock *sql.Conn // session holding the shared instance lock while connected, nil unless AdvisoryLocks
+
+	background *util.Supervisor // owns all background tasks of the manager (e.g. the ephemeral template reaper), running while connected
+}
+
+// Stats describes the current state of all pools tracked by the manager.
+type Stats struct {
+	Pools []pool.Stats `json:"pools"`
+
+	// errors of background tasks of the manager per task (pool related ones are part of the pool stats)
+	BackgroundErrors map[string]util.TaskErrors `json:"backgroundErrors,omitempty"`
+
+	// automatically maintained aliases (e.g. "latest:main") and the template hashes they point to
+	Aliases map[string]string `json:"aliases,omitempty"`
+
+	// created replicas per template hash, test databases are cloned from them as well (see TemplateReplicas)
+	TemplateReplicas map[string]int `json:"templateReplicas,omitempty"`
+
+	// number of finalized templates detected to be modified afterwards (see TemplateDriftCheckInterval)
+	TemplateDrifts int `json:"templateDrifts"`
+
+	// whether background maintenance is currently allowed by the maintenance schedule
+	MaintenanceAllowed bool `json:"maintenanceAllowed"`
+
+	// health of the Go runtime of the server and the thresholds currently exceeded (see RuntimeHealthCheckInterval)
+	Runtime                   util.RuntimeStats `json:"runtime"`
+	RuntimeThresholdsExceeded []string          `json:"runtimeThresholdsExceeded,omitempty"`
+
+	// number of test databases handed out again without being recreated (see SoakInvariantCheck), must always be 0
+	SoakInvariantViolations int `json:"soakInvariantViolations"`
+
+	// failed dump restores of templates, resumed on retry (see TemplateRestoreCheckpoints)
+	RestoreCheckpoints []RestoreCheckpoint `json:"restoreCheckpoints,omitempty"`
 }
 
 func New(config ManagerConfig) (*Manager, ManagerConfig) {
 
+	log := util.LogFromContextWith(context.Background(), config.Logger)
+
 	var testDBPrefix string
 	if config.DatabasePrefix != "" {
 		testDBPrefix = testDBPrefix + fmt.Sprintf("%s_", config.DatabasePrefix)
@@ -47,12 +127,69 @@ func New(config ManagerConfig) (*Manager, ManagerConfig) {
 
 	config.PoolConfig.TestDBNamePrefix = testDBPrefix
 
+	if len(config.TargetDatabaseConfig.Host) == 0 {
+		config.TargetDatabaseConfig.Host = config.ManagerDatabaseConfig.Host
+	}
+
+	if config.TargetDatabaseConfig.Port == 0 {
+		config.TargetDatabaseConfig.Port = config.ManagerDatabaseConfig.Port
+	}
+
+	if len(config.TargetDatabaseConfig.Username) == 0 {
+		config.TargetDatabaseConfig.Username = config.ManagerDatabaseConfig.Username
+		config.TargetDatabaseConfig.Password = config.ManagerDatabaseConfig.Password
+	}
+
+	if len(config.TargetDatabaseConfig.Database) == 0 {
+		config.TargetDatabaseConfig.Database = config.ManagerDatabaseConfig.Database
+	}
+
+	if config.TargetDatabaseConfig.AdditionalParams == nil {
+		config.TargetDatabaseConfig.AdditionalParams = config.ManagerDatabaseConfig.AdditionalParams
+	}
+
+	// the TLS settings fall back as a whole
+	if len(config.TargetDatabaseConfig.SSLMode) == 0 {
+		config.TargetDatabaseConfig.SSLMode = config.ManagerDatabaseConfig.SSLMode
+		config.TargetDatabaseConfig.SSLRootCert = config.ManagerDatabaseConfig.SSLRootCert
+		config.TargetDatabaseConfig.SSLCert = config.ManagerDatabaseConfig.SSLCert
+		config.TargetDatabaseConfig.SSLKey = config.ManagerDatabaseConfig.SSLKey
+	}
+
 	if len(config.TestDatabaseOwner) == 0 {
-		config.TestDatabaseOwner = config.ManagerDatabaseConfig.Username
+		config.TestDatabaseOwner = config.TargetDatabaseConfig.Username
 	}
 
 	if len(config.TestDatabaseOwnerPassword) == 0 {
-		config.TestDatabaseOwnerPassword = config.ManagerDatabaseConfig.Password
+		config.TestDatabaseOwnerPassword = config.TargetDatabaseConfig.Password
+	}
+
+	if len(config.SourceDatabaseConfig.Host) == 0 {
+		config.SourceDatabaseConfig.Host = config.TargetDatabaseConfig.Host
+	}
+
+	if config.SourceDatabaseConfig.Port == 0 {
+		config.SourceDatabaseConfig.Port = config.TargetDatabaseConfig.Port
+	}
+
+	if len(config.SourceDatabaseConfig.Username) == 0 {
+		config.SourceDatabaseConfig.Username = config.TargetDatabaseConfig.Username
+		config.SourceDatabaseConfig.Password = config.TargetDatabaseConfig.Password
+	}
+
+	if len(config.SourceDatabaseConfig.SSLMode) == 0 {
+		config.SourceDatabaseConfig.SSLMode = config.TargetDatabaseConfig.SSLMode
+		config.SourceDatabaseConfig.SSLRootCert = config.TargetDatabaseConfig.SSLRootCert
+		config.SourceDatabaseConfig.SSLCert = config.TargetDatabaseConfig.SSLCert
+		config.SourceDatabaseConfig.SSLKey = config.TargetDatabaseConfig.SSLKey
+	}
+
+	if len(config.PgDumpPath) == 0 {
+		config.PgDumpPath = "pg_dump"
+	}
+
+	if len(config.PgRestorePath) == 0 {
+		config.PgRestorePath = "pg_restore"
 	}
 
 	// at least one test database needs to be present initially
@@ -64,10 +201,86 @@ func New(config ManagerConfig) (*Manager, ManagerConfig) {
 		config.PoolConfig.InitialPoolSize = config.PoolConfig.MaxPoolSize
 	}
 
+	if config.PoolConfig.MaxPoolSizeLimit < config.PoolConfig.MaxPoolSize {
+		config.PoolConfig.MaxPoolSizeLimit = config.PoolConfig.MaxPoolSize
+	}
+
 	if config.PoolConfig.MaxParallelTasks < 1 {
 		config.PoolConfig.MaxParallelTasks = 1
 	}
 
+	if len(config.ShardHosts) > 0 {
+		if shards, err := ParseShardHosts(config.TargetDatabaseConfig, config.ShardHosts); err != nil {
+			log.Error().Err(err).Msg("Disabling sharding due to invalid shard hosts")
+		} else {
+			config.PoolConfig.Shards = shards
+		}
+	}
+
+	if routing, err := pool.ParseShardRouting(string(config.PoolConfig.ShardRouting)); err != nil {
+		log.Error().Err(err).Msg("Falling back to the round-robin shard routing")
+		config.PoolConfig.ShardRouting = pool.ShardRoutingRoundRobin
+	} else {
+		config.PoolConfig.ShardRouting = routing
+	}
+
+	if policy, err := pool.ParseSelectionPolicy(string(config.PoolConfig.SelectionPolicy)); err != nil {
+		log.Error().Err(err).Msg("Falling back to the lru selection policy")
+		config.PoolConfig.SelectionPolicy = pool.SelectionLRU
+	} else {
+		config.PoolConfig.SelectionPolicy = policy
+	}
+
+	if strategy, err := ParseCloneStrategy(string(config.CloneStrategy)); err != nil {
+		log.Error().Err(err).Msg("Falling back to the auto clone strategy")
+		config.CloneStrategy = CloneStrategyAuto
+	} else {
+		config.CloneStrategy = strategy
+	}
+
+	if engine, err := ParseEngine(string(config.Engine)); err != nil {
+		log.Error().Err(err).Msg("Falling back to the postgres engine")
+		config.Engine = EnginePostgres
+	} else {
+		config.Engine = engine
+	}
+
+	if len(config.MySQLPath) == 0 {
+		config.MySQLPath = "mysql"
+	}
+
+	if len(config.MySQLDumpPath) == 0 {
+		config.MySQLDumpPath = "mysqldump"
+	}
+
+	if config.TestDatabaseHealthCheckTimeout <= 0 {
+		config.TestDatabaseHealthCheckTimeout = 2 * time.Second
+	}
+
+	if config.EphemeralTemplateIdleTimeout <= 0 {
+		config.EphemeralTemplateIdleTimeout = time.Second
+	}
+
+	stateKeys, err := encryption.ParseKeyring(config.StateEncryptionKeys)
+
+	nsStateKeys := make(map[string]*encryption.Keyring, len(config.NamespaceStateEncryptionKeys))
+	for namespace, keys := range config.NamespaceStateEncryptionKeys {
+		nsKeys, nsErr := encryption.ParseKeyring(keys)
+		if nsErr != nil && err == nil {
+			err = fmt.Errorf("namespace %q: %w", namespace, nsErr)
+		}
+
+		nsStateKeys[namespace] = nsKeys
+	}
+
+	if err != nil {
+		// never fall back to persisting the state in plaintext
+		log.Error().Err(err).Msg("Disabling the template usage file, the schedule file and the tracking schema due to invalid state encryption keys")
+		config.TemplateUsageFile = ""
+		config.ScheduleFile = ""
+		config.TrackingSchema = false
+	}
+
 	// debug log final derived config
 	c, err := json.Marshal(config)
 
@@ -77,13 +290,76 @@ func New(config ManagerConfig) (*Manager, ManagerConfig) {
 
 	log.Debug().RawJSON("config", c).Msg("manager.New")
 
+	recorder := events.NewRecorder(eventsBufferSize)
+	config.PoolConfig.Events = recorder
+
+	if config.PoolConfig.Logger == nil {
+		config.PoolConfig.Logger = config.Logger
+	}
+
 	m := &Manager{
-		config:    config,
-		db:        nil,
-		templates: templates.NewCollection(),
-		pool:      pool.NewPoolCollection(config.PoolConfig),
+		config:      config,
+		stateKeys:   stateKeys,
+		nsStateKeys: nsStateKeys,
+		db:          nil,
+		engine:      newDatabaseEngine(config),
+		templates:   templates.NewCollection(),
+		pool:        pool.NewPoolCollection(config.PoolConfig),
+		events:      recorder,
+		aliases:     newAliasRegistry(),
+
+		fingerprints: newFingerprintRegistry(),
+		shutdowns:    &shutdownReports{},
+		runtime:      &runtimeHealth{},
+		soak:         newSoakRegistry(),
+		owners:       newOwnerRegistry(),
+
+		restoreCheckpoints: newRestoreCheckpointRegistry(),
+		quota:              &sync.Mutex{},
+		ddlCounts:          &ddlCounters{},
+		cloneStrategy:      &cloneStrategy{},
+		staleCheckouts:     &staleCheckouts{},
+		webhooks:           webhook.NewClient(config.Webhook),
+		replicas:           newTemplateReplicaRegistry(),
+		shards:             newShardRegistry(config.PoolConfig.Shards),
+		migrations:         newMigrationRegistry(),
+	}
+
+	if m.statsHistoryEnabled() {
+		m.statsHistory = newStatsHistory(int(config.StatsHistoryRetention / config.StatsHistoryResolution))
+	}
+
+	if config.Pooler.Enabled() {
+		syncer, err := pooler.NewSyncer(config.Pooler)
+		if err != nil {
+			log.Error().Err(err).Msg("Disabling the pooler config generation due to an invalid config")
+		} else {
+			m.pooler = syncer
+		}
+	}
+
+	if config.OCI.Enabled() {
+		m.oci = oci.NewClient(config.OCI)
 	}
 
+	if len(config.TemplateUsageFile) > 0 {
+		usage, err := loadTemplateUsage(config.TemplateUsageFile, stateKeys)
+		if err != nil {
+			log.Error().Err(err).Msg("Disabling the template usage tracking due to an unreadable usage file")
+		} else {
+			m.usage = usage
+		}
+	}
+
+	schedule, err := loadSchedule(config.ScheduleFile, stateKeys)
+	if err != nil {
+		log.Error().Err(err).Msg("Not persisting the scheduled tasks due to an unreadable schedule file")
+		schedule, _ = loadSchedule("", nil)
+	}
+	m.schedule = schedule
+
+	m.background = util.NewSupervisor(m.onTaskError, context.Canceled)
+
 	return m, m.config
 }
 
@@ -102,7 +378,22 @@ func (m *Manager) Connect(ctx context.Context) error {
 		return err
 	}
 
-	db, err := sql.Open("postgres", m.config.ManagerDatabaseConfig.ConnectionString())
+	if err := m.config.DDLFunctions.validate(); err != nil {
+		log.Error().Err(err).Msg("invalid config")
+		return err
+	}
+
+	if err := m.validateEngine(); err != nil {
+		log.Error().Err(err).Msg("invalid config")
+		return err
+	}
+
+	if len(m.shards.servers) > 0 && (m.config.TrackingSchema || m.config.RecoveryScan) {
+		log.Error().Err(ErrShardingUnsupported).Msg("invalid config")
+		return ErrShardingUnsupported
+	}
+
+	db, err := sql.Open(m.engine.DriverName(), m.engine.DSN(m.config.TargetDatabaseConfig))
 	if err != nil {
 		log.Error().Err(err).Msg("unable to connect")
 		return err
@@ -113,9 +404,59 @@ func (m *Manager) Connect(ctx context.Context) error {
 		return err
 	}
 
+	if err := m.connectShards(ctx); err != nil {
+		log.Error().Err(err).Msg("unable to connect to shards")
+		db.Close()
+		return err
+	}
+
 	m.db = db
+	m.trackingDB = db
+	m.shutdowns.Clear()
+
+	if m.config.TrackingSchema {
+		if err := m.connectTracking(ctx); err != nil {
+			log.Error().Err(err).Msg("unable to create tracking schema")
+			_ = m.closeTrackingDB()
+			m.db = nil
+			db.Close()
+			return err
+		}
+	}
+
+	if m.config.ForceDropDatabase {
+		m.detectServerVersion(ctx)
+	}
+
+	m.background.Start(context.Background())
+	m.background.Go(taskEphemeralTemplateReaper, m.runEphemeralTemplateReaper)
+	if m.templateDriftCheckEnabled() {
+		m.background.Go(taskTemplateDriftCheck, m.runTemplateDriftCheck)
+	}
+	if m.runtimeHealthCheckEnabled() {
+		m.background.Go(taskRuntimeHealthCheck, m.runRuntimeHealthCheck)
+	}
+	if m.pooler != nil {
+		m.background.Go(taskPoolerConfigSync, m.runPoolerConfigSync)
+	}
+	if m.statsHistory != nil {
+		m.background.Go(taskStatsHistory, m.runStatsHistory)
+	}
+	if m.usage != nil {
+		m.background.Go(taskTemplateUsageFlush, m.runTemplateUsageFlush)
+	}
+	if m.config.StaleCheckoutCheckInterval > 0 {
+		m.background.Go(taskStaleCheckoutCheck, m.runStaleCheckoutCheck)
+	}
+	if m.config.TemplateTTLCheckInterval > 0 {
+		m.background.Go(taskTemplateTTLReaper, m.runTemplateTTLReaper)
+	}
+	m.background.Go(taskScheduler, m.runScheduler)
+	if m.config.TrackingSchema && m.config.TrackingSyncInterval > 0 {
+		m.background.Go(taskTrackingSync, m.runTrackingSync)
+	}
 
-	log.Debug().Msg("connected.")
+	log.Info().Msg("connected.")
 
 	return nil
 }
@@ -130,9 +471,46 @@ func (m *Manager) Disconnect(ctx context.Context, ignoreCloseError bool) error {
 		return err
 	}
 
-	// stop the pool before closing DB connection
+	// stop all background tasks and the pool before closing DB connection
+	if err := m.background.Stop(); err != nil {
+		log.Debug().Err(err).Msg("first background task error since connect")
+	}
 	m.pool.Stop()
 
+	if m.usage != nil {
+		if err := m.usage.Save(); err != nil {
+			log.Warn().Err(err).Msg("persisting the template usage failed")
+		}
+	}
+
+	if m.config.TrackingSchema {
+		if err := m.syncTracking(ctx, true); err != nil {
+			log.Warn().Err(err).Msg("persisting the tracked state failed")
+		}
+	}
+
+	// the states are final now, report what's left behind while the DB connection is still there
+	if report, err := m.buildShutdownReport(ctx, true); err != nil {
+		log.Warn().Err(err).Msg("building the shutdown report failed")
+	} else {
+		m.shutdowns.Set(report)
+		report.log(log)
+	}
+
+	m.releaseInstanceLock()
+
+	if err := m.closeTrackingDB(); err != nil {
+		log.Warn().Err(err).Msg("closing the tracking connection failed")
+	}
+
+	if err := m.closeShards(); err != nil {
+		log.Warn().Err(err).Msg("closing the shard connections failed")
+	}
+
+	if err := m.closeMigrationServers(); err != nil {
+		log.Warn().Err(err).Msg("closing the connections to migrated servers failed")
+	}
+
 	if err := m.db.Close(); err != nil && !ignoreCloseError {
 		log.Error().Err(err)
 		return err
@@ -172,143 +550,414 @@ func (m *Manager) Initialize(ctx context.Context) error {
 		}
 	}
 
-	rows, err := m.db.QueryContext(ctx, "SELECT datname FROM pg_database WHERE datname LIKE $1", fmt.Sprintf("%s_%s_%%", m.config.DatabasePrefix, m.config.PoolConfig.TestDBNamePrefix))
+	// other instances sharing the server keep their test databases, only the first one cleans up
+	if m.config.AdvisoryLocks {
+		exclusive, err := m.acquireInstanceLock(ctx)
+		if err != nil {
+			log.Error().Err(err).Msg("unable to acquire instance lock")
+			return err
+		}
+
+		if !exclusive {
+			// waits for the startup cleanup of another instance (if any) to complete
+			if err := m.downgradeInstanceLock(ctx, false); err != nil {
+				log.Error().Err(err).Msg("unable to acquire shared instance lock")
+				return err
+			}
+
+			log.Info().Msg("other instances share the server, skipping dropping unmanaged dbs.")
+			log.Info().Msg("initialized.")
+			return nil
+		}
+
+		// other instances wait for the cleanup to complete before starting
+		defer func() {
+			if err := m.downgradeInstanceLock(context.Background(), true); err != nil {
+				log.Warn().Err(err).Msg("unable to downgrade instance lock, releasing it")
+				m.releaseInstanceLock()
+			}
+		}()
+	}
+
+	var tracked *trackedState
+	if m.config.TrackingSchema {
+		var err error
+		if tracked, err = m.loadTracking(ctx); err != nil {
+			log.Error().Err(err).Msg("unable to load tracked state")
+			return err
+		}
+	} else if m.config.RecoveryScan {
+		var err error
+		if tracked, err = m.scanRecoverable(ctx); err != nil {
+			log.Error().Err(err).Msg("unable to scan for recoverable databases")
+			return err
+		}
+	}
+
+	dbNames, err := m.engine.ListDatabases(ctx, m.db, m.initializeDropPattern())
 	if err != nil {
 		log.Error().Err(err)
 		return err
 	}
-	defer rows.Close()
 
 	log.Debug().Msg("Dropping unmanaged dbs...")
 
-	for rows.Next() {
-		var dbName string
-		if err := rows.Scan(&dbName); err != nil {
-			return err
+	for _, dbName := range dbNames {
+		if tracked.tracksTestDatabase(dbName) {
+			continue
 		}
 
 		log.Warn().Str("dbName", dbName).Msg("Dropping...")
 
-		if _, err := m.db.Exec(fmt.Sprintf("DROP DATABASE %s", pq.QuoteIdentifier(dbName))); err != nil {
+		if err := m.dropDatabase(ctx, dbName); err != nil {
+			log.Error().Str("dbName", dbName).Err(err)
+			return err
+		}
+	}
+
+	// replicas of previous runs are never reused, readopted templates are replicated again
+	replicaDBs, err := m.listDatabasesWithPrefix(ctx, fmt.Sprintf("%s_replica_", m.config.DatabasePrefix))
+	if err != nil {
+		log.Error().Err(err)
+		return err
+	}
+
+	for _, dbName := range replicaDBs {
+		log.Warn().Str("dbName", dbName).Msg("Dropping replica...")
+
+		if err := m.dropDatabase(ctx, dbName); err != nil {
 			log.Error().Str("dbName", dbName).Err(err)
 			return err
 		}
 	}
 
+	// template copies and test databases on further servers are never readopted
+	if err := m.dropAllShardDatabases(ctx); err != nil {
+		log.Error().Err(err).Msg("unable to drop databases on shards")
+		return err
+	}
+
+	// readopted databases might still rely on the managed roles (e.g. granted CONNECT)
+	if tracked == nil {
+		if err := m.dropManagedRoles(ctx); err != nil {
+			log.Error().Err(err).Msg("unable to drop managed roles")
+			return err
+		}
+	}
+
+	if tracked != nil {
+		if err := m.readoptTracked(ctx, tracked); err != nil {
+			log.Error().Err(err).Msg("unable to readopt tracked state")
+			return err
+		}
+
+		// ready test databases handed out from now on must not be readopted as ready after a crash
+		if m.config.TrackingSchema {
+			if err := m.syncTracking(ctx, false); err != nil {
+				log.Error().Err(err).Msg("unable to persist tracked state")
+				return err
+			}
+		}
+	}
+
 	log.Info().Msg("initialized.")
 
 	return nil
 }
 
 func (m Manager) InitializeTemplateDatabase(ctx context.Context, hash string) (db.TemplateDatabase, error) {
-	ctx, task := trace.NewTask(ctx, "initialize_template_db")
+	return m.InitializeTemplateDatabaseWithOptions(ctx, hash, templates.TemplateOptions{})
+}
+
+// InitializeTemplateDatabaseWithOptions initializes a new template database, the given options apply to the template
+// and all test databases created from it. Templates adopting an existing database or pulled from the registry are
+// finalized immediately.
+func (m Manager) InitializeTemplateDatabaseWithOptions(ctx context.Context, hash string, options templates.TemplateOptions) (_ db.TemplateDatabase, err error) {
+	defer func() { err = m.wrapTemplateOp(err, "initialize_template_db", hash) }()
+
+	template, err := m.initializeTemplateDatabase(ctx, hash, options)
+	if err != nil || (options.Source() != templates.TemplateSourceExisting && options.Source() != templates.TemplateSourceOCI) {
+		return template, err
+	}
+
+	// adopted databases and artifacts (exported after finalizing) are used as-is, there's nothing left to populate
+	if _, err := m.FinalizeTemplateDatabase(ctx, hash); err != nil && !errors.Is(err, ErrTemplateAlreadyInitialized) {
+		return db.TemplateDatabase{}, err
+	}
+
+	return template, nil
+}
+
+func (m Manager) initializeTemplateDatabase(ctx context.Context, hash string, options templates.TemplateOptions) (db.TemplateDatabase, error) {
+	ctx, span := tracing.Start(ctx, "initialize_template_db", attribute.String("hash", hash))
 
 	log := m.getManagerLogger(ctx, "InitializeTemplateDatabase").With().Str("hash", hash).Logger()
 
-	defer task.End()
+	defer span.End()
 
 	if !m.Ready() {
 		log.Error().Msg("not ready")
 		return db.TemplateDatabase{}, ErrManagerNotReady
 	}
 
+	for name := range options.Settings {
+		if !settingNameRegexp.MatchString(name) {
+			return db.TemplateDatabase{}, fmt.Errorf("%w: invalid setting name %q", ErrInvalidTemplateOptions, name)
+		}
+	}
+
+	for i, query := range options.ValidationQueries {
+		if len(strings.TrimSpace(query)) == 0 {
+			return db.TemplateDatabase{}, fmt.Errorf("%w: validation query %d is empty", ErrInvalidTemplateOptions, i)
+		}
+	}
+
+	if err := validateChecksumTables(options.ChecksumTables); err != nil {
+		return db.TemplateDatabase{}, err
+	}
+
+	if options.FillConcurrency < 0 {
+		return db.TemplateDatabase{}, fmt.Errorf("%w: fill concurrency %d is negative", ErrInvalidTemplateOptions, options.FillConcurrency)
+	}
+
+	if options.InitialPoolSize < 0 || options.MaxPoolSize < 0 {
+		return db.TemplateDatabase{}, fmt.Errorf("%w: pool sizes must not be negative", ErrInvalidTemplateOptions)
+	}
+
+	if options.InitialPoolSize > 0 {
+		if maxPoolSize := m.templatePoolConfig(options).MaxPoolSize; options.InitialPoolSize > maxPoolSize {
+			return db.TemplateDatabase{}, fmt.Errorf("%w: initial pool size %d exceeds the max pool size %d", ErrInvalidTemplateOptions, options.InitialPoolSize, maxPoolSize)
+		}
+	}
+
+	if len(options.SelectionPolicy) > 0 {
+		if _, err := pool.ParseSelectionPolicy(options.SelectionPolicy); err != nil {
+			return db.TemplateDatabase{}, fmt.Errorf("%w: %v", ErrInvalidTemplateOptions, err)
+		}
+	}
+
+	if options.Source() == templates.TemplateSourceOCI && len(options.SourceArtifact) == 0 {
+		options.SourceArtifact = hash
+	}
+
+	if err := m.validateTemplateSource(ctx, options); err != nil {
+		return db.TemplateDatabase{}, err
+	}
+
+	if err := validateTemplateWebhooks(options); err != nil {
+		return db.TemplateDatabase{}, err
+	}
+
+	if err := m.validateEngineOptions(options); err != nil {
+		return db.TemplateDatabase{}, err
+	}
+
+	if err := m.validateCloneOptions(ctx, options); err != nil {
+		return db.TemplateDatabase{}, err
+	}
+
 	dbName := m.makeTemplateDatabaseName(hash)
 	templateConfig := templates.TemplateConfig{
-		DatabaseConfig: db.DatabaseConfig{
-			Host:     m.config.ManagerDatabaseConfig.Host,
-			Port:     m.config.ManagerDatabaseConfig.Port,
-			Username: m.config.ManagerDatabaseConfig.Username,
-			Password: m.config.ManagerDatabaseConfig.Password,
-			Database: dbName,
-		},
+		DatabaseConfig: m.templateDatabaseConfig(dbName),
+		Options:        options,
+	}
+
+	// reusing (or replacing) the template database of a different schema would silently mix up their test databases
+	if err := m.checkTemplateHashCollision(ctx, hash, options.SchemaFingerprint); err != nil {
+		return db.TemplateDatabase{}, err
+	}
+
+	// the quota check and adding the template are serialized, concurrent initializations can't exceed the quota
+	m.quota.Lock()
+	if err := m.checkTemplateSharing(ctx, hash, options.Namespace); err != nil {
+		m.quota.Unlock()
+		return db.TemplateDatabase{}, err
+	}
+
+	if err := m.checkTemplateQuota(ctx, hash, options.Namespace); err != nil {
+		m.quota.Unlock()
+		log.Warn().Err(err).Msg("template quota exceeded")
+		return db.TemplateDatabase{}, err
 	}
 
 	added, unlock := m.templates.Push(ctx, hash, templateConfig)
-	// unlock template collection only after the template is actually initalized in the DB
-	defer unlock()
+	m.quota.Unlock()
 
 	if !added {
+		unlock()
 		return db.TemplateDatabase{}, ErrTemplateAlreadyInitialized
 	}
 
-	reg := trace.StartRegion(ctx, "drop_and_create_db")
-	if err := m.dropAndCreateDatabase(ctx, dbName, m.config.ManagerDatabaseConfig.Username, m.config.TemplateDatabaseTemplate); err != nil {
+	// creating the template database may take minutes (e.g. copying its source via pg_dump | pg_restore), the collection
+	// is unlocked meanwhile. Finalizing, discarding or overwriting this template waits until it's created.
+	template, _ := m.templates.GetUnsafe(ctx, hash)
+	created := template.StartCreating()
+	defer created()
+	unlock()
+
+	// other instances sharing the server may create the same template database concurrently
+	if err := m.withAdvisoryLock(ctx, advisoryLockClassTemplates, hash, func() error {
+		return m.createTemplateDatabase(ctx, templateConfig.DatabaseConfig, options)
+	}); err != nil {
 
-		log.Error().Err(err).Msg("triggering unsafe remove after dropAndCreateDatabase failed...")
-		m.templates.RemoveUnsafe(ctx, hash)
+		log.Error().Err(err).Msg("triggering remove after createTemplateDatabase failed...")
+		m.templates.Remove(ctx, template)
+		template.SetState(ctx, templates.TemplateStateDiscarded)
+		m.notifyTemplateFailed(ctx, hash, options, err)
 
 		return db.TemplateDatabase{}, err
 	}
-	reg.End()
 
 	// if template config has been overwritten, the existing pool needs to be removed
 	err := m.pool.RemoveAllWithHash(ctx, hash, m.dropTestPoolDB)
 	if err != nil && !errors.Is(err, pool.ErrUnknownHash) {
 
-		log.Error().Err(err).Msg("triggering unsafe remove after RemoveAllWithHash failed...")
-		m.templates.RemoveUnsafe(ctx, hash)
+		log.Error().Err(err).Msg("triggering remove after RemoveAllWithHash failed...")
+		m.templates.Remove(ctx, template)
+		template.SetState(ctx, templates.TemplateStateDiscarded)
 
 		return db.TemplateDatabase{}, err
 	}
 
+	log.Info().Str("source", string(options.Source())).Msg("template initialized")
+
 	return db.TemplateDatabase{
 		Database: db.Database{
 			TemplateHash: hash,
-			Config:       templateConfig.DatabaseConfig,
+			Config:       m.clientRewriteRules(options.Namespace).Apply(templateConfig.DatabaseConfig),
 		},
 	}, nil
 }
 
 func (m Manager) DiscardTemplateDatabase(ctx context.Context, hash string) error {
+	_, err := m.TeardownTemplate(ctx, hash)
+	return err
+}
+
+// TeardownSummary describes what was removed by TeardownTemplate.
+type TeardownSummary struct {
+	TemplateHash         string `json:"templateHash"`
+	TemplateDatabase     string `json:"templateDatabase"`
+	TemplateTracked      bool   `json:"templateTracked"` // false if an untracked template database was dropped (e.g. after a restart)
+	TestDatabasesRemoved int    `json:"testDatabasesRemoved"`
+}
+
+// TeardownTemplate atomically discards the template with all of its test databases: the template is marked as discarded and
+// untracked first, so no new test databases can be acquired, afterwards all tracked test databases and the template database are dropped.
+func (m Manager) TeardownTemplate(ctx context.Context, hash string) (_ TeardownSummary, err error) {
+	defer func() { err = m.wrapTemplateOp(err, "teardown_template", hash) }()
 
-	ctx, task := trace.NewTask(ctx, "discard_template_db")
-	log := m.getManagerLogger(ctx, "DiscardTemplateDatabase").With().Str("hash", hash).Logger()
+	ctx, span := tracing.Start(ctx, "teardown_template", attribute.String("hash", hash))
+	log := m.getManagerLogger(ctx, "TeardownTemplate").With().Str("hash", hash).Logger()
 
-	defer task.End()
+	defer span.End()
+
+	summary := TeardownSummary{TemplateHash: hash}
 
 	if !m.Ready() {
 		log.Error().Msg("not ready")
-		return ErrManagerNotReady
+		return summary, ErrManagerNotReady
 	}
 
-	// first remove all DB with this hash
-	if err := m.pool.RemoveAllWithHash(ctx, hash, m.dropTestPoolDB); err != nil && !errors.Is(err, pool.ErrUnknownHash) {
-		log.Error().Err(err).Msg("remove all err")
-		return err
+	// backup before anything gets removed, a failed backup keeps the template untouched
+	if m.templateBackupConfigured() {
+		if err := m.backupTemplateBeforeDiscard(ctx, hash); err != nil {
+			log.Error().Err(err).Msg("backup err")
+			return summary, err
+		}
 	}
 
+	// block new acquisitions before removing any DB with this hash
+	m.aliases.RemoveHash(hash)
 	template, found := m.templates.Pop(ctx, hash)
-	dbName := template.Config.Database
+	if found {
+		// never finalized, it won't become ready anymore
+		if template.GetState(ctx) == templates.TemplateStateInit {
+			m.notifyTemplateFailed(ctx, hash, template.TemplateConfig.Options, ErrTemplateDiscarded)
+		}
 
-	if !found {
+		template.SetState(ctx, templates.TemplateStateDiscarded)
+
+		// its database is dropped below, not while it's still created (e.g. copied from its source)
+		if err := template.WaitUntilCreated(ctx); err != nil {
+			return summary, err
+		}
+	}
+
+	// interrupt the background fill promptly (e.g. discarding right after finalizing)
+	if err := m.pool.CancelFill(ctx, hash); err != nil && !errors.Is(err, pool.ErrUnknownHash) {
+		log.Error().Err(err).Msg("cancel fill err")
+		return summary, err
+	}
+
+	// removeFunc is called sequentially
+	removed := 0
+	removeFunc := func(ctx context.Context, testDB db.TestDatabase) error {
+		if err := m.dropTestPoolDB(ctx, testDB); err != nil {
+			return err
+		}
+		removed++
+		return nil
+	}
+
+	err = m.pool.RemoveAllWithHash(ctx, hash, removeFunc)
+	summary.TestDatabasesRemoved = removed
+	if err != nil && !errors.Is(err, pool.ErrUnknownHash) {
+		log.Error().Err(err).Msg("remove all err")
+		return summary, err
+	}
+
+	if found {
+		summary.TemplateDatabase = template.Config.Database
+		summary.TemplateTracked = true
+	} else {
 		// even if a template is not found in the collection, it might still exist in the DB
 
 		log.Warn().Msg("template not found, checking for existance...")
 
-		dbName = m.makeTemplateDatabaseName(hash)
-		exists, err := m.checkDatabaseExists(ctx, dbName)
+		summary.TemplateDatabase = m.makeTemplateDatabaseName(hash)
+		exists, err := m.checkDatabaseExists(ctx, summary.TemplateDatabase)
 		if err != nil {
-			return err
+			return summary, err
 		}
 
 		if !exists {
-			return ErrTemplateNotFound
+			return summary, ErrTemplateNotFound
 		}
-	} else {
-		template.SetState(ctx, templates.TemplateStateDiscarded)
+	}
+
+	// unregistered first, further clones use the template database (until it's dropped as well)
+	if err := m.dropTemplateReplicas(ctx, hash); err != nil {
+		log.Error().Err(err).Msg("drop replicas err")
+		return summary, err
+	}
+
+	if err := m.dropShardTemplateCopies(ctx, hash); err != nil {
+		log.Error().Err(err).Msg("drop shard template copies err")
+		return summary, err
 	}
 
 	log.Debug().Msg("found template database, dropping...")
 
-	return m.dropDatabase(ctx, dbName)
+	if err := m.dropTemplateDatabase(ctx, summary.TemplateDatabase); err != nil {
+		return summary, err
+	}
+
+	m.restoreCheckpoints.Remove(summary.TemplateDatabase)
+
+	log.Info().Int("testDatabasesRemoved", summary.TestDatabasesRemoved).Bool("templateTracked", summary.TemplateTracked).Msg("template torn down")
+
+	return summary, nil
 }
 
-func (m Manager) FinalizeTemplateDatabase(ctx context.Context, hash string) (db.TemplateDatabase, error) {
-	ctx, task := trace.NewTask(ctx, "finalize_template_db")
+func (m Manager) FinalizeTemplateDatabase(ctx context.Context, hash string) (_ db.TemplateDatabase, err error) {
+	defer func() { err = m.wrapTemplateOp(err, "finalize_template_db", hash) }()
+
+	ctx, span := tracing.Start(ctx, "finalize_template_db", attribute.String("hash", hash))
 
 	log := m.getManagerLogger(ctx, "FinalizeTemplateDatabase").With().Str("hash", hash).Logger()
 
-	defer task.End()
+	defer span.End()
 
 	if !m.Ready() {
 		log.Error().Msg("not ready")
@@ -321,13 +970,17 @@ func (m Manager) FinalizeTemplateDatabase(ctx context.Context, hash string) (db.
 		return db.TemplateDatabase{}, ErrTemplateNotFound
 	}
 
+	if err := template.WaitUntilCreated(ctx); err != nil {
+		return db.TemplateDatabase{}, err
+	}
+
 	state, lockedTemplate := template.GetStateWithLock(ctx)
 	defer lockedTemplate.Unlock()
 
 	// early bailout if we are already ready (multiple calls)
 	if state == templates.TemplateStateFinalized {
 		log.Warn().Msg("bailout: template already finalized")
-		return db.TemplateDatabase{Database: template.Database}, ErrTemplateAlreadyInitialized
+		return db.TemplateDatabase{Database: m.rewriteDatabase(template.Database, template.TemplateConfig.Options.Namespace)}, ErrTemplateAlreadyInitialized
 	}
 
 	// Disallow transition from discarded to ready
@@ -336,104 +989,312 @@ func (m Manager) FinalizeTemplateDatabase(ctx context.Context, hash string) (db.
 		return db.TemplateDatabase{}, ErrTemplateDiscarded
 	}
 
+	// clones inherit the schema privileges of the template
+	if m.config.IsolateTestDatabases {
+		if err := m.hardenTemplate(ctx, template.Config.Database); err != nil {
+			log.Error().Err(err).Msg("hardening template failed")
+			m.notifyTemplateFailed(ctx, hash, template.TemplateConfig.Options, err)
+			return db.TemplateDatabase{}, err
+		}
+	}
+
+	// before cloning starts, connecting to the template delays clones
+	checksum, err := m.checksumTemplate(ctx, template)
+	if err != nil {
+		log.Error().Err(err).Msg("checksumming template failed")
+		m.notifyTemplateFailed(ctx, hash, template.TemplateConfig.Options, err)
+		return db.TemplateDatabase{}, err
+	}
+	lockedTemplate.SetChecksum(ctx, checksum)
+
+	if m.templateDriftCheckEnabled() {
+		m.captureTemplateFingerprint(ctx, template)
+	}
+
+	if m.ociExportEnabled(template.TemplateConfig.Options) {
+		m.exportTemplate(ctx, template)
+	}
+
 	// Init a pool with this hash
 	log.Trace().Msg("init hash pool...")
-	m.pool.InitHashPool(ctx, template.Database, m.recreateTestPoolDB)
+	m.initHashPool(ctx, template)
 
 	lockedTemplate.SetState(ctx, templates.TemplateStateFinalized)
+	m.updateLatestAlias(hash, template.TemplateConfig.Options)
+	m.createTemplateReplicas(ctx, template)
+	m.notifyTemplateReady(ctx, hash, template.TemplateConfig.Options)
 
-	log.Debug().Msg("Template database finalized successfully.")
-	return db.TemplateDatabase{Database: template.Database}, nil
+	log.Info().Msg("template finalized")
+	return db.TemplateDatabase{Database: m.rewriteDatabase(template.Database, template.TemplateConfig.Options.Namespace)}, nil
+}
+
+// TestDatabaseOptions apply to a single acquisition of a test database.
+type TestDatabaseOptions struct {
+	// accept a dirty test database as-is (flagged via db.TestDatabase.Dirty) instead of waiting for a clean one,
+	// meant for clients resetting the test database themselves (e.g. truncating all tables at test start)
+	SkipClean bool
+
+	// acquire the test database with this ID (its index within the pool, created if absent) instead of any ready one,
+	// e.g. mapping CI worker k of n to the same test database run after run (can't be combined with SkipClean)
+	Index *int
+
+	// lease of the checkout, the test database is reclaimed (recreated and handed out again) as soon as it expired
+	// without being returned or renewed, e.g. as the client crashed (overwrites PoolConfig.TestDatabaseLeaseDuration)
+	LeaseDuration time.Duration
+
+	// role the test database is handed out owned by (ALTER DATABASE ... OWNER TO) instead of the TestDatabaseOwner,
+	// the returned config connects as it (must be allowlisted, see TestDatabaseOwnerAllowlist)
+	Owner string
 }
 
 // GetTestDatabase tries to get a ready test DB from an existing pool.
 func (m Manager) GetTestDatabase(ctx context.Context, hash string) (db.TestDatabase, error) {
-	ctx, task := trace.NewTask(ctx, "get_test_db")
+	return m.GetTestDatabaseWithOptions(ctx, hash, TestDatabaseOptions{})
+}
+
+// GetTestDatabaseWithOptions is a variant of GetTestDatabase, the options only apply to this acquisition.
+func (m Manager) GetTestDatabaseWithOptions(ctx context.Context, hash string, options TestDatabaseOptions) (_ db.TestDatabase, err error) {
+	defer func() { err = db.WrapOp(err, "get_test_db", hash, "") }()
+
+	ctx, span := tracing.Start(ctx, "get_test_db", attribute.String("hash", hash))
 
 	log := m.getManagerLogger(ctx, "GetTestDatabase").With().Str("hash", hash).Logger()
 
-	defer task.End()
+	defer span.End()
+	defer m.warnSlowOperation(ctx, "get_test_db", hash, time.Now())
 
 	if !m.Ready() {
 		log.Error().Msg("not ready")
 		return db.TestDatabase{}, ErrManagerNotReady
 	}
 
+	if options.Index != nil && options.SkipClean {
+		return db.TestDatabase{}, fmt.Errorf("%w: index and skip clean are mutually exclusive", ErrInvalidTestDatabaseOptions)
+	}
+
+	if options.LeaseDuration < 0 {
+		return db.TestDatabase{}, fmt.Errorf("%w: lease duration %v is negative", ErrInvalidTestDatabaseOptions, options.LeaseDuration)
+	} else if options.LeaseDuration > 0 {
+		ctx = pool.WithLease(ctx, options.LeaseDuration)
+	}
+
+	if err := m.validateOwner(options.Owner); err != nil {
+		return db.TestDatabase{}, err
+	}
+
+	hash = m.aliases.Resolve(hash)
+
 	template, found := m.templates.Get(ctx, hash)
 	if !found {
-		return db.TestDatabase{}, ErrTemplateNotFound
+		if m.oci == nil || !m.config.OCIPullOnAcquire {
+			return db.TestDatabase{}, ErrTemplateNotFound
+		}
+
+		var err error
+		if template, err = m.initializeTemplateFromRegistry(ctx, hash); err != nil {
+			return db.TestDatabase{}, err
+		}
 	}
 
+	ctx, progress := m.startProgress(ctx, template)
+	defer progress.stop()
+
 	// if the template has been discarded/not initalized yet,
 	// no DB should be returned, even if already in the pool
-	state := template.WaitUntilFinalized(ctx, m.config.TemplateFinalizeTimeout)
-	if state != templates.TemplateStateFinalized {
-		return db.TestDatabase{}, ErrInvalidTemplateState
+	templateWaitStart := time.Now()
+	if template.GetState(ctx) != templates.TemplateStateFinalized {
+		progress.enter(ProgressWaitTemplate, m.config.TemplateFinalizeTimeout)
+	}
+	err = m.waitUntilFinalized(ctx, template)
+	templateWait := time.Since(templateWaitStart)
+	if err != nil {
+		return db.TestDatabase{}, progress.err(err)
 	}
 
-	ctx, task = trace.NewTask(ctx, "get_with_timeout")
-	testDB, err := m.pool.GetTestDatabase(ctx, template.TemplateHash, m.config.TestDatabaseGetTimeout)
-	task.End()
+	progress.enter(ProgressWaitTestDatabase, m.config.TestDatabaseGetTimeout)
+
+	waitCtx, waitSpan := tracing.Start(ctx, "get_with_timeout")
+	testDB, err := m.getPoolTestDatabase(waitCtx, template.TemplateHash, options)
+	waitSpan.End()
 	if errors.Is(err, pool.ErrUnknownHash) {
 		// Template exists, but the pool is not there -
 		// it must have been removed.
 		// It needs to be reinitialized.
+		// However, never reinitialize the pool of a template torn down in the meantime.
+		if template.GetState(ctx) != templates.TemplateStateFinalized {
+			return db.TestDatabase{}, ErrInvalidTemplateState
+		}
+
 		log.Warn().Err(err).Msg("ErrUnknownHash, going to InitHashPool and recursively calling us again...")
-		m.pool.InitHashPool(ctx, template.Database, m.recreateTestPoolDB)
+		m.initHashPool(ctx, template)
 
-		testDB, err = m.pool.GetTestDatabase(ctx, template.TemplateHash, m.config.TestDatabaseGetTimeout)
+		testDB, err = m.getPoolTestDatabase(ctx, template.TemplateHash, options)
 	}
 
 	if err != nil {
+		return db.TestDatabase{}, progress.err(err)
+	}
+
+	m.pool.RecordTemplateWait(ctx, template.TemplateHash, templateWait)
+	m.recordTemplateUsage(ctx, template)
+	log.Debug().Dur("templateWait", templateWait).Int("id", testDB.ID).Bool("dirty", testDB.Dirty).Msg("got testdatabase")
+	span.SetAttributes(attribute.Int("id", testDB.ID))
+
+	if m.config.SoakInvariantCheck {
+		m.checkSoakInvariant(ctx, testDB)
+	}
+
+	if err := m.applyTestDatabaseOwner(ctx, &testDB, options.Owner); err != nil {
+		log.Error().Err(err).Int("id", testDB.ID).Msg("transferring the ownership of the test database failed")
+
+		// recreated with the TestDatabaseOwner
+		if err := m.pool.RecreateTestDatabase(ctx, template.TemplateHash, testDB.ID); err != nil {
+			log.Error().Err(err).Int("id", testDB.ID).Msg("returning the test database failed")
+		}
+
 		return db.TestDatabase{}, err
 	}
 
+	m.routeThroughPooler(ctx, &testDB)
+	testDB.Database = m.rewriteDatabase(testDB.Database, template.GetConfig(ctx).Options.Namespace)
+	testDB.Checksum = template.GetChecksum(ctx)
+
 	return testDB, nil
 }
 
+// waitUntilFinalized waits (capped to the client deadline of ctx) for the template to transition into the 'finalized' state.
+func (m Manager) waitUntilFinalized(ctx context.Context, template *templates.Template) error {
+	timeout, capped := m.waitTimeout(ctx, m.config.TemplateFinalizeTimeout)
+
+	waitStart := time.Now()
+	state := template.WaitUntilFinalized(ctx, timeout)
+	if state == templates.TemplateStateFinalized {
+		return nil
+	}
+
+	// the client gave up (or the acquisition was cancelled, see WithProgress)
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// still initializing, the client deadline is the reason we gave up
+	if capped && state == templates.TemplateStateInit {
+		return deadlineExceeded(fmt.Sprintf("template %q to be finalized", template.TemplateHash), time.Since(waitStart))
+	}
+
+	return ErrInvalidTemplateState
+}
+
+// getPoolTestDatabase waits (capped to the client deadline of ctx) for a ready test DB of the pool.
+func (m Manager) getPoolTestDatabase(ctx context.Context, hash string, options TestDatabaseOptions) (db.TestDatabase, error) {
+	timeout, capped := m.waitTimeout(ctx, m.config.TestDatabaseGetTimeout)
+
+	waitStart := time.Now()
+	var testDB db.TestDatabase
+	var err error
+	switch {
+	case options.Index != nil:
+		testDB, err = m.pool.GetTestDatabaseAtIndex(ctx, hash, *options.Index, timeout)
+		if errors.Is(err, pool.ErrInvalidIndex) {
+			return db.TestDatabase{}, fmt.Errorf("%w: %v", ErrInvalidTestDatabaseOptions, err)
+		}
+	case options.SkipClean:
+		testDB, err = m.pool.GetTestDatabaseSkipClean(ctx, hash, timeout)
+	default:
+		testDB, err = m.pool.GetTestDatabase(ctx, hash, timeout)
+	}
+	if capped && errors.Is(err, pool.ErrTimeout) {
+		return db.TestDatabase{}, deadlineExceeded(fmt.Sprintf("a ready test database of template %q", hash), time.Since(waitStart))
+	}
+
+	return testDB, err
+}
+
 // ReturnTestDatabase returns the given test DB directly to the pool, without cleaning (recreating it).
-func (m Manager) ReturnTestDatabase(ctx context.Context, hash string, id int) error {
-	ctx, task := trace.NewTask(ctx, "return_test_db")
-	defer task.End()
+func (m Manager) ReturnTestDatabase(ctx context.Context, hash string, id int) (err error) {
+	defer func() { err = m.wrapTestDatabaseOp(err, "return_test_db", hash, id) }()
+
+	ctx, span := tracing.Start(ctx, "return_test_db", attribute.String("hash", hash), attribute.Int("id", id))
+	defer span.End()
 
 	if !m.Ready() {
 		return ErrManagerNotReady
 	}
 
 	// check if the template exists and is finalized
+	hash = m.aliases.Resolve(hash)
 	template, found := m.templates.Get(ctx, hash)
 	if !found {
 		return ErrTemplateNotFound
 	}
 
-	if template.WaitUntilFinalized(ctx, m.config.TemplateFinalizeTimeout) !=
-		templates.TemplateStateFinalized {
-
-		return ErrInvalidTemplateState
+	if err := m.waitUntilFinalized(ctx, template); err != nil {
+		return err
 	}
 
 	// template is ready, we can return unchanged testDB to the pool
-	return m.pool.ReturnTestDatabase(ctx, hash, id)
+	if err := m.pool.ReturnTestDatabase(ctx, hash, id); err != nil {
+		return err
+	}
+
+	if m.config.SoakInvariantCheck {
+		// reused without recreating it, its marker is expected on the next handout
+		m.soak.Unlocked(m.pool.MakeDBName(hash, id))
+	}
+
+	return nil
+}
+
+// RenewTestDatabase extends the lease of the checked out test DB (heartbeat of long running tests), preventing its
+// auto-cleaning until the returned lease expires.
+func (m Manager) RenewTestDatabase(ctx context.Context, hash string, id int) (_ pool.Lease, err error) {
+	defer func() { err = m.wrapTestDatabaseOp(err, "renew_test_db", hash, id) }()
+
+	ctx, span := tracing.Start(ctx, "renew_test_db", attribute.String("hash", hash), attribute.Int("id", id))
+	defer span.End()
+
+	if !m.Ready() {
+		return pool.Lease{}, ErrManagerNotReady
+	}
+
+	hash = m.aliases.Resolve(hash)
+	template, found := m.templates.Get(ctx, hash)
+	if !found {
+		return pool.Lease{}, ErrTemplateNotFound
+	}
+
+	if err := m.waitUntilFinalized(ctx, template); err != nil {
+		return pool.Lease{}, err
+	}
+
+	lease, err := m.pool.RenewTestDatabase(ctx, hash, id)
+	if errors.Is(err, pool.ErrInvalidIndex) {
+		return pool.Lease{}, ErrTestNotFound
+	}
+
+	return lease, err
 }
 
 // RecreateTestDatabase recreates the test DB according to the template and returns it back to the pool.
-func (m *Manager) RecreateTestDatabase(ctx context.Context, hash string, id int) error {
-	ctx, task := trace.NewTask(ctx, "recreate_test_db")
-	defer task.End()
+func (m *Manager) RecreateTestDatabase(ctx context.Context, hash string, id int) (err error) {
+	defer func() { err = m.wrapTestDatabaseOp(err, "recreate_test_db", hash, id) }()
+
+	ctx, span := tracing.Start(ctx, "recreate_test_db", attribute.String("hash", hash), attribute.Int("id", id))
+	defer span.End()
 
 	if !m.Ready() {
 		return ErrManagerNotReady
 	}
 
 	// check if the template exists and is finalized
+	hash = m.aliases.Resolve(hash)
 	template, found := m.templates.Get(ctx, hash)
 	if !found {
 		return ErrTemplateNotFound
 	}
 
-	if template.WaitUntilFinalized(ctx, m.config.TemplateFinalizeTimeout) !=
-		templates.TemplateStateFinalized {
-		return ErrInvalidTemplateState
+	if err := m.waitUntilFinalized(ctx, template); err != nil {
+		return err
 	}
 
 	// template is ready, we can return the testDB to the pool and have it cleaned up
@@ -471,33 +1332,192 @@ func (m Manager) ResetAllTracking(ctx context.Context) error {
 	log.Warn().Msg("resetting...")
 
 	// remove all templates to disallow any new test DB creation from existing templates
+	m.aliases.RemoveAll()
 	m.templates.RemoveAll(ctx)
 
-	return m.pool.RemoveAll(ctx, m.dropTestPoolDB)
+	if err := m.pool.RemoveAll(ctx, m.dropTestPoolDB); err != nil {
+		return err
+	}
+
+	// reinitialized templates must not be cloned from the replicas of their previous state
+	if err := m.dropAllTemplateReplicas(ctx); err != nil {
+		return err
+	}
+
+	if err := m.dropAllShardDatabases(ctx); err != nil {
+		return err
+	}
+
+	return m.dropManagedRoles(ctx)
 }
 
-func (m Manager) checkDatabaseExists(ctx context.Context, dbName string) (bool, error) {
-	var exists bool
+// ResetTrackingWithLabel is a variant of ResetAllTracking, which only resets the templates (and their test databases)
+// labeled with the given label, e.g. cleaning up after a single CI run without affecting long-lived templates.
+func (m Manager) ResetTrackingWithLabel(ctx context.Context, label string) error {
 
-	log := m.getManagerLogger(ctx, "checkDatabaseExists")
-	log.Trace().Msgf("SELECT 1 AS exists FROM pg_database WHERE datname = %s\n", dbName)
+	log := m.getManagerLogger(ctx, "ResetTrackingWithLabel").With().Str("label", label).Logger()
 
-	if err := m.db.QueryRowContext(ctx, "SELECT 1 AS exists FROM pg_database WHERE datname = $1", dbName).Scan(&exists); err != nil {
-		if err == sql.ErrNoRows {
-			return false, nil
+	if !m.Ready() {
+		log.Error().Msg("not ready")
+		return ErrManagerNotReady
+	}
+
+	log.Warn().Msg("resetting...")
+
+	for _, template := range m.templates.List(ctx) {
+		if !template.GetConfig(ctx).Options.HasLabel(label) {
+			continue
+		}
+
+		// remove the template first to disallow any new test DB creation from it
+		m.aliases.RemoveHash(template.TemplateHash)
+		m.templates.Pop(ctx, template.TemplateHash)
+
+		// its database might be dropped afterwards (see DropAllDatabases), not while it's still created
+		if err := template.WaitUntilCreated(ctx); err != nil {
+			return err
+		}
+
+		if err := m.pool.RemoveAllWithHash(ctx, template.TemplateHash, m.dropTestPoolDB); err != nil && !errors.Is(err, pool.ErrUnknownHash) {
+			log.Error().Err(err).Str("hash", template.TemplateHash).Msg("remove all err")
+			return err
+		}
+
+		if err := m.dropTemplateReplicas(ctx, template.TemplateHash); err != nil {
+			log.Error().Err(err).Str("hash", template.TemplateHash).Msg("drop replicas err")
+			return err
 		}
 
+		if err := m.dropShardTemplateCopies(ctx, template.TemplateHash); err != nil {
+			log.Error().Err(err).Str("hash", template.TemplateHash).Msg("drop shard template copies err")
+			return err
+		}
+	}
+
+	return nil
+}
+
+// DropAllDatabases resets all tracking and drops every database matching the managed naming scheme
+// (templates and test databases), regardless of whether they are currently tracked or not.
+// This is typically used while shutting down in ephemeral environments, where the PostgreSQL instance
+// outlives integresql and would otherwise accumulate garbage.
+func (m Manager) DropAllDatabases(ctx context.Context) error {
+
+	log := m.getManagerLogger(ctx, "DropAllDatabases")
+
+	if !m.Ready() {
+		log.Error().Msg("not ready")
+		return ErrManagerNotReady
+	}
+
+	if err := m.ResetAllTracking(ctx); err != nil {
+		log.Error().Err(err).Msg("reset all tracking failed")
+		return err
+	}
+
+	log.Warn().Msg("dropping all managed databases...")
+
+	// the pools were removed above, however there might still be untracked databases left (e.g. from previous runs)
+	for _, prefix := range []string{m.makeTemplateDatabaseName(""), m.config.PoolConfig.TestDBNamePrefix} {
+		dbNames, err := m.listDatabasesWithPrefix(ctx, prefix)
+		if err != nil {
+			log.Error().Err(err).Str("prefix", prefix).Msg("listing databases failed")
+			return err
+		}
+
+		for _, dbName := range dbNames {
+			log.Warn().Str("dbName", dbName).Msg("Dropping...")
+
+			if err := m.dropDatabase(ctx, dbName); err != nil {
+				log.Error().Str("dbName", dbName).Err(err).Msg("drop database failed")
+				return err
+			}
+		}
+	}
+
+	// roles owning objects within the templates were skipped by ResetAllTracking above
+	if err := m.dropManagedRoles(ctx); err != nil {
+		log.Error().Err(err).Msg("drop managed roles failed")
+		return err
+	}
+
+	log.Info().Msg("dropped all managed databases.")
+
+	return nil
+}
+
+// likePrefixPattern returns a LIKE pattern matching all names starting with the prefix.
+// likeEscaper escapes '_' and '%' (wildcards within LIKE patterns), matching them literally.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "_", `\_`, "%", `\%`)
+
+func likePrefixPattern(prefix string) string {
+	return likeEscaper.Replace(prefix) + "%"
+}
+
+func (m Manager) listDatabasesWithPrefix(ctx context.Context, prefix string) ([]string, error) {
+	return m.engine.ListDatabases(ctx, m.db, likePrefixPattern(prefix))
+}
+
+// Stats returns the current stats of all tracked pools.
+func (m Manager) Stats(ctx context.Context) (Stats, error) {
+	if !m.Ready() {
+		return Stats{}, ErrManagerNotReady
+	}
+
+	return Stats{
+		Pools:            m.pool.Stats(ctx),
+		BackgroundErrors: m.background.Errors(),
+		Aliases:          m.aliases.List(),
+		TemplateReplicas: m.replicas.List(),
+		TemplateDrifts:   m.fingerprints.Drifts(),
+
+		MaintenanceAllowed: m.config.PoolConfig.Maintenance.Allowed(time.Now()),
+
+		Runtime:                   util.ReadRuntimeStats(),
+		RuntimeThresholdsExceeded: m.runtime.Exceeded(),
+
+		SoakInvariantViolations: m.soak.Violations(),
+		RestoreCheckpoints:      m.restoreCheckpoints.List(),
+	}, nil
+}
+
+// onTaskError is called by the supervisor for each failed background task.
+func (m Manager) onTaskError(task string, err error) {
+	log := m.getManagerLogger(context.Background(), "onTaskError")
+	log.Error().Err(err).Str("task", task).Msg("background task failed")
+
+	m.events.Emit(events.Event{
+		Type:    events.TypeBackgroundTaskFailed,
+		Message: fmt.Sprintf("background task %s failed: %v", task, err),
+		Fields: map[string]interface{}{
+			"task":  task,
+			"error": err.Error(),
+		},
+	})
+}
+
+// RecentEvents returns the most recent events emitted by the manager and its pools (oldest first).
+func (m Manager) RecentEvents(_ context.Context) []events.Event {
+	return m.events.Recent()
+}
+
+func (m Manager) checkDatabaseExists(ctx context.Context, dbName string) (bool, error) {
+
+	log := m.getManagerLogger(ctx, "checkDatabaseExists")
+	log.Trace().Str("dbName", dbName).Msg("checking database exists")
+
+	dbNames, err := m.engine.ListDatabases(ctx, m.db, likeEscaper.Replace(dbName))
+	if err != nil {
 		return false, err
 	}
 
-	return exists, nil
+	return len(dbNames) > 0, nil
 }
 
 func (m Manager) checkDatabaseConnected(ctx context.Context, dbName string) (bool, error) {
 
-	var countConnected int
-
-	if err := m.db.QueryRowContext(ctx, "SELECT count(pid) FROM pg_stat_activity WHERE datname = $1", dbName).Scan(&countConnected); err != nil {
+	countConnected, err := m.engine.CountConnections(ctx, m.db, dbName)
+	if err != nil {
 		if err == sql.ErrNoRows {
 			return false, nil
 		}
@@ -512,18 +1532,39 @@ func (m Manager) checkDatabaseConnected(ctx context.Context, dbName string) (boo
 	return false, nil
 }
 
-func (m Manager) createDatabase(ctx context.Context, dbName string, owner string, template string) error {
+func (m Manager) createDatabase(ctx context.Context, dbName string, owner string, template string) (err error) {
+
+	defer tracing.Region(ctx, "create_db").End()
+	defer func() { m.ddlCounts.record(ddlCreate, err) }()
+	defer m.warnSlowOperation(ctx, "create_db", dbName, time.Now())
+
+	if m.useLogicalClone(template) {
+		return m.logicalClone(ctx, dbName, owner, template)
+	}
+
+	err = m.execCreateDatabase(ctx, dbName, owner, template)
+	if err != nil && m.fallbackToLogicalClone(ctx, template, err) {
+		return m.logicalClone(ctx, dbName, owner, template)
+	}
+
+	return err
+}
 
-	defer trace.StartRegion(ctx, "create_db").End()
+func (m Manager) execCreateDatabase(ctx context.Context, dbName string, owner string, template string) error {
 
 	log := m.getManagerLogger(ctx, "createDatabase")
-	log.Trace().Msgf("CREATE DATABASE %s WITH OWNER %s TEMPLATE %s\n", pq.QuoteIdentifier(dbName), pq.QuoteIdentifier(owner), pq.QuoteIdentifier(template))
+	if len(m.config.DDLFunctions.CreateDatabase) > 0 {
+		log.Trace().Msgf("SELECT %s(%s, %s, %s)\n", m.config.DDLFunctions.CreateDatabase, dbName, owner, template)
+		return m.callDDLFunction(ctx, m.config.DDLFunctions.CreateDatabase, dbName, owner, template)
+	}
 
-	if _, err := m.db.ExecContext(ctx, fmt.Sprintf("CREATE DATABASE %s WITH OWNER %s TEMPLATE %s", pq.QuoteIdentifier(dbName), pq.QuoteIdentifier(owner), pq.QuoteIdentifier(template))); err != nil {
-		return err
+	log.Trace().Str("dbName", dbName).Str("owner", owner).Str("template", template).Msg("creating database")
+
+	if options := cloneOptionsFrom(ctx); len(options.tablespace) > 0 || len(options.settings) > 0 {
+		return m.createDatabaseWithOptions(ctx, dbName, owner, template, options)
 	}
 
-	return nil
+	return m.engine.CreateDatabase(ctx, m.db, dbName, owner, template)
 }
 
 func (m Manager) recreateTestPoolDB(ctx context.Context, testDB db.TestDatabase, templateName string) error {
@@ -534,30 +1575,292 @@ func (m Manager) recreateTestPoolDB(ctx context.Context, testDB db.TestDatabase,
 		return err
 	}
 
-	if connected {
+	// leaked connections are terminated while dropping it
+	if connected && !m.config.ForceDropDatabase {
 		return pool.ErrTestDBInUse
 	}
 
-	return m.dropAndCreateDatabase(ctx, testDB.Database.Config.Database, m.config.TestDatabaseOwner, templateName)
+	// test databases on further servers are cloned from the local copy of the template
+	source := templateName
+	if pool.ShardOf(testDB.ID, len(m.config.PoolConfig.Shards)) == 0 && m.migrations.server(testDB.Config) == nil {
+		// round-robin across the template and its replicas, PostgreSQL serializes concurrent clones of the same database
+		source = m.replicas.NextSource(testDB.TemplateHash, templateName)
+	}
+
+	if err := m.dropAndCreateDatabase(ctx, testDB.Database.Config.Database, m.config.TestDatabaseOwner, source); err != nil {
+		return err
+	}
+
+	// owned by the TestDatabaseOwner again
+	m.owners.Set(testDB.Database.Config.Database, "")
+
+	return nil
+}
+
+// rewriteDatabase applies the configured NamespaceClientRewriteRules of the namespace of its template and the
+// ClientRewriteRules to the config of a database handed out to clients, the first matching rule wins.
+func (m Manager) rewriteDatabase(database db.Database, namespace string) db.Database {
+	database.Config = m.clientRewriteRules(namespace).Apply(database.Config)
+	return database
+}
+
+func (m Manager) clientRewriteRules(namespace string) db.RewriteRules {
+	namespaceRules := m.config.NamespaceClientRewriteRules[namespace]
+	if len(namespaceRules) == 0 {
+		return m.config.ClientRewriteRules
+	}
+
+	return append(append(make(db.RewriteRules, 0, len(namespaceRules)+len(m.config.ClientRewriteRules)), namespaceRules...), m.config.ClientRewriteRules...)
+}
+
+// initHashPool inits the pool of the given template with the per template pool settings applied.
+func (m Manager) initHashPool(ctx context.Context, template *templates.Template) {
+	options := template.TemplateConfig.Options
+
+	m.pool.InitHashPoolWithConfig(ctx, template.Database, m.makeRecreateTestPoolDBFunc(options), m.templatePoolConfig(options))
+}
+
+// templatePoolConfig returns the pool config of a template with the given options.
+func (m Manager) templatePoolConfig(options templates.TemplateOptions) pool.PoolConfig {
+	cfg := m.config.PoolConfig
+	if options.MaxCloneAge > 0 {
+		cfg.TestDatabaseMaxCloneAge = options.MaxCloneAge
+	}
+	if options.MaxLeaseDuration > 0 {
+		cfg.TestDatabaseMaxLeaseDuration = options.MaxLeaseDuration
+	}
+	if options.FillConcurrency > 0 {
+		cfg.MaxParallelTasks = options.FillConcurrency
+	}
+	if options.MaxPoolSize > 0 {
+		cfg.MaxPoolSize = options.MaxPoolSize
+		if cfg.InitialPoolSize > cfg.MaxPoolSize {
+			// a default initial pool size beyond the max of the template
+			cfg.InitialPoolSize = cfg.MaxPoolSize
+		}
+	}
+	if options.InitialPoolSize > 0 {
+		// validated while initializing the template
+		cfg.InitialPoolSize = options.InitialPoolSize
+	}
+	cfg.FillPriority = options.FillPriority
+	if len(options.SelectionPolicy) > 0 {
+		// validated while initializing the template
+		cfg.SelectionPolicy = pool.SelectionPolicy(options.SelectionPolicy)
+	}
+
+	cfg.HealthCheckDB = m.checkTestPoolDBHealth
+	cfg.DropOverflowDB = m.dropTestPoolDB
+	cfg.DropIdleDB = m.dropTestPoolDB
+	if m.config.Engine == EnginePostgres {
+		// evictions keep the recently used test databases, dropping never checked out ones in their place
+		cfg.RenameIdleDB = m.renameTestPoolDB
+	}
+	cfg.InUseDB = m.checkTestPoolDBInUse
+	cfg.DropMovedDB = m.dropTestPoolDB
+
+	return cfg
+}
+
+// templateMaxPoolSize returns the max pool size of the template with the hash, overflow test databases (and the ones
+// evicted after shrinking the pool, see ResizeTemplatePool) have IDs beyond.
+func (m Manager) templateMaxPoolSize(ctx context.Context, hash string) int {
+	if template, found := m.templates.Get(ctx, hash); found {
+		return m.templatePoolConfig(template.GetConfig(ctx).Options).MaxPoolSize
+	}
+
+	return m.config.PoolConfig.MaxPoolSize
+}
+
+// checkTestPoolDBHealth connects to the test DB and runs a sanity query.
+func (m Manager) checkTestPoolDBHealth(ctx context.Context, testDB db.TestDatabase) error {
+	ctx, cancel := context.WithTimeout(ctx, m.config.TestDatabaseHealthCheckTimeout)
+	defer cancel()
+
+	conn, err := sql.Open(m.engine.DriverName(), m.engine.DSN(testDB.Config))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var one int
+	if err := conn.QueryRowContext(ctx, "SELECT 1").Scan(&one); err != nil {
+		return fmt.Errorf("health check of %s failed: %w", testDB.Config.Database, err)
+	}
+
+	return nil
+}
+
+func (m Manager) checkTestPoolDBInUse(ctx context.Context, testDB db.TestDatabase) (bool, error) {
+	return m.onTestDB(testDB).checkDatabaseConnected(ctx, testDB.Config.Database)
+}
+
+// makeRecreateTestPoolDBFunc returns the function used by the pool to (re)create test databases of a template with the given options.
+func (m Manager) makeRecreateTestPoolDBFunc(options templates.TemplateOptions) pool.RecreateDBFunc {
+	return func(ctx context.Context, testDB db.TestDatabase, templateName string) error {
+		defer m.warnSlowOperation(ctx, "recreate_test_db", testDB.Config.Database, time.Now())
+
+		if err := m.ensureTemplateCopy(ctx, testDB.ID, templateName); err != nil {
+			return err
+		}
+
+		m := m.onTestDB(testDB)
+
+		// the tablespace and settings of the clone apply to the post clone script and validation queries as well
+		ctx = withCloneOptions(ctx, testDatabaseCloneOptions(options))
+
+		if err := m.recreateTestPoolDB(ctx, testDB, templateName); err != nil {
+			return err
+		}
+
+		// before the settings of the template, which may override the search_path
+		if m.config.IsolateTestDatabases {
+			if err := m.isolateTestDatabase(ctx, testDB.Config.Database); err != nil {
+				return err
+			}
+		}
+
+		if err := m.applyDatabaseSettings(ctx, testDB.Config.Database, options.Settings); err != nil {
+			return err
+		}
+
+		if len(options.PostCloneScript) > 0 {
+			if err := m.runPostCloneScript(ctx, testDB, options.PostCloneScript); err != nil {
+				return err
+			}
+		}
+
+		if len(options.ValidationQueries) == 0 {
+			return nil
+		}
+
+		return m.validateClone(ctx, testDB, options.ValidationQueries)
+	}
+}
+
+// settingNameRegexp matches plain and custom (e.g. "myext.option") setting names.
+var settingNameRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?$`)
+
+// applyDatabaseSettings sets the default settings of all new sessions within the database.
+func (m Manager) applyDatabaseSettings(ctx context.Context, dbName string, settings map[string]string) error {
+	if len(settings) == 0 {
+		return nil
+	}
+
+	defer tracing.Region(ctx, "apply_db_settings").End()
+
+	names := make([]string, 0, len(settings))
+	for name := range settings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		// names are validated while initializing the template, setting names can't be passed as quoted identifier
+		if _, err := m.db.ExecContext(ctx, fmt.Sprintf("ALTER DATABASE %s SET %s = %s", pq.QuoteIdentifier(dbName), name, pq.QuoteLiteral(settings[name]))); err != nil {
+			return fmt.Errorf("failed to set %s: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// runPostCloneScript executes the script within the given (just recreated) test database.
+// The seed of the test database is persisted as database setting 'integresql.seed' beforehand.
+func (m Manager) runPostCloneScript(ctx context.Context, testDB db.TestDatabase, script string) error {
+
+	defer tracing.Region(ctx, "post_clone_script").End()
+
+	log := m.getManagerLogger(ctx, "runPostCloneScript").With().Str("dbName", testDB.Config.Database).Int64("seed", testDB.Seed).Logger()
+	log.Trace().Msg("running post clone script...")
+
+	seed := strconv.FormatInt(testDB.Seed, 10)
+	if _, err := m.db.ExecContext(ctx, fmt.Sprintf("ALTER DATABASE %s SET integresql.seed = %s", pq.QuoteIdentifier(testDB.Config.Database), pq.QuoteLiteral(seed))); err != nil {
+		log.Error().Err(err).Msg("failed to set seed")
+		return err
+	}
+
+	conn, err := sql.Open("postgres", cloneSessionConfig(testDB.Config, cloneOptionsFrom(ctx).settings).ConnectionString())
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, script); err != nil {
+		log.Error().Err(err).Msg("post clone script failed")
+		return err
+	}
+
+	return nil
 }
 
 func (m Manager) dropTestPoolDB(ctx context.Context, testDB db.TestDatabase) error {
-	return m.dropDatabase(ctx, testDB.Config.Database)
+	if err := m.onTestDB(testDB).dropDatabase(ctx, testDB.Config.Database); err != nil {
+		return err
+	}
+
+	// the name is reused by the next test database with the same ID
+	m.soak.Forget(testDB.Config.Database)
+	m.owners.Set(testDB.Config.Database, "")
+
+	return nil
+}
+
+// renameTestPoolDB renames the test database while evicting the pool (see pool.PoolConfig.RenameIdleDB), the state
+// tracked by its name moves along with it.
+func (m Manager) renameTestPoolDB(ctx context.Context, testDB db.TestDatabase, name string) error {
+	if err := m.onTestDB(testDB).renameDatabase(ctx, testDB.Config.Database, name); err != nil {
+		return err
+	}
+
+	m.soak.Rename(testDB.Config.Database, name)
+	m.owners.Rename(testDB.Config.Database, name)
+
+	return nil
 }
 
 func (m Manager) dropDatabase(ctx context.Context, dbName string) error {
 
-	defer trace.StartRegion(ctx, "drop_db").End()
+	defer tracing.Region(ctx, "drop_db").End()
+	defer m.warnSlowOperation(ctx, "drop_db", dbName, time.Now())
+
+	err := m.withAdvisoryLock(ctx, advisoryLockClassDrops, dbName, func() error {
+		err := m.execDropDatabase(ctx, dbName)
+		if m.config.ForceDropDatabase && errors.Is(err, pool.ErrTestDBInUse) {
+			err = m.dropDatabaseTerminatingBackends(ctx, dbName, err)
+		}
+
+		return err
+	})
+
+	m.ddlCounts.record(ddlDrop, err)
+
+	return err
+}
+
+// object_in_use, e.g. "database ... is being accessed by other users"
+const pqCodeObjectInUse = "55006"
+
+func (m Manager) execDropDatabase(ctx context.Context, dbName string) error {
 
 	log := m.getManagerLogger(ctx, "dropDatabase")
-	log.Trace().Msgf("DROP DATABASE IF EXISTS %s\n", pq.QuoteIdentifier(dbName))
 
-	if _, err := m.db.ExecContext(ctx, fmt.Sprintf("DROP DATABASE IF EXISTS %s", pq.QuoteIdentifier(dbName))); err != nil {
-		if strings.Contains(err.Error(), "is being accessed by other users") {
-			return pool.ErrTestDBInUse
+	var err error
+	if len(m.config.DDLFunctions.DropDatabase) > 0 {
+		log.Trace().Msgf("SELECT %s(%s)\n", m.config.DDLFunctions.DropDatabase, dbName)
+		err = m.callDDLFunction(ctx, m.config.DDLFunctions.DropDatabase, dbName)
+	} else {
+		log.Trace().Str("dbName", dbName).Bool("force", m.forceDropSupported()).Msg("dropping database")
+		err = m.engine.DropDatabase(ctx, m.db, dbName, m.forceDropSupported())
+	}
+
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == pqCodeObjectInUse {
+			return db.WrapOp(pool.ErrTestDBInUse, "drop_db", "", dbName)
 		}
 
-		return err
+		return db.WrapOp(err, "drop_db", "", dbName)
 	}
 
 	return nil
@@ -575,10 +1878,82 @@ func (m Manager) dropAndCreateDatabase(ctx context.Context, dbName string, owner
 	return m.createDatabase(ctx, dbName, owner, template)
 }
 
+// templateDatabaseConfig returns the config of the template database with the given name on the target cluster.
+func (m Manager) templateDatabaseConfig(dbName string) db.DatabaseConfig {
+	return db.DatabaseConfig{
+		Host:     m.config.TargetDatabaseConfig.Host,
+		Port:     m.config.TargetDatabaseConfig.Port,
+		Username: m.config.TargetDatabaseConfig.Username,
+		Password: m.config.TargetDatabaseConfig.Password,
+		Database: dbName,
+
+		// clients connect with the TLS settings of the manager
+		SSLMode:     m.config.TargetDatabaseConfig.SSLMode,
+		SSLRootCert: m.config.TargetDatabaseConfig.SSLRootCert,
+		SSLCert:     m.config.TargetDatabaseConfig.SSLCert,
+		SSLKey:      m.config.TargetDatabaseConfig.SSLKey,
+	}
+}
+
+// wrapTemplateOp adds the context of the operation on the template with the hash to err, see db.OpError.
+func (m Manager) wrapTemplateOp(err error, op string, hash string) error {
+	if err == nil {
+		return nil
+	}
+
+	return db.WrapOp(err, op, hash, m.makeTemplateDatabaseName(hash))
+}
+
+// wrapTestDatabaseOp adds the context of the operation on the test database with the ID to err, see db.OpError.
+func (m Manager) wrapTestDatabaseOp(err error, op string, hash string, id int) error {
+	if err == nil {
+		return nil
+	}
+
+	return db.WrapOp(err, op, hash, m.pool.MakeDBName(hash, id))
+}
+
 func (m Manager) makeTemplateDatabaseName(hash string) string {
 	return fmt.Sprintf("%s_%s_%s", m.config.DatabasePrefix, m.config.TemplateDatabasePrefix, hash)
 }
 
+// splitTestDatabaseName returns the hash and ID of a test database name (PREFIX_HASH_ID), see pool.MakeDBName.
+func splitTestDatabaseName(prefix string, dbName string) (hash string, id int, ok bool) {
+	if !strings.HasPrefix(dbName, prefix) {
+		return "", 0, false
+	}
+
+	hashAndID := strings.TrimPrefix(dbName, prefix)
+	i := strings.LastIndex(hashAndID, "_")
+	if i <= 0 {
+		return "", 0, false
+	}
+
+	id, err := strconv.Atoi(hashAndID[i+1:])
+	if err != nil {
+		return "", 0, false
+	}
+
+	return hashAndID[:i], id, true
+}
+
+// initializeDropPattern is the LIKE pattern of the test databases of previous runs dropped by Initialize.
+func (m Manager) initializeDropPattern() string {
+	return fmt.Sprintf("%s_%s_%%", m.config.DatabasePrefix, m.config.PoolConfig.TestDBNamePrefix)
+}
+
+// warnSlowOperation warns about the operation on the template or database started at start if it took longer than the
+// SlowOperationThreshold. Meant to be deferred.
+func (m Manager) warnSlowOperation(ctx context.Context, operation string, name string, start time.Time) {
+	duration := time.Since(start)
+	if m.config.SlowOperationThreshold <= 0 || duration < m.config.SlowOperationThreshold {
+		return
+	}
+
+	log := m.getManagerLogger(ctx, "warnSlowOperation")
+	log.Warn().Str("operation", operation).Str("name", name).Dur("duration", duration).Dur("threshold", m.config.SlowOperationThreshold).Msg("slow operation")
+}
+
 func (m Manager) getManagerLogger(ctx context.Context, managerFunction string) zerolog.Logger {
-	return util.LogFromContext(ctx).With().Str("managerFn", managerFunction).Logger()
+	return util.LogFromContextWith(ctx, m.config.Logger).With().Str("managerFn", managerFunction).Logger()
 }
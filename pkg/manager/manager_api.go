@@ -0,0 +1,56 @@
+package manager
+
+import (
+	"context"
+	"time"
+
+	"github.com/allaboutapps/integresql/pkg/db"
+	"github.com/allaboutapps/integresql/pkg/events"
+	"github.com/allaboutapps/integresql/pkg/pool"
+	"github.com/allaboutapps/integresql/pkg/templates"
+)
+
+// ManagerAPI is the contract between the HTTP server and the manager (template lifecycle, test database lifecycle and stats).
+// Alternative backends (e.g. mocks) may be wired into the server by implementing it, *Manager is the default implementation.
+type ManagerAPI interface {
+	Ready() bool
+	Disconnect(ctx context.Context, ignoreCloseError bool) error
+
+	// template lifecycle
+	InitializeTemplateDatabaseWithOptions(ctx context.Context, hash string, options templates.TemplateOptions) (db.TemplateDatabase, error)
+	FinalizeTemplateDatabase(ctx context.Context, hash string) (db.TemplateDatabase, error)
+	DiscardTemplateDatabase(ctx context.Context, hash string) error
+	BootstrapTemplateDatabase(ctx context.Context, hash string, options templates.TemplateOptions) (db.TemplateDatabase, error)
+
+	// test database lifecycle
+	GetTestDatabase(ctx context.Context, hash string) (db.TestDatabase, error)
+	GetTestDatabaseWithOptions(ctx context.Context, hash string, options TestDatabaseOptions) (db.TestDatabase, error)
+	ReturnTestDatabase(ctx context.Context, hash string, id int) error
+	RecreateTestDatabase(ctx context.Context, hash string, id int) error
+	RenewTestDatabase(ctx context.Context, hash string, id int) (pool.Lease, error)
+	ExplainGetTestDatabase(ctx context.Context, hash string, options TestDatabaseOptions) (AcquireExplanation, error)
+
+	// admin
+	ListTemplates(ctx context.Context) ([]TrackedTemplate, error)
+	ResetAllTracking(ctx context.Context) error
+	ResetTrackingWithLabel(ctx context.Context, label string) error
+	DropAllDatabases(ctx context.Context) error
+	MigratePrefixes(ctx context.Context, from PrefixScheme, dryRun bool) (PrefixMigrationSummary, error)
+	MigrateTemplate(ctx context.Context, hash string, host string) (TemplateMigration, error)
+	TemplateMigrationStatus(ctx context.Context, hash string) (TemplateMigration, error)
+	ResizeTemplatePool(ctx context.Context, hash string, initialPoolSize int, maxPoolSize int) (pool.PoolSize, error)
+	FreezeTestDatabase(ctx context.Context, hash string, id int) (pool.FrozenTestDatabase, error)
+	UnfreezeTestDatabase(ctx context.Context, hash string, id int) error
+	Stats(ctx context.Context) (Stats, error)
+	StatsHistory(ctx context.Context, since time.Time, step time.Duration) ([]StatsTrendPoint, error)
+	RecentEvents(ctx context.Context) []events.Event
+	Diagnostics(ctx context.Context) (Diagnostics, error)
+	Capacity(ctx context.Context) (Capacity, error)
+	ShutdownReport(ctx context.Context) (ShutdownReport, error)
+	ScheduledTasks(ctx context.Context) []ScheduledTask
+	ScheduleTask(ctx context.Context, task ScheduledTask) (ScheduledTask, error)
+	UnscheduleTask(ctx context.Context, id int) error
+	RunScheduledTask(ctx context.Context, id int) (ScheduledTask, error)
+}
+
+var _ ManagerAPI = (*Manager)(nil)
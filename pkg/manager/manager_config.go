@@ -2,24 +2,129 @@ package manager
 
 import (
 	"runtime"
+	"strings"
 	"time"
 
 	"github.com/allaboutapps/integresql/pkg/db"
+	"github.com/allaboutapps/integresql/pkg/oci"
 	"github.com/allaboutapps/integresql/pkg/pool"
+	"github.com/allaboutapps/integresql/pkg/pooler"
 	"github.com/allaboutapps/integresql/pkg/util"
+	"github.com/allaboutapps/integresql/pkg/webhook"
+	"github.com/rs/zerolog/log"
 )
 
 // we explicitly want to access this struct via manager.ManagerConfig, thus we disable revive for the next line
 type ManagerConfig struct { //nolint:revive
 	ManagerDatabaseConfig    db.DatabaseConfig `json:"-"` // sensitive
+	TargetDatabaseConfig     db.DatabaseConfig `json:"-"` // sensitive, server template and test databases are created on (e.g. a shared database server), defaults to the ManagerDatabaseConfig
 	TemplateDatabaseTemplate string
 
+	SourceDatabaseConfig db.DatabaseConfig `json:"-"` // sensitive, cluster templates with a source database are copied from (e.g. a readonly standby), defaults to the TargetDatabaseConfig cluster
+	PgDumpPath           string            // pg_dump binary used for copying source databases
+	PgRestorePath        string            // pg_restore binary used for copying source databases
+	CloneStrategy        CloneStrategy     // How test databases are cloned from their template (CREATE DATABASE ... TEMPLATE or pg_dump | pg_restore)
+	Engine               Engine            // Database server the databases are managed on (PostgreSQL, MySQL/MariaDB or CockroachDB)
+	MySQLPath            string            // mysql binary used for cloning test databases with EngineMySQL
+	MySQLDumpPath        string            // mysqldump binary used for cloning test databases with EngineMySQL
+	CockroachBackupURI   string            // Collection URI templates are backed up into with EngineCockroach, test databases are restored from it
+	ShardHosts           []string          // Further servers ("host:port") the test databases are striped across besides the TargetDatabaseConfig (sharing its credentials), see PoolConfig.ShardRouting
+
 	DatabasePrefix            string
 	TemplateDatabasePrefix    string
 	TestDatabaseOwner         string
 	TestDatabaseOwnerPassword string        `json:"-"` // sensitive
+	ManagedRolePrefix         string        // Roles with this prefix (e.g. created per template by populating scripts) are dropped by Initialize and ResetAllTracking (empty disables it)
 	TemplateFinalizeTimeout   time.Duration // Time to wait for a template to transition into the 'finalized' state
 	TestDatabaseGetTimeout    time.Duration // Time to wait for a ready database
+	DeadlineHintMargin        time.Duration // Waits are capped to the client deadline (see WithDeadlineHint) minus this margin, leaving time to deliver the error response
+
+	TestDatabaseOwnerAllowlist []string `json:"-"` // Roles ("role" or "role:password", sensitive) test databases may be handed out owned by instead of the TestDatabaseOwner, see TestDatabaseOptions.Owner
+
+	TestDatabaseHealthCheckTimeout time.Duration // Time to wait for the health check (connect + sanity query) of a test database, see PoolConfig.TestDatabaseHealthCheckOnAcquire
+
+	Logger                 util.Logger   `json:"-"` // Optional logger receiving all log entries of the manager and its pools (instead of the global zerolog logger)
+	SlowOperationThreshold time.Duration // Warn about acquiring, creating, recreating or dropping a database taking longer than this (0 disables it)
+
+	DDLFunctions DDLFunctions // Create/drop/rename databases via these SQL functions instead of raw DDL (e.g. without CREATEDB privilege)
+
+	ForceDropDatabase bool // Drop databases with leaked connections: DROP DATABASE ... WITH (FORCE) on PostgreSQL 13+, terminating their backends and retrying otherwise
+	// Serialize creating templates, dropping databases and the startup cleanup with other instances sharing the server via
+	// advisory locks. Only the first running instance drops the test databases of previous runs in Initialize.
+	AdvisoryLocks bool
+	// Persist the finalized templates and the states of their test databases to the "integresql" schema of the manager
+	// database, Initialize readopts them after a restart (instead of orphaning them).
+	TrackingSchema       bool
+	TrackingSyncInterval time.Duration // Interval of persisting the tracked state, see TrackingSchema
+	// Without TrackingSchema, Initialize discovers the template and test databases of previous runs by their names and
+	// readopts them (instead of orphaning them), see scanRecoverable.
+	RecoveryScan bool
+
+	TemplateDiscardWaitTimeout time.Duration // Wait up to this duration for clones (and connections) blocking a discarded template database to finish (0 fails right away)
+	TemplateReplicas           int           // Number of replicas of each finalized template, test databases are cloned round-robin from the template and its replicas (0 disables it)
+
+	IsolateTestDatabases bool   // Revoke CONNECT/TEMPORARY from PUBLIC on templates and test databases and CREATE on the schemas of templates
+	IsolatedSearchPath   string // Comma separated search_path pinned on each isolated test database (empty keeps the server default)
+
+	ClientRewriteRules          db.RewriteRules            // Rewrites host/port of all database configs handed out to clients (e.g. reaching Postgres through a forwarded port)
+	NamespaceClientRewriteRules map[string]db.RewriteRules // Rewrites host/port of the configs of the templates of a namespace (see templates.TemplateOptions.Namespace), take precedence over the ClientRewriteRules
+
+	EphemeralTemplateIdleTimeout time.Duration // Ephemeral templates are discarded after their pool was idle (no checked out databases) for this duration
+
+	TemplateTTL              time.Duration // Templates are discarded this duration after their initialization, deferred while test databases are checked out (0 disables it, see templates.TemplateOptions.TTL)
+	TemplateTTLCheckInterval time.Duration // Interval of checking all templates for expired ones
+
+	TemplateDriftCheckInterval time.Duration // Periodically compare the schema/row count fingerprint of finalized templates against the one captured while finalizing (0 disables it)
+	TemplateDriftQuarantine    bool          // Quarantine drifted templates: they are untracked and their test databases removed
+
+	RuntimeHealthCheckInterval time.Duration // Interval of comparing the Go runtime stats of the server against the thresholds below (only if any is set)
+	RuntimeMaxGoroutines       int           // Warn if the server runs more goroutines (0 disables it)
+	RuntimeMaxHeapBytes        uint64        // Warn if the allocated heap exceeds this size (0 disables it)
+	RuntimeMaxGCPause          time.Duration // Warn if a GC pause exceeds this duration (0 disables it)
+
+	StatsHistoryResolution time.Duration // Interval of sampling the utilization of all pools, retrievable as trend via StatsHistory (0 disables it)
+	StatsHistoryRetention  time.Duration // Samples older than this are dropped
+
+	Pooler                   pooler.Config // Config generation of a connection pooler sidecar routing aliases to the checked out test databases
+	PoolerConfigSyncInterval time.Duration // Interval of syncing the pooler config (e.g. removing returned test databases), checkouts are synced immediately
+
+	LatestAliasMetadataKey string // Templates with this metadata key are acquirable via the alias "latest:<value>" (empty disables aliases)
+
+	TemplateBackupDir          string   // Templates are dumped into this directory before discarding them (empty disables backups)
+	TemplateBackupRetention    int      // Number of backups kept per template hash, older ones are removed (<= 0 keeps all)
+	TemplateDumpDir            string   // Templates with the source kind "dump" are restored from files within this directory (empty disables it), defaults to the TemplateBackupDir
+	TemplateRestoreCheckpoints bool     // Restore dumps section by section (each within a single transaction), a retried initialization resumes after the last completed section
+	TemplateAdoptableDatabases []string // Databases on the manager cluster templates with the source kind "existing" may adopt (empty disables it), the maintenance, root template, manager and target databases are never adoptable
+
+	CapacityDiskLimitBytes int64 // Disk available to the server, enables the disk dimension of the capacity headroom (0 disables it)
+	CapacityMaxDatabases   int   // Max number of managed databases, enables the databases dimension of the capacity headroom (0 disables it)
+
+	TemplateUsageFile        string        // Acquisitions per template are persisted to this JSON file (empty disables it)
+	StartupPrebuildTemplates int           // Number of the most acquired templates (according to the TemplateUsageFile) prebuilt on startup, see PrebuildTemplates
+	ScheduleFile             string        // Recurring admin tasks (see ScheduleTask) are persisted to this JSON file (empty keeps them in memory only)
+	StartupPrebuildTimeout   time.Duration // Time to wait for the prebuilt templates before serving anyway
+
+	// Base64 AES-256 keys sealing the persisted state (TemplateUsageFile, ScheduleFile, template options of the
+	// TrackingSchema) at rest, the first one seals, all of them open (key rotation), see encryption.Keyring. Empty keeps it in plaintext.
+	StateEncryptionKeys []string `json:"-"` // sensitive
+	// Base64 AES-256 keys per namespace (see templates.TemplateOptions.Namespace) sealing the template options of the
+	// TrackingSchema of its templates instead of the StateEncryptionKeys, the first one of each namespace seals.
+	NamespaceStateEncryptionKeys map[string][]string `json:"-"` // sensitive
+
+	SoakInvariantCheck bool // Stamp each handed out test database with a marker and verify it's gone on its next handout (e.g. in staging)
+
+	MaxTemplatesPerNamespace  int      // Max number of templates tracked per namespace (see templates.TemplateOptions.Namespace), further ones are rejected with a TemplateQuotaError (0 disables it)
+	TemplateSharingNamespaces []string // Namespaces sharing templates (same hash) with each other ("*" for all, the default), initializing a template tracked by another namespace fails with ErrTemplateNamespaceConflict otherwise
+
+	OCI              oci.Config // Registry distributing template dumps as OCI artifacts tagged by hash, see the "oci" source kind
+	OCIExport        bool       // Push the dump of each finalized (non-ephemeral) template to the registry
+	OCIPullOnAcquire bool       // Acquiring a test database of an unknown template initializes it from the artifact tagged with its hash
+
+	Webhook webhook.Config // Delivery of the ready/failed webhooks registered with templates (see templates.TemplateOptions.ReadyWebhook)
+
+	StaleCheckoutAlertAfter    time.Duration // Alert about test databases checked out longer than this without renewing their lease, e.g. held by stuck CI jobs (0 disables it, see templates.TemplateOptions.StaleCheckoutAlertAfter)
+	StaleCheckoutWebhook       string        // URL notified via POST about stale checkouts of all templates (empty only emits events)
+	StaleCheckoutCheckInterval time.Duration // Interval of checking the checkouts of all templates for stale ones
 
 	PoolConfig pool.PoolConfig
 }
@@ -41,10 +146,53 @@ func DefaultManagerConfigFromEnv() ManagerConfig {
 			// we can't use a connection to a template/test db as these dbs may be dropped/recreated
 			// thus typically this should just be the default "postgres" db
 			Database: util.GetEnv("INTEGRESQL_PGDATABASE", "postgres"),
+
+			// TLS of the connections, passed through to the configs of the template and test databases returned to clients
+			SSLMode:     util.GetEnv("INTEGRESQL_PGSSLMODE", util.GetEnv("PGSSLMODE", "")),
+			SSLRootCert: util.GetEnv("INTEGRESQL_PGSSLROOTCERT", util.GetEnv("PGSSLROOTCERT", "")),
+			SSLCert:     util.GetEnv("INTEGRESQL_PGSSLCERT", util.GetEnv("PGSSLCERT", "")),
+			SSLKey:      util.GetEnv("INTEGRESQL_PGSSLKEY", util.GetEnv("PGSSLKEY", "")),
+		},
+
+		// template and test databases may be created on another server (e.g. when running as sidecar)
+		// all unset values fall back to the ManagerDatabaseConfig
+		TargetDatabaseConfig: db.DatabaseConfig{
+			Host:     util.GetEnv("INTEGRESQL_TARGET_PGHOST", ""),
+			Port:     util.GetEnvAsInt("INTEGRESQL_TARGET_PGPORT", 0),
+			Username: util.GetEnv("INTEGRESQL_TARGET_PGUSER", ""),
+			Password: util.GetEnv("INTEGRESQL_TARGET_PGPASSWORD", ""),
+			Database: util.GetEnv("INTEGRESQL_TARGET_PGDATABASE", ""),
+
+			SSLMode:     util.GetEnv("INTEGRESQL_TARGET_PGSSLMODE", ""),
+			SSLRootCert: util.GetEnv("INTEGRESQL_TARGET_PGSSLROOTCERT", ""),
+			SSLCert:     util.GetEnv("INTEGRESQL_TARGET_PGSSLCERT", ""),
+			SSLKey:      util.GetEnv("INTEGRESQL_TARGET_PGSSLKEY", ""),
 		},
 
 		TemplateDatabaseTemplate: util.GetEnv("INTEGRESQL_ROOT_TEMPLATE", "template0"),
 
+		// templates may be copied from another cluster (e.g. a readonly standby synced from production)
+		// all unset values fall back to the TargetDatabaseConfig
+		SourceDatabaseConfig: db.DatabaseConfig{
+			Host:     util.GetEnv("INTEGRESQL_SOURCE_PGHOST", ""),
+			Port:     util.GetEnvAsInt("INTEGRESQL_SOURCE_PGPORT", 0),
+			Username: util.GetEnv("INTEGRESQL_SOURCE_PGUSER", ""),
+			Password: util.GetEnv("INTEGRESQL_SOURCE_PGPASSWORD", ""),
+
+			SSLMode:     util.GetEnv("INTEGRESQL_SOURCE_PGSSLMODE", ""),
+			SSLRootCert: util.GetEnv("INTEGRESQL_SOURCE_PGSSLROOTCERT", ""),
+			SSLCert:     util.GetEnv("INTEGRESQL_SOURCE_PGSSLCERT", ""),
+			SSLKey:      util.GetEnv("INTEGRESQL_SOURCE_PGSSLKEY", ""),
+		},
+		PgDumpPath:         util.GetEnv("INTEGRESQL_PG_DUMP_PATH", "pg_dump"),
+		PgRestorePath:      util.GetEnv("INTEGRESQL_PG_RESTORE_PATH", "pg_restore"),
+		CloneStrategy:      CloneStrategy(util.GetEnv("INTEGRESQL_CLONE_STRATEGY", string(CloneStrategyAuto))),
+		Engine:             Engine(util.GetEnv("INTEGRESQL_ENGINE", string(EnginePostgres))),
+		MySQLPath:          util.GetEnv("INTEGRESQL_MYSQL_PATH", "mysql"),
+		MySQLDumpPath:      util.GetEnv("INTEGRESQL_MYSQLDUMP_PATH", "mysqldump"),
+		CockroachBackupURI: util.GetEnv("INTEGRESQL_COCKROACH_BACKUP_URI", "nodelocal://1/integresql"),
+		ShardHosts:         util.GetEnvAsStringArr("INTEGRESQL_SHARD_HOSTS", []string{}),
+
 		DatabasePrefix: util.GetEnv("INTEGRESQL_DB_PREFIX", "integresql"),
 
 		// DatabasePrefix_TemplateDatabasePrefix_HASH
@@ -53,20 +201,230 @@ func DefaultManagerConfigFromEnv() ManagerConfig {
 		// we reuse the same user (PGUSER) and passwort (PGPASSWORT) for the test / template databases by default
 		TestDatabaseOwner:         util.GetEnv("INTEGRESQL_TEST_PGUSER", util.GetEnv("INTEGRESQL_PGUSER", util.GetEnv("PGUSER", "postgres"))),
 		TestDatabaseOwnerPassword: util.GetEnv("INTEGRESQL_TEST_PGPASSWORD", util.GetEnv("INTEGRESQL_PGPASSWORD", util.GetEnv("PGPASSWORD", ""))),
+		ManagedRolePrefix:         util.GetEnv("INTEGRESQL_MANAGED_ROLE_PREFIX", ""),
+
+		// e.g. "app,app_readonly:secret", the password is returned with the config of test databases owned by the role
+		TestDatabaseOwnerAllowlist: util.GetEnvAsStringArr("INTEGRESQL_TEST_PGUSER_ALLOWLIST", []string{}),
 
 		// typically these timeouts should be the same as INTEGRESQL_ECHO_REQUEST_TIMEOUT_MS
 		// see internal/api/server_config.go
 		TemplateFinalizeTimeout: time.Millisecond * time.Duration(util.GetEnvAsInt("INTEGRESQL_TEMPLATE_FINALIZE_TIMEOUT_MS", util.GetEnvAsInt("INTEGRESQL_ECHO_REQUEST_TIMEOUT_MS", 60*1000 /*1 min*/))),
 		TestDatabaseGetTimeout:  time.Millisecond * time.Duration(util.GetEnvAsInt("INTEGRESQL_TEST_DB_GET_TIMEOUT_MS", util.GetEnvAsInt("INTEGRESQL_ECHO_REQUEST_TIMEOUT_MS", 60*1000 /*1 min*/))),
+		DeadlineHintMargin:      time.Millisecond * time.Duration(util.GetEnvAsInt("INTEGRESQL_DEADLINE_HINT_MARGIN_MS", 250)),
+
+		TestDatabaseHealthCheckTimeout: time.Millisecond * time.Duration(util.GetEnvAsInt("INTEGRESQL_TEST_DB_HEALTH_CHECK_TIMEOUT_MS", 1000*2 /*2 sec*/)),
+
+		SlowOperationThreshold: time.Millisecond * time.Duration(util.GetEnvAsInt("INTEGRESQL_SLOW_OPERATION_THRESHOLD_MS", 1000*5 /*5 sec*/)),
+
+		DDLFunctions: DDLFunctions{
+			CreateDatabase: util.GetEnv("INTEGRESQL_DDL_CREATE_DATABASE_FUNCTION", ""),
+			DropDatabase:   util.GetEnv("INTEGRESQL_DDL_DROP_DATABASE_FUNCTION", ""),
+			RenameDatabase: util.GetEnv("INTEGRESQL_DDL_RENAME_DATABASE_FUNCTION", ""),
+		},
+
+		ForceDropDatabase: util.GetEnvAsBool("INTEGRESQL_FORCE_DROP_DATABASE", false),
+		AdvisoryLocks:     util.GetEnvAsBool("INTEGRESQL_ADVISORY_LOCKS", false),
+
+		TrackingSchema:       util.GetEnvAsBool("INTEGRESQL_TRACKING_SCHEMA", false),
+		TrackingSyncInterval: time.Millisecond * time.Duration(util.GetEnvAsInt("INTEGRESQL_TRACKING_SYNC_INTERVAL_MS", 1000*1 /*1 sec*/)),
+		RecoveryScan:         util.GetEnvAsBool("INTEGRESQL_RECOVERY_SCAN", false),
+
+		TemplateDiscardWaitTimeout: time.Millisecond * time.Duration(util.GetEnvAsInt("INTEGRESQL_TEMPLATE_DISCARD_WAIT_TIMEOUT_MS", 0)),
+		TemplateReplicas:           util.GetEnvAsInt("INTEGRESQL_TEMPLATE_REPLICAS", 0),
+
+		IsolateTestDatabases: util.GetEnvAsBool("INTEGRESQL_ISOLATE_TEST_DATABASES", false),
+		IsolatedSearchPath:   util.GetEnv("INTEGRESQL_ISOLATED_SEARCH_PATH", "public"),
+
+		// e.g. "*:5432=localhost:15432,db.internal=db.example.com", see db.ParseRewriteRule
+		ClientRewriteRules: rewriteRulesFromEnv("INTEGRESQL_CLIENT_REWRITE_RULES"),
+		// e.g. "team-a@*:5432=pgbouncer-a:6432,team-b@*=:16432", see db.ParseNamespaceRewriteRule
+		NamespaceClientRewriteRules: namespaceRewriteRulesFromEnv("INTEGRESQL_NAMESPACE_CLIENT_REWRITE_RULES"),
+
+		EphemeralTemplateIdleTimeout: time.Millisecond * time.Duration(util.GetEnvAsInt("INTEGRESQL_EPHEMERAL_TEMPLATE_IDLE_TIMEOUT_MS", 1000*60*5 /*5 min*/)),
+
+		TemplateTTL:              time.Millisecond * time.Duration(util.GetEnvAsInt("INTEGRESQL_TEMPLATE_TTL_MS", 0 /*disabled*/)),
+		TemplateTTLCheckInterval: time.Millisecond * time.Duration(util.GetEnvAsInt("INTEGRESQL_TEMPLATE_TTL_CHECK_INTERVAL_MS", 1000*60 /*1 min*/)),
+
+		TemplateDriftCheckInterval: time.Millisecond * time.Duration(util.GetEnvAsInt("INTEGRESQL_TEMPLATE_DRIFT_CHECK_INTERVAL_MS", 0 /*disabled*/)),
+		TemplateDriftQuarantine:    util.GetEnvAsBool("INTEGRESQL_TEMPLATE_DRIFT_QUARANTINE", false),
+
+		RuntimeHealthCheckInterval: time.Millisecond * time.Duration(util.GetEnvAsInt("INTEGRESQL_RUNTIME_HEALTH_CHECK_INTERVAL_MS", 1000*10 /*10 sec*/)),
+		RuntimeMaxGoroutines:       util.GetEnvAsInt("INTEGRESQL_RUNTIME_MAX_GOROUTINES", 0 /*disabled*/),
+		RuntimeMaxHeapBytes:        uint64(util.GetEnvAsInt("INTEGRESQL_RUNTIME_MAX_HEAP_MB", 0 /*disabled*/)) * 1024 * 1024,
+		RuntimeMaxGCPause:          time.Millisecond * time.Duration(util.GetEnvAsInt("INTEGRESQL_RUNTIME_MAX_GC_PAUSE_MS", 0 /*disabled*/)),
+
+		StatsHistoryResolution: time.Millisecond * time.Duration(util.GetEnvAsInt("INTEGRESQL_STATS_HISTORY_RESOLUTION_MS", 1000*60 /*1 min*/)),
+		StatsHistoryRetention:  time.Millisecond * time.Duration(util.GetEnvAsInt("INTEGRESQL_STATS_HISTORY_RETENTION_MS", 1000*60*60*24 /*24 h*/)),
+
+		Pooler: pooler.Config{
+			Kind:      pooler.Kind(util.GetEnv("INTEGRESQL_POOLER_KIND", string(pooler.KindPgBouncer))), // "pgbouncer" or "pgcat"
+			File:      util.GetEnv("INTEGRESQL_POOLER_CONFIG_FILE", ""),
+			BaseFile:  util.GetEnv("INTEGRESQL_POOLER_BASE_CONFIG_FILE", ""),
+			ReloadDSN: util.GetEnv("INTEGRESQL_POOLER_RELOAD_DSN", ""),
+			PoolMode:  util.GetEnv("INTEGRESQL_POOLER_POOL_MODE", "session"),
+			PoolSize:  util.GetEnvAsInt("INTEGRESQL_POOLER_POOL_SIZE", 5),
+		},
+		PoolerConfigSyncInterval: time.Millisecond * time.Duration(util.GetEnvAsInt("INTEGRESQL_POOLER_CONFIG_SYNC_INTERVAL_MS", 1000 /*1 sec*/)),
+
+		LatestAliasMetadataKey: util.GetEnv("INTEGRESQL_LATEST_ALIAS_METADATA_KEY", "branch"),
+
+		TemplateBackupDir:       util.GetEnv("INTEGRESQL_TEMPLATE_BACKUP_DIR", ""),
+		TemplateBackupRetention: util.GetEnvAsInt("INTEGRESQL_TEMPLATE_BACKUP_RETENTION", 3),
+		TemplateDumpDir:         util.GetEnv("INTEGRESQL_TEMPLATE_DUMP_DIR", util.GetEnv("INTEGRESQL_TEMPLATE_BACKUP_DIR", "")),
+
+		TemplateRestoreCheckpoints: util.GetEnvAsBool("INTEGRESQL_TEMPLATE_RESTORE_CHECKPOINTS", false),
+		TemplateAdoptableDatabases: util.GetEnvAsStringArr("INTEGRESQL_TEMPLATE_ADOPTABLE_DATABASES", []string{}),
+
+		CapacityDiskLimitBytes: int64(util.GetEnvAsInt("INTEGRESQL_CAPACITY_DISK_LIMIT_MB", 0 /*disabled*/)) * 1024 * 1024,
+		CapacityMaxDatabases:   util.GetEnvAsInt("INTEGRESQL_CAPACITY_MAX_DATABASES", 0 /*disabled*/),
+
+		TemplateUsageFile:        util.GetEnv("INTEGRESQL_TEMPLATE_USAGE_FILE", ""),
+		ScheduleFile:             util.GetEnv("INTEGRESQL_SCHEDULE_FILE", ""),
+		StateEncryptionKeys:      util.GetEnvAsStringArr("INTEGRESQL_STATE_ENCRYPTION_KEYS", []string{}),
+		StartupPrebuildTemplates: util.GetEnvAsInt("INTEGRESQL_STARTUP_PREBUILD_TEMPLATES", 0 /*disabled*/),
+		StartupPrebuildTimeout:   time.Millisecond * time.Duration(util.GetEnvAsInt("INTEGRESQL_STARTUP_PREBUILD_TIMEOUT_MS", 1000*60*5 /*5 min*/)),
+
+		// e.g. "team-a@<new key>,team-a@<old key>,team-b@<key>"
+		NamespaceStateEncryptionKeys: namespaceStateEncryptionKeysFromEnv("INTEGRESQL_NAMESPACE_STATE_ENCRYPTION_KEYS"),
+
+		SoakInvariantCheck: util.GetEnvAsBool("INTEGRESQL_SOAK_INVARIANT_CHECK", false),
+
+		MaxTemplatesPerNamespace:  util.GetEnvAsInt("INTEGRESQL_MAX_TEMPLATES_PER_NAMESPACE", 0 /*disabled*/),
+		TemplateSharingNamespaces: util.GetEnvAsStringArr("INTEGRESQL_TEMPLATE_SHARING_NAMESPACES", []string{"*"}), // each runner token is a namespace, thus all of them share by default
+
+		OCI: oci.Config{
+			Registry:   util.GetEnv("INTEGRESQL_OCI_REGISTRY", ""),
+			Repository: util.GetEnv("INTEGRESQL_OCI_REPOSITORY", ""),
+			Username:   util.GetEnv("INTEGRESQL_OCI_USERNAME", ""),
+			Password:   util.GetEnv("INTEGRESQL_OCI_PASSWORD", ""),
+			PlainHTTP:  util.GetEnvAsBool("INTEGRESQL_OCI_PLAIN_HTTP", false),
+		},
+		OCIExport:        util.GetEnvAsBool("INTEGRESQL_OCI_EXPORT", false),
+		OCIPullOnAcquire: util.GetEnvAsBool("INTEGRESQL_OCI_PULL_ON_ACQUIRE", false),
+
+		Webhook: webhook.Config{
+			Secret:   util.GetEnv("INTEGRESQL_WEBHOOK_SECRET", ""),
+			Timeout:  time.Millisecond * time.Duration(util.GetEnvAsInt("INTEGRESQL_WEBHOOK_TIMEOUT_MS", 1000*5 /*5 sec*/)),
+			Attempts: util.GetEnvAsInt("INTEGRESQL_WEBHOOK_ATTEMPTS", 3),
+			Backoff:  time.Millisecond * time.Duration(util.GetEnvAsInt("INTEGRESQL_WEBHOOK_BACKOFF_MS", 1000 /*1 sec*/)),
+		},
+
+		StaleCheckoutAlertAfter:    time.Millisecond * time.Duration(util.GetEnvAsInt("INTEGRESQL_STALE_CHECKOUT_ALERT_AFTER_MS", 0 /*disabled*/)),
+		StaleCheckoutWebhook:       util.GetEnv("INTEGRESQL_STALE_CHECKOUT_WEBHOOK", ""),
+		StaleCheckoutCheckInterval: time.Millisecond * time.Duration(util.GetEnvAsInt("INTEGRESQL_STALE_CHECKOUT_CHECK_INTERVAL_MS", 1000*30 /*30 sec*/)),
 
 		PoolConfig: pool.PoolConfig{
 			InitialPoolSize:                   util.GetEnvAsInt("INTEGRESQL_TEST_INITIAL_POOL_SIZE", runtime.NumCPU()), // previously default 10
 			MaxPoolSize:                       util.GetEnvAsInt("INTEGRESQL_TEST_MAX_POOL_SIZE", runtime.NumCPU()*4),   // previously default 500
+			MaxPoolSizeLimit:                  util.GetEnvAsInt("INTEGRESQL_TEST_MAX_POOL_SIZE_LIMIT", 0),              // growing pools at runtime, defaults to the max pool size
+			MaxOverflowSize:                   util.GetEnvAsInt("INTEGRESQL_TEST_MAX_OVERFLOW_SIZE", 0),                // temporary DBs beyond the max pool size, dropped on return
 			TestDBNamePrefix:                  util.GetEnv("INTEGRESQL_TEST_DB_PREFIX", "test"),                        // DatabasePrefix_TestDBNamePrefix_HASH_ID
 			MaxParallelTasks:                  util.GetEnvAsInt("INTEGRESQL_POOL_MAX_PARALLEL_TASKS", runtime.NumCPU()),
+			MaxParallelFills:                  util.GetEnvAsInt("INTEGRESQL_POOL_MAX_PARALLEL_FILLS", 0), // across all pools, 0 disables the limit
+			DirtyRecycleWorkers:               util.GetEnvAsInt("INTEGRESQL_POOL_DIRTY_RECYCLE_WORKERS", 0),
 			TestDatabaseRetryRecreateSleepMin: time.Millisecond * time.Duration(util.GetEnvAsInt("INTEGRESQL_TEST_DB_RETRY_RECREATE_SLEEP_MIN_MS", 250 /*250 ms*/)),
 			TestDatabaseRetryRecreateSleepMax: time.Millisecond * time.Duration(util.GetEnvAsInt("INTEGRESQL_TEST_DB_RETRY_RECREATE_SLEEP_MAX_MS", 1000*3 /*3 sec*/)),
 			TestDatabaseMinimalLifetime:       time.Millisecond * time.Duration(util.GetEnvAsInt("INTEGRESQL_TEST_DB_MINIMAL_LIFETIME_MS", 250 /*250 ms*/)),
+			TestDatabaseLeaseRenewDuration:    time.Millisecond * time.Duration(util.GetEnvAsInt("INTEGRESQL_TEST_DB_LEASE_RENEW_DURATION_MS", 30000 /*30 sec*/)),
+			TestDatabaseMaxLeaseDuration:      time.Millisecond * time.Duration(util.GetEnvAsInt("INTEGRESQL_TEST_DB_MAX_LEASE_DURATION_MS", 0 /*disabled*/)),
+			TestDatabaseLeaseDuration:         time.Millisecond * time.Duration(util.GetEnvAsInt("INTEGRESQL_TEST_DB_LEASE_DURATION_MS", 0 /*disabled*/)),
+			TestDatabaseLeaseSweepInterval:    time.Millisecond * time.Duration(util.GetEnvAsInt("INTEGRESQL_TEST_DB_LEASE_SWEEP_INTERVAL_MS", 1000 /*1 sec*/)),
+			TestDatabaseCheckoutWarnDuration:  time.Millisecond * time.Duration(util.GetEnvAsInt("INTEGRESQL_TEST_DB_CHECKOUT_WARN_DURATION_MS", 1000*60*5 /*5 min*/)),
+			TestDatabaseMaxCloneAge:           time.Millisecond * time.Duration(util.GetEnvAsInt("INTEGRESQL_TEST_DB_MAX_CLONE_AGE_MS", 0 /*disabled*/)),
+			TestDatabaseHealthCheckOnAcquire:  util.GetEnvAsBool("INTEGRESQL_TEST_DB_HEALTH_CHECK_ON_ACQUIRE", false),
+			TestDatabaseHealthCheckInterval:   time.Millisecond * time.Duration(util.GetEnvAsInt("INTEGRESQL_TEST_DB_HEALTH_CHECK_INTERVAL_MS", 0 /*disabled*/)),
+			TestDatabaseMaxIdleDuration:       time.Millisecond * time.Duration(util.GetEnvAsInt("INTEGRESQL_TEST_DB_MAX_IDLE_DURATION_MS", 0 /*disabled*/)),
+			SelectionPolicy:                   pool.SelectionPolicy(util.GetEnv("INTEGRESQL_TEST_DB_SELECTION_POLICY", string(pool.SelectionLRU))),
+			WaitStarvationFactor:              util.GetEnvAsInt("INTEGRESQL_TEST_DB_WAIT_STARVATION_FACTOR", 0 /*disabled*/),
+			CircuitBreakerThreshold:           util.GetEnvAsInt("INTEGRESQL_TEST_DB_CIRCUIT_BREAKER_THRESHOLD", 0 /*disabled*/),
+			CircuitBreakerProbeInterval:       time.Millisecond * time.Duration(util.GetEnvAsInt("INTEGRESQL_TEST_DB_CIRCUIT_PROBE_INTERVAL_MS", 1000*10 /*10 sec*/)),
+			ShardRouting:                      pool.ShardRouting(util.GetEnv("INTEGRESQL_SHARD_ROUTING", string(pool.ShardRoutingRoundRobin))),
+
+			// e.g. "* 0-6,20-23 * * 1-5;* * * * 0,6" (nights and weekends), see util.CronExpression
+			Maintenance: util.MaintenanceSchedule{
+				Windows:      cronExpressionsFromEnv("INTEGRESQL_MAINTENANCE_WINDOWS"),
+				QuietPeriods: cronExpressionsFromEnv("INTEGRESQL_MAINTENANCE_QUIET_PERIODS"),
+			},
 		},
 	}
 }
+
+// rewriteRulesFromEnv parses the comma separated rules, invalid rules are logged and skipped.
+func rewriteRulesFromEnv(key string) db.RewriteRules {
+	rules := make(db.RewriteRules, 0)
+
+	for _, val := range util.GetEnvAsStringArr(key, []string{}) {
+		rule, err := db.ParseRewriteRule(val)
+		if err != nil {
+			log.Error().Err(err).Str("key", key).Msg("Ignoring invalid rewrite rule")
+			continue
+		}
+
+		rules = append(rules, rule)
+	}
+
+	return rules
+}
+
+// namespaceRewriteRulesFromEnv parses the comma separated rules by namespace, invalid rules are logged and skipped.
+func namespaceRewriteRulesFromEnv(key string) map[string]db.RewriteRules {
+	rules := make(map[string]db.RewriteRules)
+
+	for _, val := range util.GetEnvAsStringArr(key, []string{}) {
+		namespace, rule, err := db.ParseNamespaceRewriteRule(val)
+		if err != nil {
+			log.Error().Err(err).Str("key", key).Msg("Ignoring invalid namespace rewrite rule")
+			continue
+		}
+
+		rules[namespace] = append(rules[namespace], rule)
+	}
+
+	return rules
+}
+
+// namespaceStateEncryptionKeysFromEnv parses the "<namespace>@<base64 key>" values, the keys of each namespace are kept
+// in order (the first one seals). Values without namespace are logged and skipped.
+func namespaceStateEncryptionKeysFromEnv(key string) map[string][]string {
+	keys := make(map[string][]string)
+
+	for _, val := range util.GetEnvAsStringArr(key, []string{}) {
+		// base64 never contains "@", the namespace might
+		i := strings.LastIndex(val, "@")
+		if i <= 0 {
+			log.Error().Str("key", key).Msg("Ignoring state encryption key without namespace")
+			continue
+		}
+
+		keys[val[:i]] = append(keys[val[:i]], val[i+1:])
+	}
+
+	return keys
+}
+
+// cronExpressionsFromEnv parses the ";" separated cron expressions (as "," is part of the cron syntax), invalid
+// expressions are logged and skipped.
+func cronExpressionsFromEnv(key string) []util.CronExpression {
+	exprs := make([]util.CronExpression, 0)
+
+	for _, val := range util.GetEnvAsStringArr(key, []string{}, ";") {
+		expr, err := util.ParseCronExpression(val)
+		if err != nil {
+			log.Error().Err(err).Str("key", key).Msg("Ignoring invalid cron expression")
+			continue
+		}
+
+		exprs = append(exprs, expr)
+	}
+
+	return exprs
+}
+
+// separateTarget returns true if the databases are created on another server (or as another user) than the one the
+// manager connects to via ManagerDatabaseConfig.
+func (c ManagerConfig) separateTarget() bool {
+	return c.TargetDatabaseConfig.Host != c.ManagerDatabaseConfig.Host ||
+		c.TargetDatabaseConfig.Port != c.ManagerDatabaseConfig.Port ||
+		c.TargetDatabaseConfig.Username != c.ManagerDatabaseConfig.Username ||
+		c.TargetDatabaseConfig.Database != c.ManagerDatabaseConfig.Database
+}
@@ -0,0 +1,303 @@
+//go:build integration
+
+// Integration tests verifying the concurrent correctness of the manager (and its pools) against a real PostgreSQL
+// server spun up via dockertest. Run them via `make test-integration` (or `go test -tags=integration ./pkg/manager/...`),
+// all other tests of this package run against the same server then.
+package manager_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/allaboutapps/integresql/pkg/manager"
+	"github.com/allaboutapps/integresql/pkg/pool"
+	"github.com/ory/dockertest/v3"
+	"github.com/ory/dockertest/v3/docker"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	integrationPostgresRepository = "postgres"
+	integrationPostgresTag        = "12.4-alpine" // should be the same version as used in docker-compose.yml
+	integrationPostgresPassword   = "integration"
+)
+
+func TestMain(m *testing.M) {
+	os.Exit(runWithPostgres(m))
+}
+
+// runWithPostgres starts a disposable PostgreSQL container, points the manager env config to it and runs all tests.
+func runWithPostgres(m *testing.M) int {
+	dockerPool, err := dockertest.NewPool("")
+	if err != nil {
+		log.Printf("failed to connect to docker: %v", err)
+		return 1
+	}
+
+	resource, err := dockerPool.RunWithOptions(&dockertest.RunOptions{
+		Repository: integrationPostgresRepository,
+		Tag:        integrationPostgresTag,
+		Env:        []string{"POSTGRES_PASSWORD=" + integrationPostgresPassword},
+		Cmd:        []string{"postgres", "-c", "fsync=off", "-c", "synchronous_commit=off", "-c", "full_page_writes=off", "-c", "max_connections=300"},
+	}, func(config *docker.HostConfig) {
+		config.AutoRemove = true
+		config.RestartPolicy = docker.RestartPolicy{Name: "no"}
+	})
+	if err != nil {
+		log.Printf("failed to start postgres: %v", err)
+		return 1
+	}
+
+	defer func() {
+		if err := dockerPool.Purge(resource); err != nil {
+			log.Printf("failed to purge postgres: %v", err)
+		}
+	}()
+
+	// never leave containers behind if the tests hang
+	_ = resource.Expire(10 * 60)
+
+	for key, value := range map[string]string{
+		"INTEGRESQL_PGHOST":     "127.0.0.1",
+		"INTEGRESQL_PGPORT":     resource.GetPort("5432/tcp"),
+		"INTEGRESQL_PGUSER":     "postgres",
+		"INTEGRESQL_PGPASSWORD": integrationPostgresPassword,
+	} {
+		os.Setenv(key, value)
+	}
+
+	dockerPool.MaxWait = time.Minute
+	if err := dockerPool.Retry(func() error {
+		conn, err := sql.Open("postgres", manager.DefaultManagerConfigFromEnv().ManagerDatabaseConfig.ConnectionString())
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+
+		return conn.Ping()
+	}); err != nil {
+		log.Printf("postgres did not become ready: %v", err)
+		return 1
+	}
+
+	return m.Run()
+}
+
+// integrationManager returns an initialized manager with a small pool, forcing the pool to recycle test databases.
+// Checked out test databases are never auto cleaned within the tests, thus each must be handed out exclusively.
+func integrationManager(t *testing.T) *manager.Manager {
+	t.Helper()
+
+	cfg := manager.DefaultManagerConfigFromEnv()
+	cfg.TemplateFinalizeTimeout = 5 * time.Second
+	cfg.TestDatabaseGetTimeout = 2 * time.Second
+	cfg.PoolConfig.TestDatabaseMinimalLifetime = time.Minute
+	cfg.PoolConfig.InitialPoolSize = 4
+	cfg.PoolConfig.MaxPoolSize = 8
+	cfg.PoolConfig.MaxParallelTasks = 4
+	m, _ := testManagerWithConfig(cfg)
+
+	require.NoError(t, m.Initialize(context.Background()))
+	t.Cleanup(func() {
+		require.NoError(t, m.ResetAllTracking(context.Background()))
+		disconnectManager(t, m)
+	})
+
+	return m
+}
+
+func integrationFinalizedTemplate(t *testing.T, m *manager.Manager, hash string) {
+	t.Helper()
+	ctx := context.Background()
+
+	template, err := m.InitializeTemplateDatabase(ctx, hash)
+	require.NoError(t, err)
+
+	populateTemplateDB(t, template)
+
+	_, err = m.FinalizeTemplateDatabase(ctx, hash)
+	require.NoError(t, err)
+}
+
+func TestIntegrationParallelInitializeSameHash(t *testing.T) {
+	ctx := context.Background()
+	m := integrationManager(t)
+
+	const parallel = 32
+	hash := "integrationparallelinit"
+
+	var wg sync.WaitGroup
+	errs := make(chan error, parallel)
+	for i := 0; i < parallel; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := m.InitializeTemplateDatabase(ctx, hash)
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	// invariant: exactly one caller owns the initialization
+	succeeded := 0
+	for err := range errs {
+		if err == nil {
+			succeeded++
+			continue
+		}
+		assert.ErrorIs(t, err, manager.ErrTemplateAlreadyInitialized)
+	}
+	assert.Equal(t, 1, succeeded)
+}
+
+func TestIntegrationAcquireReturnStorm(t *testing.T) {
+	ctx := context.Background()
+	m := integrationManager(t)
+
+	hash := "integrationstorm"
+	integrationFinalizedTemplate(t, m, hash)
+
+	const (
+		workers    = 16
+		iterations = 25
+	)
+
+	var mutex sync.Mutex
+	holders := make(map[int]int) // test database id -> worker
+
+	var wg sync.WaitGroup
+	errs := make(chan error, workers)
+	for w := 0; w < workers; w++ {
+		w := w
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for i := 0; i < iterations; i++ {
+				test, err := m.GetTestDatabase(ctx, hash)
+				if err != nil {
+					errs <- err
+					return
+				}
+
+				// invariant: a test database is never handed out twice at the same time
+				mutex.Lock()
+				if other, held := holders[test.ID]; held {
+					mutex.Unlock()
+					errs <- fmt.Errorf("test database %d handed out to worker %d while held by worker %d", test.ID, w, other)
+					return
+				}
+				holders[test.ID] = w
+				mutex.Unlock()
+
+				// invariant: the test database is connectable and contains the template data
+				if err := integrationCheckTestDB(ctx, test.Config.ConnectionString()); err != nil {
+					errs <- err
+					return
+				}
+
+				mutex.Lock()
+				delete(holders, test.ID)
+				mutex.Unlock()
+
+				if i%2 == 0 {
+					err = m.ReturnTestDatabase(ctx, hash, test.ID)
+				} else {
+					err = m.RecreateTestDatabase(ctx, hash, test.ID)
+				}
+				if err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		assert.NoError(t, err)
+	}
+}
+
+func TestIntegrationDiscardDuringCheckout(t *testing.T) {
+	ctx := context.Background()
+	m := integrationManager(t)
+
+	hash := "integrationdiscard"
+	integrationFinalizedTemplate(t, m, hash)
+
+	const workers = 16
+
+	var wg sync.WaitGroup
+	errs := make(chan error, workers)
+	start := make(chan struct{})
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+
+			for {
+				if _, err := m.GetTestDatabase(ctx, hash); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+
+	close(start)
+	time.Sleep(100 * time.Millisecond)
+
+	_, err := m.TeardownTemplate(ctx, hash)
+	require.NoError(t, err)
+
+	wg.Wait()
+	close(errs)
+
+	// invariant: acquisitions racing with the teardown fail cleanly, waiters of the removed (full) pool time out
+	for err := range errs {
+		if !errors.Is(err, manager.ErrTemplateNotFound) && !errors.Is(err, manager.ErrInvalidTemplateState) &&
+			!errors.Is(err, manager.ErrTemplateDiscarded) && !errors.Is(err, pool.ErrTimeout) {
+			assert.NoError(t, err)
+		}
+	}
+
+	// invariant: no databases of the template are left behind
+	conn, err := sql.Open("postgres", m.Config().ManagerDatabaseConfig.ConnectionString())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	var count int
+	require.NoError(t, conn.QueryRowContext(ctx, "SELECT count(*) FROM pg_database WHERE datname LIKE '%' || $1 || '%'", hash).Scan(&count))
+	assert.Equal(t, 0, count)
+}
+
+func integrationCheckTestDB(ctx context.Context, connectionString string) error {
+	conn, err := sql.Open("postgres", connectionString)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var count int
+	if err := conn.QueryRowContext(ctx, "SELECT count(*) FROM pilots").Scan(&count); err != nil {
+		return err
+	}
+
+	if count == 0 {
+		return errors.New("test database contains no template data")
+	}
+
+	return nil
+}
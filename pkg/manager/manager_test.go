@@ -1,16 +1,33 @@
 package manager_test
 
 import (
+	"bytes"
 	"context"
 	"database/sql"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
 	"sync"
 	"testing"
 	"time"
 
+	"github.com/allaboutapps/integresql/pkg/audit"
 	"github.com/allaboutapps/integresql/pkg/db"
+	"github.com/allaboutapps/integresql/pkg/encryption"
+	"github.com/allaboutapps/integresql/pkg/events"
 	"github.com/allaboutapps/integresql/pkg/manager"
+	"github.com/allaboutapps/integresql/pkg/metrics"
+	"github.com/allaboutapps/integresql/pkg/oci"
+	"github.com/allaboutapps/integresql/pkg/pool"
+	"github.com/allaboutapps/integresql/pkg/templates"
+	"github.com/allaboutapps/integresql/pkg/webhook"
 	"github.com/lib/pq"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -54,6 +71,121 @@ func TestManagerConnectError(t *testing.T) {
 	}
 }
 
+func TestManagerTargetDatabaseConfig(t *testing.T) {
+	t.Parallel()
+
+	managerConfig := db.DatabaseConfig{
+		Host:        "integresql-sidecar",
+		Port:        5432,
+		Username:    "manager",
+		Password:    "manager",
+		Database:    "postgres",
+		SSLMode:     "verify-full",
+		SSLRootCert: "/certs/root.pem",
+	}
+
+	m, cfg := manager.New(manager.ManagerConfig{
+		ManagerDatabaseConfig: managerConfig,
+		TargetDatabaseConfig: db.DatabaseConfig{
+			Host: "definitelydoesnotexist",
+			Port: 2345,
+		},
+		DatabasePrefix: "pgtestpool",
+	})
+
+	// unset values fall back to the manager connection, test databases and sources default to the target
+	assert.Equal(t, db.DatabaseConfig{Host: "definitelydoesnotexist", Port: 2345, Username: "manager", Password: "manager", Database: "postgres", SSLMode: "verify-full", SSLRootCert: "/certs/root.pem"}, cfg.TargetDatabaseConfig)
+	assert.Equal(t, managerConfig, cfg.ManagerDatabaseConfig)
+	assert.Equal(t, "manager", cfg.TestDatabaseOwner)
+	assert.Equal(t, "definitelydoesnotexist", cfg.SourceDatabaseConfig.Host)
+	assert.Equal(t, 2345, cfg.SourceDatabaseConfig.Port)
+	assert.Equal(t, "verify-full", cfg.SourceDatabaseConfig.SSLMode)
+
+	// databases are created on the target
+	assert.Error(t, m.Connect(context.Background()))
+	assert.False(t, m.Ready())
+}
+
+func TestManagerShardHosts(t *testing.T) {
+	t.Parallel()
+
+	target := db.DatabaseConfig{Host: "pg0", Port: 5432, Username: "manager", Password: "manager", Database: "postgres"}
+
+	shards, err := manager.ParseShardHosts(target, []string{"pg1", "pg2:5433"})
+	require.NoError(t, err)
+	require.Len(t, shards, 3)
+	assert.Equal(t, target, shards[0])
+	assert.Equal(t, db.DatabaseConfig{Host: "pg1", Port: 5432, Username: "manager", Password: "manager", Database: "postgres"}, shards[1])
+	assert.Equal(t, db.DatabaseConfig{Host: "pg2", Port: 5433, Username: "manager", Password: "manager", Database: "postgres"}, shards[2])
+
+	_, err = manager.ParseShardHosts(target, []string{"pg1:port"})
+	assert.Error(t, err)
+
+	cfg := manager.DefaultManagerConfigFromEnv()
+	cfg.ShardHosts = []string{"definitelydoesnotexist:2345"}
+	cfg.PoolConfig.ShardRouting = "random"
+	cfg.TrackingSchema = true
+	m, cfg := testManagerWithConfig(cfg)
+
+	require.Len(t, cfg.PoolConfig.Shards, 2)
+	assert.Equal(t, "definitelydoesnotexist", cfg.PoolConfig.Shards[1].Host)
+	assert.Equal(t, pool.ShardRoutingRoundRobin, cfg.PoolConfig.ShardRouting)
+
+	// test databases of previous runs on the shards can't be readopted
+	err = m.Connect(context.Background())
+	require.ErrorIs(t, err, manager.ErrShardingUnsupported)
+	assert.False(t, m.Ready())
+}
+
+func TestManagerConnectInvalidDDLFunction(t *testing.T) {
+	t.Parallel()
+
+	cfg := manager.DefaultManagerConfigFromEnv()
+	cfg.DDLFunctions.DropDatabase = "dba.drop_database; DROP TABLE users"
+	m, _ := testManagerWithConfig(cfg)
+
+	err := m.Connect(context.Background())
+	require.ErrorIs(t, err, manager.ErrInvalidDDLFunction)
+	assert.False(t, m.Ready())
+}
+
+func TestManagerConnectEngineUnsupported(t *testing.T) {
+	t.Parallel()
+
+	_, err := manager.ParseEngine("oracle")
+	assert.ErrorIs(t, err, manager.ErrInvalidEngine)
+
+	engine, err := manager.ParseEngine("")
+	require.NoError(t, err)
+	assert.Equal(t, manager.EnginePostgres, engine)
+
+	cfg := manager.DefaultManagerConfigFromEnv()
+	cfg.Engine = manager.EngineMySQL
+	cfg.TrackingSchema = true
+	m, _ := testManagerWithConfig(cfg)
+
+	err = m.Connect(context.Background())
+	require.ErrorIs(t, err, manager.ErrEngineUnsupported)
+	assert.False(t, m.Ready())
+}
+
+func TestManagerConnectEngineCockroachUnsupported(t *testing.T) {
+	t.Parallel()
+
+	engine, err := manager.ParseEngine("cockroach")
+	require.NoError(t, err)
+	assert.Equal(t, manager.EngineCockroach, engine)
+
+	cfg := manager.DefaultManagerConfigFromEnv()
+	cfg.Engine = manager.EngineCockroach
+	cfg.AdvisoryLocks = true
+	m, _ := testManagerWithConfig(cfg)
+
+	err = m.Connect(context.Background())
+	require.ErrorIs(t, err, manager.ErrEngineUnsupported)
+	assert.False(t, m.Ready())
+}
+
 func TestManagerReconnect(t *testing.T) {
 	t.Parallel()
 
@@ -523,6 +655,96 @@ func TestManagerDiscardTemplateDatabase(t *testing.T) {
 	}
 }
 
+func TestManagerDiscardTemplateDatabaseBackup(t *testing.T) {
+	ctx := context.Background()
+
+	cfg := manager.DefaultManagerConfigFromEnv()
+	cfg.TemplateFinalizeTimeout = 200 * time.Millisecond
+	cfg.TemplateBackupDir = t.TempDir()
+	cfg.TemplateBackupRetention = 2
+	m, _ := testManagerWithConfig(cfg)
+
+	if err := m.Initialize(ctx); err != nil {
+		t.Fatalf("initializing manager failed: %v", err)
+	}
+
+	defer disconnectManager(t, m)
+
+	hash := "hashinghash"
+
+	for i := 0; i < 3; i++ {
+		template, err := m.InitializeTemplateDatabase(ctx, hash)
+		require.NoError(t, err)
+
+		populateTemplateDB(t, template)
+
+		_, err = m.FinalizeTemplateDatabase(ctx, hash)
+		require.NoError(t, err)
+
+		require.NoError(t, m.DiscardTemplateDatabase(ctx, hash))
+	}
+
+	// only the most recent backups are retained
+	backups, err := filepath.Glob(filepath.Join(cfg.TemplateBackupDir, hash, "*.dump"))
+	require.NoError(t, err)
+	assert.Len(t, backups, 2)
+
+	for _, backup := range backups {
+		info, err := os.Stat(backup)
+		require.NoError(t, err)
+		assert.Greater(t, info.Size(), int64(0))
+	}
+
+	// templates not yet finalized are not backed up
+	_, err = m.InitializeTemplateDatabase(ctx, "unfinalized")
+	require.NoError(t, err)
+	require.NoError(t, m.DiscardTemplateDatabase(ctx, "unfinalized"))
+
+	assert.NoDirExists(t, filepath.Join(cfg.TemplateBackupDir, "unfinalized"))
+}
+
+func TestManagerTeardownTemplate(t *testing.T) {
+	ctx := context.Background()
+
+	cfg := manager.DefaultManagerConfigFromEnv()
+	cfg.PoolConfig.InitialPoolSize = 2
+	m, _ := testManagerWithConfig(cfg)
+
+	if err := m.Initialize(ctx); err != nil {
+		t.Fatalf("initializing manager failed: %v", err)
+	}
+
+	defer disconnectManager(t, m)
+
+	hash := "hashinghash"
+
+	template, err := m.InitializeTemplateDatabase(ctx, hash)
+	require.NoError(t, err)
+
+	populateTemplateDB(t, template)
+
+	_, err = m.FinalizeTemplateDatabase(ctx, hash)
+	require.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		_, err := m.GetTestDatabase(ctx, hash)
+		require.NoError(t, err)
+	}
+
+	summary, err := m.TeardownTemplate(ctx, hash)
+	require.NoError(t, err)
+	assert.Equal(t, hash, summary.TemplateHash)
+	assert.Equal(t, template.Config.Database, summary.TemplateDatabase)
+	assert.True(t, summary.TemplateTracked)
+	assert.GreaterOrEqual(t, summary.TestDatabasesRemoved, 3)
+
+	_, err = m.GetTestDatabase(ctx, hash)
+	assert.ErrorIs(t, err, manager.ErrTemplateNotFound)
+
+	_, err = m.TeardownTemplate(ctx, hash)
+	assert.ErrorIs(t, err, manager.ErrTemplateNotFound)
+}
+
 func TestManagerDiscardThenReinitializeTemplateDatabase(t *testing.T) {
 	ctx := context.Background()
 
@@ -1037,3 +1259,3250 @@ func TestManagerClearTrackedTestDatabases(t *testing.T) {
 		t.Errorf("received invalid test ID, got %d, want %d", test.ID, originalID)
 	}
 }
+
+func TestManagerResetTrackingWithLabel(t *testing.T) {
+	ctx := context.Background()
+
+	m := testManagerFromEnv()
+	if err := m.Initialize(ctx); err != nil {
+		t.Fatalf("initializing manager failed: %v", err)
+	}
+
+	defer disconnectManager(t, m)
+
+	labels := map[string][]string{
+		"hashpr":      {"pr-1234"},
+		"hashnightly": {"nightly"},
+		"hashboth":    {"nightly", "pr-1234"},
+	}
+
+	for hash, l := range labels {
+		template, err := m.InitializeTemplateDatabaseWithOptions(ctx, hash, templates.TemplateOptions{Labels: l})
+		require.NoError(t, err)
+
+		populateTemplateDB(t, template)
+
+		_, err = m.FinalizeTemplateDatabase(ctx, hash)
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, m.ResetTrackingWithLabel(ctx, "pr-1234"))
+
+	for _, hash := range []string{"hashpr", "hashboth"} {
+		_, err := m.GetTestDatabase(ctx, hash)
+		assert.ErrorIs(t, err, manager.ErrTemplateNotFound, hash)
+	}
+
+	_, err := m.GetTestDatabase(ctx, "hashnightly")
+	assert.NoError(t, err)
+}
+
+func TestManagerDiagnostics(t *testing.T) {
+	ctx := context.Background()
+
+	m := testManagerFromEnv()
+	if err := m.Initialize(ctx); err != nil {
+		t.Fatalf("initializing manager failed: %v", err)
+	}
+
+	defer disconnectManager(t, m)
+
+	hash := "hashinghash"
+
+	template, err := m.InitializeTemplateDatabase(ctx, hash)
+	require.NoError(t, err)
+
+	populateTemplateDB(t, template)
+
+	_, err = m.FinalizeTemplateDatabase(ctx, hash)
+	require.NoError(t, err)
+
+	diagnostics, err := m.Diagnostics(ctx)
+	require.NoError(t, err)
+
+	dbNames := make([]interface{}, 0, len(diagnostics.PgStatDatabase))
+	for _, row := range diagnostics.PgStatDatabase {
+		dbNames = append(dbNames, row["datname"])
+	}
+	assert.Contains(t, dbNames, template.Config.Database)
+
+	// sensitive config is excluded from the snapshot
+	b, err := json.Marshal(diagnostics)
+	require.NoError(t, err)
+	if password := m.Config().ManagerDatabaseConfig.Password; len(password) > 0 {
+		assert.NotContains(t, string(b), password)
+	}
+}
+
+func TestManagerTemplateSettings(t *testing.T) {
+	ctx := context.Background()
+
+	m := testManagerFromEnv()
+	if err := m.Initialize(ctx); err != nil {
+		t.Fatalf("initializing manager failed: %v", err)
+	}
+
+	defer disconnectManager(t, m)
+
+	hash := "hashinghash"
+
+	template, err := m.InitializeTemplateDatabaseWithOptions(ctx, hash, templates.TemplateOptions{
+		Settings: map[string]string{
+			"default_transaction_isolation": "serializable",
+			"work_mem":                      "8MB",
+		},
+	})
+	require.NoError(t, err)
+
+	populateTemplateDB(t, template)
+
+	_, err = m.FinalizeTemplateDatabase(ctx, hash)
+	require.NoError(t, err)
+
+	test, err := m.GetTestDatabase(ctx, hash)
+	require.NoError(t, err)
+
+	conn, err := sql.Open("postgres", test.Config.ConnectionString())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	var isolation, workMem string
+	require.NoError(t, conn.QueryRowContext(ctx, "SHOW default_transaction_isolation").Scan(&isolation))
+	require.NoError(t, conn.QueryRowContext(ctx, "SHOW work_mem").Scan(&workMem))
+	assert.Equal(t, "serializable", isolation)
+	assert.Equal(t, "8MB", workMem)
+
+	// invalid names and values are rejected while initializing
+	_, err = m.InitializeTemplateDatabaseWithOptions(ctx, "invalidname", templates.TemplateOptions{
+		Settings: map[string]string{"work_mem; DROP DATABASE postgres": "8MB"},
+	})
+	assert.ErrorIs(t, err, manager.ErrInvalidTemplateOptions)
+
+	_, err = m.InitializeTemplateDatabaseWithOptions(ctx, "invalidvalue", templates.TemplateOptions{
+		Settings: map[string]string{"default_transaction_isolation": "chaotic"},
+	})
+	assert.ErrorIs(t, err, manager.ErrInvalidTemplateOptions)
+}
+
+func TestManagerHealthCheckOnAcquire(t *testing.T) {
+	ctx := context.Background()
+
+	cfg := manager.DefaultManagerConfigFromEnv()
+	cfg.PoolConfig.TestDatabaseHealthCheckOnAcquire = true
+	m, _ := testManagerWithConfig(cfg)
+
+	if err := m.Initialize(ctx); err != nil {
+		t.Fatalf("initializing manager failed: %v", err)
+	}
+
+	defer disconnectManager(t, m)
+
+	hash := "hashinghash"
+
+	template, err := m.InitializeTemplateDatabase(ctx, hash)
+	require.NoError(t, err)
+
+	populateTemplateDB(t, template)
+
+	_, err = m.FinalizeTemplateDatabase(ctx, hash)
+	require.NoError(t, err)
+
+	_, err = m.GetTestDatabase(ctx, hash)
+	require.NoError(t, err)
+
+	stats, err := m.Stats(ctx)
+	require.NoError(t, err)
+	require.Len(t, stats.Pools, 1)
+	assert.Equal(t, 0, stats.Pools[0].HealthCheckReplacements)
+}
+
+func TestManagerLatestAlias(t *testing.T) {
+	ctx := context.Background()
+
+	cfg := manager.DefaultManagerConfigFromEnv()
+	cfg.LatestAliasMetadataKey = "branch"
+	m, _ := testManagerWithConfig(cfg)
+
+	if err := m.Initialize(ctx); err != nil {
+		t.Fatalf("initializing manager failed: %v", err)
+	}
+
+	defer disconnectManager(t, m)
+
+	for _, hash := range []string{"hashmain1", "hashmain2", "hashfeature"} {
+		branch := "main"
+		if hash == "hashfeature" {
+			branch = "feature"
+		}
+
+		template, err := m.InitializeTemplateDatabaseWithOptions(ctx, hash, templates.TemplateOptions{Metadata: map[string]string{"branch": branch}})
+		require.NoError(t, err)
+
+		populateTemplateDB(t, template)
+
+		_, err = m.FinalizeTemplateDatabase(ctx, hash)
+		require.NoError(t, err)
+	}
+
+	// the alias points to the most recently finalized template
+	test, err := m.GetTestDatabase(ctx, "latest:main")
+	require.NoError(t, err)
+	assert.Equal(t, "hashmain2", test.TemplateHash)
+	require.NoError(t, m.ReturnTestDatabase(ctx, "latest:main", test.ID))
+
+	stats, err := m.Stats(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"latest:main": "hashmain2", "latest:feature": "hashfeature"}, stats.Aliases)
+
+	// discarding the template removes its aliases
+	require.NoError(t, m.DiscardTemplateDatabase(ctx, "hashmain2"))
+
+	_, err = m.GetTestDatabase(ctx, "latest:main")
+	assert.ErrorIs(t, err, manager.ErrTemplateNotFound)
+}
+
+func TestManagerTemplateSourceKinds(t *testing.T) {
+	ctx := context.Background()
+
+	cfg := manager.DefaultManagerConfigFromEnv()
+	cfg.TemplateBackupDir = t.TempDir()
+	cfg.TemplateDumpDir = cfg.TemplateBackupDir
+	// protected databases are never adopted, even if they are listed
+	cfg.TemplateAdoptableDatabases = []string{"integresql_adopt_me", "integresql_does_not_exist", "postgres", cfg.TemplateDatabaseTemplate, cfg.ManagerDatabaseConfig.Database}
+	m, cfg := testManagerWithConfig(cfg)
+
+	if err := m.Initialize(ctx); err != nil {
+		t.Fatalf("initializing manager failed: %v", err)
+	}
+
+	defer disconnectManager(t, m)
+
+	conn, err := sql.Open("postgres", cfg.ManagerDatabaseConfig.ConnectionString())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	countPilots := func(test db.TestDatabase) int {
+		testConn, err := sql.Open("postgres", test.Config.ConnectionString())
+		require.NoError(t, err)
+		defer testConn.Close()
+
+		var count int
+		require.NoError(t, testConn.QueryRowContext(ctx, "SELECT count(*) FROM pilots").Scan(&count))
+		return count
+	}
+
+	// existing: adopted as-is and finalized immediately
+	adopt := "integresql_adopt_me"
+	_, err = conn.ExecContext(ctx, "DROP DATABASE IF EXISTS "+adopt)
+	require.NoError(t, err)
+	_, err = conn.ExecContext(ctx, "CREATE DATABASE "+adopt)
+	require.NoError(t, err)
+
+	adoptConfig := cfg.ManagerDatabaseConfig
+	adoptConfig.Database = adopt
+	populateTemplateDB(t, db.TemplateDatabase{Database: db.Database{Config: adoptConfig}})
+
+	_, err = m.InitializeTemplateDatabaseWithOptions(ctx, "hashexisting", templates.TemplateOptions{
+		SourceKind:     templates.TemplateSourceExisting,
+		SourceDatabase: adopt,
+	})
+	require.NoError(t, err)
+
+	test, err := m.GetTestDatabase(ctx, "hashexisting")
+	require.NoError(t, err)
+	assert.Equal(t, 2, countPilots(test))
+
+	var exists bool
+	err = conn.QueryRowContext(ctx, "SELECT 1 AS exists FROM pg_database WHERE datname = $1", adopt).Scan(&exists)
+	assert.ErrorIs(t, err, sql.ErrNoRows, "adopted database should have been renamed")
+
+	// dump: restored from the backup taken while discarding
+	require.NoError(t, m.DiscardTemplateDatabase(ctx, "hashexisting"))
+
+	backups, err := filepath.Glob(filepath.Join(cfg.TemplateBackupDir, "hashexisting", "*.dump"))
+	require.NoError(t, err)
+	require.Len(t, backups, 1)
+
+	dump, err := filepath.Rel(cfg.TemplateDumpDir, backups[0])
+	require.NoError(t, err)
+
+	_, err = m.InitializeTemplateDatabaseWithOptions(ctx, "hashdump", templates.TemplateOptions{
+		SourceKind: templates.TemplateSourceDump,
+		SourceDump: dump,
+	})
+	require.NoError(t, err)
+
+	_, err = m.FinalizeTemplateDatabase(ctx, "hashdump")
+	require.NoError(t, err)
+
+	test, err = m.GetTestDatabase(ctx, "hashdump")
+	require.NoError(t, err)
+	assert.Equal(t, 2, countPilots(test))
+
+	// validation
+	for name, options := range map[string]templates.TemplateOptions{
+		"unknown kind":        {SourceKind: "magic"},
+		"empty with source":   {SourceKind: templates.TemplateSourceEmpty, SourceDatabase: "postgres"},
+		"dump without dump":   {SourceKind: templates.TemplateSourceDump},
+		"dump not found":      {SourceKind: templates.TemplateSourceDump, SourceDump: "../../etc/passwd"},
+		"adopt manager db":    {SourceKind: templates.TemplateSourceExisting, SourceDatabase: cfg.ManagerDatabaseConfig.Database},
+		"adopt postgres":      {SourceKind: templates.TemplateSourceExisting, SourceDatabase: "postgres"},
+		"adopt template1":     {SourceKind: templates.TemplateSourceExisting, SourceDatabase: "template1"},
+		"adopt root template": {SourceKind: templates.TemplateSourceExisting, SourceDatabase: cfg.TemplateDatabaseTemplate},
+		"adopt not listed":    {SourceKind: templates.TemplateSourceExisting, SourceDatabase: "integresql_not_adoptable"},
+		"adopt non existing":  {SourceKind: templates.TemplateSourceExisting, SourceDatabase: "integresql_does_not_exist"},
+	} {
+		_, err := m.InitializeTemplateDatabaseWithOptions(ctx, "hashinvalid", options)
+		assert.ErrorIs(t, err, manager.ErrInvalidTemplateOptions, name)
+	}
+}
+
+func TestManagerDropAllDatabases(t *testing.T) {
+	ctx := context.Background()
+
+	m, cfg := testManagerFromEnvWithConfig()
+
+	if err := m.Initialize(ctx); err != nil {
+		t.Fatalf("initializing manager failed: %v", err)
+	}
+
+	defer disconnectManager(t, m)
+
+	hash := "hashinghash"
+
+	template, err := m.InitializeTemplateDatabase(ctx, hash)
+	if err != nil {
+		t.Fatalf("failed to initialize template database: %v", err)
+	}
+
+	populateTemplateDB(t, template)
+
+	if _, err := m.FinalizeTemplateDatabase(ctx, hash); err != nil {
+		t.Fatalf("failed to finalize template database: %v", err)
+	}
+
+	test, err := m.GetTestDatabase(ctx, hash)
+	if err != nil {
+		t.Fatalf("failed to get test database: %v", err)
+	}
+
+	if err := m.DropAllDatabases(ctx); err != nil {
+		t.Fatalf("failed to drop all databases: %v", err)
+	}
+
+	_, err = m.GetTestDatabase(ctx, hash)
+	assert.ErrorIs(t, err, manager.ErrTemplateNotFound)
+
+	db, err := sql.Open("postgres", cfg.ManagerDatabaseConfig.ConnectionString())
+	require.NoError(t, err)
+	defer db.Close()
+
+	for _, dbName := range []string{template.Config.Database, test.Config.Database} {
+		var exists bool
+		err := db.QueryRowContext(ctx, "SELECT 1 AS exists FROM pg_database WHERE datname = $1", dbName).Scan(&exists)
+		assert.ErrorIs(t, err, sql.ErrNoRows, "database %q should have been dropped", dbName)
+	}
+}
+
+func TestManagerPostCloneScriptWithSeed(t *testing.T) {
+	ctx := context.Background()
+
+	cfg := manager.DefaultManagerConfigFromEnv()
+	cfg.PoolConfig.InitialPoolSize = 2
+	cfg.PoolConfig.MaxPoolSize = 4
+	m, _ := testManagerWithConfig(cfg)
+
+	if err := m.Initialize(ctx); err != nil {
+		t.Fatalf("initializing manager failed: %v", err)
+	}
+
+	defer disconnectManager(t, m)
+
+	hash := "hashinghash"
+
+	template, err := m.InitializeTemplateDatabaseWithOptions(ctx, hash, templates.TemplateOptions{
+		PostCloneScript: `INSERT INTO pilots (id, "name", created_at) VALUES (uuid_generate_v4(), 'Seed ' || current_setting('integresql.seed'), now());`,
+	})
+	if err != nil {
+		t.Fatalf("failed to initialize template database: %v", err)
+	}
+
+	populateTemplateDB(t, template)
+
+	if _, err := m.FinalizeTemplateDatabase(ctx, hash); err != nil {
+		t.Fatalf("failed to finalize template database: %v", err)
+	}
+
+	test, err := m.GetTestDatabase(ctx, hash)
+	require.NoError(t, err)
+
+	db, err := sql.Open("postgres", test.Config.ConnectionString())
+	require.NoError(t, err)
+	defer db.Close()
+
+	var seed string
+	require.NoError(t, db.QueryRowContext(ctx, "SELECT current_setting('integresql.seed')").Scan(&seed))
+	assert.Equal(t, fmt.Sprintf("%d", test.Seed), seed)
+
+	var name string
+	require.NoError(t, db.QueryRowContext(ctx, `SELECT "name" FROM pilots WHERE "name" LIKE 'Seed %'`).Scan(&name))
+	assert.Equal(t, fmt.Sprintf("Seed %d", test.Seed), name)
+}
+
+func TestManagerInitializeTemplateDatabaseFromSourceDatabase(t *testing.T) {
+	ctx := context.Background()
+
+	m, cfg := testManagerFromEnvWithConfig()
+
+	if err := m.Initialize(ctx); err != nil {
+		t.Fatalf("initializing manager failed: %v", err)
+	}
+
+	defer disconnectManager(t, m)
+
+	// prepare a source database on the same cluster
+	managerDB, err := sql.Open("postgres", cfg.ManagerDatabaseConfig.ConnectionString())
+	require.NoError(t, err)
+	defer managerDB.Close()
+
+	sourceName := "pgtestpool_source"
+	_, err = managerDB.ExecContext(ctx, fmt.Sprintf("DROP DATABASE IF EXISTS %s", pq.QuoteIdentifier(sourceName)))
+	require.NoError(t, err)
+	_, err = managerDB.ExecContext(ctx, fmt.Sprintf("CREATE DATABASE %s", pq.QuoteIdentifier(sourceName)))
+	require.NoError(t, err)
+	defer func() {
+		_, err := managerDB.ExecContext(ctx, fmt.Sprintf("DROP DATABASE IF EXISTS %s", pq.QuoteIdentifier(sourceName)))
+		assert.NoError(t, err)
+	}()
+
+	source := cfg.ManagerDatabaseConfig
+	source.Database = sourceName
+	populateTemplateDB(t, db.TemplateDatabase{Database: db.Database{Config: source}})
+
+	hash := "hashinghash"
+
+	if _, err := m.InitializeTemplateDatabaseWithOptions(ctx, hash, templates.TemplateOptions{
+		SourceDatabase: sourceName,
+	}); err != nil {
+		t.Fatalf("failed to initialize template database: %v", err)
+	}
+
+	if _, err := m.FinalizeTemplateDatabase(ctx, hash); err != nil {
+		t.Fatalf("failed to finalize template database: %v", err)
+	}
+
+	test, err := m.GetTestDatabase(ctx, hash)
+	if err != nil {
+		t.Fatalf("failed to get test database: %v", err)
+	}
+
+	verifyTestDB(t, test)
+}
+
+func TestManagerEphemeralTemplate(t *testing.T) {
+	ctx := context.Background()
+
+	cfg := manager.DefaultManagerConfigFromEnv()
+	cfg.EphemeralTemplateIdleTimeout = 200 * time.Millisecond
+	m, cfg := testManagerWithConfig(cfg)
+
+	if err := m.Initialize(ctx); err != nil {
+		t.Fatalf("initializing manager failed: %v", err)
+	}
+
+	defer disconnectManager(t, m)
+
+	hash := "hashinghash"
+
+	template, err := m.InitializeTemplateDatabaseWithOptions(ctx, hash, templates.TemplateOptions{
+		Ephemeral: true,
+	})
+	if err != nil {
+		t.Fatalf("failed to initialize template database: %v", err)
+	}
+
+	populateTemplateDB(t, template)
+
+	if _, err := m.FinalizeTemplateDatabase(ctx, hash); err != nil {
+		t.Fatalf("failed to finalize template database: %v", err)
+	}
+
+	test, err := m.GetTestDatabase(ctx, hash)
+	require.NoError(t, err)
+
+	// the template must not be discarded while a test database is checked out
+	time.Sleep(2 * cfg.EphemeralTemplateIdleTimeout)
+	test2, err := m.GetTestDatabase(ctx, hash)
+	require.NoError(t, err)
+
+	// the second one is returned by recreating it
+	require.NoError(t, m.ReturnTestDatabase(ctx, hash, test.ID))
+	require.NoError(t, m.RecreateTestDatabase(ctx, hash, test2.ID))
+
+	time.Sleep(2 * cfg.EphemeralTemplateIdleTimeout)
+
+	_, err = m.GetTestDatabase(ctx, hash)
+	assert.ErrorIs(t, err, manager.ErrTemplateNotFound)
+
+	managerDB, err := sql.Open("postgres", cfg.ManagerDatabaseConfig.ConnectionString())
+	require.NoError(t, err)
+	defer managerDB.Close()
+
+	var exists bool
+	require.NoError(t, managerDB.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM pg_database WHERE datname = $1)", template.Config.Database).Scan(&exists))
+	assert.False(t, exists, "template database should have been dropped")
+
+	recent := m.RecentEvents(ctx)
+	require.NotEmpty(t, recent)
+	assert.Equal(t, events.TypeEphemeralTemplateDiscarded, recent[len(recent)-1].Type)
+}
+
+func TestManagerClientRewriteRules(t *testing.T) {
+	ctx := context.Background()
+
+	cfg := manager.DefaultManagerConfigFromEnv()
+	cfg.ClientRewriteRules = db.RewriteRules{
+		{FromHost: "*", ToHost: "rewritten.example.com", ToPort: 15432},
+	}
+	m, _ := testManagerWithConfig(cfg)
+
+	if err := m.Initialize(ctx); err != nil {
+		t.Fatalf("initializing manager failed: %v", err)
+	}
+
+	defer disconnectManager(t, m)
+
+	hash := "hashinghash"
+
+	template, err := m.InitializeTemplateDatabase(ctx, hash)
+	if err != nil {
+		t.Fatalf("failed to initialize template database: %v", err)
+	}
+
+	assert.Equal(t, "rewritten.example.com", template.Config.Host)
+	assert.Equal(t, 15432, template.Config.Port)
+
+	template, err = m.FinalizeTemplateDatabase(ctx, hash)
+	if err != nil {
+		t.Fatalf("failed to finalize template database: %v", err)
+	}
+
+	assert.Equal(t, "rewritten.example.com", template.Config.Host)
+	assert.Equal(t, 15432, template.Config.Port)
+
+	// test databases are still created on the actual cluster, only the returned config is rewritten
+	test, err := m.GetTestDatabase(ctx, hash)
+	require.NoError(t, err)
+
+	assert.Equal(t, "rewritten.example.com", test.Config.Host)
+	assert.Equal(t, 15432, test.Config.Port)
+	assert.Equal(t, cfg.ManagerDatabaseConfig.Username, test.Config.Username)
+}
+
+func TestManagerNamespaceClientRewriteRules(t *testing.T) {
+	ctx := context.Background()
+
+	cfg := manager.DefaultManagerConfigFromEnv()
+	cfg.ClientRewriteRules = db.RewriteRules{
+		{FromHost: "*", ToHost: "rewritten.example.com", ToPort: 15432},
+	}
+	cfg.NamespaceClientRewriteRules = map[string]db.RewriteRules{
+		"team-a": {{FromHost: "*", ToHost: "pgbouncer-a.example.com", ToPort: 6432}},
+	}
+	m, _ := testManagerWithConfig(cfg)
+
+	if err := m.Initialize(ctx); err != nil {
+		t.Fatalf("initializing manager failed: %v", err)
+	}
+
+	defer disconnectManager(t, m)
+
+	hash := "hashinghash"
+	other := "otherhash"
+
+	template, err := m.InitializeTemplateDatabaseWithOptions(ctx, hash, templates.TemplateOptions{Namespace: "team-a"})
+	require.NoError(t, err)
+	assert.Equal(t, "pgbouncer-a.example.com", template.Config.Host)
+	assert.Equal(t, 6432, template.Config.Port)
+
+	template, err = m.FinalizeTemplateDatabase(ctx, hash)
+	require.NoError(t, err)
+	assert.Equal(t, "pgbouncer-a.example.com", template.Config.Host)
+
+	test, err := m.GetTestDatabase(ctx, hash)
+	require.NoError(t, err)
+	assert.Equal(t, "pgbouncer-a.example.com", test.Config.Host)
+	assert.Equal(t, 6432, test.Config.Port)
+
+	// other namespaces fall back to the global rules
+	template, err = m.InitializeTemplateDatabaseWithOptions(ctx, other, templates.TemplateOptions{Namespace: "team-b"})
+	require.NoError(t, err)
+	assert.Equal(t, "rewritten.example.com", template.Config.Host)
+	assert.Equal(t, 15432, template.Config.Port)
+}
+
+func TestManagerDeadlineHint(t *testing.T) {
+	ctx := context.Background()
+
+	cfg := manager.DefaultManagerConfigFromEnv()
+	cfg.TemplateFinalizeTimeout = 10 * time.Second
+	cfg.DeadlineHintMargin = 100 * time.Millisecond
+	m, _ := testManagerWithConfig(cfg)
+
+	if err := m.Initialize(ctx); err != nil {
+		t.Fatalf("initializing manager failed: %v", err)
+	}
+
+	defer disconnectManager(t, m)
+
+	hash := "hashinghash"
+
+	template, err := m.InitializeTemplateDatabase(ctx, hash)
+	require.NoError(t, err)
+
+	// the template is never finalized, the client deadline caps the wait
+	start := time.Now()
+	_, err = m.GetTestDatabase(manager.WithDeadlineHint(ctx, time.Now().Add(300*time.Millisecond)), hash)
+	assert.ErrorIs(t, err, manager.ErrDeadlineExceeded)
+	assert.Less(t, time.Since(start), 300*time.Millisecond)
+
+	// deadline already passed
+	_, err = m.GetTestDatabase(manager.WithDeadlineHint(ctx, time.Now().Add(-time.Second)), hash)
+	assert.ErrorIs(t, err, manager.ErrDeadlineExceeded)
+
+	populateTemplateDB(t, template)
+
+	_, err = m.FinalizeTemplateDatabase(ctx, hash)
+	require.NoError(t, err)
+
+	// a sufficient deadline doesn't change anything
+	test, err := m.GetTestDatabase(manager.WithDeadlineHint(ctx, time.Now().Add(10*time.Second)), hash)
+	require.NoError(t, err)
+	verifyTestDB(t, test)
+}
+
+func TestManagerMigratePrefixes(t *testing.T) {
+	ctx := context.Background()
+
+	oldCfg := manager.DefaultManagerConfigFromEnv()
+	oldCfg.TemplateDatabasePrefix = "oldtemplate"
+	oldCfg.PoolConfig.TestDBNamePrefix = "oldtest"
+	old, _ := testManagerWithConfig(oldCfg)
+
+	if err := old.Initialize(ctx); err != nil {
+		t.Fatalf("initializing manager failed: %v", err)
+	}
+
+	hash := "hashinghash"
+
+	template, err := old.InitializeTemplateDatabase(ctx, hash)
+	if err != nil {
+		t.Fatalf("failed to initialize template database: %v", err)
+	}
+
+	populateTemplateDB(t, template)
+
+	if _, err := old.FinalizeTemplateDatabase(ctx, hash); err != nil {
+		t.Fatalf("failed to finalize template database: %v", err)
+	}
+
+	oldTest, err := old.GetTestDatabase(ctx, hash)
+	if err != nil {
+		t.Fatalf("failed to get test database: %v", err)
+	}
+
+	disconnectManager(t, old)
+
+	m, cfg := testManagerFromEnvWithConfig()
+
+	if err := m.Initialize(ctx); err != nil {
+		t.Fatalf("initializing manager failed: %v", err)
+	}
+
+	defer disconnectManager(t, m)
+
+	from := manager.PrefixScheme{DatabasePrefix: cfg.DatabasePrefix, TemplateDatabasePrefix: "oldtemplate", TestDatabasePrefix: "oldtest"}
+
+	_, err = m.MigratePrefixes(ctx, manager.PrefixScheme{DatabasePrefix: cfg.DatabasePrefix, TemplateDatabasePrefix: cfg.TemplateDatabasePrefix, TestDatabasePrefix: "test"}, true)
+	assert.ErrorIs(t, err, manager.ErrInvalidPrefixMigration)
+
+	// dry run
+	summary, err := m.MigratePrefixes(ctx, from, true)
+	require.NoError(t, err)
+	assert.False(t, summary.Failed())
+	assert.Equal(t, "test", summary.To.TestDatabasePrefix)
+
+	actions := make(map[string]manager.PrefixMigrationResult)
+	for _, result := range summary.Results {
+		actions[result.Database] = result
+	}
+
+	require.Contains(t, actions, template.Config.Database)
+	assert.Equal(t, manager.PrefixMigrationActionRename, actions[template.Config.Database].Action)
+	assert.Equal(t, hash, actions[template.Config.Database].Hash)
+	require.Contains(t, actions, oldTest.Config.Database)
+	assert.Equal(t, manager.PrefixMigrationActionDrop, actions[oldTest.Config.Database].Action)
+
+	_, err = m.GetTestDatabase(ctx, hash)
+	assert.ErrorIs(t, err, manager.ErrTemplateNotFound)
+
+	summary, err = m.MigratePrefixes(ctx, from, false)
+	require.NoError(t, err)
+	assert.False(t, summary.Failed(), "%+v", summary.Results)
+
+	// the migrated template is tracked and finalized
+	test, err := m.GetTestDatabase(ctx, hash)
+	require.NoError(t, err)
+	verifyTestDB(t, test)
+
+	_, err = m.InitializeTemplateDatabase(ctx, hash)
+	assert.ErrorIs(t, err, manager.ErrTemplateAlreadyInitialized)
+
+	db, err := sql.Open("postgres", cfg.ManagerDatabaseConfig.ConnectionString())
+	require.NoError(t, err)
+	defer db.Close()
+
+	for _, dbName := range []string{template.Config.Database, oldTest.Config.Database} {
+		var exists bool
+		err := db.QueryRowContext(ctx, "SELECT 1 AS exists FROM pg_database WHERE datname = $1", dbName).Scan(&exists)
+		assert.ErrorIs(t, err, sql.ErrNoRows, "database %q should have been migrated", dbName)
+	}
+
+	// nothing left to migrate
+	summary, err = m.MigratePrefixes(ctx, from, false)
+	require.NoError(t, err)
+	assert.Empty(t, summary.Results)
+}
+
+func TestManagerTemplateDrift(t *testing.T) {
+	ctx := context.Background()
+
+	cfg := manager.DefaultManagerConfigFromEnv()
+	cfg.TemplateDriftCheckInterval = 50 * time.Millisecond
+	cfg.TemplateDriftQuarantine = true
+	m, _ := testManagerWithConfig(cfg)
+
+	if err := m.Initialize(ctx); err != nil {
+		t.Fatalf("initializing manager failed: %v", err)
+	}
+
+	defer disconnectManager(t, m)
+
+	hash := "hashinghash"
+
+	template, err := m.InitializeTemplateDatabase(ctx, hash)
+	if err != nil {
+		t.Fatalf("failed to initialize template database: %v", err)
+	}
+
+	populateTemplateDB(t, template)
+
+	if _, err := m.FinalizeTemplateDatabase(ctx, hash); err != nil {
+		t.Fatalf("failed to finalize template database: %v", err)
+	}
+
+	test, err := m.GetTestDatabase(ctx, hash)
+	require.NoError(t, err)
+	verifyTestDB(t, test)
+
+	driftEvents := func() []events.Event {
+		drifts := []events.Event{}
+		for _, e := range m.RecentEvents(ctx) {
+			if e.Type == events.TypeTemplateDrift {
+				drifts = append(drifts, e)
+			}
+		}
+		return drifts
+	}
+
+	// unchanged templates don't drift
+	time.Sleep(3 * cfg.TemplateDriftCheckInterval)
+	require.Empty(t, driftEvents())
+
+	db, err := sql.Open("postgres", template.Config.ConnectionString())
+	require.NoError(t, err)
+	_, err = db.ExecContext(ctx, `INSERT INTO pilots (id, "name", created_at) VALUES ('a5d5bd50-54ab-4b4b-8d8b-1e0c2b6bd0b5', 'Goose', now())`)
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(driftEvents()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(cfg.TemplateDriftCheckInterval)
+	}
+	require.Len(t, driftEvents(), 1)
+
+	drift := driftEvents()[0]
+	assert.Equal(t, hash, drift.Hash)
+	assert.Contains(t, drift.Message, "public.pilots")
+	assert.NotContains(t, drift.Message, "public.jets")
+
+	stats, err := m.Stats(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, stats.TemplateDrifts)
+
+	// quarantined
+	_, err = m.GetTestDatabase(ctx, hash)
+	assert.ErrorIs(t, err, manager.ErrTemplateNotFound)
+}
+
+func TestManagerShutdownReport(t *testing.T) {
+	ctx := context.Background()
+
+	m, _ := testManagerWithConfig(manager.DefaultManagerConfigFromEnv())
+
+	if err := m.Initialize(ctx); err != nil {
+		t.Fatalf("initializing manager failed: %v", err)
+	}
+
+	hash := "hashinghash"
+
+	template, err := m.InitializeTemplateDatabase(ctx, hash)
+	require.NoError(t, err)
+
+	populateTemplateDB(t, template)
+
+	_, err = m.FinalizeTemplateDatabase(ctx, hash)
+	require.NoError(t, err)
+
+	test, err := m.GetTestDatabase(ctx, hash)
+	require.NoError(t, err)
+
+	findDatabase := func(databases []manager.ShutdownReportDatabase, dbName string) manager.ShutdownReportDatabase {
+		t.Helper()
+
+		for _, database := range databases {
+			if database.Database == dbName {
+				return database
+			}
+		}
+
+		t.Fatalf("database %s not part of the shutdown report", dbName)
+		return manager.ShutdownReportDatabase{}
+	}
+
+	// preview while connected
+	preview, err := m.ShutdownReport(ctx)
+	require.NoError(t, err)
+	assert.False(t, preview.Final)
+
+	templateDB := findDatabase(preview.Templates, template.Config.Database)
+	assert.Equal(t, hash, templateDB.Hash)
+	assert.Equal(t, "finalized", templateDB.State)
+	assert.False(t, templateDB.Readopted)
+	assert.Equal(t, manager.ShutdownReportOnRestartOrphaned, templateDB.OnRestart)
+
+	testDB := findDatabase(preview.TestDatabases, test.Config.Database)
+	assert.Equal(t, hash, testDB.Hash)
+	assert.Equal(t, "dirty", testDB.State)
+	assert.False(t, testDB.Readopted)
+
+	require.NoError(t, m.Disconnect(ctx, true))
+
+	// retrievable until the next connect
+	report, err := m.ShutdownReport(ctx)
+	require.NoError(t, err)
+	assert.True(t, report.Final)
+	assert.Equal(t, "finalized", findDatabase(report.Templates, template.Config.Database).State)
+	assert.Equal(t, "dirty", findDatabase(report.TestDatabases, test.Config.Database).State)
+
+	require.NoError(t, m.Connect(ctx))
+	defer disconnectManager(t, m)
+
+	preview, err = m.ShutdownReport(ctx)
+	require.NoError(t, err)
+	assert.False(t, preview.Final)
+
+	// still tracked, the tracking survives reconnects but not restarts
+	assert.Equal(t, "finalized", findDatabase(preview.Templates, template.Config.Database).State)
+}
+
+func TestManagerRuntimeHealth(t *testing.T) {
+	ctx := context.Background()
+
+	cfg := manager.DefaultManagerConfigFromEnv()
+	cfg.RuntimeHealthCheckInterval = 20 * time.Millisecond
+	cfg.RuntimeMaxGoroutines = 1 // always exceeded
+	m, _ := testManagerWithConfig(cfg)
+
+	if err := m.Initialize(ctx); err != nil {
+		t.Fatalf("initializing manager failed: %v", err)
+	}
+
+	defer disconnectManager(t, m)
+
+	runtimeEvents := func() []events.Event {
+		exceeded := []events.Event{}
+		for _, e := range m.RecentEvents(ctx) {
+			if e.Type == events.TypeRuntimeThresholdExceeded {
+				exceeded = append(exceeded, e)
+			}
+		}
+		return exceeded
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(runtimeEvents()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(cfg.RuntimeHealthCheckInterval)
+	}
+
+	// only emitted once while the threshold stays exceeded
+	time.Sleep(3 * cfg.RuntimeHealthCheckInterval)
+	require.Len(t, runtimeEvents(), 1)
+	assert.Equal(t, manager.RuntimeThresholdGoroutines, runtimeEvents()[0].Fields["threshold"])
+
+	stats, err := m.Stats(ctx)
+	require.NoError(t, err)
+	assert.Greater(t, stats.Runtime.Goroutines, 1)
+	assert.Greater(t, stats.Runtime.HeapAllocBytes, uint64(0))
+	assert.Equal(t, []string{manager.RuntimeThresholdGoroutines}, stats.RuntimeThresholdsExceeded)
+}
+
+func TestManagerPoolerConfig(t *testing.T) {
+	ctx := context.Background()
+
+	cfg := manager.DefaultManagerConfigFromEnv()
+	cfg.PoolConfig.InitialPoolSize = 1
+	cfg.PoolConfig.MaxPoolSize = 10
+	cfg.Pooler.File = filepath.Join(t.TempDir(), "pooler.ini")
+	cfg.PoolerConfigSyncInterval = 20 * time.Millisecond
+	m, _ := testManagerWithConfig(cfg)
+
+	if err := m.Initialize(ctx); err != nil {
+		t.Fatalf("initializing manager failed: %v", err)
+	}
+
+	defer disconnectManager(t, m)
+
+	hash := "hashinghash"
+
+	template, err := m.InitializeTemplateDatabase(ctx, hash)
+	if err != nil {
+		t.Fatalf("failed to initialize template database: %v", err)
+	}
+
+	populateTemplateDB(t, template)
+
+	if _, err := m.FinalizeTemplateDatabase(ctx, hash); err != nil {
+		t.Fatalf("failed to finalize template database: %v", err)
+	}
+
+	testDB, err := m.GetTestDatabase(ctx, hash)
+	require.NoError(t, err)
+	require.Equal(t, fmt.Sprintf("%s_%d", hash, testDB.ID), testDB.PoolerAlias)
+
+	// synced before the test database was handed out
+	content, err := os.ReadFile(cfg.Pooler.File)
+	require.NoError(t, err)
+	assert.Contains(t, string(content), fmt.Sprintf("%s = host=", testDB.PoolerAlias))
+	assert.Contains(t, string(content), "dbname="+testDB.Config.Database)
+
+	// removed by the periodic sync after returning it
+	require.NoError(t, m.ReturnTestDatabase(ctx, hash, testDB.ID))
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		content, err = os.ReadFile(cfg.Pooler.File)
+		require.NoError(t, err)
+
+		if !strings.Contains(string(content), testDB.PoolerAlias) {
+			break
+		}
+
+		time.Sleep(cfg.PoolerConfigSyncInterval)
+	}
+
+	assert.NotContains(t, string(content), testDB.PoolerAlias)
+}
+
+func TestManagerExplainGetTestDatabase(t *testing.T) {
+	ctx := context.Background()
+
+	cfg := manager.DefaultManagerConfigFromEnv()
+	cfg.PoolConfig.InitialPoolSize = 1
+	cfg.PoolConfig.MaxPoolSize = 10
+	m, _ := testManagerWithConfig(cfg)
+
+	if err := m.Initialize(ctx); err != nil {
+		t.Fatalf("initializing manager failed: %v", err)
+	}
+
+	defer disconnectManager(t, m)
+
+	hash := "hashinghash"
+
+	template, err := m.InitializeTemplateDatabase(ctx, hash)
+	if err != nil {
+		t.Fatalf("failed to initialize template database: %v", err)
+	}
+
+	explanation, err := m.ExplainGetTestDatabase(ctx, hash, manager.TestDatabaseOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, manager.DecisionWaitTemplate, explanation.Decision)
+	assert.Equal(t, "init", explanation.TemplateState)
+	assert.Nil(t, explanation.Pool)
+
+	populateTemplateDB(t, template)
+
+	if _, err := m.FinalizeTemplateDatabase(ctx, hash); err != nil {
+		t.Fatalf("failed to finalize template database: %v", err)
+	}
+
+	// wait for the initial test database
+	testDB, err := m.GetTestDatabase(ctx, hash)
+	require.NoError(t, err)
+	require.NoError(t, m.ReturnTestDatabase(ctx, hash, testDB.ID))
+
+	explanation, err = m.ExplainGetTestDatabase(ctx, hash, manager.TestDatabaseOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, pool.DecisionReuseReady, explanation.Decision)
+	assert.Equal(t, "finalized", explanation.TemplateState)
+	require.NotNil(t, explanation.Pool)
+	assert.GreaterOrEqual(t, explanation.Pool.Ready, 1)
+
+	index := 1
+	_, err = m.ExplainGetTestDatabase(ctx, hash, manager.TestDatabaseOptions{SkipClean: true, Index: &index})
+	assert.ErrorIs(t, err, manager.ErrInvalidTestDatabaseOptions)
+	_, err = m.ExplainGetTestDatabase(ctx, "unknownhash", manager.TestDatabaseOptions{})
+	assert.ErrorIs(t, err, manager.ErrTemplateNotFound)
+}
+
+func TestManagerRenewTestDatabase(t *testing.T) {
+	ctx := context.Background()
+
+	cfg := manager.DefaultManagerConfigFromEnv()
+	cfg.PoolConfig.InitialPoolSize = 1
+	cfg.PoolConfig.MaxPoolSize = 10
+	cfg.PoolConfig.TestDatabaseLeaseRenewDuration = time.Minute
+	m, _ := testManagerWithConfig(cfg)
+
+	if err := m.Initialize(ctx); err != nil {
+		t.Fatalf("initializing manager failed: %v", err)
+	}
+
+	defer disconnectManager(t, m)
+
+	hash := "hashinghash"
+
+	template, err := m.InitializeTemplateDatabaseWithOptions(ctx, hash, templates.TemplateOptions{MaxLeaseDuration: 10 * time.Second})
+	if err != nil {
+		t.Fatalf("failed to initialize template database: %v", err)
+	}
+
+	populateTemplateDB(t, template)
+
+	if _, err := m.FinalizeTemplateDatabase(ctx, hash); err != nil {
+		t.Fatalf("failed to finalize template database: %v", err)
+	}
+
+	testDB, err := m.GetTestDatabase(ctx, hash)
+	require.NoError(t, err)
+
+	// capped to the max lease duration of the template
+	lease, err := m.RenewTestDatabase(ctx, hash, testDB.ID)
+	require.NoError(t, err)
+	assert.Equal(t, lease.MaxExpiresAt, lease.ExpiresAt)
+	assert.WithinDuration(t, time.Now().Add(10*time.Second), lease.MaxExpiresAt, time.Second)
+
+	require.NoError(t, m.ReturnTestDatabase(ctx, hash, testDB.ID))
+	_, err = m.RenewTestDatabase(ctx, hash, testDB.ID)
+	assert.ErrorIs(t, err, pool.ErrInvalidState)
+
+	_, err = m.RenewTestDatabase(ctx, hash, 999)
+	assert.ErrorIs(t, err, manager.ErrTestNotFound)
+	_, err = m.RenewTestDatabase(ctx, "unknownhash", 0)
+	assert.ErrorIs(t, err, manager.ErrTemplateNotFound)
+}
+
+func TestManagerCloneValidation(t *testing.T) {
+	ctx := context.Background()
+
+	cfg := manager.DefaultManagerConfigFromEnv()
+	cfg.PoolConfig.InitialPoolSize = 1
+	cfg.PoolConfig.MaxPoolSize = 2
+	cfg.TestDatabaseGetTimeout = 500 * time.Millisecond
+	m, _ := testManagerWithConfig(cfg)
+
+	if err := m.Initialize(ctx); err != nil {
+		t.Fatalf("initializing manager failed: %v", err)
+	}
+
+	defer disconnectManager(t, m)
+
+	_, err := m.InitializeTemplateDatabaseWithOptions(ctx, "emptyqueryhash", templates.TemplateOptions{ValidationQueries: []string{" "}})
+	require.ErrorIs(t, err, manager.ErrInvalidTemplateOptions)
+
+	for hash, queries := range map[string][]string{
+		"validhash":   {"SELECT count(*) > 0 FROM pilots", "SELECT 'ok 1 - pilots exist'"},
+		"invalidhash": {"SELECT true", "SELECT 'not ok 1 - extension missing'"},
+	} {
+		template, err := m.InitializeTemplateDatabaseWithOptions(ctx, hash, templates.TemplateOptions{ValidationQueries: queries})
+		if err != nil {
+			t.Fatalf("failed to initialize template database: %v", err)
+		}
+
+		populateTemplateDB(t, template)
+
+		if _, err := m.FinalizeTemplateDatabase(ctx, hash); err != nil {
+			t.Fatalf("failed to finalize template database: %v", err)
+		}
+	}
+
+	testDB, err := m.GetTestDatabase(ctx, "validhash")
+	require.NoError(t, err)
+	verifyTestDB(t, testDB)
+
+	// failing clones never enter the pool
+	_, err = m.GetTestDatabase(ctx, "invalidhash")
+	require.ErrorIs(t, err, pool.ErrTimeout)
+
+	var failed []events.Event
+	for _, e := range m.RecentEvents(ctx) {
+		if e.Type == events.TypeCloneValidationFailed {
+			failed = append(failed, e)
+		}
+	}
+	require.NotEmpty(t, failed)
+	assert.Equal(t, "invalidhash", failed[0].Hash)
+	assert.Equal(t, 1, failed[0].Fields["query"])
+}
+
+func TestManagerCapacity(t *testing.T) {
+	ctx := context.Background()
+
+	cfg := manager.DefaultManagerConfigFromEnv()
+	cfg.PoolConfig.InitialPoolSize = 2
+	cfg.PoolConfig.MaxPoolSize = 4
+	cfg.CapacityMaxDatabases = 1000
+	m, _ := testManagerWithConfig(cfg)
+
+	if err := m.Initialize(ctx); err != nil {
+		t.Fatalf("initializing manager failed: %v", err)
+	}
+
+	defer disconnectManager(t, m)
+
+	hash := "hashinghash"
+
+	template, err := m.InitializeTemplateDatabase(ctx, hash)
+	if err != nil {
+		t.Fatalf("failed to initialize template database: %v", err)
+	}
+
+	populateTemplateDB(t, template)
+
+	if _, err := m.FinalizeTemplateDatabase(ctx, hash); err != nil {
+		t.Fatalf("failed to finalize template database: %v", err)
+	}
+
+	_, err = m.GetTestDatabase(ctx, hash)
+	require.NoError(t, err)
+
+	capacity, err := m.Capacity(ctx)
+	require.NoError(t, err)
+
+	assert.GreaterOrEqual(t, capacity.Templates, 1)
+	assert.GreaterOrEqual(t, capacity.TestDatabases, 1)
+	assert.Greater(t, capacity.MaxConnections, 0)
+	assert.Greater(t, capacity.ManagedDiskBytes, int64(0))
+	assert.GreaterOrEqual(t, capacity.DiskBytes, capacity.ManagedDiskBytes)
+	assert.Greater(t, capacity.CreatesPerSecond, 0.0)
+
+	require.NotEmpty(t, capacity.TopTemplates)
+	assert.Equal(t, hash, capacity.TopTemplates[0].Hash)
+	assert.Greater(t, capacity.TopTemplates[0].DiskBytes, int64(0))
+
+	assert.Greater(t, capacity.Headroom, 0.0)
+	assert.LessOrEqual(t, capacity.Headroom, 1.0)
+	assert.Contains(t, []string{manager.CapacityConnections, manager.CapacityDatabases}, capacity.Bottleneck)
+	require.NotNil(t, capacity.AddableTemplates)
+	assert.Greater(t, *capacity.AddableTemplates, 0)
+}
+
+func TestManagerSoakInvariantCheck(t *testing.T) {
+	ctx := context.Background()
+
+	cfg := manager.DefaultManagerConfigFromEnv()
+	cfg.PoolConfig.InitialPoolSize = 1
+	cfg.PoolConfig.MaxPoolSize = 2
+	cfg.SoakInvariantCheck = true
+	m, _ := testManagerWithConfig(cfg)
+
+	if err := m.Initialize(ctx); err != nil {
+		t.Fatalf("initializing manager failed: %v", err)
+	}
+
+	defer disconnectManager(t, m)
+
+	hash := "hashinghash"
+
+	template, err := m.InitializeTemplateDatabase(ctx, hash)
+	if err != nil {
+		t.Fatalf("failed to initialize template database: %v", err)
+	}
+
+	populateTemplateDB(t, template)
+
+	if _, err := m.FinalizeTemplateDatabase(ctx, hash); err != nil {
+		t.Fatalf("failed to finalize template database: %v", err)
+	}
+
+	index := 0
+	options := manager.TestDatabaseOptions{Index: &index}
+
+	testDB, err := m.GetTestDatabaseWithOptions(ctx, hash, options)
+	require.NoError(t, err)
+
+	markers := func(testDB db.TestDatabase) int {
+		conn, err := sql.Open("postgres", testDB.Config.ConnectionString())
+		require.NoError(t, err)
+		defer conn.Close()
+
+		var count int
+		require.NoError(t, conn.QueryRowContext(ctx, fmt.Sprintf("SELECT count(*) FROM %s", manager.SoakMarkerTable)).Scan(&count))
+		return count
+	}
+	assert.Equal(t, 1, markers(testDB))
+
+	// unlocking reuses it with its marker on purpose
+	require.NoError(t, m.ReturnTestDatabase(ctx, hash, testDB.ID))
+	testDB, err = m.GetTestDatabaseWithOptions(ctx, hash, options)
+	require.NoError(t, err)
+
+	// recreating removes the marker
+	require.NoError(t, m.RecreateTestDatabase(ctx, hash, testDB.ID))
+	testDB, err = m.GetTestDatabaseWithOptions(ctx, hash, options)
+	require.NoError(t, err)
+
+	stats, err := m.Stats(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, stats.SoakInvariantViolations)
+
+	// simulate a leaking cleaning pipeline: the marker survives the recreation
+	require.NoError(t, m.RecreateTestDatabase(ctx, hash, testDB.ID))
+	require.Eventually(t, func() bool {
+		explanation, err := m.ExplainGetTestDatabase(ctx, hash, options)
+		return err == nil && explanation.Decision == pool.DecisionReuseReady
+	}, 5*time.Second, 10*time.Millisecond)
+
+	conn, err := sql.Open("postgres", testDB.Config.ConnectionString())
+	require.NoError(t, err)
+	_, err = conn.ExecContext(ctx, fmt.Sprintf("CREATE TABLE %s (handed_out_at timestamptz NOT NULL); INSERT INTO %s VALUES (now())", manager.SoakMarkerTable, manager.SoakMarkerTable))
+	require.NoError(t, err)
+	require.NoError(t, conn.Close())
+
+	_, err = m.GetTestDatabaseWithOptions(ctx, hash, options)
+	require.NoError(t, err)
+
+	stats, err = m.Stats(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, stats.SoakInvariantViolations)
+
+	var violations []events.Event
+	for _, e := range m.RecentEvents(ctx) {
+		if e.Type == events.TypeSoakInvariantViolated {
+			violations = append(violations, e)
+		}
+	}
+	require.Len(t, violations, 1)
+	assert.Equal(t, hash, violations[0].Hash)
+}
+
+func TestManagerSoakInvariantEvictionSwap(t *testing.T) {
+	ctx := context.Background()
+
+	cfg := manager.DefaultManagerConfigFromEnv()
+	cfg.PoolConfig.InitialPoolSize = 3
+	cfg.PoolConfig.MaxPoolSize = 3
+	cfg.SoakInvariantCheck = true
+	m, _ := testManagerWithConfig(cfg)
+
+	if err := m.Initialize(ctx); err != nil {
+		t.Fatalf("initializing manager failed: %v", err)
+	}
+
+	defer disconnectManager(t, m)
+
+	hash := "hashinghash"
+
+	template, err := m.InitializeTemplateDatabase(ctx, hash)
+	require.NoError(t, err)
+
+	populateTemplateDB(t, template)
+
+	_, err = m.FinalizeTemplateDatabase(ctx, hash)
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		explanation, err := m.ExplainGetTestDatabase(ctx, hash, manager.TestDatabaseOptions{})
+		return err == nil && explanation.Pool != nil && explanation.Pool.Ready == 3
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// the warm tail is unlocked with its marker
+	tail := 2
+	testDB, err := m.GetTestDatabaseWithOptions(ctx, hash, manager.TestDatabaseOptions{Index: &tail})
+	require.NoError(t, err)
+	require.NoError(t, m.ReturnTestDatabase(ctx, hash, testDB.ID))
+
+	// shrinking drops the cold test database 0 instead, the tail is renamed into its place along with its flag
+	_, err = m.ResizeTemplatePool(ctx, hash, 1, 2)
+	require.NoError(t, err)
+
+	cold := 0
+	testDB, err = m.GetTestDatabaseWithOptions(ctx, hash, manager.TestDatabaseOptions{Index: &cold})
+	require.NoError(t, err)
+
+	conn, err := sql.Open("postgres", testDB.Config.ConnectionString())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	var markers int
+	require.NoError(t, conn.QueryRowContext(ctx, fmt.Sprintf("SELECT count(*) FROM %s", manager.SoakMarkerTable)).Scan(&markers))
+	assert.Equal(t, 1, markers, "the renamed tail is handed out")
+
+	stats, err := m.Stats(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, stats.SoakInvariantViolations)
+}
+
+func TestManagerTemplateRestoreCheckpoints(t *testing.T) {
+	ctx := context.Background()
+
+	cfg := manager.DefaultManagerConfigFromEnv()
+	cfg.TemplateBackupDir = t.TempDir()
+	cfg.TemplateDumpDir = cfg.TemplateBackupDir
+	cfg.TemplateRestoreCheckpoints = true
+
+	// logs each restored section and fails the data section once
+	wrapperDir := t.TempDir()
+	pgRestore := cfg.PgRestorePath
+	if len(pgRestore) == 0 {
+		pgRestore = "pg_restore"
+	}
+	wrapper := filepath.Join(wrapperDir, "pg_restore")
+	script := fmt.Sprintf(`#!/bin/sh
+for arg in "$@"; do
+	case "$arg" in --section=*) echo "${arg#--section=}" >> %[1]s/sections.log;; esac
+	if [ "$arg" = "--section=data" ] && [ ! -f %[1]s/failed ]; then touch %[1]s/failed; echo "simulated failure" >&2; exit 1; fi
+done
+exec %[2]s "$@"
+`, wrapperDir, pgRestore)
+	require.NoError(t, os.WriteFile(wrapper, []byte(script), 0o700)) // #nosec G306 - executable test script
+	cfg.PgRestorePath = wrapper
+
+	m, _ := testManagerWithConfig(cfg)
+
+	if err := m.Initialize(ctx); err != nil {
+		t.Fatalf("initializing manager failed: %v", err)
+	}
+
+	defer disconnectManager(t, m)
+
+	// take a dump via the backup while discarding
+	template, err := m.InitializeTemplateDatabase(ctx, "hashsource")
+	require.NoError(t, err)
+	populateTemplateDB(t, template)
+	_, err = m.FinalizeTemplateDatabase(ctx, "hashsource")
+	require.NoError(t, err)
+	require.NoError(t, m.DiscardTemplateDatabase(ctx, "hashsource"))
+
+	backups, err := filepath.Glob(filepath.Join(cfg.TemplateBackupDir, "hashsource", "*.dump"))
+	require.NoError(t, err)
+	require.Len(t, backups, 1)
+	dump, err := filepath.Rel(cfg.TemplateDumpDir, backups[0])
+	require.NoError(t, err)
+
+	options := templates.TemplateOptions{SourceKind: templates.TemplateSourceDump, SourceDump: dump}
+
+	_, err = m.InitializeTemplateDatabaseWithOptions(ctx, "hashdump", options)
+	require.Error(t, err)
+
+	stats, err := m.Stats(ctx)
+	require.NoError(t, err)
+	require.Len(t, stats.RestoreCheckpoints, 1)
+	assert.Equal(t, []string{"pre-data"}, stats.RestoreCheckpoints[0].CompletedSections)
+	assert.Equal(t, "data", stats.RestoreCheckpoints[0].FailedSection)
+
+	// resumes after pre-data
+	_, err = m.InitializeTemplateDatabaseWithOptions(ctx, "hashdump", options)
+	require.NoError(t, err)
+	_, err = m.FinalizeTemplateDatabase(ctx, "hashdump")
+	require.NoError(t, err)
+
+	sections, err := os.ReadFile(filepath.Join(wrapperDir, "sections.log"))
+	require.NoError(t, err)
+	assert.Equal(t, "pre-data\ndata\ndata\npost-data\n", string(sections))
+
+	stats, err = m.Stats(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, stats.RestoreCheckpoints)
+
+	test, err := m.GetTestDatabase(ctx, "hashdump")
+	require.NoError(t, err)
+	verifyTestDB(t, test)
+}
+
+func TestManagerOCIExportAndPull(t *testing.T) {
+	ctx := context.Background()
+
+	// minimal in-memory registry without auth
+	var mutex sync.Mutex
+	content := make(map[string][]byte)
+	registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		switch {
+		case req.Method == http.MethodPost:
+			w.Header().Set("Location", req.URL.Path+"1")
+			w.WriteHeader(http.StatusAccepted)
+		case req.Method == http.MethodPut && strings.Contains(req.URL.Path, "/blobs/uploads/"):
+			b, _ := io.ReadAll(req.Body)
+			content["/v2/team/templates/blobs/"+req.URL.Query().Get("digest")] = b
+			w.WriteHeader(http.StatusCreated)
+		case req.Method == http.MethodPut:
+			b, _ := io.ReadAll(req.Body)
+			content[req.URL.Path] = b
+			w.WriteHeader(http.StatusCreated)
+		default:
+			b, ok := content[req.URL.Path]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			_, _ = w.Write(b)
+		}
+	}))
+	defer registry.Close()
+
+	cfg := manager.DefaultManagerConfigFromEnv()
+	cfg.OCI = oci.Config{Registry: strings.TrimPrefix(registry.URL, "http://"), Repository: "team/templates", PlainHTTP: true}
+	cfg.OCIExport = true
+	cfg.OCIPullOnAcquire = true
+	cfg.TemplateDumpDir = t.TempDir()
+
+	m, _ := testManagerWithConfig(cfg)
+
+	if err := m.Initialize(ctx); err != nil {
+		t.Fatalf("initializing manager failed: %v", err)
+	}
+
+	defer disconnectManager(t, m)
+
+	hash := "hashingoci"
+
+	template, err := m.InitializeTemplateDatabase(ctx, hash)
+	require.NoError(t, err)
+	populateTemplateDB(t, template)
+	_, err = m.FinalizeTemplateDatabase(ctx, hash)
+	require.NoError(t, err)
+
+	// pushed in background
+	require.Eventually(t, func() bool {
+		for _, e := range m.RecentEvents(ctx) {
+			if e.Type == events.TypeTemplateExported && e.Hash == hash {
+				return true
+			}
+		}
+		return false
+	}, 10*time.Second, 50*time.Millisecond)
+
+	// e.g. another instance without the template: the first acquisition pulls it
+	require.NoError(t, m.DiscardTemplateDatabase(ctx, hash))
+
+	test, err := m.GetTestDatabase(ctx, hash)
+	require.NoError(t, err)
+	verifyTestDB(t, test)
+	assert.FileExists(t, filepath.Join(cfg.TemplateDumpDir, "oci", hash+".dump"))
+
+	// artifacts pulled from the registry are not exported again
+	for _, e := range m.RecentEvents(ctx) {
+		if e.Type == events.TypeTemplateExported {
+			assert.Equal(t, hash, e.Hash)
+		}
+	}
+
+	_, err = m.GetTestDatabase(ctx, "hashingunknown")
+	assert.ErrorIs(t, err, manager.ErrTemplateNotFound)
+
+	_, err = m.InitializeTemplateDatabaseWithOptions(ctx, "hashingunknown", templates.TemplateOptions{SourceKind: templates.TemplateSourceOCI})
+	assert.ErrorIs(t, err, manager.ErrInvalidTemplateOptions)
+
+	_, err = m.InitializeTemplateDatabaseWithOptions(ctx, "hashingartifact", templates.TemplateOptions{SourceArtifact: hash})
+	assert.ErrorIs(t, err, manager.ErrInvalidTemplateOptions)
+}
+
+func TestManagerGetTestDatabaseProgress(t *testing.T) {
+	ctx := context.Background()
+
+	m := testManagerFromEnv()
+	if err := m.Initialize(ctx); err != nil {
+		t.Fatalf("initializing manager failed: %v", err)
+	}
+
+	defer disconnectManager(t, m)
+
+	hash := "hashingprogress"
+
+	template, err := m.InitializeTemplateDatabase(ctx, hash)
+	require.NoError(t, err)
+	populateTemplateDB(t, template)
+
+	var mutex sync.Mutex
+	phases := []manager.ProgressPhase{}
+	progressCtx := manager.WithProgress(ctx, 20*time.Millisecond, func(p manager.Progress) error {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		assert.Equal(t, hash, p.Hash)
+		if len(phases) == 0 || phases[len(phases)-1] != p.Phase {
+			phases = append(phases, p.Phase)
+		}
+		return nil
+	})
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		_, err := m.FinalizeTemplateDatabase(ctx, hash)
+		assert.NoError(t, err)
+	}()
+
+	test, err := m.GetTestDatabase(progressCtx, hash)
+	require.NoError(t, err)
+	verifyTestDB(t, test)
+
+	// the phase change is reported immediately after the first report
+	mutex.Lock()
+	require.Equal(t, []manager.ProgressPhase{manager.ProgressWaitTemplate, manager.ProgressWaitTestDatabase}, phases)
+	mutex.Unlock()
+
+	// the progress func cancels the acquisition
+	template, err = m.InitializeTemplateDatabase(ctx, "hashingprogresscancel")
+	require.NoError(t, err)
+
+	errBudget := errors.New("estimate exceeds budget")
+	start := time.Now()
+	_, err = m.GetTestDatabase(manager.WithProgress(ctx, 20*time.Millisecond, func(p manager.Progress) error {
+		assert.Equal(t, manager.ProgressWaitTemplate, p.Phase)
+		assert.Equal(t, templates.TemplateStateInit, p.TemplateState)
+		return errBudget
+	}), template.TemplateHash)
+	require.ErrorIs(t, err, errBudget)
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestManagerTemplateQuota(t *testing.T) {
+	ctx := context.Background()
+
+	cfg := manager.DefaultManagerConfigFromEnv()
+	cfg.MaxTemplatesPerNamespace = 2
+	m, _ := testManagerWithConfig(cfg)
+	if err := m.Initialize(ctx); err != nil {
+		t.Fatalf("initializing manager failed: %v", err)
+	}
+
+	defer disconnectManager(t, m)
+
+	for _, hash := range []string{"hashquota1", "hashquota2"} {
+		template, err := m.InitializeTemplateDatabaseWithOptions(ctx, hash, templates.TemplateOptions{Namespace: "team-a"})
+		require.NoError(t, err)
+
+		populateTemplateDB(t, template)
+
+		_, err = m.FinalizeTemplateDatabase(ctx, hash)
+		require.NoError(t, err)
+	}
+
+	// keep hashquota2 in use, only hashquota1 is suggested for eviction
+	_, err := m.GetTestDatabase(ctx, "hashquota2")
+	require.NoError(t, err)
+
+	_, err = m.InitializeTemplateDatabaseWithOptions(ctx, "hashquota3", templates.TemplateOptions{Namespace: "team-a"})
+	require.ErrorIs(t, err, manager.ErrTemplateQuotaExceeded)
+
+	var quotaErr *manager.TemplateQuotaError
+	require.ErrorAs(t, err, &quotaErr)
+	assert.Equal(t, "team-a", quotaErr.Namespace)
+	assert.Equal(t, 2, quotaErr.Count)
+	assert.Equal(t, 2, quotaErr.Limit)
+	assert.Equal(t, []string{"hashquota1"}, quotaErr.EvictionCandidates)
+
+	// other namespaces aren't affected, reinitializing a tracked template never exceeds the quota
+	_, err = m.InitializeTemplateDatabaseWithOptions(ctx, "hashquota3", templates.TemplateOptions{Namespace: "team-b"})
+	require.NoError(t, err)
+
+	_, err = m.InitializeTemplateDatabaseWithOptions(ctx, "hashquota1", templates.TemplateOptions{Namespace: "team-a"})
+	require.ErrorIs(t, err, manager.ErrTemplateAlreadyInitialized)
+
+	require.NoError(t, m.DiscardTemplateDatabase(ctx, "hashquota1"))
+
+	_, err = m.InitializeTemplateDatabaseWithOptions(ctx, "hashquota4", templates.TemplateOptions{Namespace: "team-a"})
+	require.NoError(t, err)
+}
+
+func TestManagerTemplateSharing(t *testing.T) {
+	ctx := context.Background()
+
+	cfg := manager.DefaultManagerConfigFromEnv()
+	cfg.TemplateSharingNamespaces = []string{"team-a", "team-b"}
+	m, _ := testManagerWithConfig(cfg)
+	if err := m.Initialize(ctx); err != nil {
+		t.Fatalf("initializing manager failed: %v", err)
+	}
+
+	defer disconnectManager(t, m)
+
+	hash := "hashsharing"
+
+	template, err := m.InitializeTemplateDatabaseWithOptions(ctx, hash, templates.TemplateOptions{Namespace: "team-a"})
+	require.NoError(t, err)
+
+	populateTemplateDB(t, template)
+
+	_, err = m.FinalizeTemplateDatabase(ctx, hash)
+	require.NoError(t, err)
+
+	// team-c doesn't share its templates
+	_, err = m.InitializeTemplateDatabaseWithOptions(ctx, hash, templates.TemplateOptions{Namespace: "team-c"})
+	require.ErrorIs(t, err, manager.ErrTemplateNamespaceConflict)
+
+	// team-b shares the template database and pool of team-a
+	_, err = m.InitializeTemplateDatabaseWithOptions(ctx, hash, templates.TemplateOptions{Namespace: "team-b"})
+	require.ErrorIs(t, err, manager.ErrTemplateAlreadyInitialized)
+
+	testDB, err := m.GetTestDatabase(ctx, hash)
+	require.NoError(t, err)
+	assert.Equal(t, hash, testDB.TemplateHash)
+
+	var shared []events.Event
+	for _, e := range m.RecentEvents(ctx) {
+		if e.Type == events.TypeTemplateShared {
+			shared = append(shared, e)
+		}
+	}
+	require.Len(t, shared, 1)
+	assert.Equal(t, hash, shared[0].Hash)
+	assert.Equal(t, "team-b", shared[0].Fields["namespace"])
+	assert.Equal(t, "team-a", shared[0].Fields["owner"])
+}
+
+func TestManagerTemplateSharingDefault(t *testing.T) {
+	ctx := context.Background()
+
+	m, _ := testManagerFromEnvWithConfig()
+	if err := m.Initialize(ctx); err != nil {
+		t.Fatalf("initializing manager failed: %v", err)
+	}
+
+	defer disconnectManager(t, m)
+
+	hash := "hashsharingdefault"
+
+	// each runner token is its own namespace, the second runner waits for the template of the first one as before
+	runnerA := audit.TokenFingerprint("Bearer runner-a")
+	runnerB := audit.TokenFingerprint("Bearer runner-b")
+
+	_, err := m.InitializeTemplateDatabaseWithOptions(ctx, hash, templates.TemplateOptions{Namespace: runnerA})
+	require.NoError(t, err)
+
+	_, err = m.InitializeTemplateDatabaseWithOptions(ctx, hash, templates.TemplateOptions{Namespace: runnerB})
+	require.ErrorIs(t, err, manager.ErrTemplateAlreadyInitialized)
+}
+
+func TestManagerForceDropDatabase(t *testing.T) {
+	ctx := context.Background()
+
+	cfg := manager.DefaultManagerConfigFromEnv()
+	cfg.ForceDropDatabase = true
+	m, _ := testManagerWithConfig(cfg)
+	if err := m.Initialize(ctx); err != nil {
+		t.Fatalf("initializing manager failed: %v", err)
+	}
+
+	defer disconnectManager(t, m)
+
+	hash := "hashinghash"
+
+	template, err := m.InitializeTemplateDatabase(ctx, hash)
+	require.NoError(t, err)
+
+	populateTemplateDB(t, template)
+
+	_, err = m.FinalizeTemplateDatabase(ctx, hash)
+	require.NoError(t, err)
+
+	testDB, err := m.GetTestDatabase(ctx, hash)
+	require.NoError(t, err)
+
+	// a test leaking its connection
+	leaked, err := sql.Open("postgres", testDB.Config.ConnectionString())
+	require.NoError(t, err)
+	defer leaked.Close()
+	leaked.SetMaxOpenConns(1)
+	require.NoError(t, leaked.PingContext(ctx))
+
+	require.NoError(t, m.DiscardTemplateDatabase(ctx, hash))
+
+	// the leaked connection was terminated, reconnecting fails as the test database is gone
+	var alive bool
+	require.Error(t, leaked.QueryRowContext(ctx, "SELECT true").Scan(&alive))
+}
+
+func TestManagerStatsHistory(t *testing.T) {
+	ctx := context.Background()
+
+	cfg := manager.DefaultManagerConfigFromEnv()
+	cfg.StatsHistoryResolution = 10 * time.Millisecond
+	cfg.StatsHistoryRetention = 50 * time.Millisecond
+	m, _ := testManagerWithConfig(cfg)
+	if err := m.Initialize(ctx); err != nil {
+		t.Fatalf("initializing manager failed: %v", err)
+	}
+
+	defer disconnectManager(t, m)
+
+	hash := "hashinghash"
+
+	template, err := m.InitializeTemplateDatabase(ctx, hash)
+	require.NoError(t, err)
+
+	populateTemplateDB(t, template)
+
+	_, err = m.FinalizeTemplateDatabase(ctx, hash)
+	require.NoError(t, err)
+
+	_, err = m.GetTestDatabase(ctx, hash)
+	require.NoError(t, err)
+
+	checkedOut := time.Now()
+
+	require.Eventually(t, func() bool {
+		points, err := m.StatsHistory(ctx, checkedOut, 0)
+		return err == nil && len(points) > 0 && points[len(points)-1].MaxDirty >= 1
+	}, time.Second, 10*time.Millisecond)
+
+	// only the samples within the retention are kept
+	time.Sleep(100 * time.Millisecond)
+
+	points, err := m.StatsHistory(ctx, time.Time{}, 0)
+	require.NoError(t, err)
+	assert.LessOrEqual(t, len(points), 5)
+	for _, point := range points {
+		assert.Equal(t, 1, point.Samples)
+		assert.Equal(t, 1.0, point.Templates)
+		assert.GreaterOrEqual(t, point.Dirty, 1.0)
+	}
+
+	// downsampled into a single step (or two, if crossing its boundary)
+	downsampled, err := m.StatsHistory(ctx, time.Time{}, time.Hour)
+	require.NoError(t, err)
+	require.NotEmpty(t, downsampled)
+	assert.LessOrEqual(t, len(downsampled), 2)
+	assert.Equal(t, time.Now().Truncate(time.Hour), downsampled[len(downsampled)-1].Time.Truncate(time.Hour))
+
+	// disabled
+	cfg.StatsHistoryResolution = 0
+	disabled, _ := testManagerWithConfig(cfg)
+	_, err = disabled.StatsHistory(ctx, time.Time{}, 0)
+	assert.ErrorIs(t, err, manager.ErrStatsHistoryDisabled)
+}
+
+func TestManagerPrebuildTemplates(t *testing.T) {
+	ctx := context.Background()
+
+	cfg := manager.DefaultManagerConfigFromEnv()
+	cfg.TemplateBackupDir = t.TempDir()
+	cfg.TemplateDumpDir = cfg.TemplateBackupDir
+	cfg.TemplateUsageFile = filepath.Join(t.TempDir(), "usage.json")
+	cfg.StartupPrebuildTemplates = 2
+	m, _ := testManagerWithConfig(cfg)
+
+	if err := m.Initialize(ctx); err != nil {
+		t.Fatalf("initializing manager failed: %v", err)
+	}
+
+	for _, hash := range []string{"hashinghash", "nobackup"} {
+		template, err := m.InitializeTemplateDatabase(ctx, hash)
+		require.NoError(t, err)
+
+		populateTemplateDB(t, template)
+
+		_, err = m.FinalizeTemplateDatabase(ctx, hash)
+		require.NoError(t, err)
+
+		_, err = m.GetTestDatabase(ctx, hash)
+		require.NoError(t, err)
+	}
+
+	// backed up while discarding, the other one can't be prebuilt
+	require.NoError(t, m.DiscardTemplateDatabase(ctx, "hashinghash"))
+
+	// the usage is persisted on disconnect
+	require.NoError(t, m.Disconnect(ctx, true))
+
+	b, err := os.ReadFile(cfg.TemplateUsageFile)
+	require.NoError(t, err)
+
+	var usage []manager.TemplateUsageRecord
+	require.NoError(t, json.Unmarshal(b, &usage))
+	require.Len(t, usage, 2)
+	for _, u := range usage {
+		assert.Equal(t, 1, u.Acquisitions)
+	}
+
+	restarted, _ := testManagerWithConfig(cfg)
+	if err := restarted.Initialize(ctx); err != nil {
+		t.Fatalf("initializing manager failed: %v", err)
+	}
+
+	defer disconnectManager(t, restarted)
+
+	summary, err := restarted.PrebuildTemplates(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"hashinghash"}, summary.Prebuilt)
+	assert.Contains(t, summary.Skipped, "nobackup")
+
+	// ready without initializing it again
+	_, err = restarted.GetTestDatabase(ctx, "hashinghash")
+	require.NoError(t, err)
+
+	_, err = restarted.GetTestDatabase(ctx, "nobackup")
+	assert.ErrorIs(t, err, manager.ErrTemplateNotFound)
+}
+
+func TestManagerMetricSamples(t *testing.T) {
+	ctx := context.Background()
+
+	m := testManagerFromEnv()
+	if err := m.Initialize(ctx); err != nil {
+		t.Fatalf("initializing manager failed: %v", err)
+	}
+
+	defer disconnectManager(t, m)
+
+	hash := "hashinghash"
+
+	template, err := m.InitializeTemplateDatabase(ctx, hash)
+	require.NoError(t, err)
+
+	populateTemplateDB(t, template)
+
+	_, err = m.FinalizeTemplateDatabase(ctx, hash)
+	require.NoError(t, err)
+
+	_, err = m.GetTestDatabase(ctx, hash)
+	require.NoError(t, err)
+
+	_, err = m.InitializeTemplateDatabase(ctx, "initializing")
+	require.NoError(t, err)
+
+	values := make(map[string]float64)
+	for _, sample := range m.MetricSamples() {
+		key := sample.Name
+		for _, label := range []string{metrics.LabelOperation, metrics.LabelResult, metrics.LabelHash, metrics.LabelState} {
+			if v, ok := sample.Labels[label]; ok {
+				key += "," + v
+			}
+		}
+		values[key] = sample.Value
+	}
+
+	assert.Equal(t, 1.0, values["templates,finalized"])
+	assert.Equal(t, 1.0, values["templates,init"])
+	assert.Equal(t, 0.0, values["templates,discarded"])
+	assert.GreaterOrEqual(t, values["pool_test_databases,hashinghash,dirty"], 1.0)
+	assert.GreaterOrEqual(t, values["pool_size,hashinghash"], 1.0)
+	assert.NotContains(t, values, "pool_size,initializing")
+	assert.GreaterOrEqual(t, values["database_operations,create,success"], 3.0) // both templates and the test database
+}
+
+func TestManagerIsolateTestDatabases(t *testing.T) {
+	ctx := context.Background()
+
+	cfg := manager.DefaultManagerConfigFromEnv()
+	cfg.IsolateTestDatabases = true
+	cfg.IsolatedSearchPath = `"$user", public`
+	m, _ := testManagerWithConfig(cfg)
+
+	if err := m.Initialize(ctx); err != nil {
+		t.Fatalf("initializing manager failed: %v", err)
+	}
+
+	defer disconnectManager(t, m)
+
+	hash := "hashinghash"
+
+	template, err := m.InitializeTemplateDatabase(ctx, hash)
+	require.NoError(t, err)
+
+	populateTemplateDB(t, template)
+
+	_, err = m.FinalizeTemplateDatabase(ctx, hash)
+	require.NoError(t, err)
+
+	test, err := m.GetTestDatabase(ctx, hash)
+	require.NoError(t, err)
+
+	conn, err := sql.Open("postgres", test.Database.Config.ConnectionString())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	// PUBLIC may neither connect to the test database nor create within the schemas of the template
+	var publicConnect, publicCreate bool
+	require.NoError(t, conn.QueryRowContext(ctx,
+		"SELECT has_database_privilege('public', current_database(), 'CONNECT'), has_schema_privilege('public', 'public', 'CREATE')").Scan(&publicConnect, &publicCreate))
+	assert.False(t, publicConnect)
+	assert.False(t, publicCreate)
+
+	var searchPath string
+	require.NoError(t, conn.QueryRowContext(ctx, "SHOW search_path").Scan(&searchPath))
+	assert.Equal(t, `"$user", public`, searchPath)
+
+	// the owner still works within the test database
+	var count int
+	require.NoError(t, conn.QueryRowContext(ctx, "SELECT COUNT(*) FROM pilots").Scan(&count))
+	assert.Equal(t, 2, count)
+}
+
+func TestManagerTemplateWebhooks(t *testing.T) {
+	ctx := context.Background()
+
+	payloads := make(chan manager.TemplateWebhookPayload, 2)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+		assert.True(t, webhook.Verify("secret", body, r.Header.Get(webhook.SignatureHeader)))
+
+		var payload manager.TemplateWebhookPayload
+		assert.NoError(t, json.Unmarshal(body, &payload))
+		assert.Equal(t, payload.Event, r.Header.Get(webhook.EventHeader))
+		payloads <- payload
+
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	cfg := manager.DefaultManagerConfigFromEnv()
+	cfg.Webhook.Secret = "secret"
+	m, _ := testManagerWithConfig(cfg)
+	if err := m.Initialize(ctx); err != nil {
+		t.Fatalf("initializing manager failed: %v", err)
+	}
+
+	defer disconnectManager(t, m)
+
+	options := templates.TemplateOptions{
+		ReadyWebhook:  server.URL + "/ready",
+		FailedWebhook: server.URL + "/failed",
+	}
+
+	// ready
+	template, err := m.InitializeTemplateDatabaseWithOptions(ctx, "hashinghash", options)
+	require.NoError(t, err)
+	populateTemplateDB(t, template)
+	_, err = m.FinalizeTemplateDatabase(ctx, "hashinghash")
+	require.NoError(t, err)
+
+	select {
+	case payload := <-payloads:
+		assert.Equal(t, manager.TemplateWebhookReady, payload.Event)
+		assert.Equal(t, "hashinghash", payload.TemplateHash)
+		assert.Empty(t, payload.Error)
+	case <-time.After(5 * time.Second):
+		t.Fatal("ready webhook not received")
+	}
+
+	// failed, discarded before being finalized
+	_, err = m.InitializeTemplateDatabaseWithOptions(ctx, "hashinghash2", options)
+	require.NoError(t, err)
+	require.NoError(t, m.DiscardTemplateDatabase(ctx, "hashinghash2"))
+
+	select {
+	case payload := <-payloads:
+		assert.Equal(t, manager.TemplateWebhookFailed, payload.Event)
+		assert.Equal(t, "hashinghash2", payload.TemplateHash)
+		assert.Equal(t, manager.ErrTemplateDiscarded.Error(), payload.Error)
+	case <-time.After(5 * time.Second):
+		t.Fatal("failed webhook not received")
+	}
+
+	// invalid url
+	_, err = m.InitializeTemplateDatabaseWithOptions(ctx, "hashinghash3", templates.TemplateOptions{ReadyWebhook: "ci.example.com/ready"})
+	assert.ErrorIs(t, err, manager.ErrInvalidTemplateOptions)
+}
+
+func TestManagerDiscardTemplateInUse(t *testing.T) {
+	ctx := context.Background()
+
+	cfg := manager.DefaultManagerConfigFromEnv()
+	cfg.TemplateDiscardWaitTimeout = 200 * time.Millisecond
+	m, _ := testManagerWithConfig(cfg)
+	if err := m.Initialize(ctx); err != nil {
+		t.Fatalf("initializing manager failed: %v", err)
+	}
+
+	defer disconnectManager(t, m)
+
+	hash := "hashinghash"
+
+	template, err := m.InitializeTemplateDatabase(ctx, hash)
+	require.NoError(t, err)
+
+	// a connection to the template which is never closed in time
+	conn, err := sql.Open("postgres", template.Config.ConnectionString())
+	require.NoError(t, err)
+	defer conn.Close()
+	conn.SetMaxOpenConns(1)
+	require.NoError(t, conn.PingContext(ctx))
+
+	start := time.Now()
+	err = m.DiscardTemplateDatabase(ctx, hash)
+	assert.GreaterOrEqual(t, time.Since(start), cfg.TemplateDiscardWaitTimeout)
+	assert.ErrorIs(t, err, pool.ErrTestDBInUse)
+
+	var inUseErr *manager.TemplateInUseError
+	require.ErrorAs(t, err, &inUseErr)
+	assert.Equal(t, template.Config.Database, inUseErr.TemplateDatabase)
+	require.Len(t, inUseErr.Blockers, 1)
+	assert.Equal(t, manager.TemplateBlockerConnection, inUseErr.Blockers[0].Kind)
+	assert.Equal(t, template.Config.Database, inUseErr.Blockers[0].Database)
+
+	// the connection is closed while waiting, the (now untracked) template database gets dropped
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		conn.Close()
+	}()
+
+	require.NoError(t, m.DiscardTemplateDatabase(ctx, hash))
+	assert.ErrorIs(t, m.DiscardTemplateDatabase(ctx, hash), manager.ErrTemplateNotFound)
+}
+
+func TestManagerLogicalClone(t *testing.T) {
+	ctx := context.Background()
+
+	_, err := manager.ParseCloneStrategy("copy")
+	assert.ErrorIs(t, err, manager.ErrInvalidCloneStrategy)
+
+	cfg := manager.DefaultManagerConfigFromEnv()
+	cfg.CloneStrategy = manager.CloneStrategyLogical
+	m, _ := testManagerWithConfig(cfg)
+	if err := m.Initialize(ctx); err != nil {
+		t.Fatalf("initializing manager failed: %v", err)
+	}
+
+	defer disconnectManager(t, m)
+
+	hash := "hashinghash"
+
+	template, err := m.InitializeTemplateDatabase(ctx, hash)
+	require.NoError(t, err)
+
+	populateTemplateDB(t, template)
+
+	_, err = m.FinalizeTemplateDatabase(ctx, hash)
+	require.NoError(t, err)
+
+	// restored via pg_dump | pg_restore instead of CREATE DATABASE ... TEMPLATE
+	testDB, err := m.GetTestDatabase(ctx, hash)
+	require.NoError(t, err)
+	verifyTestDB(t, testDB)
+
+	require.NoError(t, m.RecreateTestDatabase(ctx, hash, testDB.ID))
+
+	testDB, err = m.GetTestDatabase(ctx, hash)
+	require.NoError(t, err)
+	verifyTestDB(t, testDB)
+}
+
+func TestManagerStaleCheckouts(t *testing.T) {
+	ctx := context.Background()
+
+	payloads := make(chan manager.StaleCheckoutWebhookPayload, 4)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload manager.StaleCheckoutWebhookPayload
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&payload))
+		assert.Equal(t, manager.StaleCheckoutWebhook, r.Header.Get(webhook.EventHeader))
+		payloads <- payload
+
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	cfg := manager.DefaultManagerConfigFromEnv()
+	cfg.StaleCheckoutCheckInterval = 20 * time.Millisecond
+	cfg.PoolConfig.TestDatabaseMinimalLifetime = 50 * time.Millisecond
+	m, _ := testManagerWithConfig(cfg)
+	if err := m.Initialize(ctx); err != nil {
+		t.Fatalf("initializing manager failed: %v", err)
+	}
+	defer disconnectManager(t, m)
+
+	hash := "hashinghash"
+
+	// disabled by default, enabled for this template only
+	template, err := m.InitializeTemplateDatabaseWithOptions(ctx, hash, templates.TemplateOptions{
+		StaleCheckoutAlertAfter: 100 * time.Millisecond,
+		StaleCheckoutWebhook:    server.URL,
+	})
+	require.NoError(t, err)
+	populateTemplateDB(t, template)
+	_, err = m.FinalizeTemplateDatabase(ctx, hash)
+	require.NoError(t, err)
+
+	stale, err := m.GetTestDatabase(pool.WithHolder(ctx, "worker-12"), hash)
+	require.NoError(t, err)
+
+	// renewing the lease is a heartbeat of a test still running
+	renewed, err := m.GetTestDatabase(ctx, hash)
+	require.NoError(t, err)
+	_, err = m.RenewTestDatabase(ctx, hash, renewed.ID)
+	require.NoError(t, err)
+
+	select {
+	case payload := <-payloads:
+		assert.Equal(t, hash, payload.TemplateHash)
+		assert.Equal(t, stale.ID, payload.ID)
+		assert.Equal(t, "worker-12", payload.Holder)
+		assert.GreaterOrEqual(t, payload.DurationMs, int64(100))
+		assert.Equal(t, int64(100), payload.ThresholdMs)
+		assert.NotNil(t, payload.LeaseExpiresAt)
+		assert.Contains(t, payload.Message, "by worker-12")
+	case <-time.After(5 * time.Second):
+		t.Fatal("stale checkout webhook not received")
+	}
+
+	// each checkout is alerted once
+	time.Sleep(10 * cfg.StaleCheckoutCheckInterval)
+	assert.Empty(t, payloads)
+
+	var alerted int
+	for _, e := range m.RecentEvents(ctx) {
+		if e.Type == events.TypeStaleCheckout {
+			alerted++
+			assert.Equal(t, "worker-12", e.Fields["holder"])
+		}
+	}
+	assert.Equal(t, 1, alerted)
+
+	require.NoError(t, m.ReturnTestDatabase(ctx, hash, stale.ID))
+	require.NoError(t, m.ReturnTestDatabase(ctx, hash, renewed.ID))
+}
+
+func TestManagerTemplateTTL(t *testing.T) {
+	ctx := context.Background()
+
+	cfg := manager.DefaultManagerConfigFromEnv()
+	cfg.TemplateTTLCheckInterval = 20 * time.Millisecond
+	m, _ := testManagerWithConfig(cfg)
+	if err := m.Initialize(ctx); err != nil {
+		t.Fatalf("initializing manager failed: %v", err)
+	}
+	defer disconnectManager(t, m)
+
+	hash := "hashinghash"
+	hashWithoutTTL := "hashinghash2"
+
+	template, err := m.InitializeTemplateDatabaseWithOptions(ctx, hash, templates.TemplateOptions{TTL: 200 * time.Millisecond})
+	require.NoError(t, err)
+	populateTemplateDB(t, template)
+	_, err = m.FinalizeTemplateDatabase(ctx, hash)
+	require.NoError(t, err)
+
+	template2, err := m.InitializeTemplateDatabase(ctx, hashWithoutTTL)
+	require.NoError(t, err)
+	populateTemplateDB(t, template2)
+	_, err = m.FinalizeTemplateDatabase(ctx, hashWithoutTTL)
+	require.NoError(t, err)
+
+	// the discard is deferred while a test database is checked out
+	test, err := m.GetTestDatabase(ctx, hash)
+	require.NoError(t, err)
+	time.Sleep(400 * time.Millisecond)
+
+	test2, err := m.GetTestDatabase(ctx, hash)
+	require.NoError(t, err)
+
+	require.NoError(t, m.ReturnTestDatabase(ctx, hash, test.ID))
+	require.NoError(t, m.ReturnTestDatabase(ctx, hash, test2.ID))
+	require.Eventually(t, func() bool {
+		for _, e := range m.RecentEvents(ctx) {
+			if e.Type == events.TypeTemplateExpired && e.Hash == hash {
+				return true
+			}
+		}
+		return false
+	}, 5*time.Second, 20*time.Millisecond)
+
+	_, err = m.GetTestDatabase(ctx, hash)
+	assert.ErrorIs(t, err, manager.ErrTemplateNotFound)
+
+	// the default TTL is disabled
+	_, err = m.GetTestDatabase(ctx, hashWithoutTTL)
+	assert.NoError(t, err)
+}
+
+func TestManagerFillOptions(t *testing.T) {
+	ctx := context.Background()
+
+	cfg := manager.DefaultManagerConfigFromEnv()
+	cfg.PoolConfig.InitialPoolSize = 4
+	cfg.PoolConfig.MaxParallelFills = 1
+	m, _ := testManagerWithConfig(cfg)
+	if err := m.Initialize(ctx); err != nil {
+		t.Fatalf("initializing manager failed: %v", err)
+	}
+	defer disconnectManager(t, m)
+
+	hash := "hashinghash"
+
+	template, err := m.InitializeTemplateDatabaseWithOptions(ctx, hash, templates.TemplateOptions{FillConcurrency: 1, FillPriority: 10})
+	require.NoError(t, err)
+	populateTemplateDB(t, template)
+	_, err = m.FinalizeTemplateDatabase(ctx, hash)
+	require.NoError(t, err)
+
+	// the pool fills one after another
+	for i := 0; i < cfg.PoolConfig.InitialPoolSize; i++ {
+		_, err := m.GetTestDatabase(ctx, hash)
+		require.NoError(t, err)
+	}
+
+	_, err = m.InitializeTemplateDatabaseWithOptions(ctx, "invalidconcurrency", templates.TemplateOptions{FillConcurrency: -1})
+	assert.ErrorIs(t, err, manager.ErrInvalidTemplateOptions)
+}
+
+func TestManagerBootstrapTemplateDatabase(t *testing.T) {
+	ctx := context.Background()
+
+	cfg := manager.DefaultManagerConfigFromEnv()
+	cfg.TemplateBackupDir = t.TempDir()
+	cfg.TemplateDumpDir = cfg.TemplateBackupDir
+	m, cfg := testManagerWithConfig(cfg)
+	if err := m.Initialize(ctx); err != nil {
+		t.Fatalf("initializing manager failed: %v", err)
+	}
+	defer disconnectManager(t, m)
+
+	// the backup taken while discarding serves as dump
+	template, err := m.InitializeTemplateDatabase(ctx, "hashsource")
+	require.NoError(t, err)
+	populateTemplateDB(t, template)
+	_, err = m.FinalizeTemplateDatabase(ctx, "hashsource")
+	require.NoError(t, err)
+	require.NoError(t, m.DiscardTemplateDatabase(ctx, "hashsource"))
+
+	backups, err := filepath.Glob(filepath.Join(cfg.TemplateBackupDir, "hashsource", "*.dump"))
+	require.NoError(t, err)
+	require.Len(t, backups, 1)
+	dump, err := filepath.Rel(cfg.TemplateDumpDir, backups[0])
+	require.NoError(t, err)
+
+	hash := "hashinghash"
+	options := templates.TemplateOptions{SourceKind: templates.TemplateSourceDump, SourceDump: dump}
+
+	// concurrent bootstraps join the same initialization
+	var wg sync.WaitGroup
+	results := make([]db.TemplateDatabase, 3)
+	errs := make([]error, 3)
+	for i := range results {
+		i := i
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], errs[i] = m.BootstrapTemplateDatabase(ctx, hash, options)
+		}()
+	}
+	wg.Wait()
+
+	for i := range results {
+		require.NoError(t, errs[i])
+		assert.Equal(t, hash, results[i].TemplateHash)
+		assert.Equal(t, results[0].Config.Database, results[i].Config.Database)
+	}
+
+	test, err := m.GetTestDatabase(ctx, hash)
+	require.NoError(t, err)
+	assert.Equal(t, hash, test.TemplateHash)
+
+	// finalized templates are returned as-is
+	again, err := m.BootstrapTemplateDatabase(ctx, hash, options)
+	require.NoError(t, err)
+	assert.Equal(t, results[0].Config.Database, again.Config.Database)
+
+	_, err = m.BootstrapTemplateDatabase(ctx, "hashempty", templates.TemplateOptions{})
+	assert.ErrorIs(t, err, manager.ErrInvalidTemplateOptions)
+}
+
+func TestManagerLeaseReclaim(t *testing.T) {
+	ctx := context.Background()
+
+	cfg := manager.DefaultManagerConfigFromEnv()
+	cfg.PoolConfig.TestDatabaseLeaseSweepInterval = 20 * time.Millisecond
+	m, _ := testManagerWithConfig(cfg)
+	if err := m.Initialize(ctx); err != nil {
+		t.Fatalf("initializing manager failed: %v", err)
+	}
+	defer disconnectManager(t, m)
+
+	hash := "hashinghash"
+
+	template, err := m.InitializeTemplateDatabase(ctx, hash)
+	require.NoError(t, err)
+	populateTemplateDB(t, template)
+	_, err = m.FinalizeTemplateDatabase(ctx, hash)
+	require.NoError(t, err)
+
+	// never returned, e.g. as the client crashed
+	_, err = m.GetTestDatabaseWithOptions(ctx, hash, manager.TestDatabaseOptions{LeaseDuration: 300 * time.Millisecond})
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		stats, err := m.Stats(ctx)
+		require.NoError(t, err)
+		return stats.Pools[0].LeaseReclaims == 1
+	}, 5*time.Second, 20*time.Millisecond)
+
+	_, err = m.GetTestDatabaseWithOptions(ctx, hash, manager.TestDatabaseOptions{LeaseDuration: -time.Second})
+	assert.ErrorIs(t, err, manager.ErrInvalidTestDatabaseOptions)
+}
+
+func TestManagerAdvisoryLocks(t *testing.T) {
+	ctx := context.Background()
+
+	cfg := manager.DefaultManagerConfigFromEnv()
+	cfg.AdvisoryLocks = true
+
+	m1, _ := testManagerWithConfig(cfg)
+	if err := m1.Initialize(ctx); err != nil {
+		t.Fatalf("initializing manager failed: %v", err)
+	}
+	defer disconnectManager(t, m1)
+
+	hash := "hashinghash"
+
+	template, err := m1.InitializeTemplateDatabase(ctx, hash)
+	require.NoError(t, err)
+	populateTemplateDB(t, template)
+	_, err = m1.FinalizeTemplateDatabase(ctx, hash)
+	require.NoError(t, err)
+
+	test, err := m1.GetTestDatabase(ctx, hash)
+	require.NoError(t, err)
+
+	// the second instance must not drop the test databases of the running one
+	m2, _ := testManagerWithConfig(cfg)
+	if err := m2.Initialize(ctx); err != nil {
+		t.Fatalf("initializing second manager failed: %v", err)
+	}
+	defer disconnectManager(t, m2)
+
+	managerDB, err := sql.Open("postgres", cfg.ManagerDatabaseConfig.ConnectionString())
+	require.NoError(t, err)
+	defer managerDB.Close()
+
+	var exists bool
+	require.NoError(t, managerDB.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM pg_database WHERE datname = $1)", test.Config.Database).Scan(&exists))
+	assert.True(t, exists, "test database of the running instance should have been kept")
+
+	// both hold the shared instance lock
+	var holders int
+	require.NoError(t, managerDB.QueryRowContext(ctx, "SELECT count(*) FROM pg_locks WHERE locktype = 'advisory' AND mode = 'ShareLock' AND classid = $1::oid", 0x49510000).Scan(&holders))
+	assert.Equal(t, 2, holders)
+}
+
+func TestManagerScheduledTasks(t *testing.T) {
+	ctx := context.Background()
+
+	cfg := manager.DefaultManagerConfigFromEnv()
+	cfg.ScheduleFile = filepath.Join(t.TempDir(), "schedule.json")
+	m, _ := testManagerWithConfig(cfg)
+	if err := m.Initialize(ctx); err != nil {
+		t.Fatalf("initializing manager failed: %v", err)
+	}
+	defer disconnectManager(t, m)
+
+	_, err := m.ScheduleTask(ctx, manager.ScheduledTask{Cron: "not a cron", Operation: manager.ScheduledOperationShrinkPools})
+	assert.ErrorIs(t, err, manager.ErrInvalidScheduledTask)
+	_, err = m.ScheduleTask(ctx, manager.ScheduledTask{Cron: "0 3 * * *", Operation: manager.ScheduledOperationRefreshTemplate})
+	assert.ErrorIs(t, err, manager.ErrInvalidScheduledTask)
+	_, err = m.ScheduleTask(ctx, manager.ScheduledTask{Cron: "0 3 * * *", Operation: "unknown"})
+	assert.ErrorIs(t, err, manager.ErrInvalidScheduledTask)
+
+	shrink, err := m.ScheduleTask(ctx, manager.ScheduledTask{Cron: "0 3 * * *", Operation: manager.ScheduledOperationShrinkPools})
+	require.NoError(t, err)
+	cleanup, err := m.ScheduleTask(ctx, manager.ScheduledTask{Cron: "*/15 * * * *", Operation: manager.ScheduledOperationCleanupOrphans})
+	require.NoError(t, err)
+	assert.Len(t, m.ScheduledTasks(ctx), 2)
+
+	shrink, err = m.RunScheduledTask(ctx, shrink.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 1, shrink.Runs)
+	assert.NotNil(t, shrink.LastRunAt)
+	assert.Empty(t, shrink.LastError)
+
+	_, err = m.RunScheduledTask(ctx, 999)
+	assert.ErrorIs(t, err, manager.ErrScheduledTaskNotFound)
+
+	require.NoError(t, m.UnscheduleTask(ctx, cleanup.ID))
+	assert.ErrorIs(t, m.UnscheduleTask(ctx, cleanup.ID), manager.ErrScheduledTaskNotFound)
+
+	// persisted, including the run
+	restarted, _ := testManagerWithConfig(cfg)
+	tasks := restarted.ScheduledTasks(ctx)
+	require.Len(t, tasks, 1)
+	assert.Equal(t, shrink.ID, tasks[0].ID)
+	assert.Equal(t, 1, tasks[0].Runs)
+}
+
+func TestManagerStateEncryption(t *testing.T) {
+	ctx := context.Background()
+
+	oldKey := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 32))
+	newKey := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{2}, 32))
+
+	cfg := manager.DefaultManagerConfigFromEnv()
+	cfg.ScheduleFile = filepath.Join(t.TempDir(), "schedule.json")
+	cfg.StateEncryptionKeys = []string{oldKey}
+	m, _ := testManagerWithConfig(cfg)
+
+	task, err := m.ScheduleTask(ctx, manager.ScheduledTask{Cron: "0 3 * * *", Operation: manager.ScheduledOperationShrinkPools})
+	require.NoError(t, err)
+
+	sealed, err := os.ReadFile(cfg.ScheduleFile)
+	require.NoError(t, err)
+	assert.True(t, encryption.IsSealed(sealed))
+	assert.NotContains(t, string(sealed), string(manager.ScheduledOperationShrinkPools))
+
+	// rotating the keys reseals the file with the new key while loading it
+	cfg.StateEncryptionKeys = []string{newKey, oldKey}
+	rotated, _ := testManagerWithConfig(cfg)
+	tasks := rotated.ScheduledTasks(ctx)
+	require.Len(t, tasks, 1)
+	assert.Equal(t, task.ID, tasks[0].ID)
+
+	resealed, err := os.ReadFile(cfg.ScheduleFile)
+	require.NoError(t, err)
+	assert.NotEqual(t, sealed, resealed)
+
+	cfg.StateEncryptionKeys = []string{newKey}
+	restarted, _ := testManagerWithConfig(cfg)
+	assert.Len(t, restarted.ScheduledTasks(ctx), 1)
+
+	// the old key alone can't open it anymore, the tasks are kept in memory only then
+	cfg.StateEncryptionKeys = []string{oldKey}
+	outdated, _ := testManagerWithConfig(cfg)
+	assert.Empty(t, outdated.ScheduledTasks(ctx))
+
+	// invalid keys never persist the state in plaintext
+	cfg.StateEncryptionKeys = []string{"invalid"}
+	invalid, invalidConfig := testManagerWithConfig(cfg)
+	assert.Empty(t, invalidConfig.ScheduleFile)
+	_, err = invalid.ScheduleTask(ctx, manager.ScheduledTask{Cron: "0 3 * * *", Operation: manager.ScheduledOperationShrinkPools})
+	require.NoError(t, err)
+
+	unchanged, err := os.ReadFile(cfg.ScheduleFile)
+	require.NoError(t, err)
+	assert.Equal(t, resealed, unchanged)
+}
+
+func TestManagerTrackingSchema(t *testing.T) {
+	ctx := context.Background()
+
+	cfg := manager.DefaultManagerConfigFromEnv()
+	cfg.TrackingSchema = true
+	cfg.PoolConfig.InitialPoolSize = 2
+
+	m1, _ := testManagerWithConfig(cfg)
+	if err := m1.Initialize(ctx); err != nil {
+		t.Fatalf("initializing manager failed: %v", err)
+	}
+
+	hash := "hashinghash"
+
+	template, err := m1.InitializeTemplateDatabaseWithOptions(ctx, hash, templates.TemplateOptions{Labels: []string{"tracked"}})
+	require.NoError(t, err)
+	populateTemplateDB(t, template)
+	_, err = m1.FinalizeTemplateDatabase(ctx, hash)
+	require.NoError(t, err)
+
+	// still checked out while restarting
+	test, err := m1.GetTestDatabase(ctx, hash)
+	require.NoError(t, err)
+
+	var preview manager.ShutdownReport
+	require.Eventually(t, func() bool {
+		preview, err = m1.ShutdownReport(ctx)
+		require.NoError(t, err)
+		for _, testDB := range preview.TestDatabases {
+			if testDB.Hash == hash && testDB.State == "ready" {
+				return testDB.Readopted
+			}
+		}
+		return false
+	}, 5*time.Second, 20*time.Millisecond)
+
+	for _, templateDB := range preview.Templates {
+		if templateDB.Database == template.Config.Database {
+			assert.True(t, templateDB.Readopted)
+			assert.Equal(t, manager.ShutdownReportOnRestartReadopted, templateDB.OnRestart)
+		}
+	}
+
+	disconnectManager(t, m1)
+
+	m2, _ := testManagerWithConfig(cfg)
+	if err := m2.Initialize(ctx); err != nil {
+		t.Fatalf("initializing manager failed: %v", err)
+	}
+	defer disconnectManager(t, m2)
+
+	// finalized without initializing it again
+	_, err = m2.InitializeTemplateDatabaseWithOptions(ctx, hash, templates.TemplateOptions{Labels: []string{"tracked"}})
+	assert.ErrorIs(t, err, manager.ErrTemplateAlreadyInitialized)
+
+	// the client of the checked out test database returns it after the restart
+	require.NoError(t, m2.ReturnTestDatabase(ctx, hash, test.ID))
+
+	other, err := m2.GetTestDatabase(ctx, hash)
+	require.NoError(t, err)
+	assert.Equal(t, hash, other.TemplateHash)
+
+	require.NoError(t, m2.DiscardTemplateDatabase(ctx, hash))
+}
+
+func TestManagerTrackingSchemaEncryption(t *testing.T) {
+	ctx := context.Background()
+
+	cfg := manager.DefaultManagerConfigFromEnv()
+	cfg.TrackingSchema = true
+	cfg.StateEncryptionKeys = []string{base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 32))}
+
+	m1, _ := testManagerWithConfig(cfg)
+	if err := m1.Initialize(ctx); err != nil {
+		t.Fatalf("initializing manager failed: %v", err)
+	}
+
+	hash := "hashinghash"
+	options := templates.TemplateOptions{Labels: []string{"tracked"}, ReadyWebhook: "https://ci.example.com/ready?token=secret"}
+
+	template, err := m1.InitializeTemplateDatabaseWithOptions(ctx, hash, options)
+	require.NoError(t, err)
+	populateTemplateDB(t, template)
+	_, err = m1.FinalizeTemplateDatabase(ctx, hash)
+	require.NoError(t, err)
+
+	disconnectManager(t, m1)
+
+	managerDB, err := sql.Open("postgres", cfg.ManagerDatabaseConfig.ConnectionString())
+	require.NoError(t, err)
+	defer managerDB.Close()
+
+	var persisted string
+	require.NoError(t, managerDB.QueryRowContext(ctx, "SELECT options #>> '{}' FROM integresql.templates WHERE database = $1", template.Config.Database).Scan(&persisted))
+	assert.True(t, encryption.IsSealed([]byte(persisted)))
+	assert.NotContains(t, persisted, "secret")
+
+	m2, _ := testManagerWithConfig(cfg)
+	if err := m2.Initialize(ctx); err != nil {
+		t.Fatalf("initializing manager failed: %v", err)
+	}
+	defer disconnectManager(t, m2)
+
+	// readopted with its options
+	_, err = m2.InitializeTemplateDatabaseWithOptions(ctx, hash, options)
+	assert.ErrorIs(t, err, manager.ErrTemplateAlreadyInitialized)
+
+	require.NoError(t, m2.DiscardTemplateDatabase(ctx, hash))
+}
+
+func TestManagerTrackingSchemaNamespaceEncryption(t *testing.T) {
+	ctx := context.Background()
+
+	cfg := manager.DefaultManagerConfigFromEnv()
+	cfg.TrackingSchema = true
+	cfg.NamespaceStateEncryptionKeys = map[string][]string{
+		"team-a": {base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 32))},
+		"team-b": {base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{2}, 32))},
+	}
+
+	m1, _ := testManagerWithConfig(cfg)
+	if err := m1.Initialize(ctx); err != nil {
+		t.Fatalf("initializing manager failed: %v", err)
+	}
+
+	hash := "hashinghash"
+
+	template, err := m1.InitializeTemplateDatabaseWithOptions(ctx, hash, templates.TemplateOptions{Namespace: "team-a", ReadyWebhook: "https://ci.example.com/ready?token=secret"})
+	require.NoError(t, err)
+	populateTemplateDB(t, template)
+	_, err = m1.FinalizeTemplateDatabase(ctx, hash)
+	require.NoError(t, err)
+
+	disconnectManager(t, m1)
+
+	managerDB, err := sql.Open("postgres", cfg.ManagerDatabaseConfig.ConnectionString())
+	require.NoError(t, err)
+	defer managerDB.Close()
+
+	var persisted, namespace string
+	require.NoError(t, managerDB.QueryRowContext(ctx, "SELECT options #>> '{}', namespace FROM integresql.templates WHERE database = $1", template.Config.Database).Scan(&persisted, &namespace))
+	assert.True(t, encryption.IsSealed([]byte(persisted)))
+	assert.NotContains(t, persisted, "secret")
+	assert.Equal(t, "team-a", namespace)
+
+	// the row of team-a can't be opened as one of team-b (with its key)
+	_, err = managerDB.ExecContext(ctx, "UPDATE integresql.templates SET namespace = 'team-b' WHERE database = $1", template.Config.Database)
+	require.NoError(t, err)
+
+	m2, _ := testManagerWithConfig(cfg)
+	assert.ErrorIs(t, m2.Initialize(ctx), encryption.ErrUnknownKey)
+	disconnectManager(t, m2)
+
+	// nor with the key of team-b configured as the one of team-a
+	_, err = managerDB.ExecContext(ctx, "UPDATE integresql.templates SET namespace = 'team-a' WHERE database = $1", template.Config.Database)
+	require.NoError(t, err)
+
+	cfg.NamespaceStateEncryptionKeys = map[string][]string{"team-a": cfg.NamespaceStateEncryptionKeys["team-b"]}
+	m3, _ := testManagerWithConfig(cfg)
+	assert.ErrorIs(t, m3.Initialize(ctx), encryption.ErrUnknownKey)
+	disconnectManager(t, m3)
+
+	_, err = managerDB.ExecContext(ctx, "DELETE FROM integresql.templates WHERE database = $1", template.Config.Database)
+	require.NoError(t, err)
+}
+
+func TestManagerTemplateHashCollision(t *testing.T) {
+	ctx := context.Background()
+
+	m, _ := testManagerWithConfig(manager.DefaultManagerConfigFromEnv())
+	if err := m.Initialize(ctx); err != nil {
+		t.Fatalf("initializing manager failed: %v", err)
+	}
+	defer disconnectManager(t, m)
+
+	hash := "hashinghash"
+
+	template, err := m.InitializeTemplateDatabaseWithOptions(ctx, hash, templates.TemplateOptions{SchemaFingerprint: "sha256:aaaa"})
+	require.NoError(t, err)
+	populateTemplateDB(t, template)
+	_, err = m.FinalizeTemplateDatabase(ctx, hash)
+	require.NoError(t, err)
+
+	// same schema (or unknown fingerprint), reused as usual
+	_, err = m.InitializeTemplateDatabaseWithOptions(ctx, hash, templates.TemplateOptions{SchemaFingerprint: "sha256:aaaa"})
+	assert.ErrorIs(t, err, manager.ErrTemplateAlreadyInitialized)
+	_, err = m.InitializeTemplateDatabase(ctx, hash)
+	assert.ErrorIs(t, err, manager.ErrTemplateAlreadyInitialized)
+
+	_, err = m.InitializeTemplateDatabaseWithOptions(ctx, hash, templates.TemplateOptions{SchemaFingerprint: "sha256:bbbb"})
+	assert.ErrorIs(t, err, manager.ErrTemplateHashCollision)
+
+	var collisionErr *manager.TemplateHashCollisionError
+	require.ErrorAs(t, err, &collisionErr)
+	assert.Equal(t, hash, collisionErr.CollidingHash)
+	assert.Equal(t, "sha256:aaaa", collisionErr.CollidingFingerprint)
+
+	// PostgreSQL truncates database names to 63 bytes
+	longHash := strings.Repeat("a", 64)
+	_, err = m.InitializeTemplateDatabase(ctx, longHash)
+	require.NoError(t, err)
+
+	_, err = m.InitializeTemplateDatabase(ctx, strings.Repeat("a", 63)+"b")
+	require.ErrorAs(t, err, &collisionErr)
+	assert.Equal(t, longHash, collisionErr.CollidingHash)
+
+	var found bool
+	for _, event := range m.RecentEvents(ctx) {
+		found = found || event.Type == events.TypeTemplateHashCollision
+	}
+	assert.True(t, found)
+
+	require.NoError(t, m.DiscardTemplateDatabase(ctx, longHash))
+	require.NoError(t, m.DiscardTemplateDatabase(ctx, hash))
+}
+
+func TestManagerRecoveryScan(t *testing.T) {
+	ctx := context.Background()
+
+	cfg := manager.DefaultManagerConfigFromEnv()
+	cfg.RecoveryScan = true
+	cfg.PoolConfig.InitialPoolSize = 2
+
+	m1, _ := testManagerWithConfig(cfg)
+	if err := m1.Initialize(ctx); err != nil {
+		t.Fatalf("initializing manager failed: %v", err)
+	}
+
+	hash := "hashinghash"
+
+	template, err := m1.InitializeTemplateDatabase(ctx, hash)
+	require.NoError(t, err)
+	populateTemplateDB(t, template)
+	_, err = m1.FinalizeTemplateDatabase(ctx, hash)
+	require.NoError(t, err)
+
+	test, err := m1.GetTestDatabase(ctx, hash)
+	require.NoError(t, err)
+
+	// not finalized yet, initialized again by its client after the restart
+	unfinalizedHash := "unfinalizedhash"
+	_, err = m1.InitializeTemplateDatabase(ctx, unfinalizedHash)
+	require.NoError(t, err)
+
+	disconnectManager(t, m1)
+
+	m2, _ := testManagerWithConfig(cfg)
+	if err := m2.Initialize(ctx); err != nil {
+		t.Fatalf("initializing manager failed: %v", err)
+	}
+	defer disconnectManager(t, m2)
+
+	_, err = m2.InitializeTemplateDatabase(ctx, hash)
+	assert.ErrorIs(t, err, manager.ErrTemplateAlreadyInitialized)
+
+	_, err = m2.InitializeTemplateDatabase(ctx, unfinalizedHash)
+	require.NoError(t, err)
+
+	// the client of the checked out test database returns it after the restart
+	require.NoError(t, m2.ReturnTestDatabase(ctx, hash, test.ID))
+
+	other, err := m2.GetTestDatabase(ctx, hash)
+	require.NoError(t, err)
+	assert.Equal(t, hash, other.TemplateHash)
+
+	require.NoError(t, m2.DiscardTemplateDatabase(ctx, hash))
+	require.NoError(t, m2.DiscardTemplateDatabase(ctx, unfinalizedHash))
+}
+
+func TestManagerTemplateReplicas(t *testing.T) {
+	ctx := context.Background()
+
+	cfg := manager.DefaultManagerConfigFromEnv()
+	cfg.TemplateReplicas = 2
+	cfg.PoolConfig.InitialPoolSize = 1
+	cfg.PoolConfig.MaxPoolSize = 6
+
+	m, _ := testManagerWithConfig(cfg)
+	if err := m.Initialize(ctx); err != nil {
+		t.Fatalf("initializing manager failed: %v", err)
+	}
+	defer disconnectManager(t, m)
+
+	hash := "hashinghash"
+
+	template, err := m.InitializeTemplateDatabase(ctx, hash)
+	require.NoError(t, err)
+	populateTemplateDB(t, template)
+	_, err = m.FinalizeTemplateDatabase(ctx, hash)
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		stats, err := m.Stats(ctx)
+		require.NoError(t, err)
+		return stats.TemplateReplicas[hash] == 2
+	}, 10*time.Second, 50*time.Millisecond)
+
+	// clones of the replicas contain the populated template
+	for i := 0; i < 4; i++ {
+		test, err := m.GetTestDatabase(ctx, hash)
+		require.NoError(t, err)
+		verifyTestDB(t, test)
+	}
+
+	require.NoError(t, m.DiscardTemplateDatabase(ctx, hash))
+
+	stats, err := m.Stats(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, stats.TemplateReplicas)
+}
+
+func TestManagerManagedRoles(t *testing.T) {
+	ctx := context.Background()
+
+	cfg := manager.DefaultManagerConfigFromEnv()
+	cfg.ManagedRolePrefix = "integresql_managed_role_"
+
+	m, _ := testManagerWithConfig(cfg)
+	if err := m.Initialize(ctx); err != nil {
+		t.Fatalf("initializing manager failed: %v", err)
+	}
+	defer disconnectManager(t, m)
+
+	db, err := sql.Open("postgres", cfg.ManagerDatabaseConfig.ConnectionString())
+	require.NoError(t, err)
+	defer db.Close()
+
+	countRoles := func() int {
+		var count int
+		require.NoError(t, db.QueryRowContext(ctx, "SELECT count(*) FROM pg_roles WHERE rolname LIKE 'integresql\\_managed\\_role\\_%'").Scan(&count))
+		return count
+	}
+
+	// created by populating scripts, the member depends on the granted role
+	for _, stmt := range []string{
+		"CREATE ROLE integresql_managed_role_base",
+		"CREATE ROLE integresql_managed_role_member",
+		"GRANT integresql_managed_role_base TO integresql_managed_role_member",
+		"CREATE TABLE integresql_managed_role_table (id int)",
+		"ALTER TABLE integresql_managed_role_table OWNER TO integresql_managed_role_base",
+	} {
+		_, err := db.ExecContext(ctx, stmt)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 2, countRoles())
+
+	require.NoError(t, m.ResetAllTracking(ctx))
+	assert.Equal(t, 0, countRoles())
+
+	// dropped along with the role owning it
+	var exists bool
+	err = db.QueryRowContext(ctx, "SELECT true FROM pg_tables WHERE tablename = 'integresql_managed_role_table'").Scan(&exists)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+
+	_, err = db.ExecContext(ctx, "CREATE ROLE integresql_managed_role_leftover")
+	require.NoError(t, err)
+
+	m2, _ := testManagerWithConfig(cfg)
+	if err := m2.Initialize(ctx); err != nil {
+		t.Fatalf("initializing manager failed: %v", err)
+	}
+	defer disconnectManager(t, m2)
+
+	assert.Equal(t, 0, countRoles())
+}
+
+func TestManagerTestDatabaseOwner(t *testing.T) {
+	ctx := context.Background()
+
+	cfg := manager.DefaultManagerConfigFromEnv()
+	cfg.ManagedRolePrefix = "integresql_managed_role_"
+	cfg.TestDatabaseOwnerAllowlist = []string{"integresql_managed_role_app:secret"}
+
+	m, _ := testManagerWithConfig(cfg)
+	if err := m.Initialize(ctx); err != nil {
+		t.Fatalf("initializing manager failed: %v", err)
+	}
+	defer disconnectManager(t, m)
+
+	db, err := sql.Open("postgres", cfg.ManagerDatabaseConfig.ConnectionString())
+	require.NoError(t, err)
+	defer db.Close()
+
+	_, err = db.ExecContext(ctx, "CREATE ROLE integresql_managed_role_app LOGIN PASSWORD 'secret'")
+	require.NoError(t, err)
+
+	owner := func(dbName string) string {
+		var owner string
+		require.NoError(t, db.QueryRowContext(ctx, "SELECT pg_get_userbyid(datdba) FROM pg_database WHERE datname = $1", dbName).Scan(&owner))
+		return owner
+	}
+
+	hash := "hashinghash"
+
+	template, err := m.InitializeTemplateDatabase(ctx, hash)
+	require.NoError(t, err)
+	populateTemplateDB(t, template)
+	_, err = m.FinalizeTemplateDatabase(ctx, hash)
+	require.NoError(t, err)
+
+	_, err = m.GetTestDatabaseWithOptions(ctx, hash, manager.TestDatabaseOptions{Owner: "postgres_unknown"})
+	assert.ErrorIs(t, err, manager.ErrInvalidTestDatabaseOptions)
+
+	test, err := m.GetTestDatabaseWithOptions(ctx, hash, manager.TestDatabaseOptions{Owner: "integresql_managed_role_app"})
+	require.NoError(t, err)
+	assert.Equal(t, "integresql_managed_role_app", owner(test.Config.Database))
+	assert.Equal(t, "integresql_managed_role_app", test.Config.Username)
+	assert.Equal(t, "secret", test.Config.Password)
+	verifyTestDB(t, test)
+
+	// handed out again as-is, the ownership is transferred back on the next acquisition without override
+	require.NoError(t, m.ReturnTestDatabase(ctx, hash, test.ID))
+
+	again, err := m.GetTestDatabaseWithOptions(ctx, hash, manager.TestDatabaseOptions{Index: &test.ID})
+	require.NoError(t, err)
+	assert.Equal(t, cfg.TestDatabaseOwner, owner(again.Config.Database))
+	assert.Equal(t, cfg.TargetDatabaseConfig.Username, again.Config.Username)
+
+	require.NoError(t, m.RecreateTestDatabase(ctx, hash, again.ID))
+}
+
+func TestManagerTemplateTablespace(t *testing.T) {
+	ctx := context.Background()
+
+	m, cfg := testManagerFromEnvWithConfig()
+	if err := m.Initialize(ctx); err != nil {
+		t.Fatalf("initializing manager failed: %v", err)
+	}
+	defer disconnectManager(t, m)
+
+	db, err := sql.Open("postgres", cfg.ManagerDatabaseConfig.ConnectionString())
+	require.NoError(t, err)
+	defer db.Close()
+
+	tablespace := func(dbName string) string {
+		var spcname string
+		require.NoError(t, db.QueryRowContext(ctx, "SELECT t.spcname FROM pg_database d JOIN pg_tablespace t ON t.oid = d.dattablespace WHERE d.datname = $1", dbName).Scan(&spcname))
+		return spcname
+	}
+
+	hash := "hashinghash"
+
+	template, err := m.InitializeTemplateDatabaseWithOptions(ctx, hash, templates.TemplateOptions{
+		Tablespace:      "pg_default",
+		CloneTablespace: "pg_default",
+		CloneSettings:   map[string]string{"maintenance_io_concurrency": "7"},
+		// records the setting of the session running the script
+		PostCloneScript: "CREATE TABLE clone_session AS SELECT current_setting('maintenance_io_concurrency') AS io",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "pg_default", tablespace(template.Config.Database))
+	populateTemplateDB(t, template)
+	_, err = m.FinalizeTemplateDatabase(ctx, hash)
+	require.NoError(t, err)
+
+	test, err := m.GetTestDatabase(ctx, hash)
+	require.NoError(t, err)
+	assert.Equal(t, "pg_default", tablespace(test.Config.Database))
+
+	conn, err := sql.Open("postgres", test.Config.ConnectionString())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	var io, current string
+	require.NoError(t, conn.QueryRowContext(ctx, "SELECT io FROM clone_session").Scan(&io))
+	assert.Equal(t, "7", io)
+
+	// never persisted within the test database
+	require.NoError(t, conn.QueryRowContext(ctx, "SHOW maintenance_io_concurrency").Scan(&current))
+	assert.NotEqual(t, "7", current)
+
+	for name, options := range map[string]templates.TemplateOptions{
+		"unknown tablespace":       {Tablespace: "integresql_does_not_exist"},
+		"unknown clone tablespace": {CloneTablespace: "integresql_does_not_exist"},
+		"invalid setting name":     {CloneSettings: map[string]string{"work_mem dbname=postgres": "1"}},
+		"invalid setting value":    {CloneSettings: map[string]string{"maintenance_work_mem": "1GB password=x"}},
+		"unknown setting value":    {CloneSettings: map[string]string{"maintenance_io_concurrency": "lots"}},
+	} {
+		_, err := m.InitializeTemplateDatabaseWithOptions(ctx, "hashinvalid", options)
+		assert.ErrorIs(t, err, manager.ErrInvalidTemplateOptions, name)
+	}
+}
+
+func TestManagerMigrateTemplate(t *testing.T) {
+	ctx := context.Background()
+
+	m, cfg := testManagerFromEnvWithConfig()
+
+	if err := m.Initialize(ctx); err != nil {
+		t.Fatalf("initializing manager failed: %v", err)
+	}
+
+	defer disconnectManager(t, m)
+
+	hash := "hashinghash"
+
+	_, err := m.MigrateTemplate(ctx, hash, cfg.TargetDatabaseConfig.Host)
+	assert.ErrorIs(t, err, manager.ErrTemplateNotFound)
+
+	template, err := m.InitializeTemplateDatabase(ctx, hash)
+	if err != nil {
+		t.Fatalf("failed to initialize template database: %v", err)
+	}
+
+	_, err = m.MigrateTemplate(ctx, hash, cfg.TargetDatabaseConfig.Host)
+	assert.ErrorIs(t, err, manager.ErrInvalidTemplateState)
+
+	populateTemplateDB(t, template)
+
+	if _, err := m.FinalizeTemplateDatabase(ctx, hash); err != nil {
+		t.Fatalf("failed to finalize template database: %v", err)
+	}
+
+	checkedOut, err := m.GetTestDatabase(ctx, hash)
+	if err != nil {
+		t.Fatalf("failed to get test database: %v", err)
+	}
+
+	// unreachable servers are rejected right away
+	_, err = m.MigrateTemplate(ctx, hash, "127.0.0.1:1")
+	assert.ErrorIs(t, err, manager.ErrInvalidMigration)
+
+	_, err = m.TemplateMigrationStatus(ctx, hash)
+	assert.ErrorIs(t, err, manager.ErrMigrationNotFound)
+
+	// migrating back to the target needs no copy of the template
+	target := fmt.Sprintf("%s:%d", cfg.TargetDatabaseConfig.Host, cfg.TargetDatabaseConfig.Port)
+	migration, err := m.MigrateTemplate(ctx, hash, target)
+	require.NoError(t, err)
+	assert.Equal(t, manager.MigrationStateCopying, migration.State)
+
+	require.Eventually(t, func() bool {
+		migration, err = m.TemplateMigrationStatus(ctx, hash)
+		return err == nil && migration.State == manager.MigrationStateCompleted
+	}, 10*time.Second, 50*time.Millisecond)
+
+	assert.Zero(t, migration.Remaining)
+	assert.NotNil(t, migration.CompletedAt)
+
+	require.NoError(t, m.ReturnTestDatabase(ctx, hash, checkedOut.ID))
+
+	testDB, err := m.GetTestDatabase(ctx, hash)
+	require.NoError(t, err)
+	verifyTestDB(t, testDB)
+}
+
+func TestManagerTemplatePoolSize(t *testing.T) {
+	ctx := context.Background()
+
+	cfg := manager.DefaultManagerConfigFromEnv()
+	cfg.PoolConfig.InitialPoolSize = 1
+	cfg.PoolConfig.MaxPoolSize = 2
+	cfg.TestDatabaseGetTimeout = 200 * time.Millisecond
+	m, _ := testManagerWithConfig(cfg)
+
+	if err := m.Initialize(ctx); err != nil {
+		t.Fatalf("initializing manager failed: %v", err)
+	}
+
+	defer disconnectManager(t, m)
+
+	hash := "hashinghash"
+
+	template, err := m.InitializeTemplateDatabaseWithOptions(ctx, hash, templates.TemplateOptions{InitialPoolSize: 3, MaxPoolSize: 4})
+	require.NoError(t, err)
+	populateTemplateDB(t, template)
+	_, err = m.FinalizeTemplateDatabase(ctx, hash)
+	require.NoError(t, err)
+
+	// more test databases checked out at once than the global max pool size
+	for i := 0; i < 4; i++ {
+		testDB, err := m.GetTestDatabase(ctx, hash)
+		require.NoError(t, err)
+		verifyTestDB(t, testDB)
+	}
+
+	_, err = m.GetTestDatabase(ctx, hash)
+	assert.ErrorIs(t, err, pool.ErrTimeout)
+
+	_, err = m.InitializeTemplateDatabaseWithOptions(ctx, "exceedingmax", templates.TemplateOptions{InitialPoolSize: 3})
+	assert.ErrorIs(t, err, manager.ErrInvalidTemplateOptions)
+
+	_, err = m.InitializeTemplateDatabaseWithOptions(ctx, "negative", templates.TemplateOptions{MaxPoolSize: -1})
+	assert.ErrorIs(t, err, manager.ErrInvalidTemplateOptions)
+}
+
+func TestManagerResizeTemplatePool(t *testing.T) {
+	ctx := context.Background()
+
+	cfg := manager.DefaultManagerConfigFromEnv()
+	cfg.PoolConfig.InitialPoolSize = 1
+	cfg.PoolConfig.MaxPoolSize = 2
+	cfg.PoolConfig.MaxPoolSizeLimit = 4
+	cfg.TestDatabaseGetTimeout = 200 * time.Millisecond
+	m, _ := testManagerWithConfig(cfg)
+
+	if err := m.Initialize(ctx); err != nil {
+		t.Fatalf("initializing manager failed: %v", err)
+	}
+
+	defer disconnectManager(t, m)
+
+	hash := "hashinghash"
+
+	template, err := m.InitializeTemplateDatabase(ctx, hash)
+	require.NoError(t, err)
+
+	_, err = m.ResizeTemplatePool(ctx, hash, 0, 4)
+	assert.ErrorIs(t, err, manager.ErrInvalidTemplateState, "not finalized yet")
+
+	populateTemplateDB(t, template)
+	_, err = m.FinalizeTemplateDatabase(ctx, hash)
+	require.NoError(t, err)
+
+	_, err = m.ResizeTemplatePool(ctx, hash, 0, 5)
+	assert.ErrorIs(t, err, manager.ErrInvalidTemplateOptions, "beyond the limit")
+
+	size, err := m.ResizeTemplatePool(ctx, hash, 0, 4)
+	require.NoError(t, err)
+	assert.Equal(t, 1, size.InitialPoolSize)
+	assert.Equal(t, 4, size.MaxPoolSize)
+
+	// more test databases checked out at once than the global max pool size
+	for i := 0; i < 4; i++ {
+		testDB, err := m.GetTestDatabase(ctx, hash)
+		require.NoError(t, err)
+		verifyTestDB(t, testDB)
+	}
+
+	_, err = m.GetTestDatabase(ctx, hash)
+	assert.ErrorIs(t, err, pool.ErrTimeout)
+
+	_, err = m.ResizeTemplatePool(ctx, "unknown", 0, 2)
+	assert.ErrorIs(t, err, manager.ErrTemplateNotFound)
+}
+
+func TestManagerFreezeTestDatabase(t *testing.T) {
+	ctx := context.Background()
+
+	cfg := manager.DefaultManagerConfigFromEnv()
+	cfg.PoolConfig.InitialPoolSize = 1
+	cfg.PoolConfig.MaxPoolSize = 1
+	cfg.TestDatabaseGetTimeout = 200 * time.Millisecond
+	m, _ := testManagerWithConfig(cfg)
+
+	if err := m.Initialize(ctx); err != nil {
+		t.Fatalf("initializing manager failed: %v", err)
+	}
+
+	defer disconnectManager(t, m)
+
+	hash := "hashinghash"
+
+	template, err := m.InitializeTemplateDatabase(ctx, hash)
+	require.NoError(t, err)
+
+	_, err = m.FreezeTestDatabase(ctx, hash, 0)
+	assert.ErrorIs(t, err, manager.ErrInvalidTemplateState, "not finalized yet")
+
+	populateTemplateDB(t, template)
+	_, err = m.FinalizeTemplateDatabase(ctx, hash)
+	require.NoError(t, err)
+
+	testDB, err := m.GetTestDatabase(ctx, hash)
+	require.NoError(t, err)
+	require.NoError(t, m.ReturnTestDatabase(ctx, hash, testDB.ID))
+
+	frozen, err := m.FreezeTestDatabase(ctx, hash, testDB.ID)
+	require.NoError(t, err)
+	assert.Equal(t, testDB.Config.Database, frozen.DBName)
+
+	_, err = m.GetTestDatabase(ctx, hash)
+	assert.ErrorIs(t, err, pool.ErrTimeout)
+
+	stats, err := m.Stats(ctx)
+	require.NoError(t, err)
+	require.Len(t, stats.Pools, 1)
+	assert.Equal(t, []pool.FrozenTestDatabase{frozen}, stats.Pools[0].Frozen)
+
+	_, err = m.FreezeTestDatabase(ctx, hash, 1)
+	assert.ErrorIs(t, err, manager.ErrTestNotFound)
+
+	require.NoError(t, m.UnfreezeTestDatabase(ctx, hash, testDB.ID))
+
+	testDB, err = m.GetTestDatabase(ctx, hash)
+	require.NoError(t, err)
+	verifyTestDB(t, testDB)
+
+	_, err = m.FreezeTestDatabase(ctx, "unknown", 0)
+	assert.ErrorIs(t, err, manager.ErrTemplateNotFound)
+}
+
+func TestManagerTemplateChecksum(t *testing.T) {
+	ctx := context.Background()
+
+	cfg := manager.DefaultManagerConfigFromEnv()
+	cfg.PoolConfig.InitialPoolSize = 1
+	cfg.PoolConfig.MaxPoolSize = 2
+	m, _ := testManagerWithConfig(cfg)
+
+	if err := m.Initialize(ctx); err != nil {
+		t.Fatalf("initializing manager failed: %v", err)
+	}
+
+	defer disconnectManager(t, m)
+
+	_, err := m.InitializeTemplateDatabaseWithOptions(ctx, "invalidchecksum", templates.TemplateOptions{ChecksumTables: []string{"a.b.c"}})
+	assert.ErrorIs(t, err, manager.ErrInvalidTemplateOptions)
+
+	hash := "hashinghash"
+
+	template, err := m.InitializeTemplateDatabaseWithOptions(ctx, hash, templates.TemplateOptions{ChecksumTables: []string{"public.pilots", "jets"}})
+	require.NoError(t, err)
+
+	populateTemplateDB(t, template)
+	_, err = m.FinalizeTemplateDatabase(ctx, hash)
+	require.NoError(t, err)
+
+	first, err := m.GetTestDatabase(ctx, hash)
+	require.NoError(t, err)
+	verifyTestDB(t, first)
+	assert.Len(t, first.Checksum, 64)
+
+	second, err := m.GetTestDatabase(ctx, hash)
+	require.NoError(t, err)
+	assert.Equal(t, first.Checksum, second.Checksum)
+
+	// unknown tables fail finalizing
+	unknown := "unknownhash"
+	template, err = m.InitializeTemplateDatabaseWithOptions(ctx, unknown, templates.TemplateOptions{ChecksumTables: []string{"missing"}})
+	require.NoError(t, err)
+
+	populateTemplateDB(t, template)
+	_, err = m.FinalizeTemplateDatabase(ctx, unknown)
+	assert.ErrorIs(t, err, manager.ErrInvalidTemplateOptions)
+
+	// without checksum tables, test databases carry no checksum
+	plain := "plainhash"
+	template, err = m.InitializeTemplateDatabase(ctx, plain)
+	require.NoError(t, err)
+
+	populateTemplateDB(t, template)
+	_, err = m.FinalizeTemplateDatabase(ctx, plain)
+	require.NoError(t, err)
+
+	testDB, err := m.GetTestDatabase(ctx, plain)
+	require.NoError(t, err)
+	assert.Empty(t, testDB.Checksum)
+}
+
+func TestManagerListTemplates(t *testing.T) {
+	ctx := context.Background()
+
+	cfg := manager.DefaultManagerConfigFromEnv()
+	cfg.PoolConfig.InitialPoolSize = 2
+	cfg.PoolConfig.MaxPoolSize = 4
+	m, _ := testManagerWithConfig(cfg)
+
+	if err := m.Initialize(ctx); err != nil {
+		t.Fatalf("initializing manager failed: %v", err)
+	}
+
+	defer disconnectManager(t, m)
+
+	list, err := m.ListTemplates(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, list)
+
+	hash := "hashinghash"
+	pending := "pendinghash"
+
+	template, err := m.InitializeTemplateDatabase(ctx, hash)
+	require.NoError(t, err)
+	populateTemplateDB(t, template)
+	_, err = m.FinalizeTemplateDatabase(ctx, hash)
+	require.NoError(t, err)
+
+	_, err = m.InitializeTemplateDatabase(ctx, pending)
+	require.NoError(t, err)
+
+	testDB, err := m.GetTestDatabase(ctx, hash)
+	require.NoError(t, err)
+
+	list, err = m.ListTemplates(ctx)
+	require.NoError(t, err)
+	require.Len(t, list, 2)
+
+	assert.Equal(t, hash, list[0].Hash)
+	assert.Equal(t, "finalized", list[0].State)
+	assert.Equal(t, template.Config.Database, list[0].Database)
+	assert.False(t, list[0].InitializedAt.IsZero())
+	require.NotNil(t, list[0].Pool)
+	assert.Equal(t, 1, list[0].Pool.InUse)
+	assert.Equal(t, 2, list[0].Pool.Size.InitialPoolSize)
+	assert.Equal(t, 4, list[0].Pool.Size.MaxPoolSize)
+
+	assert.Equal(t, pending, list[1].Hash)
+	assert.Equal(t, "init", list[1].State)
+	assert.Nil(t, list[1].Pool)
+
+	require.NoError(t, m.ReturnTestDatabase(ctx, hash, testDB.ID))
+}
@@ -0,0 +1,100 @@
+package manager
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/allaboutapps/integresql/pkg/metrics"
+	"github.com/allaboutapps/integresql/pkg/templates"
+)
+
+const (
+	ddlCreate = "create"
+	ddlDrop   = "drop"
+)
+
+// ddlCounters counts the executed CREATE/DROP DATABASE statements (of templates and test databases) by result.
+type ddlCounters struct {
+	createSuccess atomic.Int64
+	createError   atomic.Int64
+	dropSuccess   atomic.Int64
+	dropError     atomic.Int64
+}
+
+func (c *ddlCounters) record(operation string, err error) {
+	switch {
+	case operation == ddlCreate && err == nil:
+		c.createSuccess.Add(1)
+	case operation == ddlCreate:
+		c.createError.Add(1)
+	case operation == ddlDrop && err == nil:
+		c.dropSuccess.Add(1)
+	default:
+		c.dropError.Add(1)
+	}
+}
+
+// MetricSamples reports the current state of the manager as gauges (templates by state, test databases of each pool
+// by state) and the cumulative number of created and dropped databases, see metrics.Metrics.Collect.
+func (m Manager) MetricSamples() []metrics.Sample {
+	ctx := context.Background()
+
+	samples := []metrics.Sample{
+		m.ddlSample(ddlCreate, "success", &m.ddlCounts.createSuccess),
+		m.ddlSample(ddlCreate, "error", &m.ddlCounts.createError),
+		m.ddlSample(ddlDrop, "success", &m.ddlCounts.dropSuccess),
+		m.ddlSample(ddlDrop, "error", &m.ddlCounts.dropError),
+	}
+
+	if !m.Ready() {
+		return samples
+	}
+
+	states := map[templates.TemplateState]int{
+		templates.TemplateStateInit:      0,
+		templates.TemplateStateFinalized: 0,
+		templates.TemplateStateDiscarded: 0,
+	}
+
+	for _, template := range m.templates.List(ctx) {
+		states[template.GetState(ctx)]++
+
+		explanation, err := m.pool.ExplainGetTestDatabase(ctx, template.TemplateHash, false, nil)
+		if err != nil {
+			// no pool (yet), e.g. the template is still initializing
+			continue
+		}
+
+		for state, count := range map[string]int{"ready": explanation.Ready, "dirty": explanation.Dirty, "recreating": explanation.Recreating} {
+			samples = append(samples, metrics.Sample{
+				Name:   metrics.PoolTestDatabases,
+				Value:  float64(count),
+				Labels: metrics.Labels{metrics.LabelHash: template.TemplateHash, metrics.LabelState: state},
+			})
+		}
+
+		samples = append(samples, metrics.Sample{
+			Name:   metrics.PoolSize,
+			Value:  float64(explanation.Total),
+			Labels: metrics.Labels{metrics.LabelHash: template.TemplateHash},
+		})
+	}
+
+	for state, count := range states {
+		samples = append(samples, metrics.Sample{
+			Name:   metrics.Templates,
+			Value:  float64(count),
+			Labels: metrics.Labels{metrics.LabelState: state.String()},
+		})
+	}
+
+	return samples
+}
+
+func (m Manager) ddlSample(operation string, result string, count *atomic.Int64) metrics.Sample {
+	return metrics.Sample{
+		Name:   metrics.DatabaseOperations,
+		Value:  float64(count.Load()),
+		Labels: metrics.Labels{metrics.LabelOperation: operation, metrics.LabelResult: result},
+	}
+}
@@ -0,0 +1,340 @@
+package manager
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/allaboutapps/integresql/pkg/db"
+	"github.com/allaboutapps/integresql/pkg/pool"
+	"github.com/allaboutapps/integresql/pkg/templates"
+)
+
+var (
+	ErrInvalidMigration  = errors.New("invalid template migration")
+	ErrMigrationNotFound = errors.New("template migration not found")
+)
+
+const (
+	taskTemplateMigration = "TEMPLATE_MIGRATION"
+
+	migrationDrainInterval = time.Second
+)
+
+// MigrationState describes the progress of a template migration, see MigrateTemplate.
+type MigrationState string
+
+const (
+	MigrationStateCopying   MigrationState = "copying"   // the template is copied onto the new server, test databases are still handed out on the previous one
+	MigrationStateDraining  MigrationState = "draining"  // test databases are handed out on the new server, the checked out ones are moved as soon as they are returned
+	MigrationStateCompleted MigrationState = "completed" // all test databases are located on the new server
+	MigrationStateFailed    MigrationState = "failed"    // see Error, the test databases stay where they are (migrating again resumes)
+)
+
+// TemplateMigration describes the migration of the pool of a template to another server.
+type TemplateMigration struct {
+	Hash        string         `json:"hash"`
+	Host        string         `json:"host"` // "host:port" of the new server
+	State       MigrationState `json:"state"`
+	Error       string         `json:"error,omitempty"`
+	StartedAt   time.Time      `json:"startedAt"`
+	CompletedAt *time.Time     `json:"completedAt,omitempty"`
+
+	// test databases still located on the previous server
+	pool.MoveStats
+}
+
+// migrationRegistry holds the connections to the servers pools were migrated to (by "host:port") and the latest
+// migration per template hash. Test databases located on such a server are managed through its connection.
+type migrationRegistry struct {
+	servers    map[string]*shardServer
+	migrations map[string]*TemplateMigration
+	mutex      sync.Mutex
+}
+
+func newMigrationRegistry() *migrationRegistry {
+	return &migrationRegistry{
+		servers:    make(map[string]*shardServer),
+		migrations: make(map[string]*TemplateMigration),
+	}
+}
+
+func serverKey(config db.DatabaseConfig) string {
+	return net.JoinHostPort(config.Host, strconv.Itoa(config.Port))
+}
+
+// server returns the server the database with the config is located on, nil if it's not one of the migration targets.
+func (r *migrationRegistry) server(config db.DatabaseConfig) *shardServer {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.servers[serverKey(config)]
+}
+
+func (r *migrationRegistry) list() []*shardServer {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	servers := make([]*shardServer, 0, len(r.servers))
+	for _, server := range r.servers {
+		servers = append(servers, server)
+	}
+
+	return servers
+}
+
+func (r *migrationRegistry) update(hash string, f func(migration *TemplateMigration)) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if migration, ok := r.migrations[hash]; ok {
+		f(migration)
+	}
+}
+
+// onTestDB returns the manager operating on the server the test database is located on.
+func (m Manager) onTestDB(testDB db.TestDatabase) Manager {
+	if server := m.migrations.server(testDB.Config); server != nil {
+		return m.onServer(server)
+	}
+
+	return m.onShard(testDB.ID)
+}
+
+// MigrateTemplate moves the pool of the finalized template with the hash to another server ("host" or "host:port",
+// sharing the credentials of the target), e.g. to replace the server without downtime. The template is copied onto
+// the new server in background first, afterwards new test databases are handed out on the new server only. Ready
+// test databases on the previous server are moved right away, checked out ones as soon as they are returned. The
+// template database itself is kept on the previous server. Returns the started migration, see TemplateMigrationStatus.
+func (m Manager) MigrateTemplate(ctx context.Context, hash string, host string) (TemplateMigration, error) {
+
+	log := m.getManagerLogger(ctx, "MigrateTemplate").With().Str("hash", hash).Str("host", host).Logger()
+
+	if !m.Ready() {
+		log.Error().Msg("not ready")
+		return TemplateMigration{}, ErrManagerNotReady
+	}
+
+	if len(m.config.PoolConfig.Shards) > 1 {
+		return TemplateMigration{}, fmt.Errorf("%w: not supported with sharding", ErrInvalidMigration)
+	}
+
+	configs, err := ParseShardHosts(m.config.TargetDatabaseConfig, []string{host})
+	if err != nil {
+		return TemplateMigration{}, fmt.Errorf("%w: %v", ErrInvalidMigration, err)
+	}
+	config := configs[1]
+
+	template, found := m.templates.Get(ctx, hash)
+	if !found {
+		return TemplateMigration{}, ErrTemplateNotFound
+	}
+
+	if state := template.GetState(ctx); state != templates.TemplateStateFinalized {
+		return TemplateMigration{}, fmt.Errorf("%w: template is %s", ErrInvalidTemplateState, state)
+	}
+
+	key := serverKey(config)
+
+	m.migrations.mutex.Lock()
+	if migration, ok := m.migrations.migrations[hash]; ok && (migration.State == MigrationStateCopying || migration.State == MigrationStateDraining) {
+		m.migrations.mutex.Unlock()
+		return TemplateMigration{}, fmt.Errorf("%w: migration to %s still in progress", ErrInvalidMigration, migration.Host)
+	}
+	server := m.migrations.servers[key]
+	m.migrations.mutex.Unlock()
+
+	// migrating back to the target needs neither a connection nor a copy of the template
+	if server == nil && key != serverKey(m.config.TargetDatabaseConfig) {
+		if server, err = m.connectMigrationServer(ctx, config); err != nil {
+			log.Error().Err(err).Msg("unable to connect to the new server")
+			return TemplateMigration{}, err
+		}
+	}
+
+	migration := &TemplateMigration{
+		Hash:      hash,
+		Host:      key,
+		State:     MigrationStateCopying,
+		StartedAt: time.Now(),
+	}
+
+	m.migrations.mutex.Lock()
+	m.migrations.migrations[hash] = migration
+	result := *migration
+	m.migrations.mutex.Unlock()
+
+	started := m.background.Go(taskTemplateMigration, func(ctx context.Context) error {
+		return m.runTemplateMigration(ctx, hash, template.Config.Database, server, config)
+	})
+
+	if !started {
+		m.migrations.update(hash, func(migration *TemplateMigration) {
+			migration.State = MigrationStateFailed
+			migration.Error = "manager is disconnecting"
+		})
+
+		return TemplateMigration{}, ErrManagerNotReady
+	}
+
+	log.Info().Msg("migration started")
+
+	return result, nil
+}
+
+// TemplateMigrationStatus returns the latest migration of the template with the hash.
+func (m Manager) TemplateMigrationStatus(ctx context.Context, hash string) (TemplateMigration, error) {
+	m.migrations.mutex.Lock()
+	migration, ok := m.migrations.migrations[hash]
+	if !ok {
+		m.migrations.mutex.Unlock()
+		return TemplateMigration{}, ErrMigrationNotFound
+	}
+	result := *migration
+	m.migrations.mutex.Unlock()
+
+	if result.State == MigrationStateDraining {
+		// the counts of finished migrations are final
+		if stats, err := m.pool.MoveStats(ctx, hash); err == nil {
+			result.MoveStats = stats
+		}
+	}
+
+	return result, nil
+}
+
+// connectMigrationServer opens the connection to the server and registers it, an already registered one is reused.
+func (m Manager) connectMigrationServer(ctx context.Context, config db.DatabaseConfig) (*shardServer, error) {
+	conn, err := sql.Open(m.engine.DriverName(), m.engine.DSN(config))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := conn.PingContext(ctx); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("%w: unable to ping %s: %v", ErrInvalidMigration, serverKey(config), err)
+	}
+
+	m.migrations.mutex.Lock()
+	defer m.migrations.mutex.Unlock()
+
+	if server, ok := m.migrations.servers[serverKey(config)]; ok {
+		// connected concurrently
+		conn.Close()
+		return server, nil
+	}
+
+	server := &shardServer{config: config, db: conn}
+	m.migrations.servers[serverKey(config)] = server
+
+	return server, nil
+}
+
+// runTemplateMigration copies the template onto the server (nil for the target), moves the pool of the template and
+// waits until all of its test databases are located on the server.
+func (m Manager) runTemplateMigration(ctx context.Context, hash string, template string, server *shardServer, config db.DatabaseConfig) error {
+
+	log := m.getManagerLogger(ctx, "runTemplateMigration").With().Str("hash", hash).Str("host", serverKey(config)).Logger()
+
+	fail := func(err error) error {
+		log.Error().Err(err).Msg("migration failed")
+
+		m.migrations.update(hash, func(migration *TemplateMigration) {
+			migration.State = MigrationStateFailed
+			migration.Error = err.Error()
+		})
+
+		return err
+	}
+
+	if server != nil {
+		if err := m.copyTemplate(ctx, server, template); err != nil {
+			return fail(err)
+		}
+	}
+
+	if _, err := m.pool.MoveTo(ctx, hash, config); err != nil {
+		return fail(err)
+	}
+
+	m.migrations.update(hash, func(migration *TemplateMigration) {
+		migration.State = MigrationStateDraining
+	})
+
+	log.Info().Msg("template copied, draining the previous server...")
+
+	ticker := time.NewTicker(migrationDrainInterval)
+	defer ticker.Stop()
+
+	for {
+		stats, err := m.pool.MoveStats(ctx, hash)
+		if err != nil {
+			// e.g. discarded meanwhile
+			return fail(err)
+		}
+
+		if stats.Remaining == 0 {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return fail(ctx.Err())
+		case <-ticker.C:
+			// ready test databases recreated on the previous server concurrently
+			if _, err := m.pool.MoveTo(ctx, hash, config); err != nil {
+				return fail(err)
+			}
+		}
+	}
+
+	m.migrations.update(hash, func(migration *TemplateMigration) {
+		now := time.Now()
+		migration.State = MigrationStateCompleted
+		migration.CompletedAt = &now
+		migration.MoveStats = pool.MoveStats{}
+	})
+
+	log.Info().Msg("migration completed")
+
+	return nil
+}
+
+// dropMigrationTemplateCopies drops the copies of the template with the hash on all servers pools were migrated to.
+func (m Manager) dropMigrationTemplateCopies(ctx context.Context, hash string) error {
+	servers := m.migrations.list()
+	if len(servers) == 0 {
+		return nil
+	}
+
+	template := m.makeTemplateDatabaseName(hash)
+
+	var errs []error
+	for _, server := range servers {
+		if err := m.onServer(server).dropTemplateDatabase(ctx, template); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (m Manager) closeMigrationServers() error {
+	m.migrations.mutex.Lock()
+	defer m.migrations.mutex.Unlock()
+
+	var errs []error
+	for key, server := range m.migrations.servers {
+		if err := server.db.Close(); err != nil {
+			errs = append(errs, err)
+		}
+		delete(m.migrations.servers, key)
+	}
+
+	return errors.Join(errs...)
+}
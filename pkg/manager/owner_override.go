@@ -0,0 +1,115 @@
+package manager
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/allaboutapps/integresql/pkg/db"
+	"github.com/lib/pq"
+)
+
+// ownerRegistry tracks the test databases currently owned by another role than the TestDatabaseOwner (see
+// TestDatabaseOptions.Owner), their owner is restored on the next acquisition without override.
+type ownerRegistry struct {
+	owners map[string]string // map[dbName]owner
+	mutex  sync.Mutex
+}
+
+func newOwnerRegistry() *ownerRegistry {
+	return &ownerRegistry{owners: make(map[string]string)}
+}
+
+// Get returns the overridden owner of the test database, empty if owned by the TestDatabaseOwner.
+func (r *ownerRegistry) Get(dbName string) string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.owners[dbName]
+}
+
+// Set records the owner of the test database, empty if owned by the TestDatabaseOwner.
+func (r *ownerRegistry) Set(dbName string, owner string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if len(owner) == 0 {
+		delete(r.owners, dbName)
+		return
+	}
+
+	r.owners[dbName] = owner
+}
+
+// Rename moves the owner of the test database to its new name (see renameTestPoolDB), an owner of the new name is
+// dropped.
+func (r *ownerRegistry) Rename(from string, to string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	owner, ok := r.owners[from]
+	delete(r.owners, from)
+	delete(r.owners, to)
+
+	if ok {
+		r.owners[to] = owner
+	}
+}
+
+// allowedOwner returns the password of the role if it may own test databases (see TestDatabaseOwnerAllowlist).
+func (m Manager) allowedOwner(owner string) (password string, ok bool) {
+	for _, entry := range m.config.TestDatabaseOwnerAllowlist {
+		role, password, _ := strings.Cut(strings.TrimSpace(entry), ":")
+		if role == owner {
+			return password, true
+		}
+	}
+
+	return "", false
+}
+
+// validateOwner rejects an owner override of a role not allowlisted.
+func (m Manager) validateOwner(owner string) error {
+	if len(owner) == 0 {
+		return nil
+	}
+
+	if _, ok := m.allowedOwner(owner); !ok {
+		return fmt.Errorf("%w: owner %q is not allowlisted", ErrInvalidTestDatabaseOptions, owner)
+	}
+
+	return nil
+}
+
+// applyTestDatabaseOwner transfers the ownership of the handed out test database to the owner (empty restores the
+// TestDatabaseOwner), the returned config connects as the owner.
+func (m Manager) applyTestDatabaseOwner(ctx context.Context, testDB *db.TestDatabase, owner string) error {
+	if owner == m.config.TestDatabaseOwner {
+		owner = ""
+	}
+
+	dbName := testDB.Config.Database
+
+	if current := m.owners.Get(dbName); current != owner {
+		role := owner
+		if len(role) == 0 {
+			role = m.config.TestDatabaseOwner
+		}
+
+		shard := m.onTestDB(*testDB)
+		if _, err := shard.db.ExecContext(ctx, fmt.Sprintf("ALTER DATABASE %s OWNER TO %s", pq.QuoteIdentifier(dbName), pq.QuoteIdentifier(role))); err != nil {
+			return fmt.Errorf("failed to transfer the ownership of test database %s to %s: %w", dbName, role, err)
+		}
+
+		m.owners.Set(dbName, owner)
+	}
+
+	if len(owner) > 0 {
+		password, _ := m.allowedOwner(owner)
+		testDB.Config.Username = owner
+		testDB.Config.Password = password
+	}
+
+	return nil
+}
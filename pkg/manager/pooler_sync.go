@@ -0,0 +1,82 @@
+package manager
+
+import (
+	"context"
+	"time"
+
+	"github.com/allaboutapps/integresql/pkg/db"
+	"github.com/allaboutapps/integresql/pkg/pooler"
+	"github.com/allaboutapps/integresql/pkg/tracing"
+)
+
+const (
+	taskPoolerConfigSync = "POOLER_CONFIG_SYNC"
+
+	minPoolerConfigSyncInterval = 10 * time.Millisecond
+)
+
+// syncPoolerConfig writes the config of the connection pooler (see config.Pooler) routing the aliases to all
+// currently checked out test databases, the pooler is reloaded if the config changed.
+func (m Manager) syncPoolerConfig(ctx context.Context) error {
+
+	defer tracing.Region(ctx, "sync_pooler_config").End()
+
+	checkedOut := m.pool.CheckedOut(ctx)
+
+	entries := make([]pooler.Entry, 0, len(checkedOut))
+	for _, testDB := range checkedOut {
+		// the pooler connects to the server like the manager does, thus the client rewrite rules don't apply
+		entries = append(entries, pooler.Entry{Alias: pooler.Alias(testDB), Config: testDB.Config})
+	}
+
+	changed, err := m.pooler.Sync(ctx, entries)
+	if err != nil {
+		return err
+	}
+
+	if changed {
+		log := m.getManagerLogger(ctx, "syncPoolerConfig")
+		log.Debug().Int("aliases", len(entries)).Msg("pooler config synced")
+	}
+
+	return nil
+}
+
+// routeThroughPooler makes the checked out test database available via the pooler before handing it out, a failed
+// sync is only reported (the test database remains reachable directly) and retried by the next sync.
+func (m Manager) routeThroughPooler(ctx context.Context, testDB *db.TestDatabase) {
+	if m.pooler == nil {
+		return
+	}
+
+	if err := m.syncPoolerConfig(ctx); err != nil {
+		log := m.getManagerLogger(ctx, "routeThroughPooler").With().Str("hash", testDB.TemplateHash).Int("id", testDB.ID).Logger()
+		log.Warn().Err(err).Msg("syncing the pooler config failed")
+
+		m.background.Report(taskPoolerConfigSync, err)
+		return
+	}
+
+	testDB.PoolerAlias = pooler.Alias(*testDB)
+}
+
+// runPoolerConfigSync periodically syncs the pooler config until the ctx is done, removing the aliases of returned
+// test databases. Errors of single runs are reported to the background supervisor.
+func (m Manager) runPoolerConfigSync(ctx context.Context) error {
+	interval := m.config.PoolerConfigSyncInterval
+	if interval < minPoolerConfigSyncInterval {
+		interval = minPoolerConfigSyncInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			m.background.Report(taskPoolerConfigSync, m.syncPoolerConfig(ctx))
+		}
+	}
+}
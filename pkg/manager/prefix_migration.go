@@ -0,0 +1,250 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/allaboutapps/integresql/pkg/templates"
+	"github.com/allaboutapps/integresql/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+var ErrInvalidPrefixMigration = errors.New("invalid prefix migration")
+
+const (
+	PrefixMigrationActionRename = "rename" // template database renamed into the current scheme and tracked (finalized)
+	PrefixMigrationActionDrop   = "drop"   // test database dropped, the pool of the migrated template clones new ones
+	PrefixMigrationActionSkip   = "skip"   // left untouched, see the reason
+)
+
+// PrefixScheme describes a (previous) naming scheme of the managed databases, analogous to the
+// DatabasePrefix, TemplateDatabasePrefix and PoolConfig.TestDBNamePrefix configs.
+type PrefixScheme struct {
+	DatabasePrefix         string `json:"databasePrefix"`
+	TemplateDatabasePrefix string `json:"templateDatabasePrefix"`
+	TestDatabasePrefix     string `json:"testDatabasePrefix"`
+}
+
+// DatabasePrefix_TemplateDatabasePrefix_HASH
+func (s PrefixScheme) templatePrefix() string {
+	return fmt.Sprintf("%s_%s_", s.DatabasePrefix, s.TemplateDatabasePrefix)
+}
+
+// DatabasePrefix_TestDatabasePrefix_HASH_ID, empty prefixes are omitted (see New)
+func (s PrefixScheme) testPrefix() string {
+	var prefix string
+	if s.DatabasePrefix != "" {
+		prefix += fmt.Sprintf("%s_", s.DatabasePrefix)
+	}
+	if s.TestDatabasePrefix != "" {
+		prefix += fmt.Sprintf("%s_", s.TestDatabasePrefix)
+	}
+
+	return prefix
+}
+
+type PrefixMigrationResult struct {
+	Database string `json:"database"`
+	Hash     string `json:"hash,omitempty"`
+	Action   string `json:"action"`
+	Target   string `json:"target,omitempty"` // renamed database
+	Reason   string `json:"reason,omitempty"` // skipped database
+	Error    string `json:"error,omitempty"`  // the action failed, the database was left as-is
+}
+
+type PrefixMigrationSummary struct {
+	From    PrefixScheme            `json:"from"`
+	To      PrefixScheme            `json:"to"`
+	DryRun  bool                    `json:"dryRun"`
+	Results []PrefixMigrationResult `json:"results"`
+}
+
+// Failed returns true if any action of the migration failed.
+func (s PrefixMigrationSummary) Failed() bool {
+	for _, result := range s.Results {
+		if len(result.Error) > 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// MigratePrefixes moves the databases managed with a previous prefix scheme (which would otherwise be orphaned after
+// changing the prefix configs) to the current scheme instead of wiping them:
+// Template databases are renamed (ALTER DATABASE ... RENAME TO) and tracked as finalized templates, thus testrunners
+// initializing the same hash afterwards reuse them. Their test databases are dropped, the current scheme never keeps
+// test databases across restarts either and the pools clone fresh ones from the migrated templates.
+// Template databases already existing within the current scheme are never replaced. A failing database doesn't stop
+// the migration, its error is part of the summary. With dryRun, only the planned actions are returned.
+func (m Manager) MigratePrefixes(ctx context.Context, from PrefixScheme, dryRun bool) (PrefixMigrationSummary, error) {
+	ctx, span := tracing.Start(ctx, "migrate_prefixes", attribute.Bool("dryRun", dryRun))
+	defer span.End()
+
+	log := m.getManagerLogger(ctx, "MigratePrefixes").With().Str("fromTemplatePrefix", from.templatePrefix()).Str("fromTestPrefix", from.testPrefix()).Bool("dryRun", dryRun).Logger()
+
+	summary := PrefixMigrationSummary{
+		From:    from,
+		To:      m.currentPrefixScheme(),
+		DryRun:  dryRun,
+		Results: []PrefixMigrationResult{},
+	}
+
+	if !m.Ready() {
+		log.Error().Msg("not ready")
+		return summary, ErrManagerNotReady
+	}
+
+	if len(from.testPrefix()) == 0 {
+		return summary, fmt.Errorf("%w: the test database prefix of the previous scheme must not be empty", ErrInvalidPrefixMigration)
+	}
+
+	if from.templatePrefix() == summary.To.templatePrefix() && from.testPrefix() == summary.To.testPrefix() {
+		return summary, fmt.Errorf("%w: the previous scheme equals the current one", ErrInvalidPrefixMigration)
+	}
+
+	log.Warn().Msg("migrating...")
+
+	templateDBs, err := m.listDatabasesWithPrefix(ctx, from.templatePrefix())
+	if err != nil {
+		log.Error().Err(err).Msg("listing template databases failed")
+		return summary, err
+	}
+
+	for _, dbName := range templateDBs {
+		result := m.migrateTemplateDatabase(ctx, dbName, strings.TrimPrefix(dbName, from.templatePrefix()), dryRun)
+		if len(result.Error) > 0 {
+			log.Error().Str("dbName", dbName).Str("err", result.Error).Msg("migrating template database failed")
+		}
+
+		summary.Results = append(summary.Results, result)
+	}
+
+	testDBs, err := m.listDatabasesWithPrefix(ctx, from.testPrefix())
+	if err != nil {
+		log.Error().Err(err).Msg("listing test databases failed")
+		return summary, err
+	}
+
+	for _, dbName := range testDBs {
+		result := m.migrateTestDatabase(ctx, from, dbName, dryRun)
+		if len(result.Error) > 0 {
+			log.Error().Str("dbName", dbName).Str("err", result.Error).Msg("migrating test database failed")
+		}
+
+		summary.Results = append(summary.Results, result)
+	}
+
+	log.Info().Int("databases", len(summary.Results)).Bool("failed", summary.Failed()).Msg("migrated.")
+
+	return summary, nil
+}
+
+func (m Manager) migrateTemplateDatabase(ctx context.Context, dbName string, hash string, dryRun bool) PrefixMigrationResult {
+	result := PrefixMigrationResult{Database: dbName, Hash: hash, Action: PrefixMigrationActionSkip}
+
+	// the previous scheme might be a prefix of the current one (e.g. "template" -> "template_v2")
+	if reason, managed := m.isManagedByCurrentScheme(dbName); managed {
+		result.Reason = reason
+		return result
+	}
+
+	if len(hash) == 0 {
+		result.Reason = "no template hash"
+		return result
+	}
+
+	target := m.makeTemplateDatabaseName(hash)
+	exists, err := m.checkDatabaseExists(ctx, target)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	if exists {
+		result.Reason = fmt.Sprintf("target database %q already exists", target)
+		return result
+	}
+
+	result.Action = PrefixMigrationActionRename
+	result.Target = target
+
+	if dryRun {
+		return result
+	}
+
+	// adopting renames the database and tracks it as a finalized template, the same as for any other existing database
+	// (but without being part of the TemplateAdoptableDatabases)
+	if _, err := m.InitializeTemplateDatabaseWithOptions(withAdoptUnlisted(ctx), hash, templates.TemplateOptions{
+		SourceKind:     templates.TemplateSourceExisting,
+		SourceDatabase: dbName,
+	}); err != nil {
+		result.Error = err.Error()
+	}
+
+	return result
+}
+
+func (m Manager) migrateTestDatabase(ctx context.Context, from PrefixScheme, dbName string, dryRun bool) PrefixMigrationResult {
+	result := PrefixMigrationResult{Database: dbName, Action: PrefixMigrationActionSkip}
+
+	if reason, managed := m.isManagedByCurrentScheme(dbName); managed {
+		result.Reason = reason
+		return result
+	}
+
+	// e.g. an empty TestDatabasePrefix matches the (skipped) template databases as well
+	if strings.HasPrefix(dbName, from.templatePrefix()) {
+		result.Reason = "template database"
+		return result
+	}
+
+	// HASH_ID, anything else doesn't belong to us
+	hash, _, ok := splitTestDatabaseName(from.testPrefix(), dbName)
+	if !ok {
+		result.Reason = "not a test database name"
+		return result
+	}
+
+	result.Hash = hash
+	result.Action = PrefixMigrationActionDrop
+
+	if dryRun {
+		return result
+	}
+
+	if err := m.dropDatabase(ctx, dbName); err != nil {
+		result.Error = err.Error()
+	}
+
+	return result
+}
+
+// currentPrefixScheme reverts the test database prefix to its configured form (New prepends the DatabasePrefix).
+func (m Manager) currentPrefixScheme() PrefixScheme {
+	testPrefix := m.config.PoolConfig.TestDBNamePrefix
+	if m.config.DatabasePrefix != "" {
+		testPrefix = strings.TrimPrefix(testPrefix, m.config.DatabasePrefix+"_")
+	}
+
+	return PrefixScheme{
+		DatabasePrefix:         m.config.DatabasePrefix,
+		TemplateDatabasePrefix: m.config.TemplateDatabasePrefix,
+		TestDatabasePrefix:     strings.TrimSuffix(testPrefix, "_"),
+	}
+}
+
+// isManagedByCurrentScheme returns true for databases, which must never be touched by migrations.
+func (m Manager) isManagedByCurrentScheme(dbName string) (string, bool) {
+	if dbName == m.config.TargetDatabaseConfig.Database {
+		return "manager database", true
+	}
+
+	if strings.HasPrefix(dbName, m.makeTemplateDatabaseName("")) || strings.HasPrefix(dbName, m.config.PoolConfig.TestDBNamePrefix) {
+		return "managed by the current scheme", true
+	}
+
+	return "", false
+}
@@ -0,0 +1,264 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/allaboutapps/integresql/pkg/pool"
+	"github.com/allaboutapps/integresql/pkg/templates"
+)
+
+// ProgressPhase is the wait an acquisition is currently blocked in, see WithProgress.
+type ProgressPhase string
+
+const (
+	ProgressWaitTemplate     ProgressPhase = "wait_template"      // waiting for the template to be finalized
+	ProgressWaitTestDatabase ProgressPhase = "wait_test_database" // waiting for a ready test database of the pool
+)
+
+// Progress describes a still blocked acquisition of a test database.
+type Progress struct {
+	Hash          string                  `json:"hash"`
+	Phase         ProgressPhase           `json:"phase"`
+	TemplateState templates.TemplateState `json:"templateState"`
+	Elapsed       time.Duration           `json:"elapsed"`   // since the acquisition started
+	Remaining     time.Duration           `json:"remaining"` // until the current wait times out (capped to the client deadline)
+
+	// rough estimate until a test database is ready, based on the pool state and its recent clean latencies (p50),
+	// nil if unknown (e.g. while waiting for the template, or without recent cleans)
+	EstimatedRemaining *time.Duration `json:"estimatedRemaining,omitempty"`
+
+	// snapshot of the pool while waiting for a test database, nil while waiting for the template
+	Pool *pool.Explanation `json:"pool,omitempty"`
+}
+
+// ProgressFunc receives the progress of a blocked acquisition. Returning an error cancels the acquisition, which then
+// fails with this error (e.g. a client giving up as soon as the estimate exceeds its own budget).
+type ProgressFunc func(Progress) error
+
+type progressKey struct{}
+
+type progressConfig struct {
+	interval time.Duration
+	fn       ProgressFunc
+}
+
+// WithProgress returns a context reporting the progress of acquisitions (GetTestDatabase and its variants) instead of
+// blocking opaquely: fn is called every interval while the acquisition is still waiting (immediately on a phase change
+// afterwards), until it returns. Acquisitions returning within the interval are never reported.
+// Calls are serialized, fn should return quickly, as the next report is delayed otherwise.
+func WithProgress(ctx context.Context, interval time.Duration, fn ProgressFunc) context.Context {
+	if interval <= 0 || fn == nil {
+		return ctx
+	}
+
+	return context.WithValue(ctx, progressKey{}, progressConfig{interval: interval, fn: fn})
+}
+
+// progressReporter reports the progress of a single acquisition, a nil reporter is valid and reports nothing.
+type progressReporter struct {
+	m        Manager
+	template *templates.Template
+	config   progressConfig
+	ctx      context.Context
+	cancel   context.CancelCauseFunc
+	start    time.Time
+
+	phase      ProgressPhase
+	phaseStart time.Time
+	timeout    time.Duration
+	reported   bool // fn was called at least once
+	mutex      sync.Mutex
+
+	entered chan struct{}
+	done    chan struct{}
+	wg      sync.WaitGroup
+}
+
+// startProgress starts reporting the progress of the acquisition if requested via WithProgress. The returned context
+// is cancelled as soon as the ProgressFunc returns an error.
+func (m Manager) startProgress(ctx context.Context, template *templates.Template) (context.Context, *progressReporter) {
+	config, ok := ctx.Value(progressKey{}).(progressConfig)
+	if !ok {
+		return ctx, nil
+	}
+
+	ctx, cancel := context.WithCancelCause(ctx)
+
+	r := &progressReporter{
+		m:        m,
+		template: template,
+		config:   config,
+		ctx:      ctx,
+		cancel:   cancel,
+		start:    time.Now(),
+		entered:  make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+
+	r.wg.Add(1)
+	go r.loop()
+
+	return ctx, r
+}
+
+// enter switches to the phase, which waits up to the timeout (capped to the client deadline). The phase change is
+// reported immediately if the acquisition was already reported as blocked before.
+func (r *progressReporter) enter(phase ProgressPhase, timeout time.Duration) {
+	if r == nil {
+		return
+	}
+
+	timeout, _ = r.m.waitTimeout(r.ctx, timeout)
+
+	r.mutex.Lock()
+	r.phase = phase
+	r.phaseStart = time.Now()
+	r.timeout = timeout
+	reported := r.reported
+	r.mutex.Unlock()
+
+	if !reported {
+		return
+	}
+
+	select {
+	case r.entered <- struct{}{}:
+	default:
+	}
+}
+
+// err returns the error of the ProgressFunc if it cancelled the acquisition, otherwise the given error.
+func (r *progressReporter) err(err error) error {
+	if r == nil || err == nil {
+		return err
+	}
+
+	// the waits fail differently on cancellation (e.g. ErrInvalidTemplateState), the cause is what the client wants to see
+	if cause := context.Cause(r.ctx); cause != nil && !errors.Is(cause, context.Canceled) && !errors.Is(cause, context.DeadlineExceeded) {
+		return cause
+	}
+
+	return err
+}
+
+// stop ends the reporting, fn is never called afterwards.
+func (r *progressReporter) stop() {
+	if r == nil {
+		return
+	}
+
+	close(r.done)
+	r.wg.Wait()
+	r.cancel(nil)
+}
+
+func (r *progressReporter) loop() {
+	defer r.wg.Done()
+
+	ticker := time.NewTicker(r.config.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.done:
+			return
+		case <-r.ctx.Done():
+			return
+		case <-r.entered:
+			ticker.Reset(r.config.interval)
+		case <-ticker.C:
+		}
+
+		progress, ok := r.snapshot()
+		if !ok {
+			continue
+		}
+
+		if err := r.config.fn(progress); err != nil {
+			r.cancel(err)
+			return
+		}
+
+		r.mutex.Lock()
+		r.reported = true
+		r.mutex.Unlock()
+	}
+}
+
+func (r *progressReporter) snapshot() (Progress, bool) {
+	r.mutex.Lock()
+	phase, phaseStart, timeout := r.phase, r.phaseStart, r.timeout
+	r.mutex.Unlock()
+
+	// not yet blocked in any wait
+	if len(phase) == 0 {
+		return Progress{}, false
+	}
+
+	now := time.Now()
+
+	progress := Progress{
+		Hash:          r.template.TemplateHash,
+		Phase:         phase,
+		TemplateState: r.template.GetState(r.ctx),
+		Elapsed:       now.Sub(r.start),
+		Remaining:     timeout - now.Sub(phaseStart),
+	}
+
+	if progress.Remaining < 0 {
+		progress.Remaining = 0
+	}
+
+	if phase != ProgressWaitTestDatabase {
+		return progress, true
+	}
+
+	explanation, err := r.m.pool.ExplainGetTestDatabase(r.ctx, r.template.TemplateHash, false, nil)
+	if err != nil {
+		// e.g. the pool is being (re)initialized
+		return progress, true
+	}
+	progress.Pool = &explanation
+
+	progress.EstimatedRemaining = r.estimate(explanation, now.Sub(phaseStart), now)
+
+	return progress, true
+}
+
+// estimate derives the remaining time until a test database is ready from the decision of the pool and its p50
+// clean latency (dirty -> ready), nil if there is no recent clean.
+func (r *progressReporter) estimate(explanation pool.Explanation, waited time.Duration, now time.Time) *time.Duration {
+	var estimate time.Duration
+
+	switch explanation.Decision {
+	case pool.DecisionReuseReady, pool.DecisionReuseDirty, pool.DecisionCreateOverflow:
+		return &estimate
+	}
+
+	var clean time.Duration
+	for _, stats := range r.m.pool.Stats(r.ctx) {
+		if stats.TemplateHash == r.template.TemplateHash && stats.Latencies.Clean.Count > 0 {
+			clean = time.Duration(stats.Latencies.Clean.P50Ms * float64(time.Millisecond))
+		}
+	}
+
+	if clean == 0 {
+		return nil
+	}
+
+	if explanation.Decision == pool.DecisionWaitBlocked && explanation.NextEligibleAt != nil {
+		// the lease expires first, the auto-cleaning starts afterwards
+		estimate = explanation.NextEligibleAt.Sub(now) + clean
+	} else {
+		estimate = clean - waited
+	}
+
+	if estimate < 0 {
+		estimate = 0
+	}
+
+	return &estimate
+}
@@ -0,0 +1,109 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/allaboutapps/integresql/pkg/events"
+)
+
+var ErrTemplateQuotaExceeded = errors.New("template quota of the namespace exceeded")
+
+// max number of eviction candidates suggested by a TemplateQuotaError
+const maxEvictionCandidates = 10
+
+// TemplateQuotaError is returned while initializing a template if its namespace (see templates.TemplateOptions.Namespace)
+// already tracks MaxTemplatesPerNamespace templates. It matches ErrTemplateQuotaExceeded via errors.Is.
+type TemplateQuotaError struct {
+	Namespace string `json:"namespace"`
+	Count     int    `json:"count"` // templates currently tracked within the namespace
+	Limit     int    `json:"limit"`
+
+	// Hashes of (at most 10) templates of the namespace without checked out test databases, least recently used first.
+	// Discarding them (DELETE /api/v1/templates/:hash) frees up the quota.
+	EvictionCandidates []string `json:"evictionCandidates"`
+}
+
+func (e *TemplateQuotaError) Error() string {
+	return fmt.Sprintf("%v: namespace %q tracks %d of %d templates, consider discarding unused ones (e.g. %v)",
+		ErrTemplateQuotaExceeded, e.Namespace, e.Count, e.Limit, e.EvictionCandidates)
+}
+
+func (e *TemplateQuotaError) Unwrap() error {
+	return ErrTemplateQuotaExceeded
+}
+
+// checkTemplateQuota returns a TemplateQuotaError if adding the template with the given hash would exceed the
+// MaxTemplatesPerNamespace of the namespace. Reinitializing an already tracked template never exceeds it.
+func (m Manager) checkTemplateQuota(ctx context.Context, hash string, namespace string) error {
+	if m.config.MaxTemplatesPerNamespace <= 0 {
+		return nil
+	}
+
+	type candidate struct {
+		hash         string
+		lastActivity time.Time
+	}
+
+	count := 0
+	candidates := make([]candidate, 0)
+
+	for _, template := range m.templates.List(ctx) {
+		if template.GetConfig(ctx).Options.Namespace != namespace {
+			continue
+		}
+
+		if template.TemplateHash == hash {
+			return nil
+		}
+
+		count++
+
+		checkedOut, lastActivity, err := m.pool.Activity(ctx, template.TemplateHash)
+		if err != nil {
+			// no pool yet (still initializing), it's in use
+			continue
+		}
+
+		if checkedOut == 0 {
+			candidates = append(candidates, candidate{hash: template.TemplateHash, lastActivity: lastActivity})
+		}
+	}
+
+	if count < m.config.MaxTemplatesPerNamespace {
+		return nil
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].lastActivity.Before(candidates[j].lastActivity) })
+
+	quotaErr := &TemplateQuotaError{
+		Namespace:          namespace,
+		Count:              count,
+		Limit:              m.config.MaxTemplatesPerNamespace,
+		EvictionCandidates: make([]string, 0, len(candidates)),
+	}
+
+	if len(candidates) > maxEvictionCandidates {
+		candidates = candidates[:maxEvictionCandidates]
+	}
+
+	for _, c := range candidates {
+		quotaErr.EvictionCandidates = append(quotaErr.EvictionCandidates, c.hash)
+	}
+
+	m.events.Emit(events.Event{
+		Type:    events.TypeTemplateQuotaExceeded,
+		Hash:    hash,
+		Message: quotaErr.Error(),
+		Fields: map[string]interface{}{
+			"namespace": namespace,
+			"count":     count,
+			"limit":     quotaErr.Limit,
+		},
+	})
+
+	return quotaErr
+}
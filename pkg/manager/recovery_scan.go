@@ -0,0 +1,77 @@
+package manager
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// scanRecoverable discovers the template and test databases left behind by a previous run by their names (see
+// RecoveryScan) and returns them as tracked state to readopt. Their options and the states of the test databases
+// weren't persisted: Templates are readopted with the default options, only templates with at least one test database
+// are considered finalized (templates still being populated are initialized again by their clients) and all test
+// databases are considered in use by clients of the previous run (recreated as soon as they are eligible for
+// auto-cleaning).
+func (m Manager) scanRecoverable(ctx context.Context) (*trackedState, error) {
+
+	log := m.getManagerLogger(ctx, "scanRecoverable")
+
+	templatePrefix := m.makeTemplateDatabaseName("")
+	testPrefix := m.config.PoolConfig.TestDBNamePrefix
+
+	templateDBs, err := m.listDatabasesWithPrefix(ctx, templatePrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	testDBs, err := m.listDatabasesWithPrefix(ctx, testPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	state := &trackedState{templates: make(map[string]*trackedTemplate)}
+	now := time.Now()
+
+	for _, dbName := range templateDBs {
+		// the hash of a truncated name is unknown
+		if len(dbName) >= maxIdentifierLength {
+			log.Warn().Str("dbName", dbName).Msg("template database name possibly truncated, not recovering it")
+			continue
+		}
+
+		state.templates[strings.TrimPrefix(dbName, templatePrefix)] = &trackedTemplate{
+			database:      dbName,
+			initializedAt: now,
+		}
+	}
+
+	for _, dbName := range testDBs {
+		// an empty test database prefix matches the template and manager databases as well
+		if strings.HasPrefix(dbName, templatePrefix) || dbName == m.config.TargetDatabaseConfig.Database {
+			continue
+		}
+
+		hash, id, ok := splitTestDatabaseName(testPrefix, dbName)
+		if !ok || dbName != m.pool.MakeDBName(hash, id) {
+			continue
+		}
+
+		if template, found := state.templates[hash]; found {
+			template.testDatabases = append(template.testDatabases, trackedTestDatabase{
+				database: dbName,
+				id:       id,
+				state:    "dirty",
+			})
+		}
+	}
+
+	for hash, template := range state.templates {
+		if len(template.testDatabases) == 0 {
+			delete(state.templates, hash)
+		}
+	}
+
+	log.Info().Int("templates", len(state.templates)).Msg("recoverable databases discovered")
+
+	return state, nil
+}
@@ -0,0 +1,74 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/allaboutapps/integresql/pkg/pool"
+	"github.com/allaboutapps/integresql/pkg/templates"
+)
+
+// ResizeTemplatePool changes the initial and max pool size of the finalized template with the hash at runtime (0 keeps
+// the current one), e.g. to grow the pool for a larger suite without restarting. Growing fills the pool in background,
+// shrinking evicts the test databases beyond the new max (the checked out ones as soon as they are returned). The max
+// can't exceed the MaxPoolSizeLimit the pool was created with. The sizes are stored within the options of the
+// template, thus they apply to the pool after recreating it as well.
+func (m Manager) ResizeTemplatePool(ctx context.Context, hash string, initialPoolSize int, maxPoolSize int) (pool.PoolSize, error) {
+
+	log := m.getManagerLogger(ctx, "ResizeTemplatePool").With().Str("hash", hash).Logger()
+
+	if !m.Ready() {
+		log.Error().Msg("not ready")
+		return pool.PoolSize{}, ErrManagerNotReady
+	}
+
+	if initialPoolSize < 0 || maxPoolSize < 0 {
+		return pool.PoolSize{}, fmt.Errorf("%w: pool sizes must not be negative", ErrInvalidTemplateOptions)
+	}
+
+	template, found := m.templates.Get(ctx, hash)
+	if !found {
+		return pool.PoolSize{}, ErrTemplateNotFound
+	}
+
+	if state := template.GetState(ctx); state != templates.TemplateStateFinalized {
+		return pool.PoolSize{}, fmt.Errorf("%w: template is %s", ErrInvalidTemplateState, state)
+	}
+
+	options := template.GetConfig(ctx).Options
+	current := m.templatePoolConfig(options)
+
+	if maxPoolSize == 0 {
+		maxPoolSize = current.MaxPoolSize
+	}
+	if initialPoolSize == 0 {
+		initialPoolSize = current.InitialPoolSize
+		if initialPoolSize > maxPoolSize {
+			// the kept initial pool size is capped to the new max
+			initialPoolSize = maxPoolSize
+		}
+	}
+
+	size, err := m.pool.Resize(ctx, hash, initialPoolSize, maxPoolSize)
+	if errors.Is(err, pool.ErrInvalidPoolSize) {
+		return pool.PoolSize{}, fmt.Errorf("%w: %v", ErrInvalidTemplateOptions, err)
+	} else if errors.Is(err, pool.ErrUnknownHash) {
+		// recreated with the next acquisition
+		return pool.PoolSize{}, fmt.Errorf("%w: the pool of the template is not initialized", ErrInvalidTemplateState)
+	}
+
+	// already applied if evicting the test databases beyond the new max failed
+	options.InitialPoolSize = size.InitialPoolSize
+	options.MaxPoolSize = size.MaxPoolSize
+	template.SetOptions(ctx, options)
+
+	if err != nil {
+		log.Error().Err(err).Msg("evicting test databases beyond the new max pool size failed")
+		return size, err
+	}
+
+	log.Info().Int("initialPoolSize", size.InitialPoolSize).Int("maxPoolSize", size.MaxPoolSize).Msg("pool resized")
+
+	return size, nil
+}
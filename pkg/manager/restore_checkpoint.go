@@ -0,0 +1,189 @@
+package manager
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/allaboutapps/integresql/pkg/db"
+	"github.com/allaboutapps/integresql/pkg/tracing"
+)
+
+// restoreSections are restored one after another, each within a single transaction, while TemplateRestoreCheckpoints
+// is enabled. A failed section is rolled back completely, thus a retry resumes exactly after the last completed one.
+var restoreSections = []string{"pre-data", "data", "post-data"}
+
+// RestoreCheckpoint is the progress of a failed dump restore into a template database, kept until the template
+// is initialized successfully (resuming the restore) or discarded.
+type RestoreCheckpoint struct {
+	Database          string    `json:"database"` // the template database, left behind with the completed sections
+	Dump              string    `json:"dump"`
+	CompletedSections []string  `json:"completedSections"`
+	FailedSection     string    `json:"failedSection,omitempty"` // empty if the restore completed, but the template failed afterwards
+	Error             string    `json:"error,omitempty"`
+	UpdatedAt         time.Time `json:"updatedAt"`
+
+	// the dump must not change between the attempts
+	dumpSize    int64
+	dumpModTime time.Time
+}
+
+// restoreCheckpointRegistry holds the checkpoints of the failed restores per template database.
+type restoreCheckpointRegistry struct {
+	checkpoints map[string]RestoreCheckpoint // map[dbName]
+	mutex       sync.Mutex
+}
+
+func newRestoreCheckpointRegistry() *restoreCheckpointRegistry {
+	return &restoreCheckpointRegistry{checkpoints: make(map[string]RestoreCheckpoint)}
+}
+
+func (r *restoreCheckpointRegistry) Get(dbName string) (RestoreCheckpoint, bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	checkpoint, ok := r.checkpoints[dbName]
+	return checkpoint, ok
+}
+
+func (r *restoreCheckpointRegistry) Set(checkpoint RestoreCheckpoint) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	checkpoint.UpdatedAt = time.Now()
+	checkpoint.CompletedSections = append([]string{}, checkpoint.CompletedSections...)
+	r.checkpoints[checkpoint.Database] = checkpoint
+}
+
+func (r *restoreCheckpointRegistry) Remove(dbName string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	delete(r.checkpoints, dbName)
+}
+
+// List returns all checkpoints sorted by database.
+func (r *restoreCheckpointRegistry) List() []RestoreCheckpoint {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	checkpoints := make([]RestoreCheckpoint, 0, len(r.checkpoints))
+	for _, checkpoint := range r.checkpoints {
+		checkpoints = append(checkpoints, checkpoint)
+	}
+
+	sort.Slice(checkpoints, func(i, j int) bool { return checkpoints[i].Database < checkpoints[j].Database })
+	return checkpoints
+}
+
+// resumeRestore returns the checkpoint to continue the restore of the dump into the template database from, false if
+// the restore has to start over (no previous attempt, a changed dump or the template database is gone).
+func (m Manager) resumeRestore(ctx context.Context, dbName string, dump string) (RestoreCheckpoint, bool, error) {
+
+	log := m.getManagerLogger(ctx, "resumeRestore").With().Str("dbName", dbName).Str("dump", dump).Logger()
+
+	path, err := m.templateDumpPath(dump)
+	if err != nil {
+		return RestoreCheckpoint{}, false, err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return RestoreCheckpoint{}, false, fmt.Errorf("%w: dump %q not found: %v", ErrInvalidTemplateOptions, dump, err)
+	}
+
+	fresh := RestoreCheckpoint{Database: dbName, Dump: dump, dumpSize: info.Size(), dumpModTime: info.ModTime()}
+
+	previous, ok := m.restoreCheckpoints.Get(dbName)
+	if !ok || len(previous.CompletedSections) == 0 {
+		return fresh, false, nil
+	}
+
+	if previous.Dump != dump || previous.dumpSize != info.Size() || !previous.dumpModTime.Equal(info.ModTime()) {
+		log.Info().Msg("dump changed since the failed restore, starting over")
+		m.restoreCheckpoints.Remove(dbName)
+		return fresh, false, nil
+	}
+
+	exists, err := m.checkDatabaseExists(ctx, dbName)
+	if err != nil {
+		return RestoreCheckpoint{}, false, err
+	}
+
+	if !exists {
+		log.Info().Msg("template database of the failed restore is gone, starting over")
+		m.restoreCheckpoints.Remove(dbName)
+		return fresh, false, nil
+	}
+
+	log.Info().Strs("completedSections", previous.CompletedSections).Msg("resuming restore")
+
+	return previous, true, nil
+}
+
+// restoreDumpSections restores the remaining sections of the checkpoint, recording the progress after each section.
+// The template database is kept on failure if any section was completed (see keepRestore).
+func (m Manager) restoreDumpSections(ctx context.Context, checkpoint RestoreCheckpoint, target db.DatabaseConfig) error {
+
+	defer tracing.Region(ctx, "restore_dump_sections").End()
+
+	log := m.getManagerLogger(ctx, "restoreDumpSections").With().Str("dump", checkpoint.Dump).Str("target", target.Database).Logger()
+
+	path, err := m.templateDumpPath(checkpoint.Dump)
+	if err != nil {
+		return err
+	}
+
+	for _, section := range restoreSections[len(checkpoint.CompletedSections):] {
+		args := append(pgToolConnectionArgs(target), "--no-owner", "--no-acl", "--exit-on-error", "--single-transaction", "--section="+section, path)
+		restore := exec.CommandContext(ctx, m.config.PgRestorePath, args...) // #nosec G204 - binary path is provided via config, the dump path is confined to the dump dir
+		restore.Env = pgToolEnv(target)
+
+		var stderr bytes.Buffer
+		restore.Stderr = &stderr
+
+		if err := restore.Run(); err != nil {
+			log.Error().Err(err).Str("section", section).Str("stderr", stderr.String()).Msg("pg_restore failed")
+
+			err = fmt.Errorf("pg_restore of section %s failed: %w: %s", section, err, strings.TrimSpace(stderr.String()))
+
+			checkpoint.FailedSection = section
+			checkpoint.Error = err.Error()
+			m.restoreCheckpoints.Set(checkpoint)
+
+			return err
+		}
+
+		checkpoint.CompletedSections = append(checkpoint.CompletedSections, section)
+		checkpoint.FailedSection = ""
+		checkpoint.Error = ""
+		m.restoreCheckpoints.Set(checkpoint)
+
+		log.Debug().Str("section", section).Msg("restored section.")
+	}
+
+	return nil
+}
+
+// keepRestore returns true if the failed template database should be kept for resuming its restore, recording the
+// failure of a completed restore (e.g. invalid settings applied afterwards).
+func (m Manager) keepRestore(dbName string, err error) bool {
+	checkpoint, ok := m.restoreCheckpoints.Get(dbName)
+	if !ok || len(checkpoint.CompletedSections) == 0 {
+		m.restoreCheckpoints.Remove(dbName)
+		return false
+	}
+
+	if len(checkpoint.FailedSection) == 0 {
+		checkpoint.Error = err.Error()
+		m.restoreCheckpoints.Set(checkpoint)
+	}
+
+	return true
+}
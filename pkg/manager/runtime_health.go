@@ -0,0 +1,138 @@
+package manager
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/allaboutapps/integresql/pkg/events"
+	"github.com/allaboutapps/integresql/pkg/util"
+)
+
+const (
+	taskRuntimeHealthCheck = "RUNTIME_HEALTH_CHECK"
+
+	minRuntimeHealthCheckInterval = 10 * time.Millisecond
+)
+
+const (
+	RuntimeThresholdGoroutines = "goroutines"
+	RuntimeThresholdHeap       = "heap"
+	RuntimeThresholdGCPause    = "gc_pause"
+)
+
+// runtimeHealth tracks the runtime thresholds currently exceeded, so each crossing is only alerted once.
+type runtimeHealth struct {
+	exceeded map[string]bool
+	mutex    sync.Mutex
+}
+
+// Update sets whether the threshold is currently exceeded, returns true if it was not exceeded before.
+func (h *runtimeHealth) Update(threshold string, exceeded bool) bool {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if h.exceeded == nil {
+		h.exceeded = make(map[string]bool)
+	}
+
+	crossed := exceeded && !h.exceeded[threshold]
+	h.exceeded[threshold] = exceeded
+
+	return crossed
+}
+
+// Exceeded returns the sorted thresholds currently exceeded.
+func (h *runtimeHealth) Exceeded() []string {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	exceeded := make([]string, 0, len(h.exceeded))
+	for threshold, ok := range h.exceeded {
+		if ok {
+			exceeded = append(exceeded, threshold)
+		}
+	}
+	sort.Strings(exceeded)
+
+	return exceeded
+}
+
+// runtimeHealthCheckEnabled returns true if any threshold of the Go runtime is configured.
+func (m Manager) runtimeHealthCheckEnabled() bool {
+	return m.config.RuntimeMaxGoroutines > 0 || m.config.RuntimeMaxHeapBytes > 0 || m.config.RuntimeMaxGCPause > 0
+}
+
+// runRuntimeHealthCheck periodically compares the Go runtime stats against the configured thresholds until the ctx
+// is done. Unlike maintenance tasks, it isn't restricted by the maintenance schedule (it doesn't touch any database).
+func (m Manager) runRuntimeHealthCheck(ctx context.Context) error {
+	interval := m.config.RuntimeHealthCheckInterval
+	if interval < minRuntimeHealthCheckInterval {
+		interval = minRuntimeHealthCheckInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			m.checkRuntimeHealth(ctx, util.ReadRuntimeStats())
+		}
+	}
+}
+
+// checkRuntimeHealth emits a warning event once a threshold is crossed (e.g. hinting at leaking goroutines of a
+// long-running server), the next one is emitted after it recovered and is crossed again.
+func (m Manager) checkRuntimeHealth(ctx context.Context, stats util.RuntimeStats) {
+
+	log := m.getManagerLogger(ctx, "checkRuntimeHealth")
+
+	heapMB := float64(stats.HeapAllocBytes) / 1024 / 1024
+	maxGCPauseMs := float64(m.config.RuntimeMaxGCPause) / float64(time.Millisecond)
+
+	checks := []struct {
+		threshold string
+		exceeded  bool
+		message   string
+	}{
+		{
+			RuntimeThresholdGoroutines,
+			m.config.RuntimeMaxGoroutines > 0 && stats.Goroutines > m.config.RuntimeMaxGoroutines,
+			fmt.Sprintf("%d goroutines exceed the maximum of %d", stats.Goroutines, m.config.RuntimeMaxGoroutines),
+		},
+		{
+			RuntimeThresholdHeap,
+			m.config.RuntimeMaxHeapBytes > 0 && stats.HeapAllocBytes > m.config.RuntimeMaxHeapBytes,
+			fmt.Sprintf("allocated heap of %.1f MB exceeds the maximum of %.1f MB", heapMB, float64(m.config.RuntimeMaxHeapBytes)/1024/1024),
+		},
+		{
+			RuntimeThresholdGCPause,
+			m.config.RuntimeMaxGCPause > 0 && stats.LastGCPauseMs > maxGCPauseMs,
+			fmt.Sprintf("GC pause of %.3f ms exceeds the maximum of %.3f ms", stats.LastGCPauseMs, maxGCPauseMs),
+		},
+	}
+
+	for _, check := range checks {
+		if !m.runtime.Update(check.threshold, check.exceeded) {
+			continue
+		}
+
+		log.Warn().Str("threshold", check.threshold).Int("goroutines", stats.Goroutines).Float64("heapAllocMB", heapMB).Float64("lastGCPauseMs", stats.LastGCPauseMs).Msg(check.message)
+
+		m.events.Emit(events.Event{
+			Type:    events.TypeRuntimeThresholdExceeded,
+			Message: check.message,
+			Fields: map[string]interface{}{
+				"threshold":      check.threshold,
+				"goroutines":     stats.Goroutines,
+				"heapAllocBytes": stats.HeapAllocBytes,
+				"lastGCPauseMs":  stats.LastGCPauseMs,
+			},
+		})
+	}
+}
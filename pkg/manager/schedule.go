@@ -0,0 +1,523 @@
+package manager
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/allaboutapps/integresql/pkg/encryption"
+	"github.com/allaboutapps/integresql/pkg/events"
+	"github.com/allaboutapps/integresql/pkg/pool"
+	"github.com/allaboutapps/integresql/pkg/templates"
+	"github.com/allaboutapps/integresql/pkg/util"
+)
+
+var (
+	ErrInvalidScheduledTask  = errors.New("invalid scheduled task")
+	ErrScheduledTaskNotFound = errors.New("scheduled task not found")
+)
+
+const (
+	taskScheduler = "SCHEDULER"
+
+	// interval of checking the cron expressions of the scheduled tasks, they match whole minutes
+	scheduleCheckInterval = 5 * time.Second
+)
+
+// ScheduledOperation is the admin operation executed by a ScheduledTask.
+type ScheduledOperation string
+
+const (
+	ScheduledOperationCleanupOrphans  ScheduledOperation = "cleanup_orphans"  // drops template and test databases of templates not tracked (anymore)
+	ScheduledOperationRefreshTemplate ScheduledOperation = "refresh_template" // discards the template and bootstraps it again from its source (dump, database or oci)
+	ScheduledOperationShrinkPools     ScheduledOperation = "shrink_pools"     // drops the ready test databases beyond the initial pool size of all pools
+)
+
+// ScheduledTask is a recurring admin operation executed by the manager whenever its cron expression matches,
+// persisted to the ScheduleFile.
+type ScheduledTask struct {
+	ID        int                `json:"id"`
+	Cron      string             `json:"cron"` // 5 field cron expression, see util.ParseCronExpression
+	Operation ScheduledOperation `json:"operation"`
+	Hash      string             `json:"hash,omitempty"` // template of ScheduledOperationRefreshTemplate
+	CreatedAt time.Time          `json:"createdAt"`
+
+	LastRunAt *time.Time `json:"lastRunAt,omitempty"`
+	LastError string     `json:"lastError,omitempty"` // empty if the last run succeeded
+	Runs      int        `json:"runs"`
+
+	cron util.CronExpression
+	slot time.Time // minute of the last run triggered by the cron expression
+}
+
+// validate parses the cron expression and checks the operation (and its hash).
+func (t *ScheduledTask) validate() error {
+	cron, err := util.ParseCronExpression(t.Cron)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidScheduledTask, err)
+	}
+	t.cron = cron
+
+	switch t.Operation {
+	case ScheduledOperationCleanupOrphans, ScheduledOperationShrinkPools:
+		if len(t.Hash) > 0 {
+			return fmt.Errorf("%w: operation %s doesn't take a hash", ErrInvalidScheduledTask, t.Operation)
+		}
+	case ScheduledOperationRefreshTemplate:
+		if len(t.Hash) == 0 {
+			return fmt.Errorf("%w: operation %s requires a hash", ErrInvalidScheduledTask, t.Operation)
+		}
+	default:
+		return fmt.Errorf("%w: unknown operation %q", ErrInvalidScheduledTask, t.Operation)
+	}
+
+	return nil
+}
+
+// scheduleRegistry holds the scheduled tasks and persists them to a JSON file (if any, sealed by the keys).
+type scheduleRegistry struct {
+	path   string // empty keeps the tasks in memory only
+	keys   *encryption.Keyring
+	tasks  map[int]*ScheduledTask
+	nextID int
+	mutex  sync.Mutex
+}
+
+// loadSchedule reads the scheduled tasks from the file, a missing file (or an empty path) starts empty.
+func loadSchedule(path string, keys *encryption.Keyring) (*scheduleRegistry, error) {
+	r := &scheduleRegistry{path: path, keys: keys, tasks: make(map[int]*ScheduledTask), nextID: 1}
+
+	if len(path) == 0 {
+		return r, nil
+	}
+
+	sealed, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := keys.Open(sealed)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schedule file %s: %w", path, err)
+	}
+
+	var tasks []ScheduledTask
+	if err := json.Unmarshal(b, &tasks); err != nil {
+		return nil, fmt.Errorf("invalid schedule file %s: %w", path, err)
+	}
+
+	for i := range tasks {
+		if err := tasks[i].validate(); err != nil {
+			return nil, fmt.Errorf("invalid schedule file %s: task %d: %w", path, tasks[i].ID, err)
+		}
+
+		r.tasks[tasks[i].ID] = &tasks[i]
+		if tasks[i].ID >= r.nextID {
+			r.nextID = tasks[i].ID + 1
+		}
+	}
+
+	// sealed with the primary key right away (e.g. after rotating the keys), the tasks are rarely changed
+	if !keys.Current(sealed) {
+		if err := r.unsafeSave(); err != nil {
+			return nil, fmt.Errorf("unable to seal schedule file %s: %w", path, err)
+		}
+	}
+
+	return r, nil
+}
+
+// List returns all tasks sorted by ID.
+func (r *scheduleRegistry) List() []ScheduledTask {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.unsafeList()
+}
+
+func (r *scheduleRegistry) unsafeList() []ScheduledTask {
+	tasks := make([]ScheduledTask, 0, len(r.tasks))
+	for _, task := range r.tasks {
+		tasks = append(tasks, *task)
+	}
+	sort.Slice(tasks, func(i, j int) bool { return tasks[i].ID < tasks[j].ID })
+
+	return tasks
+}
+
+func (r *scheduleRegistry) Get(id int) (ScheduledTask, bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	task, ok := r.tasks[id]
+	if !ok {
+		return ScheduledTask{}, false
+	}
+
+	return *task, true
+}
+
+// Add assigns an ID to the (validated) task and persists it.
+func (r *scheduleRegistry) Add(task ScheduledTask) (ScheduledTask, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	task.ID = r.nextID
+	r.tasks[task.ID] = &task
+
+	if err := r.unsafeSave(); err != nil {
+		delete(r.tasks, task.ID)
+		return ScheduledTask{}, err
+	}
+
+	r.nextID++
+
+	return task, nil
+}
+
+// Remove deletes the task and persists the remaining ones.
+func (r *scheduleRegistry) Remove(id int) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	task, ok := r.tasks[id]
+	if !ok {
+		return ErrScheduledTaskNotFound
+	}
+
+	delete(r.tasks, id)
+
+	if err := r.unsafeSave(); err != nil {
+		r.tasks[id] = task
+		return err
+	}
+
+	return nil
+}
+
+// Due returns the tasks whose cron expression matches the minute of now and marks them as run within this minute.
+func (r *scheduleRegistry) Due(now time.Time) []ScheduledTask {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	slot := now.Truncate(time.Minute)
+
+	due := make([]ScheduledTask, 0)
+	for _, task := range r.tasks {
+		if task.slot.Equal(slot) || !task.cron.Matches(now) {
+			continue
+		}
+
+		task.slot = slot
+		due = append(due, *task)
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].ID < due[j].ID })
+
+	return due
+}
+
+// RecordRun stores the result of a run of the task (if it still exists) and persists it.
+func (r *scheduleRegistry) RecordRun(id int, at time.Time, runErr error) (ScheduledTask, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	task, ok := r.tasks[id]
+	if !ok {
+		return ScheduledTask{}, ErrScheduledTaskNotFound
+	}
+
+	task.LastRunAt = &at
+	task.LastError = ""
+	if runErr != nil {
+		task.LastError = runErr.Error()
+	}
+	task.Runs++
+
+	return *task, r.unsafeSave()
+}
+
+// unsafeSave replaces the file atomically, a no-op without a path.
+func (r *scheduleRegistry) unsafeSave() error {
+	if len(r.path) == 0 {
+		return nil
+	}
+
+	plaintext, err := json.MarshalIndent(r.unsafeList(), "", "  ")
+	if err != nil {
+		return err
+	}
+
+	b, err := r.keys.Seal(plaintext)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(r.path), ".integresql-schedule-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), r.path)
+}
+
+// ScheduledTasks returns all scheduled tasks sorted by ID.
+func (m Manager) ScheduledTasks(_ context.Context) []ScheduledTask {
+	return m.schedule.List()
+}
+
+// ScheduleTask adds a recurring admin task, executed whenever its cron expression matches (while connected).
+func (m Manager) ScheduleTask(ctx context.Context, task ScheduledTask) (ScheduledTask, error) {
+
+	log := m.getManagerLogger(ctx, "ScheduleTask")
+
+	if err := task.validate(); err != nil {
+		return ScheduledTask{}, err
+	}
+
+	task.CreatedAt = time.Now()
+	task.LastRunAt = nil
+	task.LastError = ""
+	task.Runs = 0
+
+	task, err := m.schedule.Add(task)
+	if err != nil {
+		log.Error().Err(err).Msg("persisting the scheduled task failed")
+		return ScheduledTask{}, err
+	}
+
+	log.Info().Int("id", task.ID).Str("cron", task.Cron).Str("operation", string(task.Operation)).Str("hash", task.Hash).Msg("task scheduled")
+
+	return task, nil
+}
+
+// UnscheduleTask removes the scheduled task, a currently running execution completes.
+func (m Manager) UnscheduleTask(ctx context.Context, id int) error {
+
+	log := m.getManagerLogger(ctx, "UnscheduleTask")
+
+	if err := m.schedule.Remove(id); err != nil {
+		return err
+	}
+
+	log.Info().Int("id", id).Msg("task unscheduled")
+
+	return nil
+}
+
+// RunScheduledTask executes the scheduled task right away (regardless of its cron expression) and returns it
+// including the result of the run. Errors of the operation are part of the task (LastError), not returned.
+func (m Manager) RunScheduledTask(ctx context.Context, id int) (ScheduledTask, error) {
+	if !m.Ready() {
+		return ScheduledTask{}, ErrManagerNotReady
+	}
+
+	task, ok := m.schedule.Get(id)
+	if !ok {
+		return ScheduledTask{}, ErrScheduledTaskNotFound
+	}
+
+	return m.runScheduledTask(ctx, task)
+}
+
+// runScheduler executes the due scheduled tasks (one after another) until the ctx is done. Failed runs are reported to
+// the background supervisor, they don't stop the scheduler.
+func (m Manager) runScheduler(ctx context.Context) error {
+	ticker := time.NewTicker(scheduleCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case now := <-ticker.C:
+			for _, task := range m.schedule.Due(now) {
+				task, err := m.runScheduledTask(ctx, task)
+				if err == nil && len(task.LastError) > 0 {
+					err = fmt.Errorf("scheduled task %d (%s) failed: %s", task.ID, task.Operation, task.LastError)
+				}
+
+				m.background.Report(taskScheduler, err)
+			}
+		}
+	}
+}
+
+func (m Manager) runScheduledTask(ctx context.Context, task ScheduledTask) (ScheduledTask, error) {
+
+	log := m.getManagerLogger(ctx, "runScheduledTask").With().Int("id", task.ID).Str("operation", string(task.Operation)).Logger()
+
+	start := time.Now()
+
+	var summary string
+	var err error
+	switch task.Operation {
+	case ScheduledOperationCleanupOrphans:
+		var dropped []string
+		dropped, err = m.cleanupOrphans(ctx)
+		summary = fmt.Sprintf("dropped %d orphaned databases", len(dropped))
+	case ScheduledOperationRefreshTemplate:
+		err = m.refreshTemplate(ctx, task.Hash)
+		summary = fmt.Sprintf("refreshed template %s", task.Hash)
+	case ScheduledOperationShrinkPools:
+		var shrunk int
+		shrunk, err = m.pool.ShrinkAll(ctx)
+		summary = fmt.Sprintf("dropped %d ready test databases beyond the initial pool size", shrunk)
+	default:
+		err = fmt.Errorf("%w: unknown operation %q", ErrInvalidScheduledTask, task.Operation)
+	}
+
+	if err != nil {
+		log.Warn().Err(err).Msg("scheduled task failed")
+		summary = err.Error()
+	} else {
+		log.Info().Dur("duration", time.Since(start)).Msg(summary)
+	}
+
+	m.events.Emit(events.Event{
+		Type:    events.TypeScheduledTaskRun,
+		Hash:    task.Hash,
+		Message: fmt.Sprintf("scheduled task %d (%s): %s", task.ID, task.Operation, summary),
+		Fields: map[string]interface{}{
+			"id":         task.ID,
+			"operation":  string(task.Operation),
+			"failed":     err != nil,
+			"durationMs": time.Since(start).Milliseconds(),
+		},
+	})
+
+	recorded, saveErr := m.schedule.RecordRun(task.ID, start, err)
+	if errors.Is(saveErr, ErrScheduledTaskNotFound) {
+		// unscheduled while running
+		task.LastRunAt = &start
+		task.LastError = ""
+		if err != nil {
+			task.LastError = err.Error()
+		}
+		task.Runs++
+
+		return task, nil
+	}
+
+	return recorded, saveErr
+}
+
+// cleanupOrphans drops the template and test databases of the current prefixes whose template isn't tracked (anymore),
+// e.g. left behind by a crashed instance. Template databases kept for resuming a restore are left untouched.
+func (m Manager) cleanupOrphans(ctx context.Context) ([]string, error) {
+
+	log := m.getManagerLogger(ctx, "cleanupOrphans")
+
+	templatePrefix := m.makeTemplateDatabaseName("")
+	testPrefix := m.config.PoolConfig.TestDBNamePrefix
+
+	orphans := make([]string, 0)
+
+	templateDBs, err := m.listDatabasesWithPrefix(ctx, templatePrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, dbName := range templateDBs {
+		hash := strings.TrimPrefix(dbName, templatePrefix)
+		if _, found := m.templates.Get(ctx, hash); found {
+			continue
+		}
+
+		if _, resumable := m.restoreCheckpoints.Get(dbName); resumable {
+			continue
+		}
+
+		orphans = append(orphans, dbName)
+	}
+
+	testDBs, err := m.listDatabasesWithPrefix(ctx, testPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	states := m.pool.TestDatabaseStates(ctx)
+
+	for _, dbName := range testDBs {
+		// an empty test database prefix matches the template and manager databases as well
+		if strings.HasPrefix(dbName, templatePrefix) || dbName == m.config.TargetDatabaseConfig.Database {
+			continue
+		}
+
+		hash, _, ok := splitTestDatabaseName(testPrefix, dbName)
+		if !ok {
+			continue
+		}
+
+		// test databases of tracked templates might just be created by their pool
+		if _, tracked := states[dbName]; tracked {
+			continue
+		}
+		if _, found := m.templates.Get(ctx, hash); found {
+			continue
+		}
+
+		orphans = append(orphans, dbName)
+	}
+
+	dropped := make([]string, 0, len(orphans))
+	var errs []error
+	for _, dbName := range orphans {
+		log.Warn().Str("dbName", dbName).Msg("Dropping orphaned database...")
+
+		if err := m.dropDatabase(ctx, dbName); err != nil {
+			errs = append(errs, fmt.Errorf("failed to drop orphaned database %s: %w", dbName, err))
+			continue
+		}
+
+		dropped = append(dropped, dbName)
+	}
+
+	return dropped, errors.Join(errs...)
+}
+
+// refreshTemplate discards the template and bootstraps it again from its source (with the same options), e.g. to pick
+// up a changed dump. Templates with checked out test databases are kept, not to pull them from running tests.
+func (m Manager) refreshTemplate(ctx context.Context, hash string) error {
+	template, found := m.templates.Get(ctx, hash)
+	if !found {
+		return ErrTemplateNotFound
+	}
+
+	// empty templates are populated by the client, adopted databases are gone after discarding them
+	options := template.GetConfig(ctx).Options
+	if source := options.Source(); source == templates.TemplateSourceEmpty || source == templates.TemplateSourceExisting {
+		return fmt.Errorf("%w: template %s can't be refreshed from its source (%s)", ErrInvalidScheduledTask, hash, source)
+	}
+
+	if checkedOut, _, err := m.pool.Activity(ctx, hash); err == nil && checkedOut > 0 {
+		return fmt.Errorf("%w: %d test databases of template %s are checked out", pool.ErrTestDBInUse, checkedOut, hash)
+	}
+
+	if err := m.DiscardTemplateDatabase(ctx, hash); err != nil && !errors.Is(err, ErrTemplateNotFound) {
+		return err
+	}
+
+	_, err := m.BootstrapTemplateDatabase(ctx, hash, options)
+
+	return err
+}
@@ -0,0 +1,259 @@
+package manager
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+
+	"github.com/allaboutapps/integresql/pkg/db"
+	"github.com/allaboutapps/integresql/pkg/pool"
+	"github.com/allaboutapps/integresql/pkg/tracing"
+)
+
+var ErrShardingUnsupported = errors.New("sharding test databases across multiple servers is not supported with the tracking schema or recovery scan")
+
+// shardRegistry holds the connections to the further servers the test databases are striped across (see ShardHosts)
+// and the copies of the templates on them, test databases located on such a server are cloned from its local copy.
+type shardRegistry struct {
+	servers []*shardServer           // PoolConfig.Shards[1:], the first shard is the TargetDatabaseConfig
+	copies  map[string]*templateCopy // map[shard/template]copy of the template on the server
+	mutex   sync.Mutex
+}
+
+type shardServer struct {
+	config db.DatabaseConfig
+	db     *sql.DB // nil while disconnected
+}
+
+type templateCopy struct {
+	done chan struct{} // closed as soon as the copy is created (or failed)
+	err  error
+}
+
+func newShardRegistry(shards []db.DatabaseConfig) *shardRegistry {
+	r := &shardRegistry{
+		copies: make(map[string]*templateCopy),
+	}
+
+	for i := 1; i < len(shards); i++ {
+		r.servers = append(r.servers, &shardServer{config: shards[i]})
+	}
+
+	return r
+}
+
+// ParseShardHosts returns the configs of the servers ("host" or "host:port", the port defaults to the one of the
+// target), the target is always the first one. All servers share the credentials of the target.
+func ParseShardHosts(target db.DatabaseConfig, hosts []string) ([]db.DatabaseConfig, error) {
+	shards := []db.DatabaseConfig{target}
+
+	for _, host := range hosts {
+		config := target
+		config.Host = host
+
+		if h, p, err := net.SplitHostPort(host); err == nil {
+			port, err := strconv.Atoi(p)
+			if err != nil || port <= 0 {
+				return nil, fmt.Errorf("invalid port of shard host %q", host)
+			}
+
+			config.Host, config.Port = h, port
+		}
+
+		if len(config.Host) == 0 {
+			return nil, fmt.Errorf("invalid shard host %q", host)
+		}
+
+		shards = append(shards, config)
+	}
+
+	return shards, nil
+}
+
+// connectShards opens the connections to the further servers.
+func (m Manager) connectShards(ctx context.Context) error {
+	for _, server := range m.shards.servers {
+		conn, err := sql.Open(m.engine.DriverName(), m.engine.DSN(server.config))
+		if err != nil {
+			m.closeShards()
+			return err
+		}
+
+		if err := conn.PingContext(ctx); err != nil {
+			conn.Close()
+			m.closeShards()
+			return fmt.Errorf("unable to ping shard %s:%d: %w", server.config.Host, server.config.Port, err)
+		}
+
+		server.db = conn
+	}
+
+	return nil
+}
+
+func (m Manager) closeShards() error {
+	var errs []error
+	for _, server := range m.shards.servers {
+		if server.db == nil {
+			continue
+		}
+
+		if err := server.db.Close(); err != nil {
+			errs = append(errs, err)
+		}
+		server.db = nil
+	}
+
+	return errors.Join(errs...)
+}
+
+// onShard returns the manager operating on the server of the test database with the ID.
+func (m Manager) onShard(id int) Manager {
+	shard := pool.ShardOf(id, len(m.config.PoolConfig.Shards))
+	if shard == 0 {
+		return m
+	}
+
+	return m.onServer(m.shards.servers[shard-1])
+}
+
+func (m Manager) onServer(server *shardServer) Manager {
+	m.db = server.db
+	m.config.TargetDatabaseConfig = server.config
+
+	return m
+}
+
+// ensureTemplateCopy copies the template onto the server of the test database with the ID (once, concurrent calls
+// wait for the same copy), test databases on other servers than the target are cloned from such copies.
+func (m Manager) ensureTemplateCopy(ctx context.Context, id int, template string) error {
+	shard := pool.ShardOf(id, len(m.config.PoolConfig.Shards))
+	if shard == 0 {
+		return nil
+	}
+
+	key := fmt.Sprintf("%d/%s", shard, template)
+
+	m.shards.mutex.Lock()
+	c, ok := m.shards.copies[key]
+	if ok {
+		m.shards.mutex.Unlock()
+
+		select {
+		case <-c.done:
+			return c.err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	c = &templateCopy{done: make(chan struct{})}
+	m.shards.copies[key] = c
+	m.shards.mutex.Unlock()
+
+	c.err = m.copyTemplate(ctx, m.shards.servers[shard-1], template)
+	if c.err != nil {
+		// retried by the next clone
+		m.shards.mutex.Lock()
+		delete(m.shards.copies, key)
+		m.shards.mutex.Unlock()
+	}
+	close(c.done)
+
+	return c.err
+}
+
+func (m Manager) copyTemplate(ctx context.Context, server *shardServer, template string) error {
+	defer tracing.Region(ctx, "copy_template_to_shard").End()
+
+	log := m.getManagerLogger(ctx, "copyTemplate").With().Str("dbName", template).Str("shard", server.config.Host).Logger()
+
+	shard := m.onServer(server)
+	if err := shard.dropAndCreateDatabase(ctx, template, server.config.Username, m.config.TemplateDatabaseTemplate); err != nil {
+		return fmt.Errorf("creating the copy of template %s on shard %s failed: %w", template, server.config.Host, err)
+	}
+
+	source := m.config.TargetDatabaseConfig
+	source.Database = template
+
+	target := server.config
+	target.Database = template
+
+	if err := m.transferDatabase(ctx, source, target); err != nil {
+		return fmt.Errorf("copying template %s to shard %s failed: %w", template, server.config.Host, err)
+	}
+
+	log.Info().Msg("template copied to shard")
+
+	return nil
+}
+
+// dropShardTemplateCopies drops the copies of the template with the hash on all further servers (including the ones
+// pools were migrated to).
+func (m Manager) dropShardTemplateCopies(ctx context.Context, hash string) error {
+	if err := m.dropMigrationTemplateCopies(ctx, hash); err != nil {
+		return err
+	}
+
+	if len(m.shards.servers) == 0 {
+		return nil
+	}
+
+	template := m.makeTemplateDatabaseName(hash)
+
+	m.shards.mutex.Lock()
+	for shard := range m.shards.servers {
+		delete(m.shards.copies, fmt.Sprintf("%d/%s", shard+1, template))
+	}
+	m.shards.mutex.Unlock()
+
+	var errs []error
+	for _, server := range m.shards.servers {
+		// clones from the copy might still be in progress
+		if err := m.onServer(server).dropTemplateDatabase(ctx, template); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// dropAllShardDatabases drops all template copies and test databases on the further servers (including the ones
+// pools were migrated to).
+func (m Manager) dropAllShardDatabases(ctx context.Context) error {
+	servers := append(append([]*shardServer{}, m.shards.servers...), m.migrations.list()...)
+	if len(servers) == 0 {
+		return nil
+	}
+
+	m.shards.mutex.Lock()
+	m.shards.copies = make(map[string]*templateCopy)
+	m.shards.mutex.Unlock()
+
+	log := m.getManagerLogger(ctx, "dropAllShardDatabases")
+
+	for _, server := range servers {
+		shard := m.onServer(server)
+
+		for _, prefix := range []string{m.makeTemplateDatabaseName(""), m.config.PoolConfig.TestDBNamePrefix} {
+			dbNames, err := shard.listDatabasesWithPrefix(ctx, prefix)
+			if err != nil {
+				return fmt.Errorf("listing databases on shard %s failed: %w", server.config.Host, err)
+			}
+
+			for _, dbName := range dbNames {
+				log.Warn().Str("dbName", dbName).Str("shard", server.config.Host).Msg("Dropping...")
+
+				if err := shard.dropDatabase(ctx, dbName); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
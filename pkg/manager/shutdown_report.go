@@ -0,0 +1,215 @@
+package manager
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/allaboutapps/integresql/pkg/templates"
+	"github.com/allaboutapps/integresql/pkg/tracing"
+	"github.com/rs/zerolog"
+)
+
+const (
+	ShutdownReportStateUntracked = "untracked" // not tracked by this run (e.g. left behind by a previous run or discarded)
+
+	ShutdownReportOnRestartDropped   = "dropped"   // dropped while initializing the next start
+	ShutdownReportOnRestartOrphaned  = "orphaned"  // kept as-is, until a template of its hash (or a test database with its name) is created again, which replaces it
+	ShutdownReportOnRestartReadopted = "readopted" // tracked again by the next start, see TrackingSchema and RecoveryScan
+)
+
+// ShutdownReportDatabase describes a database left on the server by the manager.
+type ShutdownReportDatabase struct {
+	Database string `json:"database"`
+	Hash     string `json:"hash,omitempty"`
+	State    string `json:"state"` // template or test database state, ShutdownReportStateUntracked if not tracked
+
+	// tracked again after a restart, only with the TrackingSchema or RecoveryScan (tracking is in-memory only otherwise)
+	Readopted bool   `json:"readopted"`
+	OnRestart string `json:"onRestart"`
+}
+
+// ShutdownReport lists the managed databases (by prefix) left on the server.
+type ShutdownReport struct {
+	CreatedAt time.Time `json:"createdAt"`
+	Final     bool      `json:"final"` // created while disconnecting, otherwise a preview of what disconnecting now would leave behind
+
+	Templates     []ShutdownReportDatabase `json:"templates"`
+	TestDatabases []ShutdownReportDatabase `json:"testDatabases"`
+}
+
+func (r ShutdownReport) log(log zerolog.Logger) {
+	orphaned := 0
+
+	for _, template := range r.Templates {
+		if template.OnRestart == ShutdownReportOnRestartOrphaned {
+			orphaned++
+		}
+
+		log.Info().Str("dbName", template.Database).Str("hash", template.Hash).Str("state", template.State).Bool("readopted", template.Readopted).Str("onRestart", template.OnRestart).Msg("template database left behind")
+	}
+
+	for _, test := range r.TestDatabases {
+		if test.OnRestart == ShutdownReportOnRestartOrphaned {
+			orphaned++
+		}
+
+		log.Debug().Str("dbName", test.Database).Str("hash", test.Hash).Str("state", test.State).Bool("readopted", test.Readopted).Str("onRestart", test.OnRestart).Msg("test database left behind")
+	}
+
+	log.Warn().Int("templates", len(r.Templates)).Int("testDatabases", len(r.TestDatabases)).Int("orphaned", orphaned).Msg("databases left behind")
+}
+
+// shutdownReports holds the report of the last Disconnect until the next Connect.
+type shutdownReports struct {
+	report *ShutdownReport
+	mutex  sync.RWMutex
+}
+
+func (r *shutdownReports) Get() (ShutdownReport, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	if r.report == nil {
+		return ShutdownReport{}, false
+	}
+
+	return *r.report, true
+}
+
+func (r *shutdownReports) Set(report ShutdownReport) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.report = &report
+}
+
+func (r *shutdownReports) Clear() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.report = nil
+}
+
+// ShutdownReport returns the report of the databases left behind by the last Disconnect (logged as well), the server
+// keeps it retrievable until it exits. While connected, a preview of what disconnecting now would leave behind
+// is returned instead.
+func (m Manager) ShutdownReport(ctx context.Context) (ShutdownReport, error) {
+	if report, ok := m.shutdowns.Get(); ok {
+		return report, nil
+	}
+
+	if !m.Ready() {
+		return ShutdownReport{}, ErrManagerNotReady
+	}
+
+	return m.buildShutdownReport(ctx, false)
+}
+
+func (m Manager) buildShutdownReport(ctx context.Context, final bool) (ShutdownReport, error) {
+
+	defer tracing.Region(ctx, "build_shutdown_report").End()
+
+	report := ShutdownReport{
+		CreatedAt:     time.Now(),
+		Final:         final,
+		Templates:     []ShutdownReportDatabase{},
+		TestDatabases: []ShutdownReportDatabase{},
+	}
+
+	templatePrefix := m.makeTemplateDatabaseName("")
+	testPrefix := m.config.PoolConfig.TestDBNamePrefix
+
+	templateDBs, err := m.listDatabasesWithPrefix(ctx, templatePrefix)
+	if err != nil {
+		return report, err
+	}
+
+	// finalized templates (and their pool test databases) are readopted with the TrackingSchema (see syncTracking) or
+	// the RecoveryScan (see scanRecoverable)
+	readoptedHashes := make(map[string]bool)
+
+	for _, dbName := range templateDBs {
+		hash := strings.TrimPrefix(dbName, templatePrefix)
+		state := ShutdownReportStateUntracked
+
+		if template, found := m.templates.Get(ctx, hash); found && template.Config.Database == dbName {
+			state = template.GetState(ctx).String()
+		}
+
+		// initializing the hash again drops and recreates the template database
+		onRestart := ShutdownReportOnRestartOrphaned
+		readopted := (m.config.TrackingSchema || m.config.RecoveryScan) && state == templates.TemplateStateFinalized.String()
+		if readopted {
+			onRestart = ShutdownReportOnRestartReadopted
+			readoptedHashes[hash] = true
+		}
+
+		report.Templates = append(report.Templates, ShutdownReportDatabase{
+			Database:  dbName,
+			Hash:      hash,
+			State:     state,
+			Readopted: readopted,
+			OnRestart: onRestart,
+		})
+	}
+
+	testDBs, err := m.listDatabasesWithPrefix(ctx, testPrefix)
+	if err != nil {
+		return report, err
+	}
+
+	// the test databases Initialize drops are selected by a (slightly different) LIKE pattern, let the server decide
+	droppedDBs, err := m.engine.ListDatabases(ctx, m.db, m.initializeDropPattern())
+	if err != nil {
+		return report, err
+	}
+
+	dropped := make(map[string]bool, len(droppedDBs))
+	for _, dbName := range droppedDBs {
+		dropped[dbName] = true
+	}
+
+	states := m.pool.TestDatabaseStates(ctx)
+
+	for _, dbName := range testDBs {
+		// an empty test database prefix matches the template and manager databases as well
+		if strings.HasPrefix(dbName, templatePrefix) || dbName == m.config.TargetDatabaseConfig.Database {
+			continue
+		}
+
+		hash, id, ok := splitTestDatabaseName(testPrefix, dbName)
+		if !ok {
+			continue
+		}
+
+		state, tracked := states[dbName]
+		if !tracked {
+			state = ShutdownReportStateUntracked
+		}
+
+		readopted := tracked && readoptedHashes[hash] && id < m.templateMaxPoolSize(ctx, hash) && state != "dropping"
+
+		onRestart := ShutdownReportOnRestartOrphaned
+		if readopted {
+			onRestart = ShutdownReportOnRestartReadopted
+		} else if dropped[dbName] {
+			onRestart = ShutdownReportOnRestartDropped
+		}
+
+		report.TestDatabases = append(report.TestDatabases, ShutdownReportDatabase{
+			Database:  dbName,
+			Hash:      hash,
+			State:     state,
+			Readopted: readopted,
+			OnRestart: onRestart,
+		})
+	}
+
+	sort.Slice(report.Templates, func(i, j int) bool { return report.Templates[i].Database < report.Templates[j].Database })
+	sort.Slice(report.TestDatabases, func(i, j int) bool { return report.TestDatabases[i].Database < report.TestDatabases[j].Database })
+
+	return report, nil
+}
@@ -0,0 +1,135 @@
+package manager
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/allaboutapps/integresql/pkg/db"
+	"github.com/allaboutapps/integresql/pkg/events"
+	"github.com/allaboutapps/integresql/pkg/tracing"
+)
+
+// SoakMarkerTable is created within each handed out test database while SoakInvariantCheck is enabled. Recreating
+// the test database from its template removes it, thus it must be gone on the next handout of the same database.
+const SoakMarkerTable = "integresql_soak_marker"
+
+// soakRegistry tracks the test databases which may legitimately be handed out again with their marker and counts
+// the detected violations of the invariant.
+type soakRegistry struct {
+	unlocked   map[string]bool // map[dbName], returned without recreating them (see ReturnTestDatabase)
+	violations int
+	mutex      sync.Mutex
+}
+
+func newSoakRegistry() *soakRegistry {
+	return &soakRegistry{unlocked: make(map[string]bool)}
+}
+
+// Unlocked flags the test database to be reused without recreating it, its marker is expected on the next handout.
+func (r *soakRegistry) Unlocked(dbName string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.unlocked[dbName] = true
+}
+
+// HandedOut returns true if the test database was unlocked since its last handout and resets the flag.
+func (r *soakRegistry) HandedOut(dbName string) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	unlocked := r.unlocked[dbName]
+	delete(r.unlocked, dbName)
+
+	return unlocked
+}
+
+// Rename moves the flag of the test database to its new name (see renameTestPoolDB), a flag of the new name is dropped.
+func (r *soakRegistry) Rename(from string, to string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	unlocked := r.unlocked[from]
+	delete(r.unlocked, from)
+	delete(r.unlocked, to)
+
+	if unlocked {
+		r.unlocked[to] = true
+	}
+}
+
+// Forget drops the flag of the dropped test database, its name is reused by the next one with the same ID.
+func (r *soakRegistry) Forget(dbName string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	delete(r.unlocked, dbName)
+}
+
+func (r *soakRegistry) RecordViolation() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.violations++
+}
+
+func (r *soakRegistry) Violations() int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.violations
+}
+
+// checkSoakInvariant verifies the invariant "a returned test database is always recreated before its reuse": The
+// marker stamped by the previous handout must be gone, unless the test database was intentionally handed out without
+// recreating it (unlocked or dirty via skip clean). Afterwards the test database is stamped again. Errors of the check
+// itself are logged only, they never fail the handout.
+func (m Manager) checkSoakInvariant(ctx context.Context, testDB db.TestDatabase) {
+
+	defer tracing.Region(ctx, "check_soak_invariant").End()
+
+	log := m.getManagerLogger(ctx, "checkSoakInvariant").With().Str("hash", testDB.TemplateHash).Str("dbName", testDB.Config.Database).Logger()
+
+	unlocked := m.soak.HandedOut(testDB.Config.Database)
+
+	conn, err := sql.Open("postgres", testDB.Config.ConnectionString())
+	if err != nil {
+		log.Warn().Err(err).Msg("failed to connect, skipping check")
+		return
+	}
+	defer conn.Close()
+
+	var previous sql.NullTime
+	if err := conn.QueryRowContext(ctx, fmt.Sprintf(`SELECT CASE WHEN to_regclass('%s') IS NULL THEN NULL ELSE (SELECT max(handed_out_at) FROM %s) END`, SoakMarkerTable, SoakMarkerTable)).Scan(&previous); err != nil {
+		// the table might only exist partially (e.g. concurrently dropped by the test), try again on the next handout
+		log.Warn().Err(err).Msg("failed to query the marker, skipping check")
+		return
+	}
+
+	if previous.Valid && !unlocked && !testDB.Dirty {
+		m.soak.RecordViolation()
+
+		log.Error().Time("previousHandout", previous.Time).Msg("SOAK INVARIANT VIOLATED: test database was handed out again without being recreated")
+
+		m.events.Emit(events.Event{
+			Type:    events.TypeSoakInvariantViolated,
+			Hash:    testDB.TemplateHash,
+			Message: fmt.Sprintf("test database %s still contains the marker of its handout at %s, it was reused without being recreated", testDB.Config.Database, previous.Time.Format(time.RFC3339Nano)),
+			Fields: map[string]interface{}{
+				"id":              testDB.ID,
+				"previousHandout": previous.Time,
+			},
+		})
+	}
+
+	stamp := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (handed_out_at timestamptz NOT NULL); DELETE FROM %s; INSERT INTO %s (handed_out_at) VALUES (now())`, SoakMarkerTable, SoakMarkerTable, SoakMarkerTable)
+	if _, err := conn.ExecContext(ctx, stamp); err != nil {
+		log.Warn().Err(err).Msg("failed to stamp the marker")
+		return
+	}
+
+	log.Trace().Bool("unlocked", unlocked).Bool("dirty", testDB.Dirty).Msg("stamped marker")
+}
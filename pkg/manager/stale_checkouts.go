@@ -0,0 +1,182 @@
+package manager
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/allaboutapps/integresql/pkg/events"
+	"github.com/allaboutapps/integresql/pkg/pool"
+	"github.com/allaboutapps/integresql/pkg/templates"
+)
+
+const (
+	taskStaleCheckoutCheck = "STALE_CHECKOUT_CHECK"
+
+	minStaleCheckoutCheckInterval = 10 * time.Millisecond
+)
+
+// StaleCheckoutWebhook is the event of the stale checkout webhooks, sent in the webhook.EventHeader.
+const StaleCheckoutWebhook = "checkout.stale"
+
+// StaleCheckoutWebhookPayload is the JSON body of the stale checkout webhooks.
+type StaleCheckoutWebhookPayload struct {
+	Event          string     `json:"event"`
+	TemplateHash   string     `json:"templateHash"`
+	ID             int        `json:"id"`
+	Database       string     `json:"database"`
+	Holder         string     `json:"holder,omitempty"` // empty if unknown (see pool.WithHolder)
+	CheckedOutAt   time.Time  `json:"checkedOutAt"`
+	DurationMs     int64      `json:"durationMs"`
+	ThresholdMs    int64      `json:"thresholdMs"`
+	LeaseExpiresAt *time.Time `json:"leaseExpiresAt"` // nil if the test database is never auto-cleaned (overflow)
+	Message        string     `json:"message"`
+	Time           time.Time  `json:"time"`
+}
+
+type staleCheckoutKey struct {
+	hash         string
+	id           int
+	checkedOutAt time.Time
+}
+
+// staleCheckouts tracks the checkouts currently alerted as stale, so each checkout is only alerted once.
+type staleCheckouts struct {
+	alerted map[staleCheckoutKey]bool
+	mutex   sync.Mutex
+}
+
+// Swap replaces the currently stale checkouts, returns the previous ones.
+func (s *staleCheckouts) Swap(stale map[staleCheckoutKey]bool) map[staleCheckoutKey]bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	previous := s.alerted
+	s.alerted = stale
+
+	return previous
+}
+
+// staleCheckoutAlertAfter returns the alert threshold of the template, 0 if disabled.
+func (m Manager) staleCheckoutAlertAfter(options templates.TemplateOptions) time.Duration {
+	if options.StaleCheckoutAlertAfter > 0 {
+		return options.StaleCheckoutAlertAfter
+	}
+
+	return m.config.StaleCheckoutAlertAfter
+}
+
+// runStaleCheckoutCheck periodically alerts stale checkouts until the ctx is done. Unlike maintenance tasks, it isn't
+// restricted by the maintenance schedule (it doesn't touch any database).
+func (m Manager) runStaleCheckoutCheck(ctx context.Context) error {
+	interval := m.config.StaleCheckoutCheckInterval
+	if interval < minStaleCheckoutCheckInterval {
+		interval = minStaleCheckoutCheckInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case now := <-ticker.C:
+			m.checkStaleCheckouts(ctx, now)
+		}
+	}
+}
+
+// checkStaleCheckouts alerts test databases checked out longer than the threshold of their template, whose lease
+// expired (renewals are heartbeats of tests still running). Each checkout is alerted once via an event and the
+// webhooks of the manager and the template, typically catching stuck CI jobs silently holding capacity.
+func (m Manager) checkStaleCheckouts(ctx context.Context, now time.Time) {
+
+	type staleCheckout struct {
+		pool.Checkout
+		key       staleCheckoutKey
+		options   templates.TemplateOptions
+		threshold time.Duration
+	}
+
+	stale := make(map[staleCheckoutKey]bool)
+	var checkouts []staleCheckout
+
+	for _, checkout := range m.pool.Checkouts(ctx) {
+		template, found := m.templates.Get(ctx, checkout.TemplateHash)
+		if !found {
+			continue
+		}
+
+		options := template.GetConfig(ctx).Options
+		threshold := m.staleCheckoutAlertAfter(options)
+
+		if threshold <= 0 || now.Sub(checkout.CheckedOutAt) < threshold || checkout.LeaseExpiresAt.After(now) {
+			continue
+		}
+
+		key := staleCheckoutKey{hash: checkout.TemplateHash, id: checkout.ID, checkedOutAt: checkout.CheckedOutAt}
+		stale[key] = true
+		checkouts = append(checkouts, staleCheckout{Checkout: checkout, key: key, options: options, threshold: threshold})
+	}
+
+	// returned checkouts are dropped, alerted ones are kept
+	previous := m.staleCheckouts.Swap(stale)
+
+	for _, checkout := range checkouts {
+		if !previous[checkout.key] {
+			m.alertStaleCheckout(ctx, checkout.Checkout, checkout.options, checkout.threshold, now)
+		}
+	}
+}
+
+func (m Manager) alertStaleCheckout(ctx context.Context, checkout pool.Checkout, options templates.TemplateOptions, threshold time.Duration, now time.Time) {
+	duration := now.Sub(checkout.CheckedOutAt)
+	dbName := checkout.Database.Config.Database
+
+	holder := checkout.Holder
+	if len(holder) == 0 {
+		holder = "an unknown holder"
+	}
+
+	message := fmt.Sprintf("database %s checked out for %v by %s (threshold %v)", dbName, duration.Round(time.Millisecond), holder, threshold)
+
+	log := m.getManagerLogger(ctx, "alertStaleCheckout")
+	log.Warn().Str("hash", checkout.TemplateHash).Int("id", checkout.ID).Str("holder", checkout.Holder).Dur("duration", duration).Dur("threshold", threshold).Msg(message)
+
+	m.events.Emit(events.Event{
+		Type:    events.TypeStaleCheckout,
+		Hash:    checkout.TemplateHash,
+		Message: message,
+		Fields: map[string]interface{}{
+			"id":          checkout.ID,
+			"dbName":      dbName,
+			"holder":      checkout.Holder,
+			"durationMs":  duration.Milliseconds(),
+			"thresholdMs": threshold.Milliseconds(),
+		},
+	})
+
+	payload := StaleCheckoutWebhookPayload{
+		Event:        StaleCheckoutWebhook,
+		TemplateHash: checkout.TemplateHash,
+		ID:           checkout.ID,
+		Database:     dbName,
+		Holder:       checkout.Holder,
+		CheckedOutAt: checkout.CheckedOutAt,
+		DurationMs:   duration.Milliseconds(),
+		ThresholdMs:  threshold.Milliseconds(),
+		Message:      message,
+		Time:         now,
+	}
+	if !checkout.LeaseExpiresAt.IsZero() {
+		leaseExpiresAt := checkout.LeaseExpiresAt
+		payload.LeaseExpiresAt = &leaseExpiresAt
+	}
+
+	m.sendWebhook(ctx, m.config.StaleCheckoutWebhook, payload.Event, payload.TemplateHash, payload)
+	if options.StaleCheckoutWebhook != m.config.StaleCheckoutWebhook {
+		m.sendWebhook(ctx, options.StaleCheckoutWebhook, payload.Event, payload.TemplateHash, payload)
+	}
+}
@@ -0,0 +1,194 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+var ErrStatsHistoryDisabled = errors.New("stats history is disabled")
+
+const (
+	taskStatsHistory = "STATS_HISTORY"
+
+	minStatsHistoryResolution = 10 * time.Millisecond
+)
+
+// StatsSample is a snapshot of the utilization of all pools, taken every StatsHistoryResolution.
+type StatsSample struct {
+	Time       time.Time `json:"time"`
+	Templates  int       `json:"templates"`
+	Ready      int       `json:"ready"`
+	Dirty      int       `json:"dirty"` // checked out or waiting to be auto-cleaned
+	Recreating int       `json:"recreating"`
+	Total      int       `json:"total"`
+	Overflow   int       `json:"overflow"`
+}
+
+// StatsTrendPoint aggregates the samples within a step of the trend (see Manager.StatsHistory): the mean of each
+// count and the peaks relevant for sizing the pools.
+type StatsTrendPoint struct {
+	Time    time.Time `json:"time"`    // start of the step
+	Samples int       `json:"samples"` // number of samples within the step
+
+	Templates  float64 `json:"templates"`
+	Ready      float64 `json:"ready"`
+	Dirty      float64 `json:"dirty"`
+	Recreating float64 `json:"recreating"`
+	Total      float64 `json:"total"`
+	Overflow   float64 `json:"overflow"`
+
+	MaxDirty    int `json:"maxDirty"`
+	MaxOverflow int `json:"maxOverflow"`
+	MinReady    int `json:"minReady"`
+}
+
+// statsHistory is a ring buffer of the most recent samples.
+type statsHistory struct {
+	samples []StatsSample
+	next    int  // index of the next sample, the oldest one once full
+	full    bool // all samples are set
+	mutex   sync.Mutex
+}
+
+func newStatsHistory(size int) *statsHistory {
+	if size < 1 {
+		size = 1
+	}
+
+	return &statsHistory{samples: make([]StatsSample, size)}
+}
+
+// Add adds the sample, replacing the oldest one once full.
+func (h *statsHistory) Add(sample StatsSample) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.samples[h.next] = sample
+	h.next = (h.next + 1) % len(h.samples)
+	if h.next == 0 {
+		h.full = true
+	}
+}
+
+// List returns all samples, oldest first.
+func (h *statsHistory) List() []StatsSample {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if !h.full {
+		return append([]StatsSample{}, h.samples[:h.next]...)
+	}
+
+	return append(append([]StatsSample{}, h.samples[h.next:]...), h.samples[:h.next]...)
+}
+
+// statsHistoryEnabled returns true if samples are taken, see StatsHistoryResolution and StatsHistoryRetention.
+func (m Manager) statsHistoryEnabled() bool {
+	return m.config.StatsHistoryResolution > 0 && m.config.StatsHistoryRetention > 0
+}
+
+// runStatsHistory periodically samples the utilization of all pools until the ctx is done. Like the runtime health
+// check it isn't restricted by the maintenance schedule, it doesn't touch any database.
+func (m Manager) runStatsHistory(ctx context.Context) error {
+	interval := m.config.StatsHistoryResolution
+	if interval < minStatsHistoryResolution {
+		interval = minStatsHistoryResolution
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case now := <-ticker.C:
+			m.statsHistory.Add(m.sampleStats(ctx, now))
+		}
+	}
+}
+
+// sampleStats sums up the current utilization of the pools of all templates.
+func (m Manager) sampleStats(ctx context.Context, now time.Time) StatsSample {
+	sample := StatsSample{Time: now}
+
+	for _, template := range m.templates.List(ctx) {
+		sample.Templates++
+
+		explanation, err := m.pool.ExplainGetTestDatabase(ctx, template.TemplateHash, false, nil)
+		if err != nil {
+			// no pool (yet), e.g. the template is still initializing
+			continue
+		}
+
+		sample.Ready += explanation.Ready
+		sample.Dirty += explanation.Dirty
+		sample.Recreating += explanation.Recreating
+		sample.Total += explanation.Total
+		sample.Overflow += explanation.Overflow
+	}
+
+	return sample
+}
+
+// StatsHistory returns the trend of the pool utilization since the given time (zero returns all retained samples),
+// downsampled into steps of the given duration (aligned to multiples of it). Steps of at most StatsHistoryResolution
+// return each sample as is. Returns ErrStatsHistoryDisabled if no samples are taken.
+func (m Manager) StatsHistory(_ context.Context, since time.Time, step time.Duration) ([]StatsTrendPoint, error) {
+	if m.statsHistory == nil {
+		return nil, ErrStatsHistoryDisabled
+	}
+
+	if step < m.config.StatsHistoryResolution {
+		step = 0
+	}
+
+	points := make([]StatsTrendPoint, 0)
+	for _, sample := range m.statsHistory.List() {
+		if sample.Time.Before(since) {
+			continue
+		}
+
+		start := sample.Time
+		if step > 0 {
+			start = sample.Time.Truncate(step)
+		}
+
+		if len(points) == 0 || !points[len(points)-1].Time.Equal(start) {
+			points = append(points, StatsTrendPoint{Time: start, MinReady: sample.Ready})
+		}
+
+		points[len(points)-1].add(sample)
+	}
+
+	return points, nil
+}
+
+// add adds the sample to the (running) means and peaks of the point.
+func (p *StatsTrendPoint) add(sample StatsSample) {
+	p.Samples++
+	n := float64(p.Samples)
+
+	mean := func(current float64, value int) float64 {
+		return current + (float64(value)-current)/n
+	}
+
+	p.Templates = mean(p.Templates, sample.Templates)
+	p.Ready = mean(p.Ready, sample.Ready)
+	p.Dirty = mean(p.Dirty, sample.Dirty)
+	p.Recreating = mean(p.Recreating, sample.Recreating)
+	p.Total = mean(p.Total, sample.Total)
+	p.Overflow = mean(p.Overflow, sample.Overflow)
+
+	if sample.Dirty > p.MaxDirty {
+		p.MaxDirty = sample.Dirty
+	}
+	if sample.Overflow > p.MaxOverflow {
+		p.MaxOverflow = sample.Overflow
+	}
+	if sample.Ready < p.MinReady {
+		p.MinReady = sample.Ready
+	}
+}
@@ -0,0 +1,154 @@
+package manager
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/allaboutapps/integresql/pkg/templates"
+	"github.com/allaboutapps/integresql/pkg/tracing"
+)
+
+var ErrTemplateBackupFailed = errors.New("failed to backup template database before discarding it")
+
+const templateBackupExt = ".dump"
+
+// backupTemplateDatabase dumps the template database (pg_dump custom format) to TemplateBackupDir/<hash>/<timestamp>.dump
+// and removes the oldest backups of this hash exceeding TemplateBackupRetention afterwards.
+// Restore a backup via pg_restore --dbname=<db> <file>.
+func (m Manager) backupTemplateDatabase(ctx context.Context, hash string, dbName string) (string, error) {
+
+	defer tracing.Region(ctx, "backup_template_db").End()
+
+	log := m.getManagerLogger(ctx, "backupTemplateDatabase").With().Str("hash", hash).Str("dbName", dbName).Logger()
+
+	// the hash is provided by clients, never allow it to escape the backup dir
+	if len(hash) == 0 || hash == "." || hash == ".." || strings.ContainsAny(hash, `/\`) {
+		return "", fmt.Errorf("%w: invalid hash %q for a backup directory", ErrTemplateBackupFailed, hash)
+	}
+
+	dir := filepath.Join(m.config.TemplateBackupDir, hash)
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return "", fmt.Errorf("%w: %v", ErrTemplateBackupFailed, err)
+	}
+
+	path := filepath.Join(dir, time.Now().UTC().Format("20060102T150405.000000000Z")+templateBackupExt)
+	tmpPath := path + ".tmp"
+
+	if err := m.dumpDatabase(ctx, dbName, tmpPath); err != nil {
+		_ = os.Remove(tmpPath)
+		return "", fmt.Errorf("%w: %v", ErrTemplateBackupFailed, err)
+	}
+
+	// only complete backups get the final name
+	if err := os.Rename(tmpPath, path); err != nil {
+		_ = os.Remove(tmpPath)
+		return "", fmt.Errorf("%w: %v", ErrTemplateBackupFailed, err)
+	}
+
+	log.Info().Str("path", path).Msg("template database backed up")
+
+	if err := pruneTemplateBackups(dir, m.config.TemplateBackupRetention); err != nil {
+		// the backup itself succeeded, don't fail the discard
+		log.Warn().Err(err).Msg("failed to remove old template backups")
+	}
+
+	return path, nil
+}
+
+// dumpDatabase dumps the database of the manager cluster (pg_dump custom format) to the file at path.
+func (m Manager) dumpDatabase(ctx context.Context, dbName string, path string) error {
+
+	log := m.getManagerLogger(ctx, "dumpDatabase").With().Str("dbName", dbName).Logger()
+
+	config := m.config.TargetDatabaseConfig
+	config.Database = dbName
+
+	dump := exec.CommandContext(ctx, m.config.PgDumpPath, append(pgToolConnectionArgs(config), "--format=custom", "--file", path)...) // #nosec G204 - binary path is provided via config
+	dump.Env = pgToolEnv(config)
+
+	var stderr bytes.Buffer
+	dump.Stderr = &stderr
+
+	if err := dump.Run(); err != nil {
+		log.Error().Err(err).Str("stderr", stderr.String()).Msg("pg_dump failed")
+		return fmt.Errorf("pg_dump failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	return nil
+}
+
+// pruneTemplateBackups removes the oldest backups within the dir, keeping the given number of most recent ones (<= 0 keeps all).
+func pruneTemplateBackups(dir string, keep int) error {
+	if keep <= 0 {
+		return nil
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	backups := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), templateBackupExt) {
+			backups = append(backups, entry.Name())
+		}
+	}
+
+	if len(backups) <= keep {
+		return nil
+	}
+
+	// names are UTC timestamps, thus sorting them lexically sorts them by time
+	sort.Strings(backups)
+
+	var errs []error
+	for _, name := range backups[:len(backups)-keep] {
+		if err := os.Remove(filepath.Join(dir, name)); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// backupTemplateBeforeDiscard backs up the template database of the hash if it is worth it: Ephemeral and not yet finalized
+// templates are skipped, untracked template databases (e.g. after a restart) are backed up if they exist.
+func (m Manager) backupTemplateBeforeDiscard(ctx context.Context, hash string) error {
+	dbName := m.makeTemplateDatabaseName(hash)
+
+	template, found := m.templates.Get(ctx, hash)
+	if found {
+		config := template.GetConfig(ctx)
+		if config.Options.Ephemeral || template.GetState(ctx) != templates.TemplateStateFinalized {
+			return nil
+		}
+		dbName = config.Database
+	}
+
+	exists, err := m.checkDatabaseExists(ctx, dbName)
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		// nothing to backup, discarding will report the template as not found
+		return nil
+	}
+
+	_, err = m.backupTemplateDatabase(ctx, hash, dbName)
+	return err
+}
+
+// templateBackupConfigured returns true if templates should be backed up before discarding them.
+func (m Manager) templateBackupConfigured() bool {
+	return len(m.config.TemplateBackupDir) > 0
+}
@@ -0,0 +1,83 @@
+package manager
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/allaboutapps/integresql/pkg/templates"
+	"github.com/allaboutapps/integresql/pkg/tracing"
+	"github.com/lib/pq"
+)
+
+// The md5 of all rows of a table (in their text representation, sorted), computed server side. Like the fingerprint,
+// this is meant for the typically small seed tables of a template.
+const tableChecksumQuery = `SELECT md5(coalesce(string_agg(t::text, E'\n' ORDER BY t::text), '')) FROM %s AS t`
+
+// syntax errors and access rule violations, e.g. undefined tables
+const pqClassSyntaxErrorOrAccessRuleViolation = "42"
+
+// validateChecksumTables rejects empty or malformed table names of templates.TemplateOptions.ChecksumTables.
+func validateChecksumTables(tables []string) error {
+	for i, table := range tables {
+		parts := strings.Split(table, ".")
+		if len(parts) > 2 {
+			return fmt.Errorf("%w: checksum table %q is not a (schema qualified) table name", ErrInvalidTemplateOptions, table)
+		}
+
+		for _, part := range parts {
+			if len(strings.TrimSpace(part)) == 0 {
+				return fmt.Errorf("%w: checksum table %d is empty", ErrInvalidTemplateOptions, i)
+			}
+		}
+	}
+
+	return nil
+}
+
+// checksumTemplate computes the checksum of the ChecksumTables of the template: the SHA-256 over the md5 of the rows
+// of each table (sorted by table name), thus it changes as soon as any row of them differs. Returns an empty checksum
+// if the template has no ChecksumTables.
+func (m Manager) checksumTemplate(ctx context.Context, template *templates.Template) (string, error) {
+	tables := append([]string(nil), template.TemplateConfig.Options.ChecksumTables...)
+	if len(tables) == 0 {
+		return "", nil
+	}
+
+	defer tracing.Region(ctx, "checksum_template_db").End()
+
+	conn, err := sql.Open("postgres", template.Config.ConnectionString())
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	sort.Strings(tables)
+
+	hash := sha256.New()
+	for _, table := range tables {
+		parts := strings.Split(table, ".")
+		for i, part := range parts {
+			parts[i] = pq.QuoteIdentifier(strings.TrimSpace(part))
+		}
+
+		var sum string
+		if err := conn.QueryRowContext(ctx, fmt.Sprintf(tableChecksumQuery, strings.Join(parts, "."))).Scan(&sum); err != nil {
+			var pqErr *pq.Error
+			if errors.As(err, &pqErr) && pqErr.Code.Class() == pqClassSyntaxErrorOrAccessRuleViolation {
+				return "", fmt.Errorf("%w: checksumming table %s failed: %v", ErrInvalidTemplateOptions, table, err)
+			}
+
+			return "", fmt.Errorf("checksumming table %s of template %s failed: %w", table, template.Config.Database, err)
+		}
+
+		fmt.Fprintf(hash, "%s=%s\n", table, sum)
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
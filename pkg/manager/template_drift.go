@@ -0,0 +1,303 @@
+package manager
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/allaboutapps/integresql/pkg/events"
+	"github.com/allaboutapps/integresql/pkg/pool"
+	"github.com/allaboutapps/integresql/pkg/templates"
+	"github.com/allaboutapps/integresql/pkg/tracing"
+)
+
+const (
+	taskTemplateDriftCheck = "TEMPLATE_DRIFT_CHECK"
+
+	minTemplateDriftCheckInterval = 10 * time.Millisecond
+)
+
+// One row per user table: its columns (name and type) and the number of rows. Counting is cheap for the typically
+// small template databases, the connection is short-lived as cloning the template requires it to be unused
+// (CREATE DATABASE waits a few seconds for other connections to the template to vanish).
+const templateFingerprintQuery = `SELECT format('%s.%s(%s)=%s', n.nspname, c.relname,
+		(SELECT string_agg(format('%s %s', a.attname, format_type(a.atttypid, a.atttypmod)), ',' ORDER BY a.attnum)
+			FROM pg_attribute a WHERE a.attrelid = c.oid AND a.attnum > 0 AND NOT a.attisdropped),
+		(xpath('/row/count/text()', query_to_xml(format('SELECT count(*) FROM %I.%I', n.nspname, c.relname), false, true, '')))[1]::text)
+	FROM pg_class c JOIN pg_namespace n ON n.oid = c.relnamespace
+	WHERE c.relkind IN ('r', 'p') AND n.nspname NOT IN ('pg_catalog', 'information_schema') AND n.nspname NOT LIKE 'pg_toast%'
+	ORDER BY n.nspname, c.relname`
+
+// templateFingerprint describes the schema and row counts of a template database, one entry per table (sorted).
+type templateFingerprint []string
+
+// table returns the qualified table name of the fingerprint entry.
+func (templateFingerprint) table(entry string) string {
+	if i := strings.Index(entry, "("); i >= 0 {
+		return entry[:i]
+	}
+
+	return entry
+}
+
+// diff returns the tables added, removed or changed (columns or row count) compared to the other fingerprint.
+func (f templateFingerprint) diff(other templateFingerprint) []string {
+	entries := make(map[string]string, len(f))
+	for _, entry := range f {
+		entries[f.table(entry)] = entry
+	}
+
+	changed := make([]string, 0)
+	for _, entry := range other {
+		table := f.table(entry)
+		if previous, ok := entries[table]; !ok || previous != entry {
+			changed = append(changed, table)
+		}
+		delete(entries, table)
+	}
+
+	for table := range entries {
+		changed = append(changed, table)
+	}
+
+	sort.Strings(changed)
+	return changed
+}
+
+type capturedFingerprint struct {
+	template    *templates.Template // the fingerprint only applies to this very template (not to a reinitialized one with the same hash)
+	fingerprint templateFingerprint
+}
+
+// fingerprintRegistry holds the fingerprints of finalized templates to detect later writes to them.
+type fingerprintRegistry struct {
+	fingerprints map[string]capturedFingerprint // map[hash]
+	drifts       int                            // total number of detected drifts
+	mutex        sync.Mutex
+}
+
+func newFingerprintRegistry() *fingerprintRegistry {
+	return &fingerprintRegistry{fingerprints: make(map[string]capturedFingerprint)}
+}
+
+func (r *fingerprintRegistry) Get(template *templates.Template) (templateFingerprint, bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	captured, ok := r.fingerprints[template.TemplateHash]
+	if !ok || captured.template != template {
+		return nil, false
+	}
+
+	return captured.fingerprint, true
+}
+
+func (r *fingerprintRegistry) Set(template *templates.Template, fingerprint templateFingerprint) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.fingerprints[template.TemplateHash] = capturedFingerprint{template: template, fingerprint: fingerprint}
+}
+
+func (r *fingerprintRegistry) RecordDrift() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.drifts++
+}
+
+func (r *fingerprintRegistry) Drifts() int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.drifts
+}
+
+// Retain removes the fingerprints of all templates not part of the given ones (e.g. discarded in the meantime).
+func (r *fingerprintRegistry) Retain(tracked []*templates.Template) {
+	keep := make(map[*templates.Template]bool, len(tracked))
+	for _, template := range tracked {
+		keep[template] = true
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for hash, captured := range r.fingerprints {
+		if !keep[captured.template] {
+			delete(r.fingerprints, hash)
+		}
+	}
+}
+
+// templateDriftCheckEnabled returns true if finalized templates should be checked for drift.
+func (m Manager) templateDriftCheckEnabled() bool {
+	return m.config.TemplateDriftCheckInterval > 0
+}
+
+// captureTemplateFingerprint captures the fingerprint of the template (typically while finalizing it), which
+// later checks compare against. Failures are logged only, the next check captures the fingerprint then.
+func (m Manager) captureTemplateFingerprint(ctx context.Context, template *templates.Template) {
+	fingerprint, err := m.fingerprintTemplate(ctx, template)
+	if err != nil {
+		log := m.getManagerLogger(ctx, "captureTemplateFingerprint").With().Str("hash", template.TemplateHash).Logger()
+		log.Warn().Err(err).Msg("capturing the template fingerprint failed, deferring it to the next drift check")
+		return
+	}
+
+	m.fingerprints.Set(template, fingerprint)
+}
+
+func (m Manager) fingerprintTemplate(ctx context.Context, template *templates.Template) (templateFingerprint, error) {
+
+	defer tracing.Region(ctx, "fingerprint_template_db").End()
+
+	conn, err := sql.Open("postgres", template.Config.ConnectionString())
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	rows, err := conn.QueryContext(ctx, templateFingerprintQuery)
+	if err != nil {
+		return nil, fmt.Errorf("fingerprinting template %s failed: %w", template.Config.Database, err)
+	}
+	defer rows.Close()
+
+	fingerprint := templateFingerprint{}
+	for rows.Next() {
+		var entry string
+		if err := rows.Scan(&entry); err != nil {
+			return nil, err
+		}
+
+		fingerprint = append(fingerprint, entry)
+	}
+
+	return fingerprint, rows.Err()
+}
+
+// runTemplateDriftCheck periodically compares the fingerprints of all finalized templates against the ones captured
+// while finalizing them until the ctx is done. Errors of single runs are reported to the background supervisor.
+// Runs outside of the maintenance schedule (see pool.PoolConfig.Maintenance) are skipped.
+func (m Manager) runTemplateDriftCheck(ctx context.Context) error {
+	interval := m.config.TemplateDriftCheckInterval
+	if interval < minTemplateDriftCheckInterval {
+		interval = minTemplateDriftCheckInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case now := <-ticker.C:
+			if m.config.PoolConfig.Maintenance.Allowed(now) {
+				m.background.Report(taskTemplateDriftCheck, m.checkTemplateDrift(ctx))
+			}
+		}
+	}
+}
+
+// checkTemplateDrift detects finalized templates, which were written to since their fingerprint was captured
+// (their test databases would silently differ from what the testrunner set up). Each drift is emitted as event and,
+// with TemplateDriftQuarantine, the template is quarantined.
+func (m Manager) checkTemplateDrift(ctx context.Context) error {
+
+	log := m.getManagerLogger(ctx, "checkTemplateDrift")
+
+	tracked := m.templates.List(ctx)
+	m.fingerprints.Retain(tracked)
+
+	var errs []error
+
+	for _, template := range tracked {
+		if template.GetState(ctx) != templates.TemplateStateFinalized {
+			continue
+		}
+
+		hash := template.TemplateHash
+
+		current, err := m.fingerprintTemplate(ctx, template)
+		if err != nil {
+			// discarded in the meantime
+			if template.GetState(ctx) != templates.TemplateStateFinalized {
+				continue
+			}
+
+			errs = append(errs, err)
+			continue
+		}
+
+		captured, ok := m.fingerprints.Get(template)
+		if !ok {
+			m.fingerprints.Set(template, current)
+			continue
+		}
+
+		changed := captured.diff(current)
+		if len(changed) == 0 {
+			continue
+		}
+
+		// alert once per drift, further writes are compared against the drifted state
+		m.fingerprints.Set(template, current)
+		m.fingerprints.RecordDrift()
+
+		log.Error().Str("hash", hash).Strs("tables", changed).Bool("quarantine", m.config.TemplateDriftQuarantine).Msg("template was modified after it was finalized!")
+
+		m.events.Emit(events.Event{
+			Type:    events.TypeTemplateDrift,
+			Hash:    hash,
+			Message: fmt.Sprintf("template %s was modified after it was finalized, changed tables: %s", hash, strings.Join(changed, ", ")),
+			Fields: map[string]interface{}{
+				"tables":      changed,
+				"quarantined": m.config.TemplateDriftQuarantine,
+			},
+		})
+
+		if m.config.TemplateDriftQuarantine {
+			if err := m.quarantineTemplate(ctx, template); err != nil {
+				errs = append(errs, fmt.Errorf("failed to quarantine template %s: %w", hash, err))
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// quarantineTemplate stops handing out test databases of the drifted template: the template is untracked (thus
+// reinitialized by the next testrunner) and all of its test databases are removed, as they might be cloned from the
+// drifted state already. The template database itself is kept for investigation until the hash is reinitialized.
+func (m Manager) quarantineTemplate(ctx context.Context, template *templates.Template) error {
+	hash := template.TemplateHash
+
+	if current, found := m.templates.Get(ctx, hash); !found || current != template {
+		// discarded or reinitialized in the meantime, nothing to quarantine
+		return nil
+	}
+
+	// block new acquisitions before removing any DB with this hash
+	m.aliases.RemoveHash(hash)
+	m.templates.Pop(ctx, hash)
+	template.SetState(ctx, templates.TemplateStateDiscarded)
+
+	err := m.pool.RemoveAllWithHash(ctx, hash, m.dropTestPoolDB)
+	if err != nil && !errors.Is(err, pool.ErrUnknownHash) {
+		return err
+	}
+
+	// cloned from the drifted state as well
+	if err := m.dropTemplateReplicas(ctx, hash); err != nil {
+		return err
+	}
+
+	return m.dropShardTemplateCopies(ctx, hash)
+}
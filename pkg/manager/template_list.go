@@ -0,0 +1,69 @@
+package manager
+
+import (
+	"context"
+	"time"
+
+	"github.com/allaboutapps/integresql/pkg/pool"
+)
+
+// TrackedTemplate summarizes a template currently tracked by the manager, see ListTemplates.
+type TrackedTemplate struct {
+	Hash          string    `json:"hash"`
+	State         string    `json:"state"`
+	Database      string    `json:"database"`
+	InitializedAt time.Time `json:"initializedAt"`
+
+	// nil until the pool of the template is initialized (with finalizing the template)
+	Pool *TemplatePoolSummary `json:"pool"`
+}
+
+// TemplatePoolSummary is the current number of test databases of a pool by state, a shortcut of its pool.Stats.
+type TemplatePoolSummary struct {
+	Ready      int           `json:"ready"`
+	Dirty      int           `json:"dirty"` // checked out or waiting to be auto-cleaned
+	InUse      int           `json:"inUse"` // dirty ones currently checked out by clients
+	Recreating int           `json:"recreating"`
+	Frozen     int           `json:"frozen"`
+	Overflow   int           `json:"overflow"`
+	Size       pool.PoolSize `json:"size"`
+}
+
+// ListTemplates returns all templates currently tracked by the manager ordered by their hash, along with a summary of
+// their pools.
+func (m Manager) ListTemplates(ctx context.Context) ([]TrackedTemplate, error) {
+	if !m.Ready() {
+		return nil, ErrManagerNotReady
+	}
+
+	pools := make(map[string]pool.Stats)
+	for _, stats := range m.pool.Stats(ctx) {
+		pools[stats.TemplateHash] = stats
+	}
+
+	list := make([]TrackedTemplate, 0)
+	for _, template := range m.templates.List(ctx) {
+		tracked := TrackedTemplate{
+			Hash:          template.TemplateHash,
+			State:         template.GetState(ctx).String(),
+			Database:      template.GetConfig(ctx).Database,
+			InitializedAt: template.InitializedAt,
+		}
+
+		if stats, ok := pools[template.TemplateHash]; ok {
+			tracked.Pool = &TemplatePoolSummary{
+				Ready:      stats.Ready,
+				Dirty:      stats.Dirty,
+				InUse:      stats.InUse,
+				Recreating: stats.Recreating,
+				Frozen:     len(stats.Frozen),
+				Overflow:   stats.Overflow,
+				Size:       stats.Size,
+			}
+		}
+
+		list = append(list, tracked)
+	}
+
+	return list, nil
+}
@@ -0,0 +1,148 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/allaboutapps/integresql/pkg/db"
+	"github.com/allaboutapps/integresql/pkg/events"
+	"github.com/allaboutapps/integresql/pkg/oci"
+	"github.com/allaboutapps/integresql/pkg/templates"
+	"github.com/allaboutapps/integresql/pkg/tracing"
+)
+
+const backgroundTaskOCIExport = "OCI_EXPORT"
+
+// ociExportEnabled returns true if the finalized template should be pushed to the registry: Ephemeral templates and
+// templates pulled from the registry themselves are skipped.
+func (m Manager) ociExportEnabled(options templates.TemplateOptions) bool {
+	return m.oci != nil && m.config.OCIExport && !options.Ephemeral && options.Source() != templates.TemplateSourceOCI
+}
+
+// exportTemplate dumps the template database and pushes the dump as artifact tagged with the hash in background.
+// Only the dump runs in the foreground, as connecting to the template once cloning started delays clones.
+// A failed export is reported as failed background task, the template stays usable.
+func (m Manager) exportTemplate(ctx context.Context, template *templates.Template) {
+
+	defer tracing.Region(ctx, "export_template_db").End()
+
+	hash := template.TemplateHash
+	log := m.getManagerLogger(ctx, "exportTemplate").With().Str("hash", hash).Logger()
+
+	if err := oci.ValidTag(hash); err != nil {
+		log.Warn().Err(err).Msg("skipping export, the hash can't be used as tag")
+		return
+	}
+
+	tmp, err := os.CreateTemp("", "integresql-export-*.dump")
+	if err != nil {
+		m.background.Report(backgroundTaskOCIExport, err)
+		return
+	}
+	tmp.Close()
+
+	if err := m.dumpDatabase(ctx, template.Database.Config.Database, tmp.Name()); err != nil {
+		_ = os.Remove(tmp.Name())
+		m.background.Report(backgroundTaskOCIExport, fmt.Errorf("exporting template %s failed: %w", hash, err))
+		return
+	}
+
+	started := m.background.Go(backgroundTaskOCIExport, func(ctx context.Context) error {
+		defer os.Remove(tmp.Name())
+
+		digest, err := m.oci.Push(ctx, hash, tmp.Name())
+		if err != nil {
+			return fmt.Errorf("exporting template %s failed: %w", hash, err)
+		}
+
+		log.Info().Str("digest", digest).Msg("template exported")
+
+		m.events.Emit(events.Event{
+			Type:    events.TypeTemplateExported,
+			Hash:    hash,
+			Message: fmt.Sprintf("template %s was pushed as %s:%s", hash, m.config.OCI.Repository, hash),
+			Fields: map[string]interface{}{
+				"repository": m.config.OCI.Repository,
+				"digest":     digest,
+			},
+		})
+
+		return nil
+	})
+
+	if !started {
+		_ = os.Remove(tmp.Name())
+		log.Warn().Msg("skipping export, the manager is disconnecting")
+	}
+}
+
+// restoreArtifact restores the dump of the artifact with the tag into the target database, pulling it on first use.
+// Pulled dumps are cached within TemplateDumpDir/oci (or the temp dir) by tag, tags are considered immutable (like hashes).
+func (m Manager) restoreArtifact(ctx context.Context, tag string, target db.DatabaseConfig) error {
+
+	defer tracing.Region(ctx, "restore_artifact").End()
+
+	log := m.getManagerLogger(ctx, "restoreArtifact").With().Str("tag", tag).Str("target", target.Database).Logger()
+
+	dir := filepath.Join(os.TempDir(), "integresql-oci")
+	if len(m.config.TemplateDumpDir) > 0 {
+		dir = filepath.Join(m.config.TemplateDumpDir, "oci")
+	}
+
+	// the tag was validated, it never escapes the dir
+	path := filepath.Join(dir, tag+templateBackupExt)
+
+	if _, err := os.Stat(path); err == nil {
+		log.Debug().Str("path", path).Msg("using cached artifact")
+	} else {
+		if err := m.oci.Pull(ctx, tag, path); err != nil {
+			if errors.Is(err, oci.ErrNotFound) {
+				return fmt.Errorf("%w: %w", ErrInvalidTemplateOptions, err)
+			}
+
+			return err
+		}
+
+		log.Info().Str("path", path).Msg("artifact pulled")
+	}
+
+	if err := m.restoreDumpFile(ctx, path, target); err != nil {
+		// maybe a corrupted cache, the next attempt pulls it again
+		_ = os.Remove(path)
+		return err
+	}
+
+	return nil
+}
+
+// initializeTemplateFromRegistry initializes the unknown template from the artifact tagged with its hash (see
+// OCIPullOnAcquire). Returns ErrTemplateNotFound if there is no such artifact.
+func (m Manager) initializeTemplateFromRegistry(ctx context.Context, hash string) (*templates.Template, error) {
+
+	log := m.getManagerLogger(ctx, "initializeTemplateFromRegistry").With().Str("hash", hash).Logger()
+
+	if oci.ValidTag(hash) != nil {
+		return nil, ErrTemplateNotFound
+	}
+
+	_, err := m.InitializeTemplateDatabaseWithOptions(ctx, hash, templates.TemplateOptions{SourceKind: templates.TemplateSourceOCI})
+	if errors.Is(err, oci.ErrNotFound) {
+		return nil, ErrTemplateNotFound
+	}
+
+	// concurrently initialized, e.g. by another acquisition
+	if err != nil && !errors.Is(err, ErrTemplateAlreadyInitialized) {
+		log.Error().Err(err).Msg("pulling template failed")
+		return nil, err
+	}
+
+	template, found := m.templates.Get(ctx, hash)
+	if !found {
+		return nil, ErrTemplateNotFound
+	}
+
+	return template, nil
+}
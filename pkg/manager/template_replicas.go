@@ -0,0 +1,172 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/allaboutapps/integresql/pkg/templates"
+	"github.com/allaboutapps/integresql/pkg/tracing"
+)
+
+const taskTemplateReplicas = "TEMPLATE_REPLICAS"
+
+// templateReplicaRegistry tracks the replicas of finalized templates (see TemplateReplicas) and distributes the clones
+// of their test databases round-robin across the template and its replicas.
+type templateReplicaRegistry struct {
+	replicas map[string][]string // map[hash]replica database names, ready to be cloned
+	next     map[string]int      // map[hash]index of the next clone source
+	mutex    sync.Mutex
+}
+
+func newTemplateReplicaRegistry() *templateReplicaRegistry {
+	return &templateReplicaRegistry{
+		replicas: make(map[string][]string),
+		next:     make(map[string]int),
+	}
+}
+
+// Add registers the (created) replica of the template with the hash as clone source.
+func (r *templateReplicaRegistry) Add(hash string, replica string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.replicas[hash] = append(r.replicas[hash], replica)
+}
+
+// Remove unregisters and returns all replicas of the template with the hash, further clones use the template again.
+func (r *templateReplicaRegistry) Remove(hash string) []string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	replicas := r.replicas[hash]
+	delete(r.replicas, hash)
+	delete(r.next, hash)
+
+	return replicas
+}
+
+// RemoveAll unregisters and returns the replicas of all templates.
+func (r *templateReplicaRegistry) RemoveAll() []string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	var replicas []string
+	for _, names := range r.replicas {
+		replicas = append(replicas, names...)
+	}
+
+	r.replicas = make(map[string][]string)
+	r.next = make(map[string]int)
+
+	return replicas
+}
+
+// List returns the number of replicas per template hash.
+func (r *templateReplicaRegistry) List() map[string]int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	counts := make(map[string]int, len(r.replicas))
+	for hash, replicas := range r.replicas {
+		counts[hash] = len(replicas)
+	}
+
+	return counts
+}
+
+// NextSource returns the database the next test database of the template with the hash is cloned from.
+func (r *templateReplicaRegistry) NextSource(hash string, template string) string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	replicas := r.replicas[hash]
+	if len(replicas) == 0 {
+		return template
+	}
+
+	i := r.next[hash] % (len(replicas) + 1)
+	r.next[hash] = i + 1
+
+	if i == 0 {
+		return template
+	}
+
+	return replicas[i-1]
+}
+
+func (m Manager) makeTemplateReplicaName(hash string, i int) string {
+	return fmt.Sprintf("%s_replica_%s_%d", m.config.DatabasePrefix, hash, i)
+}
+
+// createTemplateReplicas clones the TemplateReplicas of the finalized template in background, each one is used as
+// clone source as soon as it's created.
+func (m Manager) createTemplateReplicas(ctx context.Context, template *templates.Template) {
+	if m.config.TemplateReplicas <= 0 {
+		return
+	}
+
+	hash := template.TemplateHash
+	templateDB := template.Config.Database
+
+	log := m.getManagerLogger(ctx, "createTemplateReplicas").With().Str("hash", hash).Logger()
+
+	// truncated names might collide with the replicas of other templates
+	if name := m.makeTemplateReplicaName(hash, m.config.TemplateReplicas); len(name) > maxIdentifierLength {
+		log.Warn().Str("dbName", name).Msg("replica database name too long, not replicating the template")
+		return
+	}
+
+	started := m.background.Go(taskTemplateReplicas, func(ctx context.Context) error {
+		for i := 1; i <= m.config.TemplateReplicas; i++ {
+			replica := m.makeTemplateReplicaName(hash, i)
+
+			reg := tracing.Region(ctx, "create_template_replica")
+			err := m.dropAndCreateDatabase(withCloneOptions(ctx, templateCloneOptions(template.Options)), replica, m.config.TargetDatabaseConfig.Username, templateDB)
+			reg.End()
+			if err != nil {
+				return fmt.Errorf("replicating template %s failed: %w", hash, err)
+			}
+
+			// discarded (or reinitialized) meanwhile, TeardownTemplate didn't know about this replica yet
+			if current, found := m.templates.Get(ctx, hash); !found || current != template || current.GetState(ctx) != templates.TemplateStateFinalized {
+				log.Debug().Str("dbName", replica).Msg("template gone, dropping replica")
+				return m.dropDatabase(ctx, replica)
+			}
+
+			m.replicas.Add(hash, replica)
+			log.Debug().Str("dbName", replica).Msg("replica created")
+		}
+
+		log.Info().Int("replicas", m.config.TemplateReplicas).Msg("template replicated")
+
+		return nil
+	})
+
+	if !started {
+		log.Warn().Msg("manager is disconnecting, not replicating the template")
+	}
+}
+
+// dropTemplateReplicas unregisters and drops all replicas of the template with the hash.
+func (m Manager) dropTemplateReplicas(ctx context.Context, hash string) error {
+	return m.dropReplicas(ctx, m.replicas.Remove(hash))
+}
+
+// dropAllTemplateReplicas unregisters and drops the replicas of all templates.
+func (m Manager) dropAllTemplateReplicas(ctx context.Context) error {
+	return m.dropReplicas(ctx, m.replicas.RemoveAll())
+}
+
+func (m Manager) dropReplicas(ctx context.Context, replicas []string) error {
+	var errs []error
+	for _, replica := range replicas {
+		// clones from the replica might still be in progress
+		if err := m.dropTemplateDatabase(ctx, replica); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,59 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/allaboutapps/integresql/pkg/events"
+)
+
+var ErrTemplateNamespaceConflict = errors.New("template is tracked by another namespace")
+
+// checkTemplateSharing returns ErrTemplateNamespaceConflict if the template with the given hash is already tracked by
+// another namespace, unless both namespaces share their templates (see TemplateSharingNamespaces). Shared templates are
+// backed by the single template database and pool of the namespace initializing it first (the others get
+// ErrTemplateAlreadyInitialized), a TEMPLATE_SHARED event is recorded.
+func (m Manager) checkTemplateSharing(ctx context.Context, hash string, namespace string) error {
+	template, found := m.templates.Get(ctx, hash)
+	if !found {
+		return nil
+	}
+
+	owner := template.GetConfig(ctx).Options.Namespace
+	if owner == namespace {
+		return nil
+	}
+
+	log := m.getManagerLogger(ctx, "checkTemplateSharing").With().Str("hash", hash).Str("namespace", namespace).Str("owner", owner).Logger()
+
+	if !m.sharesTemplates(owner) || !m.sharesTemplates(namespace) {
+		log.Warn().Msg("template is tracked by another namespace")
+		return fmt.Errorf("%w: hash %q isn't shared with namespace %q", ErrTemplateNamespaceConflict, hash, namespace)
+	}
+
+	log.Debug().Msg("sharing template of another namespace")
+
+	m.events.Emit(events.Event{
+		Type:    events.TypeTemplateShared,
+		Hash:    hash,
+		Message: fmt.Sprintf("namespace %q shares the template of namespace %q", namespace, owner),
+		Fields: map[string]interface{}{
+			"namespace": namespace,
+			"owner":     owner,
+		},
+	})
+
+	return nil
+}
+
+// sharesTemplates returns true if the namespace is part of the TemplateSharingNamespaces.
+func (m Manager) sharesTemplates(namespace string) bool {
+	for _, shared := range m.config.TemplateSharingNamespaces {
+		if shared == "*" || shared == namespace {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,274 @@
+package manager
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/allaboutapps/integresql/pkg/db"
+	"github.com/allaboutapps/integresql/pkg/oci"
+	"github.com/allaboutapps/integresql/pkg/templates"
+	"github.com/allaboutapps/integresql/pkg/tracing"
+	"github.com/lib/pq"
+)
+
+// maintenanceDatabases are never adopted, the cluster depends on them.
+var maintenanceDatabases = []string{"postgres", "template0", "template1"}
+
+type adoptUnlistedKey struct{}
+
+// withAdoptUnlisted returns a ctx adopting databases which aren't part of the TemplateAdoptableDatabases, e.g. the
+// template databases of a previous prefix scheme (see MigratePrefixes). The protected databases are still rejected.
+func withAdoptUnlisted(ctx context.Context) context.Context {
+	return context.WithValue(ctx, adoptUnlistedKey{}, true)
+}
+
+// validateTemplateSource checks the source related options without touching the database.
+func (m Manager) validateTemplateSource(ctx context.Context, options templates.TemplateOptions) error {
+	if len(options.SourceArtifact) > 0 && options.Source() != templates.TemplateSourceOCI {
+		return fmt.Errorf("%w: only %s templates have a source artifact", ErrInvalidTemplateOptions, templates.TemplateSourceOCI)
+	}
+
+	switch options.Source() {
+	case templates.TemplateSourceEmpty:
+		if len(options.SourceDatabase) > 0 || len(options.SourceDump) > 0 {
+			return fmt.Errorf("%w: empty templates have no source database or dump", ErrInvalidTemplateOptions)
+		}
+	case templates.TemplateSourceDatabase:
+		if len(options.SourceDatabase) == 0 || len(options.SourceDump) > 0 {
+			return fmt.Errorf("%w: %s templates require a source database only", ErrInvalidTemplateOptions, templates.TemplateSourceDatabase)
+		}
+	case templates.TemplateSourceDump:
+		if len(options.SourceDump) == 0 || len(options.SourceDatabase) > 0 {
+			return fmt.Errorf("%w: %s templates require a source dump only", ErrInvalidTemplateOptions, templates.TemplateSourceDump)
+		}
+		if _, err := m.templateDumpPath(options.SourceDump); err != nil {
+			return err
+		}
+	case templates.TemplateSourceOCI:
+		if len(options.SourceDatabase) > 0 || len(options.SourceDump) > 0 {
+			return fmt.Errorf("%w: %s templates have no source database or dump", ErrInvalidTemplateOptions, templates.TemplateSourceOCI)
+		}
+		if m.oci == nil {
+			return fmt.Errorf("%w: pulling artifacts is disabled (no registry configured)", ErrInvalidTemplateOptions)
+		}
+		if err := oci.ValidTag(options.SourceArtifact); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidTemplateOptions, err)
+		}
+	case templates.TemplateSourceExisting:
+		if len(options.SourceDatabase) == 0 || len(options.SourceDump) > 0 {
+			return fmt.Errorf("%w: %s templates require a source database only", ErrInvalidTemplateOptions, templates.TemplateSourceExisting)
+		}
+		if err := m.checkAdoptable(ctx, options.SourceDatabase); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("%w: unknown source kind %q", ErrInvalidTemplateOptions, options.SourceKind)
+	}
+
+	return nil
+}
+
+// checkAdoptable returns ErrInvalidTemplateOptions unless the database is part of the TemplateAdoptableDatabases.
+// Adopting renames the database into the template database (discarding the template drops it), thus the databases we
+// depend on or already manage are never adoptable.
+func (m Manager) checkAdoptable(ctx context.Context, dbName string) error {
+	protected := append([]string{
+		m.config.TemplateDatabaseTemplate,
+		m.config.ManagerDatabaseConfig.Database,
+		m.config.TargetDatabaseConfig.Database,
+	}, maintenanceDatabases...)
+
+	for _, name := range protected {
+		if dbName == name {
+			return fmt.Errorf("%w: database %q can't be adopted", ErrInvalidTemplateOptions, dbName)
+		}
+	}
+
+	if strings.HasPrefix(dbName, m.makeTemplateDatabaseName("")) || strings.HasPrefix(dbName, m.config.PoolConfig.TestDBNamePrefix) {
+		return fmt.Errorf("%w: database %q can't be adopted", ErrInvalidTemplateOptions, dbName)
+	}
+
+	if unlisted, _ := ctx.Value(adoptUnlistedKey{}).(bool); unlisted {
+		return nil
+	}
+
+	for _, adoptable := range m.config.TemplateAdoptableDatabases {
+		if dbName == adoptable {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: database %q isn't adoptable (see TemplateAdoptableDatabases)", ErrInvalidTemplateOptions, dbName)
+}
+
+// templateDumpPath returns the absolute path of the dump, which is never allowed to escape the TemplateDumpDir.
+func (m Manager) templateDumpPath(dump string) (string, error) {
+	if len(m.config.TemplateDumpDir) == 0 {
+		return "", fmt.Errorf("%w: restoring dumps is disabled (no dump directory configured)", ErrInvalidTemplateOptions)
+	}
+
+	return filepath.Join(m.config.TemplateDumpDir, filepath.Clean("/"+dump)), nil
+}
+
+// createTemplateDatabase creates the (not yet tracked) template database from its source and applies its settings.
+// On failure the template database is removed again (or an adopted one is renamed back), unless its dump restore
+// resumes on retry (see TemplateRestoreCheckpoints).
+func (m Manager) createTemplateDatabase(ctx context.Context, config db.DatabaseConfig, options templates.TemplateOptions) error {
+
+	log := m.getManagerLogger(ctx, "createTemplateDatabase").With().Str("dbName", config.Database).Str("source", string(options.Source())).Logger()
+
+	checkpoints := m.config.TemplateRestoreCheckpoints && options.Source() == templates.TemplateSourceDump
+
+	var checkpoint RestoreCheckpoint
+	var resume bool
+	if checkpoints {
+		var err error
+		if checkpoint, resume, err = m.resumeRestore(ctx, config.Database, options.SourceDump); err != nil {
+			return err
+		}
+	}
+
+	if options.Source() == templates.TemplateSourceExisting {
+		if err := m.adoptDatabase(ctx, options.SourceDatabase, config.Database); err != nil {
+			return err
+		}
+	} else if !resume {
+		reg := tracing.Region(ctx, "drop_and_create_db")
+		err := m.dropAndCreateDatabase(withCloneOptions(ctx, templateCloneOptions(options)), config.Database, m.config.TargetDatabaseConfig.Username, m.config.TemplateDatabaseTemplate)
+		reg.End()
+		if err != nil {
+			return err
+		}
+	}
+
+	var err error
+	switch options.Source() {
+	case templates.TemplateSourceDatabase:
+		source := m.config.SourceDatabaseConfig
+		source.Database = options.SourceDatabase
+
+		err = m.transferDatabase(ctx, source, config)
+	case templates.TemplateSourceDump:
+		if checkpoints {
+			err = m.restoreDumpSections(ctx, checkpoint, config)
+		} else {
+			err = m.restoreDump(ctx, options.SourceDump, config)
+		}
+	case templates.TemplateSourceOCI:
+		err = m.restoreArtifact(ctx, options.SourceArtifact, config)
+	}
+
+	// settings aren't copied while cloning, however applying them to the template validates them early
+	if err == nil {
+		if settingsErr := m.applyDatabaseSettings(ctx, config.Database, options.Settings); settingsErr != nil {
+			err = fmt.Errorf("%w: %v", ErrInvalidTemplateOptions, settingsErr)
+		}
+	}
+
+	if err == nil {
+		if checkpoints {
+			m.restoreCheckpoints.Remove(config.Database)
+		}
+
+		return nil
+	}
+
+	if checkpoints && m.keepRestore(config.Database, err) {
+		log.Warn().Err(err).Msg("keeping template database to resume its restore on retry")
+		return fmt.Errorf("%w (the restore resumes on retry)", err)
+	}
+
+	if options.Source() == templates.TemplateSourceExisting {
+		if renameErr := m.renameDatabase(ctx, config.Database, options.SourceDatabase); renameErr != nil {
+			log.Error().Err(renameErr).Msg("renaming adopted database back failed")
+		}
+	} else if dropErr := m.dropDatabase(ctx, config.Database); dropErr != nil {
+		log.Error().Err(dropErr).Msg("dropDatabase after failed creation failed")
+	}
+
+	return err
+}
+
+// adoptDatabase renames the existing source database into the template database.
+func (m Manager) adoptDatabase(ctx context.Context, source string, dbName string) error {
+	exists, err := m.checkDatabaseExists(ctx, source)
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		return fmt.Errorf("%w: database %q to adopt does not exist", ErrInvalidTemplateOptions, source)
+	}
+
+	// a previous template database with the same hash is replaced, like with all other source kinds
+	if err := m.dropDatabase(ctx, dbName); err != nil {
+		return err
+	}
+
+	return m.renameDatabase(ctx, source, dbName)
+}
+
+func (m Manager) renameDatabase(ctx context.Context, from string, to string) error {
+
+	defer tracing.Region(ctx, "rename_db").End()
+
+	if len(m.config.DDLFunctions.RenameDatabase) > 0 {
+		if err := m.callDDLFunction(ctx, m.config.DDLFunctions.RenameDatabase, from, to); err != nil {
+			return fmt.Errorf("failed to rename database %q to %q (connections must be closed): %w", from, to, err)
+		}
+
+		return nil
+	}
+
+	if _, err := m.db.ExecContext(ctx, fmt.Sprintf("ALTER DATABASE %s RENAME TO %s", pq.QuoteIdentifier(from), pq.QuoteIdentifier(to))); err != nil {
+		return fmt.Errorf("failed to rename database %q to %q (connections must be closed): %w", from, to, err)
+	}
+
+	return nil
+}
+
+// restoreDump restores the dump (relative to the TemplateDumpDir, e.g. a template backup) into the target database.
+func (m Manager) restoreDump(ctx context.Context, dump string, target db.DatabaseConfig) error {
+
+	defer tracing.Region(ctx, "restore_dump").End()
+
+	log := m.getManagerLogger(ctx, "restoreDump").With().Str("dump", dump).Str("target", target.Database).Logger()
+
+	path, err := m.templateDumpPath(dump)
+	if err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(path); err != nil {
+		return fmt.Errorf("%w: dump %q not found: %v", ErrInvalidTemplateOptions, dump, err)
+	}
+
+	if err := m.restoreDumpFile(ctx, path, target); err != nil {
+		log.Error().Err(err).Msg("restoring dump failed")
+		return err
+	}
+
+	log.Debug().Msg("restored.")
+
+	return nil
+}
+
+// restoreDumpFile restores the dump file at path (not confined to the TemplateDumpDir) into the target database.
+func (m Manager) restoreDumpFile(ctx context.Context, path string, target db.DatabaseConfig) error {
+	restore := exec.CommandContext(ctx, m.config.PgRestorePath, append(pgToolConnectionArgs(target), "--no-owner", "--no-acl", "--exit-on-error", path)...) // #nosec G204 - binary path is provided via config, the dump path is confined to the dump dir
+	restore.Env = pgToolEnv(target)
+
+	var stderr bytes.Buffer
+	restore.Stderr = &stderr
+
+	if err := restore.Run(); err != nil {
+		return fmt.Errorf("pg_restore failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	return nil
+}
@@ -0,0 +1,102 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/allaboutapps/integresql/pkg/events"
+	"github.com/allaboutapps/integresql/pkg/templates"
+)
+
+const (
+	taskTemplateTTLReaper = "TEMPLATE_TTL_REAPER"
+
+	minTemplateTTLCheckInterval = 10 * time.Millisecond
+)
+
+// templateTTL returns the TTL of the template, 0 if it never expires.
+func (m Manager) templateTTL(options templates.TemplateOptions) time.Duration {
+	if options.TTL > 0 {
+		return options.TTL
+	}
+
+	return m.config.TemplateTTL
+}
+
+// runTemplateTTLReaper periodically discards all expired templates until the ctx is done.
+// Errors of single runs are reported to the background supervisor, they don't stop the reaper.
+// Runs outside of the maintenance schedule (see pool.PoolConfig.Maintenance) are skipped.
+func (m Manager) runTemplateTTLReaper(ctx context.Context) error {
+	interval := m.config.TemplateTTLCheckInterval
+	if interval < minTemplateTTLCheckInterval {
+		interval = minTemplateTTLCheckInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case now := <-ticker.C:
+			if m.config.PoolConfig.Maintenance.Allowed(now) {
+				m.background.Report(taskTemplateTTLReaper, m.reapExpiredTemplates(ctx, now))
+			}
+		}
+	}
+}
+
+// reapExpiredTemplates discards all templates (in any state) initialized longer than their TTL ago. Templates with
+// checked out test databases are kept until those are returned (or auto-cleaned), not to pull them from running tests.
+func (m Manager) reapExpiredTemplates(ctx context.Context, now time.Time) error {
+
+	log := m.getManagerLogger(ctx, "reapExpiredTemplates")
+
+	var errs []error
+
+	for _, template := range m.templates.List(ctx) {
+		ttl := m.templateTTL(template.GetConfig(ctx).Options)
+		if ttl <= 0 {
+			continue
+		}
+
+		hash := template.TemplateHash
+		age := now.Sub(template.InitializedAt)
+		if age < ttl {
+			continue
+		}
+
+		// templates still initializing have no pool yet
+		if checkedOut, _, err := m.pool.Activity(ctx, hash); err == nil && checkedOut > 0 {
+			log.Debug().Str("hash", hash).Int("checkedOut", checkedOut).Msg("deferring the discard of the expired template, test databases are checked out")
+			continue
+		}
+
+		log.Info().Str("hash", hash).Dur("age", age).Dur("ttl", ttl).Msg("discarding expired template...")
+
+		if err := m.DiscardTemplateDatabase(ctx, hash); err != nil {
+			// discarded meanwhile
+			if errors.Is(err, ErrTemplateNotFound) {
+				continue
+			}
+
+			errs = append(errs, fmt.Errorf("failed to discard expired template %s: %w", hash, err))
+			continue
+		}
+
+		m.events.Emit(events.Event{
+			Type:    events.TypeTemplateExpired,
+			Hash:    hash,
+			Message: fmt.Sprintf("template %s was discarded after its TTL of %v", hash, ttl),
+			Fields: map[string]interface{}{
+				"ageMs": age.Milliseconds(),
+				"ttlMs": ttl.Milliseconds(),
+			},
+		})
+	}
+
+	return errors.Join(errs...)
+}
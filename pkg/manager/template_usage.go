@@ -0,0 +1,318 @@
+package manager
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/allaboutapps/integresql/pkg/encryption"
+	"github.com/allaboutapps/integresql/pkg/templates"
+)
+
+const (
+	taskTemplateUsageFlush = "TEMPLATE_USAGE_FLUSH"
+
+	// interval of persisting changed usage stats, they are persisted on disconnect as well
+	templateUsageFlushInterval = 10 * time.Second
+
+	// templates not acquired within this duration are forgotten (e.g. hashes of outdated migrations)
+	templateUsageMaxAge = 7 * 24 * time.Hour
+)
+
+// TemplateUsageRecord is the persisted acquisition count of a template, see TemplateUsageFile.
+type TemplateUsageRecord struct {
+	Hash         string                    `json:"hash"`
+	Acquisitions int                       `json:"acquisitions"`
+	LastUsedAt   time.Time                 `json:"lastUsedAt"`
+	Options      templates.TemplateOptions `json:"options"` // recreated with these options while prebuilding it
+}
+
+// templateUsageRegistry counts the acquisitions per template and persists them to a JSON file (sealed by the keys).
+type templateUsageRegistry struct {
+	path    string
+	keys    *encryption.Keyring
+	entries map[string]*TemplateUsageRecord
+	changed bool // entries changed since the last save
+	mutex   sync.Mutex
+}
+
+// loadTemplateUsage reads the usage stats from the file, a missing file starts empty.
+func loadTemplateUsage(path string, keys *encryption.Keyring) (*templateUsageRegistry, error) {
+	r := &templateUsageRegistry{path: path, keys: keys, entries: make(map[string]*TemplateUsageRecord)}
+
+	sealed, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := keys.Open(sealed)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template usage file %s: %w", path, err)
+	}
+
+	// sealed with the primary key on the next save (e.g. after rotating the keys)
+	r.changed = !keys.Current(sealed)
+
+	var entries []TemplateUsageRecord
+	if err := json.Unmarshal(b, &entries); err != nil {
+		return nil, fmt.Errorf("invalid template usage file %s: %w", path, err)
+	}
+
+	for i := range entries {
+		if time.Since(entries[i].LastUsedAt) > templateUsageMaxAge {
+			r.changed = true
+			continue
+		}
+
+		r.entries[entries[i].Hash] = &entries[i]
+	}
+
+	return r, nil
+}
+
+// Record counts an acquisition of the template.
+func (r *templateUsageRegistry) Record(hash string, options templates.TemplateOptions, now time.Time) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	usage, ok := r.entries[hash]
+	if !ok {
+		usage = &TemplateUsageRecord{Hash: hash}
+		r.entries[hash] = usage
+	}
+
+	usage.Acquisitions++
+	usage.LastUsedAt = now
+	usage.Options = options
+	r.changed = true
+}
+
+// Top returns the n most acquired templates (the most recently used ones first on ties).
+func (r *templateUsageRegistry) Top(n int) []TemplateUsageRecord {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	top := make([]TemplateUsageRecord, 0, len(r.entries))
+	for _, usage := range r.entries {
+		top = append(top, *usage)
+	}
+
+	sort.Slice(top, func(i, j int) bool {
+		if top[i].Acquisitions != top[j].Acquisitions {
+			return top[i].Acquisitions > top[j].Acquisitions
+		}
+		return top[i].LastUsedAt.After(top[j].LastUsedAt)
+	})
+
+	if len(top) > n {
+		top = top[:n]
+	}
+
+	return top
+}
+
+// Save replaces the file atomically if the entries changed since the last save.
+func (r *templateUsageRegistry) Save() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if !r.changed {
+		return nil
+	}
+
+	entries := make([]TemplateUsageRecord, 0, len(r.entries))
+	for _, usage := range r.entries {
+		entries = append(entries, *usage)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Hash < entries[j].Hash })
+
+	plaintext, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+
+	b, err := r.keys.Seal(plaintext)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(r.path), ".integresql-usage-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp.Name(), r.path); err != nil {
+		return err
+	}
+
+	r.changed = false
+
+	return nil
+}
+
+// runTemplateUsageFlush periodically persists the changed usage stats until the ctx is done.
+func (m Manager) runTemplateUsageFlush(ctx context.Context) error {
+	ticker := time.NewTicker(templateUsageFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			m.background.Report(taskTemplateUsageFlush, m.usage.Save())
+		}
+	}
+}
+
+// recordTemplateUsage counts the acquisition of a test database of the template, if the usage is tracked.
+func (m Manager) recordTemplateUsage(ctx context.Context, template *templates.Template) {
+	if m.usage == nil {
+		return
+	}
+
+	options := template.GetConfig(ctx).Options
+
+	// ephemeral templates are never worth prebuilding
+	if options.Ephemeral {
+		return
+	}
+
+	m.usage.Record(template.TemplateHash, options, time.Now())
+}
+
+// PrebuildSummary describes the templates initialized by PrebuildTemplates.
+type PrebuildSummary struct {
+	Prebuilt []string          `json:"prebuilt"`
+	Skipped  map[string]string `json:"skipped,omitempty"` // hash -> reason (e.g. no dump available)
+}
+
+// PrebuildTemplates initializes the StartupPrebuildTemplates most acquired templates (according to the persisted
+// TemplateUsageFile) before the server starts serving, so the first clients after a restart don't each pay the cold
+// template build. Templates are restored from their most recent backup within the TemplateBackupDir or pulled from
+// the OCI registry, ones without such a dump are skipped. Returns as soon as the ctx is done.
+func (m Manager) PrebuildTemplates(ctx context.Context) (PrebuildSummary, error) {
+
+	log := m.getManagerLogger(ctx, "PrebuildTemplates")
+
+	summary := PrebuildSummary{Prebuilt: make([]string, 0), Skipped: make(map[string]string)}
+
+	if m.usage == nil || m.config.StartupPrebuildTemplates <= 0 {
+		return summary, nil
+	}
+
+	if !m.Ready() {
+		return summary, ErrManagerNotReady
+	}
+
+	for _, usage := range m.usage.Top(m.config.StartupPrebuildTemplates) {
+		if err := ctx.Err(); err != nil {
+			return summary, err
+		}
+
+		log := log.With().Str("hash", usage.Hash).Int("acquisitions", usage.Acquisitions).Logger()
+
+		options, ok := m.prebuildSource(usage)
+		if !ok {
+			log.Debug().Msg("skipping prebuild, no dump available")
+			summary.Skipped[usage.Hash] = "no dump available"
+			continue
+		}
+
+		start := time.Now()
+		_, err := m.InitializeTemplateDatabaseWithOptions(ctx, usage.Hash, options)
+		if err == nil && options.Source() == templates.TemplateSourceDump {
+			// restored dumps are complete, there's nothing left to populate
+			_, err = m.FinalizeTemplateDatabase(ctx, usage.Hash)
+		}
+
+		if err != nil && !errors.Is(err, ErrTemplateAlreadyInitialized) {
+			log.Warn().Err(err).Msg("prebuilding template failed")
+			summary.Skipped[usage.Hash] = err.Error()
+			continue
+		}
+
+		log.Info().Str("source", string(options.Source())).Dur("duration", time.Since(start)).Msg("prebuilt template")
+		summary.Prebuilt = append(summary.Prebuilt, usage.Hash)
+	}
+
+	return summary, nil
+}
+
+// prebuildSource returns the recorded options of the template with the source of its dump: its most recent backup
+// (if within the TemplateDumpDir) or its artifact within the registry. Returns false if there is no such dump.
+func (m Manager) prebuildSource(usage TemplateUsageRecord) (templates.TemplateOptions, bool) {
+	options := usage.Options
+	options.SourceDatabase = ""
+
+	if backup, ok := m.latestTemplateBackup(usage.Hash); ok {
+		options.SourceKind = templates.TemplateSourceDump
+		options.SourceDump = backup
+		options.SourceArtifact = ""
+		return options, true
+	}
+
+	if m.oci != nil {
+		options.SourceKind = templates.TemplateSourceOCI
+		options.SourceDump = ""
+		if len(options.SourceArtifact) == 0 {
+			options.SourceArtifact = usage.Hash
+		}
+		return options, true
+	}
+
+	return options, false
+}
+
+// latestTemplateBackup returns the path of the most recent backup of the hash relative to the TemplateDumpDir.
+func (m Manager) latestTemplateBackup(hash string) (string, bool) {
+	if !m.templateBackupConfigured() || len(m.config.TemplateDumpDir) == 0 || strings.ContainsAny(hash, `/\`) {
+		return "", false
+	}
+
+	dir := filepath.Join(m.config.TemplateBackupDir, hash)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", false
+	}
+
+	// names are UTC timestamps, the last one is the most recent backup
+	latest := ""
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), templateBackupExt) && entry.Name() > latest {
+			latest = entry.Name()
+		}
+	}
+
+	if len(latest) == 0 {
+		return "", false
+	}
+
+	rel, err := filepath.Rel(m.config.TemplateDumpDir, filepath.Join(dir, latest))
+	if err != nil || strings.HasPrefix(rel, "..") {
+		// dumps are only restored from within the TemplateDumpDir
+		return "", false
+	}
+
+	return rel, true
+}
@@ -0,0 +1,86 @@
+package manager
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/allaboutapps/integresql/pkg/templates"
+	"github.com/allaboutapps/integresql/pkg/webhook"
+)
+
+// Events of the webhooks registered with templates, sent in the webhook.EventHeader.
+const (
+	TemplateWebhookReady  = "template.ready"
+	TemplateWebhookFailed = "template.failed"
+)
+
+const taskTemplateWebhook = "TEMPLATE_WEBHOOK"
+
+// TemplateWebhookPayload is the JSON body of the ready/failed webhooks of a template.
+type TemplateWebhookPayload struct {
+	Event        string    `json:"event"`
+	TemplateHash string    `json:"templateHash"`
+	Error        string    `json:"error,omitempty"` // cause of the failure (failed only)
+	Time         time.Time `json:"time"`
+}
+
+func validateTemplateWebhooks(options templates.TemplateOptions) error {
+	for _, rawURL := range []string{options.ReadyWebhook, options.FailedWebhook, options.StaleCheckoutWebhook} {
+		if len(rawURL) == 0 {
+			continue
+		}
+
+		if err := webhook.ValidURL(rawURL); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidTemplateOptions, err)
+		}
+	}
+
+	return nil
+}
+
+func (m Manager) notifyTemplateReady(ctx context.Context, hash string, options templates.TemplateOptions) {
+	m.sendTemplateWebhook(ctx, options.ReadyWebhook, TemplateWebhookPayload{
+		Event:        TemplateWebhookReady,
+		TemplateHash: hash,
+		Time:         time.Now(),
+	})
+}
+
+func (m Manager) notifyTemplateFailed(ctx context.Context, hash string, options templates.TemplateOptions, cause error) {
+	m.sendTemplateWebhook(ctx, options.FailedWebhook, TemplateWebhookPayload{
+		Event:        TemplateWebhookFailed,
+		TemplateHash: hash,
+		Error:        cause.Error(),
+		Time:         time.Now(),
+	})
+}
+
+// sendTemplateWebhook delivers the payload in background, failed deliveries are reported as background task errors.
+func (m Manager) sendTemplateWebhook(ctx context.Context, rawURL string, payload TemplateWebhookPayload) {
+	m.sendWebhook(ctx, rawURL, payload.Event, payload.TemplateHash, payload)
+}
+
+// sendWebhook delivers the JSON of the payload in background, failed deliveries are reported as background task errors.
+func (m Manager) sendWebhook(ctx context.Context, rawURL string, event string, hash string, payload interface{}) {
+	if len(rawURL) == 0 {
+		return
+	}
+
+	log := m.getManagerLogger(ctx, "sendWebhook").With().Str("hash", hash).Str("event", event).Logger()
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to marshal the webhook payload")
+		return
+	}
+
+	started := m.background.Go(taskTemplateWebhook, func(ctx context.Context) error {
+		return m.webhooks.Deliver(ctx, rawURL, event, body)
+	})
+
+	if !started {
+		log.Warn().Msg("skipping the webhook, the manager is disconnected")
+	}
+}
@@ -0,0 +1,394 @@
+package manager
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/allaboutapps/integresql/pkg/encryption"
+	"github.com/allaboutapps/integresql/pkg/pool"
+	"github.com/allaboutapps/integresql/pkg/templates"
+)
+
+const taskTrackingSync = "TRACKING_SYNC"
+
+// trackingSchemaStatements create the "integresql" schema within the manager database (ManagerDatabaseConfig, even if
+// the databases are created on a separate TargetDatabaseConfig server), see TrackingSchema. Rows are
+// scoped by the name of their template database, thus instances with different prefixes may share the schema.
+var trackingSchemaStatements = []string{
+	`CREATE SCHEMA IF NOT EXISTS integresql`,
+	`CREATE TABLE IF NOT EXISTS integresql.templates (
+		database text PRIMARY KEY,
+		hash text NOT NULL,
+		options jsonb NOT NULL,
+		initialized_at timestamptz NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS integresql.test_databases (
+		database text PRIMARY KEY,
+		template_database text NOT NULL REFERENCES integresql.templates (database) ON DELETE CASCADE,
+		id integer NOT NULL,
+		state text NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS integresql.syncs (
+		template_prefix text PRIMARY KEY,
+		synced_at timestamptz NOT NULL,
+		final boolean NOT NULL
+	)`,
+	// the options are sealed for the namespace of their template, see sealTrackedOptions
+	`ALTER TABLE integresql.templates ADD COLUMN IF NOT EXISTS namespace text NOT NULL DEFAULT ''`,
+}
+
+// trackedState is the state persisted by a previous run, readopted by Initialize.
+type trackedState struct {
+	// persisted by Disconnect, otherwise the ready test databases might have been handed out after the last sync
+	final     bool
+	templates map[string]*trackedTemplate // by hash
+}
+
+type trackedTemplate struct {
+	database      string
+	options       templates.TemplateOptions
+	initializedAt time.Time
+	testDatabases []trackedTestDatabase
+}
+
+type trackedTestDatabase struct {
+	database string
+	id       int
+	state    string
+}
+
+// tracksTestDatabase returns true if the test database is readopted, Initialize keeps it.
+func (s *trackedState) tracksTestDatabase(dbName string) bool {
+	if s == nil {
+		return false
+	}
+
+	for _, template := range s.templates {
+		for _, testDB := range template.testDatabases {
+			if testDB.database == dbName {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// connectTracking connects to the manager database holding the tracking schema (separately if the databases are created
+// on another TargetDatabaseConfig server) and creates the schema.
+func (m *Manager) connectTracking(ctx context.Context) error {
+	if m.config.separateTarget() {
+		trackingDB, err := sql.Open("postgres", m.config.ManagerDatabaseConfig.ConnectionString())
+		if err != nil {
+			return err
+		}
+
+		if err := trackingDB.PingContext(ctx); err != nil {
+			trackingDB.Close()
+			return err
+		}
+
+		m.trackingDB = trackingDB
+	}
+
+	return m.ensureTrackingSchema(ctx)
+}
+
+// closeTrackingDB closes the separate connection to the manager database (if any).
+func (m *Manager) closeTrackingDB() error {
+	trackingDB := m.trackingDB
+	m.trackingDB = nil
+
+	if trackingDB == nil || trackingDB == m.db {
+		return nil
+	}
+
+	return trackingDB.Close()
+}
+
+func (m Manager) ensureTrackingSchema(ctx context.Context) error {
+	for _, statement := range trackingSchemaStatements {
+		if _, err := m.trackingDB.ExecContext(ctx, statement); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m Manager) runTrackingSync(ctx context.Context) error {
+	ticker := time.NewTicker(m.config.TrackingSyncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			m.background.Report(taskTrackingSync, m.syncTracking(ctx, false))
+		}
+	}
+}
+
+// syncTracking replaces the persisted state of the current prefixes with the finalized templates and the states of
+// their test databases (overflow and dropping ones excluded) within a single transaction.
+func (m Manager) syncTracking(ctx context.Context, final bool) error {
+	templatePrefix := m.makeTemplateDatabaseName("")
+	testPrefix := m.config.PoolConfig.TestDBNamePrefix
+
+	tx, err := m.trackingDB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM integresql.templates WHERE database LIKE $1", likePrefixPattern(templatePrefix)); err != nil {
+		return err
+	}
+
+	synced := make(map[string]string) // template database by hash
+	for _, template := range m.templates.List(ctx) {
+		if template.GetState(ctx) != templates.TemplateStateFinalized {
+			continue
+		}
+
+		config := template.GetConfig(ctx)
+		options, err := m.sealTrackedOptions(config.Options)
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, "INSERT INTO integresql.templates (database, hash, options, initialized_at, namespace) VALUES ($1, $2, $3, $4, $5)",
+			config.Database, template.TemplateHash, options, template.InitializedAt, config.Options.Namespace); err != nil {
+			return err
+		}
+
+		synced[template.TemplateHash] = config.Database
+	}
+
+	for dbName, state := range m.pool.TestDatabaseStates(ctx) {
+		hash, id, ok := splitTestDatabaseName(testPrefix, dbName)
+		if !ok || id >= m.templateMaxPoolSize(ctx, hash) || state == "dropping" {
+			continue
+		}
+
+		templateDB, found := synced[hash]
+		if !found {
+			continue
+		}
+
+		if _, err := tx.ExecContext(ctx, "INSERT INTO integresql.test_databases (database, template_database, id, state) VALUES ($1, $2, $3, $4)",
+			dbName, templateDB, id, state); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, `INSERT INTO integresql.syncs (template_prefix, synced_at, final) VALUES ($1, now(), $2)
+		ON CONFLICT (template_prefix) DO UPDATE SET synced_at = EXCLUDED.synced_at, final = EXCLUDED.final`, templatePrefix, final); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// loadTracking reads the state of the current prefixes persisted by the previous run.
+func (m Manager) loadTracking(ctx context.Context) (*trackedState, error) {
+	templatePrefix := m.makeTemplateDatabaseName("")
+
+	state := &trackedState{templates: make(map[string]*trackedTemplate)}
+
+	// nothing was persisted yet, e.g. the first start with TrackingSchema
+	err := m.trackingDB.QueryRowContext(ctx, "SELECT final FROM integresql.syncs WHERE template_prefix = $1", templatePrefix).Scan(&state.final)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	rows, err := m.trackingDB.QueryContext(ctx, "SELECT database, hash, options, initialized_at, namespace FROM integresql.templates WHERE database LIKE $1", likePrefixPattern(templatePrefix))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	byDatabase := make(map[string]*trackedTemplate)
+	for rows.Next() {
+		var hash, namespace string
+		var options []byte
+		template := &trackedTemplate{}
+		if err := rows.Scan(&template.database, &hash, &options, &template.initializedAt, &namespace); err != nil {
+			return nil, err
+		}
+
+		if template.options, err = m.openTrackedOptions(options, namespace); err != nil {
+			return nil, err
+		}
+
+		state.templates[hash] = template
+		byDatabase[template.database] = template
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	testRows, err := m.trackingDB.QueryContext(ctx, "SELECT database, template_database, id, state FROM integresql.test_databases WHERE template_database LIKE $1", likePrefixPattern(templatePrefix))
+	if err != nil {
+		return nil, err
+	}
+	defer testRows.Close()
+
+	for testRows.Next() {
+		var templateDB string
+		var testDB trackedTestDatabase
+		if err := testRows.Scan(&testDB.database, &templateDB, &testDB.id, &testDB.state); err != nil {
+			return nil, err
+		}
+
+		if template, ok := byDatabase[templateDB]; ok {
+			template.testDatabases = append(template.testDatabases, testDB)
+		}
+	}
+
+	return state, testRows.Err()
+}
+
+// readoptTracked tracks the persisted templates again (finalized, with their persisted options) and starts their pools
+// with the persisted test databases, as long as their databases still exist. Templates already tracked are skipped.
+func (m Manager) readoptTracked(ctx context.Context, state *trackedState) error {
+
+	log := m.getManagerLogger(ctx, "readoptTracked")
+
+	templateDBs, err := m.listDatabasesWithPrefix(ctx, m.makeTemplateDatabaseName(""))
+	if err != nil {
+		return err
+	}
+
+	testDBs, err := m.listDatabasesWithPrefix(ctx, m.config.PoolConfig.TestDBNamePrefix)
+	if err != nil {
+		return err
+	}
+
+	existing := make(map[string]bool, len(templateDBs)+len(testDBs))
+	for _, dbName := range append(templateDBs, testDBs...) {
+		existing[dbName] = true
+	}
+
+	hashes := make([]string, 0, len(state.templates))
+	for hash := range state.templates {
+		hashes = append(hashes, hash)
+	}
+	sort.Strings(hashes)
+
+	readopted := 0
+	for _, hash := range hashes {
+		tracked := state.templates[hash]
+
+		if tracked.database != m.makeTemplateDatabaseName(hash) || !existing[tracked.database] {
+			log.Warn().Str("hash", hash).Str("dbName", tracked.database).Msg("template database gone, not readopting it")
+			continue
+		}
+
+		added, unlock := m.templates.Push(ctx, hash, templates.TemplateConfig{
+			DatabaseConfig: m.templateDatabaseConfig(tracked.database),
+			Options:        tracked.options,
+		})
+		unlock()
+
+		if !added {
+			continue
+		}
+
+		template, found := m.templates.Get(ctx, hash)
+		if !found {
+			continue
+		}
+		template.InitializedAt = tracked.initializedAt
+
+		adopted := make([]pool.AdoptedTestDatabase, 0, len(tracked.testDatabases))
+		for _, testDB := range tracked.testDatabases {
+			if !existing[testDB.database] {
+				continue
+			}
+
+			adopted = append(adopted, pool.AdoptedTestDatabase{
+				ID:    testDB.id,
+				Ready: state.final && testDB.state == "ready",
+			})
+		}
+
+		// the template itself is kept as-is across restarts, thus failures are logged only
+		if checksum, err := m.checksumTemplate(ctx, template); err != nil {
+			log.Warn().Err(err).Str("hash", hash).Msg("checksumming readopted template failed, acquisitions lack the checksum")
+		} else {
+			template.SetChecksum(ctx, checksum)
+		}
+
+		if m.templateDriftCheckEnabled() {
+			m.captureTemplateFingerprint(ctx, template)
+		}
+
+		rejected := m.pool.InitHashPoolWithAdopted(ctx, template.Database, m.makeRecreateTestPoolDBFunc(tracked.options), m.templatePoolConfig(tracked.options), adopted)
+		if len(rejected) > 0 {
+			log.Warn().Str("hash", hash).Ints("ids", rejected).Msg("test databases not readopted, growing the pool recreates them")
+		}
+
+		template.SetState(ctx, templates.TemplateStateFinalized)
+		m.updateLatestAlias(hash, tracked.options)
+		m.createTemplateReplicas(ctx, template)
+
+		log.Info().Str("hash", hash).Int("testDatabases", len(adopted)-len(rejected)).Msg("template readopted")
+		readopted++
+	}
+
+	log.Info().Int("templates", readopted).Bool("final", state.final).Msg("readopted tracked state")
+
+	return nil
+}
+
+// sealTrackedOptions returns the options persisted within the jsonb column, a JSON string of the options sealed for
+// their namespace if its NamespaceStateEncryptionKeys or the StateEncryptionKeys are configured (every sync rewrites
+// them, thus rotating the keys as well).
+func (m Manager) sealTrackedOptions(options templates.TemplateOptions) ([]byte, error) {
+	keys := m.namespaceStateKeys(options.Namespace)
+
+	plaintext, err := json.Marshal(options)
+	if err != nil || !keys.Enabled() {
+		return plaintext, err
+	}
+
+	sealed, err := keys.SealScoped(plaintext, options.Namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(string(sealed))
+}
+
+// openTrackedOptions returns the options persisted by sealTrackedOptions (sealed or not) for the namespace of their
+// row. Options sealed for another namespace (e.g. a tampered row) fail to open.
+func (m Manager) openTrackedOptions(persisted []byte, namespace string) (templates.TemplateOptions, error) {
+	var options templates.TemplateOptions
+
+	var sealed string
+	if err := json.Unmarshal(persisted, &sealed); err == nil {
+		if persisted, err = m.namespaceStateKeys(namespace).OpenScoped([]byte(sealed), namespace); err != nil {
+			return options, err
+		}
+	}
+
+	err := json.Unmarshal(persisted, &options)
+
+	return options, err
+}
+
+// namespaceStateKeys returns the keys sealing the tracked templates of the namespace: its NamespaceStateEncryptionKeys,
+// falling back to the StateEncryptionKeys.
+func (m Manager) namespaceStateKeys(namespace string) *encryption.Keyring {
+	if keys, ok := m.nsStateKeys[namespace]; ok {
+		return keys
+	}
+
+	return m.stateKeys
+}
@@ -0,0 +1,150 @@
+// Package metrics abstracts the emission of operational metrics (rates, outcomes and durations of template and
+// test database operations) from the backend they are sent to (Prometheus, statsd or DogStatsD).
+package metrics
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+var ErrUnknownBackend = errors.New("unknown metrics backend")
+
+// Metrics is implemented by all backends, see New.
+type Metrics interface {
+	// Inc increases the counter with the given name by one.
+	Inc(name string, labels Labels)
+	// Observe records the duration within the histogram (or timer) with the given name.
+	Observe(name string, d time.Duration, labels Labels)
+	// Collect registers the collector reporting gauges (and cumulative counters), invoked on each scrape (Prometheus)
+	// or every GaugeInterval (statsd).
+	Collect(collector Collector)
+	// Handler serves the metrics for scraping, nil if the backend pushes them instead.
+	Handler() http.Handler
+	// Close releases all resources of the backend.
+	Close() error
+}
+
+// Labels are attached to each emitted value (Prometheus labels, DogStatsD tags).
+type Labels map[string]string
+
+// Sample is the current value of a gauge or cumulative counter reported by a Collector.
+type Sample struct {
+	Name   string
+	Value  float64
+	Labels Labels
+}
+
+// Collector reports the current state (e.g. the size of all pools), sampled when the metrics are scraped or pushed.
+type Collector func() []Sample
+
+type Backend string
+
+const (
+	BackendNone       Backend = "none"
+	BackendPrometheus Backend = "prometheus"
+	BackendStatsd     Backend = "statsd"    // plain statsd, label values are appended to the metric name
+	BackendDogStatsd  Backend = "dogstatsd" // statsd with Datadog tags
+)
+
+type Config struct {
+	Backend       Backend
+	Prefix        string // Namespace (Prometheus) or prefix (statsd) of all metric names
+	StatsdAddress string // host:port of the statsd/DogStatsD agent (UDP)
+
+	// Interval of pushing the Go runtime gauges (statsd only, Prometheus collects them while being scraped), 0 disables them
+	RuntimeInterval time.Duration
+
+	// Interval of pushing the samples of all collectors (statsd only, Prometheus collects them while being scraped), 0 disables them
+	GaugeInterval time.Duration
+}
+
+// Names of all emitted metrics, counters are suffixed by "_total" and histograms by "_seconds" for Prometheus.
+const (
+	TemplateOperations            = "template_operations"
+	TemplateOperationDuration     = "template_operation_duration"
+	TestDatabaseOperations        = "test_database_operations"
+	TestDatabaseOperationDuration = "test_database_operation_duration"
+
+	// reported by the collector of the manager
+	Templates          = "templates"
+	PoolTestDatabases  = "pool_test_databases"
+	PoolSize           = "pool_size"
+	DatabaseOperations = "database_operations"
+)
+
+// Names of the Go runtime gauges pushed by the statsd backends (see Config.RuntimeInterval), Prometheus exports the
+// go_* metrics of its Go collector instead (e.g. go_goroutines, go_memstats_heap_alloc_bytes, go_gc_duration_seconds).
+const (
+	RuntimeGoroutines     = "runtime_goroutines"
+	RuntimeHeapAllocBytes = "runtime_heap_alloc_bytes"
+	RuntimeHeapSysBytes   = "runtime_heap_sys_bytes"
+	RuntimeHeapObjects    = "runtime_heap_objects"
+	RuntimeNumGC          = "runtime_num_gc"
+	RuntimeGCPauseTotalMs = "runtime_gc_pause_total_ms"
+)
+
+const (
+	LabelOperation = "operation" // e.g. "initialize", "get"
+	LabelResult    = "result"    // "success", "not_found", "timeout" or "error"
+	LabelState     = "state"     // e.g. "finalized" (templates) or "ready" (test databases)
+	LabelHash      = "hash"      // template hash
+)
+
+type kind int
+
+const (
+	kindCounter kind = iota
+	kindHistogram
+	kindGauge           // reported by a Collector
+	kindAbsoluteCounter // cumulative value reported by a Collector, pushed as gauge by statsd
+)
+
+type definition struct {
+	name   string
+	help   string
+	kind   kind
+	labels []string // ordered, statsd appends the values in this order
+}
+
+// definitions of all known metrics, backends requiring upfront registration (Prometheus) ignore unknown ones
+var definitions = []definition{
+	{TemplateOperations, "Number of template operations (initialize, finalize, discard, bootstrap) by result.", kindCounter, []string{LabelOperation, LabelResult}},
+	{TemplateOperationDuration, "Duration of template operations (initialize, finalize, discard, bootstrap).", kindHistogram, []string{LabelOperation}},
+	{TestDatabaseOperations, "Number of test database operations (get, return, recreate) by result.", kindCounter, []string{LabelOperation, LabelResult}},
+	{TestDatabaseOperationDuration, "Duration of test database operations (get, return, recreate), including waits.", kindHistogram, []string{LabelOperation}},
+	{Templates, "Number of tracked templates by state (init, finalized, discarded).", kindGauge, []string{LabelState}},
+	{PoolTestDatabases, "Number of test databases of the pool of a template by state (ready, dirty, recreating).", kindGauge, []string{LabelHash, LabelState}},
+	{PoolSize, "Number of test databases of the pool of a template, excluding temporary overflow ones.", kindGauge, []string{LabelHash}},
+	{DatabaseOperations, "Number of databases created and dropped (CREATE/DROP DATABASE) by the manager by result.", kindAbsoluteCounter, []string{LabelOperation, LabelResult}},
+}
+
+// New creates the metrics backend according to the config, an empty backend disables metrics.
+func New(config Config) (Metrics, error) {
+	switch config.Backend {
+	case "", BackendNone:
+		return Noop(), nil
+	case BackendPrometheus:
+		return newPrometheusMetrics(config)
+	case BackendStatsd:
+		return newStatsdMetrics(config, false)
+	case BackendDogStatsd:
+		return newStatsdMetrics(config, true)
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownBackend, config.Backend)
+	}
+}
+
+// Noop returns metrics discarding all values.
+func Noop() Metrics {
+	return noopMetrics{}
+}
+
+type noopMetrics struct{}
+
+func (noopMetrics) Inc(string, Labels)                    {}
+func (noopMetrics) Observe(string, time.Duration, Labels) {}
+func (noopMetrics) Collect(Collector)                     {}
+func (noopMetrics) Handler() http.Handler                 { return nil }
+func (noopMetrics) Close() error                          { return nil }
@@ -0,0 +1,183 @@
+package metrics_test
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/allaboutapps/integresql/pkg/metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew(t *testing.T) {
+	m, err := metrics.New(metrics.Config{})
+	require.NoError(t, err)
+	assert.Nil(t, m.Handler())
+
+	_, err = metrics.New(metrics.Config{Backend: "graphite"})
+	assert.ErrorIs(t, err, metrics.ErrUnknownBackend)
+}
+
+func TestPrometheus(t *testing.T) {
+	m, err := metrics.New(metrics.Config{Backend: metrics.BackendPrometheus, Prefix: "integresql"})
+	require.NoError(t, err)
+	defer m.Close()
+
+	m.Inc(metrics.TestDatabaseOperations, metrics.Labels{metrics.LabelOperation: "get", metrics.LabelResult: "success"})
+	m.Inc(metrics.TestDatabaseOperations, metrics.Labels{metrics.LabelOperation: "get", metrics.LabelResult: "success"})
+	m.Observe(metrics.TestDatabaseOperationDuration, 20*time.Millisecond, metrics.Labels{metrics.LabelOperation: "get"})
+
+	// unknown metrics and mismatching labels are ignored
+	m.Inc("unknown", nil)
+	m.Inc(metrics.TemplateOperations, metrics.Labels{"hash": "h1"})
+
+	require.NotNil(t, m.Handler())
+	res := httptest.NewRecorder()
+	m.Handler().ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusOK, res.Code)
+
+	body := res.Body.String()
+	assert.Contains(t, body, `integresql_test_database_operations_total{operation="get",result="success"} 2`)
+	assert.Contains(t, body, `integresql_test_database_operation_duration_seconds_count{operation="get"} 1`)
+	assert.NotContains(t, body, "unknown")
+}
+
+func TestPrometheusCollect(t *testing.T) {
+	m, err := metrics.New(metrics.Config{Backend: metrics.BackendPrometheus, Prefix: "integresql"})
+	require.NoError(t, err)
+	defer m.Close()
+
+	hashes := []string{"h1", "h2"}
+	m.Collect(func() []metrics.Sample {
+		samples := []metrics.Sample{
+			{Name: metrics.Templates, Value: float64(len(hashes)), Labels: metrics.Labels{metrics.LabelState: "finalized"}},
+			{Name: metrics.DatabaseOperations, Value: 7, Labels: metrics.Labels{metrics.LabelOperation: "create", metrics.LabelResult: "success"}},
+
+			// unknown metrics and mismatching labels are ignored
+			{Name: "unknown", Value: 1},
+			{Name: metrics.PoolSize, Value: 1, Labels: metrics.Labels{metrics.LabelState: "ready"}},
+		}
+
+		for _, hash := range hashes {
+			samples = append(samples, metrics.Sample{Name: metrics.PoolSize, Value: 4, Labels: metrics.Labels{metrics.LabelHash: hash}})
+		}
+
+		return samples
+	})
+
+	scrape := func() string {
+		res := httptest.NewRecorder()
+		m.Handler().ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		require.Equal(t, http.StatusOK, res.Code)
+
+		return res.Body.String()
+	}
+
+	body := scrape()
+	assert.Contains(t, body, `integresql_templates{state="finalized"} 2`)
+	assert.Contains(t, body, `integresql_pool_size{hash="h1"} 4`)
+	assert.Contains(t, body, `integresql_pool_size{hash="h2"} 4`)
+	assert.Contains(t, body, "# TYPE integresql_database_operations_total counter")
+	assert.Contains(t, body, `integresql_database_operations_total{operation="create",result="success"} 7`)
+	assert.NotContains(t, body, "unknown")
+
+	// series no longer reported vanish
+	hashes = hashes[:1]
+	body = scrape()
+	assert.Contains(t, body, `integresql_pool_size{hash="h1"} 4`)
+	assert.NotContains(t, body, `hash="h2"`)
+}
+
+func TestStatsd(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer conn.Close()
+
+	receive := func() string {
+		t.Helper()
+
+		buf := make([]byte, 1024)
+		require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+		n, _, err := conn.ReadFrom(buf)
+		require.NoError(t, err)
+
+		return string(buf[:n])
+	}
+
+	statsd, err := metrics.New(metrics.Config{Backend: metrics.BackendStatsd, Prefix: "integresql", StatsdAddress: conn.LocalAddr().String()})
+	require.NoError(t, err)
+	defer statsd.Close()
+	assert.Nil(t, statsd.Handler())
+
+	statsd.Inc(metrics.TemplateOperations, metrics.Labels{metrics.LabelResult: "success", metrics.LabelOperation: "initialize"})
+	assert.Equal(t, "integresql.template_operations.initialize.success:1|c", receive())
+
+	statsd.Observe(metrics.TemplateOperationDuration, 1500*time.Microsecond, metrics.Labels{metrics.LabelOperation: "finalize"})
+	assert.Equal(t, "integresql.template_operation_duration.finalize:1.500|ms", receive())
+
+	dogstatsd, err := metrics.New(metrics.Config{Backend: metrics.BackendDogStatsd, Prefix: "integresql", StatsdAddress: conn.LocalAddr().String()})
+	require.NoError(t, err)
+	defer dogstatsd.Close()
+
+	dogstatsd.Inc(metrics.TestDatabaseOperations, metrics.Labels{metrics.LabelResult: "timeout", metrics.LabelOperation: "get"})
+	assert.Equal(t, "integresql.test_database_operations:1|c|#operation:get,result:timeout", receive())
+
+	// unknown metrics get their tags sorted by name
+	dogstatsd.Observe("custom", time.Millisecond, metrics.Labels{"b": "x|y", "a": "1"})
+	assert.Equal(t, "integresql.custom:1.000|ms|#a:1,b:x_y", receive())
+}
+
+func TestStatsdRuntime(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer conn.Close()
+
+	statsd, err := metrics.New(metrics.Config{Backend: metrics.BackendStatsd, Prefix: "integresql", StatsdAddress: conn.LocalAddr().String(), RuntimeInterval: 10 * time.Millisecond})
+	require.NoError(t, err)
+
+	received := map[string]bool{}
+	buf := make([]byte, 1024)
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+	for len(received) < 6 {
+		n, _, err := conn.ReadFrom(buf)
+		require.NoError(t, err)
+
+		name, value, ok := strings.Cut(string(buf[:n]), ":")
+		require.True(t, ok)
+		assert.True(t, strings.HasSuffix(value, "|g"), value)
+		received[name] = true
+	}
+
+	assert.True(t, received["integresql."+metrics.RuntimeGoroutines])
+	assert.True(t, received["integresql."+metrics.RuntimeHeapAllocBytes])
+	assert.True(t, received["integresql."+metrics.RuntimeGCPauseTotalMs])
+
+	// stops pushing
+	require.NoError(t, statsd.Close())
+}
+
+func TestStatsdCollect(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer conn.Close()
+
+	statsd, err := metrics.New(metrics.Config{Backend: metrics.BackendDogStatsd, Prefix: "integresql", StatsdAddress: conn.LocalAddr().String(), GaugeInterval: 10 * time.Millisecond})
+	require.NoError(t, err)
+
+	statsd.Collect(func() []metrics.Sample {
+		return []metrics.Sample{{Name: metrics.PoolTestDatabases, Value: 3, Labels: metrics.Labels{metrics.LabelState: "ready", metrics.LabelHash: "h1"}}}
+	})
+
+	buf := make([]byte, 1024)
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+	n, _, err := conn.ReadFrom(buf)
+	require.NoError(t, err)
+	assert.Equal(t, "integresql.pool_test_databases:3|g|#hash:h1,state:ready", string(buf[:n]))
+
+	// stops pushing
+	require.NoError(t, statsd.Close())
+}
@@ -0,0 +1,166 @@
+package metrics
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+type prometheusMetrics struct {
+	registry   *prometheus.Registry
+	counters   map[string]*prometheus.CounterVec
+	histograms map[string]*prometheus.HistogramVec
+	samples    *sampleCollector
+}
+
+func newPrometheusMetrics(config Config) (*prometheusMetrics, error) {
+	m := &prometheusMetrics{
+		registry:   prometheus.NewRegistry(),
+		counters:   make(map[string]*prometheus.CounterVec),
+		histograms: make(map[string]*prometheus.HistogramVec),
+		samples:    &sampleCollector{descs: make(map[string]*prometheus.Desc), types: make(map[string]prometheus.ValueType), labels: make(map[string][]string)},
+	}
+
+	if err := m.registry.Register(collectors.NewGoCollector()); err != nil {
+		return nil, err
+	}
+
+	if err := m.registry.Register(collectors.NewProcessCollector(collectors.ProcessCollectorOpts{})); err != nil {
+		return nil, err
+	}
+
+	for _, def := range definitions {
+		var collector prometheus.Collector
+
+		switch def.kind {
+		case kindCounter:
+			counter := prometheus.NewCounterVec(prometheus.CounterOpts{
+				Namespace: config.Prefix,
+				Name:      def.name + "_total",
+				Help:      def.help,
+			}, def.labels)
+			m.counters[def.name] = counter
+			collector = counter
+		case kindHistogram:
+			histogram := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+				Namespace: config.Prefix,
+				Name:      def.name + "_seconds",
+				Help:      def.help,
+				Buckets:   prometheus.DefBuckets,
+			}, def.labels)
+			m.histograms[def.name] = histogram
+			collector = histogram
+		case kindGauge:
+			m.samples.add(prometheus.BuildFQName(config.Prefix, "", def.name), def, prometheus.GaugeValue)
+			continue
+		case kindAbsoluteCounter:
+			m.samples.add(prometheus.BuildFQName(config.Prefix, "", def.name+"_total"), def, prometheus.CounterValue)
+			continue
+		}
+
+		if err := m.registry.Register(collector); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := m.registry.Register(m.samples); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+func (m *prometheusMetrics) Inc(name string, labels Labels) {
+	counter, ok := m.counters[name]
+	if !ok {
+		return
+	}
+
+	// mismatching labels are a programming error, better lose the value than panic
+	if c, err := counter.GetMetricWith(prometheus.Labels(labels)); err == nil {
+		c.Inc()
+	}
+}
+
+func (m *prometheusMetrics) Observe(name string, d time.Duration, labels Labels) {
+	histogram, ok := m.histograms[name]
+	if !ok {
+		return
+	}
+
+	if h, err := histogram.GetMetricWith(prometheus.Labels(labels)); err == nil {
+		h.Observe(d.Seconds())
+	}
+}
+
+func (m *prometheusMetrics) Collect(collector Collector) {
+	m.samples.register(collector)
+}
+
+func (m *prometheusMetrics) Handler() http.Handler {
+	// compression is up to the server (gzip middleware)
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{DisableCompression: true})
+}
+
+func (m *prometheusMetrics) Close() error {
+	return nil
+}
+
+// sampleCollector reports the samples of all registered collectors as const metrics while being scraped, series no
+// longer reported (e.g. pools of discarded templates) vanish right away.
+type sampleCollector struct {
+	descs  map[string]*prometheus.Desc
+	types  map[string]prometheus.ValueType
+	labels map[string][]string
+
+	collectors []Collector
+	mutex      sync.Mutex
+}
+
+func (c *sampleCollector) add(fqName string, def definition, valueType prometheus.ValueType) {
+	c.descs[def.name] = prometheus.NewDesc(fqName, def.help, def.labels, nil)
+	c.types[def.name] = valueType
+	c.labels[def.name] = def.labels
+}
+
+func (c *sampleCollector) register(collector Collector) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.collectors = append(c.collectors, collector)
+}
+
+func (c *sampleCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range c.descs {
+		ch <- desc
+	}
+}
+
+func (c *sampleCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mutex.Lock()
+	collectors := append([]Collector{}, c.collectors...)
+	c.mutex.Unlock()
+
+	for _, collector := range collectors {
+		for _, sample := range collector() {
+			desc, ok := c.descs[sample.Name]
+			if !ok || len(sample.Labels) != len(c.labels[sample.Name]) {
+				continue
+			}
+
+			values := make([]string, 0, len(sample.Labels))
+			for _, label := range c.labels[sample.Name] {
+				values = append(values, sample.Labels[label])
+			}
+
+			// mismatching labels are a programming error, better lose the value than fail the scrape
+			if metric, err := prometheus.NewConstMetric(desc, c.types[sample.Name], sample.Value, values...); err == nil {
+				ch <- metric
+			}
+		}
+	}
+}
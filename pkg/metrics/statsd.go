@@ -0,0 +1,197 @@
+package metrics
+
+import (
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/allaboutapps/integresql/pkg/util"
+)
+
+// statsdMetrics sends each value as a single UDP packet (fire and forget), counters as "|c" and durations as "|ms" timers.
+// Plain statsd doesn't know about labels, their values are appended to the metric name in the defined order instead
+// (e.g. "integresql.test_database_operations.get.success"). DogStatsD receives them as tags.
+type statsdMetrics struct {
+	conn        net.Conn
+	prefix      string
+	tags        bool
+	labelOrders map[string][]string
+
+	collectors []Collector
+	mutex      sync.Mutex
+
+	stop    chan struct{} // stops pushing the runtime and collected gauges
+	stopped sync.WaitGroup
+}
+
+var statsdReplacer = strings.NewReplacer(":", "_", "|", "_", "@", "_", "#", "_", ",", "_", ".", "_", " ", "_")
+
+func newStatsdMetrics(config Config, tags bool) (*statsdMetrics, error) {
+	conn, err := net.Dial("udp", config.StatsdAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &statsdMetrics{
+		conn:        conn,
+		prefix:      config.Prefix,
+		tags:        tags,
+		labelOrders: make(map[string][]string, len(definitions)),
+		stop:        make(chan struct{}),
+	}
+
+	for _, def := range definitions {
+		m.labelOrders[def.name] = def.labels
+	}
+
+	if config.RuntimeInterval > 0 {
+		m.stopped.Add(1)
+		go m.pushRuntime(config.RuntimeInterval)
+	}
+
+	if config.GaugeInterval > 0 {
+		m.stopped.Add(1)
+		go m.pushCollected(config.GaugeInterval)
+	}
+
+	return m, nil
+}
+
+func (m *statsdMetrics) Inc(name string, labels Labels) {
+	m.send(name, "1|c", labels)
+}
+
+func (m *statsdMetrics) Observe(name string, d time.Duration, labels Labels) {
+	m.send(name, strconv.FormatFloat(float64(d)/float64(time.Millisecond), 'f', 3, 64)+"|ms", labels)
+}
+
+func (m *statsdMetrics) Collect(collector Collector) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.collectors = append(m.collectors, collector)
+}
+
+func (m *statsdMetrics) Handler() http.Handler {
+	return nil
+}
+
+func (m *statsdMetrics) Close() error {
+	close(m.stop)
+	m.stopped.Wait()
+
+	return m.conn.Close()
+}
+
+// pushRuntime sends the Go runtime gauges ("|g") every interval until the backend is closed.
+func (m *statsdMetrics) pushRuntime(interval time.Duration) {
+	defer m.stopped.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.stop:
+			return
+		case <-ticker.C:
+			m.sendRuntime(util.ReadRuntimeStats())
+		}
+	}
+}
+
+func (m *statsdMetrics) sendRuntime(stats util.RuntimeStats) {
+	m.send(RuntimeGoroutines, strconv.Itoa(stats.Goroutines)+"|g", nil)
+	m.send(RuntimeHeapAllocBytes, strconv.FormatUint(stats.HeapAllocBytes, 10)+"|g", nil)
+	m.send(RuntimeHeapSysBytes, strconv.FormatUint(stats.HeapSysBytes, 10)+"|g", nil)
+	m.send(RuntimeHeapObjects, strconv.FormatUint(stats.HeapObjects, 10)+"|g", nil)
+	m.send(RuntimeNumGC, strconv.FormatUint(uint64(stats.NumGC), 10)+"|g", nil)
+	m.send(RuntimeGCPauseTotalMs, strconv.FormatFloat(stats.GCPauseTotalMs, 'f', 3, 64)+"|g", nil)
+}
+
+// pushCollected sends the samples of all collectors as gauges ("|g", including cumulative counters) every interval
+// until the backend is closed.
+func (m *statsdMetrics) pushCollected(interval time.Duration) {
+	defer m.stopped.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.stop:
+			return
+		case <-ticker.C:
+			m.mutex.Lock()
+			collectors := append([]Collector{}, m.collectors...)
+			m.mutex.Unlock()
+
+			for _, collector := range collectors {
+				for _, sample := range collector() {
+					m.send(sample.Name, strconv.FormatFloat(sample.Value, 'f', -1, 64)+"|g", sample.Labels)
+				}
+			}
+		}
+	}
+}
+
+func (m *statsdMetrics) send(name string, value string, labels Labels) {
+	// send errors (e.g. no agent listening) must never affect the caller
+	_, _ = m.conn.Write([]byte(m.format(name, value, labels)))
+}
+
+func (m *statsdMetrics) format(name string, value string, labels Labels) string {
+	var b strings.Builder
+
+	if len(m.prefix) > 0 {
+		b.WriteString(m.prefix)
+		b.WriteString(".")
+	}
+	b.WriteString(name)
+
+	if !m.tags {
+		for _, label := range m.labelOrder(name, labels) {
+			if v, ok := labels[label]; ok {
+				b.WriteString(".")
+				b.WriteString(statsdReplacer.Replace(v))
+			}
+		}
+	}
+
+	b.WriteString(":")
+	b.WriteString(value)
+
+	if m.tags {
+		sep := "|#"
+		for _, label := range m.labelOrder(name, labels) {
+			if v, ok := labels[label]; ok {
+				b.WriteString(sep)
+				b.WriteString(statsdReplacer.Replace(label))
+				b.WriteString(":")
+				b.WriteString(statsdReplacer.Replace(v))
+				sep = ","
+			}
+		}
+	}
+
+	return b.String()
+}
+
+// labelOrder returns the defined order of the labels of the metric, sorted label names for unknown metrics.
+func (m *statsdMetrics) labelOrder(name string, labels Labels) []string {
+	if order, ok := m.labelOrders[name]; ok {
+		return order
+	}
+
+	order := make([]string, 0, len(labels))
+	for label := range labels {
+		order = append(order, label)
+	}
+	sort.Strings(order)
+
+	return order
+}
@@ -0,0 +1,473 @@
+// Package oci distributes template dumps as OCI artifacts via a container registry (OCI distribution API), tagged by
+// the template hash. Teams reuse the auth and caching infrastructure of their registry instead of sharing volumes.
+//
+// Each artifact consists of an empty config and a single layer holding the pg_dump (custom format) of the template.
+package oci
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	ErrNotFound   = errors.New("artifact not found")
+	ErrInvalidTag = errors.New("invalid artifact tag")
+)
+
+// Media types of the artifact, see the package docs.
+const (
+	ArtifactType   = "application/vnd.integresql.template.v1"
+	LayerMediaType = "application/vnd.integresql.template.dump.v1" // pg_dump custom format
+
+	manifestMediaType    = "application/vnd.oci.image.manifest.v1+json"
+	emptyConfigMediaType = "application/vnd.oci.empty.v1+json"
+)
+
+// the empty config ("{}") of all artifacts
+var emptyConfig = []byte("{}")
+
+// tags of the OCI distribution spec
+var tagRegexp = regexp.MustCompile(`^[a-zA-Z0-9_][a-zA-Z0-9._-]{0,127}$`)
+
+type Config struct {
+	Registry   string // host[:port] of the registry (e.g. "ghcr.io"), empty disables the distribution
+	Repository string // e.g. "my-org/integresql-templates"
+	Username   string
+	Password   string `json:"-"` // sensitive, e.g. a registry token
+	PlainHTTP  bool   // connect via http instead of https (e.g. a local registry)
+}
+
+// Enabled returns true if a registry is configured.
+func (c Config) Enabled() bool {
+	return len(c.Registry) > 0 && len(c.Repository) > 0
+}
+
+// ValidTag returns an error if the tag (typically a template hash) can't be used as OCI tag.
+func ValidTag(tag string) error {
+	if !tagRegexp.MatchString(tag) {
+		return fmt.Errorf("%w: %q", ErrInvalidTag, tag)
+	}
+
+	return nil
+}
+
+type descriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+type manifest struct {
+	SchemaVersion int          `json:"schemaVersion"`
+	MediaType     string       `json:"mediaType"`
+	ArtifactType  string       `json:"artifactType"`
+	Config        descriptor   `json:"config"`
+	Layers        []descriptor `json:"layers"`
+}
+
+// Client pushes and pulls artifacts of the configured repository.
+type Client struct {
+	config Config
+	http   *http.Client
+
+	authorization string // cached Authorization header (basic or bearer token), empty until challenged
+	mutex         sync.Mutex
+}
+
+func NewClient(config Config) *Client {
+	return &Client{config: config, http: &http.Client{}}
+}
+
+// Push uploads the file as artifact tagged with the tag, returning the digest of its manifest.
+func (c *Client) Push(ctx context.Context, tag string, path string) (string, error) {
+	if err := ValidTag(tag); err != nil {
+		return "", err
+	}
+
+	layer, err := fileDescriptor(path)
+	if err != nil {
+		return "", err
+	}
+	layer.MediaType = LayerMediaType
+	layer.Annotations = map[string]string{"org.opencontainers.image.title": tag + ".dump"}
+
+	if err := c.pushBlob(ctx, layer.Digest, layer.Size, func() (io.ReadCloser, error) { return os.Open(path) }); err != nil {
+		return "", err
+	}
+
+	config := descriptor{MediaType: emptyConfigMediaType, Digest: digestOf(emptyConfig), Size: int64(len(emptyConfig))}
+	if err := c.pushBlob(ctx, config.Digest, config.Size, func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(emptyConfig)), nil }); err != nil {
+		return "", err
+	}
+
+	body, err := json.Marshal(manifest{
+		SchemaVersion: 2,
+		MediaType:     manifestMediaType,
+		ArtifactType:  ArtifactType,
+		Config:        config,
+		Layers:        []descriptor{layer},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	res, err := c.do(ctx, http.MethodPut, c.url("manifests/"+tag), map[string]string{"Content-Type": manifestMediaType}, bytesBody(body))
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	if err := expectStatus(res, http.StatusCreated); err != nil {
+		return "", fmt.Errorf("pushing the manifest failed: %w", err)
+	}
+
+	return digestOf(body), nil
+}
+
+// Pull downloads the dump of the artifact tagged with the tag into the file at path (written atomically).
+// Returns ErrNotFound if there is no such artifact.
+func (c *Client) Pull(ctx context.Context, tag string, path string) error {
+	if err := ValidTag(tag); err != nil {
+		return err
+	}
+
+	res, err := c.do(ctx, http.MethodGet, c.url("manifests/"+tag), map[string]string{"Accept": manifestMediaType}, nil)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("%w: %s:%s", ErrNotFound, c.config.Repository, tag)
+	}
+
+	if err := expectStatus(res, http.StatusOK); err != nil {
+		return fmt.Errorf("pulling the manifest failed: %w", err)
+	}
+
+	var m manifest
+	if err := json.NewDecoder(res.Body).Decode(&m); err != nil {
+		return fmt.Errorf("decoding the manifest failed: %w", err)
+	}
+
+	var layer *descriptor
+	for i := range m.Layers {
+		if m.Layers[i].MediaType == LayerMediaType {
+			layer = &m.Layers[i]
+			break
+		}
+	}
+
+	if layer == nil {
+		return fmt.Errorf("%w: %s:%s is no template artifact (%s)", ErrNotFound, c.config.Repository, tag, m.ArtifactType)
+	}
+
+	return c.pullBlob(ctx, *layer, path)
+}
+
+func (c *Client) pushBlob(ctx context.Context, digest string, size int64, open func() (io.ReadCloser, error)) error {
+	res, err := c.do(ctx, http.MethodHead, c.url("blobs/"+digest), nil, nil)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+
+	if res.StatusCode == http.StatusOK {
+		// already known to the registry (e.g. an unchanged template pushed with another tag)
+		return nil
+	}
+
+	res, err = c.do(ctx, http.MethodPost, c.url("blobs/uploads/"), nil, nil)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+
+	if err := expectStatus(res, http.StatusAccepted); err != nil {
+		return fmt.Errorf("starting the upload of %s failed: %w", digest, err)
+	}
+
+	location, err := res.Request.URL.Parse(res.Header.Get("Location"))
+	if err != nil {
+		return fmt.Errorf("invalid upload location: %w", err)
+	}
+
+	// monolithic upload, the location may already carry query params (e.g. an upload state)
+	query := location.Query()
+	query.Set("digest", digest)
+	location.RawQuery = query.Encode()
+
+	headers := map[string]string{"Content-Type": "application/octet-stream", "Content-Length": fmt.Sprintf("%d", size)}
+	res, err = c.do(ctx, http.MethodPut, location.String(), headers, open)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+
+	if err := expectStatus(res, http.StatusCreated); err != nil {
+		return fmt.Errorf("uploading %s failed: %w", digest, err)
+	}
+
+	return nil
+}
+
+func (c *Client) pullBlob(ctx context.Context, layer descriptor, path string) error {
+	res, err := c.do(ctx, http.MethodGet, c.url("blobs/"+layer.Digest), nil, nil)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if err := expectStatus(res, http.StatusOK); err != nil {
+		return fmt.Errorf("pulling %s failed: %w", layer.Digest, err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".integresql-oci-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(tmp, hash), res.Body); err != nil {
+		tmp.Close()
+		return fmt.Errorf("pulling %s failed: %w", layer.Digest, err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if digest := "sha256:" + hex.EncodeToString(hash.Sum(nil)); digest != layer.Digest {
+		return fmt.Errorf("pulled blob has the digest %s instead of %s", digest, layer.Digest)
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+func (c *Client) url(path string) string {
+	scheme := "https"
+	if c.config.PlainHTTP {
+		scheme = "http"
+	}
+
+	return fmt.Sprintf("%s://%s/v2/%s/%s", scheme, c.config.Registry, c.config.Repository, path)
+}
+
+// do sends the request, answering an auth challenge of the registry (basic or bearer token) once.
+// open provides the body of each attempt, nil sends none.
+func (c *Client) do(ctx context.Context, method string, u string, headers map[string]string, open func() (io.ReadCloser, error)) (*http.Response, error) {
+	send := func() (*http.Response, error) {
+		var body io.ReadCloser
+		if open != nil {
+			var err error
+			if body, err = open(); err != nil {
+				return nil, err
+			}
+		}
+
+		req, err := http.NewRequestWithContext(ctx, method, u, body)
+		if err != nil {
+			if body != nil {
+				body.Close()
+			}
+			return nil, err
+		}
+
+		for key, value := range headers {
+			if key == "Content-Length" {
+				// a streamed file is sent chunked otherwise, which not all registries support
+				req.ContentLength, _ = strconv.ParseInt(value, 10, 64)
+				continue
+			}
+			req.Header.Set(key, value)
+		}
+
+		c.mutex.Lock()
+		if len(c.authorization) > 0 {
+			req.Header.Set("Authorization", c.authorization)
+		}
+		c.mutex.Unlock()
+
+		return c.http.Do(req)
+	}
+
+	res, err := send()
+	if err != nil || res.StatusCode != http.StatusUnauthorized {
+		return res, err
+	}
+
+	challenge := res.Header.Get("WWW-Authenticate")
+	res.Body.Close()
+
+	if err := c.authorize(ctx, challenge); err != nil {
+		return nil, err
+	}
+
+	return send()
+}
+
+// authorize answers the challenge of the registry, caching the resulting Authorization header.
+func (c *Client) authorize(ctx context.Context, challenge string) error {
+	scheme, params := parseChallenge(challenge)
+
+	switch strings.ToLower(scheme) {
+	case "basic":
+		req, _ := http.NewRequest(http.MethodGet, "/", nil)
+		req.SetBasicAuth(c.config.Username, c.config.Password)
+
+		c.mutex.Lock()
+		c.authorization = req.Header.Get("Authorization")
+		c.mutex.Unlock()
+
+		return nil
+	case "bearer":
+		token, err := c.fetchToken(ctx, params)
+		if err != nil {
+			return err
+		}
+
+		c.mutex.Lock()
+		c.authorization = "Bearer " + token
+		c.mutex.Unlock()
+
+		return nil
+	default:
+		return fmt.Errorf("unsupported auth challenge of the registry: %q", challenge)
+	}
+}
+
+// fetchToken requests a bearer token from the realm of the challenge (docker token auth), anonymous without credentials.
+func (c *Client) fetchToken(ctx context.Context, params map[string]string) (string, error) {
+	realm, err := url.Parse(params["realm"])
+	if err != nil || len(params["realm"]) == 0 {
+		return "", fmt.Errorf("invalid token realm %q of the registry", params["realm"])
+	}
+
+	scope := params["scope"]
+	if len(scope) == 0 {
+		scope = fmt.Sprintf("repository:%s:pull,push", c.config.Repository)
+	}
+
+	query := realm.Query()
+	query.Set("service", params["service"])
+	query.Set("scope", scope)
+	realm.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, realm.String(), nil)
+	if err != nil {
+		return "", err
+	}
+
+	if len(c.config.Username) > 0 || len(c.config.Password) > 0 {
+		req.SetBasicAuth(c.config.Username, c.config.Password)
+	}
+
+	res, err := c.http.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	if err := expectStatus(res, http.StatusOK); err != nil {
+		return "", fmt.Errorf("fetching a registry token failed: %w", err)
+	}
+
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&token); err != nil {
+		return "", fmt.Errorf("decoding the registry token failed: %w", err)
+	}
+
+	if len(token.Token) > 0 {
+		return token.Token, nil
+	}
+
+	return token.AccessToken, nil
+}
+
+// parseChallenge parses a WWW-Authenticate header, e.g. `Bearer realm="https://auth.example.com/token",service="registry"`.
+func parseChallenge(challenge string) (string, map[string]string) {
+	scheme, rest, _ := strings.Cut(strings.TrimSpace(challenge), " ")
+	params := make(map[string]string)
+
+	for len(rest) > 0 {
+		rest = strings.TrimLeft(rest, " ,")
+
+		key, value, ok := strings.Cut(rest, "=")
+		if !ok {
+			break
+		}
+
+		if strings.HasPrefix(value, `"`) {
+			end := strings.Index(value[1:], `"`)
+			if end < 0 {
+				params[strings.TrimSpace(key)] = value[1:]
+				break
+			}
+			params[strings.TrimSpace(key)] = value[1 : end+1]
+			rest = value[end+2:]
+		} else {
+			v, remainder, _ := strings.Cut(value, ",")
+			params[strings.TrimSpace(key)] = v
+			rest = remainder
+		}
+	}
+
+	return scheme, params
+}
+
+func expectStatus(res *http.Response, status int) error {
+	if res.StatusCode == status {
+		return nil
+	}
+
+	b, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+	return fmt.Errorf("received unexpected HTTP status %d (%s): %s", res.StatusCode, res.Status, strings.TrimSpace(string(b)))
+}
+
+func fileDescriptor(path string) (descriptor, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return descriptor{}, err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, f)
+	if err != nil {
+		return descriptor{}, err
+	}
+
+	return descriptor{Digest: "sha256:" + hex.EncodeToString(hash.Sum(nil)), Size: size}, nil
+}
+
+func digestOf(b []byte) string {
+	sum := sha256.Sum256(b)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+func bytesBody(b []byte) func() (io.ReadCloser, error) {
+	return func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(b)), nil }
+}
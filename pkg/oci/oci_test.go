@@ -0,0 +1,169 @@
+package oci_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/allaboutapps/integresql/pkg/oci"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// registry is a minimal in-memory registry (OCI distribution API), requiring a bearer token fetched via basic auth.
+type registry struct {
+	blobs     map[string][]byte
+	manifests map[string][]byte
+	uploads   int
+	mutex     sync.Mutex
+}
+
+func newRegistry(t *testing.T) (*registry, *httptest.Server) {
+	t.Helper()
+
+	r := &registry{blobs: make(map[string][]byte), manifests: make(map[string][]byte)}
+
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/token" {
+			if user, pass, ok := req.BasicAuth(); !ok || user != "user" || pass != "secret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			fmt.Fprint(w, `{"token":"t0ken"}`)
+			return
+		}
+
+		if req.Header.Get("Authorization") != "Bearer t0ken" {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="test",scope="repository:team/templates:pull,push"`, server.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+
+		path := strings.TrimPrefix(req.URL.Path, "/v2/team/templates/")
+		switch {
+		case strings.HasPrefix(path, "blobs/uploads/") && req.Method == http.MethodPost:
+			w.Header().Set("Location", "/v2/team/templates/blobs/uploads/1?state=x")
+			w.WriteHeader(http.StatusAccepted)
+		case strings.HasPrefix(path, "blobs/uploads/") && req.Method == http.MethodPut:
+			b, _ := io.ReadAll(req.Body)
+			sum := sha256.Sum256(b)
+			if digest := "sha256:" + hex.EncodeToString(sum[:]); digest != req.URL.Query().Get("digest") || req.URL.Query().Get("state") != "x" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			r.blobs[req.URL.Query().Get("digest")] = b
+			r.uploads++
+			w.WriteHeader(http.StatusCreated)
+		case strings.HasPrefix(path, "blobs/"):
+			b, ok := r.blobs[strings.TrimPrefix(path, "blobs/")]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			if req.Method == http.MethodGet {
+				_, _ = w.Write(b)
+			}
+		case strings.HasPrefix(path, "manifests/") && req.Method == http.MethodPut:
+			b, _ := io.ReadAll(req.Body)
+			r.manifests[strings.TrimPrefix(path, "manifests/")] = b
+			w.WriteHeader(http.StatusCreated)
+		case strings.HasPrefix(path, "manifests/"):
+			b, ok := r.manifests[strings.TrimPrefix(path, "manifests/")]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			_, _ = w.Write(b)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	return r, server
+}
+
+func testClient(t *testing.T, server *httptest.Server, password string) *oci.Client {
+	t.Helper()
+
+	u, err := url.Parse(server.URL)
+	require.NoError(t, err)
+
+	return oci.NewClient(oci.Config{Registry: u.Host, Repository: "team/templates", Username: "user", Password: password, PlainHTTP: true})
+}
+
+func TestPushPull(t *testing.T) {
+	ctx := context.Background()
+	r, server := newRegistry(t)
+	client := testClient(t, server, "secret")
+
+	dir := t.TempDir()
+	src := filepath.Join(dir, "template.dump")
+	require.NoError(t, os.WriteFile(src, []byte("PGDMP dump content"), 0o600))
+
+	digest, err := client.Push(ctx, "abc123", src)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(digest, "sha256:"))
+	assert.Equal(t, 2, r.uploads) // layer and empty config
+	assert.Contains(t, string(r.manifests["abc123"]), oci.ArtifactType)
+
+	// pushing unchanged content again reuses the known blobs
+	_, err = client.Push(ctx, "def456", src)
+	require.NoError(t, err)
+	assert.Equal(t, 2, r.uploads)
+
+	// a fresh client (e.g. another instance) pulls lazily
+	dst := filepath.Join(dir, "cache", "abc123.dump")
+	require.NoError(t, testClient(t, server, "secret").Pull(ctx, "abc123", dst))
+
+	b, err := os.ReadFile(dst)
+	require.NoError(t, err)
+	assert.Equal(t, "PGDMP dump content", string(b))
+}
+
+func TestPullErrors(t *testing.T) {
+	ctx := context.Background()
+	r, server := newRegistry(t)
+	client := testClient(t, server, "secret")
+	dst := filepath.Join(t.TempDir(), "x.dump")
+
+	err := client.Pull(ctx, "unknown", dst)
+	assert.ErrorIs(t, err, oci.ErrNotFound)
+
+	err = client.Pull(ctx, "no/tag", dst)
+	assert.ErrorIs(t, err, oci.ErrInvalidTag)
+
+	err = testClient(t, server, "wrong").Pull(ctx, "unknown", dst)
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, oci.ErrNotFound)
+
+	// a corrupted blob is rejected, the destination isn't written
+	src := filepath.Join(t.TempDir(), "template.dump")
+	require.NoError(t, os.WriteFile(src, []byte("PGDMP"), 0o600))
+	_, err = client.Push(ctx, "abc", src)
+	require.NoError(t, err)
+
+	r.mutex.Lock()
+	for digest := range r.blobs {
+		r.blobs[digest] = []byte("corrupted")
+	}
+	r.mutex.Unlock()
+
+	err = client.Pull(ctx, "abc", dst)
+	assert.ErrorContains(t, err, "digest")
+	assert.NoFileExists(t, dst)
+}
@@ -0,0 +1,91 @@
+package pool
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/allaboutapps/integresql/pkg/db"
+)
+
+// AdoptedTestDatabase is a testdatabase created by a previous run (e.g. before a restart), adopted by a new pool
+// instead of cloning it again.
+type AdoptedTestDatabase struct {
+	ID int
+
+	// Ready testdatabases are handed out as-is. All others are considered checked out since the adoption (their client
+	// may still use them), they are recreated as soon as they are returned or eligible for auto-cleaning.
+	Ready bool
+}
+
+// InitHashPoolWithAdopted creates a new pool like InitHashPoolWithConfig, starting with the adopted testdatabases
+// instead of an empty pool. As IDs index the pool, only the adopted IDs forming a gapless sequence from 0 (below
+// MaxPoolSize) are adopted. The IDs of the rejected ones are returned, growing the pool recreates them.
+func (p *PoolCollection) InitHashPoolWithAdopted(ctx context.Context, templateDB db.Database, initDBFunc RecreateDBFunc, cfg PoolConfig, adopted []AdoptedTestDatabase) (rejected []int) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	pool := NewHashPool(cfg, templateDB, initDBFunc)
+	pool.fillSlots = p.fillSlots
+
+	rejected = pool.adopt(adopted)
+
+	if !cfg.disableWorkerAutostart {
+		pool.Start()
+	}
+
+	p.pools[pool.templateDB.TemplateHash] = pool
+
+	log := pool.getPoolLogger(ctx, "InitHashPoolWithAdopted")
+	log.Info().Int("adopted", len(pool.dbs)).Ints("rejected", rejected).Int("initialPoolSize", cfg.InitialPoolSize).Int("maxPoolSize", cfg.MaxPoolSize).Msg("pool created")
+
+	return rejected
+}
+
+// adopt appends the adopted testdatabases to the (not yet started) pool, see InitHashPoolWithAdopted.
+func (pool *HashPool) adopt(adopted []AdoptedTestDatabase) (rejected []int) {
+	pool.Lock()
+	defer pool.Unlock()
+
+	sort.Slice(adopted, func(i, j int) bool { return adopted[i].ID < adopted[j].ID })
+
+	rejected = make([]int, 0)
+	now := time.Now()
+
+	for _, a := range adopted {
+		if a.ID != len(pool.dbs) || a.ID >= pool.MaxPoolSize {
+			rejected = append(rejected, a.ID)
+			continue
+		}
+
+		testDB := existingDB{
+			state: dbStateReady,
+			TestDatabase: db.TestDatabase{
+				Database: db.Database{
+					TemplateHash: pool.templateDB.TemplateHash,
+					Config:       pool.testDBConfig(a.ID),
+				},
+				ID: a.ID,
+			},
+			generation:  1,
+			recreatedAt: now,
+			lastUsedAt:  now,
+		}
+
+		if a.Ready {
+			pool.dbs = append(pool.dbs, testDB)
+			pool.ready <- a.ID
+			continue
+		}
+
+		testDB.state = dbStateDirty
+		testDB.checkedOutAt = now
+		testDB.checkouts = 1
+		pool.unsafeStartLease(context.Background(), &testDB)
+
+		pool.dbs = append(pool.dbs, testDB)
+		pool.dirty <- a.ID
+	}
+
+	return rejected
+}
@@ -0,0 +1,81 @@
+package pool
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/allaboutapps/integresql/pkg/db"
+)
+
+type holderKey struct{}
+
+// WithHolder returns a copy of ctx identifying the holder of the testdatabases checked out with it (e.g. the CI job
+// "worker-12"), reported by Checkouts and the checkout events.
+func WithHolder(ctx context.Context, holder string) context.Context {
+	return context.WithValue(ctx, holderKey{}, holder)
+}
+
+func holderFromContext(ctx context.Context) string {
+	holder, _ := ctx.Value(holderKey{}).(string)
+	return holder
+}
+
+// Checkout of a testdatabase, combining its checkout age with its lease (see RenewTestDatabase).
+type Checkout struct {
+	db.TestDatabase
+	CheckedOutAt   time.Time
+	Holder         string    // empty if unknown (see WithHolder)
+	LeaseExpiresAt time.Time // zero if the testdatabase is never auto-cleaned (overflow)
+}
+
+// Checkouts returns all currently checked out testdatabases (including overflow ones) ordered by ID.
+func (pool *HashPool) Checkouts() []Checkout {
+	pool.RLock()
+	defer pool.RUnlock()
+
+	checkouts := make([]Checkout, 0)
+	for _, testDB := range pool.dbs {
+		if !testDB.checkedOutAt.IsZero() {
+			checkouts = append(checkouts, Checkout{
+				TestDatabase:   testDB.TestDatabase,
+				CheckedOutAt:   testDB.checkedOutAt,
+				Holder:         testDB.checkedOutBy,
+				LeaseExpiresAt: testDB.blockAutoCleanDirtyUntil,
+			})
+		}
+	}
+
+	for _, testDB := range pool.overflow {
+		if !testDB.checkedOutAt.IsZero() {
+			checkouts = append(checkouts, Checkout{
+				TestDatabase: testDB.TestDatabase,
+				CheckedOutAt: testDB.checkedOutAt,
+				Holder:       testDB.checkedOutBy,
+			})
+		}
+	}
+
+	sort.Slice(checkouts, func(i, j int) bool { return checkouts[i].ID < checkouts[j].ID })
+
+	return checkouts
+}
+
+// Checkouts returns the currently checked out testdatabases of all tracked pools ordered by their template hash and ID.
+func (p *PoolCollection) Checkouts(_ context.Context) []Checkout {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	hashes := make([]string, 0, len(p.pools))
+	for hash := range p.pools {
+		hashes = append(hashes, hash)
+	}
+	sort.Strings(hashes)
+
+	checkouts := make([]Checkout, 0)
+	for _, hash := range hashes {
+		checkouts = append(checkouts, p.pools[hash].Checkouts()...)
+	}
+
+	return checkouts
+}
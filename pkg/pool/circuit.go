@@ -0,0 +1,258 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/allaboutapps/integresql/pkg/events"
+	"github.com/rs/zerolog"
+)
+
+var ErrCircuitOpen = errors.New("circuit breaker of the pool is open")
+
+const minCircuitProbeInterval = 10 * time.Millisecond
+
+// CircuitState describes the circuit breaker of a pool, see PoolConfig.CircuitBreakerThreshold.
+type CircuitState string
+
+const (
+	CircuitClosed   CircuitState = "closed"    // testdatabases are (re)created as usual
+	CircuitOpen     CircuitState = "open"      // (re)creations failed consecutively, acquisitions fail fast and background (re)creations are paused
+	CircuitHalfOpen CircuitState = "half-open" // a single testdatabase is recreated to probe whether (re)creations succeed again
+)
+
+// CircuitStats describes the (re)creations of the testdatabases of a pool and its circuit breaker.
+type CircuitStats struct {
+	State               CircuitState `json:"state"`
+	ConsecutiveFailures int          `json:"consecutiveFailures"`
+	Successes           int          `json:"successes"`           // total successful (re)creations
+	Failures            int          `json:"failures"`            // total failed (re)creations (excluding retries while in use)
+	Opened              int          `json:"opened"`              // number of times the circuit breaker opened
+	OpenedAt            *time.Time   `json:"openedAt,omitempty"`  // nil while closed
+	LastError           string       `json:"lastError,omitempty"` // of the last failed (re)creation
+}
+
+type circuitBreaker struct {
+	state               CircuitState
+	consecutiveFailures int
+	successes           int
+	failures            int
+	opened              int
+	openedAt            time.Time
+	lastErr             error
+	probeID             int          // testdatabase recreated while half-open
+	failed              map[int]bool // testdatabases not recreated as it was open, recreated as soon as it's closed
+}
+
+func newCircuitBreaker() circuitBreaker {
+	return circuitBreaker{state: CircuitClosed, failed: make(map[int]bool)}
+}
+
+// circuitBreakerEnabled returns true if the pool fails fast after CircuitBreakerThreshold consecutive failures.
+func (pool *HashPool) circuitBreakerEnabled() bool {
+	return pool.CircuitBreakerThreshold > 0
+}
+
+// circuitError returns ErrCircuitOpen (including the last failure) if the circuit breaker is not closed.
+func (pool *HashPool) circuitError() error {
+	pool.RLock()
+	defer pool.RUnlock()
+
+	return pool.unsafeCircuitError()
+}
+
+// Attention: pool should be read or write locked!
+func (pool *HashPool) unsafeCircuitError() error {
+	if pool.breaker.state == CircuitClosed {
+		return nil
+	}
+
+	return fmt.Errorf("%w after %d consecutive failures of (re)creating testdatabases, last: %v", ErrCircuitOpen, pool.breaker.consecutiveFailures, pool.breaker.lastErr)
+}
+
+// unsafeCircuitBlocks returns true if the testdatabase with the ID must not be recreated as the circuit breaker is
+// open (except for the probe while half-open), it's recreated as soon as the circuit breaker closes again.
+// Attention: pool must be write locked!
+func (pool *HashPool) unsafeCircuitBlocks(id int) bool {
+	switch pool.breaker.state {
+	case CircuitOpen:
+	case CircuitHalfOpen:
+		if id == pool.breaker.probeID {
+			return false
+		}
+	default:
+		return false
+	}
+
+	pool.breaker.failed[id] = true
+
+	return true
+}
+
+// recordRecreateFailure counts the failed (re)creation of the testdatabase with the ID. If the circuit breaker is
+// enabled, the testdatabase is moved back to dirty and retried right away until CircuitBreakerThreshold (re)creations
+// failed in a row, the circuit breaker opens then (again after a failed probe) and it's retried once it's closed.
+func (pool *HashPool) recordRecreateFailure(log zerolog.Logger, id int, err error) {
+	pool.Lock()
+	defer pool.Unlock()
+
+	pool.breaker.failures++
+	pool.breaker.consecutiveFailures++
+	pool.breaker.lastErr = err
+
+	// kept dirty (not tracked by any channel) otherwise
+	if !pool.circuitBreakerEnabled() || id < 0 || id >= len(pool.dbs) || pool.dbs[id].state == dbStateReady {
+		return
+	}
+
+	switch pool.breaker.state {
+	case CircuitHalfOpen:
+		pool.breaker.state = CircuitOpen
+		pool.breaker.openedAt = time.Now()
+		pool.breaker.failed[id] = true
+
+		log.Warn().Err(err).Msg("circuit breaker probe failed, staying open")
+	case CircuitOpen:
+		pool.breaker.failed[id] = true
+	case CircuitClosed:
+		if pool.breaker.consecutiveFailures < pool.CircuitBreakerThreshold {
+			pool.spawnRecreate(log, id)
+			return
+		}
+
+		pool.breaker.failed[id] = true
+
+		pool.breaker.state = CircuitOpen
+		pool.breaker.openedAt = time.Now()
+		pool.breaker.opened++
+
+		log.Error().Err(err).Int("consecutiveFailures", pool.breaker.consecutiveFailures).Msg("circuit breaker opened, pausing (re)creations")
+
+		pool.Events.Emit(events.Event{
+			Type:    events.TypeCircuitOpened,
+			Hash:    pool.templateDB.TemplateHash,
+			Message: fmt.Sprintf("%d consecutive (re)creations of test databases failed, acquisitions fail fast until a probe succeeds: %v", pool.breaker.consecutiveFailures, err),
+			Fields: map[string]interface{}{
+				"consecutiveFailures": pool.breaker.consecutiveFailures,
+				"error":               err.Error(),
+			},
+		})
+	}
+}
+
+// unsafeRecordRecreateSuccess counts the successful (re)creation of the testdatabase with the ID, a successful probe
+// closes the circuit breaker and recreates all testdatabases paused meanwhile.
+// Attention: pool must be write locked!
+func (pool *HashPool) unsafeRecordRecreateSuccess(log zerolog.Logger, id int) {
+	pool.breaker.successes++
+	pool.breaker.consecutiveFailures = 0
+	delete(pool.breaker.failed, id)
+
+	if pool.breaker.state == CircuitClosed {
+		return
+	}
+
+	pool.breaker.state = CircuitClosed
+	pool.breaker.lastErr = nil
+
+	log.Info().Msg("circuit breaker closed")
+
+	pool.Events.Emit(events.Event{
+		Type:    events.TypeCircuitClosed,
+		Hash:    pool.templateDB.TemplateHash,
+		Message: "recreating a test database succeeded again, the circuit breaker is closed",
+	})
+
+	for failedID := range pool.breaker.failed {
+		delete(pool.breaker.failed, failedID)
+
+		// still dirty, not tracked by any channel
+		if failedID < len(pool.dbs) && pool.dbs[failedID].state == dbStateDirty {
+			pool.spawnRecreate(log, failedID)
+		}
+	}
+}
+
+// probeCircuitLoop periodically recreates a single testdatabase while the circuit breaker is open until the ctx is done.
+func (pool *HashPool) probeCircuitLoop(ctx context.Context) error {
+	interval := pool.CircuitBreakerProbeInterval
+	if interval < minCircuitProbeInterval {
+		interval = minCircuitProbeInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			if err := pool.probeCircuit(ctx); err != nil && ctx.Err() == nil {
+				pool.supervisor.Report(workerTaskProbeCircuit, err)
+			}
+		}
+	}
+}
+
+// probeCircuit recreates the testdatabase failed first while the circuit breaker is open (half-open meanwhile).
+func (pool *HashPool) probeCircuit(ctx context.Context) error {
+
+	log := pool.getPoolLogger(ctx, "probeCircuit")
+
+	pool.Lock()
+
+	if pool.breaker.state != CircuitOpen {
+		pool.Unlock()
+		return nil
+	}
+
+	ids := make([]int, 0, len(pool.breaker.failed))
+	for id := range pool.breaker.failed {
+		if id < len(pool.dbs) && pool.dbs[id].state == dbStateDirty {
+			ids = append(ids, id)
+		}
+	}
+
+	if len(ids) == 0 {
+		// nothing left to probe (e.g. evicted meanwhile)
+		pool.unsafeRecordRecreateSuccess(log, -1)
+		pool.Unlock()
+		return nil
+	}
+
+	sort.Ints(ids)
+	pool.breaker.state = CircuitHalfOpen
+	pool.breaker.probeID = ids[0]
+	pool.Unlock()
+
+	log.Debug().Int("id", ids[0]).Msg("probing...")
+
+	return pool.recreateDatabaseGracefully(ctx, ids[0])
+}
+
+// unsafeCircuitStats returns the (re)creations of the pool and the state of its circuit breaker.
+// Attention: pool should be read or write locked!
+func (pool *HashPool) unsafeCircuitStats() CircuitStats {
+	stats := CircuitStats{
+		State:               pool.breaker.state,
+		ConsecutiveFailures: pool.breaker.consecutiveFailures,
+		Successes:           pool.breaker.successes,
+		Failures:            pool.breaker.failures,
+		Opened:              pool.breaker.opened,
+	}
+
+	if pool.breaker.state != CircuitClosed {
+		openedAt := pool.breaker.openedAt
+		stats.OpenedAt = &openedAt
+	}
+
+	if pool.breaker.lastErr != nil {
+		stats.LastError = pool.breaker.lastErr.Error()
+	}
+
+	return stats
+}
@@ -0,0 +1,228 @@
+package pool
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/allaboutapps/integresql/pkg/events"
+	"github.com/rs/zerolog"
+)
+
+// Reasons of evicting ready testdatabases, see evict.
+const (
+	evictionReasonIdle   = "idle"   // not handed out within the TestDatabaseMaxIdleDuration (or shrunk down to the InitialPoolSize, see Shrink)
+	evictionReasonResize = "resize" // beyond the MaxPoolSize after shrinking it, see Resize
+)
+
+// eviction describes a ready testdatabase dropped while shrinking the pool.
+type eviction struct {
+	id      int    // removed from the pool, always the highest ID
+	dbName  string // dropped database
+	cold    bool   // the dropped database was never checked out
+	swapped bool   // the database with the removed ID was kept (as it was checked out before) and renamed to the dropped one
+	reason  string
+}
+
+// evictionClaim holds the testdatabases flagged as dropping by unsafeClaimEviction until evict removes them.
+type evictionClaim struct {
+	tail   existingDB // the testdatabase with the highest ID, its ID is removed from the pool
+	coldID int        // the never checked out testdatabase dropped instead of the tail (which takes over its name), -1 if none
+	cold   existingDB
+	reason string
+}
+
+// unsafeClaimEviction flags the ready tail (the testdatabase with the highest ID not claimed yet, already excluded from
+// the ready channel) as dropping. Testdatabases checked out before are warm (OS cache, statistics), thus if RenameIdleDB
+// is set and the tail was checked out before, a never checked out (cold) ready testdatabase on the same server is
+// claimed as well, see evict.
+// Attention: pool should be write locked!
+func (pool *HashPool) unsafeClaimEviction(id int, reason string) evictionClaim {
+	pool.dbs[id].state = dbStateDropping
+	claim := evictionClaim{tail: pool.dbs[id], coldID: -1, reason: reason}
+
+	if coldID, ok := pool.unsafeClaimCold(id); ok {
+		claim.coldID = coldID
+		claim.cold = pool.dbs[coldID]
+	}
+
+	return claim
+}
+
+// evictClaims evicts the claims (highest IDs first) one after another. On errors, the remaining claims are put back
+// into rotation. Call it without holding the lock of the pool.
+func (pool *HashPool) evictClaims(ctx context.Context, claims []evictionClaim) ([]eviction, error) {
+	evictions := make([]eviction, 0, len(claims))
+
+	for i, claim := range claims {
+		e, err := pool.evict(ctx, claim)
+		if err != nil {
+			pool.Lock()
+			for _, remaining := range claims[i+1:] {
+				pool.unsafeReleaseEviction(remaining)
+			}
+			pool.Unlock()
+
+			return evictions, err
+		}
+
+		evictions = append(evictions, e)
+	}
+
+	return evictions, nil
+}
+
+// evict drops the claimed tail via DropIdleDB, or the claimed cold testdatabase instead, renaming the tail into its
+// place via RenameIdleDB (the IDs keep indexing the pool). Call it without holding the lock of the pool, GetTestDatabase
+// and ReturnTestDatabase never wait for the DDL. Afterwards the ID of the tail is removed from the pool, on errors the
+// intact testdatabases are put back into rotation.
+func (pool *HashPool) evict(ctx context.Context, claim evictionClaim) (eviction, error) {
+
+	log := pool.getPoolLogger(ctx, "evict")
+
+	id := claim.tail.ID
+
+	if claim.coldID < 0 {
+		err := pool.DropIdleDB(ctx, claim.tail.TestDatabase)
+
+		pool.Lock()
+		defer pool.Unlock()
+
+		if err != nil {
+			// still intact, hand it out again
+			pool.unsafeReleaseEviction(claim)
+			return eviction{}, err
+		}
+
+		pool.unsafeRemoveEvicted(log, id)
+
+		return eviction{id: id, dbName: claim.tail.Config.Database, cold: claim.tail.checkouts == 0, reason: claim.reason}, nil
+	}
+
+	if err := pool.DropIdleDB(ctx, claim.cold.TestDatabase); err != nil {
+		pool.Lock()
+		defer pool.Unlock()
+
+		// both still intact, hand them out again
+		pool.unsafeReleaseEviction(claim)
+		return eviction{}, err
+	}
+
+	err := pool.RenameIdleDB(ctx, claim.tail.TestDatabase, claim.cold.Config.Database)
+
+	pool.Lock()
+	defer pool.Unlock()
+
+	if err != nil {
+		// the cold one is gone, the tail is still intact
+		pool.unsafeReleaseEviction(evictionClaim{tail: claim.tail, coldID: -1, reason: claim.reason})
+		pool.unsafeRecreateEvicted(log, claim.coldID)
+
+		return eviction{}, fmt.Errorf("renaming %s to the dropped cold testdatabase %s failed: %w", claim.tail.Config.Database, claim.cold.Config.Database, err)
+	}
+
+	if claim.coldID < len(pool.dbs) {
+		kept := claim.tail
+		kept.ID = claim.coldID
+		kept.Config = claim.cold.Config
+		kept.state = dbStateReady
+		kept.generation = claim.cold.generation + 1
+
+		pool.dbs[claim.coldID] = kept
+		pool.ready <- claim.coldID
+	}
+
+	pool.unsafeRemoveEvicted(log, id)
+
+	return eviction{id: id, dbName: claim.cold.Config.Database, cold: true, swapped: true, reason: claim.reason}, nil
+}
+
+// unsafeReleaseEviction puts the claimed testdatabases back into rotation, their databases weren't touched.
+// Attention: pool should be write locked!
+func (pool *HashPool) unsafeReleaseEviction(claim evictionClaim) {
+	for _, id := range []int{claim.coldID, claim.tail.ID} {
+		// removed meanwhile (see RemoveAll)
+		if id < 0 || id >= len(pool.dbs) {
+			continue
+		}
+
+		pool.dbs[id].state = dbStateReady
+		pool.ready <- id
+	}
+}
+
+// unsafeRemoveEvicted removes the ID of the evicted tail from the pool. If the pool was extended while its database
+// was dropped, the ID no longer is the highest one, it's recreated instead.
+// Attention: pool should be write locked!
+func (pool *HashPool) unsafeRemoveEvicted(log zerolog.Logger, id int) {
+	if id != len(pool.dbs)-1 {
+		pool.unsafeRecreateEvicted(log, id)
+		return
+	}
+
+	pool.dbs = pool.dbs[:id]
+}
+
+// unsafeRecreateEvicted recreates the testdatabase whose database was dropped, unless removed meanwhile (see RemoveAll).
+// Attention: pool should be write locked!
+func (pool *HashPool) unsafeRecreateEvicted(log zerolog.Logger, id int) {
+	if id >= len(pool.dbs) {
+		return
+	}
+
+	pool.dbs[id].state = dbStateDirty
+	pool.spawnRecreate(log, id)
+}
+
+// unsafeClaimCold removes the ready testdatabase never checked out with the lowest ID below the tail (on the same
+// server as the tail) from the ready channel and flags it as dropping. Returns false if the tail was never checked out
+// itself, RenameIdleDB is nil or there is no such testdatabase.
+// Attention: pool should be write locked!
+func (pool *HashPool) unsafeClaimCold(tailID int) (int, bool) {
+	tail := pool.dbs[tailID]
+	if pool.RenameIdleDB == nil || tail.checkouts == 0 {
+		return 0, false
+	}
+
+	for id := 0; id < tailID; id++ {
+		testDB := pool.dbs[id]
+		if testDB.state != dbStateReady || testDB.checkouts > 0 || testDB.Config.Host != tail.Config.Host || testDB.Config.Port != tail.Config.Port {
+			continue
+		}
+
+		// the testdatabase might have just been taken from the ready channel by GetTestDatabase (waiting for the lock)
+		if !pool.excludeIDFromChannel(pool.ready, id) {
+			continue
+		}
+
+		pool.dbs[id].state = dbStateDropping
+
+		return id, true
+	}
+
+	return 0, false
+}
+
+// emitEvictions emits an event for each eviction, call it without holding the lock of the pool.
+func (pool *HashPool) emitEvictions(evictions []eviction) {
+	for _, e := range evictions {
+		message := fmt.Sprintf("evicted test database %s (%s), it was never checked out", e.dbName, e.reason)
+		if e.swapped {
+			message = fmt.Sprintf("evicted test database %d (%s) by dropping the never checked out test database %s instead, the checked out one was renamed to it", e.id, e.reason, e.dbName)
+		} else if !e.cold {
+			message = fmt.Sprintf("evicted test database %s (%s), it was checked out before", e.dbName, e.reason)
+		}
+
+		pool.Events.Emit(events.Event{
+			Type:    events.TypeTestDatabaseEvicted,
+			Hash:    pool.templateDB.TemplateHash,
+			Message: message,
+			Fields: map[string]interface{}{
+				"id":      e.id,
+				"dbName":  e.dbName,
+				"cold":    e.cold,
+				"swapped": e.swapped,
+				"reason":  e.reason,
+			},
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package pool
+
+import (
+	"context"
+	"fmt"
+	"runtime/trace"
+	"time"
+)
+
+// Decision is the branch GetTestDatabase (or one of its variants) would take, see ExplainGetTestDatabase.
+type Decision string
+
+const (
+	DecisionReuseReady     Decision = "reuse-ready"      // a ready (clean) testdatabase is handed out immediately
+	DecisionReuseDirty     Decision = "reuse-dirty"      // skip clean: a dirty testdatabase beyond its lease is handed out as-is
+	DecisionCreateOverflow Decision = "create-overflow"  // the pool is exhausted, a temporary testdatabase beyond the max pool size is created
+	DecisionWaitCreate     Decision = "wait-create"      // no ready testdatabase, waits for the pool to be extended by a new one
+	DecisionWaitRecreate   Decision = "wait-recreate"    // no ready testdatabase, waits for one currently being recreated
+	DecisionWaitCleanDirty Decision = "wait-clean-dirty" // no ready testdatabase, waits for the auto-cleaning of dirty ones beyond their lease
+	DecisionWaitBlocked    Decision = "wait-blocked"     // all testdatabases are checked out within their lease, waits until the first one expires (or is returned)
+)
+
+// Explanation describes the decision path of acquiring a testdatabase without checking anything out.
+type Explanation struct {
+	Decision Decision `json:"decision"`
+	Reason   string   `json:"reason"`
+
+	// snapshot of the pool the decision is based upon
+	Ready         int `json:"ready"`
+	Dirty         int `json:"dirty"`         // checked out or waiting to be auto-cleaned
+	DirtyEligible int `json:"dirtyEligible"` // dirty ones beyond their lease, thus eligible for auto-cleaning (or skip clean)
+	Recreating    int `json:"recreating"`
+	Total         int `json:"total"`
+	MaxPoolSize   int `json:"maxPoolSize"`
+	Overflow      int `json:"overflow"`
+	MaxOverflow   int `json:"maxOverflow"` // 0 if overflow is disabled
+
+	// earliest lease expiry of the dirty testdatabases still within their lease, nil if there is none
+	NextEligibleAt *time.Time `json:"nextEligibleAt,omitempty"`
+
+	// ready testdatabases are probed before handing them out (see TestDatabaseHealthCheckOnAcquire), unhealthy ones are skipped
+	HealthCheckOnAcquire bool `json:"healthCheckOnAcquire"`
+}
+
+// ExplainGetTestDatabase returns the decision GetTestDatabase (GetTestDatabaseSkipClean if skipClean is set,
+// GetTestDatabaseAtIndex if index is set) would take right now. Nothing is checked out or changed, the decision
+// is deterministic for the current state of the pool, but may of course change until an actual acquisition.
+// Returns ErrInvalidIndex if the index is not within the max pool size, like GetTestDatabaseAtIndex.
+func (pool *HashPool) ExplainGetTestDatabase(ctx context.Context, skipClean bool, index *int) (Explanation, error) {
+
+	reg := trace.StartRegion(ctx, "wait_for_rlock_hash_pool")
+	pool.RLock()
+	defer pool.RUnlock()
+	reg.End()
+
+	now := time.Now()
+
+	e := Explanation{
+		Total:                len(pool.dbs),
+		MaxPoolSize:          pool.MaxPoolSize,
+		Overflow:             len(pool.overflow),
+		HealthCheckOnAcquire: pool.HealthCheckDB != nil && pool.TestDatabaseHealthCheckOnAcquire,
+	}
+	if pool.DropOverflowDB != nil {
+		e.MaxOverflow = pool.MaxOverflowSize
+	}
+
+	for _, testDB := range pool.dbs {
+		switch testDB.state {
+		case dbStateReady:
+			e.Ready++
+		case dbStateRecreating:
+			e.Recreating++
+		case dbStateDirty, dbStateClaimed:
+			e.Dirty++
+			if !now.Before(testDB.blockAutoCleanDirtyUntil) {
+				e.DirtyEligible++
+			} else if e.NextEligibleAt == nil || testDB.blockAutoCleanDirtyUntil.Before(*e.NextEligibleAt) {
+				next := testDB.blockAutoCleanDirtyUntil
+				e.NextEligibleAt = &next
+			}
+		}
+	}
+
+	if index != nil {
+		if *index < 0 || *index >= pool.MaxPoolSize {
+			return Explanation{}, fmt.Errorf("%w: %d is not within the max pool size of %d", ErrInvalidIndex, *index, pool.MaxPoolSize)
+		}
+
+		e.Decision, e.Reason = pool.unsafeExplainIndex(now, *index)
+		return e, nil
+	}
+
+	switch {
+	case skipClean && e.DirtyEligible > 0:
+		e.Decision = DecisionReuseDirty
+		e.Reason = fmt.Sprintf("%d dirty test database(s) beyond their lease, the oldest one without open connections is handed out as-is", e.DirtyEligible)
+	case e.MaxOverflow > 0 && pool.unsafeExhausted() && e.Overflow < e.MaxOverflow:
+		e.Decision = DecisionCreateOverflow
+		e.Reason = fmt.Sprintf("all %d test databases are dirty, a temporary one is created (%d of %d overflow in use)", e.Total, e.Overflow, e.MaxOverflow)
+	case e.Ready > 0:
+		e.Decision = DecisionReuseReady
+		e.Reason = fmt.Sprintf("%d ready test database(s), the first one is handed out immediately", e.Ready)
+	case e.Total < e.MaxPoolSize:
+		e.Decision = DecisionWaitCreate
+		e.Reason = fmt.Sprintf("no ready test database, the pool (%d of %d) is extended by a new one", e.Total, e.MaxPoolSize)
+	case e.Recreating > 0:
+		e.Decision = DecisionWaitRecreate
+		e.Reason = fmt.Sprintf("no ready test database and the pool is full, %d are currently recreated", e.Recreating)
+	case e.DirtyEligible > 0:
+		e.Decision = DecisionWaitCleanDirty
+		e.Reason = fmt.Sprintf("no ready test database and the pool is full, %d dirty one(s) beyond their lease are auto-cleaned", e.DirtyEligible)
+	default:
+		e.Decision = DecisionWaitBlocked
+		e.Reason = "the pool is full and all test databases are checked out within their lease, waits until the first one is returned or its lease expires"
+	}
+
+	if skipClean && e.Decision != DecisionReuseDirty {
+		e.Reason = "no dirty test database beyond its lease to skip the clean, " + e.Reason
+	}
+
+	return e, nil
+}
+
+// unsafeExplainIndex explains GetTestDatabaseAtIndex for a valid index. Attention: pool should be read or write locked!
+func (pool *HashPool) unsafeExplainIndex(now time.Time, index int) (Decision, string) {
+	if index >= len(pool.dbs) {
+		return DecisionWaitCreate, fmt.Sprintf("test database %d doesn't exist yet, all missing ones up to it are created", index)
+	}
+
+	testDB := pool.dbs[index]
+	switch testDB.state {
+	case dbStateReady:
+		return DecisionReuseReady, fmt.Sprintf("test database %d is ready and handed out immediately", index)
+	case dbStateRecreating:
+		return DecisionWaitRecreate, fmt.Sprintf("test database %d is currently recreated", index)
+	case dbStateDirty, dbStateClaimed:
+		if !now.Before(testDB.blockAutoCleanDirtyUntil) {
+			return DecisionWaitCleanDirty, fmt.Sprintf("test database %d is dirty beyond its lease, it's recreated first", index)
+		}
+
+		return DecisionWaitBlocked, fmt.Sprintf("test database %d is checked out until %s (its lease), it's recreated afterwards", index, testDB.blockAutoCleanDirtyUntil.Format(time.RFC3339Nano))
+	default:
+		return DecisionWaitBlocked, fmt.Sprintf("test database %d is %v", index, testDB.state)
+	}
+}
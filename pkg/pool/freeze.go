@@ -0,0 +1,110 @@
+package pool
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// FrozenTestDatabase describes a testdatabase excluded from rotation, see Freeze.
+type FrozenTestDatabase struct {
+	ID       int       `json:"id"`
+	DBName   string    `json:"dbName"`
+	FrozenAt time.Time `json:"frozenAt"`
+}
+
+// Freeze removes the testdatabase with the ID from rotation, e.g. while investigating a failed test within it. It's
+// neither handed out, cleaned, recreated nor dropped (e.g. evicted while idle or by shrinking the pool) until it's
+// unfrozen, only removing the whole pool drops it. Only testdatabases back in the pool can be frozen: ready ones and
+// dirty ones not checked out anymore (e.g. waiting to be recreated). Freezing a frozen one again is a no-op.
+func (pool *HashPool) Freeze(ctx context.Context, id int) (FrozenTestDatabase, error) {
+
+	log := pool.getPoolLogger(ctx, "Freeze").With().Int("id", id).Logger()
+
+	pool.Lock()
+	defer pool.Unlock()
+
+	if id < 0 || id >= len(pool.dbs) {
+		log.Warn().Int("dbs", len(pool.dbs)).Msg("bailout invalid index!")
+		return FrozenTestDatabase{}, ErrInvalidIndex
+	}
+
+	testDB := pool.dbs[id]
+
+	switch testDB.state {
+	case dbStateFrozen:
+		return frozenTestDatabase(testDB), nil
+	case dbStateReady:
+		// the testdatabase might have just been taken from the ready channel by GetTestDatabase (waiting for the lock)
+		if !pool.excludeIDFromChannel(pool.ready, id) {
+			return FrozenTestDatabase{}, fmt.Errorf("%w: test database %d is currently handed out", ErrInvalidState, id)
+		}
+	case dbStateDirty:
+		if !testDB.checkedOutAt.IsZero() {
+			return FrozenTestDatabase{}, fmt.Errorf("%w: test database %d is checked out, return it first", ErrInvalidState, id)
+		}
+
+		// a pending recreate bails out as it's no longer dirty
+		pool.excludeIDFromChannel(pool.dirty, id)
+		delete(pool.breaker.failed, id)
+	default:
+		return FrozenTestDatabase{}, fmt.Errorf("%w: test database %d is %v", ErrInvalidState, id, testDB.state)
+	}
+
+	pool.dbs[id].state = dbStateFrozen
+	pool.dbs[id].frozenAt = time.Now()
+
+	log.Info().Str("previousState", testDB.state.String()).Msg("frozen")
+	pool.unsafeTraceLogStats(log)
+
+	return frozenTestDatabase(pool.dbs[id]), nil
+}
+
+// Unfreeze puts the frozen testdatabase with the ID back into rotation. As it might have been modified meanwhile, it's
+// recreated in background first.
+func (pool *HashPool) Unfreeze(ctx context.Context, id int) error {
+
+	log := pool.getPoolLogger(ctx, "Unfreeze").With().Int("id", id).Logger()
+
+	pool.Lock()
+	defer pool.Unlock()
+
+	if id < 0 || id >= len(pool.dbs) {
+		log.Warn().Int("dbs", len(pool.dbs)).Msg("bailout invalid index!")
+		return ErrInvalidIndex
+	}
+
+	if state := pool.dbs[id].state; state != dbStateFrozen {
+		return fmt.Errorf("%w: test database %d is not frozen but %v", ErrInvalidState, id, state)
+	}
+
+	pool.dbs[id].state = dbStateDirty
+	pool.dbs[id].frozenAt = time.Time{}
+	pool.spawnRecreate(log, id)
+
+	log.Info().Msg("unfrozen, recreating...")
+	pool.unsafeTraceLogStats(log)
+
+	return nil
+}
+
+// unsafeFrozen returns the frozen testdatabases ordered by their ID, nil if there are none.
+// Attention: pool should be read or write locked!
+func (pool *HashPool) unsafeFrozen() []FrozenTestDatabase {
+	var frozen []FrozenTestDatabase
+	for _, testDB := range pool.dbs {
+		if testDB.state == dbStateFrozen {
+			frozen = append(frozen, frozenTestDatabase(testDB))
+		}
+	}
+
+	return frozen
+}
+
+func frozenTestDatabase(testDB existingDB) FrozenTestDatabase {
+	return FrozenTestDatabase{
+		ID:       testDB.ID,
+		DBName:   testDB.Config.Database,
+		FrozenAt: testDB.frozenAt,
+	}
+}
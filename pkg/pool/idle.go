@@ -0,0 +1,115 @@
+package pool
+
+import (
+	"context"
+	"runtime/trace"
+	"time"
+)
+
+const (
+	workerTaskEvictIdle = "EVICT_IDLE" // only used for naming supervised tasks, never pushed to the tasksChan
+
+	minEvictIdleInterval = 10 * time.Millisecond
+	maxEvictIdleInterval = 10 * time.Second
+)
+
+// evictIdleLoop periodically drops ready testdatabases exceeding the TestDatabaseMaxIdleDuration until the ctx is done.
+// Runs outside of the maintenance schedule are skipped.
+func (pool *HashPool) evictIdleLoop(ctx context.Context) error {
+	interval := pool.TestDatabaseMaxIdleDuration / 4
+	if interval < minEvictIdleInterval {
+		interval = minEvictIdleInterval
+	}
+	if interval > maxEvictIdleInterval {
+		interval = maxEvictIdleInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case now := <-ticker.C:
+			if pool.Maintenance.Allowed(now) {
+				_, err := pool.evictIdle(ctx, pool.TestDatabaseMaxIdleDuration)
+				pool.supervisor.Report(workerTaskEvictIdle, err)
+			}
+		}
+	}
+}
+
+// evictIdle drops ready testdatabases that weren't handed out within maxIdle via DropIdleDB, shrinking the pool down
+// to its InitialPoolSize. As IDs index the pool, only the testdatabases with the highest IDs are evicted (stopping at
+// the first one still in use), extending the pool later on reuses their IDs and names. Never checked out ones are
+// dropped in their place if possible, see evict. At most MaxParallelTasks testdatabases are evicted at once, they are
+// claimed while the pool is locked but dropped afterwards. Returns the number of evicted ones.
+func (pool *HashPool) evictIdle(ctx context.Context, maxIdle time.Duration) (int, error) {
+
+	log := pool.getPoolLogger(ctx, "evictIdle")
+
+	reg := trace.StartRegion(ctx, "worker_wait_for_lock_hash_pool")
+	pool.Lock()
+	reg.End()
+
+	claims := make([]evictionClaim, 0)
+	for len(pool.dbs)-len(claims) > pool.InitialPoolSize && len(claims) < pool.MaxParallelTasks {
+		id := len(pool.dbs) - 1 - len(claims)
+		testDB := pool.dbs[id]
+
+		if testDB.state != dbStateReady || time.Since(testDB.lastUsedAt) < maxIdle {
+			break
+		}
+
+		// the testdatabase might have just been taken from the ready channel by GetTestDatabase (waiting for the lock), keep it then
+		if !pool.excludeIDFromChannel(pool.ready, id) {
+			break
+		}
+
+		claims = append(claims, pool.unsafeClaimEviction(id, evictionReasonIdle))
+	}
+
+	pool.Unlock()
+
+	if len(claims) == 0 {
+		return 0, nil
+	}
+
+	evictions, err := pool.evictClaims(ctx, claims)
+	pool.emitEvictions(evictions)
+
+	pool.Lock()
+	defer pool.Unlock()
+
+	pool.idleEvictions += len(evictions)
+
+	if len(evictions) > 0 {
+		evicted := make([]int, 0, len(evictions))
+		for _, e := range evictions {
+			evicted = append(evicted, e.id)
+		}
+
+		log.Debug().Ints("ids", evicted).Dur("maxIdleDuration", maxIdle).Msg("evicted idle ready testdatabases")
+		pool.unsafeTraceLogStats(log)
+	}
+
+	return len(evictions), err
+}
+
+// Shrink drops all ready testdatabases beyond the InitialPoolSize right away (regardless of their idle duration), see
+// evictIdle. Returns the number of dropped testdatabases.
+func (pool *HashPool) Shrink(ctx context.Context) (int, error) {
+	if pool.DropIdleDB == nil {
+		return 0, nil
+	}
+
+	total := 0
+	for {
+		evicted, err := pool.evictIdle(ctx, 0)
+		total += evicted
+		if err != nil || evicted == 0 {
+			return total, err
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package pool
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/allaboutapps/integresql/pkg/db"
+)
+
+// interval of checking whether the requested testdatabase became ready
+const indexPollInterval = 10 * time.Millisecond
+
+// GetTestDatabaseAtIndex is a variant of GetTestDatabase handing out the testdatabase with the given ID (its index
+// within the pool), e.g. mapping CI worker k of n to the same testdatabase run after run. Missing testdatabases up to
+// the index are created. If the testdatabase is still checked out, it's recreated as soon as it's eligible for
+// auto-cleaning (beyond its TestDatabaseMinimalLifetime), otherwise waits until it's ready or the timeout is reached.
+// Identities are only stable if all clients of the pool acquire by index, GetTestDatabase hands out any ready one.
+func (pool *HashPool) GetTestDatabaseAtIndex(ctx context.Context, index int, timeout time.Duration) (db.TestDatabase, error) {
+
+	log := pool.getPoolLogger(ctx, "GetTestDatabaseAtIndex").With().Int("id", index).Logger()
+
+	pool.RLock()
+	maxPoolSize := pool.MaxPoolSize
+	pool.RUnlock()
+
+	if index < 0 || index >= maxPoolSize {
+		return db.TestDatabase{}, fmt.Errorf("%w: %d is not within the max pool size of %d", ErrInvalidIndex, index, maxPoolSize)
+	}
+
+	waitStart := time.Now()
+
+	timeoutChan := time.After(timeout)
+	ticker := time.NewTicker(indexPollInterval)
+	defer ticker.Stop()
+
+	for {
+		// (re)extend each time, idle testdatabases might have been evicted meanwhile (see TestDatabaseMaxIdleDuration)
+		pool.extendTo(ctx, index)
+
+		if testDB, ok := pool.checkoutIndex(ctx, index); ok {
+			pool.latencies.readyWait.Record(time.Since(waitStart))
+			return testDB, nil
+		}
+
+		select {
+		case <-timeoutChan:
+			log.Error().Err(ErrTimeout).Dur("timeout", timeout).Msg("timeout")
+			return db.TestDatabase{}, ErrTimeout
+		case <-ctx.Done():
+			log.Warn().Err(ctx.Err()).Msg("ctx done")
+			return db.TestDatabase{}, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// extendTo adds all missing testdatabases up to the index to the pool, they are created in background.
+func (pool *HashPool) extendTo(ctx context.Context, index int) {
+
+	log := pool.getPoolLogger(ctx, "extendTo")
+
+	pool.Lock()
+
+	created := make([]int, 0)
+	for id := len(pool.dbs); id <= index; id++ {
+		// like extend, it must start in state dirty
+		newTestDB := existingDB{
+			state: dbStateDirty,
+			TestDatabase: db.TestDatabase{
+				Database: db.Database{
+					TemplateHash: pool.templateDB.TemplateHash,
+					Config:       pool.testDBConfig(id),
+				},
+				ID: id,
+			},
+			lastUsedAt: time.Now(),
+		}
+
+		pool.dbs = append(pool.dbs, newTestDB)
+		created = append(created, id)
+	}
+
+	pool.Unlock()
+
+	for _, id := range created {
+		id := id
+		started := pool.supervisor.Go(workerTaskExtend, func(ctx context.Context) error {
+			return pool.recreateDatabaseGracefully(ctx, id)
+		})
+
+		if !started {
+			// pool is not running, keep it dirty so it's picked up by the auto cleaning after the next start
+			log.Warn().Int("id", id).Msg("pool is not running, deferring creation to the dirty worker")
+			pool.Lock()
+			pool.dirty <- id
+			pool.Unlock()
+		}
+	}
+}
+
+// checkoutIndex checks out the testdatabase with the given ID if it's ready. A dirty one eligible for auto-cleaning
+// is recreated in background instead. Returns false if the testdatabase is not ready (yet).
+func (pool *HashPool) checkoutIndex(ctx context.Context, id int) (db.TestDatabase, bool) {
+
+	log := pool.getPoolLogger(ctx, "checkoutIndex").With().Int("id", id).Logger()
+
+	pool.Lock()
+	defer pool.Unlock()
+
+	if id >= len(pool.dbs) {
+		// evicted as idle meanwhile
+		return db.TestDatabase{}, false
+	}
+
+	testDB := pool.dbs[id]
+
+	switch testDB.state {
+	case dbStateReady:
+		if !pool.excludeIDFromChannel(pool.ready, id) {
+			// concurrently taken from the ready channel, e.g. via GetTestDatabase
+			return db.TestDatabase{}, false
+		}
+	case dbStateDirty:
+		if time.Now().Before(testDB.blockAutoCleanDirtyUntil) || !pool.excludeIDFromChannel(pool.dirty, id) {
+			// still in use or currently claimed by the auto cleaning
+			return db.TestDatabase{}, false
+		}
+
+		started := pool.supervisor.Go(workerTaskRecreate, func(ctx context.Context) error {
+			return pool.recreateDatabaseGracefully(ctx, id)
+		})
+
+		if !started {
+			pool.dirty <- id
+		}
+
+		log.Debug().Bool("started", started).Msg("recreating dirty testdatabase...")
+		return db.TestDatabase{}, false
+	default:
+		return db.TestDatabase{}, false
+	}
+
+	// flag as dirty and block auto clean until, like GetTestDatabase
+	testDB.state = dbStateDirty
+	testDB.checkedOutAt = time.Now()
+	testDB.checkedOutBy = holderFromContext(ctx)
+	testDB.lastUsedAt = testDB.checkedOutAt
+	testDB.checkouts++
+	pool.lastActivity = testDB.checkedOutAt
+	pool.unsafeStartLease(ctx, &testDB)
+
+	pool.dbs[id] = testDB
+	pool.dirty <- id
+
+	log.Debug().Uint("generation", testDB.generation).Msg("got testdatabase at index")
+	pool.unsafeTraceLogStats(log)
+
+	return testDB.TestDatabase, true
+}
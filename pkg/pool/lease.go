@@ -0,0 +1,193 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/trace"
+	"time"
+
+	"github.com/allaboutapps/integresql/pkg/events"
+)
+
+var ErrLeaseExpired = errors.New("lease of the test database reached its max duration")
+
+// Lease of a checked out testdatabase, blocking its auto-cleaning until it expires.
+type Lease struct {
+	ExpiresAt    time.Time // zero if the testdatabase is never auto-cleaned (overflow)
+	MaxExpiresAt time.Time // renewals never extend the lease beyond, zero if unlimited (see TestDatabaseMaxLeaseDuration)
+}
+
+// RenewTestDatabase extends the lease of the checked out testdatabase by TestDatabaseLeaseRenewDuration (from now),
+// capped to TestDatabaseMaxLeaseDuration since its checkout. Long running tests call it periodically (heartbeat) to
+// prevent their testdatabase from being auto-cleaned beyond the TestDatabaseMinimalLifetime.
+func (pool *HashPool) RenewTestDatabase(ctx context.Context, id int) (Lease, error) {
+
+	log := pool.getPoolLogger(ctx, "RenewTestDatabase").With().Int("id", id).Logger()
+
+	pool.Lock()
+	defer pool.Unlock()
+
+	if pool.isOverflowID(id) {
+		testDB, ok := pool.overflow[id]
+		if !ok || testDB.state != dbStateDirty {
+			return Lease{}, fmt.Errorf("%w: overflow test database %d is not checked out", ErrInvalidState, id)
+		}
+
+		// overflow testdatabases are dropped on return only
+		return Lease{}, nil
+	}
+
+	if id < 0 || id >= len(pool.dbs) {
+		log.Warn().Int("dbs", len(pool.dbs)).Msg("bailout invalid index!")
+		return Lease{}, ErrInvalidIndex
+	}
+
+	testDB := pool.dbs[id]
+	if testDB.state != dbStateDirty || testDB.checkedOutAt.IsZero() {
+		log.Warn().Msgf("bailout invalid state=%v.", testDB.state)
+		return Lease{}, fmt.Errorf("%w: test database %d is not checked out", ErrInvalidState, id)
+	}
+
+	now := time.Now()
+	lease := Lease{}
+	expiresAt := now.Add(pool.TestDatabaseLeaseRenewDuration)
+
+	if pool.TestDatabaseMaxLeaseDuration > 0 {
+		lease.MaxExpiresAt = testDB.checkedOutAt.Add(pool.TestDatabaseMaxLeaseDuration)
+
+		if !now.Before(lease.MaxExpiresAt) {
+			log.Warn().Dur("maxLeaseDuration", pool.TestDatabaseMaxLeaseDuration).Msg("bailout max lease duration reached")
+			return Lease{}, fmt.Errorf("%w: checked out at %v, max %v", ErrLeaseExpired, testDB.checkedOutAt.Format(time.RFC3339), pool.TestDatabaseMaxLeaseDuration)
+		}
+
+		if expiresAt.After(lease.MaxExpiresAt) {
+			expiresAt = lease.MaxExpiresAt
+		}
+	}
+
+	// never shorten the current lease (e.g. the initial TestDatabaseMinimalLifetime)
+	if expiresAt.After(testDB.blockAutoCleanDirtyUntil) {
+		pool.dbs[id].blockAutoCleanDirtyUntil = expiresAt
+	}
+
+	pool.lastActivity = now
+	lease.ExpiresAt = pool.dbs[id].blockAutoCleanDirtyUntil
+
+	log.Trace().Time("expiresAt", lease.ExpiresAt).Msg("renewed")
+
+	return lease, nil
+}
+
+type leaseKey struct{}
+
+// WithLease returns a copy of ctx requesting a lease of the given duration for the testdatabases checked out with it,
+// overwriting the TestDatabaseLeaseDuration. Such testdatabases are reclaimed (recreated and handed out again) as soon
+// as their lease expired without being renewed, e.g. as their client crashed.
+func WithLease(ctx context.Context, duration time.Duration) context.Context {
+	return context.WithValue(ctx, leaseKey{}, duration)
+}
+
+func leaseFromContext(ctx context.Context) time.Duration {
+	duration, _ := ctx.Value(leaseKey{}).(time.Duration)
+	return duration
+}
+
+// unsafeStartLease blocks auto-cleaning of the just checked out testdatabase for the TestDatabaseMinimalLifetime or,
+// if a lease was requested (see WithLease and TestDatabaseLeaseDuration), for its lease capped to the
+// TestDatabaseMaxLeaseDuration. Attention: pool should be write locked!
+func (pool *HashPool) unsafeStartLease(ctx context.Context, testDB *existingDB) {
+	duration := leaseFromContext(ctx)
+	if duration <= 0 {
+		duration = pool.TestDatabaseLeaseDuration
+	}
+
+	testDB.leased = duration > 0
+	if !testDB.leased {
+		testDB.blockAutoCleanDirtyUntil = testDB.checkedOutAt.Add(pool.TestDatabaseMinimalLifetime)
+		return
+	}
+
+	if duration < pool.TestDatabaseMinimalLifetime {
+		duration = pool.TestDatabaseMinimalLifetime
+	}
+	if pool.TestDatabaseMaxLeaseDuration > 0 && duration > pool.TestDatabaseMaxLeaseDuration {
+		duration = pool.TestDatabaseMaxLeaseDuration
+	}
+
+	testDB.blockAutoCleanDirtyUntil = testDB.checkedOutAt.Add(duration)
+}
+
+// reclaimExpiredLoop periodically reclaims leased testdatabases whose lease expired until the ctx is done. Unlike
+// maintenance tasks, it isn't restricted by the maintenance schedule (it restores the capacity of the pool).
+func (pool *HashPool) reclaimExpiredLoop(ctx context.Context) error {
+	ticker := time.NewTicker(pool.TestDatabaseLeaseSweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			pool.reclaimExpired(ctx)
+		}
+	}
+}
+
+// reclaimExpired recreates leased testdatabases whose lease expired in background, they are handed out again afterwards.
+// Unlike the auto cleaning, they are reclaimed even if the pool is not full.
+func (pool *HashPool) reclaimExpired(ctx context.Context) {
+
+	log := pool.getPoolLogger(ctx, "reclaimExpired")
+
+	reg := trace.StartRegion(ctx, "worker_wait_for_lock_hash_pool")
+	pool.Lock()
+	reg.End()
+
+	now := time.Now()
+	reclaim := make([]int, 0)
+	for id, testDB := range pool.dbs {
+		if testDB.state != dbStateDirty || !testDB.leased || now.Before(testDB.blockAutoCleanDirtyUntil) {
+			continue
+		}
+
+		// currently claimed by the auto cleaning (or a recycle worker), it's recreated anyway
+		if !pool.excludeIDFromChannel(pool.dirty, id) {
+			continue
+		}
+
+		pool.leaseReclaims++
+		reclaim = append(reclaim, id)
+
+		pool.Events.Emit(events.Event{
+			Type:    events.TypeLeaseExpired,
+			Hash:    pool.templateDB.TemplateHash,
+			Message: fmt.Sprintf("lease of test database %s expired, reclaiming it", testDB.Database.Config.Database),
+			Fields: map[string]interface{}{
+				"id":         id,
+				"dbName":     testDB.Database.Config.Database,
+				"holder":     testDB.checkedOutBy,
+				"durationMs": now.Sub(testDB.checkedOutAt).Milliseconds(),
+			},
+		})
+	}
+
+	if len(reclaim) > 0 {
+		log.Warn().Ints("ids", reclaim).Msg("reclaiming testdatabases with expired leases...")
+		pool.unsafeTraceLogStats(log)
+	}
+
+	pool.Unlock()
+
+	for _, id := range reclaim {
+		id := id
+		started := pool.supervisor.Go(workerTaskRecreate, func(ctx context.Context) error {
+			return pool.recreateDatabaseGracefully(ctx, id)
+		})
+
+		if !started {
+			// pool is stopping, keep it dirty so it's picked up by the auto cleaning after the next start
+			pool.dirty <- id
+		}
+	}
+}
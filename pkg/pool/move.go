@@ -0,0 +1,114 @@
+package pool
+
+import (
+	"context"
+	"errors"
+
+	"github.com/allaboutapps/integresql/pkg/db"
+	"github.com/rs/zerolog"
+)
+
+var ErrMoveUnsupported = errors.New("moving the testdatabases of a sharded pool is not supported")
+
+// MoveStats describes the testdatabases of the pool still located on a previous server, see MoveTo.
+type MoveStats struct {
+	Remaining  int `json:"remaining"`  // testdatabases (including overflow ones) not yet moved
+	CheckedOut int `json:"checkedOut"` // of those the ones currently checked out, moved as soon as they are returned
+}
+
+// MoveTo moves the testdatabases of the pool to the server of the config (host, port and credentials), e.g. while
+// replacing the database server without downtime. Each testdatabase is relocated with its next recreation, the one on
+// the previous server is dropped via DropMovedDB beforehand. The ready ones are recreated right away, the checked out
+// ones as soon as they are returned (drained). Testdatabases still located on another server are no longer handed
+// out. Calling it again recreates ready testdatabases that were recreated on the previous server concurrently.
+// Returns the number of ready testdatabases flagged for recreation.
+func (pool *HashPool) MoveTo(ctx context.Context, server db.DatabaseConfig) (int, error) {
+
+	log := pool.getPoolLogger(ctx, "MoveTo").With().Str("host", server.Host).Int("port", server.Port).Logger()
+
+	if pool.sharded() {
+		return 0, ErrMoveUnsupported
+	}
+
+	pool.Lock()
+	pool.server = &server
+
+	moving := make([]int, 0)
+	for id := range pool.dbs {
+		if pool.dbs[id].state != dbStateReady || !pool.unsafeMoving(pool.dbs[id]) {
+			continue
+		}
+
+		// the testdatabase might have just been taken from the ready channel by GetTestDatabase (waiting for the lock)
+		if !pool.excludeIDFromChannel(pool.ready, id) {
+			continue
+		}
+
+		pool.dbs[id].state = dbStateDirty
+		moving = append(moving, id)
+	}
+
+	pool.Unlock()
+
+	for _, id := range moving {
+		pool.spawnRecreate(log, id)
+	}
+
+	if len(moving) > 0 {
+		log.Debug().Ints("ids", moving).Msg("moving ready testdatabases")
+	}
+
+	return len(moving), nil
+}
+
+// MoveStats returns the testdatabases not yet moved to the server of the last MoveTo.
+func (pool *HashPool) MoveStats() MoveStats {
+	pool.RLock()
+	defer pool.RUnlock()
+
+	var stats MoveStats
+
+	for _, testDB := range pool.dbs {
+		if !pool.unsafeMoving(testDB) {
+			continue
+		}
+
+		stats.Remaining++
+		if !testDB.checkedOutAt.IsZero() {
+			stats.CheckedOut++
+		}
+	}
+
+	for _, testDB := range pool.overflow {
+		if pool.unsafeMoving(testDB) {
+			// dropped on return
+			stats.Remaining++
+			stats.CheckedOut++
+		}
+	}
+
+	return stats
+}
+
+// unsafeMoving returns true if the testdatabase is located on another server than the one the pool is moved to.
+// Attention: pool should be read or write locked!
+func (pool *HashPool) unsafeMoving(testDB existingDB) bool {
+	if pool.server == nil {
+		return false
+	}
+
+	return testDB.Config.Host != pool.server.Host || testDB.Config.Port != pool.server.Port
+}
+
+// spawnRecreate recreates the dirty testdatabase with the ID (not tracked by any channel) in a background worker, it's
+// kept dirty for the auto cleaning after the next start if the pool is not running.
+func (pool *HashPool) spawnRecreate(log zerolog.Logger, id int) {
+	started := pool.supervisor.Go(workerTaskRecreate, func(ctx context.Context) error {
+		return pool.recreateDatabaseGracefully(ctx, id)
+	})
+
+	if !started {
+		log.Warn().Int("id", id).Msg("pool is not running, deferring recreate to the dirty worker")
+		pool.dirty <- id
+	}
+}
@@ -0,0 +1,217 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/allaboutapps/integresql/pkg/db"
+	"github.com/allaboutapps/integresql/pkg/events"
+	"github.com/allaboutapps/integresql/pkg/tracing"
+)
+
+const workerTaskDropOverflow = "DROP_OVERFLOW" // only used for naming supervised tasks, never pushed to the tasksChan
+
+// isOverflowID returns true if the id belongs to a temporary testdatabase beyond the MaxPoolSize.
+// Overflow IDs are never reused, they start at MaxPoolSizeLimit and are increased for each overflow testdatabase.
+func (pool *HashPool) isOverflowID(id int) bool {
+	return id >= pool.MaxPoolSizeLimit
+}
+
+// unsafeExhausted returns true if the pool has reached its MaxPoolSize and all testdatabases are dirty (checked out or
+// waiting to be cleaned) or frozen, thus none is ready or going to be ready soon. Attention: pool should be read or write locked!
+func (pool *HashPool) unsafeExhausted() bool {
+	if len(pool.dbs) < pool.MaxPoolSize {
+		return false
+	}
+
+	for _, testDB := range pool.dbs {
+		if testDB.state != dbStateDirty && testDB.state != dbStateFrozen {
+			return false
+		}
+	}
+
+	return true
+}
+
+// getOverflowTestDatabase creates and checks out a temporary testdatabase beyond the MaxPoolSize if the pool is
+// exhausted (see unsafeExhausted) and overflow is enabled.
+// Returns false if no overflow testdatabase was created, the caller should wait for a ready testdatabase then.
+func (pool *HashPool) getOverflowTestDatabase(ctx context.Context) (db.TestDatabase, bool, error) {
+	if pool.MaxOverflowSize <= 0 || pool.DropOverflowDB == nil {
+		return db.TestDatabase{}, false, nil
+	}
+
+	log := pool.getPoolLogger(ctx, "getOverflowTestDatabase")
+
+	pool.Lock()
+	if !pool.unsafeExhausted() || len(pool.overflow) >= pool.MaxOverflowSize {
+		pool.Unlock()
+		return db.TestDatabase{}, false, nil
+	}
+
+	id := pool.nextOverflowID
+	pool.nextOverflowID++
+
+	testDB := existingDB{
+		state: dbStateRecreating,
+		TestDatabase: db.TestDatabase{
+			Database: db.Database{
+				TemplateHash: pool.templateDB.TemplateHash,
+				Config:       pool.testDBConfig(id),
+			},
+			ID: id,
+		},
+	}
+	testDB.Seed = newSeed()
+
+	// tracked while being created, so RemoveAll takes care of it
+	pool.overflow[id] = testDB
+	pool.Unlock()
+
+	log = log.With().Int("id", id).Logger()
+	log.Debug().Msg("pool exhausted, creating overflow testdatabase...")
+
+	reg := tracing.Region(ctx, "create_overflow_db")
+	ddlStart := time.Now()
+	err := pool.recreateDB(ctx, &testDB)
+	pool.latencies.ddl.Record(time.Since(ddlStart))
+	reg.End()
+
+	pool.Lock()
+
+	if _, tracked := pool.overflow[id]; !tracked {
+		// the pool was removed in the meantime
+		pool.Unlock()
+		log.Warn().Msg("bailout pool removed while creating overflow testdatabase")
+		return db.TestDatabase{}, true, errors.Join(ErrInvalidState, pool.DropOverflowDB(ctx, testDB.TestDatabase))
+	}
+
+	if err != nil {
+		// fall back to waiting for a ready testdatabase, whatever was created is dropped in background
+		testDB.state = dbStateDropping
+		pool.overflow[id] = testDB
+		pool.Unlock()
+
+		log.Error().Err(err).Msg("failed to create overflow testdatabase, waiting for a ready one instead")
+		pool.dropOverflow(ctx, testDB.TestDatabase)
+		return db.TestDatabase{}, false, nil
+	}
+
+	testDB.state = dbStateDirty
+	testDB.checkedOutAt = time.Now()
+	testDB.checkedOutBy = holderFromContext(ctx)
+	testDB.recreatedAt = testDB.checkedOutAt
+	pool.lastActivity = testDB.checkedOutAt
+	pool.overflow[id] = testDB
+	pool.overflowCreated++
+	overflow := len(pool.overflow)
+	pool.Unlock()
+
+	dbName := testDB.Config.Database
+	log.Info().Str("dbName", dbName).Int("overflow", overflow).Msg("checked out overflow testdatabase")
+
+	pool.Events.Emit(events.Event{
+		Type:    events.TypePoolOverflow,
+		Hash:    pool.templateDB.TemplateHash,
+		Message: fmt.Sprintf("pool exhausted, created overflow test database %s (%d/%d)", dbName, overflow, pool.MaxOverflowSize),
+		Fields: map[string]interface{}{
+			"id":       id,
+			"dbName":   dbName,
+			"overflow": overflow,
+			"max":      pool.MaxOverflowSize,
+		},
+	})
+
+	return testDB.TestDatabase, true, nil
+}
+
+// returnOverflow drops the returned overflow testdatabase in background instead of recycling it.
+func (pool *HashPool) returnOverflow(ctx context.Context, id int) error {
+
+	log := pool.getPoolLogger(ctx, "returnOverflow").With().Int("id", id).Logger()
+
+	pool.Lock()
+
+	testDB, ok := pool.overflow[id]
+	if !ok {
+		pool.Unlock()
+
+		if id < pool.nextOverflowID {
+			// already returned and dropped
+			log.Warn().Msg("bailout overflow testdatabase already dropped")
+			return nil
+		}
+
+		log.Warn().Int("overflow", len(pool.overflow)).Msg("bailout invalid overflow index!")
+		return ErrInvalidIndex
+	}
+
+	if testDB.state != dbStateDirty {
+		pool.Unlock()
+		log.Warn().Msgf("bailout invalid state=%v.", testDB.state)
+		return nil
+	}
+
+	pool.unsafeRecordCheckoutEnd(log, &testDB)
+	testDB.state = dbStateDropping
+	pool.overflow[id] = testDB
+
+	pool.Unlock()
+
+	log.Debug().Msg("dropping returned overflow testdatabase...")
+	pool.dropOverflow(ctx, testDB.TestDatabase)
+
+	return nil
+}
+
+// dropOverflow drops the overflow testdatabase in background (or directly if the pool is not running).
+// It's kept tracked (counting against the MaxOverflowSize) until it was successfully dropped.
+func (pool *HashPool) dropOverflow(ctx context.Context, testDB db.TestDatabase) {
+	started := pool.supervisor.Go(workerTaskDropOverflow, func(ctx context.Context) error {
+		return pool.dropOverflowGracefully(ctx, testDB)
+	})
+
+	if !started {
+		pool.supervisor.Report(workerTaskDropOverflow, pool.dropOverflowGracefully(ctx, testDB))
+	}
+}
+
+// dropOverflowGracefully retries dropping the overflow testdatabase as long as it's still in use (clients still connected).
+func (pool *HashPool) dropOverflowGracefully(ctx context.Context, testDB db.TestDatabase) error {
+
+	log := pool.getPoolLogger(ctx, "dropOverflowGracefully").With().Int("id", testDB.ID).Logger()
+
+	for try := 1; ; try++ {
+		err := pool.DropOverflowDB(ctx, testDB)
+		if err == nil {
+			break
+		}
+
+		if !errors.Is(err, ErrTestDBInUse) {
+			log.Error().Int("try", try).Err(err).Msg("bailout failed to drop overflow testdatabase")
+			return err
+		}
+
+		backoff := time.Duration(try) * pool.TestDatabaseRetryRecreateSleepMin
+		if backoff > pool.TestDatabaseRetryRecreateSleepMax {
+			backoff = pool.TestDatabaseRetryRecreateSleepMax
+		}
+
+		log.Warn().Int("try", try).Dur("backoff", backoff).Msg("overflow DB is still in use, will retry...")
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+	}
+
+	pool.Lock()
+	delete(pool.overflow, testDB.ID)
+	pool.Unlock()
+
+	log.Debug().Msg("overflow testdatabase dropped")
+	return nil
+}
@@ -3,13 +3,19 @@ package pool
 import (
 	"context"
 	"errors"
+	"fmt"
+	"math/rand"
 	"runtime/trace"
+	"sort"
 	"sync"
 	"time"
 
 	"github.com/allaboutapps/integresql/pkg/db"
+	"github.com/allaboutapps/integresql/pkg/events"
+	"github.com/allaboutapps/integresql/pkg/tracing"
 	"github.com/allaboutapps/integresql/pkg/util"
 	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 var (
@@ -26,8 +32,30 @@ const (
 	dbStateReady      dbState = iota // Initialized according to a template and ready to be picked up.
 	dbStateDirty                     // Taken by a client and potentially currently in use.
 	dbStateRecreating                // In the process of being recreated (to prevent concurrent cleans)
+	dbStateDropping                  // Returned overflow testdatabase in the process of being dropped
+	dbStateClaimed                   // Dirty testdatabase in the process of being handed out as-is (see GetTestDatabaseSkipClean)
+	dbStateFrozen                    // Excluded from rotation until unfrozen, e.g. while being investigated (see Freeze)
 )
 
+func (s dbState) String() string {
+	switch s {
+	case dbStateReady:
+		return "ready"
+	case dbStateDirty:
+		return "dirty"
+	case dbStateRecreating:
+		return "recreating"
+	case dbStateDropping:
+		return "dropping"
+	case dbStateClaimed:
+		return "claimed"
+	case dbStateFrozen:
+		return "frozen"
+	default:
+		return "unknown"
+	}
+}
+
 type existingDB struct {
 	state dbState
 	db.TestDatabase
@@ -41,14 +69,59 @@ type existingDB struct {
 
 	// increased after each recreation, useful for sleepy recreating workers to check if we still operate on the same gen.
 	generation uint
+
+	// set when the testdatabase is handed out, reset as soon as it's explicitly returned (unlock or recreate).
+	checkedOutAt time.Time
+
+	// holder of the checkout (see WithHolder), reset along with checkedOutAt.
+	checkedOutBy string
+
+	// set after each recreation, used to recreate ready testdatabases exceeding the TestDatabaseMaxCloneAge.
+	recreatedAt time.Time
+
+	// checked out with a lease (see WithLease), reclaimed as soon as it expired. Reset along with checkedOutAt.
+	leased bool
+
+	// set when the testdatabase is appended and each time it's handed out, used to evict ready testdatabases
+	// exceeding the TestDatabaseMaxIdleDuration.
+	lastUsedAt time.Time
+
+	// set while the testdatabase is frozen (see Freeze).
+	frozenAt time.Time
+
+	// number of times the testdatabase was handed out since it was appended, never checked out (cold) ones are evicted first.
+	checkouts int
 }
 
+// number of the most recent checkout durations used for computing percentiles
+const checkoutDurationSamples = 1000
+
 type workerTask string
 
 const (
 	workerTaskStop           = "STOP"
 	workerTaskExtend         = "EXTEND"
 	workerTaskAutoCleanDirty = "CLEAN_DIRTY"
+	workerTaskRecreate       = "RECREATE"     // only used for naming supervised tasks, never pushed to the tasksChan
+	workerTaskRefreshOld     = "REFRESH_OLD"  // only used for naming supervised tasks, never pushed to the tasksChan
+	workerTaskHealthCheck    = "HEALTH_CHECK" // only used for naming supervised tasks, never pushed to the tasksChan
+	workerTaskRecycleDirty   = "RECYCLE"      // only used for naming supervised tasks, never pushed to the tasksChan
+	workerTaskReclaimExpired = "RECLAIM"      // only used for naming supervised tasks, never pushed to the tasksChan
+	workerTaskProbeCircuit   = "PROBE"        // only used for naming supervised tasks, never pushed to the tasksChan
+)
+
+// FillStatus describes the background fill of a pool up to its InitialPoolSize, started with the pool.
+type FillStatus string
+
+const (
+	FillStatusRunning   FillStatus = "running"   // not all of the initial testdatabases are ready yet
+	FillStatusCancelled FillStatus = "cancelled" // the pool was stopped (e.g. discarded) before the initial testdatabases were ready
+	FillStatusCompleted FillStatus = "completed" // all of the initial testdatabases were ready at least once
+)
+
+const (
+	minRefreshOldInterval = 10 * time.Millisecond
+	maxRefreshOldInterval = 10 * time.Second
 )
 
 // HashPool holds a test DB pool for a certain hash. Each HashPool is running cleanup workers in background.
@@ -62,32 +135,83 @@ type HashPool struct {
 	templateDB db.Database
 	PoolConfig
 
+	checkoutDurations  *util.DurationRecorder
+	latencies          acquireLatencies
+	maxAgeRecreates    int       // number of ready testdatabases recreated as they exceeded the TestDatabaseMaxCloneAge
+	healthReplacements int       // number of ready testdatabases recreated as they failed their health check
+	idleEvictions      int       // number of ready testdatabases dropped as they exceeded the TestDatabaseMaxIdleDuration
+	leaseReclaims      int       // number of leased testdatabases reclaimed as their lease expired
+	lastActivity       time.Time // last checkout or return of a testdatabase (or the creation of the pool)
+
+	overflow        map[int]existingDB // temporary testdatabases beyond MaxPoolSize (see MaxOverflowSize) by ID, dropped on return
+	nextOverflowID  int                // ID of the next overflow testdatabase, IDs are never reused
+	overflowCreated int                // number of overflow testdatabases created
+
+	skipCleanCheckouts int // number of dirty testdatabases handed out as-is (see GetTestDatabaseSkipClean)
+
+	waiters *waitQueue // clients currently waiting within GetTestDatabase
+
+	lastSelectedID int // ID of the last ready testdatabase handed out by GetTestDatabase (SelectionRoundRobin only)
+
+	fill FillStatus // status of filling the pool up to InitialPoolSize in background
+
+	server *db.DatabaseConfig // server the testdatabases are moved to (see MoveTo), nil while located on the configured ones
+
+	breaker circuitBreaker // outcome of the recent (re)creations, see CircuitBreakerThreshold
+
 	sync.RWMutex
-	wg sync.WaitGroup
 
-	tasksChan     chan workerTask
-	running       bool
-	workerContext context.Context // the ctx all background workers will receive (nil if not yet started)
+	tasksChan  chan workerTask
+	running    bool
+	shrinking  bool             // shrinkToMaxLoop is running
+	supervisor *util.Supervisor // owns all background workers (control loop, worker tasks, recreates)
+
+	fillSlots *util.PrioritySemaphore // limits the worker tasks across all pools (see MaxParallelFills), nil if unlimited
 }
 
 // NewHashPool creates new hash pool with the given config.
 // Starts the workers to extend the pool in background up to requested inital number.
 func NewHashPool(cfg PoolConfig, templateDB db.Database, initDBFunc RecreateDBFunc) *HashPool {
 
+	if len(cfg.SelectionPolicy) == 0 {
+		cfg.SelectionPolicy = SelectionLRU
+	}
+
+	// the channels are sized by the limit, the MaxPoolSize may be changed later on (see Resize)
+	if cfg.MaxPoolSizeLimit < cfg.MaxPoolSize {
+		cfg.MaxPoolSizeLimit = cfg.MaxPoolSize
+	}
+
 	pool := &HashPool{
 		dbs:        make([]existingDB, 0, cfg.MaxPoolSize),
-		ready:      make(chan int, cfg.MaxPoolSize),
-		dirty:      make(chan int, cfg.MaxPoolSize),
-		recreating: make(chan struct{}, cfg.MaxPoolSize),
+		ready:      make(chan int, cfg.MaxPoolSizeLimit),
+		dirty:      make(chan int, cfg.MaxPoolSizeLimit),
+		recreating: make(chan struct{}, cfg.MaxPoolSizeLimit),
 
 		recreateDB: makeActualRecreateTestDBFunc(templateDB.Config.Database, initDBFunc),
 		templateDB: templateDB,
 		PoolConfig: cfg,
 
-		tasksChan: make(chan workerTask, cfg.MaxPoolSize+1),
+		checkoutDurations: util.NewDurationRecorder(checkoutDurationSamples),
+		latencies:         newAcquireLatencies(),
+		lastActivity:      time.Now(),
+
+		overflow:       make(map[int]existingDB),
+		nextOverflowID: cfg.MaxPoolSizeLimit,
+
+		waiters: newWaitQueue(),
+
+		lastSelectedID: -1,
+
+		breaker: newCircuitBreaker(),
+
+		tasksChan: make(chan workerTask, cfg.MaxPoolSizeLimit+1),
 		running:   false,
 	}
 
+	// canceled tasks (pool stopped) and a full pool are expected and not worth reporting
+	pool.supervisor = util.NewSupervisor(pool.onTaskError, context.Canceled, ErrPoolFull)
+
 	return pool
 }
 
@@ -105,19 +229,45 @@ func (pool *HashPool) Start() {
 	}
 
 	pool.running = true
+	pool.supervisor.Start(context.Background())
 
-	ctx, cancel := context.WithCancel(context.Background())
-	pool.workerContext = ctx
+	pool.fill = FillStatusRunning
+	pool.unsafeUpdateFill()
 
-	for i := 0; i < pool.InitialPoolSize; i++ {
+	// adopted testdatabases (see InitHashPoolWithAdopted) count towards the InitialPoolSize
+	for i := len(pool.dbs); i < pool.InitialPoolSize; i++ {
 		pool.tasksChan <- workerTaskExtend
 	}
 
-	pool.wg.Add(1)
-	go func() {
-		defer pool.wg.Done()
-		pool.controlLoop(ctx, cancel)
-	}()
+	pool.supervisor.Go("CONTROL_LOOP", pool.controlLoop)
+
+	if pool.TestDatabaseMaxCloneAge > 0 {
+		pool.supervisor.Go(workerTaskRefreshOld, pool.refreshOldLoop)
+	}
+
+	if pool.HealthCheckDB != nil && pool.TestDatabaseHealthCheckInterval > 0 {
+		pool.supervisor.Go(workerTaskHealthCheck, pool.healthCheckLoop)
+	}
+
+	if pool.TestDatabaseLeaseSweepInterval > 0 {
+		pool.supervisor.Go(workerTaskReclaimExpired, pool.reclaimExpiredLoop)
+	}
+
+	if pool.DropIdleDB != nil && pool.TestDatabaseMaxIdleDuration > 0 {
+		pool.supervisor.Go(workerTaskEvictIdle, pool.evictIdleLoop)
+	}
+
+	if pool.WaitStarvationFactor > 0 {
+		pool.supervisor.Go(workerTaskStarvationCheck, pool.starvationCheckLoop)
+	}
+
+	for i := 0; i < pool.DirtyRecycleWorkers; i++ {
+		pool.supervisor.Go(workerTaskRecycleDirty, pool.recycleDirtyLoop)
+	}
+
+	if pool.circuitBreakerEnabled() {
+		pool.supervisor.Go(workerTaskProbeCircuit, pool.probeCircuitLoop)
+	}
 
 	log.Info().Msg("started!")
 }
@@ -129,15 +279,20 @@ func (pool *HashPool) Stop() {
 
 	pool.Lock()
 	if !pool.running {
+		pool.Unlock()
 		log.Warn().Msg("bailout already stopped!")
 		return
 	}
 	pool.running = false
+	if pool.fill == FillStatusRunning {
+		pool.fill = FillStatusCancelled
+	}
 	pool.Unlock()
 
 	pool.tasksChan <- workerTaskStop
-	pool.wg.Wait()
-	pool.workerContext = nil
+	if err := pool.supervisor.Stop(); err != nil {
+		log.Debug().Err(err).Msg("first background task error since start")
+	}
 	log.Warn().Msg("stopped!")
 }
 
@@ -145,27 +300,73 @@ func (pool *HashPool) GetTestDatabase(ctx context.Context, timeout time.Duration
 	var index int
 
 	log := pool.getPoolLogger(ctx, "GetTestDatabase")
+
+	waitStart := time.Now()
+
+	// fail fast instead of waiting for testdatabases that can't be recreated currently
+	if len(pool.ready) == 0 {
+		if err = pool.circuitError(); err != nil {
+			log.Warn().Err(err).Msg("bailout circuit breaker open")
+			return
+		}
+	}
+
+	// latency over churn: don't wait for a recycled testdatabase if the pool is exhausted
+	if overflowDB, ok, overflowErr := pool.getOverflowTestDatabase(ctx); ok {
+		if overflowErr == nil {
+			pool.latencies.readyWait.Record(time.Since(waitStart))
+		}
+		return overflowDB, overflowErr
+	}
+
 	log.Trace().Msg("waiting for ready ID...")
+	timeoutChan := time.After(timeout)
 
-	select {
-	case <-time.After(timeout):
-		err = ErrTimeout
-		log.Error().Err(err).Dur("timeout", timeout).Msg("timeout")
-		return
-	case <-ctx.Done():
-		err = ctx.Err()
-		log.Warn().Err(err).Msg("ctx done")
-		return
-	case index = <-pool.ready:
+	waiterID := pool.waiters.Enter(holderFromContext(ctx))
+	defer pool.waiters.Leave(waiterID)
+
+	for {
+		select {
+		case <-timeoutChan:
+			err = ErrTimeout
+			log.Error().Err(err).Dur("timeout", timeout).Msg("timeout")
+			return
+		case <-ctx.Done():
+			err = ctx.Err()
+			log.Warn().Err(err).Msg("ctx done")
+			return
+		case index = <-pool.ready:
+		}
+
+		index = pool.selectReady(index)
+
+		// unhealthy testdatabases are replaced in background, continue waiting for the next ready one then
+		if pool.HealthCheckDB == nil || !pool.TestDatabaseHealthCheckOnAcquire || pool.probeClaimed(ctx, index) {
+			break
+		}
+
+		if ctx.Err() != nil {
+			err = ctx.Err()
+			log.Warn().Err(err).Msg("ctx done")
+			return
+		}
 	}
 
+	readyWait := time.Since(waitStart)
+
 	log = log.With().Int("id", index).Logger()
 	log.Trace().Msg("got ready testdatabase!")
 
+	lockStart := time.Now()
 	reg := trace.StartRegion(ctx, "wait_for_lock_hash_pool")
 	pool.Lock()
 	defer pool.Unlock()
 	reg.End()
+	lockWait := time.Since(lockStart)
+
+	pool.latencies.readyWait.Record(readyWait)
+	pool.latencies.lockWait.Record(lockWait)
+	log.Debug().Dur("readyWait", readyWait).Dur("lockWait", lockWait).Msg("acquire latencies")
 
 	// sanity check, should never happen
 	if index < 0 || index >= len(pool.dbs) {
@@ -184,7 +385,12 @@ func (pool *HashPool) GetTestDatabase(ctx context.Context, timeout time.Duration
 
 	// flag as dirty and block auto clean until
 	testDB.state = dbStateDirty
-	testDB.blockAutoCleanDirtyUntil = time.Now().Add(pool.TestDatabaseMinimalLifetime)
+	testDB.checkedOutAt = time.Now()
+	testDB.checkedOutBy = holderFromContext(ctx)
+	testDB.lastUsedAt = testDB.checkedOutAt
+	testDB.checkouts++
+	pool.lastActivity = testDB.checkedOutAt
+	pool.unsafeStartLease(ctx, &testDB)
 
 	pool.dbs[index] = testDB
 	pool.dirty <- index
@@ -212,8 +418,8 @@ func (pool *HashPool) workerTaskLoop(ctx context.Context, taskChan <-chan worker
 	log.Debug().Msg("starting...")
 
 	handlers := map[workerTask]func(ctx context.Context) error{
-		workerTaskExtend:         ignoreErrs(pool.extend, ErrPoolFull, context.Canceled),
-		workerTaskAutoCleanDirty: ignoreErrs(pool.autoCleanDirty, context.Canceled),
+		workerTaskExtend:         pool.extend,
+		workerTaskAutoCleanDirty: pool.autoCleanDirty,
 	}
 
 	// to limit the number of running goroutines.
@@ -233,44 +439,48 @@ func (pool *HashPool) workerTaskLoop(ctx context.Context, taskChan <-chan worker
 		case semaphore <- struct{}{}:
 		}
 
-		pool.wg.Add(1)
-		go func(task workerTask) {
-
+		// errors are aggregated and logged by the supervisor
+		task := task
+		started := pool.supervisor.Go(string(task), func(ctx context.Context) error {
 			defer func() {
-				pool.wg.Done()
 				<-semaphore
 			}()
 
+			// competes with the worker tasks of all other pools
+			if err := pool.fillSlots.Acquire(ctx, pool.FillPriority); err != nil {
+				return err
+			}
+			defer pool.fillSlots.Release()
+
 			log.Debug().Msgf("task=%v", task)
 
-			if err := handler(ctx); err != nil {
-				log.Error().Err(err).Msgf("task=%v FAILED!", task)
-			}
-		}(task)
+			return handler(ctx)
+		})
 
+		if !started {
+			// supervisor is stopping
+			<-semaphore
+			return
+		}
 	}
 }
 
-func (pool *HashPool) controlLoop(ctx context.Context, cancel context.CancelFunc) {
+func (pool *HashPool) controlLoop(ctx context.Context) error {
 
 	log := pool.getPoolLogger(ctx, "controlLoop")
 	log.Debug().Msg("starting...")
 
-	defer cancel()
-
 	workerTasksChan := make(chan workerTask, len(pool.tasksChan))
-	pool.wg.Add(1)
-	go func() {
-		defer pool.wg.Done()
+	pool.supervisor.Go("WORKER_TASK_LOOP", func(ctx context.Context) error {
 		pool.workerTaskLoop(ctx, workerTasksChan, pool.MaxParallelTasks)
-	}()
+		return nil
+	})
 
 	for task := range pool.tasksChan {
 		if task == workerTaskStop {
 			log.Debug().Msg("stopping...")
 			close(workerTasksChan)
-			cancel()
-			return
+			return nil
 		}
 
 		select {
@@ -280,6 +490,10 @@ func (pool *HashPool) controlLoop(ctx context.Context, cancel context.CancelFunc
 			// be available to receive Stop message at any time
 		}
 	}
+
+	// tasksChan was closed
+	close(workerTasksChan)
+	return nil
 }
 
 // ReturnTestDatabase returns the given test DB directly to the pool, without cleaning (recreating it).
@@ -288,6 +502,10 @@ func (pool *HashPool) ReturnTestDatabase(ctx context.Context, id int) error {
 	log := pool.getPoolLogger(ctx, "ReturnTestDatabase").With().Int("id", id).Logger()
 	log.Debug().Msg("returning...")
 
+	if pool.isOverflowID(id) {
+		return pool.returnOverflow(ctx, id)
+	}
+
 	pool.Lock()
 	defer pool.Unlock()
 
@@ -303,9 +521,20 @@ func (pool *HashPool) ReturnTestDatabase(ctx context.Context, id int) error {
 	}
 
 	// check if db is in the correct state
+	if state := pool.dbs[id].state; state != dbStateDirty {
+		log.Warn().Int("dbs", len(pool.dbs)).Msgf("bailout invalid state=%v.", state)
+		return nil
+	}
+
+	pool.unsafeRecordCheckoutEnd(log, &pool.dbs[id])
 	testDB := pool.dbs[id]
-	if testDB.state != dbStateDirty {
-		log.Warn().Int("dbs", len(pool.dbs)).Msgf("bailout invalid state=%v.", testDB.state)
+
+	if pool.unsafeMoving(testDB) {
+		// drained, relocated to the server the pool is moved to instead
+		pool.excludeIDFromChannel(pool.dirty, id)
+		pool.spawnRecreate(log, id)
+
+		pool.unsafeTraceLogStats(log)
 		return nil
 	}
 
@@ -322,13 +551,13 @@ func (pool *HashPool) ReturnTestDatabase(ctx context.Context, id int) error {
 	return nil
 }
 
-func (pool *HashPool) excludeIDFromChannel(ch chan int, excludeID int) {
+func (pool *HashPool) excludeIDFromChannel(ch chan int, excludeID int) (excluded bool) {
 
 	// The testDB identified by overgiven id may still in a specific channel (typically dirty). We want to exclude it.
 	// We need to explicitly remove it from there by filtering the current channel to a tmp channel.
 	// We finally close the tmp channel and flush it onto the specific channel again.
 	// The id is now no longer in the channel.
-	filtered := make(chan int, pool.MaxPoolSize)
+	filtered := make(chan int, cap(ch))
 
 	var id int
 	for loop := true; loop; {
@@ -336,6 +565,8 @@ func (pool *HashPool) excludeIDFromChannel(ch chan int, excludeID int) {
 		case id = <-ch:
 			if id != excludeID {
 				filtered <- id
+			} else {
+				excluded = true
 			}
 		default:
 			loop = false
@@ -350,23 +581,225 @@ func (pool *HashPool) excludeIDFromChannel(ch chan int, excludeID int) {
 	for id := range filtered {
 		ch <- id
 	}
+
+	return excluded
+}
+
+// refreshOldLoop periodically recreates ready testdatabases exceeding the TestDatabaseMaxCloneAge until the ctx is done.
+// Runs outside of the maintenance schedule are skipped.
+func (pool *HashPool) refreshOldLoop(ctx context.Context) error {
+	interval := pool.TestDatabaseMaxCloneAge / 4
+	if interval < minRefreshOldInterval {
+		interval = minRefreshOldInterval
+	}
+	if interval > maxRefreshOldInterval {
+		interval = maxRefreshOldInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case now := <-ticker.C:
+			if pool.Maintenance.Allowed(now) {
+				pool.refreshOld(ctx)
+			}
+		}
+	}
+}
+
+// refreshOld moves ready testdatabases exceeding the TestDatabaseMaxCloneAge back to dirty and recreates them in background.
+// At most MaxParallelTasks testdatabases are refreshed at once, the oldest ones first.
+func (pool *HashPool) refreshOld(ctx context.Context) {
+
+	log := pool.getPoolLogger(ctx, "refreshOld")
+
+	reg := trace.StartRegion(ctx, "worker_wait_for_lock_hash_pool")
+	pool.Lock()
+	reg.End()
+
+	old := make([]int, 0)
+	for id, testDB := range pool.dbs {
+		if testDB.state == dbStateReady && !testDB.recreatedAt.IsZero() && time.Since(testDB.recreatedAt) > pool.TestDatabaseMaxCloneAge {
+			old = append(old, id)
+		}
+	}
+
+	sort.Slice(old, func(i, j int) bool { return pool.dbs[old[i]].recreatedAt.Before(pool.dbs[old[j]].recreatedAt) })
+	if len(old) > pool.MaxParallelTasks {
+		old = old[:pool.MaxParallelTasks]
+	}
+
+	refresh := make([]int, 0, len(old))
+	for _, id := range old {
+		// the testdatabase might have just been taken from the ready channel by GetTestDatabase (waiting for the lock), skip it then
+		if !pool.excludeIDFromChannel(pool.ready, id) {
+			continue
+		}
+
+		pool.dbs[id].state = dbStateDirty
+		pool.maxAgeRecreates++
+		refresh = append(refresh, id)
+	}
+
+	if len(refresh) > 0 {
+		log.Debug().Ints("ids", refresh).Dur("maxCloneAge", pool.TestDatabaseMaxCloneAge).Msg("recreating old ready testdatabases...")
+		pool.unsafeTraceLogStats(log)
+	}
+
+	pool.Unlock()
+
+	for _, id := range refresh {
+		id := id
+		started := pool.supervisor.Go(workerTaskRecreate, func(ctx context.Context) error {
+			return pool.recreateDatabaseGracefully(ctx, id)
+		})
+
+		if !started {
+			// pool is stopping, keep it dirty so it's picked up by the auto cleaning after the next start
+			pool.dirty <- id
+		}
+	}
+}
+
+// healthCheckLoop periodically probes all ready testdatabases until the ctx is done.
+// Runs outside of the maintenance schedule are skipped.
+func (pool *HashPool) healthCheckLoop(ctx context.Context) error {
+	ticker := time.NewTicker(pool.TestDatabaseHealthCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case now := <-ticker.C:
+			if pool.Maintenance.Allowed(now) {
+				pool.healthCheck(ctx)
+			}
+		}
+	}
+}
+
+// healthCheck probes all ready testdatabases one after another. Each one is claimed from the ready channel while
+// being probed only, thus at most a single ready testdatabase is withheld from GetTestDatabase at once.
+func (pool *HashPool) healthCheck(ctx context.Context) {
+	pool.RLock()
+	ids := make([]int, 0, len(pool.ready))
+	for id, testDB := range pool.dbs {
+		if testDB.state == dbStateReady {
+			ids = append(ids, id)
+		}
+	}
+	pool.RUnlock()
+
+	for _, id := range ids {
+		if ctx.Err() != nil {
+			return
+		}
+
+		pool.Lock()
+		// the testdatabase might have been handed out or removed in the meantime, skip it then
+		claimed := id < len(pool.dbs) && pool.dbs[id].state == dbStateReady && pool.excludeIDFromChannel(pool.ready, id)
+		pool.Unlock()
+
+		if !claimed {
+			continue
+		}
+
+		if pool.probeClaimed(ctx, id) {
+			pool.ready <- id
+		}
+	}
+}
+
+// probeClaimed probes the ready testdatabase with the given id, which must have been taken from the ready channel.
+// Returns true if it's healthy (still owned by the caller). Otherwise it's recreated in background and false is returned.
+func (pool *HashPool) probeClaimed(ctx context.Context, id int) bool {
+
+	defer tracing.Region(ctx, "health_check_db").End()
+
+	log := pool.getPoolLogger(ctx, "probeClaimed").With().Int("id", id).Logger()
+
+	pool.RLock()
+	if id < 0 || id >= len(pool.dbs) {
+		pool.RUnlock()
+		// removed in the meantime, GetTestDatabase will report the invalid index
+		return true
+	}
+	testDB := pool.dbs[id].TestDatabase
+	pool.RUnlock()
+
+	err := pool.HealthCheckDB(ctx, testDB)
+	if err == nil {
+		return true
+	}
+
+	if ctx.Err() != nil {
+		// the probe was canceled, this says nothing about the testdatabase
+		pool.ready <- id
+		return false
+	}
+
+	pool.Lock()
+	if id >= len(pool.dbs) || pool.dbs[id].state != dbStateReady {
+		pool.Unlock()
+		return false
+	}
+	pool.dbs[id].state = dbStateDirty
+	pool.healthReplacements++
+	pool.Unlock()
+
+	dbName := testDB.Config.Database
+	log.Warn().Err(err).Str("dbName", dbName).Msg("testdatabase is unhealthy, recreating...")
+
+	pool.Events.Emit(events.Event{
+		Type:    events.TypeTestDatabaseUnhealthy,
+		Hash:    pool.templateDB.TemplateHash,
+		Message: fmt.Sprintf("test database %s failed its health check and is recreated: %v", dbName, err),
+		Fields: map[string]interface{}{
+			"id":     id,
+			"dbName": dbName,
+			"error":  err.Error(),
+		},
+	})
+
+	started := pool.supervisor.Go(workerTaskRecreate, func(ctx context.Context) error {
+		return pool.recreateDatabaseGracefully(ctx, id)
+	})
+
+	if !started {
+		// pool is stopping, keep it dirty so it's picked up by the auto cleaning after the next start
+		pool.dirty <- id
+	}
+
+	return false
 }
 
 // RecreateTestDatabase prioritizes the test DB to be recreated next via the dirty worker.
 func (pool *HashPool) RecreateTestDatabase(ctx context.Context, id int) error {
 
 	log := pool.getPoolLogger(ctx, "RecreateTestDatabase").With().Int("id", id).Logger()
+
+	// overflow testdatabases are never recycled
+	if pool.isOverflowID(id) {
+		return pool.returnOverflow(ctx, id)
+	}
+
 	log.Debug().Msg("flag testdatabase for recreation...")
 
-	pool.RLock()
+	pool.Lock()
 
 	if id < 0 || id >= len(pool.dbs) {
 		log.Warn().Int("dbs", len(pool.dbs)).Msg("bailout invalid index!")
-		pool.RUnlock()
+		pool.Unlock()
 		return ErrInvalidIndex
 	}
 
-	pool.RUnlock()
+	pool.unsafeRecordCheckoutEnd(log, &pool.dbs[id])
+	pool.Unlock()
 
 	if err := ctx.Err(); err != nil {
 		// client vanished
@@ -378,9 +811,16 @@ func (pool *HashPool) RecreateTestDatabase(ctx context.Context, id int) error {
 	pool.excludeIDFromChannel(pool.dirty, id)
 
 	// directly spawn a new worker in the bg (with the same ctx as the typical workers)
-	// note that this runs unchained, meaning we do not care about errors that may happen via this bg task
-	//nolint:errcheck
-	go pool.recreateDatabaseGracefully(pool.workerContext, id)
+	// errors that may happen via this bg task are aggregated by the supervisor
+	started := pool.supervisor.Go(workerTaskRecreate, func(ctx context.Context) error {
+		return pool.recreateDatabaseGracefully(ctx, id)
+	})
+
+	if !started {
+		// pool is not running, keep it dirty so it's picked up by the auto cleaning after the next start
+		log.Warn().Msg("pool is not running, deferring recreate to the dirty worker")
+		pool.dirty <- id
+	}
 
 	pool.unsafeTraceLogStats(log)
 	return nil
@@ -392,6 +832,8 @@ func (pool *HashPool) recreateDatabaseGracefully(ctx context.Context, id int) er
 	log := pool.getPoolLogger(ctx, "recreateDatabaseGracefully").With().Int("id", id).Logger()
 	log.Debug().Msg("recreating...")
 
+	cleanStart := time.Now()
+
 	if err := ctx.Err(); err != nil {
 		// pool closed in the meantime.
 		log.Error().Err(err).Msg("bailout pre locking ctx err")
@@ -407,14 +849,32 @@ func (pool *HashPool) recreateDatabaseGracefully(ctx context.Context, id int) er
 		return nil
 	}
 
+	if pool.unsafeCircuitBlocks(id) {
+		// recreated as soon as the circuit breaker closes again
+		log.Debug().Msg("bailout circuit breaker open")
+		pool.Unlock()
+		return nil
+	}
+
 	testDB := pool.dbs[id]
 
+	// relocated to the server the pool is moved to, the previous one is dropped first
+	var moved *db.TestDatabase
+	if pool.unsafeMoving(testDB) {
+		previous := testDB.TestDatabase
+		moved = &previous
+		testDB.Config = pool.testDBConfig(id)
+	}
+
 	// set state recreating...
 	pool.dbs[id].state = dbStateRecreating
 	pool.dbs[id] = testDB
 
 	pool.Unlock()
 
+	// each recreation gets a new seed assigned, which may be used by the recreate func
+	testDB.Seed = newSeed()
+
 	pool.recreating <- struct{}{}
 
 	defer func() {
@@ -431,7 +891,20 @@ func (pool *HashPool) recreateDatabaseGracefully(ctx context.Context, id int) er
 			try++
 
 			log.Trace().Int("try", try).Msg("trying to recreate...")
-			err := pool.recreateDB(ctx, &testDB)
+
+			var err error
+			if moved != nil && pool.DropMovedDB != nil {
+				err = pool.DropMovedDB(ctx, *moved)
+			}
+
+			if err == nil {
+				moved = nil
+
+				ddlStart := time.Now()
+				err = pool.recreateDB(ctx, &testDB)
+				pool.latencies.ddl.Record(time.Since(ddlStart))
+			}
+
 			if err != nil {
 				// only still connected errors are worthy a retry
 				if errors.Is(err, ErrTestDBInUse) {
@@ -442,10 +915,21 @@ func (pool *HashPool) recreateDatabaseGracefully(ctx context.Context, id int) er
 					}
 
 					log.Warn().Int("try", try).Dur("backoff", backoff).Msg("DB is still in use, will retry...")
-					time.Sleep(backoff)
+
+					// stopping the pool (e.g. while discarding it) must not wait for the backoff
+					select {
+					case <-ctx.Done():
+						return ctx.Err()
+					case <-time.After(backoff):
+					}
 				} else {
 
 					log.Error().Int("try", try).Err(err).Msg("bailout worker task DB error while cleanup!")
+
+					if ctx.Err() == nil {
+						pool.recordRecreateFailure(log, id, err)
+					}
+
 					return err
 				}
 			} else {
@@ -470,13 +954,36 @@ MoveToReady:
 		return nil
 	}
 
+	if pool.unsafeMoving(pool.dbs[id]) {
+		// the pool was moved to another server while recreating it, relocate it right away
+		pool.dbs[id].state = dbStateDirty
+		pool.spawnRecreate(log, id)
+
+		return nil
+	}
+
 	// increase the generation of the testdb (as we just recreated it) and move into ready!
 	pool.dbs[id].generation++
 	pool.dbs[id].state = dbStateReady
+	pool.dbs[id].Seed = testDB.Seed
+	pool.dbs[id].recreatedAt = time.Now()
+
+	// auto cleaned testdatabases (never explicitly returned) are no longer checked out
+	if !pool.dbs[id].checkedOutAt.IsZero() {
+		pool.dbs[id].checkedOutAt = time.Time{}
+		pool.dbs[id].checkedOutBy = ""
+		pool.dbs[id].leased = false
+		pool.lastActivity = time.Now()
+	}
 
 	pool.ready <- pool.dbs[id].ID
+	pool.unsafeUpdateFill()
+	pool.unsafeRecordRecreateSuccess(log, id)
 
-	log.Debug().Uint("generation", pool.dbs[id].generation).Msg("ready")
+	cleanDuration := time.Since(cleanStart)
+	pool.latencies.clean.Record(cleanDuration)
+
+	log.Debug().Uint("generation", pool.dbs[id].generation).Dur("clean", cleanDuration).Int("tries", try).Msg("ready")
 	pool.unsafeTraceLogStats(log)
 	return nil
 }
@@ -489,9 +996,6 @@ func (pool *HashPool) autoCleanDirty(ctx context.Context) error {
 	log := pool.getPoolLogger(ctx, "autoCleanDirty")
 	log.Trace().Msg("autocleaning...")
 
-	ctx, task := trace.NewTask(ctx, "worker_clean_dirty")
-	defer task.End()
-
 	var id int
 	select {
 	case id = <-pool.dirty:
@@ -503,7 +1007,50 @@ func (pool *HashPool) autoCleanDirty(ctx context.Context) error {
 		return nil
 	}
 
-	// got id...
+	ctx, span := tracing.Start(ctx, "worker_clean_dirty", attribute.String("hash", pool.templateDB.TemplateHash), attribute.Int("id", id))
+	defer span.End()
+
+	err := pool.cleanDirty(ctx, log, id)
+	span.RecordError(err)
+
+	return err
+}
+
+// recycleDirtyLoop continuously takes dirty testdatabases from the 'dirty' channel and recreates them as soon as they
+// are eligible for auto-cleaning, regardless of whether the pool is full, until the ctx is done (see DirtyRecycleWorkers).
+func (pool *HashPool) recycleDirtyLoop(ctx context.Context) error {
+
+	log := pool.getPoolLogger(ctx, "recycleDirtyLoop")
+	log.Debug().Msg("starting...")
+
+	for {
+		var id int
+		select {
+		case id = <-pool.dirty:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		spanCtx, span := tracing.Start(ctx, "worker_recycle_dirty", attribute.String("hash", pool.templateDB.TemplateHash), attribute.Int("id", id))
+		err := pool.cleanDirty(spanCtx, log, id)
+		span.RecordError(err)
+		span.End()
+
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+
+			// keep recycling the others, the error is aggregated and logged by the supervisor
+			pool.supervisor.Report(workerTaskRecycleDirty, err)
+		}
+	}
+}
+
+// cleanDirty recreates the dirty testdatabase with the given id (taken from the 'dirty' channel) as soon as it's
+// eligible for auto-cleaning, sleeping until its minimal lifetime or lease is over.
+func (pool *HashPool) cleanDirty(ctx context.Context, log zerolog.Logger, id int) error {
+
 	log = log.With().Int("id", id).Logger()
 	log.Trace().Msg("checking cleaning prerequisites...")
 
@@ -534,34 +1081,41 @@ func (pool *HashPool) autoCleanDirty(ctx context.Context) error {
 	// else we need to wait until we are allowed to work with it!
 	// we block auto-cleaning until we are allowed to...
 	log.Warn().Msg("sleeping before being allowed to clean...")
-	time.Sleep(blockedUntil)
 
-	// we need to check that the testDB.generation did not change since we slept
-	// (which would indicate that the database was already unlocked/recreated by someone else in the meantime)
-	pool.RLock()
+	for blockedUntil > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(blockedUntil):
+		}
+
+		// we need to check that the testDB.generation did not change since we slept
+		// (which would indicate that the database was already unlocked/recreated by someone else in the meantime)
+		pool.RLock()
+
+		if pool.dbs[id].generation != generation || pool.dbs[id].state != dbStateDirty {
+			log.Error().Msgf("bailout old generation=%v vs new generation=%v state=%v", generation, pool.dbs[id].generation, pool.dbs[id].state)
+			pool.RUnlock()
+			return nil
+		}
+
+		// the lease might have been renewed in the meantime (see RenewTestDatabase)
+		blockedUntil = time.Until(pool.dbs[id].blockAutoCleanDirtyUntil)
 
-	if pool.dbs[id].generation != generation || pool.dbs[id].state != dbStateDirty {
-		log.Error().Msgf("bailout old generation=%v vs new generation=%v state=%v", generation, pool.dbs[id].generation, pool.dbs[id].state)
 		pool.RUnlock()
-		return nil
-	}
 
-	pool.RUnlock()
+		if blockedUntil > 0 {
+			log.Debug().Dur("blockedUntil", blockedUntil).Msg("lease was renewed, sleeping again...")
+		}
+	}
 
 	log.Trace().Msg("clean now (after sleep has happenend)!")
 	return pool.recreateDatabaseGracefully(ctx, id)
 }
 
-func ignoreErrs(f func(ctx context.Context) error, errs ...error) func(context.Context) error {
-	return func(ctx context.Context) error {
-		err := f(ctx)
-		for _, e := range errs {
-			if errors.Is(err, e) {
-				return nil
-			}
-		}
-		return err
-	}
+func newSeed() int64 {
+	// #nosec G404 - seeds are meant for reproducible test data only, no need for a cryptographically secure source
+	return rand.Int63()
 }
 
 func (pool *HashPool) extend(ctx context.Context) error {
@@ -569,8 +1123,14 @@ func (pool *HashPool) extend(ctx context.Context) error {
 	log := pool.getPoolLogger(ctx, "extend")
 	log.Trace().Msg("extending...")
 
-	ctx, task := trace.NewTask(ctx, "worker_extend")
-	defer task.End()
+	if err := ctx.Err(); err != nil {
+		// pool stopped in the meantime (e.g. discarded right after finalizing), don't add any more testdatabases
+		log.Debug().Err(err).Msg("bailout pre locking ctx err")
+		return err
+	}
+
+	ctx, span := tracing.Start(ctx, "worker_extend", attribute.String("hash", pool.templateDB.TemplateHash))
+	defer span.End()
 
 	reg := trace.StartRegion(ctx, "worker_wait_for_lock_hash_pool")
 	pool.Lock()
@@ -578,8 +1138,8 @@ func (pool *HashPool) extend(ctx context.Context) error {
 
 	// get index of a next test DB - its ID
 	index := len(pool.dbs)
-	if index == cap(pool.dbs) {
-		log.Error().Int("dbs", len(pool.dbs)).Int("cap", cap(pool.dbs)).Err(ErrPoolFull).Msg("pool is full")
+	if index >= pool.MaxPoolSize {
+		log.Error().Int("dbs", len(pool.dbs)).Int("max", pool.MaxPoolSize).Err(ErrPoolFull).Msg("pool is full")
 		pool.Unlock()
 		return ErrPoolFull
 	}
@@ -590,13 +1150,12 @@ func (pool *HashPool) extend(ctx context.Context) error {
 		TestDatabase: db.TestDatabase{
 			Database: db.Database{
 				TemplateHash: pool.templateDB.TemplateHash,
-				Config:       pool.templateDB.Config,
+				Config:       pool.testDBConfig(index),
 			},
 			ID: index,
 		},
+		lastUsedAt: time.Now(),
 	}
-	// set DB name
-	newTestDB.Database.Config.Database = makeDBName(pool.TestDBNamePrefix, pool.templateDB.TemplateHash, index)
 
 	// add new test DB to the pool (currently it's dirty!)
 	pool.dbs = append(pool.dbs, newTestDB)
@@ -613,14 +1172,31 @@ func (pool *HashPool) RemoveAll(ctx context.Context, removeFunc RemoveDBFunc) er
 
 	log := pool.getPoolLogger(ctx, "RemoveAll")
 
-	// stop all workers
-	pool.Stop()
+	// stop all workers (unless already stopped, e.g. via PoolCollection.CancelFill)
+	pool.RLock()
+	running := pool.running
+	pool.RUnlock()
+
+	if running {
+		pool.Stop()
+	}
 
 	// wait until all current "recreating" tasks are finished...
 
 	pool.Lock()
 	defer pool.Unlock()
 
+	// overflow testdatabases (including the ones currently created or dropped) are removed first
+	for id, testDB := range pool.overflow {
+		if err := removeFunc(ctx, testDB.TestDatabase); err != nil {
+			log.Error().Int("id", id).Err(err).Msg("removeFunc overflow testdatabase err")
+			return err
+		}
+
+		delete(pool.overflow, id)
+		log.Debug().Int("id", id).Msg("overflow testdatabase removed!")
+	}
+
 	if len(pool.dbs) == 0 {
 		log.Error().Msg("bailout no dbs.")
 		return nil
@@ -653,8 +1229,309 @@ func (pool *HashPool) RemoveAll(ctx context.Context, removeFunc RemoveDBFunc) er
 	return nil
 }
 
+// Stats describes the current state of a HashPool.
+type Stats struct {
+	TemplateHash      string               `json:"templateHash"`
+	CheckoutDurations util.DurationSummary `json:"checkoutDurations"` // how long testdatabases were checked out until they were explicitly returned (unlock or recreate)
+	Latencies         LatencyStats         `json:"latencies"`
+
+	// current number of testdatabases (besides overflow ones) by state
+	Ready      int `json:"ready"`
+	Dirty      int `json:"dirty"` // checked out or waiting to be auto-cleaned
+	InUse      int `json:"inUse"` // dirty ones currently checked out by clients
+	Recreating int `json:"recreating"`
+
+	// current sizes of the pool, see Resize
+	Size PoolSize `json:"size"`
+
+	// testdatabases currently excluded from rotation, see Freeze
+	Frozen []FrozenTestDatabase `json:"frozen,omitempty"`
+
+	// total number of testdatabases handed out (including overflow and skip clean ones) and the mean time waited for
+	// them, shortcuts of Latencies.ReadyWait
+	Acquisitions int     `json:"acquisitions"`
+	AvgWaitMs    float64 `json:"avgWaitMs"`
+
+	// errors of background tasks (extend, clean dirty, recreate) per task
+	BackgroundErrors map[string]util.TaskErrors `json:"backgroundErrors,omitempty"`
+
+	// number of ready testdatabases recreated as they exceeded the max clone age
+	MaxCloneAgeRecreates int `json:"maxCloneAgeRecreates"`
+
+	// number of ready testdatabases recreated as they failed their health check
+	HealthCheckReplacements int `json:"healthCheckReplacements"`
+
+	// number of ready testdatabases dropped as they weren't handed out within the max idle duration (or by shrinking the pool)
+	IdleEvictions int `json:"idleEvictions"`
+
+	// number of leased testdatabases reclaimed as their lease expired without being returned or renewed
+	LeaseReclaims int `json:"leaseReclaims"`
+
+	// number of currently existing overflow testdatabases (beyond the max pool size) and the total number created
+	Overflow        int `json:"overflow"`
+	OverflowCreated int `json:"overflowCreated"`
+
+	// number of dirty testdatabases handed out as-is, without recreating them (skip clean)
+	SkipCleanCheckouts int `json:"skipCleanCheckouts"`
+
+	// policy selecting the ready testdatabase to hand out, compare its effect via the clean and DDL latencies
+	SelectionPolicy SelectionPolicy `json:"selectionPolicy"`
+
+	// status of filling the pool up to its initial size in background
+	Fill FillStatus `json:"fill"`
+
+	// clients currently waiting for a ready testdatabase and whether they starve
+	WaitQueue WaitQueueStats `json:"waitQueue"`
+
+	// testdatabases per server if they are spread across multiple ones
+	Shards []ShardStats `json:"shards,omitempty"`
+
+	// outcome of the (re)creations of testdatabases and the state of the circuit breaker
+	Circuit CircuitStats `json:"circuit"`
+}
+
+// LatencyStats breaks down where time is spent while acquiring and preparing testdatabases.
+type LatencyStats struct {
+	TemplateWait util.DurationSummary `json:"templateWait"` // waiting for the template to become finalized (recorded by the manager)
+	ReadyWait    util.DurationSummary `json:"readyWait"`    // waiting for a ready testdatabase
+	LockWait     util.DurationSummary `json:"lockWait"`     // waiting for the pool lock after a ready testdatabase was received
+	Clean        util.DurationSummary `json:"clean"`        // dirty -> ready, including retries and backoff
+	DDL          util.DurationSummary `json:"ddl"`          // single recreate attempts (drop, create from template, post clone)
+}
+
+type acquireLatencies struct {
+	templateWait *util.DurationRecorder
+	readyWait    *util.DurationRecorder
+	lockWait     *util.DurationRecorder
+	clean        *util.DurationRecorder
+	ddl          *util.DurationRecorder
+}
+
+func newAcquireLatencies() acquireLatencies {
+	return acquireLatencies{
+		templateWait: util.NewDurationRecorder(checkoutDurationSamples),
+		readyWait:    util.NewDurationRecorder(checkoutDurationSamples),
+		lockWait:     util.NewDurationRecorder(checkoutDurationSamples),
+		clean:        util.NewDurationRecorder(checkoutDurationSamples),
+		ddl:          util.NewDurationRecorder(checkoutDurationSamples),
+	}
+}
+
+// Stats returns the current stats of this pool.
+func (pool *HashPool) Stats() Stats {
+	pool.RLock()
+	maxAgeRecreates := pool.maxAgeRecreates
+	healthReplacements := pool.healthReplacements
+	idleEvictions := pool.idleEvictions
+	leaseReclaims := pool.leaseReclaims
+	overflow := len(pool.overflow)
+	overflowCreated := pool.overflowCreated
+	skipCleanCheckouts := pool.skipCleanCheckouts
+	fill := pool.fill
+	circuit := pool.unsafeCircuitStats()
+	size := pool.unsafePoolSize()
+	frozen := pool.unsafeFrozen()
+
+	var ready, dirty, inUse, recreating int
+	for _, testDB := range pool.dbs {
+		switch testDB.state {
+		case dbStateReady:
+			ready++
+		case dbStateRecreating:
+			recreating++
+		case dbStateDirty, dbStateClaimed:
+			dirty++
+			if !testDB.checkedOutAt.IsZero() {
+				inUse++
+			}
+		}
+	}
+	pool.RUnlock()
+
+	readyWait := pool.latencies.readyWait.Summary()
+
+	return Stats{
+		TemplateHash:      pool.templateDB.TemplateHash,
+		CheckoutDurations: pool.checkoutDurations.Summary(),
+		Latencies: LatencyStats{
+			TemplateWait: pool.latencies.templateWait.Summary(),
+			ReadyWait:    readyWait,
+			LockWait:     pool.latencies.lockWait.Summary(),
+			Clean:        pool.latencies.clean.Summary(),
+			DDL:          pool.latencies.ddl.Summary(),
+		},
+		Ready:                   ready,
+		Dirty:                   dirty,
+		InUse:                   inUse,
+		Recreating:              recreating,
+		Size:                    size,
+		Frozen:                  frozen,
+		Acquisitions:            readyWait.Count,
+		AvgWaitMs:               readyWait.MeanMs,
+		BackgroundErrors:        pool.supervisor.Errors(),
+		MaxCloneAgeRecreates:    maxAgeRecreates,
+		HealthCheckReplacements: healthReplacements,
+		IdleEvictions:           idleEvictions,
+		LeaseReclaims:           leaseReclaims,
+		Overflow:                overflow,
+		OverflowCreated:         overflowCreated,
+		SkipCleanCheckouts:      skipCleanCheckouts,
+		SelectionPolicy:         pool.SelectionPolicy,
+		Fill:                    fill,
+		WaitQueue:               pool.waiters.Stats(time.Now()),
+		Shards:                  pool.shardStats(),
+		Circuit:                 circuit,
+	}
+}
+
+// FillStatus returns the status of filling the pool up to its InitialPoolSize in background.
+func (pool *HashPool) FillStatus() FillStatus {
+	pool.RLock()
+	defer pool.RUnlock()
+
+	return pool.fill
+}
+
+// unsafeUpdateFill completes the running fill as soon as InitialPoolSize testdatabases were ready at least once.
+// Attention: pool must be locked!
+func (pool *HashPool) unsafeUpdateFill() {
+	if pool.fill != FillStatusRunning {
+		return
+	}
+
+	filled := 0
+	for _, testDB := range pool.dbs {
+		if testDB.generation > 0 {
+			filled++
+		}
+	}
+
+	if filled >= pool.InitialPoolSize {
+		pool.fill = FillStatusCompleted
+	}
+}
+
+// TestDatabaseStates returns the current state of each testdatabase of this pool (including overflow ones) by database name.
+func (pool *HashPool) TestDatabaseStates() map[string]string {
+	pool.RLock()
+	defer pool.RUnlock()
+
+	states := make(map[string]string, len(pool.dbs)+len(pool.overflow))
+	for _, testDB := range pool.dbs {
+		states[testDB.Database.Config.Database] = testDB.state.String()
+	}
+	for _, testDB := range pool.overflow {
+		states[testDB.Database.Config.Database] = testDB.state.String()
+	}
+
+	return states
+}
+
+// onTaskError is called by the supervisor for each failed background task.
+func (pool *HashPool) onTaskError(task string, err error) {
+	log := pool.getPoolLogger(context.Background(), "onTaskError")
+	log.Error().Err(err).Str("task", task).Msg("background task failed")
+
+	pool.Events.Emit(events.Event{
+		Type:    events.TypeBackgroundTaskFailed,
+		Hash:    pool.templateDB.TemplateHash,
+		Message: fmt.Sprintf("background task %s failed: %v", task, err),
+		Fields: map[string]interface{}{
+			"task":  task,
+			"error": err.Error(),
+		},
+	})
+}
+
+// Activity returns the number of currently checked out testdatabases and the time of the last checkout or return.
+func (pool *HashPool) Activity() (checkedOut int, lastActivity time.Time) {
+	pool.RLock()
+	defer pool.RUnlock()
+
+	for _, testDB := range pool.dbs {
+		if !testDB.checkedOutAt.IsZero() {
+			checkedOut++
+		}
+	}
+
+	for _, testDB := range pool.overflow {
+		if !testDB.checkedOutAt.IsZero() {
+			checkedOut++
+		}
+	}
+
+	return checkedOut, pool.lastActivity
+}
+
+// CheckedOut returns all currently checked out testdatabases (including overflow ones) ordered by ID.
+func (pool *HashPool) CheckedOut() []db.TestDatabase {
+	pool.RLock()
+	defer pool.RUnlock()
+
+	checkedOut := make([]db.TestDatabase, 0)
+	for _, testDB := range pool.dbs {
+		if !testDB.checkedOutAt.IsZero() {
+			checkedOut = append(checkedOut, testDB.TestDatabase)
+		}
+	}
+
+	for _, testDB := range pool.overflow {
+		if !testDB.checkedOutAt.IsZero() {
+			checkedOut = append(checkedOut, testDB.TestDatabase)
+		}
+	}
+
+	sort.Slice(checkedOut, func(i, j int) bool { return checkedOut[i].ID < checkedOut[j].ID })
+
+	return checkedOut
+}
+
+// RecordTemplateWait records how long an acquire had to wait for the template of this pool to become finalized.
+func (pool *HashPool) RecordTemplateWait(d time.Duration) {
+	pool.latencies.templateWait.Record(d)
+}
+
+// unsafeRecordCheckoutEnd records for how long the given testdatabase was checked out and emits a
+// warning event if this exceeds the configured threshold. Attention: pool should be write locked!
+func (pool *HashPool) unsafeRecordCheckoutEnd(log zerolog.Logger, testDB *existingDB) {
+	checkedOutAt := testDB.checkedOutAt
+	if checkedOutAt.IsZero() {
+		return
+	}
+
+	holder := testDB.checkedOutBy
+	testDB.checkedOutAt = time.Time{}
+	testDB.checkedOutBy = ""
+	testDB.leased = false
+	pool.lastActivity = time.Now()
+
+	duration := time.Since(checkedOutAt)
+	pool.checkoutDurations.Record(duration)
+
+	if pool.TestDatabaseCheckoutWarnDuration <= 0 || duration <= pool.TestDatabaseCheckoutWarnDuration {
+		return
+	}
+
+	id := testDB.ID
+	dbName := testDB.Database.Config.Database
+	log.Warn().Str("dbName", dbName).Dur("duration", duration).Dur("threshold", pool.TestDatabaseCheckoutWarnDuration).Msg("testdatabase was checked out longer than expected")
+
+	pool.Events.Emit(events.Event{
+		Type:    events.TypeCheckoutDurationExceeded,
+		Hash:    pool.templateDB.TemplateHash,
+		Message: fmt.Sprintf("test database %s was checked out for %v (threshold %v)", dbName, duration.Round(time.Millisecond), pool.TestDatabaseCheckoutWarnDuration),
+		Fields: map[string]interface{}{
+			"id":          id,
+			"dbName":      dbName,
+			"durationMs":  duration.Milliseconds(),
+			"thresholdMs": pool.TestDatabaseCheckoutWarnDuration.Milliseconds(),
+			"holder":      holder,
+		},
+	})
+}
+
 func (pool *HashPool) getPoolLogger(ctx context.Context, poolFunction string) zerolog.Logger {
-	return util.LogFromContext(ctx).With().Str("poolHash", pool.templateDB.TemplateHash).Str("poolFn", poolFunction).Logger()
+	return util.LogFromContextWith(ctx, pool.Logger).With().Str("poolHash", pool.templateDB.TemplateHash).Str("poolFn", poolFunction).Logger()
 }
 
 // unsafeTraceLogStats logs stats of this pool. Attention: pool should be read or write locked!
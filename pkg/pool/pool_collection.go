@@ -5,23 +5,60 @@ import (
 	"errors"
 	"fmt"
 	"runtime/trace"
+	"sort"
 	"sync"
 	"time"
 
 	"github.com/allaboutapps/integresql/pkg/db"
+	"github.com/allaboutapps/integresql/pkg/events"
+	"github.com/allaboutapps/integresql/pkg/util"
 )
 
 var ErrUnknownHash = errors.New("no database pool exists for this hash")
 
 // we explicitly want to access this struct via pool.PoolConfig, thus we disable revive for the next line
 type PoolConfig struct { //nolint:revive
-	InitialPoolSize                   int           // Initial number of ready DBs prepared in background
-	MaxPoolSize                       int           // Maximal pool size that won't be exceeded
-	TestDBNamePrefix                  string        // Test-Database prefix: DatabasePrefix_TestDBNamePrefix_HASH_ID
-	MaxParallelTasks                  int           // Maximal number of pool tasks running in parallel. Must be a number greater or equal 1.
-	TestDatabaseRetryRecreateSleepMin time.Duration // Minimal time to wait after a test db recreate has failed (e.g. as client is still connected). Subsequent retries multiply this values until...
-	TestDatabaseRetryRecreateSleepMax time.Duration // ... the maximum possible sleep time between retries (e.g. 3 seconds) is reached.
-	TestDatabaseMinimalLifetime       time.Duration // After a testdatabase transitions from ready to dirty, always block auto-recreation for this duration (except manual recreate).
+	InitialPoolSize                   int             // Initial number of ready DBs prepared in background
+	MaxPoolSize                       int             // Maximal pool size that won't be exceeded
+	MaxPoolSizeLimit                  int             // Upper bound of growing the MaxPoolSize of a running pool (see Resize), overflow testdatabases get IDs beyond it (defaults to MaxPoolSize).
+	TestDBNamePrefix                  string          // Test-Database prefix: DatabasePrefix_TestDBNamePrefix_HASH_ID
+	MaxParallelTasks                  int             // Maximal number of pool tasks running in parallel. Must be a number greater or equal 1.
+	MaxParallelFills                  int             // Maximal number of background fill tasks (extend, auto clean) running in parallel across all pools of the collection, 0 disables the limit.
+	FillPriority                      int             // Priority of the background fill tasks of the pool while waiting for one of the MaxParallelFills, higher ones first.
+	TestDatabaseRetryRecreateSleepMin time.Duration   // Minimal time to wait after a test db recreate has failed (e.g. as client is still connected). Subsequent retries multiply this values until...
+	TestDatabaseRetryRecreateSleepMax time.Duration   // ... the maximum possible sleep time between retries (e.g. 3 seconds) is reached.
+	TestDatabaseMinimalLifetime       time.Duration   // After a testdatabase transitions from ready to dirty, always block auto-recreation for this duration (except manual recreate).
+	TestDatabaseLeaseRenewDuration    time.Duration   // Each renewal of the lease of a checked out testdatabase (see RenewTestDatabase) blocks auto-recreation for this duration from now.
+	TestDatabaseMaxLeaseDuration      time.Duration   // Renewals never extend the lease of a testdatabase beyond this duration since its checkout (0 disables the limit).
+	TestDatabaseLeaseDuration         time.Duration   // Default lease of each checkout (see WithLease), testdatabases are reclaimed as soon as their lease expired without being returned or renewed (0 only reclaims ones with a requested lease).
+	TestDatabaseLeaseSweepInterval    time.Duration   // Interval of reclaiming testdatabases with expired leases (0 disables reclaiming).
+	TestDatabaseCheckoutWarnDuration  time.Duration   // Emit a warning event when a testdatabase was checked out longer than this duration before being returned (0 disables the warning).
+	TestDatabaseMaxCloneAge           time.Duration   // Ready testdatabases older than this (since their last recreation) are recreated in background (0 disables it).
+	TestDatabaseHealthCheckOnAcquire  bool            // Probe each ready testdatabase via HealthCheckDB before handing it out, unhealthy ones are recreated and the next one is taken.
+	TestDatabaseHealthCheckInterval   time.Duration   // Periodically probe all idle ready testdatabases via HealthCheckDB, unhealthy ones are recreated (0 disables it).
+	TestDatabaseMaxIdleDuration       time.Duration   // Ready testdatabases not handed out for this duration are dropped via DropIdleDB, down to InitialPoolSize (0 disables it).
+	MaxOverflowSize                   int             // Maximal number of temporary testdatabases created beyond MaxPoolSize while the pool is exhausted, they are dropped via DropOverflowDB on return instead of being recycled (0 disables overflow).
+	SelectionPolicy                   SelectionPolicy // Which ready testdatabase is handed out: least (default) or most recently recreated or round-robin by ID.
+	WaitStarvationFactor              int             // Clients waiting for a ready testdatabase this factor longer than the median waiting client are flagged starving, emitting an event (0 disables detection).
+	ShardRouting                      ShardRouting    // Which server (see Shards) the handed out ready testdatabase is preferably located on: round-robin (default) or least-loaded.
+	DirtyRecycleWorkers               int             // Number of background workers recreating dirty testdatabases as soon as they are eligible for auto-cleaning, even if MaxPoolSize is not reached yet (0 only auto-cleans once the pool is full).
+
+	CircuitBreakerThreshold     int           // Consecutive failed (re)creations of testdatabases opening the circuit breaker of the pool: acquisitions without a ready testdatabase fail fast with ErrCircuitOpen and (re)creations are paused (0 disables it).
+	CircuitBreakerProbeInterval time.Duration // Interval of probing an open circuit breaker by recreating a single testdatabase, it's closed again as soon as one succeeds.
+
+	Maintenance util.MaintenanceSchedule // Restricts the background maintenance (refreshing old, probing and evicting idle testdatabases) to certain times.
+
+	Shards []db.DatabaseConfig `json:"-"` // Optional servers (host, port and credentials) the testdatabases are striped across by their ID, see ShardOf.
+
+	HealthCheckDB  HealthCheckDBFunc `json:"-"` // Optional probe (e.g. connect + sanity query) of a testdatabase, health checks are disabled if nil.
+	DropOverflowDB RemoveDBFunc      `json:"-"` // Optional removal of returned overflow testdatabases, overflow is disabled if nil.
+	DropIdleDB     RemoveDBFunc      `json:"-"` // Optional removal of idle ready testdatabases (see TestDatabaseMaxIdleDuration), eviction is disabled if nil.
+	RenameIdleDB   RenameDBFunc      `json:"-"` // Optional renaming of a ready testdatabase, allowing evictions to drop never checked out testdatabases first (see evict), only the highest IDs are dropped if nil.
+	InUseDB        InUseDBFunc       `json:"-"` // Optional check for connections to a dirty testdatabase before handing it out as-is (skip clean), such are skipped.
+	DropMovedDB    RemoveDBFunc      `json:"-"` // Optional removal of testdatabases on the previous server while moving the pool (see MoveTo), such are kept if nil.
+
+	Events *events.Recorder `json:"-"` // Optional recorder receiving noteworthy pool events.
+	Logger util.Logger      `json:"-"` // Optional logger receiving all log entries of the pool (instead of the global zerolog logger).
 
 	disableWorkerAutostart bool // test only private flag for starting without background worker task system
 }
@@ -30,8 +67,9 @@ type PoolConfig struct { //nolint:revive
 type PoolCollection struct { //nolint:revive
 	PoolConfig
 
-	pools map[string]*HashPool // map[hash]
-	mutex sync.RWMutex
+	pools     map[string]*HashPool    // map[hash]
+	fillSlots *util.PrioritySemaphore // shared by all pools, see MaxParallelFills
+	mutex     sync.RWMutex
 }
 
 // enableDBRecreate set to false will allow reusing test databases that are marked as 'dirty'.
@@ -39,6 +77,7 @@ type PoolCollection struct { //nolint:revive
 func NewPoolCollection(cfg PoolConfig) *PoolCollection {
 	return &PoolCollection{
 		pools:      make(map[string]*HashPool),
+		fillSlots:  util.NewPrioritySemaphore(cfg.MaxParallelFills),
 		PoolConfig: cfg,
 	}
 }
@@ -49,6 +88,15 @@ type RecreateDBFunc func(ctx context.Context, testDB db.TestDatabase, templateNa
 // RemoveDBFunc callback executed to remove a database
 type RemoveDBFunc func(ctx context.Context, testDB db.TestDatabase) error
 
+// RenameDBFunc callback executed to rename a database (without connections) to the name.
+type RenameDBFunc func(ctx context.Context, testDB db.TestDatabase, name string) error
+
+// HealthCheckDBFunc callback executed to probe a ready database, any error marks it as unhealthy (corrupted) and triggers its recreation.
+type HealthCheckDBFunc func(ctx context.Context, testDB db.TestDatabase) error
+
+// InUseDBFunc callback executed to check whether clients are still connected to the database.
+type InUseDBFunc func(ctx context.Context, testDB db.TestDatabase) (bool, error)
+
 func makeActualRecreateTestDBFunc(templateName string, userRecreateFunc RecreateDBFunc) recreateTestDBFunc {
 	return func(ctx context.Context, testDBWrapper *existingDB) error {
 		return userRecreateFunc(ctx, testDBWrapper.TestDatabase, templateName)
@@ -58,14 +106,19 @@ func makeActualRecreateTestDBFunc(templateName string, userRecreateFunc Recreate
 type recreateTestDBFunc func(context.Context, *existingDB) error
 
 // InitHashPool creates a new pool with a given template hash and starts the cleanup workers.
-func (p *PoolCollection) InitHashPool(_ context.Context, templateDB db.Database, initDBFunc RecreateDBFunc) {
+func (p *PoolCollection) InitHashPool(ctx context.Context, templateDB db.Database, initDBFunc RecreateDBFunc) {
+	p.InitHashPoolWithConfig(ctx, templateDB, initDBFunc, p.PoolConfig)
+}
+
+// InitHashPoolWithConfig creates a new pool with a given template hash and starts the cleanup workers.
+// The given config is used instead of the one of the collection (e.g. with per template settings applied).
+func (p *PoolCollection) InitHashPoolWithConfig(ctx context.Context, templateDB db.Database, initDBFunc RecreateDBFunc, cfg PoolConfig) {
 	p.mutex.Lock()
 	defer p.mutex.Unlock()
 
-	cfg := p.PoolConfig
-
 	// Create a new HashPool
 	pool := NewHashPool(cfg, templateDB, initDBFunc)
+	pool.fillSlots = p.fillSlots
 
 	if !cfg.disableWorkerAutostart {
 		pool.Start()
@@ -73,6 +126,9 @@ func (p *PoolCollection) InitHashPool(_ context.Context, templateDB db.Database,
 
 	// pool is ready
 	p.pools[pool.templateDB.TemplateHash] = pool
+
+	log := pool.getPoolLogger(ctx, "InitHashPool")
+	log.Info().Int("initialPoolSize", cfg.InitialPoolSize).Int("maxPoolSize", cfg.MaxPoolSize).Msg("pool created")
 }
 
 // Start is used to start all background workers
@@ -98,34 +154,147 @@ func (p *PoolCollection) Stop() {
 // GetTestDatabase picks up a ready to use test DB. It waits the given timeout until a DB is available.
 // If there is no DB ready and time elapses, ErrTimeout is returned.
 // Otherwise, the obtained test DB is marked as 'dirty' and can be reused only if returned to the pool.
-func (p *PoolCollection) GetTestDatabase(ctx context.Context, hash string, timeout time.Duration) (db db.TestDatabase, err error) {
+func (p *PoolCollection) GetTestDatabase(ctx context.Context, hash string, timeout time.Duration) (db.TestDatabase, error) {
+
+	pool, err := p.getPool(ctx, hash)
+	if err != nil {
+		return db.TestDatabase{}, p.wrapOp(err, "get_test_db", hash, -1)
+	}
+
+	testDB, err := pool.GetTestDatabase(ctx, timeout)
+	return testDB, p.wrapOp(err, "get_test_db", hash, -1)
+}
+
+// GetTestDatabaseSkipClean picks up a test DB, preferring a dirty one handed out as-is (flagged via TestDatabase.Dirty)
+// over waiting for a ready one. Meant for clients resetting the test DB themselves.
+func (p *PoolCollection) GetTestDatabaseSkipClean(ctx context.Context, hash string, timeout time.Duration) (db.TestDatabase, error) {
+
+	pool, err := p.getPool(ctx, hash)
+	if err != nil {
+		return db.TestDatabase{}, p.wrapOp(err, "get_test_db", hash, -1)
+	}
+
+	testDB, err := pool.GetTestDatabaseSkipClean(ctx, timeout)
+	return testDB, p.wrapOp(err, "get_test_db", hash, -1)
+}
+
+// GetTestDatabaseAtIndex picks up the test DB with the given ID (index within the pool), creating it if absent.
+// Meant for sharded clients mapping their worker number to a stable test DB.
+func (p *PoolCollection) GetTestDatabaseAtIndex(ctx context.Context, hash string, index int, timeout time.Duration) (db.TestDatabase, error) {
+
+	pool, err := p.getPool(ctx, hash)
+	if err != nil {
+		return db.TestDatabase{}, p.wrapOp(err, "get_test_db", hash, index)
+	}
+
+	testDB, err := pool.GetTestDatabaseAtIndex(ctx, index, timeout)
+	return testDB, p.wrapOp(err, "get_test_db", hash, index)
+}
 
+// ExplainGetTestDatabase explains the decision acquiring a test DB would take right now, without checking anything out.
+func (p *PoolCollection) ExplainGetTestDatabase(ctx context.Context, hash string, skipClean bool, index *int) (Explanation, error) {
 	pool, err := p.getPool(ctx, hash)
 	if err != nil {
-		return db, err
+		return Explanation{}, err
 	}
 
-	return pool.GetTestDatabase(ctx, timeout)
+	return pool.ExplainGetTestDatabase(ctx, skipClean, index)
 }
 
 // ReturnTestDatabase returns the given test DB directly to the pool, without cleaning (recreating it).
 func (p *PoolCollection) ReturnTestDatabase(ctx context.Context, hash string, id int) error {
 	pool, err := p.getPool(ctx, hash)
 	if err != nil {
-		return err
+		return p.wrapOp(err, "return_test_db", hash, id)
 	}
 
-	return pool.ReturnTestDatabase(ctx, id)
+	return p.wrapOp(pool.ReturnTestDatabase(ctx, id), "return_test_db", hash, id)
+}
+
+// RenewTestDatabase extends the lease of the checked out test DB, see HashPool.RenewTestDatabase.
+func (p *PoolCollection) RenewTestDatabase(ctx context.Context, hash string, id int) (Lease, error) {
+	pool, err := p.getPool(ctx, hash)
+	if err != nil {
+		return Lease{}, p.wrapOp(err, "renew_test_db", hash, id)
+	}
+
+	lease, err := pool.RenewTestDatabase(ctx, id)
+	return lease, p.wrapOp(err, "renew_test_db", hash, id)
 }
 
 // RecreateTestDatabase recreates the test DB according to the template and returns it back to the pool.
 func (p *PoolCollection) RecreateTestDatabase(ctx context.Context, hash string, id int) error {
+	pool, err := p.getPool(ctx, hash)
+	if err != nil {
+		return p.wrapOp(err, "recreate_test_db", hash, id)
+	}
+
+	return p.wrapOp(pool.RecreateTestDatabase(ctx, id), "recreate_test_db", hash, id)
+}
+
+// FreezeTestDatabase removes the test DB from rotation until it's unfrozen, see HashPool.Freeze.
+func (p *PoolCollection) FreezeTestDatabase(ctx context.Context, hash string, id int) (FrozenTestDatabase, error) {
+	pool, err := p.getPool(ctx, hash)
+	if err != nil {
+		return FrozenTestDatabase{}, p.wrapOp(err, "freeze_test_db", hash, id)
+	}
+
+	frozen, err := pool.Freeze(ctx, id)
+	return frozen, p.wrapOp(err, "freeze_test_db", hash, id)
+}
+
+// UnfreezeTestDatabase puts the frozen test DB back into rotation, see HashPool.Unfreeze.
+func (p *PoolCollection) UnfreezeTestDatabase(ctx context.Context, hash string, id int) error {
+	pool, err := p.getPool(ctx, hash)
+	if err != nil {
+		return p.wrapOp(err, "unfreeze_test_db", hash, id)
+	}
+
+	return p.wrapOp(pool.Unfreeze(ctx, id), "unfreeze_test_db", hash, id)
+}
+
+// CancelFill stops all background workers of the pool with the given hash, interrupting the fill up to its
+// InitialPoolSize if it's still running (see FillStatus). Typically followed by RemoveAllWithHash. Already ready
+// testdatabases stay available, but no testdatabase is cleaned or created anymore.
+func (p *PoolCollection) CancelFill(ctx context.Context, hash string) error {
 	pool, err := p.getPool(ctx, hash)
 	if err != nil {
 		return err
 	}
 
-	return pool.RecreateTestDatabase(ctx, id)
+	pool.Stop()
+
+	return nil
+}
+
+// MoveTo moves the testdatabases of the pool with the given hash to the server of the config, see HashPool.MoveTo.
+func (p *PoolCollection) MoveTo(ctx context.Context, hash string, server db.DatabaseConfig) (int, error) {
+	pool, err := p.getPool(ctx, hash)
+	if err != nil {
+		return 0, err
+	}
+
+	return pool.MoveTo(ctx, server)
+}
+
+// MoveStats returns the testdatabases of the pool with the given hash not yet moved, see HashPool.MoveStats.
+func (p *PoolCollection) MoveStats(ctx context.Context, hash string) (MoveStats, error) {
+	pool, err := p.getPool(ctx, hash)
+	if err != nil {
+		return MoveStats{}, err
+	}
+
+	return pool.MoveStats(), nil
+}
+
+// Resize changes the initial and max size of the pool with the given hash, see HashPool.Resize.
+func (p *PoolCollection) Resize(ctx context.Context, hash string, initialPoolSize int, maxPoolSize int) (PoolSize, error) {
+	pool, err := p.getPool(ctx, hash)
+	if err != nil {
+		return PoolSize{}, err
+	}
+
+	return pool.Resize(ctx, initialPoolSize, maxPoolSize)
 }
 
 // RemoveAllWithHash removes a pool with a given template hash.
@@ -145,6 +314,9 @@ func (p *PoolCollection) RemoveAllWithHash(ctx context.Context, hash string, rem
 	// all DBs have been removed, now remove the pool itself
 	delete(p.pools, hash)
 
+	log := pool.getPoolLogger(ctx, "RemoveAllWithHash")
+	log.Info().Msg("pool removed")
+
 	return nil
 }
 
@@ -164,6 +336,101 @@ func (p *PoolCollection) RemoveAll(ctx context.Context, removeFunc RemoveDBFunc)
 	return nil
 }
 
+// ShrinkAll drops the ready testdatabases beyond the initial pool size of all pools, see HashPool.Shrink. Returns the
+// number of dropped testdatabases.
+func (p *PoolCollection) ShrinkAll(ctx context.Context) (int, error) {
+	p.mutex.RLock()
+	pools := make([]*HashPool, 0, len(p.pools))
+	for _, pool := range p.pools {
+		pools = append(pools, pool)
+	}
+	p.mutex.RUnlock()
+
+	total := 0
+	var errs []error
+	for _, pool := range pools {
+		shrunk, err := pool.Shrink(ctx)
+		total += shrunk
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to shrink pool %s: %w", pool.templateDB.TemplateHash, err))
+		}
+	}
+
+	return total, errors.Join(errs...)
+}
+
+// Stats returns the stats of all tracked pools ordered by their template hash.
+func (p *PoolCollection) Stats(_ context.Context) []Stats {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	stats := make([]Stats, 0, len(p.pools))
+	for _, pool := range p.pools {
+		stats = append(stats, pool.Stats())
+	}
+
+	sort.Slice(stats, func(i, j int) bool { return stats[i].TemplateHash < stats[j].TemplateHash })
+
+	return stats
+}
+
+// TestDatabaseStates returns the current state of the testdatabases of all tracked pools by database name.
+func (p *PoolCollection) TestDatabaseStates(_ context.Context) map[string]string {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	states := make(map[string]string)
+	for _, pool := range p.pools {
+		for dbName, state := range pool.TestDatabaseStates() {
+			states[dbName] = state
+		}
+	}
+
+	return states
+}
+
+// CheckedOut returns the currently checked out testdatabases of all tracked pools ordered by their template hash and ID.
+func (p *PoolCollection) CheckedOut(_ context.Context) []db.TestDatabase {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	hashes := make([]string, 0, len(p.pools))
+	for hash := range p.pools {
+		hashes = append(hashes, hash)
+	}
+	sort.Strings(hashes)
+
+	checkedOut := make([]db.TestDatabase, 0)
+	for _, hash := range hashes {
+		checkedOut = append(checkedOut, p.pools[hash].CheckedOut()...)
+	}
+
+	return checkedOut
+}
+
+// Activity returns the number of currently checked out testdatabases of the pool with the given hash and the time
+// of its last checkout or return.
+func (p *PoolCollection) Activity(ctx context.Context, hash string) (checkedOut int, lastActivity time.Time, err error) {
+	pool, err := p.getPool(ctx, hash)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+
+	checkedOut, lastActivity = pool.Activity()
+	return checkedOut, lastActivity, nil
+}
+
+// RecordTemplateWait records how long an acquire had to wait for the template with the given hash to become finalized.
+// It's a noop if there is no pool for the hash (yet).
+func (p *PoolCollection) RecordTemplateWait(ctx context.Context, hash string, d time.Duration) {
+	pool, err := p.getPool(ctx, hash)
+	if err != nil {
+		return
+	}
+
+	pool.RecordTemplateWait(d)
+}
+
 // MakeDBName makes a test DB name with the configured prefix, template hash and ID of the DB.
 func (p *PoolCollection) MakeDBName(hash string, id int) string {
 	p.mutex.RLock()
@@ -172,6 +439,21 @@ func (p *PoolCollection) MakeDBName(hash string, id int) string {
 	return makeDBName(p.PoolConfig.TestDBNamePrefix, hash, id)
 }
 
+// wrapOp adds the context of the operation on the pool with the hash (and the testdatabase with the ID, unless
+// negative) to err, see db.OpError.
+func (p *PoolCollection) wrapOp(err error, op string, hash string, id int) error {
+	if err == nil {
+		return nil
+	}
+
+	dbName := ""
+	if id >= 0 {
+		dbName = p.MakeDBName(hash, id)
+	}
+
+	return db.WrapOp(err, op, hash, dbName)
+}
+
 func makeDBName(testDBPrefix string, hash string, id int) string {
 	// db name has an ID in suffix
 	return fmt.Sprintf("%s%s_%03d", testDBPrefix, hash, id)
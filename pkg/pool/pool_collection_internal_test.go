@@ -2,11 +2,16 @@ package pool
 
 import (
 	"context"
+	"errors"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/allaboutapps/integresql/pkg/db"
+	"github.com/allaboutapps/integresql/pkg/events"
+	"github.com/allaboutapps/integresql/pkg/util"
+	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -345,3 +350,2211 @@ func TestPoolReturnTestDatabase(t *testing.T) {
 	assert.Equal(t, testDB1.ID, testDB2.ID)
 
 }
+
+func TestPoolCheckoutDurations(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	hash1 := "h1"
+	templateDB1 := db.Database{
+		TemplateHash: hash1,
+		Config: db.DatabaseConfig{
+			Database: "h1_template",
+		},
+	}
+
+	initFunc := func(ctx context.Context, testDB db.TestDatabase, templateName string) error {
+		return nil
+	}
+
+	recorder := events.NewRecorder(10)
+	cfg := PoolConfig{
+		MaxPoolSize:                      10,
+		MaxParallelTasks:                 3,
+		TestDatabaseCheckoutWarnDuration: 10 * time.Millisecond,
+		Events:                           recorder,
+		disableWorkerAutostart:           true, // no extend / cleanDirty tasks should run automatically!
+	}
+	p := NewPoolCollection(cfg)
+
+	p.InitHashPool(ctx, templateDB1, initFunc)
+	require.NoError(t, p.extend(ctx, templateDB1))
+
+	// a short checkout does not emit any event
+	testDB, err := p.GetTestDatabase(ctx, hash1, time.Millisecond)
+	require.NoError(t, err)
+	require.NoError(t, p.ReturnTestDatabase(ctx, hash1, testDB.ID))
+	assert.Empty(t, recorder.Recent())
+
+	// a long checkout does
+	testDB, err = p.GetTestDatabase(ctx, hash1, time.Millisecond)
+	require.NoError(t, err)
+	time.Sleep(20 * time.Millisecond)
+	require.NoError(t, p.ReturnTestDatabase(ctx, hash1, testDB.ID))
+
+	recent := recorder.Recent()
+	require.Len(t, recent, 1)
+	assert.Equal(t, events.TypeCheckoutDurationExceeded, recent[0].Type)
+	assert.Equal(t, hash1, recent[0].Hash)
+
+	// returning it again does not record anything
+	require.NoError(t, p.ReturnTestDatabase(ctx, hash1, testDB.ID))
+
+	stats := p.Stats(ctx)
+	require.Len(t, stats, 1)
+	assert.Equal(t, hash1, stats[0].TemplateHash)
+	assert.Equal(t, 2, stats[0].CheckoutDurations.Count)
+	assert.GreaterOrEqual(t, stats[0].CheckoutDurations.MaxMs, 20.0)
+}
+
+func TestPoolLatencies(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	hash1 := "h1"
+	templateDB1 := db.Database{
+		TemplateHash: hash1,
+		Config: db.DatabaseConfig{
+			Database: "h1_template",
+		},
+	}
+
+	tries := 0
+	initFunc := func(ctx context.Context, testDB db.TestDatabase, templateName string) error {
+		time.Sleep(5 * time.Millisecond)
+		tries++
+		if tries == 1 {
+			return ErrTestDBInUse
+		}
+		return nil
+	}
+
+	cfg := PoolConfig{
+		MaxPoolSize:                       10,
+		MaxParallelTasks:                  3,
+		TestDatabaseRetryRecreateSleepMin: 10 * time.Millisecond,
+		TestDatabaseRetryRecreateSleepMax: 10 * time.Millisecond,
+		disableWorkerAutostart:            true, // no extend / cleanDirty tasks should run automatically!
+	}
+	p := NewPoolCollection(cfg)
+
+	p.InitHashPool(ctx, templateDB1, initFunc)
+	// first recreate attempt fails as still in use, the second one succeeds
+	require.NoError(t, p.extend(ctx, templateDB1))
+
+	_, err := p.GetTestDatabase(ctx, hash1, time.Millisecond)
+	require.NoError(t, err)
+
+	p.RecordTemplateWait(ctx, hash1, 3*time.Millisecond)
+	// unknown hashes are ignored
+	p.RecordTemplateWait(ctx, "unknown", time.Millisecond)
+
+	stats := p.Stats(ctx)
+	require.Len(t, stats, 1)
+	latencies := stats[0].Latencies
+
+	assert.Equal(t, 2, latencies.DDL.Count)
+	assert.GreaterOrEqual(t, latencies.DDL.MinMs, 5.0)
+	assert.Equal(t, 1, latencies.Clean.Count)
+	assert.GreaterOrEqual(t, latencies.Clean.MinMs, 20.0) // 2 attempts + backoff
+	assert.Equal(t, 1, latencies.ReadyWait.Count)
+	assert.Equal(t, 1, latencies.LockWait.Count)
+	assert.Equal(t, 1, latencies.TemplateWait.Count)
+	assert.Equal(t, 3.0, latencies.TemplateWait.MaxMs)
+}
+
+func TestPoolActivity(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	hash1 := "h1"
+	templateDB1 := db.Database{
+		TemplateHash: hash1,
+		Config: db.DatabaseConfig{
+			Database: "h1_template",
+		},
+	}
+
+	initFunc := func(ctx context.Context, testDB db.TestDatabase, templateName string) error {
+		return nil
+	}
+
+	cfg := PoolConfig{
+		MaxPoolSize:            10,
+		MaxParallelTasks:       3,
+		disableWorkerAutostart: true, // no extend / cleanDirty tasks should run automatically!
+	}
+	p := NewPoolCollection(cfg)
+
+	_, _, err := p.Activity(ctx, hash1)
+	assert.ErrorIs(t, err, ErrUnknownHash)
+
+	p.InitHashPool(ctx, templateDB1, initFunc)
+	require.NoError(t, p.extend(ctx, templateDB1))
+	require.NoError(t, p.extend(ctx, templateDB1))
+
+	checkedOut, created, err := p.Activity(ctx, hash1)
+	require.NoError(t, err)
+	assert.Equal(t, 0, checkedOut)
+
+	testDB1, err := p.GetTestDatabase(ctx, hash1, time.Millisecond)
+	require.NoError(t, err)
+	testDB2, err := p.GetTestDatabase(ctx, hash1, time.Millisecond)
+	require.NoError(t, err)
+
+	checkedOut, lastActivity, err := p.Activity(ctx, hash1)
+	require.NoError(t, err)
+	assert.Equal(t, 2, checkedOut)
+	assert.False(t, lastActivity.Before(created))
+
+	require.NoError(t, p.ReturnTestDatabase(ctx, hash1, testDB1.ID))
+	checkedOut, _, err = p.Activity(ctx, hash1)
+	require.NoError(t, err)
+	assert.Equal(t, 1, checkedOut)
+
+	// auto cleaning a testdatabase, which was never returned, marks it as no longer checked out
+	require.NoError(t, p.pools[hash1].recreateDatabaseGracefully(ctx, testDB2.ID))
+	checkedOut, _, err = p.Activity(ctx, hash1)
+	require.NoError(t, err)
+	assert.Equal(t, 0, checkedOut)
+}
+
+func TestPoolBackgroundErrors(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	hash1 := "h1"
+	templateDB1 := db.Database{
+		TemplateHash: hash1,
+		Config: db.DatabaseConfig{
+			Database: "h1_template",
+		},
+	}
+
+	errRecreate := errors.New("recreate failed")
+	initFunc := func(ctx context.Context, testDB db.TestDatabase, templateName string) error {
+		return errRecreate
+	}
+
+	recorder := events.NewRecorder(10)
+	cfg := PoolConfig{
+		InitialPoolSize:  2,
+		MaxPoolSize:      2,
+		MaxParallelTasks: 2,
+		Events:           recorder,
+	}
+	p := NewPoolCollection(cfg)
+
+	// the workers try to extend the pool in background, which fails
+	p.InitHashPool(ctx, templateDB1, initFunc)
+
+	_, err := util.WaitWithTimeout(ctx, time.Second, func(ctx context.Context) (bool, error) {
+		for ctx.Err() == nil {
+			if p.Stats(ctx)[0].BackgroundErrors[workerTaskExtend].Count == 2 {
+				return true, nil
+			}
+			time.Sleep(time.Millisecond)
+		}
+		return false, ctx.Err()
+	})
+	require.NoError(t, err)
+	p.Stop()
+
+	stats := p.Stats(ctx)
+	assert.Equal(t, errRecreate.Error(), stats[0].BackgroundErrors[workerTaskExtend].LastError)
+
+	recent := recorder.Recent()
+	require.Len(t, recent, 2)
+	assert.Equal(t, events.TypeBackgroundTaskFailed, recent[0].Type)
+	assert.Equal(t, hash1, recent[0].Hash)
+	assert.Equal(t, workerTaskExtend, recent[0].Fields["task"])
+}
+
+func TestPoolMaxCloneAge(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	hash1 := "h1"
+	templateDB1 := db.Database{
+		TemplateHash: hash1,
+		Config: db.DatabaseConfig{
+			Database: "h1_template",
+		},
+	}
+
+	var mutex sync.Mutex
+	recreates := 0
+	initFunc := func(ctx context.Context, testDB db.TestDatabase, templateName string) error {
+		mutex.Lock()
+		defer mutex.Unlock()
+		recreates++
+		return nil
+	}
+
+	cfg := PoolConfig{
+		InitialPoolSize:             1,
+		MaxPoolSize:                 1,
+		MaxParallelTasks:            1,
+		TestDatabaseMinimalLifetime: 500 * time.Millisecond, // block auto cleaning after checkout
+	}
+	p := NewPoolCollection(cfg)
+
+	// the max clone age is only set for this pool
+	poolCfg := cfg
+	poolCfg.TestDatabaseMaxCloneAge = 50 * time.Millisecond
+	p.InitHashPoolWithConfig(ctx, templateDB1, initFunc, poolCfg)
+
+	_, err := util.WaitWithTimeout(ctx, time.Second, func(ctx context.Context) (bool, error) {
+		for ctx.Err() == nil {
+			if p.Stats(ctx)[0].MaxCloneAgeRecreates >= 2 {
+				return true, nil
+			}
+			time.Sleep(time.Millisecond)
+		}
+		return false, ctx.Err()
+	})
+	require.NoError(t, err)
+
+	// the refreshed testdatabase is still ready to be used
+	testDB, err := p.GetTestDatabase(ctx, hash1, time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, 0, testDB.ID)
+
+	// checked out testdatabases are never refreshed
+	time.Sleep(2 * poolCfg.TestDatabaseMaxCloneAge)
+	p.pools[hash1].refreshOld(ctx)
+	p.pools[hash1].RLock()
+	assert.Equal(t, dbStateDirty, p.pools[hash1].dbs[testDB.ID].state)
+	p.pools[hash1].RUnlock()
+
+	p.Stop()
+
+	mutex.Lock()
+	assert.GreaterOrEqual(t, recreates, 3) // initial + refreshes
+	mutex.Unlock()
+}
+
+func TestPoolSeed(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	hash1 := "h1"
+	templateDB1 := db.Database{
+		TemplateHash: hash1,
+		Config: db.DatabaseConfig{
+			Database: "h1_template",
+		},
+	}
+
+	seedsMap := sync.Map{}
+	initFunc := func(ctx context.Context, testDB db.TestDatabase, templateName string) error {
+		seedsMap.Store(testDB.ID, testDB.Seed)
+		return nil
+	}
+
+	cfg := PoolConfig{
+		MaxPoolSize:            10,
+		MaxParallelTasks:       3,
+		disableWorkerAutostart: true, // no extend / cleanDirty tasks should run automatically!
+	}
+	p := NewPoolCollection(cfg)
+
+	p.InitHashPool(ctx, templateDB1, initFunc)
+	require.NoError(t, p.extend(ctx, templateDB1))
+	require.NoError(t, p.extend(ctx, templateDB1))
+
+	testDB1, err := p.GetTestDatabase(ctx, hash1, time.Millisecond)
+	require.NoError(t, err)
+	testDB2, err := p.GetTestDatabase(ctx, hash1, time.Millisecond)
+	require.NoError(t, err)
+
+	// the seed passed to the recreate func is the one handed out
+	seed1, ok := seedsMap.Load(testDB1.ID)
+	require.True(t, ok)
+	assert.Equal(t, seed1, testDB1.Seed)
+
+	seed2, ok := seedsMap.Load(testDB2.ID)
+	require.True(t, ok)
+	assert.Equal(t, seed2, testDB2.Seed)
+
+	assert.NotEqual(t, testDB1.Seed, testDB2.Seed)
+}
+
+func TestPoolHealthCheck(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	var mutex sync.Mutex
+	failures := map[string]int{} // dbName -> remaining failing probes
+	healthCheck := func(ctx context.Context, testDB db.TestDatabase) error {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		if failures[testDB.Config.Database] > 0 {
+			failures[testDB.Config.Database]--
+			return errors.New("corrupted")
+		}
+		return nil
+	}
+
+	initFunc := func(ctx context.Context, testDB db.TestDatabase, templateName string) error {
+		return nil
+	}
+
+	cfg := PoolConfig{
+		InitialPoolSize:  2,
+		MaxPoolSize:      2,
+		MaxParallelTasks: 2,
+		TestDBNamePrefix: "test_",
+		HealthCheckDB:    healthCheck,
+	}
+	p := NewPoolCollection(cfg)
+
+	waitReady := func(hash string, count int) {
+		_, err := util.WaitWithTimeout(ctx, time.Second, func(ctx context.Context) (bool, error) {
+			for ctx.Err() == nil {
+				pool, err := p.getPool(ctx, hash)
+				if err != nil {
+					return false, err
+				}
+				if len(pool.ready) >= count {
+					return true, nil
+				}
+				time.Sleep(time.Millisecond)
+			}
+			return false, ctx.Err()
+		})
+		require.NoError(t, err)
+	}
+
+	// probe on acquire, the unhealthy testdatabase is replaced and never handed out before
+	onAcquireCfg := cfg
+	onAcquireCfg.TestDatabaseHealthCheckOnAcquire = true
+	p.InitHashPoolWithConfig(ctx, db.Database{TemplateHash: "h1", Config: db.DatabaseConfig{Database: "h1_template"}}, initFunc, onAcquireCfg)
+	waitReady("h1", 2)
+
+	mutex.Lock()
+	failures["test_h1_000"] = 1
+	mutex.Unlock()
+
+	for i := 0; i < 2; i++ {
+		_, err := p.GetTestDatabase(ctx, "h1", time.Second)
+		require.NoError(t, err)
+	}
+
+	// periodic probes of idle ready testdatabases
+	periodicCfg := cfg
+	periodicCfg.TestDatabaseHealthCheckInterval = 5 * time.Millisecond
+	p.InitHashPoolWithConfig(ctx, db.Database{TemplateHash: "h2", Config: db.DatabaseConfig{Database: "h2_template"}}, initFunc, periodicCfg)
+	waitReady("h2", 2)
+
+	mutex.Lock()
+	failures["test_h2_001"] = 1
+	mutex.Unlock()
+
+	_, err := util.WaitWithTimeout(ctx, time.Second, func(ctx context.Context) (bool, error) {
+		for ctx.Err() == nil {
+			for _, stats := range p.Stats(ctx) {
+				if stats.TemplateHash == "h2" && stats.HealthCheckReplacements == 1 {
+					return true, nil
+				}
+			}
+			time.Sleep(time.Millisecond)
+		}
+		return false, ctx.Err()
+	})
+	require.NoError(t, err)
+
+	waitReady("h2", 2)
+
+	p.Stop()
+
+	for _, stats := range p.Stats(ctx) {
+		assert.Equal(t, 1, stats.HealthCheckReplacements, stats.TemplateHash)
+	}
+}
+
+func TestPoolOverflow(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	var mutex sync.Mutex
+	dropped := []string{}
+	dropFunc := func(ctx context.Context, testDB db.TestDatabase) error {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		dropped = append(dropped, testDB.Config.Database)
+		return nil
+	}
+
+	initFunc := func(ctx context.Context, testDB db.TestDatabase, templateName string) error {
+		return nil
+	}
+
+	cfg := PoolConfig{
+		InitialPoolSize:  1,
+		MaxPoolSize:      1,
+		MaxOverflowSize:  1,
+		MaxParallelTasks: 1,
+		TestDBNamePrefix: "test_",
+		DropOverflowDB:   dropFunc,
+
+		// keep the checked out testdatabase from being auto cleaned (reused) while testing
+		TestDatabaseMinimalLifetime: time.Second,
+	}
+	p := NewPoolCollection(cfg)
+
+	hash := "h1"
+	templateDB := db.Database{TemplateHash: hash, Config: db.DatabaseConfig{Database: "h1_template"}}
+	p.InitHashPool(ctx, templateDB, initFunc)
+
+	waitOverflow := func(count int) {
+		_, err := util.WaitWithTimeout(ctx, time.Second, func(ctx context.Context) (bool, error) {
+			for ctx.Err() == nil {
+				if p.Stats(ctx)[0].Overflow == count {
+					return true, nil
+				}
+				time.Sleep(time.Millisecond)
+			}
+			return false, ctx.Err()
+		})
+		require.NoError(t, err)
+	}
+
+	testDB, err := p.GetTestDatabase(ctx, hash, time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, 0, testDB.ID)
+
+	// pool exhausted, a temporary testdatabase is created
+	overflowDB, err := p.GetTestDatabase(ctx, hash, time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, 1, overflowDB.ID)
+	assert.Equal(t, "test_h1_001", overflowDB.Config.Database)
+	assert.Equal(t, 1, p.Stats(ctx)[0].Overflow)
+
+	checkedOut, _, err := p.Activity(ctx, hash)
+	require.NoError(t, err)
+	assert.Equal(t, 2, checkedOut)
+
+	// overflow exhausted as well
+	_, err = p.GetTestDatabase(ctx, hash, 10*time.Millisecond)
+	assert.ErrorIs(t, err, ErrTimeout)
+
+	// returned overflow testdatabases are dropped instead of recycled, repeated returns are ignored
+	require.NoError(t, p.ReturnTestDatabase(ctx, hash, overflowDB.ID))
+	waitOverflow(0)
+	require.NoError(t, p.ReturnTestDatabase(ctx, hash, overflowDB.ID))
+	assert.ErrorIs(t, p.ReturnTestDatabase(ctx, hash, 42), ErrInvalidIndex)
+
+	overflowDB, err = p.GetTestDatabase(ctx, hash, time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, 2, overflowDB.ID)
+
+	require.NoError(t, p.RecreateTestDatabase(ctx, hash, overflowDB.ID))
+	waitOverflow(0)
+
+	// overflow testdatabases are removed together with the pool
+	_, err = p.GetTestDatabase(ctx, hash, time.Second)
+	require.NoError(t, err)
+
+	removed := []string{}
+	require.NoError(t, p.RemoveAllWithHash(ctx, hash, func(ctx context.Context, testDB db.TestDatabase) error {
+		removed = append(removed, testDB.Config.Database)
+		return nil
+	}))
+	assert.ElementsMatch(t, []string{"test_h1_000", "test_h1_003"}, removed)
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	assert.Equal(t, []string{"test_h1_001", "test_h1_002"}, dropped)
+}
+
+func TestPoolMaintenanceSchedule(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	initFunc := func(ctx context.Context, testDB db.TestDatabase, templateName string) error {
+		return nil
+	}
+
+	probes := 0
+	var mutex sync.Mutex
+	healthCheck := func(ctx context.Context, testDB db.TestDatabase) error {
+		mutex.Lock()
+		defer mutex.Unlock()
+		probes++
+		return nil
+	}
+
+	always, err := util.ParseCronExpression("* * * * *")
+	require.NoError(t, err)
+
+	cfg := PoolConfig{
+		InitialPoolSize:                 1,
+		MaxPoolSize:                     1,
+		MaxParallelTasks:                1,
+		TestDatabaseMaxCloneAge:         5 * time.Millisecond,
+		TestDatabaseHealthCheckInterval: 5 * time.Millisecond,
+		HealthCheckDB:                   healthCheck,
+		Maintenance:                     util.MaintenanceSchedule{QuietPeriods: []util.CronExpression{always}},
+	}
+	p := NewPoolCollection(cfg)
+
+	p.InitHashPool(ctx, db.Database{TemplateHash: "h1", Config: db.DatabaseConfig{Database: "h1_template"}}, initFunc)
+
+	// background maintenance never runs during the quiet period, user facing operations are not affected
+	time.Sleep(50 * time.Millisecond)
+
+	testDB, err := p.GetTestDatabase(ctx, "h1", time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, 0, testDB.ID)
+
+	p.Stop()
+
+	assert.Equal(t, 0, p.Stats(ctx)[0].MaxCloneAgeRecreates)
+
+	mutex.Lock()
+	assert.Equal(t, 0, probes)
+	mutex.Unlock()
+}
+
+func TestPoolSkipClean(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	hash := "h1"
+	templateDB := db.Database{TemplateHash: hash, Config: db.DatabaseConfig{Database: "h1_template"}}
+
+	var recreates int32
+	initFunc := func(ctx context.Context, testDB db.TestDatabase, templateName string) error {
+		atomic.AddInt32(&recreates, 1)
+		return nil
+	}
+
+	var inUse sync.Map
+	inUseFunc := func(ctx context.Context, testDB db.TestDatabase) (bool, error) {
+		_, ok := inUse.Load(testDB.ID)
+		return ok, nil
+	}
+
+	cfg := PoolConfig{
+		MaxPoolSize:                 2,
+		MaxParallelTasks:            1,
+		TestDBNamePrefix:            "test_",
+		TestDatabaseMinimalLifetime: 50 * time.Millisecond,
+		InUseDB:                     inUseFunc,
+		disableWorkerAutostart:      true, // no extend / cleanDirty tasks should run automatically!
+	}
+	p := NewPoolCollection(cfg)
+
+	p.InitHashPool(ctx, templateDB, initFunc)
+	require.NoError(t, p.extend(ctx, templateDB))
+	require.NoError(t, p.extend(ctx, templateDB))
+
+	for id := 0; id < 2; id++ {
+		testDB, err := p.GetTestDatabase(ctx, hash, time.Millisecond)
+		require.NoError(t, err)
+		assert.False(t, testDB.Dirty)
+	}
+
+	// dirty testdatabases are only handed out beyond their minimal lifetime
+	_, err := p.GetTestDatabaseSkipClean(ctx, hash, time.Millisecond)
+	assert.ErrorIs(t, err, ErrTimeout)
+
+	time.Sleep(cfg.TestDatabaseMinimalLifetime)
+
+	// testdatabases with connections left are skipped
+	inUse.Store(0, true)
+	testDB, err := p.GetTestDatabaseSkipClean(ctx, hash, time.Millisecond)
+	require.NoError(t, err)
+	assert.Equal(t, 1, testDB.ID)
+	assert.True(t, testDB.Dirty)
+
+	_, err = p.GetTestDatabaseSkipClean(ctx, hash, time.Millisecond)
+	assert.ErrorIs(t, err, ErrTimeout)
+
+	inUse.Delete(0)
+	testDB, err = p.GetTestDatabaseSkipClean(ctx, hash, time.Millisecond)
+	require.NoError(t, err)
+	assert.Equal(t, 0, testDB.ID)
+	assert.True(t, testDB.Dirty)
+
+	// both are still waiting to be auto cleaned
+	pool, err := p.getPool(ctx, hash)
+	require.NoError(t, err)
+	assert.Len(t, pool.dirty, 2)
+
+	// falls back to ready testdatabases
+	require.NoError(t, p.ReturnTestDatabase(ctx, hash, 0))
+	testDB, err = p.GetTestDatabaseSkipClean(ctx, hash, time.Millisecond)
+	require.NoError(t, err)
+	assert.Equal(t, 0, testDB.ID)
+	assert.False(t, testDB.Dirty)
+
+	assert.Equal(t, 2, p.Stats(ctx)[0].SkipCleanCheckouts)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&recreates), "only the initial creations")
+}
+
+func TestPoolTestDatabaseStates(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	hash := "h1"
+	templateDB := db.Database{TemplateHash: hash, Config: db.DatabaseConfig{Database: "h1_template"}}
+
+	initFunc := func(ctx context.Context, testDB db.TestDatabase, templateName string) error {
+		return nil
+	}
+
+	cfg := PoolConfig{
+		MaxPoolSize:            2,
+		MaxParallelTasks:       1,
+		TestDBNamePrefix:       "test_",
+		disableWorkerAutostart: true, // no extend / cleanDirty tasks should run automatically!
+	}
+	p := NewPoolCollection(cfg)
+
+	assert.Empty(t, p.TestDatabaseStates(ctx))
+
+	p.InitHashPool(ctx, templateDB, initFunc)
+	require.NoError(t, p.extend(ctx, templateDB))
+	require.NoError(t, p.extend(ctx, templateDB))
+
+	testDB, err := p.GetTestDatabase(ctx, hash, time.Millisecond)
+	require.NoError(t, err)
+
+	states := p.TestDatabaseStates(ctx)
+	assert.Equal(t, map[string]string{
+		testDB.Config.Database:          "dirty",
+		p.MakeDBName(hash, 1-testDB.ID): "ready",
+	}, states)
+}
+
+func TestPoolCancelFill(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	hash1 := "h1"
+	hash2 := "h2"
+	templateDB1 := db.Database{TemplateHash: hash1, Config: db.DatabaseConfig{Database: "h1_template"}}
+	templateDB2 := db.Database{TemplateHash: hash2, Config: db.DatabaseConfig{Database: "h2_template"}}
+
+	cfg := PoolConfig{
+		InitialPoolSize:                   2,
+		MaxPoolSize:                       4,
+		MaxParallelTasks:                  2,
+		TestDatabaseRetryRecreateSleepMin: 10 * time.Second, // only a cancelled backoff lets the test finish in time
+		TestDatabaseRetryRecreateSleepMax: 10 * time.Second,
+	}
+	p := NewPoolCollection(cfg)
+
+	p.InitHashPool(ctx, templateDB1, func(ctx context.Context, testDB db.TestDatabase, templateName string) error {
+		return nil
+	})
+
+	// never becomes ready, the workers are stuck within the backoff
+	var attempts int32
+	p.InitHashPool(ctx, templateDB2, func(ctx context.Context, testDB db.TestDatabase, templateName string) error {
+		atomic.AddInt32(&attempts, 1)
+		return ErrTestDBInUse
+	})
+
+	t.Cleanup(func() { p.Stop() })
+
+	_, err := util.WaitWithTimeout(ctx, time.Second, func(ctx context.Context) (bool, error) {
+		for ctx.Err() == nil {
+			stats := p.Stats(ctx)
+			if stats[0].Fill == FillStatusCompleted && atomic.LoadInt32(&attempts) == 2 {
+				return true, nil
+			}
+			time.Sleep(time.Millisecond)
+		}
+		return false, ctx.Err()
+	})
+	require.NoError(t, err)
+
+	stats := p.Stats(ctx)
+	assert.Equal(t, FillStatusCompleted, stats[0].Fill)
+	assert.Equal(t, FillStatusRunning, stats[1].Fill)
+
+	start := time.Now()
+	require.NoError(t, p.CancelFill(ctx, hash2))
+	assert.Less(t, time.Since(start), time.Second)
+	assert.Equal(t, FillStatusCancelled, p.Stats(ctx)[1].Fill)
+	assert.ErrorIs(t, p.CancelFill(ctx, "unknown"), ErrUnknownHash)
+
+	// completed fills stay completed
+	require.NoError(t, p.CancelFill(ctx, hash1))
+	assert.Equal(t, FillStatusCompleted, p.Stats(ctx)[0].Fill)
+
+	removed := 0
+	require.NoError(t, p.RemoveAllWithHash(ctx, hash2, func(ctx context.Context, testDB db.TestDatabase) error {
+		removed++
+		return nil
+	}))
+	assert.Equal(t, 2, removed)
+	assert.Len(t, p.Stats(ctx), 1)
+}
+
+func TestPoolGetTestDatabaseAtIndex(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	hash1 := "h1"
+	templateDB1 := db.Database{TemplateHash: hash1, Config: db.DatabaseConfig{Database: "h1_template"}}
+
+	var recreates int32
+	initFunc := func(ctx context.Context, testDB db.TestDatabase, templateName string) error {
+		atomic.AddInt32(&recreates, 1)
+		return nil
+	}
+
+	cfg := PoolConfig{
+		MaxPoolSize:                 4,
+		MaxParallelTasks:            4,
+		TestDBNamePrefix:            "test_",
+		TestDatabaseMinimalLifetime: 50 * time.Millisecond,
+	}
+	p := NewPoolCollection(cfg)
+	p.InitHashPool(ctx, templateDB1, initFunc)
+
+	t.Cleanup(func() { p.Stop() })
+
+	// creates all missing testdatabases up to the index
+	testDB, err := p.GetTestDatabaseAtIndex(ctx, hash1, 2, time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, 2, testDB.ID)
+	assert.Equal(t, "test_h1_002", testDB.Database.Config.Database)
+	assert.EqualValues(t, 3, atomic.LoadInt32(&recreates))
+
+	// the others are ready for plain acquisitions
+	other, err := p.GetTestDatabase(ctx, hash1, time.Second)
+	require.NoError(t, err)
+	assert.Less(t, other.ID, 2)
+
+	// still checked out (within its minimal lifetime), waits until it was recreated
+	start := time.Now()
+	testDB, err = p.GetTestDatabaseAtIndex(ctx, hash1, 2, time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, 2, testDB.ID)
+	assert.GreaterOrEqual(t, time.Since(start), cfg.TestDatabaseMinimalLifetime/2)
+
+	// returned ones are handed out directly
+	require.NoError(t, p.ReturnTestDatabase(ctx, hash1, 2))
+	testDB, err = p.GetTestDatabaseAtIndex(ctx, hash1, 2, time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, 2, testDB.ID)
+
+	_, err = p.GetTestDatabaseAtIndex(ctx, hash1, cfg.MaxPoolSize, time.Second)
+	assert.ErrorIs(t, err, ErrInvalidIndex)
+	_, err = p.GetTestDatabaseAtIndex(ctx, "unknown", 0, time.Second)
+	assert.ErrorIs(t, err, ErrUnknownHash)
+}
+
+func TestPoolRenewTestDatabase(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	hash1 := "h1"
+	templateDB1 := db.Database{TemplateHash: hash1, Config: db.DatabaseConfig{Database: "h1_template"}}
+	initFunc := func(ctx context.Context, testDB db.TestDatabase, templateName string) error {
+		return nil
+	}
+
+	cfg := PoolConfig{
+		MaxPoolSize:                    1,
+		InitialPoolSize:                1,
+		MaxParallelTasks:               2,
+		TestDBNamePrefix:               "test_",
+		TestDatabaseMinimalLifetime:    20 * time.Millisecond,
+		TestDatabaseLeaseRenewDuration: 200 * time.Millisecond,
+		TestDatabaseMaxLeaseDuration:   300 * time.Millisecond,
+	}
+	p := NewPoolCollection(cfg)
+	p.InitHashPool(ctx, templateDB1, initFunc)
+
+	t.Cleanup(func() { p.Stop() })
+
+	testDB, err := p.GetTestDatabase(ctx, hash1, time.Second)
+	require.NoError(t, err)
+
+	lease, err := p.RenewTestDatabase(ctx, hash1, testDB.ID)
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(cfg.TestDatabaseLeaseRenewDuration), lease.ExpiresAt, 50*time.Millisecond)
+	assert.False(t, lease.MaxExpiresAt.IsZero())
+
+	// without the renewal, it would be auto-cleaned beyond the minimal lifetime
+	_, err = p.GetTestDatabase(ctx, hash1, 100*time.Millisecond)
+	assert.ErrorIs(t, err, ErrTimeout)
+
+	// capped to the max lease duration since the checkout
+	lease, err = p.RenewTestDatabase(ctx, hash1, testDB.ID)
+	require.NoError(t, err)
+	assert.Equal(t, lease.MaxExpiresAt, lease.ExpiresAt)
+
+	// auto-cleaned as soon as the lease expired
+	recreated, err := p.GetTestDatabase(ctx, hash1, time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, testDB.ID, recreated.ID)
+	assert.False(t, time.Now().Before(lease.ExpiresAt))
+
+	require.NoError(t, p.ReturnTestDatabase(ctx, hash1, recreated.ID))
+	_, err = p.RenewTestDatabase(ctx, hash1, recreated.ID)
+	assert.ErrorIs(t, err, ErrInvalidState)
+
+	// the minimal lifetime keeps it checked out beyond the max lease duration
+	hash2 := "h2"
+	cfg2 := cfg
+	cfg2.TestDatabaseMinimalLifetime = time.Minute
+	cfg2.TestDatabaseMaxLeaseDuration = 50 * time.Millisecond
+	p.InitHashPoolWithConfig(ctx, db.Database{TemplateHash: hash2, Config: db.DatabaseConfig{Database: "h2_template"}}, initFunc, cfg2)
+
+	testDB, err = p.GetTestDatabase(ctx, hash2, time.Second)
+	require.NoError(t, err)
+	time.Sleep(cfg2.TestDatabaseMaxLeaseDuration)
+	_, err = p.RenewTestDatabase(ctx, hash2, testDB.ID)
+	assert.ErrorIs(t, err, ErrLeaseExpired)
+
+	_, err = p.RenewTestDatabase(ctx, hash1, -1)
+	assert.ErrorIs(t, err, ErrInvalidIndex)
+	_, err = p.RenewTestDatabase(ctx, "unknown", 0)
+	assert.ErrorIs(t, err, ErrUnknownHash)
+}
+
+func TestPoolCheckouts(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	hash1 := "h1"
+	templateDB1 := db.Database{TemplateHash: hash1, Config: db.DatabaseConfig{Database: "h1_template"}}
+	initFunc := func(ctx context.Context, testDB db.TestDatabase, templateName string) error {
+		return nil
+	}
+
+	cfg := PoolConfig{
+		MaxPoolSize:                    2,
+		InitialPoolSize:                2,
+		MaxParallelTasks:               2,
+		TestDBNamePrefix:               "test_",
+		TestDatabaseMinimalLifetime:    time.Minute,
+		TestDatabaseLeaseRenewDuration: time.Hour,
+	}
+	p := NewPoolCollection(cfg)
+	p.InitHashPool(ctx, templateDB1, initFunc)
+
+	t.Cleanup(func() { p.Stop() })
+
+	assert.Empty(t, p.Checkouts(ctx))
+
+	testDB1, err := p.GetTestDatabase(WithHolder(ctx, "worker-12"), hash1, time.Second)
+	require.NoError(t, err)
+	testDB2, err := p.GetTestDatabase(ctx, hash1, time.Second)
+	require.NoError(t, err)
+
+	_, err = p.RenewTestDatabase(ctx, hash1, testDB2.ID)
+	require.NoError(t, err)
+
+	checkouts := p.Checkouts(ctx)
+	require.Len(t, checkouts, 2)
+	byID := map[int]Checkout{checkouts[0].ID: checkouts[0], checkouts[1].ID: checkouts[1]}
+
+	assert.Equal(t, "worker-12", byID[testDB1.ID].Holder)
+	assert.WithinDuration(t, time.Now(), byID[testDB1.ID].CheckedOutAt, time.Second)
+	assert.WithinDuration(t, byID[testDB1.ID].CheckedOutAt.Add(cfg.TestDatabaseMinimalLifetime), byID[testDB1.ID].LeaseExpiresAt, time.Millisecond)
+	assert.Empty(t, byID[testDB2.ID].Holder)
+	assert.WithinDuration(t, time.Now().Add(cfg.TestDatabaseLeaseRenewDuration), byID[testDB2.ID].LeaseExpiresAt, time.Second)
+
+	// the holder is reset on return
+	require.NoError(t, p.ReturnTestDatabase(ctx, hash1, testDB1.ID))
+	checkouts = p.Checkouts(ctx)
+	require.Len(t, checkouts, 1)
+	assert.Equal(t, testDB2.ID, checkouts[0].ID)
+
+	testDB1, err = p.GetTestDatabase(ctx, hash1, time.Second)
+	require.NoError(t, err)
+	for _, checkout := range p.Checkouts(ctx) {
+		assert.Empty(t, checkout.Holder)
+	}
+}
+
+func TestPoolExplainGetTestDatabase(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	hash1 := "h1"
+	templateDB1 := db.Database{TemplateHash: hash1, Config: db.DatabaseConfig{Database: "h1_template"}}
+	initFunc := func(ctx context.Context, testDB db.TestDatabase, templateName string) error {
+		return nil
+	}
+
+	cfg := PoolConfig{
+		MaxPoolSize:                 2,
+		InitialPoolSize:             1,
+		MaxParallelTasks:            2,
+		TestDBNamePrefix:            "test_",
+		TestDatabaseMinimalLifetime: time.Minute,
+	}
+	p := NewPoolCollection(cfg)
+	p.InitHashPool(ctx, templateDB1, initFunc)
+
+	t.Cleanup(func() { p.Stop() })
+
+	testDB1, err := p.GetTestDatabase(ctx, hash1, time.Second)
+	require.NoError(t, err)
+	testDB2, err := p.GetTestDatabase(ctx, hash1, time.Second)
+	require.NoError(t, err)
+
+	// the dry-run never checks anything out, the decision stays the same
+	for i := 0; i < 2; i++ {
+		explanation, err := p.ExplainGetTestDatabase(ctx, hash1, false, nil)
+		require.NoError(t, err)
+		assert.Equal(t, DecisionWaitBlocked, explanation.Decision)
+		assert.Equal(t, 0, explanation.Ready)
+		assert.Equal(t, 2, explanation.Dirty)
+		assert.Equal(t, 0, explanation.DirtyEligible)
+		assert.Equal(t, 2, explanation.Total)
+		require.NotNil(t, explanation.NextEligibleAt)
+		assert.True(t, explanation.NextEligibleAt.After(time.Now()))
+	}
+
+	index := testDB1.ID
+	explanation, err := p.ExplainGetTestDatabase(ctx, hash1, false, &index)
+	require.NoError(t, err)
+	assert.Equal(t, DecisionWaitBlocked, explanation.Decision)
+
+	require.NoError(t, p.ReturnTestDatabase(ctx, hash1, testDB1.ID))
+
+	explanation, err = p.ExplainGetTestDatabase(ctx, hash1, false, nil)
+	require.NoError(t, err)
+	assert.Equal(t, DecisionReuseReady, explanation.Decision)
+	assert.Equal(t, 1, explanation.Ready)
+	assert.Equal(t, 1, explanation.Dirty)
+
+	// nothing is eligible for skipping the clean, falls back to the ready one
+	explanation, err = p.ExplainGetTestDatabase(ctx, hash1, true, nil)
+	require.NoError(t, err)
+	assert.Equal(t, DecisionReuseReady, explanation.Decision)
+
+	index = testDB1.ID
+	explanation, err = p.ExplainGetTestDatabase(ctx, hash1, false, &index)
+	require.NoError(t, err)
+	assert.Equal(t, DecisionReuseReady, explanation.Decision)
+
+	// the checked out testdatabase is still there after all dry-runs
+	_, err = p.RenewTestDatabase(ctx, hash1, testDB2.ID)
+	require.NoError(t, err)
+
+	index = cfg.MaxPoolSize
+	_, err = p.ExplainGetTestDatabase(ctx, hash1, false, &index)
+	assert.ErrorIs(t, err, ErrInvalidIndex)
+	_, err = p.ExplainGetTestDatabase(ctx, "unknown", false, nil)
+	assert.ErrorIs(t, err, ErrUnknownHash)
+}
+
+func TestPoolSelectionPolicy(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	initFunc := func(ctx context.Context, testDB db.TestDatabase, templateName string) error {
+		return nil
+	}
+
+	cfg := PoolConfig{
+		MaxPoolSize:      3,
+		InitialPoolSize:  3,
+		MaxParallelTasks: 1,
+		TestDBNamePrefix: "test_",
+	}
+	p := NewPoolCollection(cfg)
+
+	t.Cleanup(func() { p.Stop() })
+
+	// acquires and directly unlocks a testdatabase (keeping its recreation time) n times, returning the IDs
+	acquire := func(hash string, n int) []int {
+		ids := make([]int, 0, n)
+		for i := 0; i < n; i++ {
+			testDB, err := p.GetTestDatabase(ctx, hash, time.Second)
+			require.NoError(t, err)
+			require.NoError(t, p.ReturnTestDatabase(ctx, hash, testDB.ID))
+			ids = append(ids, testDB.ID)
+		}
+		return ids
+	}
+
+	for _, policy := range []SelectionPolicy{SelectionLRU, SelectionMRU, SelectionRoundRobin} {
+		hash := string(policy)
+		policyCfg := cfg
+		policyCfg.SelectionPolicy = policy
+		p.InitHashPoolWithConfig(ctx, db.Database{TemplateHash: hash, Config: db.DatabaseConfig{Database: hash + "_template"}}, initFunc, policyCfg)
+
+		require.Eventually(t, func() bool {
+			explanation, err := p.ExplainGetTestDatabase(ctx, hash, false, nil)
+			return err == nil && explanation.Ready == cfg.MaxPoolSize
+		}, time.Second, 5*time.Millisecond)
+	}
+
+	// the least recently recreated one is always preferred, even though the returned (stale) testdatabase was queued up
+	// behind the more recently recreated ones
+	lru, err := p.getPool(ctx, string(SelectionLRU))
+	require.NoError(t, err)
+
+	lru.RLock()
+	oldest := 0
+	for id := range lru.dbs {
+		if lru.dbs[id].recreatedAt.Before(lru.dbs[oldest].recreatedAt) {
+			oldest = id
+		}
+	}
+	lru.RUnlock()
+
+	ids := acquire(string(SelectionLRU), 3)
+	assert.Equal(t, []int{oldest, oldest, oldest}, ids)
+
+	// the most recently recreated one is always preferred, unlocking doesn't change its recreation time
+	ids = acquire(string(SelectionMRU), 3)
+	assert.Equal(t, []int{ids[0], ids[0], ids[0]}, ids)
+
+	ids = acquire(string(SelectionRoundRobin), 4)
+	assert.Equal(t, []int{0, 1, 2, 0}, ids)
+
+	stats := p.Stats(ctx)
+	require.Len(t, stats, 3)
+	for _, s := range stats {
+		assert.Equal(t, SelectionPolicy(s.TemplateHash), s.SelectionPolicy)
+	}
+
+	_, err = ParseSelectionPolicy("random")
+	assert.ErrorIs(t, err, ErrInvalidSelectionPolicy)
+	policy, err := ParseSelectionPolicy("")
+	require.NoError(t, err)
+	assert.Equal(t, SelectionLRU, policy)
+}
+
+func TestPoolDirtyRecycleWorkers(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	var mutex sync.Mutex
+	recreates := make(map[string]int)
+	initFunc := func(ctx context.Context, testDB db.TestDatabase, templateName string) error {
+		mutex.Lock()
+		defer mutex.Unlock()
+		recreates[testDB.Config.Database]++
+		return nil
+	}
+
+	cfg := PoolConfig{
+		MaxPoolSize:                 3,
+		InitialPoolSize:             1,
+		MaxParallelTasks:            1,
+		TestDBNamePrefix:            "test_",
+		TestDatabaseMinimalLifetime: 20 * time.Millisecond,
+	}
+	p := NewPoolCollection(cfg)
+
+	t.Cleanup(func() { p.Stop() })
+
+	recycleCfg := cfg
+	recycleCfg.DirtyRecycleWorkers = 2
+	p.InitHashPoolWithConfig(ctx, db.Database{TemplateHash: "recycle", Config: db.DatabaseConfig{Database: "recycle_template"}}, initFunc, recycleCfg)
+	p.InitHashPoolWithConfig(ctx, db.Database{TemplateHash: "lazy", Config: db.DatabaseConfig{Database: "lazy_template"}}, initFunc, cfg)
+
+	recycled, err := p.GetTestDatabase(ctx, "recycle", time.Second)
+	require.NoError(t, err)
+	lazy, err := p.GetTestDatabase(ctx, "lazy", time.Second)
+	require.NoError(t, err)
+
+	// never returned, it's recreated in background as soon as its minimal lifetime is over
+	require.Eventually(t, func() bool {
+		return p.TestDatabaseStates(ctx)[recycled.Config.Database] == "ready"
+	}, time.Second, 5*time.Millisecond)
+
+	mutex.Lock()
+	assert.Equal(t, 2, recreates[recycled.Config.Database])
+	assert.Equal(t, 1, recreates[lazy.Config.Database])
+	mutex.Unlock()
+
+	// without workers, dirty testdatabases are only auto-cleaned once the pool is full
+	assert.Equal(t, "dirty", p.TestDatabaseStates(ctx)[lazy.Config.Database])
+}
+
+func TestPoolMaxIdleDuration(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	hash1 := "h1"
+	templateDB1 := db.Database{TemplateHash: hash1, Config: db.DatabaseConfig{Database: "h1_template"}}
+
+	initFunc := func(ctx context.Context, testDB db.TestDatabase, templateName string) error {
+		return nil
+	}
+
+	var mutex sync.Mutex
+	dropped := make([]string, 0)
+	dropFunc := func(ctx context.Context, testDB db.TestDatabase) error {
+		mutex.Lock()
+		defer mutex.Unlock()
+		dropped = append(dropped, testDB.Config.Database)
+		return nil
+	}
+
+	cfg := PoolConfig{
+		InitialPoolSize:             1,
+		MaxPoolSize:                 3,
+		MaxParallelTasks:            4,
+		TestDBNamePrefix:            "test_",
+		TestDatabaseMinimalLifetime: time.Second, // block auto cleaning after checkout
+		TestDatabaseMaxIdleDuration: 50 * time.Millisecond,
+		DropIdleDB:                  dropFunc,
+	}
+	p := NewPoolCollection(cfg)
+	p.InitHashPool(ctx, templateDB1, initFunc)
+
+	t.Cleanup(func() { p.Stop() })
+
+	testDB, err := p.GetTestDatabaseAtIndex(ctx, hash1, 2, time.Second)
+	require.NoError(t, err)
+
+	// the checked out testdatabase with the highest ID blocks evicting the idle ones before it
+	time.Sleep(3 * cfg.TestDatabaseMaxIdleDuration)
+	mutex.Lock()
+	assert.Empty(t, dropped)
+	mutex.Unlock()
+
+	require.NoError(t, p.ReturnTestDatabase(ctx, hash1, testDB.ID))
+
+	// shrinks down to the initial pool size
+	require.Eventually(t, func() bool {
+		return len(p.TestDatabaseStates(ctx)) == cfg.InitialPoolSize
+	}, time.Second, 5*time.Millisecond)
+
+	mutex.Lock()
+	assert.Equal(t, []string{"test_h1_002", "test_h1_001"}, dropped)
+	mutex.Unlock()
+	assert.Equal(t, 2, p.Stats(ctx)[0].IdleEvictions)
+
+	// evicted IDs are reused when the pool grows again
+	testDB, err = p.GetTestDatabaseAtIndex(ctx, hash1, 2, time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, "test_h1_002", testDB.Database.Config.Database)
+}
+
+func TestPoolShrinkAll(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	hash1 := "h1"
+	templateDB1 := db.Database{TemplateHash: hash1, Config: db.DatabaseConfig{Database: "h1_template"}}
+
+	initFunc := func(ctx context.Context, testDB db.TestDatabase, templateName string) error {
+		return nil
+	}
+
+	var mutex sync.Mutex
+	dropped := make([]string, 0)
+	dropFunc := func(ctx context.Context, testDB db.TestDatabase) error {
+		mutex.Lock()
+		defer mutex.Unlock()
+		dropped = append(dropped, testDB.Config.Database)
+		return nil
+	}
+
+	cfg := PoolConfig{
+		InitialPoolSize:             1,
+		MaxPoolSize:                 4,
+		MaxParallelTasks:            2,
+		TestDBNamePrefix:            "test_",
+		TestDatabaseMinimalLifetime: time.Second, // block auto cleaning after checkout
+		TestDatabaseMaxIdleDuration: time.Hour,   // never evicted by the loop
+		DropIdleDB:                  dropFunc,
+	}
+	p := NewPoolCollection(cfg)
+	p.InitHashPool(ctx, templateDB1, initFunc)
+
+	t.Cleanup(func() { p.Stop() })
+
+	testDB, err := p.GetTestDatabaseAtIndex(ctx, hash1, 3, time.Second)
+	require.NoError(t, err)
+	require.NoError(t, p.ReturnTestDatabase(ctx, hash1, testDB.ID))
+
+	require.Eventually(t, func() bool {
+		return len(p.TestDatabaseStates(ctx)) == 4
+	}, time.Second, 5*time.Millisecond)
+
+	// more than MaxParallelTasks, regardless of the idle duration
+	shrunk, err := p.ShrinkAll(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 3, shrunk)
+	assert.Len(t, p.TestDatabaseStates(ctx), cfg.InitialPoolSize)
+
+	mutex.Lock()
+	assert.Equal(t, []string{"test_h1_003", "test_h1_002", "test_h1_001"}, dropped)
+	mutex.Unlock()
+
+	shrunk, err = p.ShrinkAll(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, shrunk)
+}
+
+func TestPoolAdopt(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	hash1 := "h1"
+	templateDB1 := db.Database{TemplateHash: hash1, Config: db.DatabaseConfig{Database: "h1_template"}}
+
+	var mutex sync.Mutex
+	recreated := make([]int, 0)
+	initFunc := func(ctx context.Context, testDB db.TestDatabase, templateName string) error {
+		mutex.Lock()
+		defer mutex.Unlock()
+		recreated = append(recreated, testDB.ID)
+		return nil
+	}
+
+	cfg := PoolConfig{
+		InitialPoolSize:             2,
+		MaxPoolSize:                 3,
+		MaxParallelTasks:            4,
+		TestDBNamePrefix:            "test_",
+		TestDatabaseMinimalLifetime: time.Hour, // block auto cleaning the adopted dirty one
+	}
+	p := NewPoolCollection(cfg)
+	rejected := p.InitHashPoolWithAdopted(ctx, templateDB1, initFunc, cfg, []AdoptedTestDatabase{
+		{ID: 1, Ready: false},
+		{ID: 0, Ready: true},
+		{ID: 3, Ready: true}, // gap
+	})
+
+	t.Cleanup(func() { p.Stop() })
+
+	assert.Equal(t, []int{3}, rejected)
+	assert.Equal(t, map[string]string{"test_h1_000": "ready", "test_h1_001": "dirty"}, p.TestDatabaseStates(ctx))
+
+	// handed out as-is, the adopted ones satisfy the initial pool size
+	testDB, err := p.GetTestDatabase(ctx, hash1, time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, 0, testDB.ID)
+
+	checkouts := p.Checkouts(ctx)
+	require.Len(t, checkouts, 2)
+	assert.Equal(t, 1, checkouts[1].ID)
+
+	// the client of the adopted dirty one returns it after the restart
+	require.NoError(t, p.ReturnTestDatabase(ctx, hash1, 1))
+	testDB, err = p.GetTestDatabase(ctx, hash1, time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, 1, testDB.ID)
+
+	mutex.Lock()
+	assert.NotContains(t, recreated, 0)
+	assert.NotContains(t, recreated, 1)
+	mutex.Unlock()
+}
+
+func TestPoolFillPriority(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	gate := make(chan struct{})
+	var once sync.Once
+	var mutex sync.Mutex
+	order := make([]string, 0)
+	initFunc := func(ctx context.Context, testDB db.TestDatabase, templateName string) error {
+		// the very first fill blocks all others
+		once.Do(func() { <-gate })
+
+		mutex.Lock()
+		defer mutex.Unlock()
+		order = append(order, testDB.TemplateHash)
+		return nil
+	}
+
+	cfg := PoolConfig{
+		InitialPoolSize:  3,
+		MaxPoolSize:      3,
+		MaxParallelTasks: 3,
+		MaxParallelFills: 1,
+		TestDBNamePrefix: "test_",
+	}
+	p := NewPoolCollection(cfg)
+
+	t.Cleanup(func() { p.Stop() })
+
+	p.InitHashPool(ctx, db.Database{TemplateHash: "low", Config: db.DatabaseConfig{Database: "low_template"}}, initFunc)
+	require.Eventually(t, func() bool { return p.fillSlots.Waiting() == 2 }, time.Second, time.Millisecond)
+
+	highCfg := cfg
+	highCfg.FillPriority = 10
+	p.InitHashPoolWithConfig(ctx, db.Database{TemplateHash: "high", Config: db.DatabaseConfig{Database: "high_template"}}, initFunc, highCfg)
+	require.Eventually(t, func() bool { return p.fillSlots.Waiting() == 5 }, time.Second, time.Millisecond)
+
+	close(gate)
+
+	require.Eventually(t, func() bool {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return len(order) == 6
+	}, time.Second, time.Millisecond)
+
+	mutex.Lock()
+	assert.Equal(t, []string{"low", "high", "high", "high", "low", "low"}, order)
+	mutex.Unlock()
+}
+
+func TestPoolLeaseReclaim(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	hash1 := "h1"
+	templateDB1 := db.Database{TemplateHash: hash1, Config: db.DatabaseConfig{Database: "h1_template"}}
+
+	initFunc := func(ctx context.Context, testDB db.TestDatabase, templateName string) error {
+		return nil
+	}
+
+	cfg := PoolConfig{
+		InitialPoolSize:                3,
+		MaxPoolSize:                    4,
+		MaxParallelTasks:               4,
+		TestDBNamePrefix:               "test_",
+		TestDatabaseMinimalLifetime:    10 * time.Millisecond,
+		TestDatabaseLeaseRenewDuration: time.Second,
+		TestDatabaseLeaseSweepInterval: 10 * time.Millisecond,
+	}
+	p := NewPoolCollection(cfg)
+	p.InitHashPool(ctx, templateDB1, initFunc)
+
+	t.Cleanup(func() { p.Stop() })
+
+	leaseCtx := WithLease(ctx, 50*time.Millisecond)
+	crashed, err := p.GetTestDatabase(leaseCtx, hash1, time.Second)
+	require.NoError(t, err)
+	renewed, err := p.GetTestDatabase(leaseCtx, hash1, time.Second)
+	require.NoError(t, err)
+	_, err = p.RenewTestDatabase(ctx, hash1, renewed.ID)
+	require.NoError(t, err)
+	unleased, err := p.GetTestDatabase(ctx, hash1, time.Second)
+	require.NoError(t, err)
+
+	// the expired lease is reclaimed, although the pool is not full
+	require.Eventually(t, func() bool {
+		return p.TestDatabaseStates(ctx)[crashed.Config.Database] == "ready"
+	}, time.Second, 5*time.Millisecond)
+	assert.Equal(t, 1, p.Stats(ctx)[0].LeaseReclaims)
+
+	states := p.TestDatabaseStates(ctx)
+	assert.Equal(t, "dirty", states[renewed.Config.Database])
+	assert.Equal(t, "dirty", states[unleased.Config.Database])
+
+	// no longer checked out
+	for _, checkout := range p.Checkouts(ctx) {
+		assert.NotEqual(t, crashed.ID, checkout.ID)
+	}
+}
+
+type messageLogger struct {
+	mutex    sync.Mutex
+	messages []string
+}
+
+func (l *messageLogger) Log(_ context.Context, _ zerolog.Level, msg string, _ map[string]interface{}) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.messages = append(l.messages, msg)
+}
+
+func TestPoolLogger(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	logger := &messageLogger{}
+	cfg := PoolConfig{
+		MaxPoolSize:            2,
+		MaxParallelTasks:       4,
+		TestDBNamePrefix:       "prefix_",
+		Logger:                 logger,
+		disableWorkerAutostart: true,
+	}
+	p := NewPoolCollection(cfg)
+
+	templateDB := db.Database{
+		TemplateHash: "h1",
+		Config: db.DatabaseConfig{
+			Username: "ich",
+			Database: "templateDBname",
+		},
+	}
+	initFunc := func(ctx context.Context, testDB db.TestDatabase, templateName string) error {
+		return nil
+	}
+	p.InitHashPool(ctx, templateDB, initFunc)
+	require.NoError(t, p.RemoveAllWithHash(ctx, "h1", func(ctx context.Context, testDB db.TestDatabase) error { return nil }))
+
+	logger.mutex.Lock()
+	defer logger.mutex.Unlock()
+	assert.Contains(t, logger.messages, "pool created")
+	assert.Contains(t, logger.messages, "pool removed")
+}
+
+func TestPoolWaitStarvation(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	recorder := events.NewRecorder(10)
+	cfg := PoolConfig{
+		MaxPoolSize:            2,
+		MaxParallelTasks:       4,
+		TestDBNamePrefix:       "prefix_",
+		WaitStarvationFactor:   3,
+		Events:                 recorder,
+		disableWorkerAutostart: true,
+	}
+	p := NewPoolCollection(cfg)
+
+	templateDB := db.Database{
+		TemplateHash: "h1",
+		Config: db.DatabaseConfig{
+			Username: "ich",
+			Database: "templateDBname",
+		},
+	}
+	initFunc := func(ctx context.Context, testDB db.TestDatabase, templateName string) error {
+		return nil
+	}
+	p.InitHashPool(ctx, templateDB, initFunc)
+
+	pool, err := p.getPool(ctx, "h1")
+	require.NoError(t, err)
+
+	// no testdatabases are created, all clients wait until they give up
+	waitCtx, cancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	for _, holder := range []string{"worker-1", "worker-2", "worker-3"} {
+		wg.Add(1)
+		go func(holder string) {
+			defer wg.Done()
+			_, err := p.GetTestDatabase(WithHolder(waitCtx, holder), "h1", time.Minute)
+			assert.ErrorIs(t, err, context.Canceled)
+		}(holder)
+	}
+
+	require.Eventually(t, func() bool { return pool.Stats().WaitQueue.Waiting == 3 }, time.Second, time.Millisecond)
+
+	// worker-1 waits far longer than the median
+	now := time.Now()
+	pool.waiters.mutex.Lock()
+	for _, w := range pool.waiters.waiters {
+		if w.holder == "worker-1" {
+			w.since = now.Add(-time.Minute)
+		} else {
+			w.since = now.Add(-2 * time.Second)
+		}
+	}
+	pool.waiters.mutex.Unlock()
+
+	pool.checkStarvation(ctx, now)
+	pool.checkStarvation(ctx, now) // each waiter is only flagged once
+
+	stats := pool.Stats().WaitQueue
+	assert.Equal(t, 1, stats.Starving)
+	assert.Equal(t, 1, stats.StarvationsDetected)
+	assert.Equal(t, int64(2000), stats.MedianWaitMs)
+	require.Len(t, stats.Waiters, 3)
+	assert.Equal(t, "worker-1", stats.Waiters[0].Holder)
+	assert.True(t, stats.Waiters[0].Starving)
+	assert.False(t, stats.Waiters[1].Starving)
+
+	recent := recorder.Recent()
+	require.Len(t, recent, 1)
+	assert.Equal(t, events.TypeWaitStarvation, recent[0].Type)
+	assert.Equal(t, "worker-1", recent[0].Fields["holder"])
+	assert.Contains(t, recent[0].Fields["suggestions"], "allow overflow test databases while the pool is exhausted")
+
+	cancel()
+	wg.Wait()
+
+	assert.Equal(t, 0, pool.Stats().WaitQueue.Waiting)
+	assert.Empty(t, pool.Stats().WaitQueue.Waiters)
+}
+
+func TestPoolShards(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	initFunc := func(ctx context.Context, testDB db.TestDatabase, templateName string) error {
+		return nil
+	}
+
+	cfg := PoolConfig{
+		MaxPoolSize:      4,
+		InitialPoolSize:  4,
+		MaxParallelTasks: 1,
+		TestDBNamePrefix: "test_",
+		// checked out testdatabases must not be auto-cleaned while the pool is exhausted
+		TestDatabaseMinimalLifetime: time.Minute,
+		Shards: []db.DatabaseConfig{
+			{Host: "pg0", Port: 5432, Username: "u0"},
+			{Host: "pg1", Port: 5433, Username: "u1"},
+		},
+	}
+	p := NewPoolCollection(cfg)
+
+	t.Cleanup(func() { p.Stop() })
+
+	for _, routing := range []ShardRouting{ShardRoutingRoundRobin, ShardRoutingLeastLoaded} {
+		hash := string(routing)
+		routingCfg := cfg
+		routingCfg.ShardRouting = routing
+		p.InitHashPoolWithConfig(ctx, db.Database{TemplateHash: hash, Config: db.DatabaseConfig{Host: "pg0", Port: 5432, Database: hash + "_template"}}, initFunc, routingCfg)
+
+		require.Eventually(t, func() bool {
+			explanation, err := p.ExplainGetTestDatabase(ctx, hash, false, nil)
+			return err == nil && explanation.Ready == cfg.MaxPoolSize
+		}, time.Second, 5*time.Millisecond)
+	}
+
+	// the servers in turn, each testdatabase is located on the server of its ID
+	hash := string(ShardRoutingRoundRobin)
+	shards := make([]int, 0, 4)
+	for i := 0; i < 4; i++ {
+		testDB, err := p.GetTestDatabase(ctx, hash, time.Second)
+		require.NoError(t, err)
+
+		shard := ShardOf(testDB.ID, len(cfg.Shards))
+		assert.Equal(t, cfg.Shards[shard].Host, testDB.Config.Host)
+		assert.Equal(t, cfg.Shards[shard].Port, testDB.Config.Port)
+		assert.Equal(t, cfg.Shards[shard].Username, testDB.Config.Username)
+		shards = append(shards, shard)
+	}
+	assert.Equal(t, []int{0, 1, 0, 1}, shards)
+
+	stats := p.Stats(ctx)
+	for _, s := range stats {
+		if s.TemplateHash != hash {
+			continue
+		}
+
+		require.Len(t, s.Shards, 2)
+		assert.Equal(t, ShardStats{Host: "pg0:5432", CheckedOut: 2, Total: 2}, s.Shards[0])
+		assert.Equal(t, ShardStats{Host: "pg1:5433", CheckedOut: 2, Total: 2}, s.Shards[1])
+	}
+
+	// the server with the fewest checked out testdatabases
+	hash = string(ShardRoutingLeastLoaded)
+	first, err := p.GetTestDatabase(ctx, hash, time.Second)
+	require.NoError(t, err)
+	second, err := p.GetTestDatabase(ctx, hash, time.Second)
+	require.NoError(t, err)
+	assert.NotEqual(t, ShardOf(first.ID, 2), ShardOf(second.ID, 2))
+
+	require.NoError(t, p.ReturnTestDatabase(ctx, hash, second.ID))
+	third, err := p.GetTestDatabase(ctx, hash, time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, ShardOf(second.ID, 2), ShardOf(third.ID, 2))
+
+	_, err = ParseShardRouting("random")
+	assert.ErrorIs(t, err, ErrInvalidShardRouting)
+	routing, err := ParseShardRouting("")
+	require.NoError(t, err)
+	assert.Equal(t, ShardRoutingRoundRobin, routing)
+}
+
+func TestPoolMoveTo(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	var mutex sync.Mutex
+	dropped := make([]string, 0)
+
+	initFunc := func(ctx context.Context, testDB db.TestDatabase, templateName string) error {
+		return nil
+	}
+
+	cfg := PoolConfig{
+		MaxPoolSize:      3,
+		InitialPoolSize:  3,
+		MaxParallelTasks: 1,
+		TestDBNamePrefix: "test_",
+		// checked out testdatabases must not be auto-cleaned while draining
+		TestDatabaseMinimalLifetime: time.Minute,
+		DropMovedDB: func(ctx context.Context, testDB db.TestDatabase) error {
+			mutex.Lock()
+			defer mutex.Unlock()
+
+			dropped = append(dropped, testDB.Config.Host+"/"+testDB.Config.Database)
+			return nil
+		},
+	}
+	p := NewPoolCollection(cfg)
+
+	t.Cleanup(func() { p.Stop() })
+
+	hash := "h1"
+	p.InitHashPool(ctx, db.Database{TemplateHash: hash, Config: db.DatabaseConfig{Host: "old", Port: 5432, Database: "h1_template"}}, initFunc)
+
+	require.Eventually(t, func() bool {
+		explanation, err := p.ExplainGetTestDatabase(ctx, hash, false, nil)
+		return err == nil && explanation.Ready == cfg.MaxPoolSize
+	}, time.Second, 5*time.Millisecond)
+
+	checkedOut, err := p.GetTestDatabase(ctx, hash, time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, "old", checkedOut.Config.Host)
+
+	moved, err := p.MoveTo(ctx, hash, db.DatabaseConfig{Host: "new", Port: 5433, Username: "other"})
+	require.NoError(t, err)
+	assert.Equal(t, 2, moved)
+
+	// the ready ones are relocated right away, the checked out one is drained
+	require.Eventually(t, func() bool {
+		stats, err := p.MoveStats(ctx, hash)
+		return err == nil && stats == MoveStats{Remaining: 1, CheckedOut: 1}
+	}, time.Second, 5*time.Millisecond)
+
+	testDB, err := p.GetTestDatabase(ctx, hash, time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, "new", testDB.Config.Host)
+	assert.Equal(t, 5433, testDB.Config.Port)
+	assert.Equal(t, "other", testDB.Config.Username)
+
+	// returned testdatabases are not handed out again on the previous server
+	require.NoError(t, p.ReturnTestDatabase(ctx, hash, checkedOut.ID))
+
+	require.Eventually(t, func() bool {
+		stats, err := p.MoveStats(ctx, hash)
+		return err == nil && stats == MoveStats{}
+	}, time.Second, 5*time.Millisecond)
+
+	mutex.Lock()
+	assert.ElementsMatch(t, []string{"old/test_h1_000", "old/test_h1_001", "old/test_h1_002"}, dropped)
+	mutex.Unlock()
+
+	for i := 0; i < 2; i++ {
+		testDB, err := p.GetTestDatabase(ctx, hash, time.Second)
+		require.NoError(t, err)
+		assert.Equal(t, "new", testDB.Config.Host)
+	}
+
+	// striped across the servers by their ID
+	shardedCfg := cfg
+	shardedCfg.Shards = []db.DatabaseConfig{{Host: "pg0", Port: 5432}, {Host: "pg1", Port: 5432}}
+	p.InitHashPoolWithConfig(ctx, db.Database{TemplateHash: "h2", Config: db.DatabaseConfig{Host: "pg0", Port: 5432, Database: "h2_template"}}, initFunc, shardedCfg)
+
+	_, err = p.MoveTo(ctx, "h2", db.DatabaseConfig{Host: "new", Port: 5433})
+	assert.ErrorIs(t, err, ErrMoveUnsupported)
+}
+
+func TestPoolCircuitBreaker(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	var failing atomic.Bool
+	failing.Store(true)
+
+	initFunc := func(ctx context.Context, testDB db.TestDatabase, templateName string) error {
+		if failing.Load() {
+			return errors.New("disk full")
+		}
+		return nil
+	}
+
+	recorder := events.NewRecorder(10)
+	cfg := PoolConfig{
+		MaxPoolSize:                 2,
+		InitialPoolSize:             2,
+		MaxParallelTasks:            1,
+		TestDBNamePrefix:            "test_",
+		CircuitBreakerThreshold:     2,
+		CircuitBreakerProbeInterval: 20 * time.Millisecond,
+		Events:                      recorder,
+	}
+	p := NewPoolCollection(cfg)
+
+	t.Cleanup(func() { p.Stop() })
+
+	hash := "h1"
+	p.InitHashPool(ctx, db.Database{TemplateHash: hash, Config: db.DatabaseConfig{Database: "h1_template"}}, initFunc)
+
+	require.Eventually(t, func() bool {
+		stats := p.Stats(ctx)
+		return len(stats) == 1 && stats[0].Circuit.State != CircuitClosed
+	}, time.Second, 5*time.Millisecond)
+
+	// fails fast instead of waiting for the timeout
+	start := time.Now()
+	_, err := p.GetTestDatabase(ctx, hash, 5*time.Second)
+	require.ErrorIs(t, err, ErrCircuitOpen)
+	assert.Contains(t, err.Error(), "disk full")
+	assert.Less(t, time.Since(start), time.Second)
+
+	stats := p.Stats(ctx)[0]
+	assert.Equal(t, 1, stats.Circuit.Opened)
+	assert.GreaterOrEqual(t, stats.Circuit.Failures, 2)
+	assert.Equal(t, "disk full", stats.Circuit.LastError)
+	assert.NotNil(t, stats.Circuit.OpenedAt)
+
+	// the next probe closes it again, the paused testdatabases are recreated afterwards
+	failing.Store(false)
+
+	require.Eventually(t, func() bool {
+		explanation, err := p.ExplainGetTestDatabase(ctx, hash, false, nil)
+		return err == nil && explanation.Ready == cfg.MaxPoolSize
+	}, time.Second, 5*time.Millisecond)
+
+	stats = p.Stats(ctx)[0]
+	assert.Equal(t, CircuitClosed, stats.Circuit.State)
+	assert.Equal(t, 0, stats.Circuit.ConsecutiveFailures)
+	assert.Equal(t, 2, stats.Circuit.Successes)
+	assert.Nil(t, stats.Circuit.OpenedAt)
+
+	_, err = p.GetTestDatabase(ctx, hash, time.Second)
+	require.NoError(t, err)
+
+	types := make([]events.Type, 0)
+	for _, e := range recorder.Recent() {
+		types = append(types, e.Type)
+	}
+	assert.Contains(t, types, events.TypeCircuitOpened)
+	assert.Contains(t, types, events.TypeCircuitClosed)
+}
+
+func TestPoolResize(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	var mutex sync.Mutex
+	dropped := make([]int, 0)
+
+	initFunc := func(ctx context.Context, testDB db.TestDatabase, templateName string) error {
+		return nil
+	}
+
+	cfg := PoolConfig{
+		MaxPoolSize:      2,
+		InitialPoolSize:  1,
+		MaxPoolSizeLimit: 4,
+		MaxParallelTasks: 2,
+		TestDBNamePrefix: "test_",
+		DropIdleDB: func(ctx context.Context, testDB db.TestDatabase) error {
+			mutex.Lock()
+			defer mutex.Unlock()
+
+			dropped = append(dropped, testDB.ID)
+			return nil
+		},
+	}
+	p := NewPoolCollection(cfg)
+
+	t.Cleanup(func() { p.Stop() })
+
+	hash := "h1"
+	p.InitHashPool(ctx, db.Database{TemplateHash: hash, Config: db.DatabaseConfig{Database: "h1_template"}}, initFunc)
+
+	require.Eventually(t, func() bool {
+		explanation, err := p.ExplainGetTestDatabase(ctx, hash, false, nil)
+		return err == nil && explanation.Ready == 1
+	}, time.Second, 5*time.Millisecond)
+
+	_, err := p.Resize(ctx, hash, 1, 5)
+	assert.ErrorIs(t, err, ErrInvalidPoolSize, "beyond the limit")
+
+	_, err = p.Resize(ctx, hash, 3, 2)
+	assert.ErrorIs(t, err, ErrInvalidPoolSize, "initial beyond the max")
+
+	_, err = p.Resize(ctx, "unknown", 1, 2)
+	assert.ErrorIs(t, err, ErrUnknownHash)
+
+	// growing fills the pool in background
+	size, err := p.Resize(ctx, hash, 3, 4)
+	require.NoError(t, err)
+	assert.Equal(t, 3, size.InitialPoolSize)
+	assert.Equal(t, 4, size.MaxPoolSize)
+	assert.Equal(t, 4, size.MaxPoolSizeLimit)
+
+	require.Eventually(t, func() bool {
+		explanation, err := p.ExplainGetTestDatabase(ctx, hash, false, nil)
+		return err == nil && explanation.Ready == 3 && explanation.MaxPoolSize == 4
+	}, time.Second, 5*time.Millisecond)
+
+	checkedOut, err := p.GetTestDatabaseAtIndex(ctx, hash, 3, time.Second)
+	require.NoError(t, err)
+
+	// shrinking evicts the ready testdatabase beyond the max right away, the checked out one as soon as it's returned
+	size, err = p.Resize(ctx, hash, 1, 2)
+	require.NoError(t, err)
+	assert.Equal(t, 4, size.Total)
+
+	mutex.Lock()
+	assert.Empty(t, dropped)
+	mutex.Unlock()
+
+	require.NoError(t, p.ReturnTestDatabase(ctx, hash, checkedOut.ID))
+
+	require.Eventually(t, func() bool {
+		explanation, err := p.ExplainGetTestDatabase(ctx, hash, false, nil)
+		return err == nil && explanation.Total == 2
+	}, time.Second, 5*time.Millisecond)
+
+	mutex.Lock()
+	assert.Equal(t, []int{3, 2}, dropped)
+	mutex.Unlock()
+
+	_, err = p.GetTestDatabaseAtIndex(ctx, hash, 2, time.Second)
+	assert.ErrorIs(t, err, ErrInvalidIndex)
+}
+
+func TestPoolStatsCounts(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	initFunc := func(ctx context.Context, testDB db.TestDatabase, templateName string) error {
+		return nil
+	}
+
+	cfg := PoolConfig{
+		MaxPoolSize:      3,
+		InitialPoolSize:  3,
+		MaxParallelTasks: 2,
+		TestDBNamePrefix: "test_",
+	}
+	p := NewPoolCollection(cfg)
+
+	t.Cleanup(func() { p.Stop() })
+
+	hash := "h1"
+	p.InitHashPool(ctx, db.Database{TemplateHash: hash, Config: db.DatabaseConfig{Database: "h1_template"}}, initFunc)
+
+	require.Eventually(t, func() bool {
+		stats := p.Stats(ctx)
+		return len(stats) == 1 && stats[0].Ready == 3
+	}, time.Second, 5*time.Millisecond)
+
+	first, err := p.GetTestDatabase(ctx, hash, time.Second)
+	require.NoError(t, err)
+	_, err = p.GetTestDatabase(ctx, hash, time.Second)
+	require.NoError(t, err)
+
+	// returned untouched, thus ready again right away
+	require.NoError(t, p.ReturnTestDatabase(ctx, hash, first.ID))
+
+	stats := p.Stats(ctx)
+	require.Len(t, stats, 1)
+
+	assert.Equal(t, hash, stats[0].TemplateHash)
+	assert.Equal(t, 2, stats[0].Ready)
+	assert.Equal(t, 1, stats[0].Dirty)
+	assert.Equal(t, 1, stats[0].InUse)
+	assert.Equal(t, 0, stats[0].Recreating)
+	assert.Equal(t, PoolSize{InitialPoolSize: 3, MaxPoolSize: 3, MaxPoolSizeLimit: 3, Total: 3}, stats[0].Size)
+	assert.Equal(t, 2, stats[0].Acquisitions)
+	assert.Equal(t, stats[0].Latencies.ReadyWait.MeanMs, stats[0].AvgWaitMs)
+}
+
+func TestPoolFreeze(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	var mutex sync.Mutex
+	recreated := make(map[int]int)
+
+	initFunc := func(ctx context.Context, testDB db.TestDatabase, templateName string) error {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		recreated[testDB.ID]++
+		return nil
+	}
+
+	cfg := PoolConfig{
+		MaxPoolSize:      2,
+		InitialPoolSize:  2,
+		MaxParallelTasks: 2,
+		TestDBNamePrefix: "test_",
+
+		// checked out testdatabases are not auto-cleaned meanwhile
+		TestDatabaseMinimalLifetime: time.Minute,
+	}
+	p := NewPoolCollection(cfg)
+
+	t.Cleanup(func() { p.Stop() })
+
+	hash := "h1"
+	p.InitHashPool(ctx, db.Database{TemplateHash: hash, Config: db.DatabaseConfig{Database: "h1_template"}}, initFunc)
+
+	require.Eventually(t, func() bool {
+		stats := p.Stats(ctx)
+		return len(stats) == 1 && stats[0].Ready == 2
+	}, time.Second, 5*time.Millisecond)
+
+	_, err := p.FreezeTestDatabase(ctx, hash, 2)
+	assert.ErrorIs(t, err, ErrInvalidIndex)
+
+	frozen, err := p.FreezeTestDatabase(ctx, hash, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 0, frozen.ID)
+	assert.Equal(t, "test_h1_000", frozen.DBName)
+	assert.False(t, frozen.FrozenAt.IsZero())
+
+	// freezing again is a no-op
+	again, err := p.FreezeTestDatabase(ctx, hash, 0)
+	require.NoError(t, err)
+	assert.Equal(t, frozen, again)
+
+	// checked out testdatabases can't be frozen
+	checkedOut, err := p.GetTestDatabase(ctx, hash, time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, 1, checkedOut.ID)
+
+	_, err = p.FreezeTestDatabase(ctx, hash, 1)
+	assert.ErrorIs(t, err, ErrInvalidState)
+
+	// the frozen one is never handed out
+	_, err = p.GetTestDatabase(ctx, hash, 50*time.Millisecond)
+	assert.ErrorIs(t, err, ErrTimeout)
+
+	stats := p.Stats(ctx)
+	require.Len(t, stats, 1)
+	assert.Equal(t, []FrozenTestDatabase{frozen}, stats[0].Frozen)
+	assert.Equal(t, 0, stats[0].Ready)
+	assert.Equal(t, 1, stats[0].InUse)
+
+	assert.ErrorIs(t, p.UnfreezeTestDatabase(ctx, hash, 1), ErrInvalidState)
+
+	// recreated before it's handed out again
+	require.NoError(t, p.UnfreezeTestDatabase(ctx, hash, 0))
+
+	testDB, err := p.GetTestDatabase(ctx, hash, time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, 0, testDB.ID)
+
+	mutex.Lock()
+	assert.Equal(t, 2, recreated[0])
+	mutex.Unlock()
+
+	assert.Empty(t, p.Stats(ctx)[0].Frozen)
+}
+
+func TestPoolEvictColdFirst(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	var mutex sync.Mutex
+	dropped := make([]string, 0)
+	renamed := make(map[string]string)
+
+	initFunc := func(ctx context.Context, testDB db.TestDatabase, templateName string) error {
+		return nil
+	}
+
+	recorder := events.NewRecorder(10)
+	cfg := PoolConfig{
+		MaxPoolSize:                 3,
+		InitialPoolSize:             3,
+		MaxPoolSizeLimit:            3,
+		MaxParallelTasks:            2,
+		TestDBNamePrefix:            "test_",
+		TestDatabaseMinimalLifetime: time.Minute,
+		DropIdleDB: func(ctx context.Context, testDB db.TestDatabase) error {
+			mutex.Lock()
+			defer mutex.Unlock()
+
+			dropped = append(dropped, testDB.Config.Database)
+			return nil
+		},
+		RenameIdleDB: func(ctx context.Context, testDB db.TestDatabase, name string) error {
+			mutex.Lock()
+			defer mutex.Unlock()
+
+			renamed[testDB.Config.Database] = name
+			return nil
+		},
+		Events: recorder,
+	}
+	p := NewPoolCollection(cfg)
+
+	t.Cleanup(func() { p.Stop() })
+
+	hash := "h1"
+	p.InitHashPool(ctx, db.Database{TemplateHash: hash, Config: db.DatabaseConfig{Database: "h1_template"}}, initFunc)
+
+	require.Eventually(t, func() bool {
+		explanation, err := p.ExplainGetTestDatabase(ctx, hash, false, nil)
+		return err == nil && explanation.Ready == 3
+	}, time.Second, 5*time.Millisecond)
+
+	// the tail is warm, 0 and 1 were never checked out
+	warm, err := p.GetTestDatabaseAtIndex(ctx, hash, 2, time.Second)
+	require.NoError(t, err)
+	require.NoError(t, p.RecreateTestDatabase(ctx, hash, warm.ID))
+
+	require.Eventually(t, func() bool {
+		explanation, err := p.ExplainGetTestDatabase(ctx, hash, false, nil)
+		return err == nil && explanation.Ready == 3
+	}, time.Second, 5*time.Millisecond)
+
+	size, err := p.Resize(ctx, hash, 1, 2)
+	require.NoError(t, err)
+	assert.Equal(t, 2, size.Total)
+
+	cold := makeDBName(cfg.TestDBNamePrefix, hash, 0)
+
+	mutex.Lock()
+	assert.Equal(t, []string{cold}, dropped, "the cold testdatabase is dropped instead of the warm tail")
+	assert.Equal(t, map[string]string{warm.Config.Database: cold}, renamed)
+	mutex.Unlock()
+
+	recent := recorder.Recent()
+	require.NotEmpty(t, recent)
+	evicted := recent[len(recent)-1]
+	assert.Equal(t, events.TypeTestDatabaseEvicted, evicted.Type)
+	assert.Equal(t, cold, evicted.Fields["dbName"])
+	assert.Equal(t, true, evicted.Fields["swapped"])
+	assert.Equal(t, evictionReasonResize, evicted.Fields["reason"])
+
+	// the kept testdatabase took over the ID of the dropped one
+	testDB, err := p.GetTestDatabaseAtIndex(ctx, hash, 0, time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, cold, testDB.Config.Database)
+
+	pool, err := p.getPool(ctx, hash)
+	require.NoError(t, err)
+	pool.RLock()
+	assert.Equal(t, 2, pool.dbs[0].checkouts)
+	pool.RUnlock()
+
+	// without any cold testdatabase left, the tail itself is dropped
+	_, err = p.GetTestDatabaseAtIndex(ctx, hash, 1, time.Second)
+	require.NoError(t, err)
+	require.NoError(t, p.ReturnTestDatabase(ctx, hash, 1))
+
+	_, err = p.Resize(ctx, hash, 1, 1)
+	require.NoError(t, err)
+
+	mutex.Lock()
+	assert.Equal(t, []string{cold, makeDBName(cfg.TestDBNamePrefix, hash, 1)}, dropped)
+	assert.Len(t, renamed, 1)
+	mutex.Unlock()
+
+	recent = recorder.Recent()
+	evicted = recent[len(recent)-1]
+	assert.Equal(t, false, evicted.Fields["swapped"])
+	assert.Equal(t, false, evicted.Fields["cold"])
+}
+
+func TestPoolResizeSingleShrinkLoop(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	initFunc := func(ctx context.Context, testDB db.TestDatabase, templateName string) error {
+		return nil
+	}
+
+	cfg := PoolConfig{
+		MaxPoolSize:                 2,
+		InitialPoolSize:             2,
+		MaxParallelTasks:            2,
+		TestDBNamePrefix:            "test_",
+		TestDatabaseMinimalLifetime: time.Minute,
+		DropIdleDB: func(ctx context.Context, testDB db.TestDatabase) error {
+			return nil
+		},
+	}
+	p := NewPoolCollection(cfg)
+
+	t.Cleanup(func() { p.Stop() })
+
+	hash := "h1"
+	p.InitHashPool(ctx, db.Database{TemplateHash: hash, Config: db.DatabaseConfig{Database: "h1_template"}}, initFunc)
+
+	require.Eventually(t, func() bool {
+		explanation, err := p.ExplainGetTestDatabase(ctx, hash, false, nil)
+		return err == nil && explanation.Ready == 2
+	}, time.Second, 5*time.Millisecond)
+
+	checkedOut, err := p.GetTestDatabaseAtIndex(ctx, hash, 1, time.Second)
+	require.NoError(t, err)
+
+	pool, err := p.getPool(ctx, hash)
+	require.NoError(t, err)
+
+	// resizing repeatedly while the tail is checked out starts a single loop only
+	for i := 0; i < 3; i++ {
+		size, err := p.Resize(ctx, hash, 1, 1)
+		require.NoError(t, err)
+		assert.Equal(t, 2, size.Total)
+
+		pool.RLock()
+		assert.True(t, pool.shrinking)
+		pool.RUnlock()
+	}
+
+	require.NoError(t, p.ReturnTestDatabase(ctx, hash, checkedOut.ID))
+
+	require.Eventually(t, func() bool {
+		pool.RLock()
+		defer pool.RUnlock()
+
+		return len(pool.dbs) == 1 && !pool.shrinking
+	}, time.Second, 5*time.Millisecond)
+}
+
+func TestPoolEvictUnlocked(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	initFunc := func(ctx context.Context, testDB db.TestDatabase, templateName string) error {
+		return nil
+	}
+
+	dropping := make(chan string, 1)
+	release := make(chan struct{})
+
+	cfg := PoolConfig{
+		MaxPoolSize:                 3,
+		InitialPoolSize:             3,
+		MaxParallelTasks:            2,
+		TestDBNamePrefix:            "test_",
+		TestDatabaseMinimalLifetime: time.Minute,
+		DropIdleDB: func(ctx context.Context, testDB db.TestDatabase) error {
+			dropping <- testDB.Config.Database
+			<-release
+			return nil
+		},
+	}
+	p := NewPoolCollection(cfg)
+
+	t.Cleanup(func() { p.Stop() })
+
+	hash := "h1"
+	p.InitHashPool(ctx, db.Database{TemplateHash: hash, Config: db.DatabaseConfig{Database: "h1_template"}}, initFunc)
+
+	require.Eventually(t, func() bool {
+		explanation, err := p.ExplainGetTestDatabase(ctx, hash, false, nil)
+		return err == nil && explanation.Ready == 3
+	}, time.Second, 5*time.Millisecond)
+
+	resized := make(chan PoolSize, 1)
+	go func() {
+		size, err := p.Resize(ctx, hash, 2, 2)
+		assert.NoError(t, err)
+		resized <- size
+	}()
+
+	assert.Equal(t, makeDBName(cfg.TestDBNamePrefix, hash, 2), <-dropping)
+
+	// the pool isn't locked while the tail is dropped
+	testDB, err := p.GetTestDatabase(ctx, hash, 100*time.Millisecond)
+	require.NoError(t, err)
+	assert.NotEqual(t, 2, testDB.ID)
+	require.NoError(t, p.ReturnTestDatabase(ctx, hash, testDB.ID))
+
+	assert.Equal(t, "dropping", p.TestDatabaseStates(ctx)[makeDBName(cfg.TestDBNamePrefix, hash, 2)])
+
+	close(release)
+
+	size := <-resized
+	assert.Equal(t, 2, size.Total)
+}
@@ -0,0 +1,195 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/trace"
+	"time"
+)
+
+var ErrInvalidPoolSize = errors.New("invalid pool size")
+
+const (
+	workerTaskShrinkToMax = "SHRINK_TO_MAX" // only used for naming supervised tasks, never pushed to the tasksChan
+
+	shrinkToMaxInterval = 100 * time.Millisecond
+)
+
+// PoolSize describes the sizes of a pool, see Resize.
+type PoolSize struct { //nolint:revive
+	InitialPoolSize  int `json:"initialPoolSize"`
+	MaxPoolSize      int `json:"maxPoolSize"`
+	MaxPoolSizeLimit int `json:"maxPoolSizeLimit"` // upper bound of growing the MaxPoolSize, fixed with the creation of the pool
+	Total            int `json:"total"`            // current number of testdatabases (besides overflow ones), beyond the MaxPoolSize while shrinking
+}
+
+// Resize changes the InitialPoolSize and MaxPoolSize of the running pool. The MaxPoolSize can't exceed the
+// MaxPoolSizeLimit. Growing the InitialPoolSize extends the pool in background right away, growing the MaxPoolSize
+// allows extending it on demand. Shrinking the MaxPoolSize evicts the testdatabases beyond it via DropIdleDB (highest
+// IDs first, as soon as they are ready again if they are checked out currently), they are kept if it's nil.
+func (pool *HashPool) Resize(ctx context.Context, initialPoolSize int, maxPoolSize int) (PoolSize, error) {
+
+	log := pool.getPoolLogger(ctx, "Resize").With().Int("initialPoolSize", initialPoolSize).Int("maxPoolSize", maxPoolSize).Logger()
+
+	if maxPoolSize < 1 || maxPoolSize > pool.MaxPoolSizeLimit {
+		return PoolSize{}, fmt.Errorf("%w: max pool size %d is not within 1 and the limit of %d", ErrInvalidPoolSize, maxPoolSize, pool.MaxPoolSizeLimit)
+	}
+
+	if initialPoolSize < 0 || initialPoolSize > maxPoolSize {
+		return PoolSize{}, fmt.Errorf("%w: initial pool size %d is not within 0 and the max pool size of %d", ErrInvalidPoolSize, initialPoolSize, maxPoolSize)
+	}
+
+	pool.Lock()
+
+	pool.InitialPoolSize = initialPoolSize
+	pool.MaxPoolSize = maxPoolSize
+
+	if pool.running {
+		// see Start, testdatabases currently extended are already appended
+		for i := len(pool.dbs); i < pool.InitialPoolSize; i++ {
+			pool.tasksChan <- workerTaskExtend
+		}
+
+		if len(pool.dbs) < pool.InitialPoolSize && pool.fill == FillStatusCompleted {
+			pool.fill = FillStatusRunning
+		}
+	}
+
+	shrink := len(pool.dbs) > pool.MaxPoolSize && pool.DropIdleDB != nil
+	size := pool.unsafePoolSize()
+
+	pool.unsafeTraceLogStats(log)
+	pool.Unlock()
+
+	log.Info().Msg("resized")
+
+	if !shrink {
+		return size, nil
+	}
+
+	if _, err := pool.shrinkToMax(ctx); err != nil {
+		return size, err
+	}
+
+	// checked out testdatabases beyond the max are evicted in background as soon as they are ready again
+	if size = pool.Size(); size.Total > size.MaxPoolSize {
+		pool.startShrinkToMaxLoop()
+	}
+
+	return size, nil
+}
+
+// startShrinkToMaxLoop starts the shrinkToMaxLoop unless it's already running (e.g. after resizing repeatedly while the
+// testdatabases beyond the max are checked out).
+func (pool *HashPool) startShrinkToMaxLoop() {
+	pool.Lock()
+	defer pool.Unlock()
+
+	if pool.shrinking {
+		return
+	}
+
+	pool.shrinking = pool.supervisor.Go(workerTaskShrinkToMax, func(ctx context.Context) error {
+		defer func() {
+			pool.Lock()
+			pool.shrinking = false
+			pool.Unlock()
+		}()
+
+		return pool.shrinkToMaxLoop(ctx)
+	})
+}
+
+// Size returns the current sizes of the pool.
+func (pool *HashPool) Size() PoolSize {
+	pool.RLock()
+	defer pool.RUnlock()
+
+	return pool.unsafePoolSize()
+}
+
+// Attention: pool should be read or write locked!
+func (pool *HashPool) unsafePoolSize() PoolSize {
+	return PoolSize{
+		InitialPoolSize:  pool.InitialPoolSize,
+		MaxPoolSize:      pool.MaxPoolSize,
+		MaxPoolSizeLimit: pool.MaxPoolSizeLimit,
+		Total:            len(pool.dbs),
+	}
+}
+
+// shrinkToMaxLoop periodically evicts the testdatabases beyond the MaxPoolSize until none is left or the ctx is done.
+func (pool *HashPool) shrinkToMaxLoop(ctx context.Context) error {
+	ticker := time.NewTicker(shrinkToMaxInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			done, err := pool.shrinkToMax(ctx)
+			if err != nil {
+				pool.supervisor.Report(workerTaskShrinkToMax, err)
+			}
+
+			if done {
+				return nil
+			}
+		}
+	}
+}
+
+// shrinkToMax drops the ready testdatabases beyond the MaxPoolSize via DropIdleDB like evictIdle (never checked out
+// ones first, see evict), stopping at the first one still in use. Returns true if no testdatabase is left beyond the
+// MaxPoolSize.
+func (pool *HashPool) shrinkToMax(ctx context.Context) (bool, error) {
+
+	log := pool.getPoolLogger(ctx, "shrinkToMax")
+
+	reg := trace.StartRegion(ctx, "worker_wait_for_lock_hash_pool")
+	pool.Lock()
+	reg.End()
+
+	claims := make([]evictionClaim, 0)
+	for len(pool.dbs)-len(claims) > pool.MaxPoolSize {
+		id := len(pool.dbs) - 1 - len(claims)
+		testDB := pool.dbs[id]
+
+		if testDB.state != dbStateReady {
+			break
+		}
+
+		// the testdatabase might have just been taken from the ready channel by GetTestDatabase (waiting for the lock), keep it then
+		if !pool.excludeIDFromChannel(pool.ready, id) {
+			break
+		}
+
+		claims = append(claims, pool.unsafeClaimEviction(id, evictionReasonResize))
+	}
+
+	pool.Unlock()
+
+	evictions, err := pool.evictClaims(ctx, claims)
+	pool.emitEvictions(evictions)
+
+	pool.Lock()
+	defer pool.Unlock()
+
+	if len(evictions) > 0 {
+		evicted := make([]int, 0, len(evictions))
+		for _, e := range evictions {
+			evicted = append(evicted, e.id)
+		}
+
+		log.Debug().Ints("ids", evicted).Int("maxPoolSize", pool.MaxPoolSize).Msg("evicted testdatabases beyond the max pool size")
+		pool.unsafeTraceLogStats(log)
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	return len(pool.dbs) <= pool.MaxPoolSize, nil
+}
@@ -0,0 +1,103 @@
+package pool
+
+import (
+	"errors"
+	"fmt"
+)
+
+var ErrInvalidSelectionPolicy = errors.New("invalid selection policy")
+
+// SelectionPolicy defines which of the ready testdatabases is handed out by GetTestDatabase. Rotating through all of
+// them spreads the catalog bloat (and the vacuum work cleaning it up) evenly instead of always hammering the same OIDs.
+type SelectionPolicy string
+
+const (
+	SelectionLRU        SelectionPolicy = "lru"         // least recently recreated first (default), returned testdatabases keep their recreation time
+	SelectionMRU        SelectionPolicy = "mru"         // most recently recreated first, favoring a small set of warm testdatabases
+	SelectionRoundRobin SelectionPolicy = "round-robin" // ascending IDs, continuing after the last handed out one
+)
+
+// ParseSelectionPolicy returns the policy, empty defaults to SelectionLRU.
+func ParseSelectionPolicy(s string) (SelectionPolicy, error) {
+	switch policy := SelectionPolicy(s); policy {
+	case "":
+		return SelectionLRU, nil
+	case SelectionLRU, SelectionMRU, SelectionRoundRobin:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("%w: %q", ErrInvalidSelectionPolicy, s)
+	}
+}
+
+// selectReady returns the ready testdatabase preferred by the SelectionPolicy, the received one (the head of the ready
+// set) is put back if another one is preferred. Concurrent acquisitions may hold further ready testdatabases meanwhile,
+// they are not part of the candidates then. Sharded pools prefer the server by the ShardRouting first.
+func (pool *HashPool) selectReady(received int) int {
+	pool.Lock()
+	defer pool.Unlock()
+
+	// the ready set in FIFO order
+	candidates := []int{received}
+	for loop := true; loop; {
+		select {
+		case id := <-pool.ready:
+			candidates = append(candidates, id)
+		default:
+			loop = false
+		}
+	}
+
+	var ranks []int
+	if pool.sharded() {
+		ranks = pool.unsafeShardRanks()
+	}
+
+	selected := 0
+	for i, id := range candidates {
+		if ranks != nil {
+			a, b := ranks[ShardOf(id, len(ranks))], ranks[ShardOf(candidates[selected], len(ranks))]
+			if a != b {
+				if a < b {
+					selected = i
+				}
+				continue
+			}
+		}
+
+		if pool.unsafePrefers(id, candidates[selected]) {
+			selected = i
+		}
+	}
+
+	for i, id := range candidates {
+		if i != selected {
+			pool.ready <- id
+		}
+	}
+
+	pool.lastSelectedID = candidates[selected]
+
+	return candidates[selected]
+}
+
+// unsafePrefers returns true if the testdatabase a is preferred over b (ties keep b, thus the FIFO order).
+// Attention: pool should be read or write locked!
+func (pool *HashPool) unsafePrefers(a int, b int) bool {
+	switch pool.SelectionPolicy {
+	case SelectionMRU:
+		return pool.dbs[a].recreatedAt.After(pool.dbs[b].recreatedAt)
+	case SelectionLRU, "":
+		// not the FIFO order: returned (or unlocked) testdatabases are queued up again without being recreated
+		return pool.dbs[a].recreatedAt.Before(pool.dbs[b].recreatedAt)
+	case SelectionRoundRobin:
+		// IDs after the last selected one come first, the others wrap around
+		aNext, bNext := a > pool.lastSelectedID, b > pool.lastSelectedID
+		if aNext != bNext {
+			return aNext
+		}
+
+		return a < b
+	default:
+		return false
+	}
+}
@@ -0,0 +1,135 @@
+package pool
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/allaboutapps/integresql/pkg/db"
+)
+
+var ErrInvalidShardRouting = errors.New("invalid shard routing")
+
+// ShardRouting defines which of the database servers (see PoolConfig.Shards) the ready testdatabase handed out by
+// GetTestDatabase is preferably located on, spreading the IO of parallel clients across all of them.
+type ShardRouting string
+
+const (
+	ShardRoutingRoundRobin  ShardRouting = "round-robin"  // the servers in turn, continuing after the last handed out one (default)
+	ShardRoutingLeastLoaded ShardRouting = "least-loaded" // the server with the fewest checked out testdatabases
+)
+
+// ParseShardRouting returns the routing, empty defaults to ShardRoutingRoundRobin.
+func ParseShardRouting(s string) (ShardRouting, error) {
+	switch routing := ShardRouting(s); routing {
+	case "":
+		return ShardRoutingRoundRobin, nil
+	case ShardRoutingRoundRobin, ShardRoutingLeastLoaded:
+		return routing, nil
+	default:
+		return "", fmt.Errorf("%w: %q", ErrInvalidShardRouting, s)
+	}
+}
+
+// ShardOf returns the index of the server (see PoolConfig.Shards) the testdatabase with the ID is located on, the
+// testdatabases are striped across all servers by their ID.
+func ShardOf(id int, shards int) int {
+	if shards <= 1 {
+		return 0
+	}
+
+	return id % shards
+}
+
+// ShardStats describes the testdatabases of the pool located on one of the servers.
+type ShardStats struct {
+	Host       string `json:"host"`
+	Ready      int    `json:"ready"`
+	CheckedOut int    `json:"checkedOut"`
+	Total      int    `json:"total"`
+}
+
+// sharded returns true if the testdatabases of the pool are spread across multiple servers.
+func (pool *HashPool) sharded() bool {
+	return len(pool.Shards) > 1
+}
+
+// testDBConfig returns the config of the testdatabase with the ID, located on its server (or the one the pool is
+// moved to, see MoveTo).
+func (pool *HashPool) testDBConfig(id int) db.DatabaseConfig {
+	config := pool.templateDB.Config
+
+	if pool.server != nil {
+		config.Host = pool.server.Host
+		config.Port = pool.server.Port
+		config.Username = pool.server.Username
+		config.Password = pool.server.Password
+	} else if pool.sharded() {
+		shard := pool.Shards[ShardOf(id, len(pool.Shards))]
+		config.Host = shard.Host
+		config.Port = shard.Port
+		config.Username = shard.Username
+		config.Password = shard.Password
+	}
+
+	config.Database = makeDBName(pool.TestDBNamePrefix, pool.templateDB.TemplateHash, id)
+
+	return config
+}
+
+// unsafeShardRanks returns the rank of each server for the next acquisition by the ShardRouting, lower first.
+// Attention: pool should be read or write locked!
+func (pool *HashPool) unsafeShardRanks() []int {
+	ranks := make([]int, len(pool.Shards))
+
+	switch pool.ShardRouting {
+	case ShardRoutingLeastLoaded:
+		for _, testDB := range pool.dbs {
+			if !testDB.checkedOutAt.IsZero() {
+				ranks[ShardOf(testDB.ID, len(pool.Shards))]++
+			}
+		}
+	default:
+		// the servers after the one of the last selected testdatabase come first, the others wrap around
+		last := -1
+		if pool.lastSelectedID >= 0 {
+			last = ShardOf(pool.lastSelectedID, len(pool.Shards))
+		}
+
+		for shard := range ranks {
+			ranks[shard] = (shard - last - 1 + len(ranks)) % len(ranks)
+		}
+	}
+
+	return ranks
+}
+
+// shardStats returns the testdatabases of the pool per server, nil if the pool is not sharded.
+func (pool *HashPool) shardStats() []ShardStats {
+	if !pool.sharded() {
+		return nil
+	}
+
+	pool.RLock()
+	defer pool.RUnlock()
+
+	stats := make([]ShardStats, len(pool.Shards))
+	for i, shard := range pool.Shards {
+		stats[i].Host = net.JoinHostPort(shard.Host, strconv.Itoa(shard.Port))
+	}
+
+	for _, testDB := range pool.dbs {
+		s := &stats[ShardOf(testDB.ID, len(pool.Shards))]
+		s.Total++
+
+		if testDB.state == dbStateReady {
+			s.Ready++
+		}
+		if !testDB.checkedOutAt.IsZero() {
+			s.CheckedOut++
+		}
+	}
+
+	return stats
+}
@@ -0,0 +1,128 @@
+package pool
+
+import (
+	"context"
+	"time"
+
+	"github.com/allaboutapps/integresql/pkg/db"
+)
+
+// GetTestDatabaseSkipClean is a variant of GetTestDatabase for clients resetting the testdatabase themselves.
+// It prefers handing out a dirty testdatabase as-is (without recreating it), flagged via TestDatabase.Dirty.
+// Only dirty testdatabases waiting to be auto-cleaned (beyond their TestDatabaseMinimalLifetime) and, if InUseDB is
+// set, without any connections left are considered. Otherwise waits for a ready testdatabase like GetTestDatabase.
+func (pool *HashPool) GetTestDatabaseSkipClean(ctx context.Context, timeout time.Duration) (db.TestDatabase, error) {
+	waitStart := time.Now()
+
+	if testDB, ok := pool.getDirtyTestDatabase(ctx); ok {
+		pool.latencies.readyWait.Record(time.Since(waitStart))
+		return testDB, nil
+	}
+
+	return pool.GetTestDatabase(ctx, timeout)
+}
+
+// getDirtyTestDatabase checks out the oldest dirty testdatabase eligible for auto-cleaning as-is.
+// Returns false if there is none.
+func (pool *HashPool) getDirtyTestDatabase(ctx context.Context) (db.TestDatabase, bool) {
+
+	log := pool.getPoolLogger(ctx, "getDirtyTestDatabase")
+
+	skipped := make(map[int]bool)
+
+	for {
+		id, ok := pool.claimDirty(skipped)
+		if !ok {
+			return db.TestDatabase{}, false
+		}
+
+		log := log.With().Int("id", id).Logger()
+
+		inUse := false
+		if pool.InUseDB != nil {
+			pool.RLock()
+			testDB := pool.dbs[id].TestDatabase
+			pool.RUnlock()
+
+			var err error
+			inUse, err = pool.InUseDB(ctx, testDB)
+			if err != nil {
+				log.Warn().Err(err).Msg("checking connections failed, skipping")
+				inUse = true
+			}
+		}
+
+		pool.Lock()
+
+		if inUse {
+			// the previous client might still work with it, leave it to the auto cleaning
+			pool.dbs[id].state = dbStateDirty
+			pool.dirty <- id
+			pool.Unlock()
+
+			log.Debug().Msg("dirty testdatabase still in use, skipping")
+			skipped[id] = true
+			continue
+		}
+
+		testDB := pool.dbs[id]
+		testDB.state = dbStateDirty
+		testDB.checkedOutAt = time.Now()
+		testDB.checkedOutBy = holderFromContext(ctx)
+		testDB.lastUsedAt = testDB.checkedOutAt
+		testDB.checkouts++
+		pool.lastActivity = testDB.checkedOutAt
+		pool.unsafeStartLease(ctx, &testDB)
+
+		pool.dbs[id] = testDB
+		pool.dirty <- id
+		pool.skipCleanCheckouts++
+
+		log.Debug().Uint("generation", testDB.generation).Msg("got dirty testdatabase")
+		pool.unsafeTraceLogStats(log)
+
+		pool.Unlock()
+
+		testDB.Dirty = true
+		return testDB.TestDatabase, true
+	}
+}
+
+// claimDirty takes the oldest eligible (not skipped) testdatabase from the dirty channel and flags it as claimed,
+// so neither the auto cleaning nor returns of the previous client interfere while it's being checked.
+func (pool *HashPool) claimDirty(skipped map[int]bool) (int, bool) {
+	pool.Lock()
+	defer pool.Unlock()
+
+	now := time.Now()
+	claimed := -1
+
+	// the dirty channel is FIFO, keep the order of all other IDs
+drain:
+	for i, n := 0, len(pool.dirty); i < n; i++ {
+		var id int
+		select {
+		case id = <-pool.dirty:
+		default:
+			// concurrently taken by the auto cleaning
+			break drain
+		}
+
+		if claimed < 0 && !skipped[id] && id >= 0 && id < len(pool.dbs) &&
+			pool.dbs[id].state == dbStateDirty && !now.Before(pool.dbs[id].blockAutoCleanDirtyUntil) &&
+			!pool.unsafeMoving(pool.dbs[id]) {
+			claimed = id
+			continue
+		}
+
+		pool.dirty <- id
+	}
+
+	if claimed < 0 {
+		return 0, false
+	}
+
+	pool.dbs[claimed].state = dbStateClaimed
+
+	return claimed, true
+}
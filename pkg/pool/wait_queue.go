@@ -0,0 +1,224 @@
+package pool
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/allaboutapps/integresql/pkg/events"
+)
+
+const (
+	workerTaskStarvationCheck = "STARVATION_CHECK" // only used for naming supervised tasks, never pushed to the tasksChan
+
+	starvationCheckInterval = time.Second
+	minStarvationWait       = time.Second // waiters are never flagged starving before, regardless of the median
+)
+
+// Waiter is a client currently waiting for a ready testdatabase of the pool.
+type Waiter struct {
+	Holder       string    `json:"holder,omitempty"` // empty if unknown (see WithHolder)
+	WaitingSince time.Time `json:"waitingSince"`
+	WaitedMs     int64     `json:"waitedMs"`
+	Starving     bool      `json:"starving"` // waited WaitStarvationFactor times longer than the median waiter
+}
+
+// WaitQueueStats describes the fairness of handing out ready testdatabases to the waiting clients.
+type WaitQueueStats struct {
+	Waiting      int      `json:"waiting"`
+	MedianWaitMs int64    `json:"medianWaitMs"`
+	MaxWaitMs    int64    `json:"maxWaitMs"`
+	Starving     int      `json:"starving"`
+	Waiters      []Waiter `json:"waiters,omitempty"` // longest waiting first
+
+	// number of waiters flagged starving in total
+	StarvationsDetected int `json:"starvationsDetected"`
+}
+
+type waiter struct {
+	holder   string
+	since    time.Time
+	starving bool
+}
+
+// waitQueue tracks the clients currently waiting within GetTestDatabase.
+type waitQueue struct {
+	waiters    map[uint64]*waiter
+	nextID     uint64
+	starvation int // number of waiters flagged starving in total
+	mutex      sync.Mutex
+}
+
+func newWaitQueue() *waitQueue {
+	return &waitQueue{
+		waiters: make(map[uint64]*waiter),
+	}
+}
+
+// Enter registers a waiter, it must Leave as soon as it stops waiting.
+func (q *waitQueue) Enter(holder string) uint64 {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	id := q.nextID
+	q.nextID++
+	q.waiters[id] = &waiter{holder: holder, since: time.Now()}
+
+	return id
+}
+
+func (q *waitQueue) Leave(id uint64) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	delete(q.waiters, id)
+}
+
+// Stats returns the current waiters, longest waiting first.
+func (q *waitQueue) Stats(now time.Time) WaitQueueStats {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	stats := WaitQueueStats{
+		Waiting:             len(q.waiters),
+		StarvationsDetected: q.starvation,
+	}
+
+	if len(q.waiters) == 0 {
+		return stats
+	}
+
+	stats.Waiters = make([]Waiter, 0, len(q.waiters))
+	for _, w := range q.waiters {
+		stats.Waiters = append(stats.Waiters, Waiter{
+			Holder:       w.holder,
+			WaitingSince: w.since,
+			WaitedMs:     now.Sub(w.since).Milliseconds(),
+			Starving:     w.starving,
+		})
+
+		if w.starving {
+			stats.Starving++
+		}
+	}
+
+	sort.Slice(stats.Waiters, func(i, j int) bool { return stats.Waiters[i].WaitingSince.Before(stats.Waiters[j].WaitingSince) })
+
+	stats.MaxWaitMs = stats.Waiters[0].WaitedMs
+	stats.MedianWaitMs = q.unsafeMedianWait(now).Milliseconds()
+
+	return stats
+}
+
+// DetectStarving flags the waiters waiting factor times longer than the median waiter (at least minStarvationWait),
+// each waiter is only returned once. At least two clients must be waiting.
+func (q *waitQueue) DetectStarving(now time.Time, factor int) (starving []Waiter, median time.Duration, waiting int) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if len(q.waiters) < 2 {
+		return nil, 0, len(q.waiters)
+	}
+
+	median = q.unsafeMedianWait(now)
+
+	threshold := median * time.Duration(factor)
+	if threshold < minStarvationWait {
+		threshold = minStarvationWait
+	}
+
+	for _, w := range q.waiters {
+		waited := now.Sub(w.since)
+		if w.starving || waited < threshold {
+			continue
+		}
+
+		w.starving = true
+		q.starvation++
+		starving = append(starving, Waiter{Holder: w.holder, WaitingSince: w.since, WaitedMs: waited.Milliseconds(), Starving: true})
+	}
+
+	return starving, median, len(q.waiters)
+}
+
+func (q *waitQueue) unsafeMedianWait(now time.Time) time.Duration {
+	waits := make([]time.Duration, 0, len(q.waiters))
+	for _, w := range q.waiters {
+		waits = append(waits, now.Sub(w.since))
+	}
+
+	sort.Slice(waits, func(i, j int) bool { return waits[i] < waits[j] })
+
+	mid := len(waits) / 2
+	if len(waits)%2 == 0 {
+		return (waits[mid-1] + waits[mid]) / 2
+	}
+
+	return waits[mid]
+}
+
+// starvationCheckLoop periodically flags starving waiters (see WaitStarvationFactor) until the ctx is done.
+func (pool *HashPool) starvationCheckLoop(ctx context.Context) error {
+	ticker := time.NewTicker(starvationCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case now := <-ticker.C:
+			pool.checkStarvation(ctx, now)
+		}
+	}
+}
+
+// checkStarvation emits an event for each newly starving waiter, suggesting how to relieve the pool.
+func (pool *HashPool) checkStarvation(ctx context.Context, now time.Time) {
+	starving, median, waiting := pool.waiters.DetectStarving(now, pool.WaitStarvationFactor)
+	if len(starving) == 0 {
+		return
+	}
+
+	log := pool.getPoolLogger(ctx, "checkStarvation")
+
+	suggestions := pool.starvationSuggestions()
+
+	for _, w := range starving {
+		log.Warn().Str("holder", w.Holder).Int64("waitedMs", w.WaitedMs).Dur("medianWait", median).Int("waiting", waiting).Msg("starving waiter detected")
+
+		pool.Events.Emit(events.Event{
+			Type:    events.TypeWaitStarvation,
+			Hash:    pool.templateDB.TemplateHash,
+			Message: fmt.Sprintf("client %q waits %dms for a test database, the median of the %d waiting clients is %dms", w.Holder, w.WaitedMs, waiting, median.Milliseconds()),
+			Fields: map[string]interface{}{
+				"holder":       w.Holder,
+				"waitedMs":     w.WaitedMs,
+				"medianWaitMs": median.Milliseconds(),
+				"waiting":      waiting,
+				"suggestions":  suggestions,
+			},
+		})
+	}
+}
+
+func (pool *HashPool) starvationSuggestions() []string {
+	pool.RLock()
+	size := len(pool.dbs)
+	initialPoolSize, maxPoolSize := pool.InitialPoolSize, pool.MaxPoolSize
+	pool.RUnlock()
+
+	suggestions := make([]string, 0, 3)
+	if maxPoolSize > 0 && size >= maxPoolSize {
+		suggestions = append(suggestions, fmt.Sprintf("raise the max pool size (%d test databases exist already)", size))
+	}
+	if initialPoolSize < maxPoolSize {
+		suggestions = append(suggestions, fmt.Sprintf("raise the initial pool size (%d) to prewarm more test databases", initialPoolSize))
+	}
+	if pool.MaxOverflowSize == 0 {
+		suggestions = append(suggestions, "allow overflow test databases while the pool is exhausted")
+	}
+
+	return suggestions
+}
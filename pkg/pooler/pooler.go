@@ -0,0 +1,219 @@
+// Package pooler renders the database sections of a connection pooler (PgBouncer or pgcat) running as sidecar, routing
+// friendly aliases to the currently checked out test databases. Clients with expensive connection establishment connect
+// to the pooler using the alias (see Alias) as database name instead of connecting to the test database directly.
+package pooler
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/allaboutapps/integresql/pkg/db"
+
+	// the admin console of the pooler is reached via the postgres wire protocol
+	_ "github.com/lib/pq"
+)
+
+var ErrUnknownKind = errors.New("unknown pooler kind")
+
+type Kind string
+
+const (
+	KindPgBouncer Kind = "pgbouncer" // [databases] section, typically included via "%include <File>" within pgbouncer.ini
+	KindPgcat     Kind = "pgcat"     // [pools.<alias>] tables, the [general] section must be part of the BaseFile
+)
+
+type Config struct {
+	Kind     Kind
+	File     string // the rendered config is written to this file (empty disables the config generation)
+	BaseFile string // optional file prepended verbatim to the rendered config (e.g. the [general] section of pgcat)
+
+	// Admin console of the pooler (e.g. "host=127.0.0.1 port=6432 user=pgbouncer dbname=pgbouncer"), receiving a RELOAD
+	// after each change of the config (empty disables hot-reloading)
+	ReloadDSN string `json:"-"` // sensitive
+
+	PoolMode string // pool_mode of each alias: "session", "transaction" or "statement"
+	PoolSize int    // pool size of each alias
+}
+
+// Enabled returns true if the config generation is enabled.
+func (c Config) Enabled() bool {
+	return len(c.File) > 0
+}
+
+// Entry maps an alias to the database the pooler connects to.
+type Entry struct {
+	Alias  string
+	Config db.DatabaseConfig
+}
+
+// Alias returns the friendly name of the test database within the pooler: "<hash>_<id>".
+func Alias(testDB db.TestDatabase) string {
+	return fmt.Sprintf("%s_%d", testDB.TemplateHash, testDB.ID)
+}
+
+// Render renders the database sections of the pooler for the given entries (sorted by alias).
+func Render(config Config, entries []Entry) ([]byte, error) {
+	sorted := append([]Entry{}, entries...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Alias < sorted[j].Alias })
+
+	var b bytes.Buffer
+	b.WriteString("# generated by integresql, manual changes are overwritten\n")
+
+	switch config.Kind {
+	case KindPgBouncer:
+		renderPgBouncer(&b, config, sorted)
+	case KindPgcat:
+		renderPgcat(&b, config, sorted)
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownKind, config.Kind)
+	}
+
+	return b.Bytes(), nil
+}
+
+func renderPgBouncer(b *bytes.Buffer, config Config, entries []Entry) {
+	b.WriteString("[databases]\n")
+
+	for _, entry := range entries {
+		fmt.Fprintf(b, "%s = host=%s port=%d dbname=%s user=%s password=%s pool_mode=%s pool_size=%d\n",
+			entry.Alias,
+			quotePgBouncer(entry.Config.Host),
+			entry.Config.Port,
+			quotePgBouncer(entry.Config.Database),
+			quotePgBouncer(entry.Config.Username),
+			quotePgBouncer(entry.Config.Password),
+			config.PoolMode,
+			config.PoolSize,
+		)
+	}
+}
+
+func renderPgcat(b *bytes.Buffer, config Config, entries []Entry) {
+	for _, entry := range entries {
+		alias := strconv.Quote(entry.Alias)
+
+		fmt.Fprintf(b, "\n[pools.%s]\npool_mode = %s\n", alias, strconv.Quote(config.PoolMode))
+		fmt.Fprintf(b, "\n[pools.%s.users.0]\nusername = %s\npassword = %s\npool_size = %d\n",
+			alias, strconv.Quote(entry.Config.Username), strconv.Quote(entry.Config.Password), config.PoolSize)
+		fmt.Fprintf(b, "\n[pools.%s.shards.0]\nservers = [[%s, %d, \"primary\"]]\ndatabase = %s\n",
+			alias, strconv.Quote(entry.Config.Host), entry.Config.Port, strconv.Quote(entry.Config.Database))
+	}
+}
+
+// quotePgBouncer quotes the value of a connection string parameter of PgBouncer (libpq syntax).
+func quotePgBouncer(value string) string {
+	if len(value) > 0 && !strings.ContainsAny(value, " '\\") {
+		return value
+	}
+
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value) + "'"
+}
+
+// Syncer keeps the config file of the pooler in sync with the given entries.
+type Syncer struct {
+	config Config
+	last   []byte // last written config, nil before the first sync
+	mutex  sync.Mutex
+}
+
+func NewSyncer(config Config) (*Syncer, error) {
+	if _, err := Render(config, nil); err != nil {
+		return nil, err
+	}
+
+	return &Syncer{config: config}, nil
+}
+
+// Sync renders the config for the entries and, if it changed, writes the file and reloads the pooler.
+// Returns true if the config changed.
+func (s *Syncer) Sync(ctx context.Context, entries []Entry) (bool, error) {
+	rendered, err := Render(s.config, entries)
+	if err != nil {
+		return false, err
+	}
+
+	// concurrent syncs are serialized, so the file never goes back to an older state
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.last != nil && bytes.Equal(s.last, rendered) {
+		return false, nil
+	}
+
+	if err := s.write(rendered); err != nil {
+		return false, err
+	}
+
+	if len(s.config.ReloadDSN) > 0 {
+		if err := s.reload(ctx); err != nil {
+			// retried by the next sync
+			return true, err
+		}
+	}
+
+	s.last = rendered
+
+	return true, nil
+}
+
+// write replaces the config file atomically, the pooler never reads a partially written file.
+func (s *Syncer) write(rendered []byte) error {
+	var content []byte
+
+	if len(s.config.BaseFile) > 0 {
+		base, err := os.ReadFile(s.config.BaseFile)
+		if err != nil {
+			return fmt.Errorf("failed to read the base config of the pooler: %w", err)
+		}
+
+		content = append(append(base, '\n'), rendered...)
+	} else {
+		content = rendered
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.config.File), ".integresql-pooler-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	// readable by the sidecar via a shared group (e.g. the fsGroup of a Kubernetes pod), it contains credentials
+	if err := os.Chmod(tmp.Name(), 0o640); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), s.config.File)
+}
+
+func (s *Syncer) reload(ctx context.Context) error {
+	conn, err := sql.Open("postgres", s.config.ReloadDSN)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// the admin consoles only support the simple query protocol, which is used for statements without arguments
+	if _, err := conn.ExecContext(ctx, "RELOAD"); err != nil {
+		return fmt.Errorf("failed to reload the pooler: %w", err)
+	}
+
+	return nil
+}
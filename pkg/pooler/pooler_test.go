@@ -0,0 +1,114 @@
+package pooler_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/allaboutapps/integresql/pkg/db"
+	"github.com/allaboutapps/integresql/pkg/pooler"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testEntry(alias string, database string) pooler.Entry {
+	return pooler.Entry{
+		Alias: alias,
+		Config: db.DatabaseConfig{
+			Host:     "postgres",
+			Port:     5432,
+			Username: "dbuser",
+			Password: "pass word",
+			Database: database,
+		},
+	}
+}
+
+func TestAlias(t *testing.T) {
+	testDB := db.TestDatabase{Database: db.Database{TemplateHash: "abc"}, ID: 3}
+	assert.Equal(t, "abc_3", pooler.Alias(testDB))
+}
+
+func TestRenderPgBouncer(t *testing.T) {
+	config := pooler.Config{Kind: pooler.KindPgBouncer, PoolMode: "transaction", PoolSize: 2}
+
+	rendered, err := pooler.Render(config, []pooler.Entry{
+		testEntry("abc_1", "integresql_test_abc_001"),
+		testEntry("abc_0", "integresql_test_abc_000"),
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, `# generated by integresql, manual changes are overwritten
+[databases]
+abc_0 = host=postgres port=5432 dbname=integresql_test_abc_000 user=dbuser password='pass word' pool_mode=transaction pool_size=2
+abc_1 = host=postgres port=5432 dbname=integresql_test_abc_001 user=dbuser password='pass word' pool_mode=transaction pool_size=2
+`, string(rendered))
+}
+
+func TestRenderPgcat(t *testing.T) {
+	config := pooler.Config{Kind: pooler.KindPgcat, PoolMode: "session", PoolSize: 5}
+
+	rendered, err := pooler.Render(config, []pooler.Entry{testEntry("abc_0", "integresql_test_abc_000")})
+	require.NoError(t, err)
+
+	assert.Equal(t, `# generated by integresql, manual changes are overwritten
+
+[pools."abc_0"]
+pool_mode = "session"
+
+[pools."abc_0".users.0]
+username = "dbuser"
+password = "pass word"
+pool_size = 5
+
+[pools."abc_0".shards.0]
+servers = [["postgres", 5432, "primary"]]
+database = "integresql_test_abc_000"
+`, string(rendered))
+}
+
+func TestRenderUnknownKind(t *testing.T) {
+	_, err := pooler.Render(pooler.Config{Kind: "pgpool"}, nil)
+	assert.ErrorIs(t, err, pooler.ErrUnknownKind)
+
+	_, err = pooler.NewSyncer(pooler.Config{Kind: "pgpool", File: "pooler.ini"})
+	assert.ErrorIs(t, err, pooler.ErrUnknownKind)
+}
+
+func TestSyncerSync(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	base := filepath.Join(dir, "base.ini")
+	require.NoError(t, os.WriteFile(base, []byte("[pgbouncer]\nlisten_port = 6432\n"), 0o600))
+
+	file := filepath.Join(dir, "pooler.ini")
+	syncer, err := pooler.NewSyncer(pooler.Config{Kind: pooler.KindPgBouncer, File: file, BaseFile: base, PoolMode: "session", PoolSize: 5})
+	require.NoError(t, err)
+
+	changed, err := syncer.Sync(ctx, nil)
+	require.NoError(t, err)
+	assert.True(t, changed, "the first sync must always write the file")
+
+	changed, err = syncer.Sync(ctx, []pooler.Entry{testEntry("abc_0", "integresql_test_abc_000")})
+	require.NoError(t, err)
+	assert.True(t, changed)
+
+	content, err := os.ReadFile(file)
+	require.NoError(t, err)
+	assert.Contains(t, string(content), "[pgbouncer]\nlisten_port = 6432\n")
+	assert.Contains(t, string(content), "abc_0 = host=postgres")
+
+	info, err := os.Stat(file)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o640), info.Mode().Perm())
+
+	changed, err = syncer.Sync(ctx, []pooler.Entry{testEntry("abc_0", "integresql_test_abc_000")})
+	require.NoError(t, err)
+	assert.False(t, changed)
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 2, "no temporary files must be left behind")
+}
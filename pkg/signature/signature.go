@@ -0,0 +1,102 @@
+// Package signature signs the responses of acquiring and returning test databases with the Ed25519 key of the server,
+// letting clients prove that a DSN was handed out by the authoritative IntegreSQL instance (and not injected by a
+// compromised intermediary).
+//
+// The client sends a random nonce in the NonceHeader, the server signs the method, the nonce, the status and the body
+// of its response and returns the signature in the SignatureHeader ("ed25519=<base64>"). Clients verify it with the
+// public key of the server (published via GET /api/v1/info, but pinned out of band) via Verify.
+package signature
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalidKey = errors.New("invalid ed25519 key")
+
+const (
+	SignatureHeader = "X-IntegreSQL-Response-Signature"
+	NonceHeader     = "X-IntegreSQL-Nonce"
+
+	signaturePrefix = "ed25519="
+	messagePrefix   = "integresql-response-v1"
+)
+
+// ParsePrivateKey parses the base64 (standard encoding) private key, either its 32 byte seed or the full 64 byte key.
+func ParsePrivateKey(encoded string) (ed25519.PrivateKey, error) {
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidKey, err)
+	}
+
+	switch len(raw) {
+	case ed25519.SeedSize:
+		return ed25519.NewKeyFromSeed(raw), nil
+	case ed25519.PrivateKeySize:
+		return ed25519.PrivateKey(raw), nil
+	default:
+		return nil, fmt.Errorf("%w: private key must be %d (seed) or %d bytes, got %d", ErrInvalidKey, ed25519.SeedSize, ed25519.PrivateKeySize, len(raw))
+	}
+}
+
+// ParsePublicKey parses the base64 (standard encoding) public key, see EncodePublicKey.
+func ParsePublicKey(encoded string) (ed25519.PublicKey, error) {
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidKey, err)
+	}
+
+	if len(raw) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("%w: public key must be %d bytes, got %d", ErrInvalidKey, ed25519.PublicKeySize, len(raw))
+	}
+
+	return ed25519.PublicKey(raw), nil
+}
+
+// EncodePublicKey returns the base64 (standard encoding) public key of the private key.
+func EncodePublicKey(key ed25519.PrivateKey) string {
+	return base64.StdEncoding.EncodeToString(key.Public().(ed25519.PublicKey))
+}
+
+// NewNonce returns a random nonce sent by the client in the NonceHeader.
+func NewNonce() (string, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(nonce), nil
+}
+
+// Sign returns the signature of the response sent in the SignatureHeader.
+func Sign(key ed25519.PrivateKey, method string, nonce string, status int, body []byte) string {
+	return signaturePrefix + base64.StdEncoding.EncodeToString(ed25519.Sign(key, message(method, nonce, status, body)))
+}
+
+// Verify returns true if the signature (value of the SignatureHeader) matches the response to the request with the nonce.
+func Verify(key ed25519.PublicKey, method string, nonce string, status int, body []byte, signature string) bool {
+	if !strings.HasPrefix(signature, signaturePrefix) || len(key) != ed25519.PublicKeySize {
+		return false
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(signature, signaturePrefix))
+	if err != nil {
+		return false
+	}
+
+	return ed25519.Verify(key, message(method, nonce, status, body), sig)
+}
+
+// message binds the signature to the request (method and nonce), the status and the body of the response.
+func message(method string, nonce string, status int, body []byte) []byte {
+	digest := sha256.Sum256(body)
+
+	return []byte(strings.Join([]string{messagePrefix, method, nonce, strconv.Itoa(status), hex.EncodeToString(digest[:])}, "\n"))
+}
@@ -0,0 +1,59 @@
+package signature_test
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"net/http"
+	"testing"
+
+	"github.com/allaboutapps/integresql/pkg/signature"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseKeys(t *testing.T) {
+	seed := make([]byte, ed25519.SeedSize)
+	seed[0] = 42
+
+	fromSeed, err := signature.ParsePrivateKey(base64.StdEncoding.EncodeToString(seed))
+	require.NoError(t, err)
+
+	full, err := signature.ParsePrivateKey(base64.StdEncoding.EncodeToString(fromSeed))
+	require.NoError(t, err)
+	assert.Equal(t, fromSeed, full)
+
+	pub, err := signature.ParsePublicKey(signature.EncodePublicKey(fromSeed))
+	require.NoError(t, err)
+	assert.Equal(t, fromSeed.Public(), pub)
+
+	_, err = signature.ParsePrivateKey("not base64!")
+	assert.ErrorIs(t, err, signature.ErrInvalidKey)
+	_, err = signature.ParsePrivateKey(base64.StdEncoding.EncodeToString([]byte("short")))
+	assert.ErrorIs(t, err, signature.ErrInvalidKey)
+	_, err = signature.ParsePublicKey(base64.StdEncoding.EncodeToString(seed[:16]))
+	assert.ErrorIs(t, err, signature.ErrInvalidKey)
+}
+
+func TestSignVerify(t *testing.T) {
+	pub, key, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	otherPub, _, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+
+	nonce, err := signature.NewNonce()
+	require.NoError(t, err)
+
+	body := []byte(`{"id":1,"database":{"config":{"host":"db"}}}`)
+	sig := signature.Sign(key, http.MethodGet, nonce, http.StatusOK, body)
+
+	assert.Regexp(t, "^ed25519=", sig)
+	assert.True(t, signature.Verify(pub, http.MethodGet, nonce, http.StatusOK, body, sig))
+
+	assert.False(t, signature.Verify(otherPub, http.MethodGet, nonce, http.StatusOK, body, sig))
+	assert.False(t, signature.Verify(pub, http.MethodGet, "replayed", http.StatusOK, body, sig))
+	assert.False(t, signature.Verify(pub, http.MethodGet, nonce, http.StatusOK, []byte(`{"id":1,"database":{"config":{"host":"evil"}}}`), sig))
+	assert.False(t, signature.Verify(pub, http.MethodGet, nonce, http.StatusNotFound, body, sig))
+	assert.False(t, signature.Verify(pub, http.MethodPost, nonce, http.StatusOK, body, sig))
+	assert.False(t, signature.Verify(pub, http.MethodGet, nonce, http.StatusOK, body, ""))
+	assert.False(t, signature.Verify(pub, http.MethodGet, nonce, http.StatusOK, body, "ed25519=invalid"))
+}
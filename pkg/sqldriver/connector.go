@@ -0,0 +1,188 @@
+package sqldriver
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/allaboutapps/integresql/pkg/db"
+	"github.com/lib/pq"
+)
+
+// Connector connects to the test database acquired for it, see the package docs.
+type Connector struct {
+	config  Config
+	baseURL *url.URL
+	client  *http.Client
+
+	testDB *db.TestDatabase // acquired while at least one connection is open
+	conn   driver.Connector // connects to the acquired testDB
+	open   int              // number of open connections
+	mutex  sync.Mutex
+}
+
+var _ driver.Connector = (*Connector)(nil)
+
+// NewConnector returns a connector for the given config, e.g. to be used via sql.OpenDB.
+func NewConnector(config Config) (*Connector, error) {
+	u, err := url.Parse(config.BaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidDSN, err)
+	}
+
+	return &Connector{
+		config:  config,
+		baseURL: u.ResolveReference(&url.URL{Path: path.Join(u.Path, config.APIVersion)}),
+		client:  &http.Client{},
+	}, nil
+}
+
+func (c *Connector) Driver() driver.Driver {
+	return Driver{}
+}
+
+// Connect opens a new connection to the test database, acquiring it first if there is no open connection.
+func (c *Connector) Connect(ctx context.Context) (driver.Conn, error) {
+	// concurrent connects wait for the first one to acquire the test database
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.testDB == nil {
+		testDB, err := c.acquire(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		conn, err := pq.NewConnector(testDB.Config.ConnectionString())
+		if err != nil {
+			return nil, err
+		}
+
+		c.testDB = &testDB
+		c.conn = conn
+	}
+
+	pqConn, err := c.conn.Connect(ctx)
+	if err != nil {
+		if c.open == 0 {
+			// nobody is going to use the test database, don't keep it checked out
+			if releaseErr := c.unsafeRelease(); releaseErr != nil {
+				return nil, fmt.Errorf("%w (returning the test database failed as well: %v)", err, releaseErr)
+			}
+		}
+
+		return nil, err
+	}
+
+	c.open++
+
+	return &conn{Conn: pqConn, onClose: c.closed}, nil
+}
+
+// TestDatabase returns the currently acquired test database, false if there is no open connection.
+func (c *Connector) TestDatabase() (db.TestDatabase, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.testDB == nil {
+		return db.TestDatabase{}, false
+	}
+
+	return *c.testDB, true
+}
+
+// closed is called after a connection was closed, the last one returns the test database.
+func (c *Connector) closed() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.open--
+	if c.open > 0 {
+		return nil
+	}
+
+	return c.unsafeRelease()
+}
+
+// unsafeRelease returns the test database. Attention: c.mutex must be locked!
+func (c *Connector) unsafeRelease() error {
+	testDB := c.testDB
+	c.testDB = nil
+	c.conn = nil
+
+	if testDB == nil || c.config.Return == ReturnNone {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.config.ReturnTimeout)
+	defer cancel()
+
+	endpoint := fmt.Sprintf("/templates/%s/tests/%d/%s", c.config.Hash, testDB.ID, c.config.Return)
+	if _, err := c.request(ctx, http.MethodPost, endpoint, http.StatusNoContent); err != nil {
+		return fmt.Errorf("integresql: returning test database %d of template %s failed: %w", testDB.ID, c.config.Hash, err)
+	}
+
+	return nil
+}
+
+func (c *Connector) acquire(ctx context.Context) (db.TestDatabase, error) {
+	var testDB db.TestDatabase
+
+	body, err := c.request(ctx, http.MethodGet, fmt.Sprintf("/templates/%s/tests", c.config.Hash), http.StatusOK)
+	if err != nil {
+		return testDB, fmt.Errorf("integresql: acquiring a test database of template %s failed: %w", c.config.Hash, err)
+	}
+
+	if err := json.Unmarshal(body, &testDB); err != nil {
+		return testDB, fmt.Errorf("integresql: decoding the test database of template %s failed: %w", c.config.Hash, err)
+	}
+
+	return testDB, nil
+}
+
+func (c *Connector) request(ctx context.Context, method string, endpoint string, expectedStatus int) ([]byte, error) {
+	u := c.baseURL.ResolveReference(&url.URL{Path: path.Join(c.baseURL.Path, endpoint)})
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Accept", "application/json")
+
+	// lets the server give up (with a precise error) before our own deadline is reached
+	if deadline, ok := ctx.Deadline(); ok {
+		remaining := time.Until(deadline).Milliseconds()
+		if remaining < 0 {
+			remaining = 0
+		}
+		req.Header.Set("X-Integresql-Deadline-Ms", fmt.Sprintf("%d", remaining))
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// body must always be closed
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != expectedStatus {
+		return nil, fmt.Errorf("received unexpected HTTP status %d (%s): %s", resp.StatusCode, resp.Status, strings.TrimSpace(string(b)))
+	}
+
+	return b, nil
+}
@@ -0,0 +1,128 @@
+// Package sqldriver registers the "integresql" database/sql driver, a compat shim for legacy test code: Switching its
+// DSN to sql.Open("integresql", "hash=<hash>;server=http://integresql:5000/api") lets it use an isolated test database
+// of the template <hash> without any further changes.
+//
+// The test database is acquired lazily on the first connection of the *sql.DB and returned as soon as the last
+// connection is closed (typically on db.Close()). All connections of a *sql.DB share the same test database. Note that
+// closing all idle connections while the *sql.DB is still in use (e.g. SetMaxIdleConns(0)) returns the test database
+// as well, the next connection acquires a new one then.
+package sqldriver
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/allaboutapps/integresql/pkg/util"
+)
+
+const DriverName = "integresql"
+
+var ErrInvalidDSN = errors.New("invalid integresql DSN")
+
+func init() {
+	sql.Register(DriverName, Driver{})
+}
+
+// ReturnMode defines how the test database is returned after the last connection was closed.
+type ReturnMode string
+
+const (
+	ReturnRecreate ReturnMode = "recreate" // POST /api/v1/templates/:hash/tests/:id/recreate (default, the test might have modified it)
+	ReturnUnlock   ReturnMode = "unlock"   // POST /api/v1/templates/:hash/tests/:id/unlock, only for readonly tests
+	ReturnNone     ReturnMode = "none"     // left to the FIFO auto-cleaning of the server
+)
+
+// Config is parsed from the DSN, a ";" separated list of key=value pairs:
+//
+//	hash=<template hash>;server=<base URL of the API>;return=<recreate|unlock|none>
+//
+// server defaults to INTEGRESQL_CLIENT_BASE_URL (or "http://integresql:5000/api"), return defaults to recreate.
+type Config struct {
+	Hash       string
+	BaseURL    string
+	APIVersion string
+	Return     ReturnMode
+
+	// Timeout of returning the test database, acquiring it respects the context of the connect instead
+	ReturnTimeout time.Duration
+}
+
+// ParseDSN parses the DSN of the integresql driver.
+func ParseDSN(dsn string) (Config, error) {
+	config := Config{
+		BaseURL:       util.GetEnv("INTEGRESQL_CLIENT_BASE_URL", "http://integresql:5000/api"),
+		APIVersion:    util.GetEnv("INTEGRESQL_CLIENT_API_VERSION", "v1"),
+		Return:        ReturnRecreate,
+		ReturnTimeout: 10 * time.Second,
+	}
+
+	for _, pair := range strings.Split(dsn, ";") {
+		pair = strings.TrimSpace(pair)
+		if len(pair) == 0 {
+			continue
+		}
+
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return config, fmt.Errorf("%w: %q is not a key=value pair", ErrInvalidDSN, pair)
+		}
+
+		value = strings.TrimSpace(value)
+
+		switch strings.TrimSpace(key) {
+		case "hash":
+			config.Hash = value
+		case "server":
+			config.BaseURL = value
+		case "return":
+			switch mode := ReturnMode(value); mode {
+			case ReturnRecreate, ReturnUnlock, ReturnNone:
+				config.Return = mode
+			default:
+				return config, fmt.Errorf("%w: unknown return mode %q", ErrInvalidDSN, value)
+			}
+		default:
+			return config, fmt.Errorf("%w: unknown key %q", ErrInvalidDSN, key)
+		}
+	}
+
+	if len(config.Hash) == 0 {
+		return config, fmt.Errorf("%w: hash is required", ErrInvalidDSN)
+	}
+
+	if len(config.BaseURL) == 0 {
+		return config, fmt.Errorf("%w: server must not be empty", ErrInvalidDSN)
+	}
+
+	return config, nil
+}
+
+// Driver is the database/sql driver registered as "integresql".
+type Driver struct{}
+
+var _ driver.DriverContext = Driver{}
+
+// Open acquires a separate test database for each connection, use sql.Open (relying on OpenConnector) to share one
+// test database between all connections of a *sql.DB.
+func (d Driver) Open(dsn string) (driver.Conn, error) {
+	c, err := d.OpenConnector(dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.Connect(context.Background())
+}
+
+func (d Driver) OpenConnector(dsn string) (driver.Connector, error) {
+	config, err := ParseDSN(dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewConnector(config)
+}
@@ -0,0 +1,116 @@
+package sqldriver_test
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/allaboutapps/integresql/pkg/db"
+	"github.com/allaboutapps/integresql/pkg/manager"
+	"github.com/allaboutapps/integresql/pkg/sqldriver"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseDSN(t *testing.T) {
+	config, err := sqldriver.ParseDSN("hash=abc; server=http://localhost:5000/api ;")
+	require.NoError(t, err)
+	assert.Equal(t, "abc", config.Hash)
+	assert.Equal(t, "http://localhost:5000/api", config.BaseURL)
+	assert.Equal(t, sqldriver.ReturnRecreate, config.Return)
+
+	config, err = sqldriver.ParseDSN("hash=abc;return=unlock")
+	require.NoError(t, err)
+	assert.Equal(t, sqldriver.ReturnUnlock, config.Return)
+	assert.NotEmpty(t, config.BaseURL)
+
+	for _, invalid := range []string{"", "server=http://localhost:5000/api", "hash", "hash=abc;return=maybe", "hash=abc;user=postgres", "hash=abc;server="} {
+		_, err := sqldriver.ParseDSN(invalid)
+		assert.ErrorIs(t, err, sqldriver.ErrInvalidDSN, invalid)
+	}
+}
+
+// stubServer hands out the given test database and records the calls.
+type stubServer struct {
+	testDB db.TestDatabase
+
+	calls []string
+	mutex sync.Mutex
+}
+
+func (s *stubServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	s.calls = append(s.calls, fmt.Sprintf("%s %s", r.Method, r.URL.Path))
+	s.mutex.Unlock()
+
+	if r.Method == http.MethodGet {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(s.testDB)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *stubServer) Calls() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return append([]string{}, s.calls...)
+}
+
+func TestConnectorReturnsOnFailedConnect(t *testing.T) {
+	stub := &stubServer{testDB: db.TestDatabase{ID: 3, Database: db.Database{TemplateHash: "abc", Config: db.DatabaseConfig{
+		Host: "127.0.0.1", Port: 1, Username: "nobody", Password: "nothing", Database: "unreachable",
+	}}}}
+	srv := httptest.NewServer(stub)
+	defer srv.Close()
+
+	conn, err := sql.Open(sqldriver.DriverName, fmt.Sprintf("hash=abc;server=%s/api", srv.URL))
+	require.NoError(t, err)
+	defer conn.Close()
+
+	// nothing is acquired until the first connection
+	assert.Empty(t, stub.Calls())
+
+	require.Error(t, conn.PingContext(context.Background()))
+
+	// the unused test database isn't kept checked out
+	assert.Equal(t, []string{"GET /api/v1/templates/abc/tests", "POST /api/v1/templates/abc/tests/3/recreate"}, stub.Calls()[:2])
+}
+
+func TestDriver(t *testing.T) {
+	// hands out the manager database itself, an existing database is all this test needs
+	stub := &stubServer{testDB: db.TestDatabase{ID: 7, Database: db.Database{TemplateHash: "abc", Config: manager.DefaultManagerConfigFromEnv().ManagerDatabaseConfig}}}
+	srv := httptest.NewServer(stub)
+	defer srv.Close()
+
+	conn, err := sql.Open(sqldriver.DriverName, fmt.Sprintf("hash=abc;server=%s/api;return=unlock", srv.URL))
+	require.NoError(t, err)
+
+	ctx := context.Background()
+
+	// multiple connections share the test database
+	c1, err := conn.Conn(ctx)
+	require.NoError(t, err)
+	c2, err := conn.Conn(ctx)
+	require.NoError(t, err)
+
+	var one int
+	require.NoError(t, c1.QueryRowContext(ctx, "SELECT 1").Scan(&one))
+	require.NoError(t, c2.QueryRowContext(ctx, "SELECT 1").Scan(&one))
+
+	require.NoError(t, c1.Close())
+	require.NoError(t, c2.Close())
+
+	assert.Equal(t, []string{"GET /api/v1/templates/abc/tests"}, stub.Calls())
+
+	// closing the last connection returns it
+	require.NoError(t, conn.Close())
+	assert.Equal(t, []string{"GET /api/v1/templates/abc/tests", "POST /api/v1/templates/abc/tests/7/unlock"}, stub.Calls())
+}
@@ -17,10 +17,26 @@ const (
 	TemplateStateFinalized
 )
 
+func (s TemplateState) String() string {
+	switch s {
+	case TemplateStateInit:
+		return "init"
+	case TemplateStateDiscarded:
+		return "discarded"
+	case TemplateStateFinalized:
+		return "finalized"
+	default:
+		return "unknown"
+	}
+}
+
 type Template struct {
 	TemplateConfig
 	db.Database
-	state TemplateState
+	InitializedAt time.Time // never changes, the TTL of the template starts here
+	state         TemplateState
+	checksum      string        // of the ChecksumTables, computed while finalizing
+	created       chan struct{} // open while the template database is created, see StartCreating
 
 	cond  *sync.Cond
 	mutex sync.RWMutex
@@ -28,12 +44,157 @@ type Template struct {
 
 type TemplateConfig struct {
 	db.DatabaseConfig
+	Options TemplateOptions
+}
+
+// TemplateOptions are optional settings of a template provided while initializing it.
+type TemplateOptions struct {
+	// SQL script executed within each test database after it was (re)created from the template.
+	// The random seed assigned to the test database is available within the script (and later on) via current_setting('integresql.seed').
+	PostCloneScript string `json:"postCloneScript,omitempty"`
+
+	// Queries executed within each test database after it was (re)created (and the PostCloneScript ran), it only enters
+	// the pool if all of them pass: A query fails on errors or if the first column of any row is false or a "not ok"
+	// TAP line, e.g. "SELECT count(*) > 0 FROM users" or a pgTAP suite via "SELECT * FROM runtests()".
+	ValidationQueries []string `json:"validationQueries,omitempty"`
+
+	// Kind of the source the template database is created from, defaults to TemplateSourceDatabase if a SourceDatabase
+	// is set, TemplateSourceEmpty otherwise.
+	SourceKind TemplateSourceKind `json:"sourceKind,omitempty"`
+
+	// Name of the source database: With TemplateSourceDatabase a database on the source cluster (see ManagerConfig.SourceDatabaseConfig),
+	// which schema and data are copied into the template database while initializing it (typically a readonly standby synced
+	// from production). With TemplateSourceExisting a database on the manager cluster, which is adopted as-is.
+	SourceDatabase string `json:"sourceDatabase,omitempty"`
+
+	// Path of a pg_dump (custom format) file relative to ManagerConfig.TemplateDumpDir restored with TemplateSourceDump.
+	SourceDump string `json:"sourceDump,omitempty"`
+
+	// Tag of the OCI artifact (see ManagerConfig.OCI) pulled and restored with TemplateSourceOCI, defaults to the hash.
+	SourceArtifact string `json:"sourceArtifact,omitempty"`
+
+	// Ephemeral templates are automatically discarded (including all of their test databases) as soon as none of their
+	// test databases is checked out and the pool was idle for ManagerConfig.EphemeralTemplateIdleTimeout.
+	Ephemeral bool `json:"ephemeral,omitempty"`
+
+	// Templates are automatically discarded (including all of their test databases) this duration after their
+	// initialization, overwrites the ManagerConfig.TemplateTTL default if set.
+	TTL time.Duration `json:"ttl,omitempty"`
+
+	// Ready test databases older than this (since their last recreation) are recreated in background, overwrites
+	// the PoolConfig.TestDatabaseMaxCloneAge default if set.
+	MaxCloneAge time.Duration `json:"maxCloneAge,omitempty"`
+
+	// Renewals never extend the lease of a checked out test database beyond this duration since its checkout,
+	// overwrites the PoolConfig.TestDatabaseMaxLeaseDuration default if set.
+	MaxLeaseDuration time.Duration `json:"maxLeaseDuration,omitempty"`
+
+	// Maximal number of test databases of the template (re)created in parallel in background, overwrites the
+	// PoolConfig.MaxParallelTasks default if set (e.g. low for big templates, high for tiny ones).
+	FillConcurrency int `json:"fillConcurrency,omitempty"`
+
+	// Priority of the background (re)creation of the template's test databases while waiting for one of the
+	// PoolConfig.MaxParallelFills shared by all templates, higher ones first (defaults to 0, may be negative).
+	FillPriority int `json:"fillPriority,omitempty"`
+
+	// Number of test databases of the template prepared in background and maximal size of its pool, overwrite the
+	// PoolConfig.InitialPoolSize and PoolConfig.MaxPoolSize defaults if set (e.g. high for a 64-way parallel suite).
+	InitialPoolSize int `json:"initialPoolSize,omitempty"`
+	MaxPoolSize     int `json:"maxPoolSize,omitempty"`
+
+	// Which ready test database is handed out: "lru" (least recently recreated), "mru" or "round-robin", overwrites
+	// the PoolConfig.SelectionPolicy default if set.
+	SelectionPolicy string `json:"selectionPolicy,omitempty"`
+
+	// Labels describing the environment/context of the template (e.g. "pr-1234", "nightly"), allowing to reset
+	// the tracking of all templates with a certain label.
+	Labels []string `json:"labels,omitempty"`
+
+	// Namespace the template is accounted to (the fingerprint of the API token, admin tokens may pick another one, e.g. a team),
+	// at most ManagerConfig.MaxTemplatesPerNamespace templates are tracked per namespace.
+	Namespace string `json:"namespace,omitempty"`
+
+	// Default session settings (GUCs, e.g. "default_transaction_isolation": "serializable", "work_mem": "64MB", "jit": "off")
+	// applied via ALTER DATABASE SET to the template database and every test database cloned from it.
+	Settings map[string]string `json:"settings,omitempty"`
+
+	// Arbitrary metadata (e.g. "branch": "main"). The most recently finalized template carrying the
+	// ManagerConfig.LatestAliasMetadataKey is acquirable via the alias "latest:<value>" (e.g. "latest:main") instead of its hash.
+	Metadata map[string]string `json:"metadata,omitempty"`
+
+	// URLs notified via POST as soon as the template is finalized (ready) or can't become ready anymore (failed, e.g.
+	// discarded before finalizing), allowing pipelines to gate on the template without polling.
+	ReadyWebhook  string `json:"readyWebhook,omitempty"`
+	FailedWebhook string `json:"failedWebhook,omitempty"`
+
+	// Test databases checked out longer than this (without renewing their lease) are alerted as stale checkouts,
+	// overwrites the ManagerConfig.StaleCheckoutAlertAfter default if set.
+	StaleCheckoutAlertAfter time.Duration `json:"staleCheckoutAlertAfter,omitempty"`
+
+	// URL notified via POST about stale checkouts of the template's test databases (in addition to the
+	// ManagerConfig.StaleCheckoutWebhook).
+	StaleCheckoutWebhook string `json:"staleCheckoutWebhook,omitempty"`
+
+	// Fingerprint of the full schema the hash was derived from (e.g. a SHA-256 over all migrations and fixtures), verified
+	// while initializing an already tracked hash: a different fingerprint means two different schemas collide on the same
+	// (possibly truncated) hash, which is rejected instead of handing out test databases of the other schema.
+	SchemaFingerprint string `json:"schemaFingerprint,omitempty"`
+
+	// Tablespace the template database (and its replicas) is created in, test databases are cloned into it as well
+	// unless a CloneTablespace is set (e.g. to keep big templates and their clones off the hot storage tier).
+	Tablespace      string `json:"tablespace,omitempty"`
+	CloneTablespace string `json:"cloneTablespace,omitempty"`
+
+	// Settings (e.g. "maintenance_io_concurrency": "16", "maintenance_work_mem": "1GB") of the sessions creating the
+	// template and test databases and running the PostCloneScript and ValidationQueries. Unlike the Settings, they are
+	// never persisted in the databases.
+	CloneSettings map[string]string `json:"cloneSettings,omitempty"`
+
+	// Tables (e.g. "users" or "public.users") whose contents are checksummed while finalizing the template. The checksum
+	// is part of every acquired test database, allowing clients to verify they got a clone of the template they expect.
+	ChecksumTables []string `json:"checksumTables,omitempty"`
+}
+
+// TemplateSourceKind describes what the template database is created from.
+type TemplateSourceKind string
+
+const (
+	TemplateSourceEmpty    TemplateSourceKind = "empty"    // empty database (from ManagerConfig.TemplateDatabaseTemplate), populated and finalized by the client
+	TemplateSourceDatabase TemplateSourceKind = "database" // copy of the SourceDatabase on the source cluster, may be further populated by the client before finalizing
+	TemplateSourceDump     TemplateSourceKind = "dump"     // restore of the SourceDump, may be further populated by the client before finalizing
+	TemplateSourceExisting TemplateSourceKind = "existing" // the SourceDatabase on the manager cluster is adopted as-is (renamed) and finalized immediately
+	TemplateSourceOCI      TemplateSourceKind = "oci"      // restore of the SourceArtifact pulled from the registry (exported by another instance after finalizing) and finalized immediately
+)
+
+// Source returns the effective kind of the source the template database is created from.
+func (o TemplateOptions) Source() TemplateSourceKind {
+	if len(o.SourceKind) > 0 {
+		return o.SourceKind
+	}
+
+	if len(o.SourceDatabase) > 0 {
+		return TemplateSourceDatabase
+	}
+
+	return TemplateSourceEmpty
+}
+
+// HasLabel returns true if the label was assigned to the template.
+func (o TemplateOptions) HasLabel(label string) bool {
+	for _, l := range o.Labels {
+		if l == label {
+			return true
+		}
+	}
+
+	return false
 }
 
 func NewTemplate(hash string, config TemplateConfig) *Template {
 	t := &Template{
 		TemplateConfig: config,
 		Database:       db.Database{TemplateHash: hash, Config: config.DatabaseConfig},
+		InitializedAt:  time.Now(),
 		state:          TemplateStateInit,
 	}
 	t.cond = sync.NewCond(&t.mutex)
@@ -48,6 +209,30 @@ func (t *Template) GetConfig(_ context.Context) TemplateConfig {
 	return t.TemplateConfig
 }
 
+// SetOptions replaces the options of the template, e.g. after resizing its pool.
+func (t *Template) SetOptions(_ context.Context, options TemplateOptions) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.Options = options
+}
+
+// GetChecksum returns the checksum of the ChecksumTables computed while finalizing, empty if there are none.
+func (t *Template) GetChecksum(_ context.Context) string {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
+	return t.checksum
+}
+
+// SetChecksum sets the checksum of the ChecksumTables.
+func (t *Template) SetChecksum(_ context.Context, checksum string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.checksum = checksum
+}
+
 // GetState locks the template and checks its state.
 func (t *Template) GetState(_ context.Context) TemplateState {
 	t.mutex.RLock()
@@ -69,8 +254,53 @@ func (t *Template) SetState(ctx context.Context, newState TemplateState) {
 	t.cond.Broadcast()
 }
 
+// StartCreating marks the template database as being created, e.g. while it's copied from its source without holding
+// the lock of the collection. The returned function must be called once it's created (or failed).
+func (t *Template) StartCreating() (done func()) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	created := make(chan struct{})
+	t.created = created
+
+	var once sync.Once
+	return func() { once.Do(func() { close(created) }) }
+}
+
+// WaitUntilCreated returns as soon as the template database is created (or failed to), directly if it's not being created.
+func (t *Template) WaitUntilCreated(ctx context.Context) error {
+	created := t.creating()
+	if created == nil {
+		return nil
+	}
+
+	select {
+	case <-created:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// creating returns the channel closed once the template database is created, nil if it's not being created.
+func (t *Template) creating() <-chan struct{} {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
+	if t.created == nil {
+		return nil
+	}
+
+	select {
+	case <-t.created:
+		return nil
+	default:
+		return t.created
+	}
+}
+
 // WaitUntilFinalized checks the current template state and returns directly if it's 'Finalized'.
-// If it's not, the function waits the given timeout until the template state changes.
+// If it's not, the function waits the given timeout (or until ctx is done) until the template state changes.
 // On timeout, the old state is returned, otherwise - the new state.
 func (t *Template) WaitUntilFinalized(ctx context.Context, timeout time.Duration) (exitState TemplateState) {
 	currentState := t.GetState(ctx)
@@ -122,6 +352,11 @@ func (l LockedTemplate) SetState(_ context.Context, newState TemplateState) {
 	l.t.cond.Broadcast()
 }
 
+// SetChecksum sets the checksum of the ChecksumTables of the locked template (without acquiring the lock again).
+func (l LockedTemplate) SetChecksum(_ context.Context, checksum string) {
+	l.t.checksum = checksum
+}
+
 func (c TemplateConfig) Equals(other TemplateConfig) bool {
 	return c.DatabaseConfig.ConnectionString() == other.ConnectionString()
 }
@@ -3,6 +3,7 @@ package templates
 import (
 	"context"
 	"runtime/trace"
+	"sort"
 	"sync"
 )
 
@@ -23,7 +24,8 @@ func NewCollection() *Collection {
 
 // Push tries to add a new template to the collection.
 // If the template already exists and the config matches, added=false is returned.
-// If config doesn't match, the template is overwritten and added=true is returned.
+// If config doesn't match, the template is overwritten and added=true is returned. A template still being created (see
+// Template.StartCreating) is only overwritten once it's created.
 // This function locks the collection and no matter what is its output, the unlock function needs to be called to release the lock.
 func (tc *Collection) Push(ctx context.Context, hash string, config TemplateConfig) (added bool, unlock Unlock) {
 	reg := trace.StartRegion(ctx, "get_template_lock")
@@ -41,7 +43,14 @@ func (tc *Collection) Push(ctx context.Context, hash string, config TemplateConf
 		if template.GetConfig(ctx).Equals(config) {
 			return false, unlock
 		}
-		// else overwrite the template
+
+		// else overwrite the template, but never while its database is still created with the old config
+		if created := template.creating(); created != nil {
+			unlock()
+			<-created
+
+			return tc.Push(ctx, hash, config)
+		}
 	}
 
 	tc.templates[hash] = NewTemplate(hash, config)
@@ -80,6 +89,47 @@ func (tc *Collection) Get(ctx context.Context, hash string) (template *Template,
 	return template, true
 }
 
+// List returns all templates currently within the collection ordered by their hash.
+func (tc *Collection) List(ctx context.Context) []*Template {
+	reg := trace.StartRegion(ctx, "get_template_lock")
+	defer reg.End()
+
+	tc.collMutex.RLock()
+	defer tc.collMutex.RUnlock()
+
+	list := make([]*Template, 0, len(tc.templates))
+	for _, template := range tc.templates {
+		list = append(list, template)
+	}
+
+	sort.Slice(list, func(i, j int) bool { return list[i].TemplateHash < list[j].TemplateHash })
+
+	return list
+}
+
+// GetUnsafe gets the requested template and can be called ONLY IF THE COLLECTION IS LOCKED.
+func (tc *Collection) GetUnsafe(_ context.Context, hash string) (template *Template, found bool) {
+	template, found = tc.templates[hash]
+
+	return template, found
+}
+
+// Remove removes the template, unless the hash was overwritten by another template meanwhile.
+func (tc *Collection) Remove(ctx context.Context, template *Template) bool {
+	reg := trace.StartRegion(ctx, "get_template_lock")
+	defer reg.End()
+
+	tc.collMutex.Lock()
+	defer tc.collMutex.Unlock()
+
+	if tc.templates[template.TemplateHash] != template {
+		return false
+	}
+
+	delete(tc.templates, template.TemplateHash)
+	return true
+}
+
 // RemoveUnsafe removes the template and can be called ONLY IF THE COLLECTION IS LOCKED.
 func (tc *Collection) RemoveUnsafe(_ context.Context, hash string) {
 	delete(tc.templates, hash)
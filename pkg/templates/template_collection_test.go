@@ -92,3 +92,95 @@ func TestTemplateCollectionPushWithOtherConfig(t *testing.T) {
 	assert.Equal(t, "template_another", template.Config.Database)
 
 }
+
+func TestTemplateCollectionList(t *testing.T) {
+	ctx := context.Background()
+
+	coll := templates.NewCollection()
+	assert.Empty(t, coll.List(ctx))
+
+	for _, hash := range []string{"b", "c", "a"} {
+		_, unlock := coll.Push(ctx, hash, templates.TemplateConfig{
+			DatabaseConfig: db.DatabaseConfig{
+				Database: "template_" + hash,
+			},
+		})
+		unlock()
+	}
+
+	list := coll.List(ctx)
+	if assert.Len(t, list, 3) {
+		assert.Equal(t, "a", list[0].TemplateHash)
+		assert.Equal(t, "b", list[1].TemplateHash)
+		assert.Equal(t, "c", list[2].TemplateHash)
+	}
+
+	coll.Pop(ctx, "b")
+	assert.Len(t, coll.List(ctx), 2)
+}
+
+func TestTemplateCollectionPushWhileCreating(t *testing.T) {
+	ctx := context.Background()
+
+	coll := templates.NewCollection()
+	cfg := templates.TemplateConfig{
+		DatabaseConfig: db.DatabaseConfig{
+			Database: "template_test",
+		},
+	}
+	hash := "123"
+
+	added, unlock := coll.Push(ctx, hash, cfg)
+	assert.True(t, added)
+	template, found := coll.GetUnsafe(ctx, hash)
+	assert.True(t, found)
+	created := template.StartCreating()
+	unlock()
+
+	// other templates stay accessible while it's created
+	added, unlock = coll.Push(ctx, "456", cfg)
+	assert.True(t, added)
+	unlock()
+
+	_, found = coll.Get(ctx, hash)
+	assert.True(t, found)
+
+	// same config: already initialized
+	added, unlock = coll.Push(ctx, hash, cfg)
+	assert.False(t, added)
+	unlock()
+
+	waitCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, template.WaitUntilCreated(waitCtx), context.DeadlineExceeded)
+
+	// other config: overwritten only once it's created
+	overwritten := make(chan bool)
+	go func() {
+		other := cfg
+		other.Database = "template_another"
+		added, unlock := coll.Push(ctx, hash, other)
+		unlock()
+		overwritten <- added
+	}()
+
+	select {
+	case <-overwritten:
+		t.Fatal("template overwritten while it's created")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	created()
+	assert.NoError(t, template.WaitUntilCreated(ctx))
+	assert.True(t, <-overwritten)
+
+	// the overwriting template is kept
+	assert.False(t, coll.Remove(ctx, template))
+	current, found := coll.Get(ctx, hash)
+	assert.True(t, found)
+	assert.Equal(t, "template_another", current.Config.Database)
+
+	assert.True(t, coll.Remove(ctx, current))
+	_, found = coll.Get(ctx, hash)
+	assert.False(t, found)
+}
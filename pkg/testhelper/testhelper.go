@@ -0,0 +1,106 @@
+// Package testhelper acquires test databases within Go tests via the client package, returning them automatically
+// via t.Cleanup once the test (and its subtests) finished.
+//
+//	func TestSomething(t *testing.T) {
+//		testDB := testhelper.Acquire(t, hash)
+//		_, err := testDB.DB.ExecContext(ctx, "INSERT INTO ...")
+//	}
+package testhelper
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/allaboutapps/integresql/pkg/client"
+	"github.com/allaboutapps/integresql/pkg/db"
+)
+
+// TestDatabase is a checked out test database with an open connection pool, both are released on cleanup.
+type TestDatabase struct {
+	db.TestDatabase
+	DB *sql.DB
+}
+
+var (
+	defaultClient     *client.Client
+	defaultClientErr  error
+	defaultClientOnce sync.Once
+)
+
+// Default returns the client shared by Acquire, configured via client.DefaultConfigFromEnv.
+func Default() (*client.Client, error) {
+	defaultClientOnce.Do(func() {
+		defaultClient, defaultClientErr = client.DefaultFromEnv()
+	})
+
+	return defaultClient, defaultClientErr
+}
+
+// Acquire checks out a test database of the (finalized) template via the Default client, see AcquireWithClient.
+func Acquire(t testing.TB, hash string) TestDatabase {
+	t.Helper()
+
+	c, err := Default()
+	if err != nil {
+		t.Fatalf("integresql: failed to create the client: %v", err)
+	}
+
+	return AcquireWithClient(t, c, hash)
+}
+
+// AcquireWithClient checks out a test database of the (finalized) template and opens it. On cleanup, the connection
+// pool is closed and the test database is returned to be recreated. Failures fail the test right away.
+func AcquireWithClient(t testing.TB, c *client.Client, hash string) TestDatabase {
+	t.Helper()
+
+	ctx := context.Background()
+
+	testDB, err := c.GetTestDatabase(ctx, hash)
+	if err != nil {
+		t.Fatalf("integresql: failed to acquire a test database of template %q: %v", hash, explain(err))
+	}
+
+	conn, err := sql.Open("postgres", client.ConnectionString(testDB.Database))
+	if err != nil {
+		t.Fatalf("integresql: failed to open test database %s: %v", testDB.Config.Database, err)
+	}
+
+	t.Cleanup(func() {
+		if err := conn.Close(); err != nil {
+			t.Errorf("integresql: failed to close test database %s: %v", testDB.Config.Database, err)
+		}
+
+		if err := c.RecreateTestDatabase(context.Background(), hash, testDB.ID); err != nil {
+			t.Errorf("integresql: failed to return test database %s: %v", testDB.Config.Database, err)
+		}
+	})
+
+	return TestDatabase{TestDatabase: testDB, DB: conn}
+}
+
+// errPoolExhausted hints at the typical causes of waiting for a ready test database in vain.
+var errPoolExhausted = errors.New("no test database became ready in time, the pool is likely exhausted " +
+	"(test databases not returned, INTEGRESQL_TEST_MAX_POOL_SIZE too small for the parallelism of the tests or recreations failing)")
+
+// explain annotates the errors of acquiring a test database with their typical cause.
+func explain(err error) error {
+	var apiErr *client.APIError
+
+	switch {
+	case errors.Is(err, client.ErrDeadlineExceeded),
+		errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusInternalServerError && strings.Contains(apiErr.Message, "timeout when waiting for ready db"):
+		return fmt.Errorf("%w: %w", errPoolExhausted, err)
+	case errors.Is(err, client.ErrTemplateNotFound):
+		return fmt.Errorf("template is not initialized, set it up first (e.g. via client.SetupTemplate): %w", err)
+	case errors.Is(err, client.ErrTemplateDiscarded):
+		return fmt.Errorf("template was discarded while waiting: %w", err)
+	default:
+		return err
+	}
+}
@@ -0,0 +1,97 @@
+package testhelper_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/allaboutapps/integresql/pkg/client"
+	"github.com/allaboutapps/integresql/pkg/db"
+	"github.com/allaboutapps/integresql/pkg/testhelper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testClient(t *testing.T, handler http.HandlerFunc) *client.Client {
+	t.Helper()
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	c, err := client.New(client.Config{BaseURL: server.URL + "/api", RetryBackoff: time.Millisecond})
+	require.NoError(t, err)
+
+	return c
+}
+
+// fatalTB records the message of Fatalf and stops the goroutine like testing.T does.
+type fatalTB struct {
+	testing.TB
+	message string
+}
+
+func (f *fatalTB) Helper() {}
+
+func (f *fatalTB) Fatalf(format string, args ...interface{}) {
+	f.message = fmt.Sprintf(format, args...)
+	runtime.Goexit()
+}
+
+func TestAcquireReturnsOnCleanup(t *testing.T) {
+	var mu sync.Mutex
+	requests := make([]string, 0)
+
+	c := testClient(t, func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		mu.Unlock()
+
+		if r.Method == http.MethodGet {
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(db.TestDatabase{ID: 3, Database: db.Database{TemplateHash: "hashinghash", Config: db.DatabaseConfig{
+				Host: "localhost", Port: 5432, Username: "test", Password: "test", Database: "integresql_test_hashinghash_003",
+			}}})
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	t.Run("acquire", func(t *testing.T) {
+		testDB := testhelper.AcquireWithClient(t, c, "hashinghash")
+		assert.Equal(t, 3, testDB.ID)
+		assert.Equal(t, "integresql_test_hashinghash_003", testDB.Config.Database)
+		require.NotNil(t, testDB.DB)
+	})
+
+	assert.Equal(t, []string{
+		"GET /api/v1/templates/hashinghash/tests",
+		"POST /api/v1/templates/hashinghash/tests/3/recreate",
+	}, requests)
+}
+
+func TestAcquirePoolExhausted(t *testing.T) {
+	c := testClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		_ = json.NewEncoder(w).Encode(map[string]string{"message": "timeout when waiting for ready db"})
+	})
+
+	tb := &fatalTB{TB: t}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		testhelper.AcquireWithClient(tb, c, "hashinghash")
+	}()
+	<-done
+
+	assert.Contains(t, tb.message, `failed to acquire a test database of template "hashinghash"`)
+	assert.Contains(t, tb.message, "the pool is likely exhausted")
+	assert.Contains(t, tb.message, "timeout when waiting for ready db")
+}
@@ -0,0 +1,166 @@
+// Package tracing instruments the manager, the pools and the HTTP API with OpenTelemetry spans exported via OTLP.
+// Each span is mirrored as runtime/trace task (or region), thus `go tool trace` keeps working as before.
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	rtrace "runtime/trace"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var ErrUnknownExporter = errors.New("unknown tracing exporter")
+
+const instrumentationName = "github.com/allaboutapps/integresql"
+
+type Exporter string
+
+const (
+	ExporterNone Exporter = "none"
+	ExporterOTLP Exporter = "otlp" // OTLP over HTTP, the standard OTEL_EXPORTER_OTLP_* env vars apply as well
+)
+
+type Config struct {
+	Exporter      Exporter
+	Endpoint      string // host:port of the OTLP collector, empty falls back to OTEL_EXPORTER_OTLP_ENDPOINT (or localhost:4318)
+	Insecure      bool   // http instead of https
+	ServiceName   string
+	SamplePercent int // share of root spans sampled (0..100), child spans follow the decision of their parent
+}
+
+func (c Config) Enabled() bool {
+	return len(c.Exporter) > 0 && c.Exporter != ExporterNone
+}
+
+// tracer delegates to the provider installed by Init (a noop one before)
+var tracer = otel.Tracer(instrumentationName)
+
+// Init installs the global tracer provider exporting spans according to the config and the W3C trace context
+// propagator. The returned func flushes all pending spans and stops the export, a noop if tracing is disabled.
+func Init(ctx context.Context, config Config) (func(context.Context) error, error) {
+	if !config.Enabled() {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	if config.Exporter != ExporterOTLP {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownExporter, config.Exporter)
+	}
+
+	options := make([]otlptracehttp.Option, 0, 2)
+	if len(config.Endpoint) > 0 {
+		options = append(options, otlptracehttp.WithEndpoint(config.Endpoint))
+	}
+	if config.Insecure {
+		options = append(options, otlptracehttp.WithInsecure())
+	}
+
+	exporter, err := otlptracehttp.New(ctx, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(semconv.ServiceName(config.ServiceName)))
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(float64(config.SamplePercent)/100))),
+	)
+
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	return provider.Shutdown, nil
+}
+
+// Span is an OpenTelemetry span mirrored as runtime/trace task or region.
+type Span struct {
+	span   trace.Span
+	task   *rtrace.Task
+	region *rtrace.Region
+}
+
+// Start starts a span (and runtime/trace task) of an operation, the returned ctx carries both for nested spans.
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, Span) {
+	ctx, task := rtrace.NewTask(ctx, name)
+	ctx, span := tracer.Start(ctx, name, trace.WithAttributes(attrs...))
+
+	return ctx, Span{span: span, task: task}
+}
+
+// StartHTTP starts a server span (and runtime/trace task) of the request to the route, continuing the trace of the
+// client if it propagated one (W3C traceparent header).
+func StartHTTP(req *http.Request, route string) (context.Context, Span) {
+	ctx := otel.GetTextMapPropagator().Extract(req.Context(), propagation.HeaderCarrier(req.Header))
+	name := req.Method + " " + route
+
+	ctx, task := rtrace.NewTask(ctx, name)
+	ctx, span := tracer.Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			semconv.HTTPRequestMethodKey.String(req.Method),
+			semconv.HTTPRoute(route),
+			semconv.URLPath(req.URL.Path),
+		))
+
+	return ctx, Span{span: span, task: task}
+}
+
+// SetHTTPStatus records the response status of a span started by StartHTTP, server errors mark it as failed.
+func (s Span) SetHTTPStatus(status int) {
+	s.span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+
+	if status >= http.StatusInternalServerError {
+		s.span.SetStatus(codes.Error, http.StatusText(status))
+	}
+}
+
+// Region starts a span (and runtime/trace region) of a step within the operation of ctx, e.g. a single statement.
+// Like the runtime/trace region, it must be ended within the same goroutine.
+func Region(ctx context.Context, name string, attrs ...attribute.KeyValue) Span {
+	region := rtrace.StartRegion(ctx, name)
+	_, span := tracer.Start(ctx, name, trace.WithAttributes(attrs...))
+
+	return Span{span: span, region: region}
+}
+
+// SetAttributes annotates the span, e.g. with the decision taken.
+func (s Span) SetAttributes(attrs ...attribute.KeyValue) {
+	s.span.SetAttributes(attrs...)
+}
+
+// RecordError marks the span as failed, nil errors are ignored.
+func (s Span) RecordError(err error) {
+	if err == nil {
+		return
+	}
+
+	s.span.RecordError(err)
+	s.span.SetStatus(codes.Error, err.Error())
+}
+
+func (s Span) End() {
+	s.span.End()
+
+	if s.task != nil {
+		s.task.End()
+	}
+
+	if s.region != nil {
+		s.region.End()
+	}
+}
@@ -0,0 +1,76 @@
+package tracing_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/allaboutapps/integresql/pkg/tracing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestInit(t *testing.T) {
+	shutdown, err := tracing.Init(context.Background(), tracing.Config{Exporter: tracing.ExporterNone})
+	require.NoError(t, err)
+	assert.NoError(t, shutdown(context.Background()))
+
+	_, err = tracing.Init(context.Background(), tracing.Config{Exporter: "zipkin"})
+	assert.ErrorIs(t, err, tracing.ErrUnknownExporter)
+}
+
+func TestSpans(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	// continues the trace of the client
+	client := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{1},
+		SpanID:     trace.SpanID{2},
+		TraceFlags: trace.FlagsSampled,
+	})
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/templates/hash/tests", nil)
+	otel.GetTextMapPropagator().Inject(trace.ContextWithRemoteSpanContext(context.Background(), client), propagation.HeaderCarrier(req.Header))
+
+	ctx, request := tracing.StartHTTP(req, "/api/v1/templates/:hash/tests")
+
+	ctx, operation := tracing.Start(ctx, "get_test_db", attribute.String("hash", "hash"))
+	region := tracing.Region(ctx, "create_db")
+	region.RecordError(errors.New("boom"))
+	region.End()
+	operation.End()
+
+	request.SetHTTPStatus(http.StatusServiceUnavailable)
+	request.End()
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 3)
+
+	byName := make(map[string]tracetest.SpanStub)
+	for _, span := range spans {
+		byName[span.Name] = span
+		assert.Equal(t, client.TraceID(), span.SpanContext.TraceID())
+	}
+
+	server := byName["GET /api/v1/templates/:hash/tests"]
+	assert.Equal(t, client.SpanID(), server.Parent.SpanID())
+	assert.Equal(t, trace.SpanKindServer, server.SpanKind)
+	assert.Equal(t, codes.Error, server.Status.Code)
+
+	assert.Equal(t, server.SpanContext.SpanID(), byName["get_test_db"].Parent.SpanID())
+	assert.Contains(t, byName["get_test_db"].Attributes, attribute.String("hash", "hash"))
+
+	assert.Equal(t, byName["get_test_db"].SpanContext.SpanID(), byName["create_db"].Parent.SpanID())
+	assert.Equal(t, codes.Error, byName["create_db"].Status.Code)
+	assert.Equal(t, "boom", byName["create_db"].Status.Description)
+}
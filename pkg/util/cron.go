@@ -0,0 +1,134 @@
+package util
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInvalidCronExpression = errors.New("invalid cron expression")
+
+// CronExpression is a standard 5 field cron expression ("minute hour day-of-month month day-of-week"), matching minutes.
+// Each field supports "*", single values, ranges ("1-5"), steps ("*/15", "0-30/10") and comma separated lists of those.
+// Names (e.g. "MON") are not supported, day-of-week 0 and 7 are both Sunday. As usual, if both day-of-month and
+// day-of-week are restricted, a time matches if either of them matches.
+type CronExpression struct {
+	expr string
+
+	minute, hour, dom, month, dow uint64 // bitsets of allowed values
+	domStar, dowStar              bool
+}
+
+type cronField struct {
+	min, max int
+}
+
+var cronFields = [5]cronField{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 7}}
+
+// ParseCronExpression parses the given 5 field cron expression.
+func ParseCronExpression(expr string) (CronExpression, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != len(cronFields) {
+		return CronExpression{}, fmt.Errorf("%w %q: expected %d fields, got %d", ErrInvalidCronExpression, expr, len(cronFields), len(fields))
+	}
+
+	var bits [5]uint64
+	for i, field := range fields {
+		b, err := parseCronField(field, cronFields[i])
+		if err != nil {
+			return CronExpression{}, fmt.Errorf("%w %q: %v", ErrInvalidCronExpression, expr, err)
+		}
+		bits[i] = b
+	}
+
+	// Sunday is both 0 and 7
+	if bits[4]&(1<<7) != 0 {
+		bits[4] |= 1
+	}
+
+	return CronExpression{
+		expr:    strings.Join(fields, " "),
+		minute:  bits[0],
+		hour:    bits[1],
+		dom:     bits[2],
+		month:   bits[3],
+		dow:     bits[4],
+		domStar: strings.HasPrefix(fields[2], "*"),
+		dowStar: strings.HasPrefix(fields[4], "*"),
+	}, nil
+}
+
+func parseCronField(field string, bounds cronField) (uint64, error) {
+	var bits uint64
+
+	for _, part := range strings.Split(field, ",") {
+		rangePart, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			var err error
+			rangePart = part[:i]
+			step, err = strconv.Atoi(part[i+1:])
+			if err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step in %q", part)
+			}
+		}
+
+		from, to := bounds.min, bounds.max
+		if rangePart != "*" {
+			var err error
+			bound := strings.SplitN(rangePart, "-", 2)
+
+			from, err = strconv.Atoi(bound[0])
+			if err != nil {
+				return 0, fmt.Errorf("invalid value in %q", part)
+			}
+
+			to = from
+			if len(bound) == 2 {
+				to, err = strconv.Atoi(bound[1])
+				if err != nil {
+					return 0, fmt.Errorf("invalid value in %q", part)
+				}
+			} else if step > 1 {
+				// "5/15" is short for "5-max/15"
+				to = bounds.max
+			}
+		}
+
+		if from < bounds.min || to > bounds.max || from > to {
+			return 0, fmt.Errorf("%q is out of range %d-%d", part, bounds.min, bounds.max)
+		}
+
+		for v := from; v <= to; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+
+	return bits, nil
+}
+
+// Matches returns true if the minute of the given time matches the expression.
+func (c CronExpression) Matches(t time.Time) bool {
+	if c.minute&(1<<uint(t.Minute())) == 0 || c.hour&(1<<uint(t.Hour())) == 0 || c.month&(1<<uint(t.Month())) == 0 {
+		return false
+	}
+
+	domMatch := c.dom&(1<<uint(t.Day())) != 0
+	dowMatch := c.dow&(1<<uint(t.Weekday())) != 0
+
+	if !c.domStar && !c.dowStar {
+		return domMatch || dowMatch
+	}
+
+	return domMatch && dowMatch
+}
+
+func (c CronExpression) String() string {
+	return c.expr
+}
+
+// MarshalText keeps the expression human readable within serialized configs.
+func (c CronExpression) MarshalText() ([]byte, error) {
+	return []byte(c.expr), nil
+}
@@ -0,0 +1,91 @@
+package util_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/allaboutapps/integresql/pkg/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCronExpression(t *testing.T) {
+	// Monday
+	monday := time.Date(2024, time.January, 15, 21, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		expr    string
+		t       time.Time
+		matches bool
+	}{
+		{"* * * * *", monday, true},
+		{"30 21 * * *", monday, true},
+		{"31 21 * * *", monday, false},
+		{"*/15 * * * *", monday, true},
+		{"*/20 * * * *", monday, false},
+		{"10/20 * * * *", monday, true},
+		{"* 0-6,20-23 * * 1-5", monday, true},
+		{"* 0-6,20-23 * * 1-5", monday.Add(-12 * time.Hour), false},
+		{"* * * * 0,6", monday, false},
+		{"* * * * 7", monday.AddDate(0, 0, 6), true}, // Sunday
+		{"* * * 2 *", monday, false},
+		// both day fields restricted, either matches
+		{"* * 1 * 1", monday, true},
+		{"* * 15 * 0", monday, true},
+		{"* * 1 * 0", monday, false},
+		// a single restricted day field must match
+		{"* * 1 * *", monday, false},
+		{"* * */2 * *", monday.AddDate(0, 0, 1), false},
+	}
+
+	for _, tt := range tests {
+		c, err := util.ParseCronExpression(tt.expr)
+		require.NoError(t, err, tt.expr)
+		assert.Equal(t, tt.matches, c.Matches(tt.t), "%s at %v", tt.expr, tt.t)
+	}
+
+	for _, invalid := range []string{"", "* * * *", "* * * * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "* * * 13 *", "* * * * 8", "5-1 * * * *", "*/0 * * * *", "a * * * *", "1-a * * * *"} {
+		_, err := util.ParseCronExpression(invalid)
+		assert.ErrorIs(t, err, util.ErrInvalidCronExpression, invalid)
+	}
+
+	c, err := util.ParseCronExpression("  0  22 * *   1-5 ")
+	require.NoError(t, err)
+	assert.Equal(t, "0 22 * * 1-5", c.String())
+
+	b, err := json.Marshal(util.MaintenanceSchedule{Windows: []util.CronExpression{c}})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"windows": ["0 22 * * 1-5"]}`, string(b))
+}
+
+func TestMaintenanceSchedule(t *testing.T) {
+	// Saturday
+	saturday := time.Date(2024, time.January, 20, 12, 0, 0, 0, time.UTC)
+
+	parse := func(exprs ...string) []util.CronExpression {
+		t.Helper()
+
+		parsed := make([]util.CronExpression, 0, len(exprs))
+		for _, expr := range exprs {
+			c, err := util.ParseCronExpression(expr)
+			require.NoError(t, err)
+			parsed = append(parsed, c)
+		}
+		return parsed
+	}
+
+	// no restrictions
+	assert.True(t, util.MaintenanceSchedule{}.Allowed(saturday))
+
+	nightsAndWeekends := util.MaintenanceSchedule{Windows: parse("* 0-6,20-23 * * 1-5", "* * * * 0,6")}
+	assert.True(t, nightsAndWeekends.Allowed(saturday))
+	assert.False(t, nightsAndWeekends.Allowed(saturday.AddDate(0, 0, 2))) // Monday noon
+
+	// quiet periods take precedence
+	nightsAndWeekends.QuietPeriods = parse("* 11-13 * * *")
+	assert.False(t, nightsAndWeekends.Allowed(saturday))
+	assert.True(t, nightsAndWeekends.Allowed(saturday.Add(2*time.Hour)))
+
+	assert.False(t, util.MaintenanceSchedule{QuietPeriods: parse("* * * * *")}.Allowed(saturday))
+}
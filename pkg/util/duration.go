@@ -0,0 +1,107 @@
+package util
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// DurationRecorder keeps track of recorded durations. Only the last n samples are kept for computing
+// percentiles, while count, min, max and mean take all recorded durations into account.
+type DurationRecorder struct {
+	samples []time.Duration
+	next    int
+
+	count int
+	total time.Duration
+	min   time.Duration
+	max   time.Duration
+
+	mutex sync.Mutex
+}
+
+// DurationSummary summarizes the durations recorded by a DurationRecorder in milliseconds.
+type DurationSummary struct {
+	Count  int     `json:"count"`
+	MinMs  float64 `json:"minMs"`
+	MaxMs  float64 `json:"maxMs"`
+	MeanMs float64 `json:"meanMs"`
+	P50Ms  float64 `json:"p50Ms"`
+	P90Ms  float64 `json:"p90Ms"`
+	P99Ms  float64 `json:"p99Ms"`
+}
+
+// NewDurationRecorder creates a new recorder keeping up to maxSamples samples for computing percentiles.
+func NewDurationRecorder(maxSamples int) *DurationRecorder {
+	if maxSamples < 1 {
+		maxSamples = 1
+	}
+
+	return &DurationRecorder{
+		samples: make([]time.Duration, 0, maxSamples),
+	}
+}
+
+// Record adds the given duration.
+func (r *DurationRecorder) Record(d time.Duration) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if len(r.samples) < cap(r.samples) {
+		r.samples = append(r.samples, d)
+	} else {
+		r.samples[r.next] = d
+	}
+	r.next = (r.next + 1) % cap(r.samples)
+
+	if r.count == 0 || d < r.min {
+		r.min = d
+	}
+	if d > r.max {
+		r.max = d
+	}
+
+	r.count++
+	r.total += d
+}
+
+// Summary returns the current summary of all recorded durations.
+func (r *DurationRecorder) Summary() DurationSummary {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.count == 0 {
+		return DurationSummary{}
+	}
+
+	sorted := make([]time.Duration, len(r.samples))
+	copy(sorted, r.samples)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	return DurationSummary{
+		Count:  r.count,
+		MinMs:  durationToMs(r.min),
+		MaxMs:  durationToMs(r.max),
+		MeanMs: durationToMs(r.total / time.Duration(r.count)),
+		P50Ms:  durationToMs(percentile(sorted, 0.5)),
+		P90Ms:  durationToMs(percentile(sorted, 0.9)),
+		P99Ms:  durationToMs(percentile(sorted, 0.99)),
+	}
+}
+
+// percentile uses the nearest-rank method on the already sorted durations.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	rank := int(p*float64(len(sorted))+0.5) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	if rank >= len(sorted) {
+		rank = len(sorted) - 1
+	}
+
+	return sorted[rank]
+}
+
+func durationToMs(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
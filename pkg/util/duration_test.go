@@ -0,0 +1,39 @@
+package util_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/allaboutapps/integresql/pkg/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDurationRecorder(t *testing.T) {
+	r := util.NewDurationRecorder(10)
+	assert.Equal(t, util.DurationSummary{}, r.Summary())
+
+	for i := 1; i <= 10; i++ {
+		r.Record(time.Duration(i) * time.Millisecond)
+	}
+
+	s := r.Summary()
+	assert.Equal(t, 10, s.Count)
+	assert.Equal(t, 1.0, s.MinMs)
+	assert.Equal(t, 10.0, s.MaxMs)
+	assert.Equal(t, 5.5, s.MeanMs)
+	assert.Equal(t, 5.0, s.P50Ms)
+	assert.Equal(t, 9.0, s.P90Ms)
+	assert.Equal(t, 10.0, s.P99Ms)
+
+	// only the last 10 samples are used for percentiles, min/max/mean respect all durations
+	for i := 0; i < 10; i++ {
+		r.Record(100 * time.Millisecond)
+	}
+
+	s = r.Summary()
+	assert.Equal(t, 20, s.Count)
+	assert.Equal(t, 1.0, s.MinMs)
+	assert.Equal(t, 100.0, s.MaxMs)
+	assert.Equal(t, 52.75, s.MeanMs)
+	assert.Equal(t, 100.0, s.P50Ms)
+}
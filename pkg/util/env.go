@@ -3,6 +3,7 @@ package util
 import (
 	"os"
 	"strconv"
+	"strings"
 )
 
 func GetEnv(key string, defaultVal string) string {
@@ -32,3 +33,26 @@ func GetEnvAsBool(key string, defaultVal bool) bool {
 
 	return defaultVal
 }
+
+// GetEnvAsStringArr splits the env var by the separator (defaults to ","), trimming all values and skipping empty ones.
+func GetEnvAsStringArr(key string, defaultVal []string, separator ...string) []string {
+	strVal := GetEnv(key, "")
+
+	if len(strVal) == 0 {
+		return defaultVal
+	}
+
+	sep := ","
+	if len(separator) >= 1 {
+		sep = separator[0]
+	}
+
+	vals := make([]string, 0)
+	for _, val := range strings.Split(strVal, sep) {
+		if val = strings.TrimSpace(val); len(val) > 0 {
+			vals = append(vals, val)
+		}
+	}
+
+	return vals
+}
@@ -0,0 +1,63 @@
+package util
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/rs/zerolog"
+)
+
+// Logger receives the structured log entries of the manager and its pools, e.g. to forward them into the logging
+// setup of an application embedding integresql. See NewZerologLogger and NewSlogLogger for adapters.
+type Logger interface {
+	Log(ctx context.Context, level zerolog.Level, msg string, fields map[string]interface{})
+}
+
+type zerologLogger struct {
+	logger zerolog.Logger
+}
+
+// NewZerologLogger returns a Logger writing all entries to the given zerolog logger.
+func NewZerologLogger(logger zerolog.Logger) Logger {
+	return zerologLogger{logger: logger}
+}
+
+func (l zerologLogger) Log(_ context.Context, level zerolog.Level, msg string, fields map[string]interface{}) {
+	l.logger.WithLevel(level).Fields(fields).Msg(msg)
+}
+
+// LogFromContextWith returns a zerolog instance forwarding all entries to the given Logger.
+// If the Logger is nil, the one of the context is returned, see `util.LogFromContext`.
+func LogFromContextWith(ctx context.Context, logger Logger) *zerolog.Logger {
+	if logger == nil {
+		return LogFromContext(ctx)
+	}
+
+	l := zerolog.New(loggerWriter{ctx: ctx, logger: logger})
+	return &l
+}
+
+// loggerWriter decodes the JSON entries written by zerolog and passes them on to the Logger.
+type loggerWriter struct {
+	ctx    context.Context //nolint:containedctx
+	logger Logger
+}
+
+func (w loggerWriter) Write(p []byte) (int, error) {
+	return w.WriteLevel(zerolog.NoLevel, p)
+}
+
+func (w loggerWriter) WriteLevel(level zerolog.Level, p []byte) (int, error) {
+	fields := make(map[string]interface{})
+	if err := json.Unmarshal(p, &fields); err != nil {
+		return 0, err
+	}
+
+	msg, _ := fields[zerolog.MessageFieldName].(string)
+	delete(fields, zerolog.MessageFieldName)
+	delete(fields, zerolog.LevelFieldName)
+
+	w.logger.Log(w.ctx, level, msg, fields)
+
+	return len(p), nil
+}
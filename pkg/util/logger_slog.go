@@ -0,0 +1,52 @@
+//go:build go1.21
+
+package util
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+
+	"github.com/rs/zerolog"
+)
+
+type slogLogger struct {
+	logger *slog.Logger
+}
+
+// NewSlogLogger returns a Logger writing all entries to the given slog logger.
+func NewSlogLogger(logger *slog.Logger) Logger {
+	return slogLogger{logger: logger}
+}
+
+func (l slogLogger) Log(ctx context.Context, level zerolog.Level, msg string, fields map[string]interface{}) {
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	attrs := make([]slog.Attr, 0, len(keys))
+	for _, key := range keys {
+		attrs = append(attrs, slog.Any(key, fields[key]))
+	}
+
+	l.logger.LogAttrs(ctx, slogLevel(level), msg, attrs...)
+}
+
+func slogLevel(level zerolog.Level) slog.Level {
+	switch level {
+	case zerolog.TraceLevel:
+		return slog.LevelDebug - 4
+	case zerolog.DebugLevel:
+		return slog.LevelDebug
+	case zerolog.WarnLevel:
+		return slog.LevelWarn
+	case zerolog.ErrorLevel:
+		return slog.LevelError
+	case zerolog.FatalLevel, zerolog.PanicLevel:
+		return slog.LevelError + 4
+	default:
+		return slog.LevelInfo
+	}
+}
@@ -0,0 +1,33 @@
+//go:build go1.21
+
+package util_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"github.com/allaboutapps/integresql/pkg/util"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSlogLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := util.NewSlogLogger(slog.New(slog.NewJSONHandler(&buf, nil)))
+
+	// below the default level of the handler
+	logger.Log(context.Background(), zerolog.DebugLevel, "got testdatabase", nil)
+	assert.Zero(t, buf.Len())
+
+	logger.Log(context.Background(), zerolog.WarnLevel, "slow operation", map[string]interface{}{"operation": "create_db"})
+
+	var entry map[string]interface{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+	assert.Equal(t, "WARN", entry["level"])
+	assert.Equal(t, "slow operation", entry["msg"])
+	assert.Equal(t, "create_db", entry["operation"])
+}
@@ -0,0 +1,65 @@
+package util_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+
+	"github.com/allaboutapps/integresql/pkg/util"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type logEntry struct {
+	level  zerolog.Level
+	msg    string
+	fields map[string]interface{}
+}
+
+type recordingLogger struct {
+	mutex   sync.Mutex
+	entries []logEntry
+}
+
+func (l *recordingLogger) Log(_ context.Context, level zerolog.Level, msg string, fields map[string]interface{}) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.entries = append(l.entries, logEntry{level: level, msg: msg, fields: fields})
+}
+
+func TestLogFromContextWith(t *testing.T) {
+	ctx := context.Background()
+
+	// without a logger, the one of the context is used
+	assert.Equal(t, util.LogFromContext(ctx), util.LogFromContextWith(ctx, nil))
+
+	logger := &recordingLogger{}
+	log := util.LogFromContextWith(ctx, logger).With().Str("poolFn", "test").Logger()
+
+	log.Warn().Int("id", 3).Msg("slow operation")
+	log.Info().Msg("pool created")
+
+	require.Len(t, logger.entries, 2)
+	assert.Equal(t, zerolog.WarnLevel, logger.entries[0].level)
+	assert.Equal(t, "slow operation", logger.entries[0].msg)
+	assert.Equal(t, map[string]interface{}{"poolFn": "test", "id": 3.0}, logger.entries[0].fields)
+	assert.Equal(t, zerolog.InfoLevel, logger.entries[1].level)
+	assert.Equal(t, "pool created", logger.entries[1].msg)
+}
+
+func TestZerologLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := util.NewZerologLogger(zerolog.New(&buf))
+
+	logger.Log(context.Background(), zerolog.ErrorLevel, "background task failed", map[string]interface{}{"task": "reaper"})
+
+	var entry map[string]interface{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+	assert.Equal(t, "error", entry["level"])
+	assert.Equal(t, "background task failed", entry["message"])
+	assert.Equal(t, "reaper", entry["task"])
+}
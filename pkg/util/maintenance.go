@@ -0,0 +1,33 @@
+package util
+
+import (
+	"time"
+)
+
+// MaintenanceSchedule restricts background maintenance (e.g. recreating old test databases, probing idle ones or
+// discarding idle ephemeral templates) to certain times. User facing operations are never restricted.
+type MaintenanceSchedule struct {
+	Windows      []CronExpression `json:"windows,omitempty"`      // maintenance is allowed during the minutes matching any of them, anytime if empty
+	QuietPeriods []CronExpression `json:"quietPeriods,omitempty"` // maintenance is never allowed during the minutes matching any of them, even within a window
+}
+
+// Allowed returns true if background maintenance may run at the given time.
+func (s MaintenanceSchedule) Allowed(t time.Time) bool {
+	for _, quiet := range s.QuietPeriods {
+		if quiet.Matches(t) {
+			return false
+		}
+	}
+
+	if len(s.Windows) == 0 {
+		return true
+	}
+
+	for _, window := range s.Windows {
+		if window.Matches(t) {
+			return true
+		}
+	}
+
+	return false
+}
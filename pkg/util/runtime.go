@@ -0,0 +1,39 @@
+package util
+
+import (
+	"runtime"
+	"time"
+)
+
+// RuntimeStats is a snapshot of the health of the Go runtime (e.g. to spot goroutine or memory leaks of long-running servers).
+type RuntimeStats struct {
+	Goroutines     int     `json:"goroutines"`
+	HeapAllocBytes uint64  `json:"heapAllocBytes"` // bytes of allocated heap objects
+	HeapSysBytes   uint64  `json:"heapSysBytes"`   // bytes of heap memory obtained from the OS
+	HeapObjects    uint64  `json:"heapObjects"`
+	NumGC          uint32  `json:"numGC"`          // number of completed GC cycles
+	GCPauseTotalMs float64 `json:"gcPauseTotalMs"` // cumulative stop-the-world pauses since the start
+	LastGCPauseMs  float64 `json:"lastGCPauseMs"`  // pause of the most recent GC cycle
+}
+
+// ReadRuntimeStats reads the current runtime stats. Reading the memory stats briefly stops the world, don't call
+// it in hot paths.
+func ReadRuntimeStats() RuntimeStats {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	stats := RuntimeStats{
+		Goroutines:     runtime.NumGoroutine(),
+		HeapAllocBytes: mem.HeapAlloc,
+		HeapSysBytes:   mem.HeapSys,
+		HeapObjects:    mem.HeapObjects,
+		NumGC:          mem.NumGC,
+		GCPauseTotalMs: float64(mem.PauseTotalNs) / float64(time.Millisecond),
+	}
+
+	if mem.NumGC > 0 {
+		stats.LastGCPauseMs = float64(mem.PauseNs[(mem.NumGC+255)%256]) / float64(time.Millisecond)
+	}
+
+	return stats
+}
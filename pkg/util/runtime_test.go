@@ -0,0 +1,20 @@
+package util_test
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/allaboutapps/integresql/pkg/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadRuntimeStats(t *testing.T) {
+	runtime.GC()
+
+	stats := util.ReadRuntimeStats()
+	assert.GreaterOrEqual(t, stats.Goroutines, 1)
+	assert.Greater(t, stats.HeapAllocBytes, uint64(0))
+	assert.GreaterOrEqual(t, stats.HeapSysBytes, stats.HeapAllocBytes)
+	assert.GreaterOrEqual(t, stats.NumGC, uint32(1))
+	assert.GreaterOrEqual(t, stats.GCPauseTotalMs, stats.LastGCPauseMs)
+}
@@ -0,0 +1,141 @@
+package util
+
+import (
+	"container/heap"
+	"context"
+	"sync"
+)
+
+// PrioritySemaphore limits the number of concurrently held slots. Waiters with a higher priority are granted a free slot
+// first, waiters with the same priority in FIFO order. A nil PrioritySemaphore is unlimited.
+type PrioritySemaphore struct {
+	slots   int
+	used    int
+	waiters semaphoreWaiters
+	seq     uint64
+
+	mutex sync.Mutex
+}
+
+// NewPrioritySemaphore creates a semaphore with the given number of slots, returns nil (unlimited) if slots <= 0.
+func NewPrioritySemaphore(slots int) *PrioritySemaphore {
+	if slots <= 0 {
+		return nil
+	}
+
+	return &PrioritySemaphore{slots: slots}
+}
+
+type semaphoreWaiter struct {
+	priority int
+	seq      uint64
+	granted  bool
+	ready    chan struct{}
+	index    int
+}
+
+// Acquire blocks until a slot is granted or the ctx is done. Each successful Acquire must be followed by a Release.
+func (s *PrioritySemaphore) Acquire(ctx context.Context, priority int) error {
+	if s == nil {
+		return nil
+	}
+
+	s.mutex.Lock()
+	if s.used < s.slots && len(s.waiters) == 0 {
+		s.used++
+		s.mutex.Unlock()
+		return nil
+	}
+
+	w := &semaphoreWaiter{priority: priority, seq: s.seq, ready: make(chan struct{})}
+	s.seq++
+	heap.Push(&s.waiters, w)
+	s.mutex.Unlock()
+
+	select {
+	case <-w.ready:
+		return nil
+	case <-ctx.Done():
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+
+		if w.granted {
+			// granted meanwhile, pass the slot on
+			s.unsafeRelease()
+		} else {
+			heap.Remove(&s.waiters, w.index)
+		}
+
+		return ctx.Err()
+	}
+}
+
+// Release frees a slot, handing it to the waiter with the highest priority (if any).
+func (s *PrioritySemaphore) Release() {
+	if s == nil {
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.unsafeRelease()
+}
+
+func (s *PrioritySemaphore) unsafeRelease() {
+	if len(s.waiters) == 0 {
+		s.used--
+		return
+	}
+
+	w := heap.Pop(&s.waiters).(*semaphoreWaiter)
+	w.granted = true
+	close(w.ready)
+}
+
+// Waiting returns the number of currently blocked Acquire calls.
+func (s *PrioritySemaphore) Waiting() int {
+	if s == nil {
+		return 0
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return len(s.waiters)
+}
+
+// semaphoreWaiters implements heap.Interface, highest priority (then lowest seq) first.
+type semaphoreWaiters []*semaphoreWaiter
+
+func (w semaphoreWaiters) Len() int { return len(w) }
+
+func (w semaphoreWaiters) Less(i, j int) bool {
+	if w[i].priority != w[j].priority {
+		return w[i].priority > w[j].priority
+	}
+
+	return w[i].seq < w[j].seq
+}
+
+func (w semaphoreWaiters) Swap(i, j int) {
+	w[i], w[j] = w[j], w[i]
+	w[i].index = i
+	w[j].index = j
+}
+
+func (w *semaphoreWaiters) Push(x interface{}) {
+	waiter := x.(*semaphoreWaiter)
+	waiter.index = len(*w)
+	*w = append(*w, waiter)
+}
+
+func (w *semaphoreWaiters) Pop() interface{} {
+	old := *w
+	n := len(old)
+	waiter := old[n-1]
+	old[n-1] = nil
+	*w = old[:n-1]
+
+	return waiter
+}
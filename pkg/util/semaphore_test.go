@@ -0,0 +1,75 @@
+package util_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/allaboutapps/integresql/pkg/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrioritySemaphore(t *testing.T) {
+	ctx := context.Background()
+
+	s := util.NewPrioritySemaphore(1)
+	require.NoError(t, s.Acquire(ctx, 0))
+
+	var mutex sync.Mutex
+	granted := make([]int, 0)
+
+	var wg sync.WaitGroup
+	waiting := 0
+	acquire := func(priority int) {
+		waiting++
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			require.NoError(t, s.Acquire(ctx, priority))
+
+			mutex.Lock()
+			granted = append(granted, priority)
+			mutex.Unlock()
+
+			s.Release()
+		}()
+
+		// enqueue the waiters one after another
+		require.Eventually(t, func() bool { return s.Waiting() == waiting }, time.Second, time.Millisecond)
+	}
+
+	// no waiter is granted before the slot is released
+	acquire(1)
+	acquire(10)
+	acquire(1)
+	acquire(5)
+
+	// waiters giving up don't hold a slot
+	cancelCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, s.Acquire(cancelCtx, 100), context.DeadlineExceeded)
+	assert.Equal(t, 4, s.Waiting())
+
+	s.Release()
+	wg.Wait()
+
+	assert.Equal(t, []int{10, 5, 1, 1}, granted)
+	assert.Equal(t, 0, s.Waiting())
+
+	// all slots are free again
+	require.NoError(t, s.Acquire(ctx, 0))
+	s.Release()
+}
+
+func TestPrioritySemaphoreUnlimited(t *testing.T) {
+	s := util.NewPrioritySemaphore(0)
+	assert.Nil(t, s)
+
+	for i := 0; i < 10; i++ {
+		require.NoError(t, s.Acquire(context.Background(), 0))
+	}
+	s.Release()
+	assert.Equal(t, 0, s.Waiting())
+}
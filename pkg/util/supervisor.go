@@ -0,0 +1,144 @@
+package util
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// Supervisor owns background tasks, which are all bound to the same context and are canceled/awaited together via Stop.
+// Errors returned by tasks never affect other tasks, they are aggregated per task name instead (see Errors) and
+// passed to the optional onError callback.
+// A supervisor may be restarted after it was stopped, aggregated errors are kept.
+type Supervisor struct {
+	onError    func(task string, err error)
+	ignoreErrs []error
+
+	group   *errgroup.Group
+	ctx     context.Context
+	cancel  context.CancelFunc
+	running bool
+
+	errors map[string]TaskErrors
+	mutex  sync.Mutex
+}
+
+// TaskErrors summarizes the errors of a supervised background task.
+type TaskErrors struct {
+	Count       int       `json:"count"`
+	LastError   string    `json:"lastError"`
+	LastErrorAt time.Time `json:"lastErrorAt"`
+}
+
+// NewSupervisor creates a new (not yet started) supervisor. Task errors matching any of ignoreErrs (errors.Is) are neither
+// aggregated nor passed to onError.
+func NewSupervisor(onError func(task string, err error), ignoreErrs ...error) *Supervisor {
+	return &Supervisor{
+		onError:    onError,
+		ignoreErrs: ignoreErrs,
+		errors:     make(map[string]TaskErrors),
+	}
+}
+
+// Start starts the supervisor, all tasks will receive a context derived from the given one.
+// Returns false if the supervisor is already running.
+func (s *Supervisor) Start(ctx context.Context) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.running {
+		return false
+	}
+
+	s.ctx, s.cancel = context.WithCancel(ctx)
+	s.group = &errgroup.Group{}
+	s.running = true
+
+	return true
+}
+
+// Go runs the task in background. Returns false (and doesn't run the task) if the supervisor is not running.
+func (s *Supervisor) Go(task string, f func(ctx context.Context) error) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if !s.running {
+		return false
+	}
+
+	ctx := s.ctx
+	s.group.Go(func() error {
+		err := f(ctx)
+		s.Report(task, err)
+		return err
+	})
+
+	return true
+}
+
+// Report records an error of the given task, which did not cause the task to end (e.g. within a long running loop).
+// Nil and ignored errors are skipped.
+func (s *Supervisor) Report(task string, err error) {
+	if err == nil {
+		return
+	}
+
+	for _, ignore := range s.ignoreErrs {
+		if errors.Is(err, ignore) {
+			return
+		}
+	}
+
+	s.mutex.Lock()
+	taskErrors := s.errors[task]
+	taskErrors.Count++
+	taskErrors.LastError = err.Error()
+	taskErrors.LastErrorAt = time.Now()
+	s.errors[task] = taskErrors
+	s.mutex.Unlock()
+
+	if s.onError != nil {
+		s.onError(task, err)
+	}
+}
+
+// Stop cancels the context of all tasks and waits until they have finished.
+// Returns the first error returned by a task since the supervisor was started (ignored errors included).
+func (s *Supervisor) Stop() error {
+	s.mutex.Lock()
+	if !s.running {
+		s.mutex.Unlock()
+		return nil
+	}
+
+	s.running = false
+	s.cancel()
+	group := s.group
+	s.mutex.Unlock()
+
+	return group.Wait()
+}
+
+// Running returns true if the supervisor was started and not yet stopped.
+func (s *Supervisor) Running() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.running
+}
+
+// Errors returns the aggregated errors per task.
+func (s *Supervisor) Errors() map[string]TaskErrors {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	errs := make(map[string]TaskErrors, len(s.errors))
+	for task, taskErrors := range s.errors {
+		errs[task] = taskErrors
+	}
+
+	return errs
+}
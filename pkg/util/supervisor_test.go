@@ -0,0 +1,68 @@
+package util_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/allaboutapps/integresql/pkg/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSupervisor(t *testing.T) {
+	errIgnored := errors.New("ignored")
+	errFailed := errors.New("failed")
+
+	var mutex sync.Mutex
+	reported := make([]string, 0)
+	s := util.NewSupervisor(func(task string, err error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		reported = append(reported, task+": "+err.Error())
+	}, errIgnored)
+
+	// not yet started
+	assert.False(t, s.Go("noop", func(ctx context.Context) error { return nil }))
+	assert.NoError(t, s.Stop())
+
+	require.True(t, s.Start(context.Background()))
+	assert.False(t, s.Start(context.Background()))
+	assert.True(t, s.Running())
+
+	assert.True(t, s.Go("fail", func(ctx context.Context) error { return errFailed }))
+	assert.True(t, s.Go("fail", func(ctx context.Context) error { return errFailed }))
+	assert.True(t, s.Go("ignore", func(ctx context.Context) error { return errIgnored }))
+	assert.True(t, s.Go("loop", func(ctx context.Context) error {
+		s.Report("loop", errFailed)
+		<-ctx.Done()
+		return ctx.Err()
+	}))
+
+	// a failing task does not cancel the others
+	time.Sleep(10 * time.Millisecond)
+	assert.True(t, s.Running())
+
+	assert.Error(t, s.Stop())
+	assert.False(t, s.Running())
+	assert.False(t, s.Go("noop", func(ctx context.Context) error { return nil }))
+
+	errs := s.Errors()
+	assert.Len(t, errs, 2)
+	assert.Equal(t, 2, errs["fail"].Count)
+	assert.Equal(t, errFailed.Error(), errs["fail"].LastError)
+	assert.False(t, errs["fail"].LastErrorAt.IsZero())
+	assert.Equal(t, 2, errs["loop"].Count) // reported one and context.Canceled
+	assert.NotContains(t, errs, "ignore")
+
+	mutex.Lock()
+	assert.Len(t, reported, 4)
+	mutex.Unlock()
+
+	// errors are kept after restarting
+	require.True(t, s.Start(context.Background()))
+	assert.Equal(t, 2, s.Errors()["fail"].Count)
+	assert.NoError(t, s.Stop())
+}
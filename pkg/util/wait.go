@@ -11,6 +11,7 @@ import (
 var ErrTimeout = errors.New("timeout while waiting for operation to complete")
 
 // WaitWithTimeout waits for the operation to complete of returns the ErrTimeout.
+// If the given context is cancelled before, the function returns directly with its error.
 func WaitWithTimeout[T any](ctx context.Context, timeout time.Duration, operation func(context.Context) (T, error)) (T, error) {
 	cctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
@@ -30,6 +31,9 @@ func WaitWithTimeout[T any](ctx context.Context, timeout time.Duration, operatio
 	case <-time.After(timeout):
 		var empty T
 		return empty, ErrTimeout
+	case <-ctx.Done():
+		var empty T
+		return empty, ctx.Err()
 	}
 }
 
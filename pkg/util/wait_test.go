@@ -51,4 +51,18 @@ func TestWaitWithTimeout(t *testing.T) {
 	assert.ErrorIs(t, err, testErr)
 	assert.Empty(t, res)
 	assert.Less(t, elapsed, 120*time.Millisecond)
+
+	// context cancelled before the timeout
+	cctx, cancel := context.WithCancel(ctx)
+	time.AfterFunc(50*time.Millisecond, cancel)
+	start = time.Now()
+	res, err = util.WaitWithTimeout(cctx, time.Second, func(ctx context.Context) (output, error) {
+		time.Sleep(time.Millisecond * 200)
+		return output{A: 1}, nil
+	})
+	elapsed = time.Since(start)
+
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Empty(t, res)
+	assert.Less(t, elapsed, 150*time.Millisecond)
 }
@@ -0,0 +1,137 @@
+// Package webhook delivers JSON notifications (e.g. a template became ready) to URLs registered by clients.
+//
+// If a secret is configured, each request carries the HMAC-SHA256 of its body in the SignatureHeader
+// ("sha256=<hex>"), receivers verify it via Verify before trusting the payload.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+var (
+	ErrInvalidURL       = errors.New("invalid webhook url")
+	ErrDeliveryRejected = errors.New("webhook delivery rejected")
+)
+
+const (
+	EventHeader     = "X-IntegreSQL-Event"
+	SignatureHeader = "X-IntegreSQL-Signature"
+
+	signaturePrefix = "sha256="
+)
+
+type Config struct {
+	Secret   string        `json:"-"` // sensitive, key of the HMAC signature (empty sends unsigned requests)
+	Timeout  time.Duration // Timeout of a single delivery attempt
+	Attempts int           // Number of delivery attempts, failed ones are retried with exponential backoff
+	Backoff  time.Duration // Sleep after the first failed attempt, doubled after each further one
+}
+
+// ValidURL returns an error if the webhook can't be delivered to the URL (absolute http(s) URLs only).
+func ValidURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidURL, err)
+	}
+
+	if (u.Scheme != "http" && u.Scheme != "https") || len(u.Host) == 0 {
+		return fmt.Errorf("%w: %q is no absolute http(s) url", ErrInvalidURL, rawURL)
+	}
+
+	return nil
+}
+
+// Sign returns the signature of the body sent in the SignatureHeader.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify returns true if the signature (value of the SignatureHeader) matches the body.
+func Verify(secret string, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, body)), []byte(signature))
+}
+
+type Client struct {
+	config Config
+	http   *http.Client
+}
+
+func NewClient(config Config) *Client {
+	if config.Attempts < 1 {
+		config.Attempts = 1
+	}
+
+	return &Client{config: config, http: &http.Client{}}
+}
+
+// Deliver posts the JSON body of the event to the URL until it is accepted (2xx), all attempts failed or ctx is done.
+func (c *Client) Deliver(ctx context.Context, rawURL string, event string, body []byte) error {
+	backoff := c.config.Backoff
+
+	var err error
+	for attempt := 1; attempt <= c.config.Attempts; attempt++ {
+		if err = c.post(ctx, rawURL, event, body); err == nil {
+			return nil
+		}
+
+		if attempt == c.config.Attempts {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+			backoff *= 2
+		}
+	}
+
+	return fmt.Errorf("delivering %s to %s failed after %d attempts: %w", event, rawURL, c.config.Attempts, err)
+}
+
+func (c *Client) post(ctx context.Context, rawURL string, event string, body []byte) error {
+	if c.config.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.config.Timeout)
+		defer cancel()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, rawURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, event)
+	if len(c.config.Secret) > 0 {
+		req.Header.Set(SignatureHeader, Sign(c.config.Secret, body))
+	}
+
+	res, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	// drain the body, the connection may be reused
+	_, _ = io.Copy(io.Discard, res.Body)
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("%w: status %d", ErrDeliveryRejected, res.StatusCode)
+	}
+
+	return nil
+}
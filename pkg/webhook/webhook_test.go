@@ -0,0 +1,67 @@
+package webhook_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/allaboutapps/integresql/pkg/webhook"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidURL(t *testing.T) {
+	assert.NoError(t, webhook.ValidURL("https://ci.example.com/hooks/templates?stage=test"))
+	assert.NoError(t, webhook.ValidURL("http://localhost:8080/ready"))
+
+	assert.ErrorIs(t, webhook.ValidURL("ci.example.com/hooks"), webhook.ErrInvalidURL)
+	assert.ErrorIs(t, webhook.ValidURL("ftp://ci.example.com/hooks"), webhook.ErrInvalidURL)
+	assert.ErrorIs(t, webhook.ValidURL("https://"), webhook.ErrInvalidURL)
+	assert.ErrorIs(t, webhook.ValidURL("://"), webhook.ErrInvalidURL)
+}
+
+func TestSignVerify(t *testing.T) {
+	body := []byte(`{"event":"template.ready"}`)
+	signature := webhook.Sign("secret", body)
+
+	assert.Regexp(t, "^sha256=[0-9a-f]{64}$", signature)
+	assert.True(t, webhook.Verify("secret", body, signature))
+	assert.False(t, webhook.Verify("other", body, signature))
+	assert.False(t, webhook.Verify("secret", []byte(`{"event":"template.failed"}`), signature))
+}
+
+func TestDeliver(t *testing.T) {
+	body := []byte(`{"event":"template.ready"}`)
+
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+		assert.Equal(t, body, received)
+		assert.Equal(t, "template.ready", r.Header.Get(webhook.EventHeader))
+		assert.True(t, webhook.Verify("secret", received, r.Header.Get(webhook.SignatureHeader)))
+
+		// the first attempt fails
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	client := webhook.NewClient(webhook.Config{Secret: "secret", Timeout: time.Second, Attempts: 2, Backoff: time.Millisecond})
+	require.NoError(t, client.Deliver(context.Background(), server.URL, "template.ready", body))
+	assert.Equal(t, int32(2), calls.Load())
+
+	// all attempts rejected
+	calls.Store(0)
+	client = webhook.NewClient(webhook.Config{Secret: "secret", Timeout: time.Second, Attempts: 1})
+	assert.ErrorIs(t, client.Deliver(context.Background(), server.URL, "template.ready", body), webhook.ErrDeliveryRejected)
+	assert.Equal(t, int32(1), calls.Load())
+}
@@ -14,8 +14,11 @@ import (
 	"net/http"
 	"net/url"
 	"path"
+	"strconv"
+	"time"
 
 	"github.com/allaboutapps/integresql/pkg/manager"
+	"github.com/allaboutapps/integresql/pkg/pool"
 	"github.com/allaboutapps/integresql/pkg/util"
 
 	// Import postgres driver for database/sql package
@@ -92,6 +95,27 @@ func (c *Client) ResetAllTracking(ctx context.Context) error {
 	return nil
 }
 
+func (c *Client) ResetTrackingWithLabel(ctx context.Context, label string) error {
+	req, err := c.newRequest(ctx, "DELETE", "/admin/templates", nil)
+	if err != nil {
+		return err
+	}
+
+	req.URL.RawQuery = url.Values{"label": []string{label}}.Encode()
+
+	var msg string
+	resp, err := c.do(req, &msg)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("failed to reset tracking with label %q: %v", label, msg)
+	}
+
+	return nil
+}
+
 func (c *Client) InitializeTemplate(ctx context.Context, hash string) (TemplateDatabase, error) {
 	var template TemplateDatabase
 
@@ -205,6 +229,22 @@ func (c *Client) FinalizeTemplate(ctx context.Context, hash string) error {
 }
 
 func (c *Client) GetTestDatabase(ctx context.Context, hash string) (TestDatabase, error) {
+	return c.getTestDatabase(ctx, hash, nil)
+}
+
+// GetTestDatabaseSkipClean accepts a dirty test database as-is (flagged via TestDatabase.Dirty), the caller is
+// responsible for resetting it.
+func (c *Client) GetTestDatabaseSkipClean(ctx context.Context, hash string) (TestDatabase, error) {
+	return c.getTestDatabase(ctx, hash, url.Values{"skipClean": []string{"true"}})
+}
+
+// GetTestDatabaseAtIndex acquires the test database with the given ID (index within the pool, created if absent),
+// e.g. to map CI worker k of n to the same test database run after run.
+func (c *Client) GetTestDatabaseAtIndex(ctx context.Context, hash string, index int) (TestDatabase, error) {
+	return c.getTestDatabase(ctx, hash, url.Values{"index": []string{strconv.Itoa(index)}})
+}
+
+func (c *Client) getTestDatabase(ctx context.Context, hash string, query url.Values) (TestDatabase, error) {
 	var test TestDatabase
 
 	req, err := c.newRequest(ctx, "GET", fmt.Sprintf("/templates/%s/tests", hash), nil)
@@ -212,6 +252,8 @@ func (c *Client) GetTestDatabase(ctx context.Context, hash string) (TestDatabase
 		return test, err
 	}
 
+	req.URL.RawQuery = query.Encode()
+
 	resp, err := c.do(req, &test)
 	if err != nil {
 		return test, err
@@ -224,6 +266,8 @@ func (c *Client) GetTestDatabase(ctx context.Context, hash string) (TestDatabase
 		return test, manager.ErrTemplateNotFound
 	case http.StatusGone:
 		return test, manager.ErrTestNotFound
+	case http.StatusRequestTimeout:
+		return test, manager.ErrDeadlineExceeded
 	case http.StatusServiceUnavailable:
 		return test, manager.ErrManagerNotReady
 	default:
@@ -254,6 +298,68 @@ func (c *Client) ReturnTestDatabase(ctx context.Context, hash string, id int) er
 	}
 }
 
+// RenewTestDatabase extends the lease of the checked out test database, preventing its auto-cleaning while a long
+// running test is still using it.
+func (c *Client) RenewTestDatabase(ctx context.Context, hash string, id int) (Lease, error) {
+	var lease Lease
+
+	req, err := c.newRequest(ctx, "POST", fmt.Sprintf("/templates/%s/tests/%d/renew", hash, id), nil)
+	if err != nil {
+		return lease, err
+	}
+
+	resp, err := c.do(req, &lease)
+	if err != nil {
+		return lease, err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return lease, nil
+	case http.StatusNotFound:
+		return lease, manager.ErrTemplateNotFound
+	case http.StatusConflict:
+		return lease, pool.ErrInvalidState
+	case http.StatusGone:
+		return lease, pool.ErrLeaseExpired
+	case http.StatusServiceUnavailable:
+		return lease, manager.ErrManagerNotReady
+	default:
+		return lease, fmt.Errorf("received unexpected HTTP status %d (%s)", resp.StatusCode, resp.Status)
+	}
+}
+
+// KeepAlive renews the lease of the checked out test database every interval (well below the lease renew duration of
+// the server) until the returned stop function is called (exactly once) or the ctx is done. Renewals stop on the first error (e.g. the
+// max lease duration was reached), which is returned by stop.
+func (c *Client) KeepAlive(ctx context.Context, hash string, id int, interval time.Duration) (stop func() error) {
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan error, 1)
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				done <- nil
+				return
+			case <-ticker.C:
+				if _, err := c.RenewTestDatabase(ctx, hash, id); err != nil && ctx.Err() == nil {
+					done <- err
+					return
+				}
+			}
+		}
+	}()
+
+	return func() error {
+		cancel()
+		return <-done
+	}
+}
+
 func (c *Client) newRequest(ctx context.Context, method string, endpoint string, body interface{}) (*http.Request, error) {
 	u := c.baseURL.ResolveReference(&url.URL{Path: path.Join(c.baseURL.Path, endpoint)})
 
@@ -276,6 +382,15 @@ func (c *Client) newRequest(ctx context.Context, method string, endpoint string,
 
 	req.Header.Set("Accept", "application/json")
 
+	// lets the server give up (with a precise error) before our own deadline is reached
+	if deadline, ok := ctx.Deadline(); ok {
+		remaining := time.Until(deadline).Milliseconds()
+		if remaining < 0 {
+			remaining = 0
+		}
+		req.Header.Set("X-Integresql-Deadline-Ms", strconv.FormatInt(remaining, 10))
+	}
+
 	return req, nil
 }
 
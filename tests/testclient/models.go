@@ -4,12 +4,21 @@ import (
 	"fmt"
 	"sort"
 	"strings"
+	"time"
 )
 
 type TestDatabase struct {
 	Database `json:"database"`
 
-	ID int `json:"id"`
+	ID    int   `json:"id"`
+	Seed  int64 `json:"seed"`
+	Dirty bool  `json:"dirty"`
+}
+
+// Lease of a checked out test database, see Client.RenewTestDatabase.
+type Lease struct {
+	ExpiresAt    *time.Time `json:"expiresAt"`    // nil if the test database is never auto-cleaned
+	MaxExpiresAt *time.Time `json:"maxExpiresAt"` // nil if renewals are unlimited
 }
 
 type TemplateDatabase struct {